@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Health reports whether the server is up
+func (c *Client) Health(ctx context.Context) error {
+	return c.doPublic(ctx, http.MethodGet, "/health", nil, nil)
+}
+
+// SetupStatus reports whether the first admin has been created
+func (c *Client) SetupStatus(ctx context.Context) (bool, error) {
+	var resp struct {
+		Completed bool `json:"completed"`
+	}
+	err := c.doPublic(ctx, http.MethodGet, "/setup", nil, &resp)
+	return resp.Completed, err
+}
+
+// Setup creates the first admin; it fails with ErrForbidden afterwards
+func (c *Client) Setup(ctx context.Context, username, password string) error {
+	body := map[string]string{"username": username, "password": password}
+	return c.doPublic(ctx, http.MethodPost, "/setup", body, nil)
+}
+
+// Login authenticates and stores the issued token on the client
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginResponse, error) {
+	resp, err := c.login(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.setTokenLocked(resp.Token)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *Client) login(ctx context.Context, username, password string) (*LoginResponse, error) {
+	var resp LoginResponse
+	body := map[string]string{"username": username, "password": password}
+	if err := c.doPublic(ctx, http.MethodPost, "/login", body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Refresh exchanges the current token for one with a new expiry. The client
+// does this on its own before tokens expire; call it to force a renewal.
+func (c *Client) Refresh(ctx context.Context) (*LoginResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshLocked(ctx)
+}
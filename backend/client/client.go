@@ -0,0 +1,278 @@
+// Package client is a typed Go client for the go-notes REST API.
+//
+// A Client holds a bearer token and renews it transparently: tokens close to
+// expiry are exchanged via POST /refresh, and when credentials are configured
+// a rejected or missing token triggers a fresh login followed by one retry.
+// API failures are returned as *APIError values that match the package's
+// sentinel errors with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshWindow is how long before expiry a token is renewed
+const DefaultRefreshWindow = 24 * time.Hour
+
+// Client talks to one go-notes server. It is safe for concurrent use.
+type Client struct {
+	baseURL       string
+	httpClient    *http.Client
+	refreshWindow time.Duration
+	onToken       func(token string)
+
+	username string
+	password string
+
+	mu    sync.Mutex
+	token string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken starts the client with an existing bearer token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithCredentials lets the client log in on demand and again whenever the
+// server rejects its token
+func WithCredentials(username, password string) Option {
+	return func(c *Client) { c.username, c.password = username, password }
+}
+
+// WithTokenHandler is called with every newly issued token, e.g. to persist it
+func WithTokenHandler(fn func(token string)) Option {
+	return func(c *Client) { c.onToken = fn }
+}
+
+// WithRefreshWindow sets how long before expiry a token is renewed; zero
+// disables proactive refresh
+func WithRefreshWindow(d time.Duration) Option {
+	return func(c *Client) { c.refreshWindow = d }
+}
+
+// New returns a client for the API rooted at baseURL, including any base
+// path the server is mounted under (e.g. "https://notes.example.com/test")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		httpClient:    http.DefaultClient,
+		refreshWindow: DefaultRefreshWindow,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the current bearer token, which may be empty
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken replaces the bearer token
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Do sends an authenticated request for endpoints without a typed method.
+// path is relative to the base URL; in is encoded as JSON when non-nil and
+// the response is decoded into out when non-nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	return c.do(ctx, method, path, nil, in, out)
+}
+
+// do performs an authenticated call, renewing the token before it expires
+// and logging in again once if the server rejects it
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	body, err := encode(in)
+	if err != nil {
+		return err
+	}
+	token, err := c.validToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.send(ctx, method, path, query, body, token, out)
+	if errors.Is(err, ErrUnauthorized) && c.username != "" {
+		if token, err = c.relogin(ctx, token); err != nil {
+			return err
+		}
+		err = c.send(ctx, method, path, query, body, token, out)
+	}
+	return err
+}
+
+// doPublic performs a call that needs no token
+func (c *Client) doPublic(ctx context.Context, method, path string, in, out any) error {
+	body, err := encode(in)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, nil, body, "", out)
+}
+
+func encode(in any) ([]byte, error) {
+	if in == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return body, nil
+}
+
+// send is a single HTTP round trip; the body is passed as bytes so a
+// request can be replayed after a re-login
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, token string, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return newAPIError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// validToken returns a token that is not about to expire, logging in or
+// refreshing as needed. A failed refresh falls back to the current token and
+// leaves the decision to the server.
+func (c *Client) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" {
+		if c.username == "" {
+			return "", nil
+		}
+		return c.loginLocked(ctx)
+	}
+	if c.refreshWindow <= 0 {
+		return c.token, nil
+	}
+	exp, ok := tokenExpiry(c.token)
+	if !ok || time.Until(exp) > c.refreshWindow {
+		return c.token, nil
+	}
+	if time.Now().Before(exp) {
+		if _, err := c.refreshLocked(ctx); err == nil {
+			return c.token, nil
+		}
+	}
+	if c.username != "" {
+		return c.loginLocked(ctx)
+	}
+	return c.token, nil
+}
+
+// relogin replaces a rejected token unless another caller already has
+func (c *Client) relogin(ctx context.Context, rejected string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != rejected {
+		return c.token, nil
+	}
+	return c.loginLocked(ctx)
+}
+
+func (c *Client) loginLocked(ctx context.Context) (string, error) {
+	resp, err := c.login(ctx, c.username, c.password)
+	if err != nil {
+		return "", err
+	}
+	c.setTokenLocked(resp.Token)
+	return resp.Token, nil
+}
+
+func (c *Client) refreshLocked(ctx context.Context) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.send(ctx, http.MethodPost, "/refresh", nil, nil, c.token, &resp); err != nil {
+		return nil, err
+	}
+	c.setTokenLocked(resp.Token)
+	return &resp, nil
+}
+
+func (c *Client) setTokenLocked(token string) {
+	c.token = token
+	if c.onToken != nil {
+		c.onToken(token)
+	}
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it; the server
+// stays the authority on validity
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+func itoa(n int) string {
+	return fmt.Sprint(n)
+}
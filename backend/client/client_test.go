@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeToken builds an unsigned JWT that only carries an expiry
+func fakeToken(name string, exp time.Time) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	payload, _ := json.Marshal(map[string]any{"exp": exp.Unix(), "name": name})
+	return enc([]byte(`{"alg":"HS256"}`)) + "." + enc(payload) + ".sig"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestAPIErrorsMatchSentinels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/workspaces/1/members":
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "Not a member"})
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, "Limit exceeded")
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	_, err := c.ListMembers(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Not a member", apiErr.Message)
+
+	_, err = c.ListTags(context.Background())
+	assert.ErrorIs(t, err, ErrRateLimited)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Limit exceeded", apiErr.Message)
+}
+
+func TestRefreshesTokenCloseToExpiry(t *testing.T) {
+	expiring := fakeToken("old", time.Now().Add(time.Hour))
+	fresh := fakeToken("new", time.Now().Add(7*24*time.Hour))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/refresh":
+			assert.Equal(t, "Bearer "+expiring, r.Header.Get("Authorization"))
+			writeJSON(w, http.StatusOK, map[string]any{"token": fresh, "user": map[string]any{"id": 1}})
+		case "/tags":
+			assert.Equal(t, "Bearer "+fresh, r.Header.Get("Authorization"))
+			writeJSON(w, http.StatusOK, []Tag{{ID: 1, Name: "go"}})
+		}
+	}))
+	defer srv.Close()
+
+	var saved string
+	c := New(srv.URL, WithToken(expiring), WithTokenHandler(func(token string) { saved = token }))
+	tags, err := c.ListTags(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Tag{{ID: 1, Name: "go"}}, tags)
+	assert.Equal(t, fresh, c.Token())
+	assert.Equal(t, fresh, saved)
+}
+
+func TestLogsInAgainWhenTokenIsRejected(t *testing.T) {
+	revoked := fakeToken("revoked", time.Now().Add(7*24*time.Hour))
+	fresh := fakeToken("fresh", time.Now().Add(7*24*time.Hour))
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal(t, map[string]string{"username": "alice", "password": "pw"}, body)
+			logins++
+			writeJSON(w, http.StatusOK, map[string]any{"token": fresh, "user": map[string]any{"id": 1, "username": "alice"}})
+		case "/workspaces":
+			if r.Header.Get("Authorization") != "Bearer "+fresh {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid token"})
+				return
+			}
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			writeJSON(w, http.StatusCreated, map[string]any{"id": 7, "name": body["name"], "owner_id": 1})
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(revoked), WithCredentials("alice", "pw"))
+	ws, err := c.CreateWorkspace(context.Background(), "Retried")
+	require.NoError(t, err)
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, "Retried", ws.Name, "request body must be replayed on retry")
+
+	// Without credentials the 401 is returned as is
+	c = New(srv.URL, WithToken(revoked))
+	_, err = c.CreateWorkspace(context.Background(), "Rejected")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestNotesIteratorFollowsCursors(t *testing.T) {
+	pages := map[string]NotePage{
+		"":   {Notes: []Note{{ID: 1}, {ID: 2}}, NextCursor: "c1"},
+		"c1": {Notes: []Note{{ID: 3}, {ID: 4}}, NextCursor: "c2"},
+		"c2": {Notes: []Note{{ID: 5}}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "2", q.Get("limit"))
+		assert.Equal(t, "go", q.Get("tag"))
+		assert.Equal(t, "desc", q.Get("order"))
+		writeJSON(w, http.StatusOK, pages[q.Get("cursor")])
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	var ids []int
+	for note, err := range c.Notes(context.Background(), 3, NoteListOptions{Tag: "go", Desc: true, Limit: 2}) {
+		require.NoError(t, err)
+		ids = append(ids, note.ID)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ids)
+
+	// Breaking out early stops fetching
+	ids = nil
+	for note := range c.Notes(context.Background(), 3, NoteListOptions{Tag: "go", Desc: true, Limit: 2}) {
+		ids = append(ids, note.ID)
+		if len(ids) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3}, ids)
+}
+
+func TestNotesIteratorYieldsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+	}))
+	defer srv.Close()
+
+	var errs []error
+	for _, err := range New(srv.URL).Notes(context.Background(), 1, NoteListOptions{Cursor: "bogus"}) {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrBadRequest)
+}
+
+func TestNoteUpdateDistinguishesNullFromAbsent(t *testing.T) {
+	title := "Renamed"
+	b, err := json.Marshal(NoteUpdate{Title: &title})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"title":"Renamed"}`, string(b))
+
+	b, err = json.Marshal(NoteUpdate{MoveToRoot: true, InheritSearchLanguage: true})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"folder_id":null,"search_language":null}`, string(b))
+}
+
+func TestContextCancellation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := New(srv.URL).ListWorkspaces(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+}
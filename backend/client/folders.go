@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+func folderPath(workspaceID, folderID int) string {
+	return workspacePath(workspaceID) + "/folders/" + itoa(folderID)
+}
+
+// CreateFolder adds a folder under parentID, or at the root when nil
+func (c *Client) CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (*Folder, error) {
+	var folder Folder
+	body := map[string]any{"name": name, "parent_id": parentID}
+	if err := c.do(ctx, http.MethodPost, workspacePath(workspaceID)+"/folders", nil, body, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// ListFolders returns every folder in a workspace
+func (c *Client) ListFolders(ctx context.Context, workspaceID int) ([]Folder, error) {
+	var folders []Folder
+	err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/folders", nil, nil, &folders)
+	return folders, err
+}
+
+// UpdateFolder renames or moves a folder
+func (c *Client) UpdateFolder(ctx context.Context, workspaceID, folderID int, in FolderUpdate) error {
+	return c.do(ctx, http.MethodPut, folderPath(workspaceID, folderID), nil, in, nil)
+}
+
+// DeleteFolder deletes a folder and its subfolders, moving their notes to
+// the trash
+func (c *Client) DeleteFolder(ctx context.Context, workspaceID, folderID int) error {
+	return c.do(ctx, http.MethodDelete, folderPath(workspaceID, folderID), nil, nil, nil)
+}
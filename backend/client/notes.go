@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DefaultPageSize is used by ListNotesPage and Notes when no limit is set
+const DefaultPageSize = 100
+
+func notePath(workspaceID, noteID int) string {
+	return workspacePath(workspaceID) + "/notes/" + itoa(noteID)
+}
+
+// CreateNote adds a note, tagging it in the same call
+func (c *Client) CreateNote(ctx context.Context, workspaceID int, in NoteCreate) (*Note, error) {
+	var note Note
+	if err := c.do(ctx, http.MethodPost, workspacePath(workspaceID)+"/notes", nil, in, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// GetNote returns a note with its tags
+func (c *Client) GetNote(ctx context.Context, workspaceID, noteID int) (*Note, error) {
+	var note Note
+	if err := c.do(ctx, http.MethodGet, notePath(workspaceID, noteID), nil, nil, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// ListNotes returns every note matching the filters in one response;
+// opts.Limit and opts.Cursor are ignored. Use Notes for large workspaces.
+func (c *Client) ListNotes(ctx context.Context, workspaceID int, opts NoteListOptions) ([]Note, error) {
+	opts.Limit, opts.Cursor = 0, ""
+	var notes []Note
+	err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/notes", opts.query(), nil, &notes)
+	return notes, err
+}
+
+// ListNotesPage returns one page of notes; pass the returned NextCursor as
+// opts.Cursor to get the next one
+func (c *Client) ListNotesPage(ctx context.Context, workspaceID int, opts NoteListOptions) (*NotePage, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+	var page NotePage
+	if err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/notes", opts.query(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Notes iterates over every matching note, fetching opts.Limit notes per
+// request. Iteration stops at the first error, which is yielded once.
+func (c *Client) Notes(ctx context.Context, workspaceID int, opts NoteListOptions) iter.Seq2[Note, error] {
+	return func(yield func(Note, error) bool) {
+		for {
+			page, err := c.ListNotesPage(ctx, workspaceID, opts)
+			if err != nil {
+				yield(Note{}, err)
+				return
+			}
+			for _, note := range page.Notes {
+				if !yield(note, nil) {
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+}
+
+func (o NoteListOptions) query() url.Values {
+	q := url.Values{}
+	if o.FolderID != nil {
+		q.Set("folder_id", itoa(*o.FolderID))
+	}
+	if o.Trashed != nil {
+		q.Set("trashed", strconv.FormatBool(*o.Trashed))
+	}
+	if o.Tag != "" {
+		q.Set("tag", o.Tag)
+	}
+	if o.CreatedBy != nil {
+		q.Set("created_by", itoa(*o.CreatedBy))
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Desc {
+		q.Set("order", "desc")
+	}
+	if o.Limit > 0 {
+		q.Set("limit", itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	return q
+}
+
+// UpdateNote applies a partial update and returns the updated note
+func (c *Client) UpdateNote(ctx context.Context, workspaceID, noteID int, in NoteUpdate) (*Note, error) {
+	var note Note
+	if err := c.do(ctx, http.MethodPut, notePath(workspaceID, noteID), nil, in, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// DeleteNote deletes a note permanently; see TrashNote for a soft delete
+func (c *Client) DeleteNote(ctx context.Context, workspaceID, noteID int) error {
+	return c.do(ctx, http.MethodDelete, notePath(workspaceID, noteID), nil, nil, nil)
+}
+
+// RelatedNotes returns notes similar in content across the caller's
+// workspaces; limit 0 uses the server default
+func (c *Client) RelatedNotes(ctx context.Context, workspaceID, noteID, limit int) ([]ScoredNote, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", itoa(limit))
+	}
+	var notes []ScoredNote
+	err := c.do(ctx, http.MethodGet, notePath(workspaceID, noteID)+"/related", q, nil, &notes)
+	return notes, err
+}
+
+// SetNoteTags replaces a note's tags
+func (c *Client) SetNoteTags(ctx context.Context, workspaceID, noteID int, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	body := map[string][]string{"tags": tags}
+	return c.do(ctx, http.MethodPut, notePath(workspaceID, noteID)+"/tags", nil, body, nil)
+}
+
+// SetNoteSearchText replaces the plain text indexed for full-text search
+func (c *Client) SetNoteSearchText(ctx context.Context, workspaceID, noteID int, text string) error {
+	body := map[string]string{"content_text": text}
+	return c.do(ctx, http.MethodPut, notePath(workspaceID, noteID)+"/search-text", nil, body, nil)
+}
+
+// GetNoteContent returns a note's body
+func (c *Client) GetNoteContent(ctx context.Context, workspaceID, noteID int) (*NoteContent, error) {
+	var content NoteContent
+	if err := c.do(ctx, http.MethodGet, notePath(workspaceID, noteID)+"/content", nil, nil, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// SetNoteMarkdown replaces a note's body with Markdown. Lines left as
+// GetNoteContent rendered them keep formatting Markdown cannot express.
+func (c *Client) SetNoteMarkdown(ctx context.Context, workspaceID, noteID int, markdown string) error {
+	body := map[string]string{"markdown": markdown}
+	return c.do(ctx, http.MethodPut, notePath(workspaceID, noteID)+"/content", nil, body, nil)
+}
+
+// SetNoteDelta replaces a note's body with a Quill document
+func (c *Client) SetNoteDelta(ctx context.Context, workspaceID, noteID int, ops []DeltaOp) error {
+	if ops == nil {
+		ops = []DeltaOp{}
+	}
+	body := map[string][]DeltaOp{"ops": ops}
+	return c.do(ctx, http.MethodPut, notePath(workspaceID, noteID)+"/content", nil, body, nil)
+}
+
+// ListTags returns every tag on the server
+func (c *Client) ListTags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	err := c.do(ctx, http.MethodGet, "/tags", nil, nil, &tags)
+	return tags, err
+}
+
+// ListWorkspaceTags returns the tags used by notes in a workspace
+func (c *Client) ListWorkspaceTags(ctx context.Context, workspaceID int) ([]Tag, error) {
+	var tags []Tag
+	err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/tags", nil, nil, &tags)
+	return tags, err
+}
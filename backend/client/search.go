@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+func searchQuery(query, mode string, limit int) url.Values {
+	q := url.Values{"q": {query}}
+	if mode != "" {
+		q.Set("mode", mode)
+	}
+	if limit > 0 {
+		q.Set("limit", itoa(limit))
+	}
+	return q
+}
+
+// Search returns notes matching query across the caller's workspaces. The
+// query accepts the server's filter syntax (tag:, workspace:, before:, ...).
+func (c *Client) Search(ctx context.Context, query string, opts SearchOptions) ([]Note, error) {
+	var notes []Note
+	err := c.do(ctx, http.MethodGet, "/search", searchQuery(query, opts.Mode, opts.Limit), nil, &notes)
+	return notes, err
+}
+
+// SearchWithFacets is Search plus the total hit count and facet counts
+func (c *Client) SearchWithFacets(ctx context.Context, query string, opts SearchOptions) (*SearchResponse, error) {
+	q := searchQuery(query, opts.Mode, opts.Limit)
+	q.Set("facets", "true")
+	var resp SearchResponse
+	if err := c.do(ctx, http.MethodGet, "/search", q, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SearchFuzzy is a typo-tolerant search with "did you mean" suggestions
+func (c *Client) SearchFuzzy(ctx context.Context, query string, limit int) (*FuzzySearchResult, error) {
+	var resp FuzzySearchResult
+	if err := c.do(ctx, http.MethodGet, "/search", searchQuery(query, "fuzzy", limit), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SearchSemantic ranks notes by content similarity to query
+func (c *Client) SearchSemantic(ctx context.Context, query string, limit int) ([]ScoredNote, error) {
+	var notes []ScoredNote
+	err := c.do(ctx, http.MethodGet, "/search", searchQuery(query, "semantic", limit), nil, &notes)
+	return notes, err
+}
+
+// SearchLanguages lists the available full-text search languages
+func (c *Client) SearchLanguages(ctx context.Context) (*SearchLanguages, error) {
+	var resp SearchLanguages
+	if err := c.do(ctx, http.MethodGet, "/search/languages", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListTrash returns a workspace's trashed notes
+func (c *Client) ListTrash(ctx context.Context, workspaceID int) ([]Note, error) {
+	var notes []Note
+	err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/trash", nil, nil, &notes)
+	return notes, err
+}
+
+// TrashNote moves a note to the trash
+func (c *Client) TrashNote(ctx context.Context, workspaceID, noteID int) error {
+	return c.do(ctx, http.MethodPost, notePath(workspaceID, noteID)+"/trash", nil, nil, nil)
+}
+
+// RestoreNote takes a note out of the trash
+func (c *Client) RestoreNote(ctx context.Context, workspaceID, noteID int) error {
+	return c.do(ctx, http.MethodPost, notePath(workspaceID, noteID)+"/restore", nil, nil, nil)
+}
+
+// EmptyTrash permanently deletes a workspace's trashed notes
+func (c *Client) EmptyTrash(ctx context.Context, workspaceID int) error {
+	return c.do(ctx, http.MethodPost, workspacePath(workspaceID)+"/trash/empty", nil, nil, nil)
+}
@@ -0,0 +1,223 @@
+package client
+
+import "encoding/json"
+
+// Timestamps are passed through as the server formats them.
+
+// User is an account; the password hash is never exposed
+type User struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"is_admin"`
+	Disabled  bool   `json:"disabled"`
+	CreatedAt string `json:"created_at"`
+}
+
+// LoginResponse is returned by Login and Refresh
+type LoginResponse struct {
+	Token string `json:"token"`
+	User  struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+		IsAdmin  bool   `json:"is_admin"`
+	} `json:"user"`
+}
+
+// UserCreate is the body of CreateUser
+type UserCreate struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// UserUpdate changes a username and/or password; empty fields are kept
+type UserUpdate struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Workspace as listed for the caller; Role is "owner" or "member" in
+// listings and empty elsewhere
+type Workspace struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	OwnerID        int    `json:"owner_id"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	SearchLanguage string `json:"search_language,omitempty"`
+	Role           string `json:"role,omitempty"`
+}
+
+// Member is a workspace membership
+type Member struct {
+	WorkspaceID int    `json:"workspace_id"`
+	UserID      int    `json:"user_id"`
+	Role        string `json:"role"`
+}
+
+// Tag is shared across workspaces; names are case-insensitive
+type Tag struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Folder in a workspace tree; ParentID is nil at the root
+type Folder struct {
+	ID          int    `json:"id"`
+	WorkspaceID int    `json:"workspace_id"`
+	ParentID    *int   `json:"parent_id"`
+	Name        string `json:"name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// FolderUpdate renames a folder and sets its parent (nil moves it to the
+// root); a different WorkspaceID moves the whole subtree
+type FolderUpdate struct {
+	Name        string `json:"name"`
+	ParentID    *int   `json:"parent_id"`
+	WorkspaceID *int   `json:"workspace_id,omitempty"`
+}
+
+// Note metadata; the body is read with GetNoteContent
+type Note struct {
+	ID                      int     `json:"id"`
+	WorkspaceID             int     `json:"workspace_id"`
+	Title                   string  `json:"title"`
+	YjsRoomID               string  `json:"yjs_room_id"`
+	FolderID                *int    `json:"folder_id"`
+	CreatedBy               *int    `json:"created_by"`
+	CreatedAt               string  `json:"created_at"`
+	UpdatedAt               string  `json:"updated_at"`
+	IsTrashed               bool    `json:"is_trashed"`
+	TrashedAt               *string `json:"trashed_at"`
+	Color                   string  `json:"color"`
+	SearchLanguage          string  `json:"search_language"`
+	SearchLanguageInherited bool    `json:"search_language_inherited"`
+	Tags                    []Tag   `json:"tags,omitempty"`
+}
+
+// NoteCreate is the body of CreateNote; an empty title becomes "Untitled"
+type NoteCreate struct {
+	Title    string   `json:"title,omitempty"`
+	FolderID *int     `json:"folder_id,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Color    string   `json:"color,omitempty"`
+}
+
+// NoteUpdate is a partial update: nil fields are left alone. The API tells
+// null from absent, so moving a note to the workspace root and reverting to
+// the workspace search language have their own flags.
+type NoteUpdate struct {
+	Title          *string
+	Color          *string
+	FolderID       *int
+	MoveToRoot     bool
+	WorkspaceID    *int
+	SearchLanguage *string
+	// InheritSearchLanguage drops a per-note override
+	InheritSearchLanguage bool
+}
+
+// MarshalJSON emits only the fields being changed
+func (u NoteUpdate) MarshalJSON() ([]byte, error) {
+	body := map[string]any{}
+	if u.Title != nil {
+		body["title"] = *u.Title
+	}
+	if u.Color != nil {
+		body["color"] = *u.Color
+	}
+	if u.FolderID != nil {
+		body["folder_id"] = *u.FolderID
+	} else if u.MoveToRoot {
+		body["folder_id"] = nil
+	}
+	if u.WorkspaceID != nil {
+		body["workspace_id"] = *u.WorkspaceID
+	}
+	if u.SearchLanguage != nil {
+		body["search_language"] = *u.SearchLanguage
+	} else if u.InheritSearchLanguage {
+		body["search_language"] = nil
+	}
+	return json.Marshal(body)
+}
+
+// DeltaOp is a Quill Delta operation; document inserts are a string or an
+// embed such as {"image": url}
+type DeltaOp struct {
+	Insert     any            `json:"insert,omitempty"`
+	Delete     int            `json:"delete,omitempty"`
+	Retain     int            `json:"retain,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// NoteContent is a note body as line-oriented Markdown and as the editor's
+// Quill Delta
+type NoteContent struct {
+	Markdown string    `json:"markdown"`
+	Ops      []DeltaOp `json:"ops"`
+}
+
+// NoteListOptions filters, sorts and pages a note listing
+type NoteListOptions struct {
+	FolderID  *int
+	Trashed   *bool  // nil lists trashed and live notes together
+	Tag       string // tag name, case-insensitive
+	CreatedBy *int
+	Sort      string // created (default), updated, title or color
+	Desc      bool
+	Limit     int    // page size; ListNotes ignores it
+	Cursor    string // NextCursor of the previous page
+}
+
+// NotePage is one page of a listing; NextCursor is empty on the last page
+type NotePage struct {
+	Notes      []Note `json:"notes"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// ScoredNote is a search hit with its relevance score
+type ScoredNote struct {
+	Note
+	Score float64 `json:"score"`
+}
+
+// SearchOptions for Search and SearchWithFacets
+type SearchOptions struct {
+	Mode  string // metadata (default) or full
+	Limit int
+}
+
+// FacetCount is the number of hits sharing a tag, workspace or author
+type FacetCount struct {
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Facets summarise all hits, not just the returned page
+type Facets struct {
+	Tags       []FacetCount `json:"tags"`
+	Workspaces []FacetCount `json:"workspaces"`
+	Authors    []FacetCount `json:"authors"`
+}
+
+// SearchResponse is a page of hits with facet counts
+type SearchResponse struct {
+	Notes  []Note `json:"notes"`
+	Total  int    `json:"total"`
+	Facets Facets `json:"facets"`
+}
+
+// FuzzySearchResult holds ranked notes plus "did you mean" suggestions
+type FuzzySearchResult struct {
+	Notes       []ScoredNote `json:"notes"`
+	DidYouMean  string       `json:"did_you_mean,omitempty"`
+	Suggestions []string     `json:"suggestions"`
+}
+
+// SearchLanguages lists the server's full-text search configurations
+type SearchLanguages struct {
+	Default   string   `json:"default"`
+	Languages []string `json:"languages"`
+}
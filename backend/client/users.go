@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// ListUsers returns every account
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	err := c.do(ctx, http.MethodGet, "/users/", nil, nil, &users)
+	return users, err
+}
+
+// CreateUser adds an account (admin only)
+func (c *Client) CreateUser(ctx context.Context, in UserCreate) error {
+	return c.do(ctx, http.MethodPost, "/users/", nil, in, nil)
+}
+
+// GetUser returns an account; non-admins may only read their own
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, "/users/"+itoa(id), nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUser changes a username and/or password
+func (c *Client) UpdateUser(ctx context.Context, id int, in UserUpdate) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodPut, "/users/"+itoa(id), nil, in, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUser removes an account
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/users/"+itoa(id), nil, nil, nil)
+}
+
+// FindUser looks an account up by username, returning ErrNotFound when
+// there is none
+func (c *Client) FindUser(ctx context.Context, username string) (*User, error) {
+	users, err := c.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, &APIError{StatusCode: http.StatusNotFound, Message: "User not found"}
+}
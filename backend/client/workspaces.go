@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+func workspacePath(id int) string {
+	return "/workspaces/" + itoa(id)
+}
+
+// CreateWorkspace creates a workspace owned by the caller
+func (c *Client) CreateWorkspace(ctx context.Context, name string) (*Workspace, error) {
+	var ws Workspace
+	if err := c.do(ctx, http.MethodPost, "/workspaces", nil, map[string]string{"name": name}, &ws); err != nil {
+		return nil, err
+	}
+	ws.Role = "owner"
+	return &ws, nil
+}
+
+// ListWorkspaces returns the caller's workspaces with their role in each
+func (c *Client) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	var workspaces []Workspace
+	err := c.do(ctx, http.MethodGet, "/workspaces", nil, nil, &workspaces)
+	return workspaces, err
+}
+
+// RenameWorkspace changes a workspace's name (owner only)
+func (c *Client) RenameWorkspace(ctx context.Context, id int, name string) error {
+	return c.do(ctx, http.MethodPut, workspacePath(id), nil, map[string]string{"name": name}, nil)
+}
+
+// SetWorkspaceSearchLanguage sets the default full-text search language
+// (owner only)
+func (c *Client) SetWorkspaceSearchLanguage(ctx context.Context, id int, language string) error {
+	return c.do(ctx, http.MethodPut, workspacePath(id)+"/search-language", nil, map[string]string{"language": language}, nil)
+}
+
+// DeleteWorkspace deletes a workspace with all its folders and notes
+// (owner only)
+func (c *Client) DeleteWorkspace(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, workspacePath(id), nil, nil, nil)
+}
+
+// ListMembers returns a workspace's members
+func (c *Client) ListMembers(ctx context.Context, workspaceID int) ([]Member, error) {
+	var members []Member
+	err := c.do(ctx, http.MethodGet, workspacePath(workspaceID)+"/members", nil, nil, &members)
+	return members, err
+}
+
+// AddMember shares a workspace; role is "member" or "owner" (owner only)
+func (c *Client) AddMember(ctx context.Context, workspaceID, userID int, role string) error {
+	body := map[string]any{"user_id": userID, "role": role}
+	return c.do(ctx, http.MethodPost, workspacePath(workspaceID)+"/members", nil, body, nil)
+}
+
+// RemoveMember removes a member; anyone but the owner may remove themselves
+func (c *Client) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	return c.do(ctx, http.MethodDelete, workspacePath(workspaceID)+"/members/"+itoa(userID), nil, nil, nil)
+}
+
+// TransferOwnership hands a workspace to an existing member (owner only)
+func (c *Client) TransferOwnership(ctx context.Context, workspaceID, newOwnerID int) error {
+	body := map[string]int{"new_owner_id": newOwnerID}
+	return c.do(ctx, http.MethodPut, workspacePath(workspaceID)+"/owner", nil, body, nil)
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang-migrate/migrate/v4"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/search"
+	"go-notes/backend/internal/server"
+	"go-notes/backend/internal/sqlitestore"
+)
+
+const adminUsage = `Usage: go-notes [COMMAND]
+
+Commands:
+  serve                                  run the server (default)
+  migrate up [N]                         apply all or N pending migrations
+  migrate down (N | -all)                roll back N or all migrations
+  migrate status                         show the schema version
+  migrate force VERSION                  mark VERSION as applied, clearing dirty
+  user list
+  user create [-admin] [-password-stdin] NAME
+  user reset-password [-password-stdin] NAME
+  user promote [-revoke] NAME            grant or revoke admin rights
+  user disable [-enable] NAME            block login and existing tokens
+  workspace list
+  workspace transfer ID NAME             make NAME the owner of workspace ID
+  trash purge [-workspace ID] [-older-than DAYS]
+  reindex                                rebuild the search index
+
+Commands use the same DB_* settings as the server. Without -password-stdin,
+passwords are prompted for on the terminal.
+`
+
+// adminData is what the commands read and change, through the same store
+// interfaces as the server on either driver
+type adminData interface {
+	server.UserStore
+	server.WorkspaceStore
+	server.AdminStore
+	DB() *sql.DB
+}
+
+// adminStore is a driver's store with its transactions
+type adminStore struct {
+	adminData
+	server.Transactor
+}
+
+type adminCommand func(ctx context.Context, store adminStore, args []string) error
+
+var adminCommands = map[string]map[string]adminCommand{
+	"user": {
+		"list":           adminUserList,
+		"create":         adminUserCreate,
+		"reset-password": adminUserResetPassword,
+		"promote":        adminUserPromote,
+		"disable":        adminUserDisable,
+	},
+	"workspace": {
+		"list":     adminWorkspaceList,
+		"transfer": adminWorkspaceTransfer,
+	},
+	"trash": {
+		"purge": adminTrashPurge,
+	},
+}
+
+// errAdminUsage makes runAdmin print the usage text
+var errAdminUsage = errors.New("invalid usage; see go-notes help")
+
+// runAdmin runs a maintenance command against the database and exits;
+// "serve" is handled by main
+func runAdmin(args []string) error {
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Print(adminUsage)
+		return nil
+	case "migrate":
+		return adminMigrate(args[1:])
+	}
+
+	var cmd adminCommand
+	if args[0] == "reindex" {
+		cmd = adminReindex
+		args = args[1:]
+	} else if group, ok := adminCommands[args[0]]; !ok {
+		return fmt.Errorf("unknown command %q; see go-notes help", args[0])
+	} else if len(args) < 2 || group[args[1]] == nil {
+		return errAdminUsage
+	} else {
+		cmd = group[args[1]]
+		args = args[2:]
+	}
+
+	database, err := db.Connect()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if err := database.Ping(); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	pgStore := db.NewStore(database)
+	store := adminStore{pgStore, server.Transactions(pgStore.WithTx)}
+	if db.Driver() == db.DriverSQLite {
+		liteStore := sqlitestore.New(database)
+		store = adminStore{liteStore, server.Transactions(liteStore.WithTx)}
+	}
+	return cmd(context.Background(), store, args)
+}
+
+// adminFlags parses flags that may appear before or after positional
+// arguments and checks the positional count
+func adminFlags(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if want >= 0 && len(positional) != want {
+		return nil, errAdminUsage
+	}
+	return positional, nil
+}
+
+func adminMigrate(args []string) error {
+	if len(args) == 0 {
+		return errAdminUsage
+	}
+	var run func(m *migrate.Migrate) error
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		run = (*migrate.Migrate).Up
+	case args[0] == "up" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return errAdminUsage
+		}
+		run = func(m *migrate.Migrate) error { return m.Steps(n) }
+	case args[0] == "down" && len(args) == 2 && (args[1] == "-all" || args[1] == "--all"):
+		run = (*migrate.Migrate).Down
+	case args[0] == "down" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return errAdminUsage
+		}
+		run = func(m *migrate.Migrate) error { return m.Steps(-n) }
+	case args[0] == "force" && len(args) == 2:
+		v, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errAdminUsage
+		}
+		run = func(m *migrate.Migrate) error { return m.Force(v) }
+	case args[0] == "status" && len(args) == 1:
+		run = func(*migrate.Migrate) error { return nil }
+	default:
+		return errAdminUsage
+	}
+
+	return db.WithMigrator(func(m *migrate.Migrate) error {
+		if err := run(m); errors.Is(err, migrate.ErrNoChange) {
+			fmt.Println("No change")
+		} else if err != nil {
+			return err
+		}
+
+		latest, err := db.LatestMigration()
+		if err != nil {
+			return err
+		}
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Printf("Version: none (empty database), latest %d\n", latest)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Version: %d, latest %d", version, latest)
+		if dirty {
+			fmt.Print(" (dirty: fix the schema by hand, then run migrate force VERSION)")
+		}
+		fmt.Println()
+		return nil
+	})
+}
+
+func adminUserList(ctx context.Context, store adminStore, args []string) error {
+	if _, err := adminFlags(flag.NewFlagSet("user list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	users, err := store.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tADMIN\tDISABLED\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%t\t%s\n", u.ID, u.Username, u.IsAdmin, u.Disabled, u.CreatedAt)
+	}
+	return w.Flush()
+}
+
+func adminUserCreate(ctx context.Context, store adminStore, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	isAdmin := fs.Bool("admin", false, "create an admin")
+	fromStdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	names, err := adminFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if _, err := store.GetUserByUsername(ctx, names[0]); err == nil {
+		return fmt.Errorf("user %q already exists", names[0])
+	}
+	hash, err := readPasswordHash(*fromStdin)
+	if err != nil {
+		return err
+	}
+	if err := store.CreateUser(ctx, names[0], hash, *isAdmin); err != nil {
+		return err
+	}
+	fmt.Printf("Created user %s\n", names[0])
+	return nil
+}
+
+func adminUserResetPassword(ctx context.Context, store adminStore, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	fromStdin := fs.Bool("password-stdin", false, "read the password from stdin")
+	names, err := adminFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, store, names[0])
+	if err != nil {
+		return err
+	}
+	hash, err := readPasswordHash(*fromStdin)
+	if err != nil {
+		return err
+	}
+	if err := store.SetUserPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	fmt.Printf("Password reset for %s\n", user.Username)
+	return nil
+}
+
+func adminUserPromote(ctx context.Context, store adminStore, args []string) error {
+	fs := flag.NewFlagSet("user promote", flag.ContinueOnError)
+	revoke := fs.Bool("revoke", false, "revoke admin rights instead")
+	names, err := adminFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, store, names[0])
+	if err != nil {
+		return err
+	}
+	if *revoke && user.IsAdmin && !user.Disabled {
+		if err := requireAnotherAdmin(ctx, store); err != nil {
+			return err
+		}
+	}
+	if err := store.SetUserAdmin(ctx, user.ID, !*revoke); err != nil {
+		return err
+	}
+	if *revoke {
+		fmt.Printf("%s is no longer an admin\n", user.Username)
+	} else {
+		fmt.Printf("%s is now an admin; it takes effect at their next login or token refresh\n", user.Username)
+	}
+	return nil
+}
+
+func adminUserDisable(ctx context.Context, store adminStore, args []string) error {
+	fs := flag.NewFlagSet("user disable", flag.ContinueOnError)
+	enable := fs.Bool("enable", false, "re-enable the user instead")
+	names, err := adminFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, store, names[0])
+	if err != nil {
+		return err
+	}
+	if !*enable && user.IsAdmin && !user.Disabled {
+		if err := requireAnotherAdmin(ctx, store); err != nil {
+			return err
+		}
+	}
+	if err := store.SetUserDisabled(ctx, user.ID, !*enable); err != nil {
+		return err
+	}
+	if *enable {
+		fmt.Printf("Enabled %s\n", user.Username)
+	} else {
+		fmt.Printf("Disabled %s\n", user.Username)
+	}
+	return nil
+}
+
+// requireAnotherAdmin refuses to demote or disable the last active admin
+func requireAnotherAdmin(ctx context.Context, store adminStore) error {
+	count, err := store.CountActiveAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if count <= 1 {
+		return errors.New("refusing to remove the last active admin; promote another user first")
+	}
+	return nil
+}
+
+func lookupUser(ctx context.Context, store adminStore, username string) (*db.User, error) {
+	user, err := store.GetUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %q not found", username)
+	}
+	return user, err
+}
+
+// readPasswordHash reads a new password, from the first line of stdin or
+// from a terminal prompt with confirmation, and hashes it
+func readPasswordHash(fromStdin bool) (string, error) {
+	var password string
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return "", errors.New("stdin is not a terminal; use -password-stdin")
+		}
+		fmt.Fprint(os.Stderr, "Password: ")
+		first, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(first) != string(second) {
+			return "", errors.New("passwords do not match")
+		}
+		password = string(first)
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func adminWorkspaceList(ctx context.Context, store adminStore, args []string) error {
+	if _, err := adminFlags(flag.NewFlagSet("workspace list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	workspaces, err := store.ListAllWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tOWNER\tMEMBERS\tNOTES")
+	for _, ws := range workspaces {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\n", ws.ID, ws.Name, ws.OwnerName, ws.Members, ws.Notes)
+	}
+	return w.Flush()
+}
+
+func adminWorkspaceTransfer(ctx context.Context, store adminStore, args []string) error {
+	positional, err := adminFlags(flag.NewFlagSet("workspace transfer", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	workspaceID, err := strconv.Atoi(positional[0])
+	if err != nil {
+		return errAdminUsage
+	}
+	ws, err := store.GetWorkspace(ctx, workspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("workspace %d not found", workspaceID)
+	} else if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, store, positional[1])
+	if err != nil {
+		return err
+	}
+	err = store.InTx(ctx, func(tx server.TxStores) error {
+		isMember, err := tx.IsWorkspaceMember(ctx, workspaceID, user.ID)
+		if err != nil {
+			return err
+		}
+		if !isMember {
+			if err := tx.AddWorkspaceMember(ctx, workspaceID, user.ID, "member"); err != nil {
+				return err
+			}
+		}
+		return tx.TransferWorkspaceOwnership(ctx, workspaceID, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Workspace %d (%s) is now owned by %s\n", ws.ID, ws.Name, user.Username)
+	return nil
+}
+
+func adminTrashPurge(ctx context.Context, store adminStore, args []string) error {
+	fs := flag.NewFlagSet("trash purge", flag.ContinueOnError)
+	workspaceID := fs.Int("workspace", 0, "only this workspace")
+	olderThan := fs.Int("older-than", 0, "only notes trashed more than DAYS ago")
+	if _, err := adminFlags(fs, args, 0); err != nil {
+		return err
+	}
+	count, err := store.PurgeTrash(ctx, *workspaceID, *olderThan)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d trashed notes\n", count)
+
+	// Drop the deleted notes from the search index now rather than at the
+	// server's next hourly prune
+	searchBackend, err := search.New(store.DB())
+	if err != nil {
+		return err
+	}
+	defer searchBackend.Close()
+	return searchBackend.Prune(ctx)
+}
+
+func adminReindex(ctx context.Context, store adminStore, args []string) error {
+	if _, err := adminFlags(flag.NewFlagSet("reindex", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	searchBackend, err := search.New(store.DB())
+	if err != nil {
+		return err
+	}
+	defer searchBackend.Close()
+	count, err := searchBackend.Reindex(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reindexed %d notes with %s search backend\n", count, searchBackend.Name())
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/sqlitestore"
+)
+
+func TestAdminUsageErrors(t *testing.T) {
+	// These fail before any database connection is attempted
+	assert.ErrorIs(t, runAdmin([]string{"user"}), errAdminUsage)
+	assert.ErrorIs(t, runAdmin([]string{"user", "rename"}), errAdminUsage)
+	assert.ErrorContains(t, runAdmin([]string{"frobnicate"}), `unknown command "frobnicate"`)
+	assert.ErrorIs(t, adminMigrate(nil), errAdminUsage)
+	assert.NoError(t, runAdmin([]string{"help"}))
+}
+
+func TestAdminFlagsInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	admin := fs.Bool("admin", false, "")
+	names, err := adminFlags(fs, []string{"alice", "-admin"}, 1)
+	require.NoError(t, err)
+	assert.True(t, *admin)
+	assert.Equal(t, []string{"alice"}, names)
+
+	_, err = adminFlags(flag.NewFlagSet("test", flag.ContinueOnError), []string{"a", "b"}, 1)
+	assert.ErrorIs(t, err, errAdminUsage)
+}
+
+// withStdin feeds input to a command reading passwords from stdin
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	require.NoError(t, err)
+	_, err = f.WriteString(input)
+	require.NoError(t, err)
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		f.Close()
+	})
+}
+
+func TestAdminCommandsSQLite(t *testing.T) {
+	documents := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer documents.Close()
+	t.Setenv("YJS_HTTP_URL", documents.URL)
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "notes.db"))
+	require.NoError(t, runAdmin([]string{"migrate", "up"}))
+
+	withStdin(t, "secret\n")
+	require.NoError(t, runAdmin([]string{"user", "create", "-admin", "-password-stdin", "alice"}))
+	withStdin(t, "secret\n")
+	require.NoError(t, runAdmin([]string{"user", "create", "-password-stdin", "bob"}))
+	assert.ErrorContains(t, runAdmin([]string{"user", "disable", "alice"}), "last active admin")
+	require.NoError(t, runAdmin([]string{"user", "promote", "bob"}))
+	require.NoError(t, runAdmin([]string{"user", "disable", "alice"}))
+	withStdin(t, "changed\n")
+	require.NoError(t, runAdmin([]string{"user", "reset-password", "-password-stdin", "bob"}))
+	require.NoError(t, runAdmin([]string{"user", "list"}))
+	require.NoError(t, runAdmin([]string{"workspace", "list"}))
+
+	database, err := db.Connect()
+	require.NoError(t, err)
+	defer database.Close()
+	store := sqlitestore.New(database)
+	ctx := context.Background()
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := store.GetUserByUsername(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, bob.IsAdmin)
+	active, err := store.IsActiveUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+	wsID := workspaces[0].ID
+	require.NoError(t, runAdmin([]string{"workspace", "transfer", strconv.Itoa(wsID), "bob"}))
+	isOwner, err := store.IsWorkspaceOwner(ctx, wsID, bob.ID)
+	require.NoError(t, err)
+	assert.True(t, isOwner)
+
+	noteID, err := store.CreateNote(ctx, wsID, "Old", nil, &alice.ID, "#FFFFFF")
+	require.NoError(t, err)
+	require.NoError(t, store.TrashNote(ctx, noteID))
+	require.NoError(t, runAdmin([]string{"trash", "purge", "-workspace", strconv.Itoa(wsID)}))
+	_, err = store.GetNote(ctx, noteID)
+	assert.Error(t, err)
+	require.NoError(t, runAdmin([]string{"reindex"}))
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"go-notes/backend/client"
+)
+
+func cmdLogin(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("login")
+	server := fs.String("server", "", "server URL, e.g. https://notes.example.com/api")
+	username := fs.String("username", "", "username")
+	if rest, err := parse(fs, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errUsage
+	}
+
+	p := a.current()
+	if *server == "" {
+		*server = p.Server
+	}
+	if *server == "" {
+		return errors.New("no server for this profile; pass -server URL")
+	}
+	if *username == "" {
+		*username = p.Username
+	}
+	if *username == "" {
+		name, err := a.prompt("Username: ", false)
+		if err != nil {
+			return err
+		}
+		*username = name
+	}
+	password := os.Getenv("GONOTES_PASSWORD")
+	if password == "" {
+		var err error
+		if password, err = a.prompt("Password: ", true); err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.New(*server).Login(ctx, *username, password)
+	if err != nil {
+		return err
+	}
+	if p.Server != *server {
+		// A different server invalidates the default workspace
+		p.Workspace = 0
+	}
+	p.Server, p.Username, p.Token = *server, resp.User.Username, resp.Token
+	a.cfg.Profiles[a.profile] = p
+	if a.cfg.Current == "" {
+		a.cfg.Current = a.profile
+	}
+	if err := a.cfg.save(); err != nil {
+		return err
+	}
+	return a.print(resp.User, func(w io.Writer) {
+		fmt.Fprintf(w, "Logged in to %s as %s (profile %s)\n", p.Server, p.Username, a.profile)
+	})
+}
+
+// prompt reads a line from stdin, without echo for secrets on a terminal
+func (a *app) prompt(label string, secret bool) (string, error) {
+	fmt.Fprint(a.stderr, label)
+	if f, ok := a.stdin.(*os.File); ok && secret && term.IsTerminal(int(f.Fd())) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(a.stderr)
+		return string(b), err
+	}
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("reading %s: %w", strings.TrimSuffix(strings.ToLower(label), ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func cmdLogout(ctx context.Context, a *app, args []string) error {
+	if _, err := parse(a.flags("logout"), args); err != nil {
+		return err
+	}
+	p, ok := a.cfg.Profiles[a.profile]
+	if !ok || p.Token == "" {
+		return a.message("Not logged in")
+	}
+	p.Token = ""
+	if err := a.cfg.save(); err != nil {
+		return err
+	}
+	return a.message("Logged out of %s", p.Server)
+}
+
+type profileRow struct {
+	Name      string `json:"name"`
+	Current   bool   `json:"current"`
+	Server    string `json:"server"`
+	Username  string `json:"username"`
+	LoggedIn  bool   `json:"logged_in"`
+	Workspace int    `json:"workspace,omitempty"`
+}
+
+func cmdProfileList(ctx context.Context, a *app, args []string) error {
+	if _, err := parse(a.flags("profile ls"), args); err != nil {
+		return err
+	}
+	rows := []profileRow{}
+	for _, name := range a.cfg.names() {
+		p := a.cfg.Profiles[name]
+		rows = append(rows, profileRow{
+			Name:      name,
+			Current:   name == a.profile,
+			Server:    p.Server,
+			Username:  p.Username,
+			LoggedIn:  p.Token != "",
+			Workspace: p.Workspace,
+		})
+	}
+	return a.print(rows, func(w io.Writer) {
+		fmt.Fprintln(w, "\tPROFILE\tSERVER\tUSER\tWORKSPACE")
+		for _, r := range rows {
+			mark, user := "", r.Username
+			if r.Current {
+				mark = "*"
+			}
+			if !r.LoggedIn {
+				user += " (logged out)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, r.Name, r.Server, user, optionalID(nonZero(r.Workspace)))
+		}
+	})
+}
+
+func cmdProfileUse(ctx context.Context, a *app, args []string) error {
+	rest, err := parse(a.flags("profile use"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+	if _, ok := a.cfg.Profiles[rest[0]]; !ok {
+		return fmt.Errorf("no profile %q; create it with gonotes --profile %s login -server URL", rest[0], rest[0])
+	}
+	a.cfg.Current = rest[0]
+	if err := a.cfg.save(); err != nil {
+		return err
+	}
+	return a.message("Using profile %s", rest[0])
+}
+
+func cmdProfileRemove(ctx context.Context, a *app, args []string) error {
+	rest, err := parse(a.flags("profile rm"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+	if _, ok := a.cfg.Profiles[rest[0]]; !ok {
+		return fmt.Errorf("no profile %q", rest[0])
+	}
+	delete(a.cfg.Profiles, rest[0])
+	if a.cfg.Current == rest[0] {
+		a.cfg.Current = ""
+	}
+	if err := a.cfg.save(); err != nil {
+		return err
+	}
+	return a.message("Removed profile %s", rest[0])
+}
+
+func cmdWorkspaceList(ctx context.Context, a *app, args []string) error {
+	if _, err := parse(a.flags("ws ls"), args); err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	workspaces, err := c.ListWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	def := a.current().Workspace
+	return a.print(workspaces, func(w io.Writer) {
+		fmt.Fprintln(w, "\tID\tNAME\tROLE")
+		for _, ws := range workspaces {
+			mark := ""
+			if ws.ID == def {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", mark, ws.ID, ws.Name, ws.Role)
+		}
+	})
+}
+
+func cmdWorkspaceUse(ctx context.Context, a *app, args []string) error {
+	rest, err := parse(a.flags("ws use"), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(rest[0])
+	if err != nil {
+		return fmt.Errorf("invalid workspace ID %q", rest[0])
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	workspaces, err := c.ListWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ws := range workspaces {
+		if ws.ID == id {
+			a.cfg.Profiles[a.profile].Workspace = id
+			if err := a.cfg.save(); err != nil {
+				return err
+			}
+			return a.message("Default workspace is now %d (%s)", id, ws.Name)
+		}
+	}
+	return fmt.Errorf("workspace %d not found or not accessible", id)
+}
+
+// noteFlags returns a command's flag set with -w registered
+func (a *app) noteFlags(name string) (*flag.FlagSet, *int) {
+	fs := a.flags(name)
+	ws := fs.Int("w", 0, "workspace ID")
+	return fs, ws
+}
+
+// noteArgs parses args and resolves the workspace and NOTE ID
+func (a *app) noteArgs(fs *flag.FlagSet, ws *int, args []string) (workspaceID, noteID int, rest []string, err error) {
+	rest, err = parse(fs, args)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(rest) == 0 {
+		return 0, 0, nil, errUsage
+	}
+	if noteID, err = strconv.Atoi(rest[0]); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid note ID %q", rest[0])
+	}
+	if workspaceID, err = a.workspace(*ws); err != nil {
+		return 0, 0, nil, err
+	}
+	return workspaceID, noteID, rest[1:], nil
+}
+
+func cmdNotesList(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("notes ls")
+	folder := fs.Int("folder", 0, "only notes directly in this folder")
+	tag := fs.String("tag", "", "only notes with this tag")
+	trashed := fs.Bool("trashed", false, "list the trash instead")
+	sortBy := fs.String("sort", "", "created, updated, title or color")
+	desc := fs.Bool("desc", false, "sort descending")
+	limit := fs.Int("limit", 0, "stop after N notes")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+	workspaceID, err := a.workspace(*ws)
+	if err != nil {
+		return err
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	opts := client.NoteListOptions{Trashed: trashed, Tag: *tag, Sort: *sortBy, Desc: *desc}
+	if *folder > 0 {
+		opts.FolderID = folder
+	}
+	if *limit > 0 && *limit < client.DefaultPageSize {
+		opts.Limit = *limit
+	}
+	notes := []client.Note{}
+	for note, err := range c.Notes(ctx, workspaceID, opts) {
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+		if len(notes) == *limit {
+			break
+		}
+	}
+	return a.print(notes, func(w io.Writer) { noteTable(w, notes) })
+}
+
+func cmdNotesNew(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("notes new")
+	folder := fs.Int("folder", 0, "folder ID")
+	tags := fs.String("tags", "", "comma-separated tags")
+	color := fs.String("color", "", "note color")
+	file := fs.String("file", "", "Markdown body, - for stdin")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	workspaceID, err := a.workspace(*ws)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	switch *file {
+	case "":
+	case "-":
+		body, err = io.ReadAll(a.stdin)
+	default:
+		body, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	title := strings.Join(rest, " ")
+	if title == "" && *file != "" && *file != "-" {
+		title = strings.TrimSuffix(filepath.Base(*file), filepath.Ext(*file))
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	in := client.NoteCreate{Title: title, Tags: splitList(*tags), Color: *color}
+	if *folder > 0 {
+		in.FolderID = folder
+	}
+	note, err := c.CreateNote(ctx, workspaceID, in)
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		if err := c.SetNoteMarkdown(ctx, workspaceID, note.ID, string(body)); err != nil {
+			return fmt.Errorf("note %d created but setting its content failed: %w", note.ID, err)
+		}
+	}
+	return a.print(note, func(w io.Writer) {
+		fmt.Fprintf(w, "Created note %d %q\n", note.ID, note.Title)
+	})
+}
+
+func cmdNotesMove(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("notes mv")
+	folder := fs.Int("folder", 0, "destination folder ID")
+	root := fs.Bool("root", false, "move to the workspace root")
+	toWorkspace := fs.Int("to-ws", 0, "destination workspace ID")
+	workspaceID, noteID, rest, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 || (*folder > 0 && *root) || (*folder == 0 && !*root && *toWorkspace == 0) {
+		return errUsage
+	}
+
+	update := client.NoteUpdate{MoveToRoot: *root}
+	if *folder > 0 {
+		update.FolderID = folder
+	}
+	if *toWorkspace > 0 {
+		update.WorkspaceID = toWorkspace
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	note, err := c.UpdateNote(ctx, workspaceID, noteID, update)
+	if err != nil {
+		return err
+	}
+	return a.print(note, func(w io.Writer) {
+		fmt.Fprintf(w, "Moved note %d to workspace %d, folder %s\n", note.ID, note.WorkspaceID, optionalID(note.FolderID))
+	})
+}
+
+func cmdNotesRemove(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("notes rm")
+	permanent := fs.Bool("permanent", false, "delete instead of moving to the trash")
+	workspaceID, noteID, rest, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	if *permanent {
+		if err := c.DeleteNote(ctx, workspaceID, noteID); err != nil {
+			return err
+		}
+		return a.message("Deleted note %d", noteID)
+	}
+	if err := c.TrashNote(ctx, workspaceID, noteID); err != nil {
+		return err
+	}
+	return a.message("Moved note %d to the trash", noteID)
+}
+
+func cmdNotesRestore(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("notes restore")
+	workspaceID, noteID, rest, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	if err := c.RestoreNote(ctx, workspaceID, noteID); err != nil {
+		return err
+	}
+	return a.message("Restored note %d", noteID)
+}
+
+func cmdTag(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("tag")
+	add := fs.Bool("add", false, "add the tags instead of replacing them")
+	remove := fs.Bool("remove", false, "remove the tags")
+	workspaceID, noteID, tags, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if *add && *remove {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	note, err := c.GetNote(ctx, workspaceID, noteID)
+	if err != nil {
+		return err
+	}
+	current := make([]string, len(note.Tags))
+	for i, t := range note.Tags {
+		current[i] = t.Name
+	}
+
+	if len(tags) > 0 {
+		set := map[string]bool{}
+		if *add || *remove {
+			for _, t := range current {
+				set[strings.ToLower(t)] = true
+			}
+		}
+		for _, t := range tags {
+			set[strings.ToLower(t)] = !*remove
+		}
+		next := []string{}
+		for _, t := range sortedKeys(set) {
+			if set[t] {
+				next = append(next, t)
+			}
+		}
+		if err := c.SetNoteTags(ctx, workspaceID, noteID, next); err != nil {
+			return err
+		}
+		current = next
+	}
+	return a.print(current, func(w io.Writer) {
+		fmt.Fprintln(w, strings.Join(current, "\n"))
+	})
+}
+
+func cmdSearch(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("search")
+	mode := fs.String("mode", "full", "full, metadata, fuzzy or semantic")
+	limit := fs.Int("limit", 0, "maximum results")
+	rest, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(rest, " ")
+	if query == "" {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+
+	switch *mode {
+	case "fuzzy":
+		res, err := c.SearchFuzzy(ctx, query, *limit)
+		if err != nil {
+			return err
+		}
+		return a.print(res, func(w io.Writer) {
+			if res.DidYouMean != "" {
+				fmt.Fprintf(a.stderr, "Did you mean: %s\n", res.DidYouMean)
+			}
+			scoredTable(w, res.Notes)
+		})
+	case "semantic":
+		notes, err := c.SearchSemantic(ctx, query, *limit)
+		if err != nil {
+			return err
+		}
+		return a.print(notes, func(w io.Writer) { scoredTable(w, notes) })
+	case "full", "metadata":
+		notes, err := c.Search(ctx, query, client.SearchOptions{Mode: *mode, Limit: *limit})
+		if err != nil {
+			return err
+		}
+		return a.print(notes, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tWORKSPACE\tTITLE\tTAGS\tUPDATED")
+			for _, n := range notes {
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", n.ID, n.WorkspaceID, n.Title, tagNames(n.Tags), shortTime(n.UpdatedAt))
+			}
+		})
+	}
+	return fmt.Errorf("unknown search mode %q", *mode)
+}
+
+func cmdCat(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("cat")
+	workspaceID, noteID, rest, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	content, err := c.GetNoteContent(ctx, workspaceID, noteID)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.print(content, nil)
+	}
+	_, err = io.WriteString(a.stdout, content.Markdown)
+	return err
+}
+
+// cmdEdit opens the note's Markdown in an editor and saves it if changed.
+// Lines left alone keep formatting Markdown cannot show. If someone else
+// edits the note meanwhile, the save is refused and the file is kept.
+func cmdEdit(ctx context.Context, a *app, args []string) error {
+	fs, ws := a.noteFlags("edit")
+	workspaceID, noteID, rest, err := a.noteArgs(fs, ws, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	content, err := c.GetNoteContent(ctx, workspaceID, noteID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", fmt.Sprintf("gonotes-%d-*.md", noteID))
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+	_, err = f.WriteString(content.Markdown)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			os.Remove(path)
+		}
+	}()
+
+	if err := runEditor(ctx, path); err != nil {
+		return err
+	}
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, []byte(content.Markdown)) {
+		return a.message("No changes")
+	}
+
+	latest, err := c.GetNoteContent(ctx, workspaceID, noteID)
+	if err != nil {
+		keep = true
+		return fmt.Errorf("%w (your edit is saved in %s)", err, path)
+	}
+	if latest.Markdown != content.Markdown {
+		keep = true
+		return fmt.Errorf("note %d changed while you were editing; your version is in %s", noteID, path)
+	}
+	if err := c.SetNoteMarkdown(ctx, workspaceID, noteID, string(edited)); err != nil {
+		keep = true
+		return fmt.Errorf("%w (your edit is saved in %s)", err, path)
+	}
+	return a.message("Saved note %d", noteID)
+}
+
+// runEditor runs $VISUAL, $EDITOR or vi on path. The variable may include
+// arguments, e.g. "code --wait".
+func runEditor(ctx context.Context, path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	parts := strings.Fields(editor)
+	cmd := exec.CommandContext(ctx, parts[0], append(parts[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %w", parts[0], err)
+	}
+	return nil
+}
+
+func nonZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
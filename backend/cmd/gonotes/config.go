@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Profile is one server login. The token is refreshed in place as the
+// client renews it.
+type Profile struct {
+	Server    string `json:"server"`
+	Username  string `json:"username,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Workspace int    `json:"workspace,omitempty"` // default for -w
+}
+
+// Config is the CLI's settings file
+type Config struct {
+	Current  string              `json:"current,omitempty"`
+	Profiles map[string]*Profile `json:"profiles"`
+
+	path string
+}
+
+// configPath is $GONOTES_CONFIG or gonotes/config.json in the user config dir
+func configPath() (string, error) {
+	if p := os.Getenv("GONOTES_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gonotes", "config.json"), nil
+}
+
+func loadConfig() (*Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{Profiles: map[string]*Profile{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*Profile{}
+	}
+	return cfg, nil
+}
+
+// save writes the file readable by the owner only, since it holds tokens
+func (c *Config) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0o600)
+}
+
+// profileName resolves -profile, then $GONOTES_PROFILE, then the current
+// profile, then "default"
+func (c *Config) profileName(flagValue string) string {
+	switch {
+	case flagValue != "":
+		return flagValue
+	case os.Getenv("GONOTES_PROFILE") != "":
+		return os.Getenv("GONOTES_PROFILE")
+	case c.Current != "":
+		return c.Current
+	}
+	return "default"
+}
+
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,223 @@
+// Command gonotes is a command-line client for a go-notes server. It keeps
+// logins in named profiles so one machine can talk to several servers, and
+// every command accepts --json for scripting.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"go-notes/backend/client"
+)
+
+const usage = `Usage: gonotes [--profile NAME] [--json] COMMAND [ARGS]
+
+Commands:
+  login [-server URL] [-username NAME]   log in and save the token
+  logout                                 forget the saved token
+  profile ls | use NAME | rm NAME        manage server profiles
+  ws ls | use ID                         list workspaces, set the default
+  notes ls [-folder ID] [-tag T] [-trashed] [-sort F] [-desc] [-limit N]
+  notes new [-folder ID] [-tags a,b] [-color C] [-file PATH|-] TITLE
+  notes mv NOTE (-folder ID | -root | -to-ws ID)
+  notes rm NOTE [-permanent]             move to trash, or delete for good
+  notes restore NOTE
+  tag NOTE [-add | -remove] [TAG...]     list, set, add or remove tags
+  search [-mode full|fuzzy|semantic] [-limit N] QUERY
+  cat NOTE                               print a note as Markdown
+  edit NOTE                              edit a note in $VISUAL or $EDITOR
+
+Commands taking a workspace accept -w ID and otherwise use the profile's
+default. The password is read from GONOTES_PASSWORD or prompted for.
+`
+
+// errUsage makes run print the usage text
+var errUsage = errors.New("invalid usage")
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"login":   cmdLogin,
+	"logout":  cmdLogout,
+	"profile": subcommands(map[string]command{"ls": cmdProfileList, "use": cmdProfileUse, "rm": cmdProfileRemove}),
+	"ws":      subcommands(map[string]command{"ls": cmdWorkspaceList, "use": cmdWorkspaceUse}),
+	"notes": subcommands(map[string]command{
+		"ls": cmdNotesList, "new": cmdNotesNew, "mv": cmdNotesMove,
+		"rm": cmdNotesRemove, "restore": cmdNotesRestore,
+	}),
+	"tag":    cmdTag,
+	"search": cmdSearch,
+	"cat":    cmdCat,
+	"edit":   cmdEdit,
+}
+
+func subcommands(sub map[string]command) command {
+	return func(ctx context.Context, a *app, args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		cmd, ok := sub[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown subcommand %q", args[0])
+		}
+		return cmd(ctx, a, args[1:])
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "gonotes:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("gonotes", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	profile := fs.String("profile", "", "configuration profile")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q (see gonotes -h)", args[0])
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	a := &app{
+		cfg:     cfg,
+		profile: cfg.profileName(*profile),
+		json:    *jsonOut,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+	err = cmd(ctx, a, args[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(stderr, usage)
+	}
+	return err
+}
+
+// app is the state shared by commands
+type app struct {
+	cfg     *Config
+	profile string
+	json    bool
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+// flags returns a flag set for a command; every command accepts --json so
+// it can follow the command name as well as precede it
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("gonotes "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.BoolVar(&a.json, "json", a.json, "print JSON")
+	return fs
+}
+
+// parse parses flags anywhere among the positional arguments, so both
+// "notes rm 3 -permanent" and "notes rm -permanent 3" work. Arguments after
+// "--" are never treated as flags.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// current returns the selected profile, which may not exist yet
+func (a *app) current() *Profile {
+	if p, ok := a.cfg.Profiles[a.profile]; ok {
+		return p
+	}
+	return &Profile{}
+}
+
+// client returns an API client for the selected profile. Renewed tokens are
+// written back to the config file.
+func (a *app) client() (*client.Client, error) {
+	p, ok := a.cfg.Profiles[a.profile]
+	if !ok || p.Server == "" {
+		return nil, fmt.Errorf("profile %q is not configured; run gonotes login -server URL", a.profile)
+	}
+	if p.Token == "" {
+		return nil, fmt.Errorf("not logged in to %s; run gonotes login", p.Server)
+	}
+	return client.New(p.Server,
+		client.WithToken(p.Token),
+		client.WithTokenHandler(func(token string) {
+			if token == p.Token {
+				return
+			}
+			p.Token = token
+			if err := a.cfg.save(); err != nil {
+				fmt.Fprintln(a.stderr, "gonotes: saving refreshed token:", err)
+			}
+		}),
+	), nil
+}
+
+// workspace resolves -w, falling back to the profile default
+func (a *app) workspace(flagValue int) (int, error) {
+	if flagValue > 0 {
+		return flagValue, nil
+	}
+	if ws := a.current().Workspace; ws > 0 {
+		return ws, nil
+	}
+	return 0, errors.New("no workspace given; pass -w ID or run gonotes ws use ID")
+}
+
+// splitList parses a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
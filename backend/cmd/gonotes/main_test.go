@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer implements just enough of the API for the commands under test
+func fakeServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Invalid credentials"}`))
+			return
+		}
+		w.Write([]byte(`{"token":"tok","user":{"id":1,"username":"alice","is_admin":false}}`))
+	})
+	mux.HandleFunc("GET /workspaces", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":7,"name":"Personal","owner_id":1,"role":"owner"}]`))
+	})
+	mux.HandleFunc("GET /workspaces/7/notes", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "false", r.URL.Query().Get("trashed"))
+		w.Write([]byte(`{"notes":[{"id":5,"workspace_id":7,"title":"Plans","tags":[{"id":1,"name":"work"}]}],"next_cursor":""}`))
+	})
+	mux.HandleFunc("GET /workspaces/7/notes/5/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"markdown":"# Plans\n","ops":[{"insert":"Plans"},{"insert":"\n","attributes":{"header":1}}]}`))
+	})
+	mux.HandleFunc("DELETE /workspaces/7/notes/5", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"Note deleted"}`))
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login" && r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func gonotes(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestProfilesAndCommands(t *testing.T) {
+	srv, calls := fakeServer(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("GONOTES_CONFIG", path)
+	t.Setenv("GONOTES_PROFILE", "")
+
+	t.Setenv("GONOTES_PASSWORD", "wrong")
+	_, err := gonotes(t, "--profile", "work", "login", "-server", srv.URL, "-username", "alice")
+	require.Error(t, err)
+
+	t.Setenv("GONOTES_PASSWORD", "secret")
+	out, err := gonotes(t, "--profile", "work", "login", "-server", srv.URL, "-username", "alice")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Logged in to "+srv.URL+" as alice")
+
+	// The token is saved privately and the first profile becomes current
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	cfg, err := loadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "work", cfg.Current)
+	assert.Equal(t, "tok", cfg.Profiles["work"].Token)
+
+	_, err = gonotes(t, "notes", "ls")
+	assert.ErrorContains(t, err, "no workspace given")
+
+	_, err = gonotes(t, "ws", "use", "7")
+	require.NoError(t, err)
+
+	out, err = gonotes(t, "notes", "ls", "--json")
+	require.NoError(t, err)
+	var notes []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out), &notes))
+	require.Len(t, notes, 1)
+	assert.Equal(t, "Plans", notes[0]["title"])
+
+	out, err = gonotes(t, "notes", "ls")
+	require.NoError(t, err)
+	assert.Regexp(t, `(?m)^5\s+Plans\s+-\s+work`, out)
+
+	out, err = gonotes(t, "cat", "5")
+	require.NoError(t, err)
+	assert.Equal(t, "# Plans\n", out)
+
+	// Flags may follow the note ID
+	_, err = gonotes(t, "notes", "rm", "5", "-permanent")
+	require.NoError(t, err)
+	assert.Contains(t, *calls, "DELETE /workspaces/7/notes/5")
+
+	_, err = gonotes(t, "logout")
+	require.NoError(t, err)
+	_, err = gonotes(t, "ws", "ls")
+	assert.ErrorContains(t, err, "not logged in")
+}
+
+func TestParseInterspersed(t *testing.T) {
+	a := &app{stderr: &bytes.Buffer{}}
+	fs := a.flags("test")
+	n := fs.Int("n", 0, "")
+	rest, err := parse(fs, []string{"a", "-n", "3", "b", "--", "-c"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, *n)
+	assert.Equal(t, []string{"a", "b", "-c"}, rest)
+}
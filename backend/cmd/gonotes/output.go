@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"go-notes/backend/client"
+)
+
+// print writes v as indented JSON with --json, otherwise as the table
+// written by text
+func (a *app) print(v any, text func(w io.Writer)) error {
+	if a.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+// message prints a confirmation, or {"message": ...} with --json
+func (a *app) message(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	return a.print(map[string]string{"message": msg}, func(w io.Writer) {
+		fmt.Fprintln(w, msg)
+	})
+}
+
+func noteTable(w io.Writer, notes []client.Note) {
+	fmt.Fprintln(w, "ID\tTITLE\tFOLDER\tTAGS\tUPDATED")
+	for _, n := range notes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", n.ID, n.Title, optionalID(n.FolderID), tagNames(n.Tags), shortTime(n.UpdatedAt))
+	}
+}
+
+func scoredTable(w io.Writer, notes []client.ScoredNote) {
+	fmt.Fprintln(w, "ID\tWORKSPACE\tTITLE\tSCORE")
+	for _, n := range notes {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%.3f\n", n.ID, n.WorkspaceID, n.Title, n.Score)
+	}
+}
+
+func tagNames(tags []client.Tag) string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func optionalID(id *int) string {
+	if id == nil {
+		return "-"
+	}
+	return fmt.Sprint(*id)
+}
+
+// shortTime trims an RFC 3339 timestamp to the minute
+func shortTime(ts string) string {
+	if len(ts) >= 16 {
+		return strings.Replace(ts[:16], "T", " ", 1)
+	}
+	return ts
+}
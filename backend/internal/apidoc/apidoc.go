@@ -0,0 +1,63 @@
+// Package apidoc serves the OpenAPI description of the REST API and a Swagger
+// UI for browsing it.
+//
+// openapi.json is maintained by hand next to the routes in cmd/main.go. The
+// cmd tests fail when a route is missing from it, when it describes a route
+// that no longer exists, or when a response does not match its schema.
+package apidoc
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// Document returns the raw specification as maintained in the repository
+func Document() []byte {
+	return spec
+}
+
+// Spec returns the specification with its server URL set to basePath, so
+// "Try it out" works when the API is mounted under API_BASE_PATH
+func Spec(basePath string) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	servers, err := json.Marshal([]map[string]string{{"url": basePath}})
+	if err != nil {
+		return nil, err
+	}
+	doc["servers"] = servers
+	return json.Marshal(doc)
+}
+
+// Register adds GET /openapi.json and the Swagger UI at /docs/ to the group
+func Register(api *gin.RouterGroup, basePath string) error {
+	served, err := Spec(basePath)
+	if err != nil {
+		return err
+	}
+	api.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", served)
+	})
+	assets := http.FS(swaggerFiles.FS)
+	api.GET("/docs/*filepath", func(c *gin.Context) {
+		file := c.Param("filepath")
+		if file == "/" || file == "/index.html" {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", swaggerPage)
+			return
+		}
+		c.FileFromFS(file, assets)
+	})
+	return nil
+}
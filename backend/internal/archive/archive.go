@@ -0,0 +1,419 @@
+// Package archive writes and reads workspace export archives.
+//
+// An archive is a zip holding each note's raw Yjs state under notes/, a
+// Markdown rendering of it under markdown/ laid out like the folder tree,
+// the content of its attachments under attachments/, and manifest.json
+// describing the workspace, its folders, notes, attachments and tags.
+// The manifest is written last so notes can be streamed one at a time
+// without holding the workspace in memory. Read validates an archive and
+// turns it back into a workspace to import.
+//
+// WriteFolder exports a single folder for reading elsewhere instead: its
+// notes rendered as Markdown, HTML or text, without state or manifest.
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/quill"
+)
+
+const (
+	// Format identifies go-notes workspace archives in the manifest
+	Format = "go-notes-workspace"
+	// Version is bumped when the manifest changes incompatibly
+	Version = 1
+
+	ManifestName = "manifest.json"
+)
+
+// Manifest is the archive's manifest.json
+type Manifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt string    `json:"exported_at"`
+	Workspace  Workspace `json:"workspace"`
+	Folders    []Folder  `json:"folders"` // root folders, each with its subtree
+	Notes      []Note    `json:"notes"`
+	Tags       []string  `json:"tags"` // every tag used by a note
+}
+
+type Workspace struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	SearchLanguage string `json:"search_language"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type Folder struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	CreatedAt string   `json:"created_at"`
+	Folders   []Folder `json:"folders"`
+}
+
+// Note is a note's metadata with the paths of its files in the archive.
+// IDs are those of the exporting server and only link notes to folders.
+type Note struct {
+	ID             int      `json:"id"`
+	FolderID       *int     `json:"folder_id"`
+	Title          string   `json:"title"`
+	YjsRoomID      string   `json:"yjs_room_id"`
+	Color          string   `json:"color"`
+	Tags           []string `json:"tags"`
+	CreatedBy      string   `json:"created_by,omitempty"` // username
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+	IsTrashed      bool     `json:"is_trashed"`
+	TrashedAt      *string  `json:"trashed_at"`
+	SearchLanguage string   `json:"search_language,omitempty"`
+
+	State    string `json:"state,omitempty"`    // raw Yjs update
+	Markdown string `json:"markdown,omitempty"` // rendered copy
+	// Error says why the content is missing when the document could not
+	// be read
+	Error string `json:"error,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file attached to a note. Its content is stored once
+// under attachments/, named by hash, however many attachments share it.
+// The ID is that of the exporting server, whose URLs the note's content
+// embeds.
+type Attachment struct {
+	ID        int    `json:"id"`
+	Filename  string `json:"filename"`
+	MimeType  string `json:"mime_type"`
+	Size      int64  `json:"size"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"created_at"`
+
+	File string `json:"file,omitempty"` // the content
+	// Error says why the content is missing when it could not be read
+	Error string `json:"error,omitempty"`
+}
+
+// Store is what an export reads metadata from
+type Store interface {
+	ListFolders(ctx context.Context, workspaceID int) ([]db.Folder, error)
+	ListNotesPage(ctx context.Context, workspaceID int, opts db.NoteListOptions) (*db.NotePage, error)
+	GetUserByID(ctx context.Context, id int) (*db.User, error)
+}
+
+// Documents is what an export reads note content from
+type Documents interface {
+	State(ctx context.Context, roomID string) ([]byte, error)
+	Delta(ctx context.Context, roomID string) (quill.Delta, error)
+}
+
+// Files is what an export reads attachments from
+type Files interface {
+	ListAttachments(ctx context.Context, noteID int) ([]db.Attachment, error)
+	// Get opens the content of an attachment by its hash
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// pageSize is how many notes are listed at a time
+const pageSize = 200
+
+// Write streams the archive of a workspace, live and trashed notes alike,
+// to w, with their attachments unless files is nil. A note whose document
+// or attachment cannot be read is exported without it and with Error set;
+// store and write failures abort the export.
+func Write(ctx context.Context, w io.Writer, ws db.Workspace, store Store, docs Documents, files Files) error {
+	folders, err := store.ListFolders(ctx, ws.ID)
+	if err != nil {
+		return fmt.Errorf("list folders: %w", err)
+	}
+	dirs := folderPaths(folders)
+
+	m := Manifest{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Workspace: Workspace{
+			ID:             ws.ID,
+			Name:           ws.Name,
+			SearchLanguage: ws.SearchLanguage,
+			CreatedAt:      ws.CreatedAt,
+		},
+		Folders: folderTree(folders),
+		Notes:   []Note{},
+		Tags:    []string{},
+	}
+
+	zw := zip.NewWriter(w)
+	usernames := map[int]string{}
+	usedPaths := map[string]bool{}
+	tags := map[string]string{}  // lower-cased name to name
+	written := map[string]bool{} // attachment files by hash
+
+	opts := db.NoteListOptions{Limit: pageSize}
+	for {
+		page, err := store.ListNotesPage(ctx, ws.ID, opts)
+		if err != nil {
+			return fmt.Errorf("list notes: %w", err)
+		}
+		for _, n := range page.Notes {
+			entry := Note{
+				ID:             n.ID,
+				FolderID:       n.FolderID,
+				Title:          n.Title,
+				YjsRoomID:      n.YjsRoomID,
+				Color:          n.Color,
+				Tags:           []string{},
+				CreatedAt:      n.CreatedAt,
+				UpdatedAt:      n.UpdatedAt,
+				IsTrashed:      n.IsTrashed,
+				TrashedAt:      n.TrashedAt,
+				SearchLanguage: n.SearchLanguage,
+			}
+			if n.SearchLanguageInherited {
+				entry.SearchLanguage = ""
+			}
+			for _, t := range n.Tags {
+				entry.Tags = append(entry.Tags, t.Name)
+				tags[strings.ToLower(t.Name)] = t.Name
+			}
+			if n.CreatedBy != nil {
+				name, ok := usernames[*n.CreatedBy]
+				if !ok {
+					if u, err := store.GetUserByID(ctx, *n.CreatedBy); err == nil {
+						name = u.Username
+					}
+					usernames[*n.CreatedBy] = name
+				}
+				entry.CreatedBy = name
+			}
+
+			dir := "markdown"
+			if n.IsTrashed {
+				dir = "markdown/.trash"
+			} else if n.FolderID != nil {
+				dir = path.Join("markdown", dirs[*n.FolderID])
+			}
+			if err := writeNote(ctx, zw, &entry, dir, usedPaths, docs); err != nil {
+				return err
+			}
+			if files != nil {
+				if err := writeAttachments(ctx, zw, &entry, written, files); err != nil {
+					return err
+				}
+			}
+			m.Notes = append(m.Notes, entry)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	for _, name := range tags {
+		m.Tags = append(m.Tags, name)
+	}
+	sort.Slice(m.Tags, func(i, j int) bool { return strings.ToLower(m.Tags[i]) < strings.ToLower(m.Tags[j]) })
+
+	f, err := zw.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeNote adds a note's state and Markdown files and records their paths
+func writeNote(ctx context.Context, zw *zip.Writer, entry *Note, dir string, used map[string]bool, docs Documents) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	state, err := docs.State(ctx, entry.YjsRoomID)
+	if err != nil {
+		entry.Error = err.Error()
+		return nil
+	}
+	delta, err := docs.Delta(ctx, entry.YjsRoomID)
+	if err != nil {
+		entry.Error = err.Error()
+		return nil
+	}
+
+	entry.State = fmt.Sprintf("notes/%d.yjs", entry.ID)
+	f, err := zw.Create(entry.State)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(state); err != nil {
+		return err
+	}
+
+	entry.Markdown = uniquePath(used, dir, SafeName(entry.Title), ".md", entry.ID)
+	f, err = zw.CreateHeader(&zip.FileHeader{
+		Name:     entry.Markdown,
+		Method:   zip.Deflate,
+		Modified: parseTime(entry.UpdatedAt),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, quill.ToMarkdown(delta))
+	return err
+}
+
+// writeAttachments lists a note's attachments, adding the content of those
+// not written yet
+func writeAttachments(ctx context.Context, zw *zip.Writer, entry *Note, written map[string]bool, files Files) error {
+	attachments, err := files.ListAttachments(ctx, entry.ID)
+	if err != nil {
+		return fmt.Errorf("list attachments of note %d: %w", entry.ID, err)
+	}
+	for _, a := range attachments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		out := Attachment{
+			ID:        a.ID,
+			Filename:  a.Filename,
+			MimeType:  a.MimeType,
+			Size:      a.Size,
+			Hash:      a.Hash,
+			CreatedAt: a.CreatedAt,
+			File:      "attachments/" + a.Hash,
+		}
+		if !written[a.Hash] {
+			r, err := files.Get(ctx, a.Hash)
+			if err != nil {
+				out.File, out.Error = "", err.Error()
+				entry.Attachments = append(entry.Attachments, out)
+				continue
+			}
+			err = writeAttachment(zw, out, r)
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("attachment %d: %w", a.ID, err)
+			}
+			written[a.Hash] = true
+		}
+		entry.Attachments = append(entry.Attachments, out)
+	}
+	return nil
+}
+
+// writeAttachment copies an attachment's content into the archive. Once
+// the file is started a failed read would leave it truncated, so it fails
+// the export.
+func writeAttachment(zw *zip.Writer, a Attachment, r io.Reader) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     a.File,
+		Method:   zip.Deflate,
+		Modified: parseTime(a.CreatedAt),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// folderTree nests the folders under their parents, sorted by name
+func folderTree(folders []db.Folder) []Folder {
+	children := map[int][]db.Folder{} // parent ID, 0 for the root
+	for _, f := range folders {
+		parent := 0
+		if f.ParentID != nil {
+			parent = *f.ParentID
+		}
+		children[parent] = append(children[parent], f)
+	}
+	var build func(parent int) []Folder
+	build = func(parent int) []Folder {
+		out := []Folder{}
+		for _, f := range children[parent] {
+			out = append(out, Folder{ID: f.ID, Name: f.Name, CreatedAt: f.CreatedAt, Folders: build(f.ID)})
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		return out
+	}
+	return build(0)
+}
+
+// folderPaths maps folder IDs to slash-separated paths of safe names
+func folderPaths(folders []db.Folder) map[int]string {
+	byID := make(map[int]db.Folder, len(folders))
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+	paths := make(map[int]string, len(folders))
+	var resolve func(id int, depth int) string
+	resolve = func(id int, depth int) string {
+		if p, ok := paths[id]; ok {
+			return p
+		}
+		f := byID[id]
+		p := SafeName(f.Name)
+		// The depth bound guards against a corrupt parent cycle
+		if f.ParentID != nil && depth < len(folders) {
+			if _, ok := byID[*f.ParentID]; ok {
+				p = path.Join(resolve(*f.ParentID, depth+1), p)
+			}
+		}
+		paths[id] = p
+		return p
+	}
+	for _, f := range folders {
+		resolve(f.ID, 0)
+	}
+	return paths
+}
+
+// uniquePath returns dir/name plus ext, adding the note ID when two notes
+// in a folder share a title
+func uniquePath(used map[string]bool, dir, name, ext string, id int) string {
+	p := path.Join(dir, name+ext)
+	if used[strings.ToLower(p)] {
+		p = path.Join(dir, fmt.Sprintf("%s (%d)%s", name, id, ext))
+	}
+	used[strings.ToLower(p)] = true
+	return p
+}
+
+// SafeName makes a title or folder name usable as a file name on common
+// file systems
+func SafeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > 120 {
+		name = strings.ToValidUTF8(name[:120], "")
+	}
+	if name == "" {
+		return "Untitled"
+	}
+	return name
+}
+
+// parseTime reads the store's timestamps, which are RFC 3339 on both
+// databases, falling back to now
+func parseTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	return time.Now()
+}
@@ -0,0 +1,555 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/memstore"
+	"go-notes/backend/internal/quill"
+	"go-notes/backend/internal/render"
+)
+
+// documents serves Markdown content as Yjs state and Delta
+type documents map[string]string
+
+func (d documents) State(ctx context.Context, roomID string) ([]byte, error) {
+	md, ok := d[roomID]
+	if !ok {
+		return nil, errors.New("document service returned 500")
+	}
+	return []byte("yjs:" + md), nil
+}
+
+func (d documents) Delta(ctx context.Context, roomID string) (quill.Delta, error) {
+	md, ok := d[roomID]
+	if !ok {
+		return quill.Delta{}, errors.New("document service returned 500")
+	}
+	return quill.FromMarkdown(md), nil
+}
+
+func readZip(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	ws := workspaces[0]
+
+	projects, err := store.CreateFolder(ctx, ws.ID, "Projects", nil)
+	require.NoError(t, err)
+	sub, err := store.CreateFolder(ctx, ws.ID, "a/b", &projects)
+	require.NoError(t, err)
+	plan, err := store.CreateNoteWithTags(ctx, ws.ID, "Plan", &sub, &alice.ID, "#FFEB3B", []string{"Work"})
+	require.NoError(t, err)
+	again, err := store.CreateNoteWithTags(ctx, ws.ID, "plan", &sub, nil, "", []string{"work", "Ideas"})
+	require.NoError(t, err)
+	old, err := store.CreateNoteWithTags(ctx, ws.ID, "Old", nil, nil, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.TrashNote(ctx, old))
+	broken, err := store.CreateNoteWithTags(ctx, ws.ID, "Broken", nil, nil, "", nil)
+	require.NoError(t, err)
+
+	docs := documents{}
+	for _, id := range []int{plan, again, old} {
+		n, err := store.GetNote(ctx, id)
+		require.NoError(t, err)
+		docs[n.YjsRoomID] = "# " + n.Title + "\n"
+	}
+	page, err := store.ListNotesPage(ctx, ws.ID, db.NoteListOptions{})
+	require.NoError(t, err)
+	for _, n := range page.Notes {
+		if n.Title == "Intro & Guide" {
+			docs[n.YjsRoomID] = "Welcome\n"
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(ctx, &buf, ws, store, docs, nil))
+	files := readZip(t, buf.Bytes())
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal([]byte(files[ManifestName]), &m))
+	assert.Equal(t, Format, m.Format)
+	assert.Equal(t, Version, m.Version)
+	assert.Equal(t, ws.Name, m.Workspace.Name)
+	require.Len(t, m.Folders, 1)
+	assert.Equal(t, "Projects", m.Folders[0].Name)
+	require.Len(t, m.Folders[0].Folders, 1)
+	assert.Equal(t, sub, m.Folders[0].Folders[0].ID)
+	assert.Equal(t, []string{"Ideas", "Work"}, m.Tags, "tags are listed once whatever their case")
+
+	notes := map[int]Note{}
+	for _, n := range m.Notes {
+		notes[n.ID] = n
+	}
+	require.Len(t, notes, 5)
+
+	p := notes[plan]
+	assert.Equal(t, "alice", p.CreatedBy)
+	assert.Equal(t, "#FFEB3B", p.Color)
+	assert.Equal(t, []string{"Work"}, p.Tags)
+	assert.Equal(t, &sub, p.FolderID)
+	assert.Equal(t, "markdown/Projects/a_b/Plan.md", p.Markdown, "names are made safe for file systems")
+	assert.Equal(t, "# Plan\n", files[p.Markdown])
+	assert.Equal(t, "yjs:# Plan\n", files[p.State])
+
+	assert.NotEqual(t, p.Markdown, notes[again].Markdown, "titles differing only in case get distinct files")
+	assert.Contains(t, files, notes[again].Markdown)
+
+	assert.True(t, notes[old].IsTrashed)
+	assert.NotNil(t, notes[old].TrashedAt)
+	assert.Equal(t, "markdown/.trash/Old.md", notes[old].Markdown)
+
+	// A document that cannot be read is reported rather than failing the export
+	assert.NotEmpty(t, notes[broken].Error)
+	assert.Empty(t, notes[broken].State)
+	assert.Empty(t, notes[broken].Markdown)
+}
+
+func TestWriteFolder(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	wsID := workspaces[0].ID
+
+	parent, err := store.CreateFolder(ctx, wsID, "Work", nil)
+	require.NoError(t, err)
+	projects, err := store.CreateFolder(ctx, wsID, "Projects", &parent)
+	require.NoError(t, err)
+	sub, err := store.CreateFolder(ctx, wsID, "Q1", &projects)
+	require.NoError(t, err)
+	_, err = store.CreateFolder(ctx, wsID, "Empty", &projects)
+	require.NoError(t, err)
+	docs := documents{}
+	note := func(title string, folderID *int, md string) int {
+		id, err := store.CreateNoteWithTags(ctx, wsID, title, folderID, nil, "", nil)
+		require.NoError(t, err)
+		if md != "" {
+			n, err := store.GetNote(ctx, id)
+			require.NoError(t, err)
+			docs[n.YjsRoomID] = md
+		}
+		return id
+	}
+	note("Plan", &projects, "# Plan\n- **ship**\n")
+	note("Review", &sub, "Done\n")
+	note("Outside", &parent, "Not exported\n")
+	old := note("Old", &projects, "Trashed\n")
+	require.NoError(t, store.TrashNote(ctx, old))
+	broken := note("Broken", &sub, "")
+
+	folder, err := store.GetFolder(ctx, projects)
+	require.NoError(t, err)
+	format, _ := render.Lookup("html")
+	var buf bytes.Buffer
+	require.NoError(t, WriteFolder(ctx, &buf, *folder, store, docs, format, nil))
+	files := readZip(t, buf.Bytes())
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"Projects/", "Projects/Q1/", "Projects/Empty/",
+		"Projects/Plan.html", "Projects/Q1/Review.html", "Projects/" + ErrorsName,
+	}, names)
+	assert.Contains(t, files["Projects/Plan.html"], "<title>Plan</title>")
+	assert.Contains(t, files["Projects/Plan.html"], "<li><strong>ship</strong></li>")
+	assert.Contains(t, files["Projects/"+ErrorsName], fmt.Sprintf("Broken (note %d)", broken))
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// Another process's result is left alone
+	other := filepath.Join(dir, "other.zip")
+	require.NoError(t, os.WriteFile(other, []byte("archive"), 0o600))
+	jobs, err := NewJobs(dir, memstore.New(), time.Hour, 0, 0)
+	require.NoError(t, err)
+	assert.FileExists(t, other)
+
+	release := make(chan struct{})
+	job, err := jobs.Start(ctx, 1, 2, func(ctx context.Context, w io.Writer) error {
+		<-release
+		_, err := io.WriteString(w, "archive")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, JobRunning, job.Status)
+	_, err = jobs.Open(ctx, job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFinished)
+
+	close(release)
+	job = waitForJob(t, jobs, job.ID)
+	assert.Equal(t, JobDone, job.Status)
+	assert.Equal(t, int64(len("archive")), job.Size)
+	f, err := jobs.Open(ctx, job.ID)
+	require.NoError(t, err)
+	content, _ := io.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "archive", string(content))
+
+	// The state is in the store, so another process serves the result
+	restarted, err := NewJobs(dir, jobs.store, time.Hour, 0, 0)
+	require.NoError(t, err)
+	f, err = restarted.Open(ctx, job.ID)
+	require.NoError(t, err)
+	f.Close()
+
+	failed, err := jobs.Start(ctx, 1, 2, func(ctx context.Context, w io.Writer) error {
+		return errors.New("document service down")
+	})
+	require.NoError(t, err)
+	failed = waitForJob(t, jobs, failed.ID)
+	assert.Equal(t, JobFailed, failed.Status)
+	assert.Equal(t, "document service down", failed.Error)
+	_, err = jobs.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	// Expired jobs are forgotten along with their files
+	jobs.retention, jobs.pruneEvery = 0, 0
+	expiring, err := jobs.Start(ctx, 1, 2, func(ctx context.Context, w io.Writer) error { return nil })
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := jobs.Get(ctx, expiring.ID)
+		return errors.Is(err, ErrJobNotFound)
+	}, time.Second, 5*time.Millisecond)
+	assert.NoFileExists(t, jobs.path(expiring.ID))
+	assert.FileExists(t, other)
+}
+
+func TestJobLimits(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	jobs, err := NewJobs(t.TempDir(), store, time.Hour, 2, 1)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	blocked := func(ctx context.Context, w io.Writer) error {
+		<-release
+		return nil
+	}
+
+	first, err := jobs.Start(ctx, 1, 2, blocked)
+	require.NoError(t, err)
+	_, err = jobs.Start(ctx, 1, 2, blocked)
+	assert.ErrorIs(t, err, ErrTooManyJobs)
+	// The user's jobs count on every process
+	elsewhere, err := NewJobs(jobs.dir, store, time.Hour, 2, 1)
+	require.NoError(t, err)
+	_, err = elsewhere.Start(ctx, 1, 2, blocked)
+	assert.ErrorIs(t, err, ErrTooManyJobs)
+
+	_, err = jobs.Start(ctx, 1, 3, blocked)
+	require.NoError(t, err)
+	_, err = jobs.Start(ctx, 1, 4, blocked)
+	assert.ErrorIs(t, err, ErrBusy)
+
+	close(release)
+	waitForJob(t, jobs, first.ID)
+	require.Eventually(t, func() bool {
+		_, err := jobs.Start(ctx, 1, 4, blocked)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStalledJob(t *testing.T) {
+	ctx := context.Background()
+	jobs, err := NewJobs(t.TempDir(), memstore.New(), time.Hour, 0, 0)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	job, err := jobs.Start(ctx, 1, 2, func(ctx context.Context, w io.Writer) error {
+		<-release
+		_, err := io.WriteString(w, "archive")
+		return err
+	})
+	require.NoError(t, err)
+
+	// A job not heard from is given up, and what it writes later discarded
+	jobs.stalledAfter, jobs.pruneEvery = 0, 0
+	job, err = jobs.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobFailed, job.Status)
+	close(release)
+	require.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(jobs.dir)
+		return len(entries) == 0
+	}, time.Second, 5*time.Millisecond)
+	job, err = jobs.Get(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "the export was interrupted", job.Error)
+}
+
+func waitForJob(t *testing.T, jobs *Jobs, id string) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = jobs.Get(context.Background(), id)
+		return err == nil && job.Status != JobRunning
+	}, time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	ws := workspaces[0]
+
+	parent, err := store.CreateFolder(ctx, ws.ID, "Parent", nil)
+	require.NoError(t, err)
+	child, err := store.CreateFolder(ctx, ws.ID, "Child", &parent)
+	require.NoError(t, err)
+	noteID, err := store.CreateNoteWithTags(ctx, ws.ID, "Deep", &child, &alice.ID, "#E1F5FE", []string{"Go"})
+	require.NoError(t, err)
+	require.NoError(t, store.TrashNote(ctx, noteID))
+	n, err := store.GetNote(ctx, noteID)
+	require.NoError(t, err)
+
+	docs := documents{n.YjsRoomID: "Some **bold** text\n"}
+	var buf bytes.Buffer
+	require.NoError(t, Write(ctx, &buf, ws, store, docs, nil))
+
+	in, report := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 1<<30)
+	require.NotNil(t, in, report.Errors)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, ws.Name, report.Workspace)
+	assert.Equal(t, 2, report.Folders)
+	assert.Equal(t, 2, report.Notes, "the intro note and Deep")
+	assert.Equal(t, 1, report.Trashed)
+	assert.Equal(t, []string{"Go"}, report.Tags)
+	assert.Len(t, report.Warnings, 1, "the intro note has no content in the fake service: %v", report.Warnings)
+
+	require.Len(t, in.Folders, 2)
+	assert.Equal(t, db.ImportFolder{Key: parent, Name: "Parent", CreatedAt: in.Folders[0].CreatedAt}, in.Folders[0])
+	assert.Equal(t, &parent, in.Folders[1].ParentKey, "parents come first")
+	assert.NotNil(t, in.Folders[0].CreatedAt)
+
+	var deep db.ImportNote
+	for _, note := range in.Notes {
+		if note.Key == noteID {
+			deep = note
+		}
+	}
+	assert.Equal(t, "Deep", deep.Title)
+	assert.Equal(t, &child, deep.FolderKey)
+	assert.Equal(t, "#E1F5FE", deep.Color)
+	assert.Equal(t, []string{"Go"}, deep.Tags)
+	assert.True(t, deep.IsTrashed)
+	require.NotNil(t, deep.TrashedAt)
+	assert.Equal(t, *n.TrashedAt, deep.TrashedAt.Format(time.RFC3339Nano))
+	assert.Equal(t, []byte("yjs:Some **bold** text\n"), deep.Content)
+	assert.Equal(t, "Some bold text", deep.ContentText)
+}
+
+// files serves attachment content kept in memory by hash
+type files struct {
+	*memstore.Store
+	blobs map[string]string
+}
+
+func (f files) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	content, ok := f.blobs[key]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func TestAttachmentsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	ws := workspaces[0]
+
+	fs := files{Store: store, blobs: map[string]string{"aa11": "%PDF-1.4 report", "bb22": "photo"}}
+	attach := func(noteID int, filename, hash string, size int64) db.Attachment {
+		a := db.Attachment{NoteID: noteID, Filename: filename, MimeType: "application/pdf", Size: size, Hash: hash, Key: "k"}
+		require.NoError(t, store.CreateAttachment(ctx, &a, 0, func() error { return nil }))
+		return a
+	}
+	trip, err := store.CreateNoteWithTags(ctx, ws.ID, "Trip", nil, nil, "", nil)
+	require.NoError(t, err)
+	again, err := store.CreateNoteWithTags(ctx, ws.ID, "Again", nil, nil, "", nil)
+	require.NoError(t, err)
+	report := attach(trip, "report.pdf", "aa11", 15)
+	attach(again, "copy.pdf", "aa11", 15)
+	attach(trip, "lost.jpg", "cc33", 4)
+
+	docs := documents{}
+	page, err := store.ListNotesPage(ctx, ws.ID, db.NoteListOptions{})
+	require.NoError(t, err)
+	for _, n := range page.Notes {
+		docs[n.YjsRoomID] = n.Title + "\n"
+	}
+	var buf bytes.Buffer
+	require.NoError(t, Write(ctx, &buf, ws, store, docs, fs))
+	zipped := readZip(t, buf.Bytes())
+	var m Manifest
+	require.NoError(t, json.Unmarshal([]byte(zipped[ManifestName]), &m))
+	notes := map[int]Note{}
+	for _, n := range m.Notes {
+		notes[n.ID] = n
+	}
+	require.Len(t, notes[trip].Attachments, 2)
+	exported := notes[trip].Attachments[0]
+	assert.Equal(t, report.ID, exported.ID)
+	assert.Equal(t, "report.pdf", exported.Filename)
+	assert.Equal(t, "attachments/aa11", exported.File)
+	assert.Equal(t, "%PDF-1.4 report", zipped[exported.File])
+	assert.Equal(t, "attachments/aa11", notes[again].Attachments[0].File, "shared content is stored once")
+	assert.Empty(t, notes[trip].Attachments[1].File)
+	assert.NotEmpty(t, notes[trip].Attachments[1].Error, "unreadable content is reported")
+
+	in, rep := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 1<<30)
+	require.NotNil(t, in, rep.Errors)
+	assert.Equal(t, 2, rep.Attachments)
+	assert.Len(t, rep.Warnings, 1, "the attachment exported without content: %v", rep.Warnings)
+	require.Len(t, in.Attachments[trip], 1)
+	f := in.Attachments[trip][0]
+	assert.Equal(t, report.ID, f.ID)
+	assert.Equal(t, "report.pdf", f.Filename)
+	rc, err := f.Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 report", string(content))
+	assert.Len(t, in.Attachments[again], 1)
+}
+
+// writeArchive zips the given files, marshalling a manifest
+func writeArchive(t *testing.T, m Manifest, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	raw, err := json.Marshal(m)
+	require.NoError(t, err)
+	files[ManifestName] = string(raw)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = io.WriteString(f, content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestReadValidation(t *testing.T) {
+	read := func(b []byte) (*Import, Report) {
+		return Read(bytes.NewReader(b), int64(len(b)), 1<<30)
+	}
+
+	in, report := read([]byte("not a zip"))
+	assert.Nil(t, in)
+	assert.Len(t, report.Errors, 1)
+
+	in, report = read(writeArchive(t, Manifest{Format: "other", Version: 1}, map[string]string{}))
+	assert.Nil(t, in)
+	assert.Contains(t, report.Errors[0], "Not a go-notes workspace archive")
+
+	in, report = read(writeArchive(t, Manifest{Format: Format, Version: Version + 1}, map[string]string{}))
+	assert.Nil(t, in)
+	assert.Contains(t, report.Errors[0], "Unsupported archive version")
+
+	missing := 99
+	in, report = read(writeArchive(t, Manifest{
+		Format: Format, Version: Version,
+		Folders: []Folder{{ID: 1, Name: "A"}, {ID: 1, Name: "B"}},
+		Notes: []Note{
+			{ID: 10, FolderID: &missing},
+			{ID: 11, State: "notes/11.yjs"},
+			{ID: 12, Error: "document service returned 500", CreatedAt: "yesterday"},
+		},
+	}, map[string]string{}))
+	assert.Nil(t, in)
+	assert.Equal(t, []string{
+		"Folder 1 appears more than once",
+		"Note 10 is in folder 99, which is not in the archive",
+		"Note 11: notes/11.yjs is missing from the archive",
+	}, report.Errors)
+	assert.Equal(t, []string{
+		`The workspace has no name; it is imported as "Imported workspace"`,
+		`Unreadable note 12 created_at "yesterday"; the import time is used instead`,
+		"Note 12 (Untitled) was exported without content: document service returned 500",
+	}, report.Warnings)
+}
+
+func TestReadUnpackedLimit(t *testing.T) {
+	m := Manifest{
+		Format: Format, Version: Version,
+		Notes: []Note{{ID: 1, Title: "Big", State: "notes/1.yjs", Attachments: []Attachment{
+			{ID: 5, Filename: "a.bin", File: "attachments/5"},
+			{ID: 6, Filename: "b.bin", File: "attachments/6"},
+		}}},
+	}
+	half := strings.Repeat("x", 600<<10)
+	b := writeArchive(t, m, map[string]string{"notes/1.yjs": "state", "attachments/5": half, "attachments/6": half})
+
+	in, report := Read(bytes.NewReader(b), int64(len(b)), 1<<20)
+	assert.Nil(t, in)
+	assert.Equal(t, []string{"The archive unpacks to more than 1 MB"}, report.Errors, "each file fits, not all of them")
+
+	in, report = Read(bytes.NewReader(b), int64(len(b)), 2<<20)
+	require.NotNil(t, in, report.Errors)
+	require.Len(t, in.Attachments[1], 2)
+	r, err := in.Attachments[1][0].Open()
+	require.NoError(t, err)
+	defer r.Close()
+	first, err := io.ReadAll(r)
+	require.NoError(t, err)
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	again, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, half, string(first))
+	assert.Equal(t, first, again, "rewinding reads the entry again")
+	_, err = r.Seek(10, io.SeekStart)
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/render"
+)
+
+// ErrorsName lists, in a folder export, the notes whose content could not
+// be read
+const ErrorsName = "export-errors.txt"
+
+// WriteFolder streams a zip of a folder's live notes rendered in one
+// format, laid out like the folder tree below a directory named after the
+// folder. Notes whose document cannot be read are left out and listed in
+// ErrorsName; store and write failures abort the export. images loads the
+// images notes embed by URL, for formats that include them.
+func WriteFolder(ctx context.Context, w io.Writer, folder db.Folder, store Store, docs Documents, format render.Format, images render.Images) error {
+	folders, err := store.ListFolders(ctx, folder.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("list folders: %w", err)
+	}
+	dirs := folderPaths(folders)
+	root := SafeName(folder.Name)
+	// dir places a folder of the subtree below the export's root directory
+	dir := func(id int) string {
+		return path.Join(root, strings.TrimPrefix(dirs[id], dirs[folder.ID]))
+	}
+
+	zw := zip.NewWriter(w)
+	used := map[string]bool{}
+	var failed []string
+	live := false
+	for _, id := range subtree(folders, folder.ID) {
+		if _, err := zw.Create(dir(id) + "/"); err != nil {
+			return err
+		}
+		opts := db.NoteListOptions{FolderID: &id, Trashed: &live, Sort: "title", Limit: pageSize}
+		for {
+			page, err := store.ListNotesPage(ctx, folder.WorkspaceID, opts)
+			if err != nil {
+				return fmt.Errorf("list notes: %w", err)
+			}
+			for _, n := range page.Notes {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				delta, err := docs.Delta(ctx, n.YjsRoomID)
+				if err != nil {
+					failed = append(failed, fmt.Sprintf("%s (note %d): %v", n.Title, n.ID, err))
+					continue
+				}
+				f, err := zw.CreateHeader(&zip.FileHeader{
+					Name:     uniquePath(used, dir(id), SafeName(n.Title), format.Ext, n.ID),
+					Method:   zip.Deflate,
+					Modified: parseTime(n.UpdatedAt),
+				})
+				if err != nil {
+					return err
+				}
+				doc := render.NewDoc(n, delta)
+				doc.Images = images
+				if err := format.Write(f, doc); err != nil {
+					return err
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+
+	if len(failed) > 0 {
+		f, err := zw.Create(path.Join(root, ErrorsName))
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, "These notes could not be read and are missing:\n"+strings.Join(failed, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// subtree lists a folder and the folders below it, parents first
+func subtree(folders []db.Folder, rootID int) []int {
+	children := map[int][]int{}
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+	out := []int{rootID}
+	seen := map[int]bool{rootID: true}
+	for i := 0; i < len(out); i++ {
+		for _, c := range children[out[i]] {
+			// A corrupt parent cycle is walked once
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
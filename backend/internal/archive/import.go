@@ -0,0 +1,354 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/quill"
+)
+
+// Report describes what importing an archive creates. An archive with
+// Errors is not imported; Warnings note what is imported differently.
+type Report struct {
+	Workspace   string   `json:"workspace"`
+	Folders     int      `json:"folders"`
+	Notes       int      `json:"notes"`
+	Trashed     int      `json:"trashed"`
+	Attachments int      `json:"attachments"`
+	Tags        []string `json:"tags"`
+	Warnings    []string `json:"warnings"`
+	Errors      []string `json:"errors"`
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) fail(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Import is a workspace read from an archive, with the attachments of its
+// notes by note key. Attachments stay in the archive until opened.
+type Import struct {
+	db.WorkspaceImport
+	Attachments map[int][]File
+}
+
+// File is an attachment in an archive. Its ID is that of the exporting
+// server, which the content of the archive's notes refers to.
+type File struct {
+	ID       int
+	Filename string
+	Size     int64
+	zip      *zip.File
+	left     *budget
+}
+
+// Open streams the attachment's content from the archive. Seeking back to
+// the start decompresses it again rather than keeping it in memory.
+func (f File) Open() (io.ReadSeekCloser, error) {
+	rc, err := f.zip.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &entryReader{f: f.zip, rc: rc, left: f.left}, nil
+}
+
+// entryReader reads a zip entry, rewinding by reopening it. The first read
+// through counts against the archive's budget.
+type entryReader struct {
+	f      *zip.File
+	rc     io.ReadCloser
+	left   *budget
+	reread bool
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if !r.reread {
+		if berr := r.left.take(int64(n)); berr != nil {
+			return n, berr
+		}
+	}
+	return n, err
+}
+
+func (r *entryReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("archive: an attachment can only be read again from the start")
+	}
+	rc, err := r.f.Open()
+	if err != nil {
+		return 0, err
+	}
+	r.rc.Close()
+	r.rc, r.reread = rc, true
+	return 0, nil
+}
+
+func (r *entryReader) Close() error {
+	return r.rc.Close()
+}
+
+// maxFileSize bounds each file read from an archive, against zip bombs
+const maxFileSize = 256 << 20
+
+// budget counts the bytes unpacked from an archive against its limit. The
+// sizes entries declare are checked against the limit before anything is
+// read; counting what is read does not rely on them being true.
+type budget struct {
+	mu          sync.Mutex
+	limit, left int64
+}
+
+// take counts n bytes read, failing once the archive has unpacked to more
+// than its limit
+func (b *budget) take(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.left -= n
+	if b.left < 0 {
+		return fmt.Errorf("the archive unpacks to more than %d MB", b.limit>>20)
+	}
+	return nil
+}
+
+// Read validates an archive written by Write and returns the workspace it
+// describes, with every note's content loaded and its attachments ready to
+// open. Archives whose files add up to more than maxUnpacked bytes are
+// refused. The import is nil when the report has errors.
+func Read(r io.ReaderAt, size, maxUnpacked int64) (*Import, Report) {
+	report := Report{Tags: []string{}, Warnings: []string{}, Errors: []string{}}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		report.fail("Not a zip archive: %v", err)
+		return nil, report
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	var declared uint64
+	for _, f := range zr.File {
+		files[f.Name] = f
+		declared += f.UncompressedSize64
+		if f.UncompressedSize64 > uint64(maxUnpacked) || declared > uint64(maxUnpacked) {
+			report.fail("The archive unpacks to more than %d MB", maxUnpacked>>20)
+			return nil, report
+		}
+	}
+	left := &budget{limit: maxUnpacked, left: maxUnpacked}
+
+	var m Manifest
+	raw, err := readFile(files, ManifestName, left)
+	if err == nil {
+		err = json.Unmarshal(raw, &m)
+	}
+	if err != nil {
+		report.fail("Invalid %s: %v", ManifestName, err)
+		return nil, report
+	}
+	if m.Format != Format {
+		report.fail("Not a go-notes workspace archive (format %q)", m.Format)
+		return nil, report
+	}
+	if m.Version < 1 || m.Version > Version {
+		report.fail("Unsupported archive version %d; this server reads up to %d", m.Version, Version)
+		return nil, report
+	}
+
+	in := &Import{
+		WorkspaceImport: db.WorkspaceImport{
+			Name:           strings.TrimSpace(m.Workspace.Name),
+			SearchLanguage: m.Workspace.SearchLanguage,
+			CreatedAt:      parseTimestamp(&report, "workspace created_at", m.Workspace.CreatedAt),
+		},
+		Attachments: map[int][]File{},
+	}
+	if in.Name == "" {
+		in.Name = "Imported workspace"
+		report.warn("The workspace has no name; it is imported as %q", in.Name)
+	}
+	report.Workspace = in.Name
+
+	// Flattening the tree puts parents before their children
+	folders := map[int]bool{}
+	var flatten func(parent *int, list []Folder)
+	flatten = func(parent *int, list []Folder) {
+		for _, f := range list {
+			if folders[f.ID] {
+				report.fail("Folder %d appears more than once", f.ID)
+				continue
+			}
+			folders[f.ID] = true
+			name := strings.TrimSpace(f.Name)
+			if name == "" {
+				name = "Untitled"
+				report.warn("Folder %d has no name; it is imported as %q", f.ID, name)
+			}
+			in.Folders = append(in.Folders, db.ImportFolder{
+				Key:       f.ID,
+				ParentKey: parent,
+				Name:      name,
+				CreatedAt: parseTimestamp(&report, fmt.Sprintf("folder %d created_at", f.ID), f.CreatedAt),
+			})
+			id := f.ID
+			flatten(&id, f.Folders)
+		}
+	}
+	flatten(nil, m.Folders)
+
+	notes := map[int]bool{}
+	tags := map[string]string{}
+	for _, n := range m.Notes {
+		if notes[n.ID] {
+			report.fail("Note %d appears more than once", n.ID)
+			continue
+		}
+		notes[n.ID] = true
+		if n.FolderID != nil && !folders[*n.FolderID] {
+			report.fail("Note %d is in folder %d, which is not in the archive", n.ID, *n.FolderID)
+			continue
+		}
+		note := db.ImportNote{
+			Key:            n.ID,
+			FolderKey:      n.FolderID,
+			Title:          strings.TrimSpace(n.Title),
+			Color:          n.Color,
+			CreatedAt:      parseTimestamp(&report, fmt.Sprintf("note %d created_at", n.ID), n.CreatedAt),
+			UpdatedAt:      parseTimestamp(&report, fmt.Sprintf("note %d updated_at", n.ID), n.UpdatedAt),
+			IsTrashed:      n.IsTrashed,
+			SearchLanguage: n.SearchLanguage,
+		}
+		if note.Title == "" {
+			note.Title = "Untitled"
+		}
+		if note.Color == "" {
+			note.Color = "#FFFFFF"
+		}
+		if n.IsTrashed {
+			report.Trashed++
+			if n.TrashedAt != nil {
+				note.TrashedAt = parseTimestamp(&report, fmt.Sprintf("note %d trashed_at", n.ID), *n.TrashedAt)
+			}
+		}
+		for _, t := range n.Tags {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			note.Tags = append(note.Tags, t)
+			if _, ok := tags[strings.ToLower(t)]; !ok {
+				tags[strings.ToLower(t)] = t
+			}
+		}
+
+		switch {
+		case n.State != "":
+			state, err := readFile(files, n.State, left)
+			if err != nil {
+				report.fail("Note %d: %v", n.ID, err)
+				continue
+			}
+			note.Content = state
+		case n.Error != "":
+			report.warn("Note %d (%s) was exported without content: %s", n.ID, note.Title, n.Error)
+		default:
+			report.warn("Note %d (%s) has no content", n.ID, note.Title)
+		}
+		if n.Markdown != "" {
+			if md, err := readFile(files, n.Markdown, left); err == nil {
+				note.ContentText = quill.PlainText(quill.FromMarkdown(string(md)))
+			} else {
+				report.warn("Note %d: %v; it is not searchable by content until edited", n.ID, err)
+			}
+		}
+		for _, a := range n.Attachments {
+			if file, ok := readAttachment(&report, files, left, n.ID, a); ok {
+				in.Attachments[n.ID] = append(in.Attachments[n.ID], file)
+				report.Attachments++
+			}
+		}
+		in.Notes = append(in.Notes, note)
+	}
+
+	for _, t := range tags {
+		report.Tags = append(report.Tags, t)
+	}
+	sort.Slice(report.Tags, func(i, j int) bool { return strings.ToLower(report.Tags[i]) < strings.ToLower(report.Tags[j]) })
+	report.Folders = len(in.Folders)
+	report.Notes = len(in.Notes)
+	if len(report.Errors) > 0 {
+		return nil, report
+	}
+	return in, report
+}
+
+// readAttachment finds an attachment's content, warning when the archive
+// lacks it
+func readAttachment(report *Report, files map[string]*zip.File, left *budget, noteID int, a Attachment) (File, bool) {
+	if a.File == "" {
+		report.warn("Note %d: attachment %s was exported without content: %s", noteID, a.Filename, a.Error)
+		return File{}, false
+	}
+	f, ok := files[a.File]
+	if !ok {
+		report.warn("Note %d: attachment %s is left out; %s is missing from the archive", noteID, a.Filename, a.File)
+		return File{}, false
+	}
+	if f.UncompressedSize64 > maxFileSize {
+		report.warn("Note %d: attachment %s is left out; %s is larger than %d bytes", noteID, a.Filename, a.File, maxFileSize)
+		return File{}, false
+	}
+	return File{ID: a.ID, Filename: a.Filename, Size: int64(f.UncompressedSize64), zip: f, left: left}, true
+}
+
+func readFile(files map[string]*zip.File, name string, left *budget) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the archive", name)
+	}
+	if f.UncompressedSize64 > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxFileSize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(b) > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxFileSize)
+	}
+	if err := left.take(int64(len(b))); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// timestampLayouts are those of PostgreSQL and SQLite as exported
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"}
+
+// parseTimestamp reads an exported timestamp; an empty or unreadable one
+// becomes the time of the import
+func parseTimestamp(report *Report, field, s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	report.warn("Unreadable %s %q; the import time is used instead", field, s)
+	return nil
+}
@@ -0,0 +1,263 @@
+package archive
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// Job states
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Export job errors
+var (
+	// ErrJobNotFound is returned for an unknown or expired job
+	ErrJobNotFound = errors.New("export job not found")
+	// ErrJobNotFinished is returned when opening the result of a running or
+	// failed job
+	ErrJobNotFinished = errors.New("export job has not finished")
+	// ErrBusy is returned when this process runs as many jobs as it may
+	ErrBusy = errors.New("too many exports are running")
+	// ErrTooManyJobs is returned when the user runs as many jobs as they may
+	ErrTooManyJobs = errors.New("too many of your exports are running")
+)
+
+// Job is a background export
+type Job = db.ExportJob
+
+// JobStore keeps the state of the jobs, shared by every process serving
+// the same database
+type JobStore interface {
+	CreateExportJob(ctx context.Context, id string, workspaceID, userID int) (*db.ExportJob, error)
+	GetExportJob(ctx context.Context, id string) (*db.ExportJob, error)
+	CountRunningExportJobs(ctx context.Context, userID int) (int, error)
+	TouchExportJob(ctx context.Context, id string) error
+	FinishExportJob(ctx context.Context, id, status, errMsg string, size int64, retention time.Duration) (bool, error)
+	FailStalledExportJobs(ctx context.Context, stalledAfter, retention time.Duration) ([]string, error)
+	DeleteExpiredExportJobs(ctx context.Context) ([]string, error)
+}
+
+// Jobs runs exports in the background for workspaces too large to stream
+// within a request. Their state is in the store and their results are
+// files in dir, so processes sharing both serve each other's jobs and a
+// restart loses none that finished. A job runs in the process that started
+// it, which keeps it alive in the store; one that stops being heard from
+// died with its process and is failed by the next prune.
+type Jobs struct {
+	dir        string
+	store      JobStore
+	retention  time.Duration
+	timeout    time.Duration
+	maxRunning int // in this process, 0 for no limit
+	maxPerUser int // in every process, 0 for no limit
+
+	heartbeat    time.Duration // how often a running job is kept alive
+	stalledAfter time.Duration // silence after which a job is given up
+	pruneEvery   time.Duration
+
+	mu        sync.Mutex
+	running   int
+	lastPrune time.Time
+}
+
+// NewJobs keeps results in dir for retention. It removes no files: the
+// ones in dir may be other processes' jobs, and prune removes those of
+// expired jobs whichever process wrote them.
+func NewJobs(dir string, store JobStore, retention time.Duration, maxRunning, maxPerUser int) (*Jobs, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Jobs{
+		dir: dir, store: store, retention: retention, timeout: 6 * time.Hour,
+		maxRunning: maxRunning, maxPerUser: maxPerUser,
+		heartbeat: time.Minute, stalledAfter: 5 * time.Minute, pruneEvery: time.Minute,
+	}, nil
+}
+
+// Start runs write in the background, saving what it writes as the job's
+// result. It fails with ErrBusy or ErrTooManyJobs when as many jobs as
+// allowed are running.
+func (j *Jobs) Start(ctx context.Context, workspaceID, userID int, write func(ctx context.Context, w io.Writer) error) (Job, error) {
+	j.prune(ctx)
+	j.mu.Lock()
+	if j.maxRunning > 0 && j.running >= j.maxRunning {
+		j.mu.Unlock()
+		return Job{}, ErrBusy
+	}
+	j.running++
+	j.mu.Unlock()
+
+	job, err := j.create(ctx, workspaceID, userID)
+	if err != nil {
+		j.release()
+		return Job{}, err
+	}
+	go j.run(*job, write)
+	return *job, nil
+}
+
+func (j *Jobs) create(ctx context.Context, workspaceID, userID int) (*Job, error) {
+	if j.maxPerUser > 0 {
+		n, err := j.store.CountRunningExportJobs(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if n >= j.maxPerUser {
+			return nil, ErrTooManyJobs
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return j.store.CreateExportJob(ctx, hex.EncodeToString(b), workspaceID, userID)
+}
+
+func (j *Jobs) release() {
+	j.mu.Lock()
+	j.running--
+	j.mu.Unlock()
+}
+
+func (j *Jobs) run(job Job, write func(ctx context.Context, w io.Writer) error) {
+	defer j.release()
+	ctx, cancel := context.WithTimeout(context.Background(), j.timeout)
+	defer cancel()
+
+	alive := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(j.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-alive:
+				return
+			case <-ticker.C:
+				if err := j.store.TouchExportJob(ctx, job.ID); err != nil {
+					log.Printf("[WARN] Export job %s heartbeat failed: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	// Written under a temporary name so a download never sees a partial file
+	final := j.path(job.ID)
+	tmp := final + ".part"
+	size, err := func() (int64, error) {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		if err := write(ctx, f); err != nil {
+			return 0, err
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}()
+	if err == nil {
+		err = os.Rename(tmp, final)
+	}
+	close(alive)
+
+	status, errMsg := JobDone, ""
+	if err != nil {
+		os.Remove(tmp)
+		log.Printf("[WARN] Export job %s of workspace %d failed: %v", job.ID, job.WorkspaceID, err)
+		status, errMsg, size = JobFailed, err.Error(), 0
+	}
+	recorded, err := j.store.FinishExportJob(context.Background(), job.ID, status, errMsg, size, j.retention)
+	if err != nil || !recorded {
+		// Given up as stalled, or never to be found: nobody will download it
+		os.Remove(final)
+		if err != nil {
+			log.Printf("[WARN] Export job %s could not be recorded: %v", job.ID, err)
+		}
+		return
+	}
+	if status == JobDone {
+		log.Printf("[INFO] Export job %s of workspace %d finished (%d bytes)", job.ID, job.WorkspaceID, size)
+	}
+}
+
+// Get returns a job
+func (j *Jobs) Get(ctx context.Context, id string) (Job, error) {
+	j.prune(ctx)
+	job, err := j.store.GetExportJob(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return *job, nil
+}
+
+// Open returns the result of a finished job
+func (j *Jobs) Open(ctx context.Context, id string) (*os.File, error) {
+	job, err := j.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobDone {
+		return nil, ErrJobNotFinished
+	}
+	f, err := os.Open(j.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrJobNotFound
+	}
+	return f, err
+}
+
+func (j *Jobs) path(id string) string {
+	return filepath.Join(j.dir, id+".zip")
+}
+
+// prune fails the jobs that died with their process and forgets expired
+// ones, deleting the files of just those jobs. It runs at most once every
+// pruneEvery.
+func (j *Jobs) prune(ctx context.Context) {
+	j.mu.Lock()
+	if time.Since(j.lastPrune) < j.pruneEvery {
+		j.mu.Unlock()
+		return
+	}
+	j.lastPrune = time.Now()
+	j.mu.Unlock()
+
+	stalled, err := j.store.FailStalledExportJobs(ctx, j.stalledAfter, j.retention)
+	if err != nil {
+		log.Printf("[WARN] Failing stalled export jobs failed: %v", err)
+	}
+	for _, id := range stalled {
+		log.Printf("[WARN] Export job %s was interrupted", id)
+		os.Remove(j.path(id) + ".part")
+	}
+	expired, err := j.store.DeleteExpiredExportJobs(ctx)
+	if err != nil {
+		log.Printf("[WARN] Deleting expired export jobs failed: %v", err)
+	}
+	for _, id := range expired {
+		os.Remove(j.path(id))
+	}
+}
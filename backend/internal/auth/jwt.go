@@ -7,14 +7,14 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret []byte
+var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
+// RequireSecret stops the server when no signing secret is configured. It is
+// called at startup rather than on import so tests can build the router.
+func RequireSecret() {
+	if len(jwtSecret) == 0 {
         log.Fatal("JWT_SECRET environment variable is required")
 	}
-	jwtSecret = []byte(secret)
 }
 
 type Claims struct {
@@ -1,14 +1,19 @@
 package auth
 
 import (
-	"database/sql"
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthRequired(db *sql.DB) gin.HandlerFunc {
+// ActiveUsers reports whether a token's user still exists and is enabled
+type ActiveUsers interface {
+	IsActiveUser(ctx context.Context, id int) (bool, error)
+}
+
+func AuthRequired(users ActiveUsers) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tokenStr string
 
@@ -32,9 +37,8 @@ func AuthRequired(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Verify user still exists in database
-		var exists bool
-		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", claims.UserID).Scan(&exists)
+		// Verify user still exists in database and has not been disabled
+		exists, err := users.IsActiveUser(c.Request.Context(), claims.UserID)
 		if err != nil || !exists {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
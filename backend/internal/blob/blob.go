@@ -0,0 +1,69 @@
+// Package blob keeps the bytes of attachments, named by keys derived from
+// their content, in a directory on local disk or in an S3-compatible bucket
+// such as MinIO. Metadata lives in the database; a blob store only knows
+// keys.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// ErrNotFound is returned by Get for a key that holds no blob
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a flat namespace of immutable blobs
+type Store interface {
+	// Put writes size bytes read from r under key, replacing any blob
+	// there. Readers never see a partly written blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens a blob for reading; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob; deleting a missing one is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey admits the keys callers build from hashes, which are safe as
+// file names and in URLs without escaping
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+func checkKey(key string) error {
+	if !validKey.MatchString(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// VariantKey is the key of a rendering of the blob under key, such as an
+// image thumbnail a number of pixels wide
+func VariantKey(key string, width int) string {
+	return fmt.Sprintf("%s-w%d", key, width)
+}
+
+// FromEnv opens the store chosen by ATTACHMENT_STORAGE: "disk", the
+// default, keeps blobs below ATTACHMENT_DIR; "s3" uses the bucket described
+// by the S3_* variables
+func FromEnv() (Store, error) {
+	switch kind := os.Getenv("ATTACHMENT_STORAGE"); kind {
+	case "", "disk":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = "./data/attachments"
+		}
+		return NewDisk(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("ATTACHMENT_STORAGE must be disk or s3, not %q", kind)
+	}
+}
@@ -0,0 +1,154 @@
+// Package collab reads and writes note content through the Hocuspocus
+// document service, which owns the Yjs documents. Going through it rather
+// than the database keeps open editors in sync with API changes.
+package collab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-notes/backend/internal/quill"
+)
+
+// Client talks to the document service's HTTP API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// New returns a client for the service at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// FromEnv uses YJS_HTTP_URL, the same setting as default note initialisation
+func FromEnv() *Client {
+	url := os.Getenv("YJS_HTTP_URL")
+	if url == "" {
+		url = "http://yjs:1235"
+	}
+	return New(url)
+}
+
+// Delta returns the content of a note's document
+func (c *Client) Delta(ctx context.Context, roomID string) (quill.Delta, error) {
+	var d quill.Delta
+	err := c.call(ctx, http.MethodGet, roomID, nil, &d)
+	if d.Ops == nil {
+		d.Ops = []quill.Op{}
+	}
+	return d, err
+}
+
+// SetDelta replaces the content of a note's document; the service applies
+// only the difference
+func (c *Client) SetDelta(ctx context.Context, roomID string, d quill.Delta) error {
+	if d.Ops == nil {
+		d.Ops = []quill.Op{}
+	}
+	return c.call(ctx, http.MethodPut, roomID, d, nil)
+}
+
+// State returns a note's whole document as a binary Yjs update
+func (c *Client) State(ctx context.Context, roomID string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/documents/"+roomID+"/state", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Encode turns a Delta into the binary Yjs update of a document holding
+// it, without storing anything; imports write it as a new note's content
+func (c *Client) Encode(ctx context.Context, d quill.Delta) ([]byte, error) {
+	if d.Ops == nil {
+		d.Ops = []quill.Op{}
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/documents/encode", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Decode returns the content of a binary Yjs update, such as an exported
+// note's state, without storing anything
+func (c *Client) Decode(ctx context.Context, state []byte) (quill.Delta, error) {
+	var d quill.Delta
+	resp, err := c.do(ctx, http.MethodPost, "/documents/decode", "application/octet-stream", bytes.NewReader(state))
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&d)
+	if d.Ops == nil {
+		d.Ops = []quill.Op{}
+	}
+	return d, err
+}
+
+func (c *Client) call(ctx context.Context, method, roomID string, in, out any) error {
+	var body *bytes.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+	resp, err := c.do(ctx, method, "/documents/"+roomID+"/delta", "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends a request to a path of the service and turns a non-200 answer
+// into an error
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, fmt.Errorf("document service returned %d: %s", resp.StatusCode, e.Error)
+	}
+	return resp, nil
+}
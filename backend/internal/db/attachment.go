@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// --- Attachments ---
+
+// ErrQuotaExceeded is returned by CreateAttachment when the upload would
+// take the workspace's attachments over its quota
+var ErrQuotaExceeded = errors.New("attachment quota exceeded")
+
+// Attachment is a file uploaded to a note. Its bytes are the blob named by
+// Hash, the hex SHA-256 of the content, shared by every attachment with the
+// same content.
+type Attachment struct {
+	ID       int    `json:"id"`
+	NoteID   int    `json:"note_id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Hash     string `json:"hash"`
+	Key      string `json:"-"` // grants download without a login, for image URLs
+	// Width and Height are the pixel size of processed images
+	Width     *int   `json:"width"`
+	Height    *int   `json:"height"`
+	CreatedBy *int   `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+const attachmentColumns = "id, note_id, filename, mime_type, size, hash, access_key, width, height, created_by, created_at"
+
+func scanAttachment(scan func(dest ...any) error, a *Attachment) error {
+	return scan(&a.ID, &a.NoteID, &a.Filename, &a.MimeType, &a.Size, &a.Hash, &a.Key, &a.Width, &a.Height, &a.CreatedBy, &a.CreatedAt)
+}
+
+// CreateAttachment records an upload, setting a.ID and a.CreatedAt. put
+// writes the blob and is called only when no attachment shares its hash;
+// its error rolls the upload back. With a positive quota, uploads that
+// would take the note's workspace past that many bytes fail with
+// ErrQuotaExceeded.
+func (s *Store) CreateAttachment(ctx context.Context, a *Attachment, quota int64, put func() error) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		if quota > 0 {
+			// Locking the workspace serialises its uploads, so concurrent
+			// ones cannot pass the quota together
+			var workspaceID int
+			err := tx.q.QueryRowContext(ctx, `
+				SELECT w.id FROM workspaces w JOIN notes n ON n.workspace_id = w.id
+				WHERE n.id = $1 FOR UPDATE OF w
+			`, a.NoteID).Scan(&workspaceID)
+			if err != nil {
+				return err
+			}
+			used, err := tx.WorkspaceAttachmentBytes(ctx, workspaceID)
+			if err != nil {
+				return err
+			}
+			if used+a.Size > quota {
+				return ErrQuotaExceeded
+			}
+		}
+		if err := tx.claimBlob(ctx, a.Hash, a.Size, put); err != nil {
+			return err
+		}
+		return tx.q.QueryRowContext(ctx, `
+			INSERT INTO attachments (note_id, hash, filename, mime_type, size, access_key, width, height, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at
+		`, a.NoteID, a.Hash, a.Filename, a.MimeType, a.Size, a.Key, a.Width, a.Height, a.CreatedBy).Scan(&a.ID, &a.CreatedAt)
+	})
+}
+
+// claimBlob marks a blob as in use, creating its row and calling put when
+// it has none. The row lock taken here waits for a sweep deleting the blob.
+func (s *Store) claimBlob(ctx context.Context, hash string, size int64, put func() error) error {
+	res, err := s.q.ExecContext(ctx, "UPDATE attachment_blobs SET last_used_at = CURRENT_TIMESTAMP WHERE hash = $1", hash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	res, err = s.q.ExecContext(ctx, "INSERT INTO attachment_blobs (hash, size) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING", hash, size)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if err := put(); err != nil {
+		return fmt.Errorf("store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetAttachment(ctx context.Context, id int) (*Attachment, error) {
+	var a Attachment
+	row := s.q.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = $1", id)
+	if err := scanAttachment(row.Scan, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAttachments returns a note's attachments, oldest first
+func (s *Store) ListAttachments(ctx context.Context, noteID int) ([]Attachment, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE note_id = $1 ORDER BY id", noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := scanAttachment(rows.Scan, &a); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteAttachment removes an attachment; its blob is left to the sweep
+// SetAttachmentKey replaces an attachment's access key, so URLs carrying
+// the old one stop working
+func (s *Store) SetAttachmentKey(ctx context.Context, id int, key string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE attachments SET access_key = $1 WHERE id = $2", key, id)
+	return err
+}
+
+func (s *Store) DeleteAttachment(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM attachments WHERE id = $1", id)
+	return err
+}
+
+// WorkspaceAttachmentBytes sums the sizes of the attachments of a
+// workspace's notes, trashed ones included. Content shared between
+// attachments counts once per attachment.
+func (s *Store) WorkspaceAttachmentBytes(ctx context.Context, workspaceID int) (int64, error) {
+	var used int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(a.size), 0)
+		FROM attachments a JOIN notes n ON n.id = a.note_id
+		WHERE n.workspace_id = $1
+	`, workspaceID).Scan(&used)
+	return used, err
+}
+
+// DeleteOrphanBlobs deletes the blobs no attachment has referred to for
+// the grace period, calling remove to delete each from blob storage before
+// its row goes. It returns the number deleted; a blob that fails is left
+// for the next sweep and the others are still tried.
+func (s *Store) DeleteOrphanBlobs(ctx context.Context, grace time.Duration, remove func(hash string) error) (int, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT b.hash FROM attachment_blobs b
+		WHERE b.last_used_at < NOW() - make_interval(secs => $1)
+		AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.hash = b.hash)
+	`, grace.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	hashes, err := scanStrings(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	for _, hash := range hashes {
+		err := s.WithTx(ctx, func(tx *Store) error {
+			// The conditions are checked again under the row lock, which an
+			// upload of the same content waits for
+			res, err := tx.q.ExecContext(ctx, `
+				DELETE FROM attachment_blobs b
+				WHERE b.hash = $1 AND b.last_used_at < NOW() - make_interval(secs => $2)
+				AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.hash = b.hash)
+			`, hash, grace.Seconds())
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+			if err := remove(hash); err != nil {
+				return err
+			}
+			deleted++
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete blob %s: %w", hash, err))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
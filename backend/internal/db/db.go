@@ -1,6 +1,7 @@
 package db
 
 import (
+    "context"
     "database/sql"
     "fmt"
     "os"
@@ -8,23 +9,45 @@ import (
     "bytes"
     "encoding/json"
     "log"
+    "net"
     "net/http"
+    "net/url"
 	"strings"
     "github.com/lib/pq"
 )
 
 // --- DB Connection ---
+
+// Connect opens the database selected by DB_DRIVER
 func Connect() (*sql.DB, error) {
-    dbHost := getenv("DB_HOST", "db")
-    dbPort := getenv("DB_PORT", "5432")
-    dbUser := getenv("DB_USER", "notes")
-    dbPassword := getenv("DB_PASSWORD", "notespass")
-    dbName := getenv("DB_NAME", "notesdb")
-    dbURL := fmt.Sprintf(
-        "postgres://%s:%s@%s:%s/%s?sslmode=disable",
-        dbUser, dbPassword, dbHost, dbPort, dbName,
-    )
-    return sql.Open("postgres", dbURL)
+    switch Driver() {
+    case DriverPostgres:
+        return sql.Open("postgres", ConnString())
+    case DriverSQLite:
+        return openSQLite()
+    default:
+        return nil, fmt.Errorf("unknown DB_DRIVER %q (want %s or %s)", Driver(), DriverPostgres, DriverSQLite)
+    }
+}
+
+// ConnString builds the Postgres URL from DB_* environment variables, for
+// components that need their own connection (e.g. LISTEN, migrations).
+// DB_SSLMODE defaults to disable; DB_SSLROOTCERT points at a CA bundle for
+// verify-ca and verify-full.
+func ConnString() string {
+    query := url.Values{}
+    query.Set("sslmode", getenv("DB_SSLMODE", "disable"))
+    if rootCert := getenv("DB_SSLROOTCERT", ""); rootCert != "" {
+        query.Set("sslrootcert", rootCert)
+    }
+    u := url.URL{
+        Scheme:   "postgres",
+        User:     url.UserPassword(getenv("DB_USER", "notes"), getenv("DB_PASSWORD", "notespass")),
+        Host:     net.JoinHostPort(getenv("DB_HOST", "db"), getenv("DB_PORT", "5432")),
+        Path:     "/" + getenv("DB_NAME", "notesdb"),
+        RawQuery: query.Encode(),
+    }
+    return u.String()
 }
 
 func getenv(key, def string) string {
@@ -46,49 +69,42 @@ type User struct {
     Username     string `json:"username"`
     PasswordHash string `json:"password_hash"`
     IsAdmin      bool   `json:"is_admin"`
+    Disabled     bool   `json:"disabled"`
     CreatedAt    string `json:"created_at"`
 }
 
-func GetUserCount(db *sql.DB) (int, error) {
+func (s *Store) GetUserCount(ctx context.Context) (int, error) {
     var count int
-    err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+    err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
     return count, err
 }
 
-func CreateAdmin(db *sql.DB, username, passwordHash string) error {
-    var userID int
-    err := db.QueryRow(
-        "INSERT INTO users (username, password_hash, is_admin) VALUES ($1, $2, TRUE) RETURNING id",
-        username, passwordHash,
-    ).Scan(&userID)
-    if err != nil {
-        return err
-    }
-    return CreateDefaultWorkspaceForUser(db, userID, username)
+func (s *Store) CreateAdmin(ctx context.Context, username, passwordHash string) error {
+    return s.CreateUser(ctx, username, passwordHash, true)
 }
 
-func GetUserByID(db *sql.DB, id int) (*User, error) {
+func (s *Store) GetUserByID(ctx context.Context, id int) (*User, error) {
     var u User
-    err := db.QueryRow("SELECT id, username, password_hash, is_admin, created_at FROM users WHERE id = $1", id).
-        Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt)
+    err := s.q.QueryRowContext(ctx, "SELECT id, username, password_hash, is_admin, disabled_at IS NOT NULL, created_at FROM users WHERE id = $1", id).
+        Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.Disabled, &u.CreatedAt)
     if err != nil {
         return nil, err
     }
     return &u, nil
 }
 
-func GetUserByUsername(db *sql.DB, username string) (*User, error) {
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*User, error) {
     var u User
-    err := db.QueryRow("SELECT id, username, password_hash, is_admin, created_at FROM users WHERE username = $1", username).
-        Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.CreatedAt)
+    err := s.q.QueryRowContext(ctx, "SELECT id, username, password_hash, is_admin, disabled_at IS NOT NULL, created_at FROM users WHERE username = $1", username).
+        Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.Disabled, &u.CreatedAt)
     if err != nil {
         return nil, err
     }
     return &u, nil
 }
 
-func ListUsers(db *sql.DB) ([]User, error) {
-    rows, err := db.Query("SELECT id, username, is_admin, created_at FROM users ORDER BY id")
+func (s *Store) ListUsers(ctx context.Context) ([]User, error) {
+    rows, err := s.q.QueryContext(ctx, "SELECT id, username, is_admin, disabled_at IS NOT NULL, created_at FROM users ORDER BY id")
     if err != nil {
         return nil, err
     }
@@ -98,7 +114,7 @@ func ListUsers(db *sql.DB) ([]User, error) {
     
     for rows.Next() {
         var u User
-        err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.CreatedAt)
+        err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.Disabled, &u.CreatedAt)
         if err != nil {
             return nil, fmt.Errorf("failed to scan user: %v", err)
         }
@@ -107,56 +123,65 @@ func ListUsers(db *sql.DB) ([]User, error) {
     return users, nil
 }
 
-func CreateUser(db *sql.DB, username, passwordHash string, isAdmin bool) error {
-    var userID int
-    err := db.QueryRow("INSERT INTO users (username, password_hash, is_admin) VALUES ($1, $2, $3) RETURNING id", username, passwordHash, isAdmin).Scan(&userID)
-    if err != nil {
-        return err
-    }
-    return CreateDefaultWorkspaceForUser(db, userID, username)
+// CreateUser adds a user together with their default workspace and intro
+// note; either everything is created or nothing is
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string, isAdmin bool) error {
+    return s.WithTx(ctx, func(tx *Store) error {
+        var userID int
+        err := tx.q.QueryRowContext(ctx, "INSERT INTO users (username, password_hash, is_admin) VALUES ($1, $2, $3) RETURNING id", username, passwordHash, isAdmin).Scan(&userID)
+        if err != nil {
+            return err
+        }
+        return tx.CreateDefaultWorkspaceForUser(ctx, userID, username)
+    })
 }
 
 
-func CreateDefaultWorkspaceForUser(db *sql.DB, userID int, username string) error {
-    // Create default workspace
-    workspaceName := "Default WS"
-    var wsID int
-    err := db.QueryRow("INSERT INTO workspaces (name, owner_id) VALUES ($1, $2) RETURNING id", workspaceName, userID).Scan(&wsID)
-    if err != nil {
-        return err
-    }
-    
-    // Add user as owner member
-    _, err = db.Exec("INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, 'owner')", wsID, userID)
-    if err != nil {
-        return err
-    }
-    
-    // Create intro note
-    noteID, err := CreateNote(db, wsID, "Intro & Guide", nil, &userID, "#FFFFFF")
-    if err != nil {
-        return err
-    }
-    
-    // Initialize note content via Hocuspocus HTTP endpoint
+// CreateDefaultWorkspaceForUser creates a user's first workspace with an
+// intro note. The note's content is initialised by Hocuspocus once the
+// transaction has committed, so the service never sees a half-created note.
+func (s *Store) CreateDefaultWorkspaceForUser(ctx context.Context, userID int, username string) error {
+    return s.WithTx(ctx, func(tx *Store) error {
+        // Create default workspace, with the user as owner member
+        wsID, err := tx.CreateWorkspace(ctx, "Default WS", userID)
+        if err != nil {
+            return err
+        }
+        
+        // Create intro note
+        noteID, err := tx.CreateNote(ctx, wsID, "Intro & Guide", nil, &userID, "#FFFFFF")
+        if err != nil {
+            return err
+        }
+        roomID := fmt.Sprintf("w%d_n%d", wsID, noteID)
+        
+        tx.afterCommit(func() { InitializeDocument(ctx, roomID, userID) })
+        return nil
+    })
+}
+
+// InitializeDocument asks Hocuspocus to write the intro content into a
+// new note. Failures are logged: the note still exists, just empty.
+func InitializeDocument(ctx context.Context, roomID string, userID int) {
     yjsURL := getenv("YJS_HTTP_URL", "http://yjs:1235")
-    roomID := fmt.Sprintf("w%d_n%d", wsID, noteID)
     
     payload := map[string]string{"room_id": roomID}
     jsonData, err := json.Marshal(payload)
     if err != nil {
         log.Printf("[WARN] Failed to marshal room_id for initialization: %v", err)
-        return nil // Don't fail user creation if initialization fails
+        return
     }
     
-    resp, err := http.Post(
-        fmt.Sprintf("%s/initialize-document", yjsURL),
-        "application/json",
-        bytes.NewBuffer(jsonData),
-    )
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/initialize-document", yjsURL), bytes.NewBuffer(jsonData))
+    if err != nil {
+        log.Printf("[WARN] Failed to initialize default note content: %v", err)
+        return
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := http.DefaultClient.Do(req)
     if err != nil {
         log.Printf("[WARN] Failed to initialize default note content: %v", err)
-        return nil // Don't fail user creation if initialization fails
+        return
     }
     defer resp.Body.Close()
     
@@ -165,28 +190,61 @@ func CreateDefaultWorkspaceForUser(db *sql.DB, userID int, username string) erro
     } else {
         log.Printf("[INFO] Successfully initialized default intro note for user %d", userID)
     }
-    
-    return nil
 }
 
 
-func UpdateUser(db *sql.DB, id int, username, passwordHash string) error {
-    _, err := db.Exec("UPDATE users SET username=$1, password_hash=$2 WHERE id=$3", username, passwordHash, id)
+func (s *Store) UpdateUser(ctx context.Context, id int, username, passwordHash string) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE users SET username=$1, password_hash=$2 WHERE id=$3", username, passwordHash, id)
+    return err
+}
+
+// SetUserPassword replaces a user's password hash
+func (s *Store) SetUserPassword(ctx context.Context, id int, passwordHash string) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE users SET password_hash=$1 WHERE id=$2", passwordHash, id)
     return err
 }
 
-func DeleteUser(db *sql.DB, id int) error {
-    _, err := db.Exec("DELETE FROM users WHERE id=$1", id)
+// SetUserAdmin grants or revokes admin rights; issued tokens keep the old
+// flag until they are refreshed
+func (s *Store) SetUserAdmin(ctx context.Context, id int, isAdmin bool) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE users SET is_admin=$1 WHERE id=$2", isAdmin, id)
+    return err
+}
+
+// SetUserDisabled blocks or re-enables a user. Disabled users cannot log in
+// and AuthRequired rejects their existing tokens.
+func (s *Store) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END WHERE id=$2", disabled, id)
+    return err
+}
+
+// CountActiveAdmins counts admins who are not disabled
+func (s *Store) CountActiveAdmins(ctx context.Context) (int, error) {
+    var count int
+    err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE is_admin AND disabled_at IS NULL").Scan(&count)
+    return count, err
+}
+
+// IsActiveUser reports whether a user exists and is not disabled
+func (s *Store) IsActiveUser(ctx context.Context, id int) (bool, error) {
+    var exists bool
+    err := s.q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND disabled_at IS NULL)", id).Scan(&exists)
+    return exists, err
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+    _, err := s.q.ExecContext(ctx, "DELETE FROM users WHERE id=$1", id)
     return err
 }
 
 // --- Workspace CRUD ---
 
 type Workspace struct {
-    ID        int    `json:"id"`
-    Name      string `json:"name"`
-    OwnerID   int    `json:"owner_id"`
-    CreatedAt string `json:"created_at"`
+    ID             int    `json:"id"`
+    Name           string `json:"name"`
+    OwnerID        int    `json:"owner_id"`
+    CreatedAt      string `json:"created_at"`
+    SearchLanguage string `json:"search_language"`
 }
 
 type WorkspaceMember struct {
@@ -195,23 +253,26 @@ type WorkspaceMember struct {
     Role        string `json:"role"` // "owner" or "member"
 }
 
-func CreateWorkspace(db *sql.DB, name string, ownerID int) (int, error) {
+func (s *Store) CreateWorkspace(ctx context.Context, name string, ownerID int) (int, error) {
     var id int
-    err := db.QueryRow("INSERT INTO workspaces (name, owner_id) VALUES ($1, $2) RETURNING id", name, ownerID).Scan(&id)
+    err := s.WithTx(ctx, func(tx *Store) error {
+        err := tx.q.QueryRowContext(ctx, "INSERT INTO workspaces (name, owner_id) VALUES ($1, $2) RETURNING id", name, ownerID).Scan(&id)
+        if err != nil {
+            return err
+        }
+        // Add owner as workspace member
+        _, err = tx.q.ExecContext(ctx, "INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, 'owner')", id, ownerID)
+        return err
+    })
     if err != nil {
         return 0, err
     }
-    // Add owner as workspace member
-    _, err = db.Exec("INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, 'owner')", id, ownerID)
-    if err != nil {
-        return id, err
-    }
     return id, nil
 }
 
-func ListWorkspaces(db *sql.DB, userID int) ([]Workspace, error) {
-    rows, err := db.Query(`
-        SELECT w.id, w.name, w.owner_id, w.created_at
+func (s *Store) ListWorkspaces(ctx context.Context, userID int) ([]Workspace, error) {
+    rows, err := s.q.QueryContext(ctx, `
+        SELECT w.id, w.name, w.owner_id, w.created_at, w.search_language::text
         FROM workspaces w
         JOIN workspace_members wm ON wm.workspace_id = w.id
         WHERE wm.user_id = $1
@@ -224,7 +285,7 @@ func ListWorkspaces(db *sql.DB, userID int) ([]Workspace, error) {
     var workspaces []Workspace
     for rows.Next() {
         var w Workspace
-        err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt)
+        err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage)
         if err == nil {
             workspaces = append(workspaces, w)
         }
@@ -232,28 +293,62 @@ func ListWorkspaces(db *sql.DB, userID int) ([]Workspace, error) {
     return workspaces, nil
 }
 
-func GetWorkspace(db *sql.DB, id int) (*Workspace, error) {
+// WorkspaceSummary is a workspace with its owner's name and sizes, for
+// server administration
+type WorkspaceSummary struct {
+    Workspace
+    OwnerName string `json:"owner_name"`
+    Members   int    `json:"members"`
+    Notes     int    `json:"notes"`
+}
+
+// ListAllWorkspaces returns every workspace on the server
+func (s *Store) ListAllWorkspaces(ctx context.Context) ([]WorkspaceSummary, error) {
+    rows, err := s.q.QueryContext(ctx, `
+        SELECT w.id, w.name, w.owner_id, w.created_at, w.search_language::text, u.username,
+               (SELECT COUNT(*) FROM workspace_members wm WHERE wm.workspace_id = w.id),
+               (SELECT COUNT(*) FROM notes n WHERE n.workspace_id = w.id AND NOT n.is_trashed)
+        FROM workspaces w
+        JOIN users u ON u.id = w.owner_id
+        ORDER BY w.id
+    `)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    workspaces := []WorkspaceSummary{}
+    for rows.Next() {
+        var w WorkspaceSummary
+        if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage, &w.OwnerName, &w.Members, &w.Notes); err != nil {
+            return nil, err
+        }
+        workspaces = append(workspaces, w)
+    }
+    return workspaces, rows.Err()
+}
+
+func (s *Store) GetWorkspace(ctx context.Context, id int) (*Workspace, error) {
     var w Workspace
-    err := db.QueryRow("SELECT id, name, owner_id, created_at FROM workspaces WHERE id = $1", id).
-        Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt)
+    err := s.q.QueryRowContext(ctx, "SELECT id, name, owner_id, created_at, search_language::text FROM workspaces WHERE id = $1", id).
+        Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage)
     if err != nil {
         return nil, err
     }
     return &w, nil
 }
 
-func UpdateWorkspace(db *sql.DB, id int, name string) error {
-    _, err := db.Exec("UPDATE workspaces SET name=$1 WHERE id=$2", name, id)
+func (s *Store) UpdateWorkspace(ctx context.Context, id int, name string) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE workspaces SET name=$1 WHERE id=$2", name, id)
     return err
 }
 
-func DeleteWorkspace(db *sql.DB, id int) error {
-    _, err := db.Exec("DELETE FROM workspaces WHERE id=$1", id)
+func (s *Store) DeleteWorkspace(ctx context.Context, id int) error {
+    _, err := s.q.ExecContext(ctx, "DELETE FROM workspaces WHERE id=$1", id)
     return err
 }
 
-func ListWorkspaceMembers(db *sql.DB, workspaceID int) ([]WorkspaceMember, error) {
-    rows, err := db.Query("SELECT workspace_id, user_id, role FROM workspace_members WHERE workspace_id = $1", workspaceID)
+func (s *Store) ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]WorkspaceMember, error) {
+    rows, err := s.q.QueryContext(ctx, "SELECT workspace_id, user_id, role FROM workspace_members WHERE workspace_id = $1", workspaceID)
     if err != nil {
         return nil, err
     }
@@ -269,56 +364,60 @@ func ListWorkspaceMembers(db *sql.DB, workspaceID int) ([]WorkspaceMember, error
     return members, nil
 }
 
-func AddWorkspaceMember(db *sql.DB, workspaceID, userID int, role string) error {
-    _, err := db.Exec("INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", workspaceID, userID, role)
+func (s *Store) AddWorkspaceMember(ctx context.Context, workspaceID, userID int, role string) error {
+    _, err := s.q.ExecContext(ctx, "INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", workspaceID, userID, role)
     return err
 }
 
-func RemoveWorkspaceMember(db *sql.DB, workspaceID, userID int) error {
-    _, err := db.Exec("DELETE FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID)
+func (s *Store) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error {
+    _, err := s.q.ExecContext(ctx, "DELETE FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID)
     return err
 }
 
-func TransferWorkspaceOwnership(db *sql.DB, workspaceID, newOwnerID int) error {
-    _, err := db.Exec("UPDATE workspaces SET owner_id=$1 WHERE id=$2", newOwnerID, workspaceID)
-    if err != nil {
-        return err
-    }
-    _, err = db.Exec("UPDATE workspace_members SET role='owner' WHERE workspace_id=$1 AND user_id=$2", workspaceID, newOwnerID)
-    if err != nil {
+func (s *Store) TransferWorkspaceOwnership(ctx context.Context, workspaceID, newOwnerID int) error {
+    return s.WithTx(ctx, func(tx *Store) error {
+        _, err := tx.q.ExecContext(ctx, "UPDATE workspaces SET owner_id=$1 WHERE id=$2", newOwnerID, workspaceID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.q.ExecContext(ctx, "UPDATE workspace_members SET role='owner' WHERE workspace_id=$1 AND user_id=$2", workspaceID, newOwnerID)
+        if err != nil {
+            return err
+        }
+        _, err = tx.q.ExecContext(ctx, "UPDATE workspace_members SET role='member' WHERE workspace_id=$1 AND user_id!=$2 AND role='owner'", workspaceID, newOwnerID)
         return err
-    }
-    _, err = db.Exec("UPDATE workspace_members SET role='member' WHERE workspace_id=$1 AND user_id!=$2 AND role='owner'", workspaceID, newOwnerID)
-    return err
+    })
 }
 
-func IsWorkspaceOwner(db *sql.DB, workspaceID, userID int) (bool, error) {
+func (s *Store) IsWorkspaceOwner(ctx context.Context, workspaceID, userID int) (bool, error) {
     var count int
-    err := db.QueryRow("SELECT COUNT(*) FROM workspaces WHERE id=$1 AND owner_id=$2", workspaceID, userID).Scan(&count)
+    err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspaces WHERE id=$1 AND owner_id=$2", workspaceID, userID).Scan(&count)
     return count > 0, err
 }
 
-func IsWorkspaceMember(db *sql.DB, workspaceID, userID int) (bool, error) {
+func (s *Store) IsWorkspaceMember(ctx context.Context, workspaceID, userID int) (bool, error) {
     var count int
-    err := db.QueryRow("SELECT COUNT(*) FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID).Scan(&count)
+    err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID).Scan(&count)
     return count > 0, err
 }
 
 // --- Note, Folder CRUD ---
 
 type Note struct {
-    ID          int        `json:"id"`
-    WorkspaceID int        `json:"workspace_id"`
-    Title       string     `json:"title"`
-    YjsRoomID   string     `json:"yjs_room_id"`
-    FolderID    *int       `json:"folder_id"`
-    CreatedBy   *int       `json:"created_by"`
-    CreatedAt   string     `json:"created_at"`
-    UpdatedAt   string     `json:"updated_at"`
-    IsTrashed   bool       `json:"is_trashed"`
-    TrashedAt   *string    `json:"trashed_at"`
-    Color       string     `json:"color"`
-    Tags        []Tag      `json:"tags,omitempty"`
+    ID                      int     `json:"id"`
+    WorkspaceID             int     `json:"workspace_id"`
+    Title                   string  `json:"title"`
+    YjsRoomID               string  `json:"yjs_room_id"`
+    FolderID                *int    `json:"folder_id"`
+    CreatedBy               *int    `json:"created_by"`
+    CreatedAt               string  `json:"created_at"`
+    UpdatedAt               string  `json:"updated_at"`
+    IsTrashed               bool    `json:"is_trashed"`
+    TrashedAt               *string `json:"trashed_at"`
+    Color                   string  `json:"color"`
+    SearchLanguage          string  `json:"search_language"`
+    SearchLanguageInherited bool    `json:"search_language_inherited"`
+    Tags                    []Tag   `json:"tags,omitempty"`
 }
 
 type Folder struct {
@@ -329,7 +428,7 @@ type Folder struct {
     CreatedAt   string `json:"created_at"`
 }
 
-func CreateNote(db *sql.DB, workspaceID int, title string, folderID *int, createdBy *int, color string) (int, error) {
+func (s *Store) CreateNote(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string) (int, error) {
     if color == "" {
         color = "#FFFFFF"
     }
@@ -338,79 +437,70 @@ func CreateNote(db *sql.DB, workspaceID int, title string, folderID *int, create
     }
     
     var id int
-    err := db.QueryRow(
-        "INSERT INTO notes (workspace_id, title, yjs_room_id, folder_id, created_by, color) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-        workspaceID, title, "temp", folderID, createdBy, color,
-    ).Scan(&id)
+    err := s.WithTx(ctx, func(tx *Store) error {
+        // New notes inherit the workspace's search language
+        err := tx.q.QueryRowContext(ctx,
+            "INSERT INTO notes (workspace_id, title, yjs_room_id, folder_id, created_by, color, search_language) VALUES ($1, $2, $3, $4, $5, $6, (SELECT search_language FROM workspaces WHERE id = $1)) RETURNING id",
+            workspaceID, title, "temp", folderID, createdBy, color,
+        ).Scan(&id)
+        if err != nil {
+            return err
+        }
+        
+        // Update with proper room ID
+        yjsRoomID := fmt.Sprintf("w%d_n%d", workspaceID, id)
+        _, err = tx.q.ExecContext(ctx, "UPDATE notes SET yjs_room_id=$1 WHERE id=$2", yjsRoomID, id)
+        return err
+    })
     if err != nil {
         return 0, err
     }
-    
-    // Update with proper room ID
-    yjsRoomID := fmt.Sprintf("w%d_n%d", workspaceID, id)
-    _, err = db.Exec("UPDATE notes SET yjs_room_id=$1 WHERE id=$2", yjsRoomID, id)
-    return id, err
+    return id, nil
+}
+
+// CreateNoteWithTags creates a note and sets its tags in one transaction
+func (s *Store) CreateNoteWithTags(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string, tags []string) (int, error) {
+    var id int
+    err := s.WithTx(ctx, func(tx *Store) error {
+        var err error
+        id, err = tx.CreateNote(ctx, workspaceID, title, folderID, createdBy, color)
+        if err != nil || len(tags) == 0 {
+            return err
+        }
+        return tx.SetTagsForNote(ctx, id, tags)
+    })
+    if err != nil {
+        return 0, err
+    }
+    return id, nil
 }
 
-func GetNote(db *sql.DB, id int) (*Note, error) {
+func (s *Store) GetNote(ctx context.Context, id int) (*Note, error) {
     var n Note
-    err := db.QueryRow("SELECT id, workspace_id, title, yjs_room_id, folder_id, created_by, created_at, updated_at, is_trashed, trashed_at, color FROM notes WHERE id = $1", id).
-        Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt, &n.IsTrashed, &n.TrashedAt, &n.Color)
+    err := s.q.QueryRowContext(ctx, "SELECT id, workspace_id, title, yjs_room_id, folder_id, created_by, created_at, updated_at, is_trashed, trashed_at, color, search_language::text, search_language_inherited FROM notes WHERE id = $1", id).
+        Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt, &n.IsTrashed, &n.TrashedAt, &n.Color, &n.SearchLanguage, &n.SearchLanguageInherited)
     if err != nil {
         return nil, err
     }
     return &n, nil
 }
 
-func ListNotes(db *sql.DB, workspaceID int, folderID *int, includeTrashed bool) ([]Note, error) {
-    query := "SELECT id FROM notes WHERE workspace_id = $1"
-    args := []interface{}{workspaceID}
-    argIdx := 2
-    if folderID != nil {
-        query += fmt.Sprintf(" AND folder_id = $%d", argIdx)
-        args = append(args, *folderID)
-        argIdx++
-    }
+// ListNotes lists every note in a workspace (optionally one folder) with tags
+func (s *Store) ListNotes(ctx context.Context, workspaceID int, folderID *int, includeTrashed bool) ([]Note, error) {
+    opts := NoteListOptions{FolderID: folderID}
     if !includeTrashed {
-        query += fmt.Sprintf(" AND is_trashed = FALSE")
+        live := false
+        opts.Trashed = &live
     }
-    rows, err := db.Query(query, args...)
+    page, err := s.ListNotesPage(ctx, workspaceID, opts)
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-    var notes []Note
-    for rows.Next() {
-        var id int
-        err := rows.Scan(&id)
-        if err == nil {
-            note, _ := GetNote(db, id)
-            if note != nil {
-                notes = append(notes, *note)
-            }
-        }
-    }
-    
-    // Batch load tags for all notes (prevents N+1 queries)
-    if len(notes) > 0 {
-        noteIDs := make([]int, len(notes))
-        for i, note := range notes {
-            noteIDs[i] = note.ID
-        }
-        
-        tagMap, err := batchLoadTags(db, noteIDs)
-        if err == nil {
-            for i := range notes {
-                notes[i].Tags = tagMap[notes[i].ID]
-            }
-        }
-    }
-    
-    return notes, nil
+    return page.Notes, nil
 }
 
 // batchLoadTags loads tags for multiple notes in a single query
-func batchLoadTags(db *sql.DB, noteIDs []int) (map[int][]Tag, error) {
+func batchLoadTags(ctx context.Context, q DBTX, noteIDs []int) (map[int][]Tag, error) {
     query := `
         SELECT nt.note_id, t.id, t.name
         FROM note_tags nt
@@ -419,7 +509,7 @@ func batchLoadTags(db *sql.DB, noteIDs []int) (map[int][]Tag, error) {
         ORDER BY nt.note_id, LOWER(t.name)
     `
     
-    rows, err := db.Query(query, pq.Array(noteIDs))
+    rows, err := q.QueryContext(ctx, query, pq.Array(noteIDs))
     if err != nil {
         return nil, err
     }
@@ -434,75 +524,99 @@ func batchLoadTags(db *sql.DB, noteIDs []int) (map[int][]Tag, error) {
         }
     }
     
-    return tagMap, nil
+    return tagMap, rows.Err()
+}
+
+// AttachTags batch loads tags onto the given notes in place
+func (s *Store) AttachTags(ctx context.Context, notes []Note) error {
+    if len(notes) == 0 {
+        return nil
+    }
+    noteIDs := make([]int, len(notes))
+    for i, note := range notes {
+        noteIDs[i] = note.ID
+    }
+    tagMap, err := batchLoadTags(ctx, s.q, noteIDs)
+    if err != nil {
+        return err
+    }
+    for i := range notes {
+        notes[i].Tags = tagMap[notes[i].ID]
+    }
+    return nil
 }
 
 // --- Trash/Restore/Empty Functions ---
 
-func TrashNote(db *sql.DB, id int) error {
-    _, err := db.Exec("UPDATE notes SET is_trashed=TRUE, trashed_at=NOW() WHERE id=$1", id)
+func (s *Store) TrashNote(ctx context.Context, id int) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE notes SET is_trashed=TRUE, trashed_at=NOW() WHERE id=$1", id)
     return err
 }
 
-func RestoreNote(db *sql.DB, id int) error {
-    _, err := db.Exec("UPDATE notes SET is_trashed=FALSE, trashed_at=NULL WHERE id=$1", id)
+func (s *Store) RestoreNote(ctx context.Context, id int) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE notes SET is_trashed=FALSE, trashed_at=NULL WHERE id=$1", id)
     return err
 }
 
-func DeleteNote(db *sql.DB, id int) error {
-    _, err := db.Exec("DELETE FROM notes WHERE id=$1", id)
+func (s *Store) DeleteNote(ctx context.Context, id int) error {
+    _, err := s.q.ExecContext(ctx, "DELETE FROM notes WHERE id=$1", id)
     return err
 }
 
-func ListTrashedNotes(db *sql.DB, workspaceID int) ([]Note, error) {
-    rows, err := db.Query("SELECT id FROM notes WHERE workspace_id = $1 AND is_trashed = TRUE", workspaceID)
+func (s *Store) ListTrashedNotes(ctx context.Context, workspaceID int) ([]Note, error) {
+    trashed := true
+    page, err := s.ListNotesPage(ctx, workspaceID, NoteListOptions{Trashed: &trashed})
     if err != nil {
         return nil, err
     }
-    defer rows.Close()
-    var notes []Note
-    for rows.Next() {
-        var id int
-        err := rows.Scan(&id)
-        if err == nil {
-            note, _ := GetNote(db, id)
-            if note != nil {
-                notes = append(notes, *note)
-            }
-        }
-    }
-    return notes, nil
+    return page.Notes, nil
 }
 
-func EmptyWorkspaceTrash(db *sql.DB, workspaceID int) error {
-    _, err := db.Exec("DELETE FROM notes WHERE workspace_id=$1 AND is_trashed=TRUE", workspaceID)
+func (s *Store) EmptyWorkspaceTrash(ctx context.Context, workspaceID int) error {
+    _, err := s.q.ExecContext(ctx, "DELETE FROM notes WHERE workspace_id=$1 AND is_trashed=TRUE", workspaceID)
     return err
 }
 
-func AutoEmptyTrash(db *sql.DB) error {
+func (s *Store) AutoEmptyTrash(ctx context.Context) error {
     daysStr := getenv("TRASH_AUTO_DELETE_DAYS", "30")
     days := 30
     if d, err := strconv.Atoi(daysStr); err == nil && d > 0 {
         days = d
     }
-    _, err := db.Exec(fmt.Sprintf("DELETE FROM notes WHERE is_trashed=TRUE AND trashed_at < (NOW() - INTERVAL '%d days')", days))
+    _, err := s.q.ExecContext(ctx, fmt.Sprintf("DELETE FROM notes WHERE is_trashed=TRUE AND trashed_at < (NOW() - INTERVAL '%d days')", days))
     return err
 }
 
+// PurgeTrash permanently deletes trashed notes, in one workspace or all
+// when workspaceID is 0, that were trashed more than olderThanDays ago
+// (0 purges everything). It returns the number of notes deleted.
+func (s *Store) PurgeTrash(ctx context.Context, workspaceID, olderThanDays int) (int64, error) {
+    res, err := s.q.ExecContext(ctx, `
+        DELETE FROM notes
+        WHERE is_trashed = TRUE
+          AND ($1 = 0 OR workspace_id = $1)
+          AND ($2 = 0 OR trashed_at < NOW() - make_interval(days => $2))
+    `, workspaceID, olderThanDays)
+    if err != nil {
+        return 0, err
+    }
+    return res.RowsAffected()
+}
+
 // --- Folder CRUD ---
 
-func CreateFolder(db *sql.DB, workspaceID int, name string, parentID *int) (int, error) {
+func (s *Store) CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (int, error) {
     var id int
-    err := db.QueryRow(
+    err := s.q.QueryRowContext(ctx, 
         "INSERT INTO folders (workspace_id, name, parent_id) VALUES ($1, $2, $3) RETURNING id",
         workspaceID, name, parentID,
     ).Scan(&id)
     return id, err
 }
 
-func GetFolder(db *sql.DB, id int) (*Folder, error) {
+func (s *Store) GetFolder(ctx context.Context, id int) (*Folder, error) {
     var f Folder
-    err := db.QueryRow("SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE id = $1", id).
+    err := s.q.QueryRowContext(ctx, "SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE id = $1", id).
         Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt)
     if err != nil {
         return nil, err
@@ -510,93 +624,86 @@ func GetFolder(db *sql.DB, id int) (*Folder, error) {
     return &f, nil
 }
 
-func ListFolders(db *sql.DB, workspaceID int) ([]Folder, error) {
-    rows, err := db.Query("SELECT id FROM folders WHERE workspace_id = $1", workspaceID)
+func (s *Store) ListFolders(ctx context.Context, workspaceID int) ([]Folder, error) {
+    rows, err := s.q.QueryContext(ctx, "SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE workspace_id = $1 ORDER BY id", workspaceID)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
     var folders []Folder
     for rows.Next() {
-        var id int
-        err := rows.Scan(&id)
-        if err == nil {
-            folder, _ := GetFolder(db, id)
-            if folder != nil {
-                folders = append(folders, *folder)
-            }
+        var f Folder
+        if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt); err != nil {
+            return nil, err
         }
+        folders = append(folders, f)
     }
-    return folders, nil
+    return folders, rows.Err()
 }
 
-func UpdateFolder(db *sql.DB, id int, name string, parentID *int) error {
-    _, err := db.Exec("UPDATE folders SET name=$1, parent_id=$2 WHERE id=$3", name, parentID, id)
+func (s *Store) UpdateFolder(ctx context.Context, id int, name string, parentID *int) error {
+    _, err := s.q.ExecContext(ctx, "UPDATE folders SET name=$1, parent_id=$2 WHERE id=$3", name, parentID, id)
     return err
 }
 
-func DeleteFolder(db *sql.DB, id int) error {
-    // First, get the parent_id of the folder being deleted
-    var parentID *int
-    err := db.QueryRow("SELECT parent_id FROM folders WHERE id=$1", id).Scan(&parentID)
-    if err != nil {
-        return err
-    }
-    
-    // Get all child folder IDs recursively
-    folderIDs := []int{id}
-    err = collectChildFolderIDs(db, id, &folderIDs)
-    if err != nil {
-        return err
-    }
-    
-    // Move ALL notes (trashed and non-trashed) in these folders to trash and set folder_id to parent
-    if len(folderIDs) > 0 {
-        for _, folderID := range folderIDs {
-            // Trash all non-trashed notes in this folder
-            _, err = db.Exec("UPDATE notes SET is_trashed=TRUE, trashed_at=NOW(), folder_id=$1 WHERE is_trashed=FALSE AND folder_id=$2", parentID, folderID)
-            if err != nil {
-                return err
-            }
-            
-            // Move already-trashed notes to parent folder
-            _, err = db.Exec("UPDATE notes SET folder_id=$1 WHERE is_trashed=TRUE AND folder_id=$2", parentID, folderID)
-            if err != nil {
-                return err
-            }
+// DeleteFolder deletes a folder and its subfolders. Their live notes are
+// moved to the trash and all their notes to the deleted folder's parent,
+// in one transaction.
+func (s *Store) DeleteFolder(ctx context.Context, id int) error {
+    return s.WithTx(ctx, func(tx *Store) error {
+        // First, get the parent_id of the folder being deleted
+        var parentID *int
+        err := tx.q.QueryRowContext(ctx, "SELECT parent_id FROM folders WHERE id=$1", id).Scan(&parentID)
+        if err != nil {
+            return err
         }
-    }
-    
-    // Now delete the folder (CASCADE will only delete child folders, notes are already moved)
-    _, err = db.Exec("DELETE FROM folders WHERE id=$1", id)
-    return err
+        
+        // Get all child folder IDs recursively
+        folderIDs, err := tx.descendantFolderIDs(ctx, id)
+        if err != nil {
+            return err
+        }
+        
+        // Trash all non-trashed notes in these folders and move every note to the parent
+        _, err = tx.q.ExecContext(ctx, "UPDATE notes SET is_trashed=TRUE, trashed_at=NOW() WHERE is_trashed=FALSE AND folder_id = ANY($1)", pq.Array(folderIDs))
+        if err != nil {
+            return err
+        }
+        _, err = tx.q.ExecContext(ctx, "UPDATE notes SET folder_id=$1 WHERE folder_id = ANY($2)", parentID, pq.Array(folderIDs))
+        if err != nil {
+            return err
+        }
+        
+        // Now delete the folder (CASCADE will only delete child folders, notes are already moved)
+        _, err = tx.q.ExecContext(ctx, "DELETE FROM folders WHERE id=$1", id)
+        return err
+    })
 }
 
-// Helper function to recursively collect all child folder IDs
-func collectChildFolderIDs(db *sql.DB, parentID int, folderIDs *[]int) error {
-    rows, err := db.Query("SELECT id FROM folders WHERE parent_id=$1", parentID)
+// descendantFolderIDs returns a folder's ID followed by those of all folders
+// below it
+func (s *Store) descendantFolderIDs(ctx context.Context, id int) ([]int, error) {
+    rows, err := s.q.QueryContext(ctx, `
+        WITH RECURSIVE tree AS (
+            SELECT id FROM folders WHERE id = $1
+            UNION ALL
+            SELECT f.id FROM folders f JOIN tree t ON f.parent_id = t.id
+        )
+        SELECT id FROM tree
+    `, id)
     if err != nil {
-        return err
+        return nil, err
     }
     defer rows.Close()
-    
-    var childIDs []int
+    ids := []int{}
     for rows.Next() {
-        var childID int
-        if err := rows.Scan(&childID); err == nil {
-            childIDs = append(childIDs, childID)
-            *folderIDs = append(*folderIDs, childID)
+        var folderID int
+        if err := rows.Scan(&folderID); err != nil {
+            return nil, err
         }
+        ids = append(ids, folderID)
     }
-    
-    // Recursively collect children of children
-    for _, childID := range childIDs {
-        if err := collectChildFolderIDs(db, childID, folderIDs); err != nil {
-            return err
-        }
-    }
-    
-    return nil
+    return ids, rows.Err()
 }
 
 // --- Tag Logic ---
@@ -606,25 +713,19 @@ type Tag struct {
     Name string `json:"name"`
 }
 
-func GetOrCreateTag(db *sql.DB, name string) (Tag, error) {
+func (s *Store) GetOrCreateTag(ctx context.Context, name string) (Tag, error) {
+    // ON CONFLICT rather than insert-and-retry: a failed INSERT would abort
+    // the surrounding transaction
     var t Tag
-    err := db.QueryRow("SELECT id, name FROM tags WHERE LOWER(name)=LOWER($1)", name).Scan(&t.ID, &t.Name)
-    if err == nil {
-        return t, nil
-    }
-    err = db.QueryRow("INSERT INTO tags (name) VALUES ($1) RETURNING id, name", name).Scan(&t.ID, &t.Name)
-    if err != nil {
-        err2 := db.QueryRow("SELECT id, name FROM tags WHERE LOWER(name)=LOWER($1)", name).Scan(&t.ID, &t.Name)
-        if err2 == nil {
-            return t, nil
-        }
-        return t, err
+    err := s.q.QueryRowContext(ctx, "INSERT INTO tags (name) VALUES ($1) ON CONFLICT ((LOWER(name))) DO NOTHING RETURNING id, name", name).Scan(&t.ID, &t.Name)
+    if err == sql.ErrNoRows {
+        err = s.q.QueryRowContext(ctx, "SELECT id, name FROM tags WHERE LOWER(name)=LOWER($1)", name).Scan(&t.ID, &t.Name)
     }
-    return t, nil
+    return t, err
 }
 
-func ListTags(db *sql.DB) ([]Tag, error) {
-    rows, err := db.Query("SELECT id, name FROM tags ORDER BY LOWER(name)")
+func (s *Store) ListTags(ctx context.Context) ([]Tag, error) {
+    rows, err := s.q.QueryContext(ctx, "SELECT id, name FROM tags ORDER BY LOWER(name)")
     if err != nil {
         return nil, err
     }
@@ -639,26 +740,29 @@ func ListTags(db *sql.DB) ([]Tag, error) {
     return tags, nil
 }
 
-func SetTagsForNote(db *sql.DB, noteID int, tagNames []string) error {
-    _, err := db.Exec("DELETE FROM note_tags WHERE note_id = $1", noteID)
-    if err != nil {
-        return err
-    }
-    for _, name := range tagNames {
-        t, err := GetOrCreateTag(db, name)
+// SetTagsForNote replaces a note's tags, creating missing ones, atomically
+func (s *Store) SetTagsForNote(ctx context.Context, noteID int, tagNames []string) error {
+    return s.WithTx(ctx, func(tx *Store) error {
+        _, err := tx.q.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id = $1", noteID)
         if err != nil {
-            return fmt.Errorf("GetOrCreateTag failed for tag '%s': %v", name, err)
+            return err
         }
-        _, err = db.Exec("INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", noteID, t.ID)
-        if err != nil {
-            return fmt.Errorf("Failed to insert note_tag for note %d tag %d: %v", noteID, t.ID, err)
+        for _, name := range tagNames {
+            t, err := tx.GetOrCreateTag(ctx, name)
+            if err != nil {
+                return fmt.Errorf("GetOrCreateTag failed for tag '%s': %v", name, err)
+            }
+            _, err = tx.q.ExecContext(ctx, "INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", noteID, t.ID)
+            if err != nil {
+                return fmt.Errorf("Failed to insert note_tag for note %d tag %d: %v", noteID, t.ID, err)
+            }
         }
-    }
-    return nil
+        return nil
+    })
 }
 
-func ListTagsForNote(db *sql.DB, noteID int) ([]Tag, error) {
-    rows, err := db.Query(`
+func (s *Store) ListTagsForNote(ctx context.Context, noteID int) ([]Tag, error) {
+    rows, err := s.q.QueryContext(ctx, `
         SELECT t.id, t.name
         FROM tags t
         JOIN note_tags nt ON nt.tag_id = t.id
@@ -679,8 +783,8 @@ func ListTagsForNote(db *sql.DB, noteID int) ([]Tag, error) {
     return tags, nil
 }
 
-func ListTagsForWorkspace(db *sql.DB, workspaceID int) ([]Tag, error) {
-    rows, err := db.Query(`
+func (s *Store) ListTagsForWorkspace(ctx context.Context, workspaceID int) ([]Tag, error) {
+    rows, err := s.q.QueryContext(ctx, `
         SELECT t.id, t.name
         FROM tags t
         JOIN note_tags nt ON nt.tag_id = t.id
@@ -706,7 +810,7 @@ func ListTagsForWorkspace(db *sql.DB, workspaceID int) ([]Tag, error) {
 // --- Move/Update Functions for Notes and Folders ---
 
 // UpdateNoteMetadata updates note metadata fields (NOT content - preserves granular edit system)
-func UpdateNoteMetadata(db *sql.DB, noteID int, updates map[string]interface{}) error {
+func (s *Store) UpdateNoteMetadata(ctx context.Context, noteID int, updates map[string]interface{}) error {
     allowedFields := map[string]bool{
         "title": true, "folder_id": true, "workspace_id": true, "color": true,
     }
@@ -725,110 +829,107 @@ func UpdateNoteMetadata(db *sql.DB, noteID int, updates map[string]interface{})
         argIdx++
     }
     
+    // Notes that follow their workspace's search language pick up the new workspace's setting
+    if workspaceID, moving := updates["workspace_id"]; moving {
+        setClauses = append(setClauses, fmt.Sprintf(
+            "search_language = CASE WHEN search_language_inherited THEN (SELECT search_language FROM workspaces WHERE id=$%d) ELSE search_language END",
+            argIdx))
+        args = append(args, workspaceID)
+        argIdx++
+    }
+    
     query := fmt.Sprintf("UPDATE notes SET %s WHERE id=$%d", 
         strings.Join(setClauses, ", "), argIdx)
     args = append(args, noteID)
     
-    _, err := db.Exec(query, args...)
+    _, err := s.q.ExecContext(ctx, query, args...)
     return err
 }
 
-// UpdateNoteSearchText updates the searchable plain text content
-func UpdateNoteSearchText(db *sql.DB, noteID int, contentText string) error {
-	_, err := db.Exec(
-		"UPDATE notes SET content_text=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2",
+// UpdateNoteSearchText updates the searchable plain text content, reporting
+// whether it changed; every open editor saves the same text after an edit
+func (s *Store) UpdateNoteSearchText(ctx context.Context, noteID int, contentText string) (bool, error) {
+	res, err := s.q.ExecContext(ctx,
+		"UPDATE notes SET content_text=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 AND content_text IS DISTINCT FROM $1",
 		contentText, noteID,
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
 // SearchNotes searches notes by title, tags, and optionally content
 // mode can be "metadata" (title+tags) or "full" (title+tags+content)
-func SearchNotes(db *sql.DB, userID int, query string, mode string) ([]Note, error) {
+// The query may also carry filters such as tag:work or folder:12 (see ParseSearchQuery)
+func (s *Store) SearchNotes(ctx context.Context, userID int, query string, mode string) ([]Note, error) {
 	// Get all workspaces user is member of
-	workspaceIDs := []int{}
-	rows, err := db.Query(`
-		SELECT workspace_id FROM workspace_members WHERE user_id = $1
-	`, userID)
+	workspaceIDs, err := s.MemberWorkspaceIDs(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	for rows.Next() {
-		var wsID int
-		if err := rows.Scan(&wsID); err == nil {
-			workspaceIDs = append(workspaceIDs, wsID)
-		}
-	}
-	rows.Close()
-	
-	if len(workspaceIDs) == 0 {
+
+	return s.searchNotesIn(ctx, workspaceIDs, ParseSearchQuery(query), mode)
+}
+
+// searchNotesIn runs a parsed query against the given workspaces
+func (s *Store) searchNotesIn(ctx context.Context, workspaceIDs []int, q SearchQuery, mode string) ([]Note, error) {
+	if len(workspaceIDs) == 0 || q.IsEmpty() {
 		return []Note{}, nil
 	}
-	
-	// Build search query based on mode
-	var sqlQuery string
-	if mode == "full" {
-		sqlQuery = `
-			SELECT DISTINCT n.id
-			FROM notes n
-			LEFT JOIN note_tags nt ON nt.note_id = n.id
-			LEFT JOIN tags t ON t.id = nt.tag_id
-			WHERE n.workspace_id = ANY($1)
-			AND n.is_trashed = FALSE
-			AND (
-				LOWER(n.title) LIKE $2
-				OR LOWER(t.name) LIKE $2
-				OR to_tsvector('english', n.content_text) @@ plainto_tsquery('english', $3)
-			)
-			ORDER BY n.id DESC
-		`
-	} else {
-		// metadata mode - only title and tags
-		sqlQuery = `
-			SELECT DISTINCT n.id
-			FROM notes n
-			LEFT JOIN note_tags nt ON nt.note_id = n.id
-			LEFT JOIN tags t ON t.id = nt.tag_id
-			WHERE n.workspace_id = ANY($1)
-			AND n.is_trashed = FALSE
-			AND (
-				LOWER(n.title) LIKE $2
-				OR LOWER(t.name) LIKE $2
-			)
-			ORDER BY n.id DESC
-		`
+
+	args := []interface{}{pq.Array(workspaceIDs)}
+	where, err := s.searchConditions(ctx, workspaceIDs, q, mode, &args)
+	if err != nil {
+		return nil, err
 	}
-	
-	likeQuery := "%" + strings.ToLower(query) + "%"
-	
-	var searchRows *sql.Rows
-	if mode == "full" {
-		searchRows, err = db.Query(sqlQuery, pq.Array(workspaceIDs), likeQuery, query)
-	} else {
-		searchRows, err = db.Query(sqlQuery, pq.Array(workspaceIDs), likeQuery)
+
+	searchRows, err := s.q.QueryContext(ctx, "SELECT n.id FROM notes n WHERE "+where+" ORDER BY n.id DESC", args...)
+	if err != nil {
+		return nil, err
 	}
+	ids, err := scanIntRows(searchRows)
 	if err != nil {
 		return nil, err
 	}
-	defer searchRows.Close()
-	
+
 	var notes []Note
-	for searchRows.Next() {
-		var id int
-		if err := searchRows.Scan(&id); err == nil {
-			note, _ := GetNote(db, id)
-			if note != nil {
-				notes = append(notes, *note)
-			}
+	for _, id := range ids {
+		note, _ := s.GetNote(ctx, id)
+		if note != nil {
+			notes = append(notes, *note)
 		}
 	}
-	
+
 	return notes, nil
 }
 
+// countNotesIn returns how many notes in the given workspaces match a parsed query
+func (s *Store) countNotesIn(ctx context.Context, workspaceIDs []int, q SearchQuery, mode string) (int, error) {
+	if len(workspaceIDs) == 0 || q.IsEmpty() {
+		return 0, nil
+	}
+
+	args := []interface{}{pq.Array(workspaceIDs)}
+	where, err := s.searchConditions(ctx, workspaceIDs, q, mode, &args)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes n WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// MemberWorkspaceIDs returns the IDs of all workspaces the user belongs to
+func (s *Store) MemberWorkspaceIDs(ctx context.Context, userID int) ([]int, error) {
+	return s.scanInts(ctx, "SELECT workspace_id FROM workspace_members WHERE user_id = $1", userID)
+}
+
 // IsDescendantFolder checks if potentialParentID is a descendant of folderID
 // Returns true if moving folderID to potentialParentID would create a cycle
-func IsDescendantFolder(db *sql.DB, folderID int, potentialParentID int) (bool, error) {
+func (s *Store) IsDescendantFolder(ctx context.Context, folderID int, potentialParentID int) (bool, error) {
 	if folderID == potentialParentID {
 		return true, nil // Folder is its own descendant
 	}
@@ -850,7 +951,7 @@ func IsDescendantFolder(db *sql.DB, folderID int, potentialParentID int) (bool,
 		
 		// Get parent of current folder
 		var parentID *int
-		err := db.QueryRow("SELECT parent_id FROM folders WHERE id=$1", currentID).Scan(&parentID)
+		err := s.q.QueryRowContext(ctx, "SELECT parent_id FROM folders WHERE id=$1", currentID).Scan(&parentID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				break // Reached root
@@ -868,16 +969,22 @@ func IsDescendantFolder(db *sql.DB, folderID int, potentialParentID int) (bool,
 }
 
 // UpdateFolderWithCascade updates folder and cascades workspace_id changes to children and notes
-func UpdateFolderWithCascade(db *sql.DB, folderID int, name string, parentID *int, workspaceID *int) error {
+func (s *Store) UpdateFolderWithCascade(ctx context.Context, folderID int, name string, parentID *int, workspaceID *int) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		return tx.updateFolderWithCascade(ctx, folderID, name, parentID, workspaceID)
+	})
+}
+
+func (s *Store) updateFolderWithCascade(ctx context.Context, folderID int, name string, parentID *int, workspaceID *int) error {
 	// Get current folder state
-	oldFolder, err := GetFolder(db, folderID)
+	oldFolder, err := s.GetFolder(ctx, folderID)
 	if err != nil {
 		return err
 	}
 	
 	// If parentID is changing, validate it won't create a cycle
 	if parentID != nil && (oldFolder.ParentID == nil || *parentID != *oldFolder.ParentID) {
-		isDescendant, err := IsDescendantFolder(db, folderID, *parentID)
+		isDescendant, err := s.IsDescendantFolder(ctx, folderID, *parentID)
 		if err != nil {
 			return err
 		}
@@ -887,7 +994,7 @@ func UpdateFolderWithCascade(db *sql.DB, folderID int, name string, parentID *in
 		
 		// If moving to a different parent, verify parent is in target workspace
 		if workspaceID != nil && *workspaceID != oldFolder.WorkspaceID {
-			parentFolder, err := GetFolder(db, *parentID)
+			parentFolder, err := s.GetFolder(ctx, *parentID)
 			if err != nil {
 				return fmt.Errorf("parent folder not found")
 			}
@@ -898,7 +1005,7 @@ func UpdateFolderWithCascade(db *sql.DB, folderID int, name string, parentID *in
 	}
 	
 	// Update the folder itself
-	_, err = db.Exec(
+	_, err = s.q.ExecContext(ctx, 
 		"UPDATE folders SET name=$1, parent_id=$2, workspace_id=$3 WHERE id=$4",
 		name, parentID, coalesce(workspaceID, &oldFolder.WorkspaceID), folderID,
 	)
@@ -908,7 +1015,7 @@ func UpdateFolderWithCascade(db *sql.DB, folderID int, name string, parentID *in
 	
 	// If workspace_id changed, cascade to all descendants
 	if workspaceID != nil && *workspaceID != oldFolder.WorkspaceID {
-		if err := cascadeWorkspaceIDToDescendants(db, folderID, *workspaceID); err != nil {
+		if err := s.cascadeWorkspaceIDToDescendants(ctx, folderID, *workspaceID); err != nil {
 			return err
 		}
 	}
@@ -926,41 +1033,25 @@ func coalesce(values ...*int) int {
 	return 0
 }
 
-// cascadeWorkspaceIDToDescendants recursively updates workspace_id for all child folders and notes
-func cascadeWorkspaceIDToDescendants(db *sql.DB, parentFolderID int, newWorkspaceID int) error {
-	// Get all child folders
-	rows, err := db.Query("SELECT id FROM folders WHERE parent_id=$1", parentFolderID)
+// cascadeWorkspaceIDToDescendants updates workspace_id for all folders below
+// a folder and for the notes in that folder and its descendants
+func (s *Store) cascadeWorkspaceIDToDescendants(ctx context.Context, parentFolderID int, newWorkspaceID int) error {
+	folderIDs, err := s.descendantFolderIDs(ctx, parentFolderID)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	
-	var childFolderIDs []int
-	for rows.Next() {
-		var childID int
-		if err := rows.Scan(&childID); err == nil {
-			childFolderIDs = append(childFolderIDs, childID)
-		}
-	}
 	
 	// Update all child folders' workspace_id
-	for _, childID := range childFolderIDs {
-		_, err := db.Exec("UPDATE folders SET workspace_id=$1 WHERE id=$2", newWorkspaceID, childID)
-		if err != nil {
-			return err
-		}
-		
-		// Recursively update this child's descendants
-		if err := cascadeWorkspaceIDToDescendants(db, childID, newWorkspaceID); err != nil {
-			return err
-		}
-	}
-	
-	// Update all notes in this folder
-	_, err = db.Exec("UPDATE notes SET workspace_id=$1 WHERE folder_id=$2", newWorkspaceID, parentFolderID)
+	_, err = s.q.ExecContext(ctx, "UPDATE folders SET workspace_id=$1 WHERE id = ANY($2)", newWorkspaceID, pq.Array(folderIDs[1:]))
 	if err != nil {
 		return err
 	}
 	
-	return nil
+	// Update all notes in the subtree
+	_, err = s.q.ExecContext(ctx, `
+		UPDATE notes SET workspace_id=$1,
+			search_language = CASE WHEN search_language_inherited THEN (SELECT search_language FROM workspaces WHERE id=$1) ELSE search_language END
+		WHERE folder_id = ANY($2)
+	`, newWorkspaceID, pq.Array(folderIDs))
+	return err
 }
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// Database drivers selectable with DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver returns the configured database driver. PostgreSQL is the default;
+// SQLite suits single-user and embedded deployments.
+func Driver() string {
+	return getenv("DB_DRIVER", DriverPostgres)
+}
+
+// SQLitePath returns the database file used when DB_DRIVER=sqlite
+func SQLitePath() string {
+	return getenv("DB_PATH", "./data/notes.db")
+}
+
+// SQLiteDSN builds the connection string for the SQLite database file.
+// Every connection enforces foreign keys (cascading deletes depend on them),
+// waits for locks instead of failing, and uses WAL so readers do not block
+// the writer. Transactions take the write lock when they begin, so two
+// read-then-write transactions cannot deadlock.
+func SQLiteDSN() string {
+	query := url.Values{}
+	query.Set("_txlock", "immediate")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	return "file:" + SQLitePath() + "?" + query.Encode()
+}
+
+// openSQLite opens the SQLite database, creating its directory if needed
+func openSQLite() (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(SQLitePath()), 0o755); err != nil {
+		return nil, fmt.Errorf("create database directory: %w", err)
+	}
+	return sql.Open("sqlite", SQLiteDSN())
+}
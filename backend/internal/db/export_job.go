@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// --- Export Jobs ---
+
+// ExportJob is a background workspace export. The row is shared by the
+// replicas; the archive it produces is a file named after the ID in the
+// export directory they share.
+type ExportJob struct {
+	ID          string `json:"id"`
+	WorkspaceID int    `json:"workspace_id"`
+	UserID      int    `json:"user_id"`
+	Status      string `json:"status"` // running, done, failed
+	Error       string `json:"error,omitempty"`
+	Size        int64  `json:"size,omitempty"` // bytes, once done
+	CreatedAt   string `json:"created_at"`
+	FinishedAt  string `json:"finished_at,omitempty"`
+}
+
+const exportJobColumns = "id, workspace_id, user_id, status, COALESCE(error, ''), size, created_at, finished_at"
+
+func scanExportJob(row interface{ Scan(...interface{}) error }) (*ExportJob, error) {
+	var j ExportJob
+	var finished sql.NullString
+	if err := row.Scan(&j.ID, &j.WorkspaceID, &j.UserID, &j.Status, &j.Error, &j.Size, &j.CreatedAt, &finished); err != nil {
+		return nil, err
+	}
+	j.FinishedAt = finished.String
+	return &j, nil
+}
+
+// CreateExportJob records a running job
+func (s *Store) CreateExportJob(ctx context.Context, id string, workspaceID, userID int) (*ExportJob, error) {
+	return scanExportJob(s.q.QueryRowContext(ctx,
+		"INSERT INTO export_jobs (id, workspace_id, user_id) VALUES ($1, $2, $3) RETURNING "+exportJobColumns,
+		id, workspaceID, userID,
+	))
+}
+
+// GetExportJob returns a job that has not expired
+func (s *Store) GetExportJob(ctx context.Context, id string) (*ExportJob, error) {
+	return scanExportJob(s.q.QueryRowContext(ctx,
+		"SELECT "+exportJobColumns+" FROM export_jobs WHERE id = $1 AND (expires_at IS NULL OR expires_at > NOW())", id))
+}
+
+// CountRunningExportJobs counts a user's running jobs on every replica
+func (s *Store) CountRunningExportJobs(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM export_jobs WHERE user_id = $1 AND status = 'running'", userID).Scan(&n)
+	return n, err
+}
+
+// TouchExportJob records that a running job's process is still alive
+func (s *Store) TouchExportJob(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE export_jobs SET heartbeat_at = NOW() WHERE id = $1 AND status = 'running'", id)
+	return err
+}
+
+// FinishExportJob records the outcome of a running job, kept for retention.
+// It reports false when the job was no longer running, having been given
+// up as stalled.
+func (s *Store) FinishExportJob(ctx context.Context, id, status, errMsg string, size int64, retention time.Duration) (bool, error) {
+	var errArg interface{}
+	if errMsg != "" {
+		errArg = errMsg
+	}
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE export_jobs
+		SET status = $2, error = $3, size = $4, finished_at = NOW(), expires_at = NOW() + $5 * INTERVAL '1 second'
+		WHERE id = $1 AND status = 'running'
+	`, id, status, errArg, size, int64(retention.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FailStalledExportJobs fails the running jobs whose process has not been
+// heard from for stalledAfter, which died with it, returning their IDs
+func (s *Store) FailStalledExportJobs(ctx context.Context, stalledAfter, retention time.Duration) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE export_jobs
+		SET status = 'failed', error = 'the export was interrupted', finished_at = NOW(),
+		    expires_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE status = 'running' AND heartbeat_at < NOW() - $1 * INTERVAL '1 second'
+		RETURNING id
+	`, int64(stalledAfter.Seconds()), int64(retention.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	return scanJobIDs(rows)
+}
+
+// DeleteExpiredExportJobs forgets the jobs past their retention, returning
+// their IDs so their files can be removed
+func (s *Store) DeleteExpiredExportJobs(ctx context.Context) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, "DELETE FROM export_jobs WHERE expires_at <= NOW() RETURNING id")
+	if err != nil {
+		return nil, err
+	}
+	return scanJobIDs(rows)
+}
+
+func scanJobIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
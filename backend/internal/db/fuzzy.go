@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ScoredNote is a search hit with its relevance score
+type ScoredNote struct {
+	Note
+	Score float64 `json:"score"`
+}
+
+// FuzzySearchResult holds ranked notes plus "did you mean" suggestions
+type FuzzySearchResult struct {
+	Notes       []ScoredNote `json:"notes"`
+	DidYouMean  string       `json:"did_you_mean,omitempty"`
+	Suggestions []string     `json:"suggestions"`
+}
+
+// SearchNotesFuzzy performs a typo-tolerant search over titles, tags and content
+// using pg_trgm, ranked by trigram similarity
+func (s *Store) SearchNotesFuzzy(ctx context.Context, userID int, query string, limit int) (*FuzzySearchResult, error) {
+	result := &FuzzySearchResult{Notes: []ScoredNote{}, Suggestions: []string{}}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return result, nil
+	}
+
+	workspaceIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaceIDs) == 0 {
+		return result, nil
+	}
+
+	err = s.WithTx(ctx, func(tx *Store) error {
+		return tx.searchNotesFuzzy(ctx, workspaceIDs, query, limit, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchNotesFuzzy fills in result for SearchNotesFuzzy within its transaction
+func (s *Store) searchNotesFuzzy(ctx context.Context, workspaceIDs []int, query string, limit int, result *FuzzySearchResult) error {
+	// Thresholds drive the % and <% operators, which is what lets the
+	// trigram GIN indexes be used. SET LOCAL scopes them to this transaction.
+	if _, err := s.q.ExecContext(ctx, `
+		SELECT set_config('pg_trgm.similarity_threshold', $1, true),
+		       set_config('pg_trgm.word_similarity_threshold', $1, true)
+	`, strconv.FormatFloat(FuzzyThreshold, 'f', -1, 64)); err != nil {
+		return err
+	}
+
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT n.id, n.workspace_id, n.title, n.yjs_room_id, n.folder_id, n.created_by,
+		       n.created_at, n.updated_at, n.is_trashed, n.trashed_at, n.color,
+		       n.search_language::text, n.search_language_inherited,
+		       GREATEST(
+		           word_similarity($2, LOWER(n.title)),
+		           COALESCE(word_similarity($2, LOWER(n.content_text)), 0) * 0.8,
+		           COALESCE(MAX(similarity(LOWER(t.name), $2)), 0)
+		       ) AS score
+		FROM notes n
+		LEFT JOIN note_tags nt ON nt.note_id = n.id
+		LEFT JOIN tags t ON t.id = nt.tag_id
+		WHERE n.workspace_id = ANY($1)
+		AND n.is_trashed = FALSE
+		AND (
+			$2 <% LOWER(n.title)
+			OR $2 <% LOWER(n.content_text)
+			OR LOWER(t.name) % $2
+		)
+		GROUP BY n.id
+		ORDER BY score DESC, n.updated_at DESC
+		LIMIT $3
+	`, pq.Array(workspaceIDs), query, limit)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var n ScoredNote
+		if err := rows.Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy,
+			&n.CreatedAt, &n.UpdatedAt, &n.IsTrashed, &n.TrashedAt, &n.Color,
+			&n.SearchLanguage, &n.SearchLanguageInherited, &n.Score); err == nil {
+			result.Notes = append(result.Notes, n)
+		}
+	}
+	rows.Close()
+
+	didYouMean, suggestions, err := s.suggestTerms(ctx, workspaceIDs, query)
+	if err != nil {
+		return err
+	}
+	result.DidYouMean = didYouMean
+	result.Suggestions = suggestions
+
+	if len(result.Notes) > 0 {
+		noteIDs := make([]int, len(result.Notes))
+		for i, n := range result.Notes {
+			noteIDs[i] = n.ID
+		}
+		tagMap, err := batchLoadTags(ctx, s.q, noteIDs)
+		if err == nil {
+			for i := range result.Notes {
+				result.Notes[i].Tags = tagMap[result.Notes[i].ID]
+			}
+		}
+	}
+
+	return nil
+}
+
+// suggestTerms builds "did you mean" corrections from the vocabulary of the
+// given workspaces: words in note titles and content plus tag names.
+// A term that already appears in the vocabulary is left as-is.
+func (s *Store) suggestTerms(ctx context.Context, workspaceIDs []int, query string) (string, []string, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return "", nil, nil
+	}
+
+	rows, err := s.q.QueryContext(ctx, `
+		WITH vocab AS (
+			SELECT DISTINCT word FROM (
+				SELECT regexp_split_to_table(LOWER(n.title || ' ' || COALESCE(n.content_text, '')), '[^[:alnum:]]+') AS word
+				FROM notes n
+				WHERE n.workspace_id = ANY($1) AND n.is_trashed = FALSE
+				UNION ALL
+				SELECT LOWER(t.name)
+				FROM tags t
+				JOIN note_tags nt ON nt.tag_id = t.id
+				JOIN notes n ON n.id = nt.note_id
+				WHERE n.workspace_id = ANY($1) AND n.is_trashed = FALSE
+			) w
+			WHERE length(word) >= $3
+		)
+		SELECT term, vocab.word, similarity(vocab.word, term) AS score
+		FROM unnest($2::text[]) AS term
+		JOIN vocab ON vocab.word % term
+		ORDER BY term, score DESC, vocab.word
+	`, pq.Array(workspaceIDs), pq.Array(terms), minVocabularyWord)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool)
+	candidates := make(map[string][]string)
+	for rows.Next() {
+		var term, word string
+		var score float64
+		if err := rows.Scan(&term, &word, &score); err != nil {
+			continue
+		}
+		if word == term {
+			known[term] = true
+			continue
+		}
+		candidates[term] = append(candidates[term], word)
+	}
+
+	didYouMean, suggestions := corrections(terms, known, candidates)
+	return didYouMean, suggestions, nil
+}
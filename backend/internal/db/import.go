@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WorkspaceImport describes a workspace to recreate, such as one read from
+// an export archive. Keys are the IDs in the source and only link notes to
+// folders; everything gets new IDs.
+type WorkspaceImport struct {
+	Name           string
+	SearchLanguage string // empty keeps the default
+	CreatedAt      *time.Time
+	Folders        []ImportFolder // parents before their children
+	Notes          []ImportNote
+}
+
+type ImportFolder struct {
+	Key       int
+	ParentKey *int
+	Name      string
+	CreatedAt *time.Time
+}
+
+type ImportNote struct {
+	Key            int
+	FolderKey      *int
+	Title          string
+	Color          string
+	Tags           []string
+	CreatedAt      *time.Time // nil means now
+	UpdatedAt      *time.Time
+	IsTrashed      bool
+	TrashedAt      *time.Time
+	SearchLanguage string // empty inherits the workspace's
+
+	// Content is the note's Yjs state. It is stored where the document
+	// service loads it from, so a new room opens with it.
+	Content     []byte
+	ContentText string
+}
+
+// ImportedWorkspace maps the keys of an import to the rows created
+type ImportedWorkspace struct {
+	WorkspaceID int            `json:"workspace_id"`
+	Folders     map[int]int    `json:"folders"` // key to folder ID
+	Notes       []ImportedNote `json:"notes"`
+}
+
+type ImportedNote struct {
+	Key       int    `json:"key"`
+	ID        int    `json:"id"`
+	YjsRoomID string `json:"yjs_room_id"`
+}
+
+// FolderID returns the new ID of a folder key; parents must have been
+// imported before their children
+func (w *ImportedWorkspace) FolderID(key *int) (*int, error) {
+	if key == nil {
+		return nil, nil
+	}
+	id, ok := w.Folders[*key]
+	if !ok {
+		return nil, fmt.Errorf("folder %d is not part of the import", *key)
+	}
+	return &id, nil
+}
+
+// ImportWorkspace creates a workspace owned by ownerID with its folders,
+// notes, tags and content in one transaction
+func (s *Store) ImportWorkspace(ctx context.Context, ownerID int, in WorkspaceImport) (*ImportedWorkspace, error) {
+	out := &ImportedWorkspace{Folders: map[int]int{}, Notes: []ImportedNote{}}
+	err := s.WithTx(ctx, func(tx *Store) error {
+		id, err := tx.CreateWorkspace(ctx, in.Name, ownerID)
+		if err != nil {
+			return err
+		}
+		out.WorkspaceID = id
+		_, err = tx.q.ExecContext(ctx,
+			`UPDATE workspaces SET created_at = COALESCE($1, created_at),
+				search_language = COALESCE(NULLIF($2, '')::regconfig, search_language)
+			WHERE id = $3`,
+			utcTime(in.CreatedAt), in.SearchLanguage, id)
+		if err != nil {
+			return fmt.Errorf("workspace: %w", err)
+		}
+
+		for _, f := range in.Folders {
+			parentID, err := out.FolderID(f.ParentKey)
+			if err != nil {
+				return err
+			}
+			var folderID int
+			err = tx.q.QueryRowContext(ctx,
+				"INSERT INTO folders (workspace_id, name, parent_id, created_at) VALUES ($1, $2, $3, COALESCE($4, CURRENT_TIMESTAMP)) RETURNING id",
+				id, f.Name, parentID, utcTime(f.CreatedAt),
+			).Scan(&folderID)
+			if err != nil {
+				return fmt.Errorf("folder %d: %w", f.Key, err)
+			}
+			out.Folders[f.Key] = folderID
+		}
+
+		for _, n := range in.Notes {
+			folderID, err := out.FolderID(n.FolderKey)
+			if err != nil {
+				return err
+			}
+			var noteID int
+			err = tx.q.QueryRowContext(ctx, `
+				INSERT INTO notes (workspace_id, title, yjs_room_id, folder_id, created_by, color, content, content_text,
+					is_trashed, trashed_at, created_at, updated_at, search_language, search_language_inherited)
+				VALUES ($1, $2, 'temp', $3, $4, $5, $6, $7,
+					$8, CASE WHEN $8 THEN COALESCE($9, CURRENT_TIMESTAMP) END,
+					COALESCE($10, CURRENT_TIMESTAMP), COALESCE($11, $10, CURRENT_TIMESTAMP),
+					COALESCE(NULLIF($12, '')::regconfig, (SELECT search_language FROM workspaces WHERE id = $1)), $12 = '')
+				RETURNING id`,
+				id, n.Title, folderID, ownerID, n.Color, n.Content, n.ContentText,
+				n.IsTrashed, utcTime(n.TrashedAt), utcTime(n.CreatedAt), utcTime(n.UpdatedAt), n.SearchLanguage,
+			).Scan(&noteID)
+			if err != nil {
+				return fmt.Errorf("note %d: %w", n.Key, err)
+			}
+			roomID := fmt.Sprintf("w%d_n%d", id, noteID)
+			if _, err := tx.q.ExecContext(ctx, "UPDATE notes SET yjs_room_id=$1 WHERE id=$2", roomID, noteID); err != nil {
+				return err
+			}
+			if len(n.Tags) > 0 {
+				if err := tx.SetTagsForNote(ctx, noteID, n.Tags); err != nil {
+					return fmt.Errorf("note %d tags: %w", n.Key, err)
+				}
+			}
+			out.Notes = append(out.Notes, ImportedNote{Key: n.Key, ID: noteID, YjsRoomID: roomID})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// utcTime converts an optional timestamp for the TIMESTAMP columns, which
+// hold UTC
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// SetNoteContent stores a note's Yjs state and search text directly, for
+// notes imported into an existing workspace, with the source's timestamps
+// when given. The document service must not have the room open yet.
+func (s *Store) SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE notes SET content = $1, content_text = $2,
+			created_at = COALESCE($3, created_at), updated_at = COALESCE($4, $3, updated_at)
+		WHERE id = $5`,
+		content, contentText, utcTime(createdAt), utcTime(updatedAt), noteID)
+	return err
+}
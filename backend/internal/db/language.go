@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DefaultSearchLanguage is the text search configuration used when none is set
+const DefaultSearchLanguage = "english"
+
+// ListSearchLanguages returns the text search configurations installed in the
+// database, e.g. "english", "german", "french" and "simple" (no stemming)
+func (s *Store) ListSearchLanguages(ctx context.Context) ([]string, error) {
+	return s.queryStrings(ctx, "SELECT cfgname FROM pg_ts_config ORDER BY cfgname")
+}
+
+// IsValidSearchLanguage reports whether name is an installed text search configuration
+func (s *Store) IsValidSearchLanguage(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := s.q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM pg_ts_config WHERE cfgname = $1)", name).Scan(&exists)
+	return exists, err
+}
+
+// SetWorkspaceSearchLanguage changes a workspace's default language and
+// re-points every note that inherits it
+func (s *Store) SetWorkspaceSearchLanguage(ctx context.Context, workspaceID int, language string) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		if _, err := tx.q.ExecContext(ctx, "UPDATE workspaces SET search_language=$1::regconfig WHERE id=$2", language, workspaceID); err != nil {
+			return err
+		}
+		_, err := tx.q.ExecContext(ctx,
+			"UPDATE notes SET search_language=$1::regconfig WHERE workspace_id=$2 AND search_language_inherited",
+			language, workspaceID,
+		)
+		return err
+	})
+}
+
+// SetNoteSearchLanguage sets a per-note language override.
+// A nil language drops the override so the note follows its workspace again.
+func (s *Store) SetNoteSearchLanguage(ctx context.Context, noteID int, language *string) error {
+	if language == nil {
+		_, err := s.q.ExecContext(ctx, `
+			UPDATE notes SET search_language_inherited=TRUE,
+				search_language=(SELECT w.search_language FROM workspaces w WHERE w.id = notes.workspace_id)
+			WHERE id=$1
+		`, noteID)
+		return err
+	}
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE notes SET search_language=$1::regconfig, search_language_inherited=FALSE WHERE id=$2",
+		*language, noteID,
+	)
+	return err
+}
+
+// searchLanguagesInUse lists the distinct configs of notes in the given workspaces
+func (s *Store) searchLanguagesInUse(ctx context.Context, workspaceIDs []int) ([]string, error) {
+	return s.queryStrings(ctx,
+		"SELECT DISTINCT search_language::text FROM notes WHERE workspace_id = ANY($1) AND is_trashed = FALSE",
+		pq.Array(workspaceIDs),
+	)
+}
+
+// ftsMatchClause builds an "OR ..." full-text predicate against the
+// idx_notes_content_text_lang expression index. Each language gets its own
+// branch with a constant tsquery so the planner can use the index; a single
+// plainto_tsquery(n.search_language, ...) would be evaluated per row instead.
+// textArg is the placeholder index of the search text; config names are
+// appended to args.
+func ftsMatchClause(languages []string, textArg int, args *[]interface{}) string {
+	if len(languages) == 0 {
+		return ""
+	}
+	branches := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		*args = append(*args, lang)
+		idx := len(*args)
+		branches = append(branches, fmt.Sprintf(
+			"(n.search_language = $%d::regconfig AND to_tsvector(n.search_language, n.content_text) @@ plainto_tsquery($%d::regconfig, $%d))",
+			idx, idx, textArg,
+		))
+	}
+	return "OR " + strings.Join(branches, "\n\t\t\t\tOR ")
+}
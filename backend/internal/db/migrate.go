@@ -1,38 +1,169 @@
 package db
 
 import (
-    "fmt"
-    "os"
+    "context"
+    "database/sql"
+    "errors"
+    "io/fs"
+    "log"
+    "strconv"
+    "strings"
 
     "github.com/golang-migrate/migrate/v4"
-    _ "github.com/lib/pq"
-    _ "github.com/golang-migrate/migrate/v4/source/file"
-    _ "github.com/golang-migrate/migrate/v4/database/postgres"
+    "github.com/golang-migrate/migrate/v4/database/postgres"
+    "github.com/golang-migrate/migrate/v4/database/sqlite"
+    "github.com/golang-migrate/migrate/v4/source/iofs"
+    "github.com/lib/pq"
+
+    "go-notes/backend/internal/migrations"
 )
 
-func RunMigrations() error {
-    dbHost := os.Getenv("DB_HOST")
-    dbPort := os.Getenv("DB_PORT")
-    dbUser := os.Getenv("DB_USER")
-    dbPassword := os.Getenv("DB_PASSWORD")
-    dbName := os.Getenv("DB_NAME")
+// migrationLockID is the advisory lock held while migrating, so replicas
+// starting together apply each migration once
+const migrationLockID = 0x676f6e6f746573 // "gonotes"
 
-    dbURL := fmt.Sprintf(
-        "postgres://%s:%s@%s:%s/%s?sslmode=disable",
-        dbUser, dbPassword, dbHost, dbPort, dbName,
-    )
+// WithMigrator runs fn with a migrator for the embedded migrations, using
+// the same connection settings as Connect. A Postgres advisory lock is held
+// throughout; other callers wait for it.
+func WithMigrator(fn func(m *migrate.Migrate) error) error {
+    if Driver() == DriverSQLite {
+        return withSQLiteMigrator(fn)
+    }
+    database, err := Connect()
+    if err != nil {
+        return err
+    }
+    defer database.Close() // ends the session, releasing the lock on any error path
 
-    m, err := migrate.New(
-        "file://internal/migrations",
-        dbURL,
-    )
+    ctx := context.Background()
+    conn, err := database.Conn(ctx)
     if err != nil {
         return err
     }
+    var locked bool
+    if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLockID).Scan(&locked); err != nil {
+        conn.Close()
+        return err
+    }
+    if !locked {
+        log.Printf("[INFO] Waiting for another instance to finish migrating")
+        if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+            conn.Close()
+            return err
+        }
+    }
 
-    // Run migrations up; ignore ErrNoChange
-    if err := m.Up(); err != nil && err.Error() != "no change" {
+    driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+    if err != nil {
+        conn.Close()
+        return err
+    }
+    source, err := iofs.New(migrations.FS, ".")
+    if err != nil {
+        driver.Close()
+        return err
+    }
+    m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+    if err != nil {
+        driver.Close()
+        return err
+    }
+    defer m.Close()
+    defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+    return fn(m)
+}
+
+// withSQLiteMigrator runs fn with a migrator for the SQLite migrations. Each
+// migration runs in a transaction, which SQLite's file lock serialises.
+func withSQLiteMigrator(fn func(m *migrate.Migrate) error) error {
+    // The driver closes the pool it is given, so it gets its own
+    database, err := openSQLite()
+    if err != nil {
+        return err
+    }
+    driver, err := sqlite.WithInstance(database, &sqlite.Config{})
+    if err != nil {
+        database.Close()
+        return err
+    }
+    source, err := iofs.New(migrations.SQLiteFS, "sqlite")
+    if err != nil {
+        driver.Close()
+        return err
+    }
+    m, err := migrate.NewWithInstance("iofs", source, DriverSQLite, driver)
+    if err != nil {
+        driver.Close()
         return err
     }
-    return nil
+    defer m.Close()
+    return fn(m)
+}
+
+// RunMigrations applies all pending migrations
+func RunMigrations() error {
+    return WithMigrator(func(m *migrate.Migrate) error {
+        if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+            return err
+        }
+        return nil
+    })
+}
+
+// MigrationStatus is the schema version recorded in the database and the
+// newest version this binary ships
+type MigrationStatus struct {
+    Version uint `json:"version"` // 0 before the first migration
+    Dirty   bool `json:"dirty"`   // a migration failed part way; see `go-notes migrate force`
+    Latest  uint `json:"latest"`
+    Pending bool `json:"pending"`
+}
+
+// GetMigrationStatus reads the state golang-migrate keeps in schema_migrations
+func GetMigrationStatus(db *sql.DB) (*MigrationStatus, error) {
+    latest, err := LatestMigration()
+    if err != nil {
+        return nil, err
+    }
+    s := &MigrationStatus{Latest: latest}
+    var version int64
+    err = db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &s.Dirty)
+    var pqErr *pq.Error
+    switch {
+    case errors.Is(err, sql.ErrNoRows):
+    case errors.As(err, &pqErr) && pqErr.Code == "42P01": // undefined_table: never migrated
+    case err != nil && strings.Contains(err.Error(), "no such table"): // SQLite, never migrated
+    case err != nil:
+        return nil, err
+    default:
+        s.Version = uint(version)
+    }
+    s.Pending = s.Version < s.Latest
+    return s, nil
+}
+
+// LatestMigration returns the highest embedded migration version for the
+// configured driver
+func LatestMigration() (uint, error) {
+    var entries []fs.DirEntry
+    var err error
+    if Driver() == DriverSQLite {
+        entries, err = fs.ReadDir(migrations.SQLiteFS, "sqlite")
+    } else {
+        entries, err = fs.ReadDir(migrations.FS, ".")
+    }
+    if err != nil {
+        return 0, err
+    }
+    var latest uint
+    for _, e := range entries {
+        prefix, _, ok := strings.Cut(e.Name(), "_")
+        if !ok {
+            continue
+        }
+        if v, err := strconv.ParseUint(prefix, 10, 64); err == nil && uint(v) > latest {
+            latest = uint(v)
+        }
+    }
+    return latest, nil
 }
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/migrations"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// iofs parses every file name, rejecting duplicates and malformed names
+	source, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+	defer source.Close()
+
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, names)
+	last := names[len(names)-1]
+	latest, err := LatestMigration()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(last, fmt.Sprintf("%03d_", latest)), "latest %d, last file %s", latest, last)
+}
+
+func TestConnStringSharesSSLMode(t *testing.T) {
+	vars := map[string]string{"DB_PASSWORD": "p@ss/word", "DB_SSLMODE": "verify-full", "DB_SSLROOTCERT": "/certs/ca.pem"}
+	orig := env
+	env = func(key string) string { return vars[key] }
+	t.Cleanup(func() { env = orig })
+
+	u, err := url.Parse(ConnString())
+	require.NoError(t, err)
+	password, _ := u.User.Password()
+	assert.Equal(t, "p@ss/word", password)
+	assert.Equal(t, "db:5432", u.Host)
+	assert.Equal(t, "/notesdb", u.Path)
+	assert.Equal(t, "verify-full", u.Query().Get("sslmode"))
+	assert.Equal(t, "/certs/ca.pem", u.Query().Get("sslrootcert"))
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	vars := map[string]string{"DB_DRIVER": DriverSQLite, "DB_PATH": filepath.Join(t.TempDir(), "notes.db")}
+	orig := env
+	env = func(key string) string { return vars[key] }
+	t.Cleanup(func() { env = orig })
+
+	// A version names the same change on both drivers; SQLite skips some
+	source, err := iofs.New(migrations.SQLiteFS, "sqlite")
+	require.NoError(t, err)
+	defer source.Close()
+	sqliteNames, err := fs.Glob(migrations.SQLiteFS, "sqlite/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, sqliteNames)
+	for _, name := range sqliteNames {
+		_, err := fs.Stat(migrations.FS, strings.TrimPrefix(name, "sqlite/"))
+		assert.NoError(t, err, "%s has no PostgreSQL counterpart", name)
+	}
+
+	database, err := Connect()
+	require.NoError(t, err)
+	defer database.Close()
+
+	status, err := GetMigrationStatus(database)
+	require.NoError(t, err)
+	assert.Zero(t, status.Version)
+	assert.True(t, status.Pending)
+
+	require.NoError(t, RunMigrations())
+	status, err = GetMigrationStatus(database)
+	require.NoError(t, err)
+	assert.Equal(t, status.Latest, status.Version)
+	assert.False(t, status.Pending)
+
+	require.NoError(t, WithMigrator(func(m *migrate.Migrate) error { return m.Down() }))
+	status, err = GetMigrationStatus(database)
+	require.NoError(t, err)
+	assert.Zero(t, status.Version)
+}
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for a cursor that does not decode or was issued
+// for a different sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// noteSortColumns maps a sort name to its SQL expression and the type its
+// cursor value is cast back to
+var noteSortColumns = map[string]struct{ expr, cast string }{
+	"created": {"n.created_at", "timestamp"},
+	"updated": {"n.updated_at", "timestamp"},
+	"title":   {"LOWER(n.title)", "text"},
+	"color":   {"COALESCE(n.color, '')", "text"},
+}
+
+// NoteListOptions filters, sorts and pages a workspace note listing
+type NoteListOptions struct {
+	FolderID  *int
+	Trashed   *bool  // nil lists trashed and live notes together
+	Tag       string // tag name, case-insensitive
+	CreatedBy *int
+	Sort      string // created (default), updated, title or color
+	Desc      bool
+	Limit     int    // 0 means no limit
+	Cursor    string // NextCursor of the previous page
+}
+
+// NotePage is one page of a note listing; NextCursor is empty on the last page
+type NotePage struct {
+	Notes      []Note `json:"notes"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// noteCursor is the position after the last note of a page
+type noteCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+func encodeNoteCursor(c noteCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeNoteCursor(s string) (noteCursor, error) {
+	var c noteCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// IsValidNoteSort reports whether sort names a supported sort column
+func IsValidNoteSort(sort string) bool {
+	_, ok := noteSortColumns[sort]
+	return sort == "" || ok
+}
+
+// ListNotesPage lists a workspace's notes in one query using keyset pagination
+// on (sort column, id), then batch-loads their tags
+func (s *Store) ListNotesPage(ctx context.Context, workspaceID int, opts NoteListOptions) (*NotePage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "created"
+	}
+	col, ok := noteSortColumns[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+
+	conds := []string{"n.workspace_id = $1"}
+	args := []interface{}{workspaceID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.FolderID != nil {
+		conds = append(conds, "n.folder_id = "+arg(*opts.FolderID))
+	}
+	if opts.Trashed != nil {
+		conds = append(conds, "n.is_trashed = "+arg(*opts.Trashed))
+	}
+	if opts.Tag != "" {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE nt.note_id = n.id AND LOWER(t.name) = LOWER(`+arg(opts.Tag)+`))`)
+	}
+	if opts.CreatedBy != nil {
+		conds = append(conds, "n.created_by = "+arg(*opts.CreatedBy))
+	}
+
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if opts.Cursor != "" {
+		c, err := decodeNoteCursor(opts.Cursor)
+		if err != nil || c.Sort != opts.Sort {
+			return nil, ErrInvalidCursor
+		}
+		conds = append(conds, fmt.Sprintf("(%s, n.id) %s (%s::%s, %s)", col.expr, cmp, arg(c.Key), col.cast, arg(c.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT n.id, n.workspace_id, n.title, n.yjs_room_id, n.folder_id, n.created_by, n.created_at, n.updated_at,
+		       n.is_trashed, n.trashed_at, n.color, n.search_language::text, n.search_language_inherited, (%s)::text
+		FROM notes n
+		WHERE %s
+		ORDER BY %s %s, n.id %s`, col.expr, strings.Join(conds, " AND "), col.expr, dir, dir)
+	if opts.Limit > 0 {
+		// One extra row tells us whether there is a next page
+		query += " LIMIT " + arg(opts.Limit+1)
+	}
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &NotePage{Notes: []Note{}}
+	var keys []string
+	for rows.Next() {
+		var n Note
+		var key string
+		if err := rows.Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt,
+			&n.IsTrashed, &n.TrashedAt, &n.Color, &n.SearchLanguage, &n.SearchLanguageInherited, &key); err != nil {
+			return nil, err
+		}
+		page.Notes = append(page.Notes, n)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Limit > 0 && len(page.Notes) > opts.Limit {
+		page.Notes = page.Notes[:opts.Limit]
+		last := page.Notes[opts.Limit-1]
+		page.NextCursor = encodeNoteCursor(noteCursor{Sort: opts.Sort, Key: keys[opts.Limit-1], ID: last.ID})
+	}
+
+	if err := s.AttachTags(ctx, page.Notes); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteCursorRoundTrip(t *testing.T) {
+	want := noteCursor{Sort: "updated", Key: "2024-05-01 10:11:12.123456", ID: 42}
+
+	got, err := decodeNoteCursor(encodeNoteCursor(want))
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestDecodeNoteCursorRejectsGarbage(t *testing.T) {
+	_, err := decodeNoteCursor("not a cursor!")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestListNotesPageRejectsUnknownSort(t *testing.T) {
+	assert.False(t, IsValidNoteSort("size"))
+	assert.True(t, IsValidNoteSort(""))
+
+	_, err := NewStore(nil).ListNotesPage(context.Background(), 1, NoteListOptions{Sort: "size"})
+	assert.Error(t, err)
+}
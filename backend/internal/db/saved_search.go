@@ -0,0 +1,159 @@
+package db
+
+import "context"
+
+// --- Saved Searches / Smart Folders ---
+
+// SavedSearch is a named query evaluated on demand, presented as a smart folder.
+// WorkspaceID nil means private to the owner; otherwise it is shared with the
+// workspace's members and evaluated within that workspace only.
+type SavedSearch struct {
+	ID          int    `json:"id"`
+	OwnerID     int    `json:"owner_id"`
+	WorkspaceID *int   `json:"workspace_id"`
+	Name        string `json:"name"`
+	Query       string `json:"query"`
+	Mode        string `json:"mode"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// SavedSearchCount is the live number of notes matching a saved search
+type SavedSearchCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (s *Store) CreateSavedSearch(ctx context.Context, ownerID int, workspaceID *int, name, query, mode string) (int, error) {
+	var id int
+	err := s.q.QueryRowContext(ctx,
+		"INSERT INTO saved_searches (owner_id, workspace_id, name, query, mode) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		ownerID, workspaceID, name, query, mode,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) GetSavedSearch(ctx context.Context, id int) (*SavedSearch, error) {
+	var ss SavedSearch
+	err := s.q.QueryRowContext(ctx,
+		"SELECT id, owner_id, workspace_id, name, query, mode, created_at, updated_at FROM saved_searches WHERE id = $1", id,
+	).Scan(&ss.ID, &ss.OwnerID, &ss.WorkspaceID, &ss.Name, &ss.Query, &ss.Mode, &ss.CreatedAt, &ss.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// ListSavedSearches returns the user's private searches plus those shared
+// with any workspace the user belongs to, the ones CanViewSavedSearch
+// allows; a search shared with a workspace its owner has left is not
+// listed
+func (s *Store) ListSavedSearches(ctx context.Context, userID int) ([]SavedSearch, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT s.id, s.owner_id, s.workspace_id, s.name, s.query, s.mode, s.created_at, s.updated_at
+		FROM saved_searches s
+		WHERE (s.workspace_id IS NULL AND s.owner_id = $1)
+		OR s.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+		ORDER BY LOWER(s.name), s.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	searches := []SavedSearch{}
+	for rows.Next() {
+		var ss SavedSearch
+		if err := rows.Scan(&ss.ID, &ss.OwnerID, &ss.WorkspaceID, &ss.Name, &ss.Query, &ss.Mode, &ss.CreatedAt, &ss.UpdatedAt); err == nil {
+			searches = append(searches, ss)
+		}
+	}
+	return searches, nil
+}
+
+func (s *Store) UpdateSavedSearch(ctx context.Context, id int, workspaceID *int, name, query, mode string) error {
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE saved_searches SET workspace_id=$1, name=$2, query=$3, mode=$4, updated_at=CURRENT_TIMESTAMP WHERE id=$5",
+		workspaceID, name, query, mode, id,
+	)
+	return err
+}
+
+func (s *Store) DeleteSavedSearch(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM saved_searches WHERE id=$1", id)
+	return err
+}
+
+// CanViewSavedSearch reports whether the user may evaluate a search: a
+// shared search needs current membership of its workspace, even for the
+// owner, and a private one is the owner's alone
+func (s *Store) CanViewSavedSearch(ctx context.Context, ss *SavedSearch, userID int) (bool, error) {
+	if ss.WorkspaceID != nil {
+		return s.IsWorkspaceMember(ctx, *ss.WorkspaceID, userID)
+	}
+	return ss.OwnerID == userID, nil
+}
+
+// savedSearchScope returns the workspaces a saved search is evaluated
+// against: those of memberIDs, narrowed to the shared workspace if any
+func savedSearchScope(ss *SavedSearch, memberIDs []int) []int {
+	if ss.WorkspaceID == nil {
+		return memberIDs
+	}
+	for _, id := range memberIDs {
+		if id == *ss.WorkspaceID {
+			return []int{id}
+		}
+	}
+	return []int{}
+}
+
+// SavedSearchNotes evaluates a saved search for the user, returning the
+// smart folder's current contents with tags loaded
+func (s *Store) SavedSearchNotes(ctx context.Context, ss *SavedSearch, userID int) ([]Note, error) {
+	memberIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.searchNotesIn(ctx, savedSearchScope(ss, memberIDs), ParseSearchQuery(ss.Query), ss.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Batch load tags for all notes (prevents N+1 queries)
+	if len(notes) > 0 {
+		noteIDs := make([]int, len(notes))
+		for i, note := range notes {
+			noteIDs[i] = note.ID
+		}
+		tagMap, err := batchLoadTags(ctx, s.q, noteIDs)
+		if err == nil {
+			for i := range notes {
+				notes[i].Tags = tagMap[notes[i].ID]
+			}
+		}
+	}
+	return notes, nil
+}
+
+// CountSavedSearches returns live match counts for every saved search visible to the user
+func (s *Store) CountSavedSearches(ctx context.Context, userID int) ([]SavedSearchCount, error) {
+	searches, err := s.ListSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]SavedSearchCount, 0, len(searches))
+	for _, ss := range searches {
+		count, err := s.countNotesIn(ctx, savedSearchScope(&ss, memberIDs), ParseSearchQuery(ss.Query), ss.Mode)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, SavedSearchCount{ID: ss.ID, Name: ss.Name, Count: count})
+	}
+	return counts, nil
+}
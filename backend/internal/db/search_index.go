@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// IndexableNote carries everything an external search index needs about a note
+type IndexableNote struct {
+	Note
+	ContentText  string    `json:"content_text"`
+	Author       string    `json:"author"`
+	UpdatedAtRaw time.Time `json:"-"`
+}
+
+// ListIndexableNotes loads notes for indexing. A nil noteIDs loads every note.
+func (s *Store) ListIndexableNotes(ctx context.Context, noteIDs []int) ([]IndexableNote, error) {
+	if noteIDs == nil {
+		return s.queryIndexableNotes(ctx, "TRUE")
+	}
+	return s.queryIndexableNotes(ctx, "n.id = ANY($1)", pq.Array(noteIDs))
+}
+
+// ListWorkspaceIndexableNotes loads every note in a workspace for indexing
+func (s *Store) ListWorkspaceIndexableNotes(ctx context.Context, workspaceID int) ([]IndexableNote, error) {
+	return s.queryIndexableNotes(ctx, "n.workspace_id = $1", workspaceID)
+}
+
+func (s *Store) queryIndexableNotes(ctx context.Context, where string, args ...interface{}) ([]IndexableNote, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT n.id, n.workspace_id, n.title, n.yjs_room_id, n.folder_id, n.created_by, n.created_at, n.updated_at,
+		       n.is_trashed, n.trashed_at, n.color, COALESCE(n.content_text, ''), COALESCE(u.username, '')
+		FROM notes n
+		LEFT JOIN users u ON u.id = n.created_by
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []IndexableNote
+	for rows.Next() {
+		var n IndexableNote
+		if err := rows.Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAtRaw,
+			&n.IsTrashed, &n.TrashedAt, &n.Color, &n.ContentText, &n.Author); err != nil {
+			return nil, err
+		}
+		n.UpdatedAt = n.UpdatedAtRaw.Format(time.RFC3339Nano)
+		notes = append(notes, n)
+	}
+
+	if len(notes) > 0 {
+		noteIDs := make([]int, len(notes))
+		for i, note := range notes {
+			noteIDs[i] = note.ID
+		}
+		tagMap, err := batchLoadTags(ctx, s.q, noteIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range notes {
+			notes[i].Tags = tagMap[notes[i].ID]
+		}
+	}
+	return notes, rows.Err()
+}
+
+// ListNoteIDs returns the IDs of every note, trashed or not
+func (s *Store) ListNoteIDs(ctx context.Context) ([]int, error) {
+	return s.scanInts(ctx, "SELECT id FROM notes")
+}
+
+// GetVisibleNotes loads non-trashed notes by ID, in the given order, skipping any
+// that no longer exist or are outside workspaceIDs. Used to hydrate hits from an
+// external index, which may briefly lag behind the database.
+func (s *Store) GetVisibleNotes(ctx context.Context, noteIDs []int, workspaceIDs []int) ([]Note, error) {
+	if len(noteIDs) == 0 || len(workspaceIDs) == 0 {
+		return []Note{}, nil
+	}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, workspace_id, title, yjs_room_id, folder_id, created_by, created_at, updated_at,
+		       is_trashed, trashed_at, color, search_language::text, search_language_inherited
+		FROM notes
+		WHERE id = ANY($1) AND workspace_id = ANY($2) AND is_trashed = FALSE
+	`, pq.Array(noteIDs), pq.Array(workspaceIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]Note, len(noteIDs))
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt,
+			&n.IsTrashed, &n.TrashedAt, &n.Color, &n.SearchLanguage, &n.SearchLanguageInherited); err == nil {
+			byID[n.ID] = n
+		}
+	}
+
+	notes := make([]Note, 0, len(byID))
+	ids := make([]int, 0, len(byID))
+	for _, id := range noteIDs {
+		if n, ok := byID[id]; ok {
+			notes = append(notes, n)
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		tagMap, err := batchLoadTags(ctx, s.q, ids)
+		if err == nil {
+			for i := range notes {
+				notes[i].Tags = tagMap[notes[i].ID]
+			}
+		}
+	}
+	return notes, nil
+}
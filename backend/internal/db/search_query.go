@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchQuery is a search string split into free text and field filters.
+//
+// Supported filters (values may be double-quoted to include spaces):
+//
+//	tag:NAME          note has the tag (repeatable, all must match)
+//	workspace:ID      note is in the workspace (alias ws:ID)
+//	folder:ID         note is directly in the folder
+//	author:USERNAME   note was created by the user
+//	color:#RRGGBB     note has the color
+//	after:YYYY-MM-DD  note was updated on or after the date
+//	before:YYYY-MM-DD note was updated before the date
+//
+// Anything else is free text, matched as in SearchNotes.
+type SearchQuery struct {
+	Text          string     `json:"text,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	WorkspaceID   *int       `json:"workspace_id,omitempty"`
+	FolderID      *int       `json:"folder_id,omitempty"`
+	Author        string     `json:"author,omitempty"`
+	Color         string     `json:"color,omitempty"`
+	UpdatedAfter  *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+}
+
+// IsEmpty reports whether the query has neither text nor filters
+func (q SearchQuery) IsEmpty() bool {
+	return q.Text == "" && len(q.Tags) == 0 && q.WorkspaceID == nil && q.FolderID == nil &&
+		q.Author == "" && q.Color == "" && q.UpdatedAfter == nil && q.UpdatedBefore == nil
+}
+
+// ParseSearchQuery splits a raw search string into text and filters.
+// Malformed filter values are kept as plain text rather than rejected.
+func ParseSearchQuery(raw string) SearchQuery {
+	var q SearchQuery
+	var text []string
+
+	for _, token := range tokenizeQuery(raw) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || value == "" {
+			text = append(text, unquote(token))
+			continue
+		}
+		value = unquote(value)
+
+		handled := true
+		switch strings.ToLower(key) {
+		case "tag":
+			q.Tags = append(q.Tags, value)
+		case "workspace", "ws":
+			if id, err := strconv.Atoi(value); err == nil {
+				q.WorkspaceID = &id
+			} else {
+				handled = false
+			}
+		case "folder":
+			if id, err := strconv.Atoi(value); err == nil {
+				q.FolderID = &id
+			} else {
+				handled = false
+			}
+		case "author":
+			q.Author = value
+		case "color":
+			q.Color = value
+		case "after":
+			if t, err := time.Parse("2006-01-02", value); err == nil {
+				q.UpdatedAfter = &t
+			} else {
+				handled = false
+			}
+		case "before":
+			if t, err := time.Parse("2006-01-02", value); err == nil {
+				q.UpdatedBefore = &t
+			} else {
+				handled = false
+			}
+		default:
+			handled = false
+		}
+		if !handled {
+			text = append(text, unquote(token))
+		}
+	}
+
+	q.Text = strings.Join(text, " ")
+	return q
+}
+
+// tokenizeQuery splits on whitespace, keeping double-quoted runs together
+func tokenizeQuery(raw string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t' || r == '\n') && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func unquote(s string) string {
+	return strings.ReplaceAll(s, `"`, "")
+}
+
+// searchConditions translates a parsed query into a WHERE clause over "notes n".
+// args must already hold the workspace ID array as $1; further values are appended.
+func (s *Store) searchConditions(ctx context.Context, workspaceIDs []int, q SearchQuery, mode string, args *[]interface{}) (string, error) {
+	conditions := []string{"n.workspace_id = ANY($1)", "n.is_trashed = FALSE"}
+	next := func(v interface{}) int {
+		*args = append(*args, v)
+		return len(*args)
+	}
+
+	for _, tag := range q.Tags {
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND LOWER(t.name) = LOWER($%d))",
+			next(tag)))
+	}
+	if q.WorkspaceID != nil {
+		conditions = append(conditions, fmt.Sprintf("n.workspace_id = $%d", next(*q.WorkspaceID)))
+	}
+	if q.FolderID != nil {
+		conditions = append(conditions, fmt.Sprintf("n.folder_id = $%d", next(*q.FolderID)))
+	}
+	if q.Author != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			"n.created_by = (SELECT id FROM users WHERE LOWER(username) = LOWER($%d))", next(q.Author)))
+	}
+	if q.Color != "" {
+		conditions = append(conditions, fmt.Sprintf("LOWER(n.color) = LOWER($%d)", next(q.Color)))
+	}
+	if q.UpdatedAfter != nil {
+		conditions = append(conditions, fmt.Sprintf("n.updated_at >= $%d", next(*q.UpdatedAfter)))
+	}
+	if q.UpdatedBefore != nil {
+		conditions = append(conditions, fmt.Sprintf("n.updated_at < $%d", next(*q.UpdatedBefore)))
+	}
+
+	if q.Text != "" {
+		likeArg := next("%" + strings.ToLower(q.Text) + "%")
+		textMatch := fmt.Sprintf(`LOWER(n.title) LIKE $%d
+			OR EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND LOWER(t.name) LIKE $%d)`,
+			likeArg, likeArg)
+		if mode == "full" {
+			languages, err := s.searchLanguagesInUse(ctx, workspaceIDs)
+			if err != nil {
+				return "", err
+			}
+			textArg := next(q.Text)
+			textMatch += "\n\t\t\t" + ftsMatchClause(languages, textArg, args)
+		}
+		conditions = append(conditions, "("+textMatch+")")
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
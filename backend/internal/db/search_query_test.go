@@ -0,0 +1,39 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q := ParseSearchQuery(`weekly tag:work tag:"project x" folder:12 ws:3 author:alice color:#FF0000 after:2024-01-31 sync`)
+
+	assert.Equal(t, "weekly sync", q.Text)
+	assert.Equal(t, []string{"work", "project x"}, q.Tags)
+	if assert.NotNil(t, q.FolderID) {
+		assert.Equal(t, 12, *q.FolderID)
+	}
+	if assert.NotNil(t, q.WorkspaceID) {
+		assert.Equal(t, 3, *q.WorkspaceID)
+	}
+	assert.Equal(t, "alice", q.Author)
+	assert.Equal(t, "#FF0000", q.Color)
+	if assert.NotNil(t, q.UpdatedAfter) {
+		assert.Equal(t, "2024-01-31", q.UpdatedAfter.Format("2006-01-02"))
+	}
+	assert.Nil(t, q.UpdatedBefore)
+}
+
+func TestParseSearchQueryKeepsMalformedFiltersAsText(t *testing.T) {
+	q := ParseSearchQuery(`folder:abc "project meeting" http://example.com before:yesterday`)
+
+	assert.Equal(t, "folder:abc project meeting http://example.com before:yesterday", q.Text)
+	assert.Nil(t, q.FolderID)
+	assert.Nil(t, q.UpdatedBefore)
+}
+
+func TestParseSearchQueryEmpty(t *testing.T) {
+	assert.True(t, ParseSearchQuery("   ").IsEmpty())
+	assert.False(t, ParseSearchQuery("tag:work").IsEmpty())
+}
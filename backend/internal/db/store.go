@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is the query interface shared by *sql.DB, *sql.Tx and *sql.Conn
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Store runs the data layer's queries. Every method takes the caller's
+// context, so a cancelled request or an expired deadline stops its queries.
+// Compound operations run in a transaction via WithTx.
+type Store struct {
+	db *sql.DB
+	q  DBTX     // db, or the transaction this store is bound to
+	tx *txState // nil outside a transaction
+}
+
+type txState struct {
+	afterCommit []func()
+}
+
+// NewStore returns a store using the connection pool
+func NewStore(database *sql.DB) *Store {
+	return &Store{db: database, q: database}
+}
+
+// DB returns the connection pool, for code that still takes a *sql.DB
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// WithTx runs fn with a store bound to a new transaction, committing when fn
+// returns nil and rolling back otherwise. On a store that is already in a
+// transaction fn joins it, so compound operations can call each other.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	return s.withTxOptions(ctx, nil, fn)
+}
+
+// withTxOptions is WithTx with a choice of isolation level. A store already
+// in a transaction keeps that transaction's level.
+func (s *Store) withTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(tx *Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	state := &txState{}
+	if err := fn(&Store{db: s.db, q: tx, tx: state}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range state.afterCommit {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit defers side effects outside the database, such as calls to
+// the document service, until the surrounding transaction has committed.
+// Outside a transaction fn runs immediately.
+func (s *Store) afterCommit(fn func()) {
+	if s.tx == nil {
+		fn()
+		return
+	}
+	s.tx.afterCommit = append(s.tx.afterCommit, fn)
+}
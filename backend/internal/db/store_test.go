@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAfterCommitOutsideTransactionRunsImmediately(t *testing.T) {
+	ran := false
+	NewStore(nil).afterCommit(func() { ran = true })
+	assert.True(t, ran)
+}
+
+func TestWithTxJoinsOpenTransaction(t *testing.T) {
+	// A store bound to a transaction never begins another one, so this
+	// needs no database
+	outer := &Store{tx: &txState{}}
+	ran := false
+	err := outer.WithTx(context.Background(), func(tx *Store) error {
+		assert.Same(t, outer, tx)
+		tx.afterCommit(func() { ran = true })
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, ran, "hooks wait for the outermost commit")
+	assert.Len(t, outer.tx.afterCommit, 1)
+
+	failure := errors.New("boom")
+	assert.ErrorIs(t, outer.WithTx(context.Background(), func(*Store) error { return failure }), failure)
+}
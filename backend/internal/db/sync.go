@@ -0,0 +1,428 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// ErrSyncCursorExpired means changes after the cursor were pruned; the client
+// must resync from scratch
+var ErrSyncCursorExpired = errors.New("sync cursor expired")
+
+// SyncRef identifies a workspace-scoped entity
+type SyncRef struct {
+	WorkspaceID int `json:"workspace_id"`
+	ID          int `json:"id"`
+}
+
+// SyncTag is a tag used by at least one note in a workspace
+type SyncTag struct {
+	WorkspaceID int `json:"workspace_id"`
+	Tag
+}
+
+// SyncDeleted lists tombstones. Workspaces are those the user can no longer
+// see (deleted or membership removed); clients drop everything in them.
+type SyncDeleted struct {
+	Notes      []int             `json:"notes"`
+	Folders    []int             `json:"folders"`
+	Tags       []SyncRef         `json:"tags"`
+	Members    []WorkspaceMember `json:"members"`
+	Workspaces []int             `json:"workspaces"`
+}
+
+// SyncChanges is the current state of everything that changed since a cursor.
+// Clients apply Deleted first, then upsert the rest, and pass Cursor next time.
+// Full is set when no cursor was given and the response holds every visible
+// entity, so local state should be replaced rather than merged.
+type SyncChanges struct {
+	Cursor     string            `json:"cursor"`
+	Full       bool              `json:"full"`
+	Workspaces []Workspace       `json:"workspaces"`
+	Members    []WorkspaceMember `json:"members"`
+	Folders    []Folder          `json:"folders"`
+	Notes      []Note            `json:"notes"`
+	Tags       []SyncTag         `json:"tags"`
+	Deleted    SyncDeleted       `json:"deleted"`
+}
+
+// GetSyncChanges returns changes visible to userID since the given cursor
+// ("" for a full sync). Everything is read from one snapshot, and the new
+// cursor is that snapshot's oldest running transaction, so changes committed
+// concurrently are picked up by the next call rather than skipped.
+func (s *Store) GetSyncChanges(ctx context.Context, userID int, since string) (*SyncChanges, error) {
+	var sinceXid uint64
+	if since != "" {
+		var err error
+		if sinceXid, err = strconv.ParseUint(since, 10, 64); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	var res *SyncChanges
+	err := s.withTxOptions(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, func(tx *Store) error {
+		var err error
+		res, err = tx.syncChanges(ctx, userID, since, sinceXid)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// syncChanges reads the changes for GetSyncChanges within its snapshot
+func (s *Store) syncChanges(ctx context.Context, userID int, since string, sinceXid uint64) (*SyncChanges, error) {
+	res := &SyncChanges{
+		Full:       since == "",
+		Workspaces: []Workspace{},
+		Members:    []WorkspaceMember{},
+		Folders:    []Folder{},
+		Notes:      []Note{},
+		Tags:       []SyncTag{},
+		Deleted: SyncDeleted{
+			Notes: []int{}, Folders: []int{}, Tags: []SyncRef{}, Members: []WorkspaceMember{}, Workspaces: []int{},
+		},
+	}
+	if err := s.q.QueryRowContext(ctx, "SELECT pg_snapshot_xmin(pg_current_snapshot())::text").Scan(&res.Cursor); err != nil {
+		return nil, err
+	}
+	if since != "" {
+		var expired bool
+		if err := s.q.QueryRowContext(ctx, "SELECT $1::xid8 <= txid FROM sync_horizon WHERE id = 1", since).Scan(&expired); err != nil {
+			return nil, err
+		}
+		if expired {
+			return nil, ErrSyncCursorExpired
+		}
+		if cur, _ := strconv.ParseUint(res.Cursor, 10, 64); sinceXid > cur {
+			// A cursor never moves backwards
+			res.Cursor = since
+		}
+	}
+
+	memberIDs, err := s.scanInts(ctx, "SELECT workspace_id FROM workspace_members WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[int]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		member[id] = true
+	}
+
+	// Workspaces that are sent whole: all of them on a full sync, or ones the
+	// user joined since the cursor
+	full := make(map[int]bool)
+	if since == "" {
+		full = member
+	}
+	var noteIDs, folderIDs, workspaceIDs []int
+	var tagRefs, memberRefs []SyncRef
+	var deletedNotes, deletedFolders []int
+
+	if since != "" {
+		rows, err := s.q.QueryContext(ctx, `
+			SELECT DISTINCT ON (entity, entity_id, workspace_id) entity, entity_id, workspace_id, deleted
+			FROM sync_changes
+			WHERE txid >= $1::xid8 AND txid < $2::xid8
+			  AND (workspace_id = ANY($3) OR (entity = 'member' AND entity_id = $4))
+			ORDER BY entity, entity_id, workspace_id, id DESC
+		`, since, res.Cursor, pq.Array(memberIDs), userID)
+		if err != nil {
+			return nil, err
+		}
+		type change struct {
+			entity  string
+			id, ws  int
+			deleted bool
+		}
+		var changes []change
+		for rows.Next() {
+			var ch change
+			if err := rows.Scan(&ch.entity, &ch.id, &ch.ws, &ch.deleted); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			changes = append(changes, ch)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, ch := range changes {
+			if ch.entity == "member" && ch.id == userID {
+				if !member[ch.ws] {
+					res.Deleted.Workspaces = append(res.Deleted.Workspaces, ch.ws)
+				} else if !ch.deleted {
+					full[ch.ws] = true
+				}
+			}
+		}
+		for _, ch := range changes {
+			if full[ch.ws] || !member[ch.ws] {
+				continue
+			}
+			switch ch.entity {
+			case "note":
+				if ch.deleted {
+					deletedNotes = append(deletedNotes, ch.id)
+				} else {
+					noteIDs = append(noteIDs, ch.id)
+				}
+			case "folder":
+				if ch.deleted {
+					deletedFolders = append(deletedFolders, ch.id)
+				} else {
+					folderIDs = append(folderIDs, ch.id)
+				}
+			case "tag":
+				if ch.deleted {
+					res.Deleted.Tags = append(res.Deleted.Tags, SyncRef{WorkspaceID: ch.ws, ID: ch.id})
+				} else {
+					tagRefs = append(tagRefs, SyncRef{WorkspaceID: ch.ws, ID: ch.id})
+				}
+			case "member":
+				if ch.deleted {
+					res.Deleted.Members = append(res.Deleted.Members, WorkspaceMember{WorkspaceID: ch.ws, UserID: ch.id})
+				} else {
+					memberRefs = append(memberRefs, SyncRef{WorkspaceID: ch.ws, ID: ch.id})
+				}
+			case "workspace":
+				workspaceIDs = append(workspaceIDs, ch.ws)
+			}
+		}
+	}
+
+	fullIDs := make([]int, 0, len(full))
+	for id := range full {
+		fullIDs = append(fullIDs, id)
+	}
+	workspaceIDs = append(workspaceIDs, fullIDs...)
+
+	if err := s.loadSyncPayload(ctx, res, memberIDs, fullIDs, workspaceIDs, noteIDs, folderIDs, tagRefs, memberRefs); err != nil {
+		return nil, err
+	}
+
+	// A note or folder that moved out of one workspace and into another the
+	// user can see is an upsert, not a delete
+	res.Deleted.Notes = withoutIDs(deletedNotes, noteIDsOf(res.Notes))
+	res.Deleted.Folders = withoutIDs(deletedFolders, folderIDsOf(res.Folders))
+
+	return res, nil
+}
+
+func (s *Store) loadSyncPayload(ctx context.Context, res *SyncChanges, memberIDs, fullIDs, workspaceIDs, noteIDs, folderIDs []int, tagRefs, memberRefs []SyncRef) error {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT id, name, owner_id, created_at, search_language::text
+		FROM workspaces WHERE id = ANY($1) AND id = ANY($2) ORDER BY id
+	`, pq.Array(workspaceIDs), pq.Array(memberIDs))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var w Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage); err != nil {
+			rows.Close()
+			return err
+		}
+		res.Workspaces = append(res.Workspaces, w)
+	}
+	rows.Close()
+
+	memberWs, memberUsers := splitRefs(memberRefs)
+	rows, err = s.q.QueryContext(ctx, `
+		SELECT workspace_id, user_id, role FROM workspace_members
+		WHERE workspace_id = ANY($1)
+		   OR (workspace_id, user_id) IN (SELECT * FROM unnest($2::int[], $3::int[]))
+		ORDER BY workspace_id, user_id
+	`, pq.Array(fullIDs), pq.Array(memberWs), pq.Array(memberUsers))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var m WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role); err != nil {
+			rows.Close()
+			return err
+		}
+		res.Members = append(res.Members, m)
+	}
+	rows.Close()
+
+	rows, err = s.q.QueryContext(ctx, `
+		SELECT id, workspace_id, parent_id, name, created_at FROM folders
+		WHERE workspace_id = ANY($1) AND (workspace_id = ANY($2) OR id = ANY($3))
+		ORDER BY id
+	`, pq.Array(memberIDs), pq.Array(fullIDs), pq.Array(folderIDs))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var f Folder
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		res.Folders = append(res.Folders, f)
+	}
+	rows.Close()
+
+	rows, err = s.q.QueryContext(ctx, `
+		SELECT id, workspace_id, title, yjs_room_id, folder_id, created_by, created_at, updated_at,
+		       is_trashed, trashed_at, color, search_language::text, search_language_inherited
+		FROM notes
+		WHERE workspace_id = ANY($1) AND (workspace_id = ANY($2) OR id = ANY($3))
+		ORDER BY id
+	`, pq.Array(memberIDs), pq.Array(fullIDs), pq.Array(noteIDs))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt,
+			&n.IsTrashed, &n.TrashedAt, &n.Color, &n.SearchLanguage, &n.SearchLanguageInherited); err != nil {
+			rows.Close()
+			return err
+		}
+		res.Notes = append(res.Notes, n)
+	}
+	rows.Close()
+	if len(res.Notes) > 0 {
+		tagMap, err := batchLoadTags(ctx, s.q, noteIDsOf(res.Notes))
+		if err != nil {
+			return err
+		}
+		for i := range res.Notes {
+			res.Notes[i].Tags = tagMap[res.Notes[i].ID]
+		}
+	}
+
+	tagWs, tagIDs := splitRefs(tagRefs)
+	rows, err = s.q.QueryContext(ctx, `
+		SELECT DISTINCT n.workspace_id, t.id, t.name
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE n.workspace_id = ANY($1)
+		  AND (n.workspace_id = ANY($2)
+		       OR (n.workspace_id, t.id) IN (SELECT * FROM unnest($3::int[], $4::int[])))
+		ORDER BY n.workspace_id, t.id
+	`, pq.Array(memberIDs), pq.Array(fullIDs), pq.Array(tagWs), pq.Array(tagIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t SyncTag
+		if err := rows.Scan(&t.WorkspaceID, &t.ID, &t.Name); err != nil {
+			return err
+		}
+		res.Tags = append(res.Tags, t)
+	}
+	return rows.Err()
+}
+
+// PruneSyncChanges drops change rows superseded by a newer change to the same
+// entity, then expires rows older than retentionDays. Cursors from before the
+// expired rows get ErrSyncCursorExpired.
+func (s *Store) PruneSyncChanges(ctx context.Context, retentionDays int) error {
+	_, err := s.q.ExecContext(ctx, `
+		DELETE FROM sync_changes c
+		USING sync_changes newer
+		WHERE newer.entity = c.entity AND newer.entity_id = c.entity_id
+		  AND newer.workspace_id = c.workspace_id AND newer.id > c.id
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = s.q.ExecContext(ctx, fmt.Sprintf(`
+		WITH expired AS (
+			DELETE FROM sync_changes WHERE changed_at < (NOW() - INTERVAL '%d days') RETURNING txid
+		)
+		UPDATE sync_horizon
+		SET txid = GREATEST(txid, (SELECT txid FROM expired ORDER BY txid DESC LIMIT 1))
+		WHERE id = 1 AND EXISTS (SELECT 1 FROM expired)
+	`, retentionDays))
+	return err
+}
+
+// scanInts runs a query selecting one integer column
+func (s *Store) scanInts(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIntRows(rows)
+}
+
+// queryStrings runs a query selecting one text column
+func (s *Store) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := scanStrings(rows)
+	if out == nil {
+		out = []string{}
+	}
+	return out, err
+}
+
+func scanIntRows(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func splitRefs(refs []SyncRef) (workspaceIDs, ids []int) {
+	workspaceIDs, ids = []int{}, []int{}
+	for _, r := range refs {
+		workspaceIDs = append(workspaceIDs, r.WorkspaceID)
+		ids = append(ids, r.ID)
+	}
+	return workspaceIDs, ids
+}
+
+func noteIDsOf(notes []Note) []int {
+	ids := make([]int, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func folderIDsOf(folders []Folder) []int {
+	ids := make([]int, len(folders))
+	for i, f := range folders {
+		ids[i] = f.ID
+	}
+	return ids
+}
+
+// withoutIDs returns ids minus any in exclude, never nil
+func withoutIDs(ids, exclude []int) []int {
+	skip := make(map[int]bool, len(exclude))
+	for _, id := range exclude {
+		skip[id] = true
+	}
+	out := []int{}
+	for _, id := range ids {
+		if !skip[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
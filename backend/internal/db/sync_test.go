@@ -0,0 +1,18 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSyncChangesRejectsMalformedCursor(t *testing.T) {
+	_, err := NewStore(nil).GetSyncChanges(context.Background(), 1, "abc")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestWithoutIDs(t *testing.T) {
+	assert.Equal(t, []int{1, 3}, withoutIDs([]int{1, 2, 3}, []int{2, 4}))
+	assert.Equal(t, []int{}, withoutIDs(nil, []int{1}))
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FuzzyThreshold is the minimum trigram similarity for a fuzzy match.
+// pg_trgm defaults to 0.3 for similarity and 0.6 for word similarity;
+// the latter is too strict to catch transposed letters in short words.
+const FuzzyThreshold = 0.3
+
+// minVocabularyWord is the shortest word offered as a correction
+const minVocabularyWord = 3
+
+// maxSuggestionsPerTerm caps the alternatives offered for one misspelled word
+const maxSuggestionsPerTerm = 3
+
+// words splits lowercased text on anything but letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns the trigram set of text as pg_trgm builds it: each word
+// is padded with two spaces in front and one behind
+func trigrams(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range words(text) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Similarity is pg_trgm's similarity(): the share of trigrams two strings
+// have in common
+func Similarity(a, b string) float64 {
+	return jaccard(trigrams(a), trigrams(b))
+}
+
+// WordSimilarity approximates pg_trgm's word_similarity(): the best
+// Similarity between query and a run of consecutive words of text no longer
+// than the query
+func WordSimilarity(query, text string) float64 {
+	q := trigrams(query)
+	n := len(words(query))
+	textWords := words(text)
+	best := 0.0
+	for i := range textWords {
+		for j := i + 1; j <= len(textWords) && j-i <= n; j++ {
+			if sim := jaccard(q, trigrams(strings.Join(textWords[i:j], " "))); sim > best {
+				best = sim
+			}
+		}
+	}
+	return best
+}
+
+// AddVocabulary adds the words of text long enough to be suggested
+func AddVocabulary(vocabulary map[string]bool, text string) {
+	for _, w := range words(text) {
+		if len([]rune(w)) >= minVocabularyWord {
+			vocabulary[w] = true
+		}
+	}
+}
+
+// SuggestTerms builds "did you mean" corrections for a lowercased query from
+// a vocabulary, as the PostgreSQL search does with pg_trgm
+func SuggestTerms(query string, vocabulary map[string]bool) (string, []string) {
+	terms := strings.Fields(query)
+	known := make(map[string]bool)
+	candidates := make(map[string][]string)
+	for _, term := range terms {
+		if vocabulary[term] {
+			known[term] = true
+			continue
+		}
+		type match struct {
+			word  string
+			score float64
+		}
+		var matches []match
+		for word := range vocabulary {
+			if score := Similarity(word, term); score >= FuzzyThreshold {
+				matches = append(matches, match{word, score})
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].score != matches[j].score {
+				return matches[i].score > matches[j].score
+			}
+			return matches[i].word < matches[j].word
+		})
+		for _, m := range matches {
+			candidates[term] = append(candidates[term], m.word)
+		}
+	}
+	return corrections(terms, known, candidates)
+}
+
+// corrections replaces each unknown term with its best candidate. known
+// holds terms found in the vocabulary; candidates are ordered best first.
+func corrections(terms []string, known map[string]bool, candidates map[string][]string) (string, []string) {
+	corrected := make([]string, len(terms))
+	suggestions := []string{}
+	changed := false
+	for i, term := range terms {
+		corrected[i] = term
+		if known[term] || len(candidates[term]) == 0 {
+			continue
+		}
+		corrected[i] = candidates[term][0]
+		changed = true
+		for j, word := range candidates[term] {
+			if j >= maxSuggestionsPerTerm {
+				break
+			}
+			suggestions = append(suggestions, word)
+		}
+	}
+
+	if !changed {
+		return "", suggestions
+	}
+	return strings.Join(corrected, " "), suggestions
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("Meeting", "meeting"))
+	// "  m", " me", "mee", "eet" shared out of 12 distinct trigrams
+	assert.InDelta(t, 4.0/12, Similarity("meeting", "meetnig"), 1e-9)
+	assert.Equal(t, 0.0, Similarity("meeting", ""))
+}
+
+func TestWordSimilarityMatchesWordsWithinText(t *testing.T) {
+	assert.Equal(t, 1.0, WordSimilarity("meeting", "Weekly team meeting, notes"))
+	assert.GreaterOrEqual(t, WordSimilarity("meetnig", "Weekly team meeting, notes"), FuzzyThreshold)
+	assert.Less(t, WordSimilarity("budget", "Weekly team meeting, notes"), FuzzyThreshold)
+}
+
+func TestSuggestTerms(t *testing.T) {
+	vocabulary := map[string]bool{}
+	AddVocabulary(vocabulary, "Weekly team meeting, on a Monday")
+	assert.False(t, vocabulary["on"], "short words are not suggested")
+
+	didYouMean, suggestions := SuggestTerms("weekly meetnig", vocabulary)
+	assert.Equal(t, "weekly meeting", didYouMean)
+	assert.Equal(t, []string{"meeting"}, suggestions)
+
+	didYouMean, suggestions = SuggestTerms("weekly meeting", vocabulary)
+	assert.Empty(t, didYouMean)
+	assert.Empty(t, suggestions)
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Webhooks ---
+
+// Webhook is a workspace subscription that POSTs events to URL. An empty
+// EventTypes subscribes to every event.
+type Webhook struct {
+	ID          int      `json:"id"`
+	WorkspaceID int      `json:"workspace_id"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	EventTypes  []string `json:"event_types"`
+	Active      bool     `json:"active"`
+	CreatedBy   *int     `json:"created_by"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// WebhookDelivery is one queued or attempted delivery of an event. Its
+// WebhookID is 0 once the webhook went with its workspace.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"-"`
+	Status         string     `json:"status"` // pending, delivered, failed
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	ResponseBody   *string    `json:"response_body,omitempty"`
+	Error          *string    `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+
+	// Target of a claimed delivery
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+const webhookColumns = "id, workspace_id, url, secret, event_types, active, created_by, created_at, updated_at"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (*Webhook, error) {
+	var w Webhook
+	err := row.Scan(&w.ID, &w.WorkspaceID, &w.URL, &w.Secret, pq.Array(&w.EventTypes), &w.Active, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	return &w, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, workspaceID int, url, secret string, eventTypes []string, active bool, createdBy int) (int, error) {
+	var id int
+	err := s.q.QueryRowContext(ctx,
+		"INSERT INTO webhooks (workspace_id, url, secret, event_types, active, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		workspaceID, url, secret, pq.Array(eventTypes), active, createdBy,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id int) (*Webhook, error) {
+	return scanWebhook(s.q.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id))
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, workspaceID int) ([]Webhook, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE workspace_id = $1 ORDER BY id", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *w)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *Store) UpdateWebhook(ctx context.Context, id int, url string, eventTypes []string, active bool) error {
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE webhooks SET url=$1, event_types=$2, active=$3, updated_at=CURRENT_TIMESTAMP WHERE id=$4",
+		url, pq.Array(eventTypes), active, id,
+	)
+	return err
+}
+
+// DeleteWebhook removes a webhook with its deliveries, which would
+// otherwise outlive it
+func (s *Store) DeleteWebhook(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, `
+		WITH deliveries AS (DELETE FROM webhook_deliveries WHERE webhook_id = $1)
+		DELETE FROM webhooks WHERE id = $1
+	`, id)
+	return err
+}
+
+// EnqueueWebhookDeliveries queues payload for every active webhook in the
+// workspace subscribed to eventType, returning how many were queued. The
+// deliveries keep the webhook's url and secret, so they still go out if
+// the workspace is deleted next.
+func (s *Store) EnqueueWebhookDeliveries(ctx context.Context, workspaceID int, eventType string, payload []byte) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, url, secret, event_type, payload)
+		SELECT id, url, secret, $2, $3::jsonb FROM webhooks
+		WHERE workspace_id = $1 AND active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`, workspaceID, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// EnqueueWebhookDelivery queues payload for one webhook regardless of its
+// subscriptions (pings and manual redeliveries)
+func (s *Store) EnqueueWebhookDelivery(ctx context.Context, webhookID int, eventType string, payload []byte) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, url, secret, event_type, payload)
+		 SELECT id, url, secret, $2, $3::jsonb FROM webhooks WHERE id = $1 RETURNING id`,
+		webhookID, eventType, string(payload),
+	).Scan(&id)
+	return id, err
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and leases them for
+// lease, so a crashed worker's claims are retried by someone else later. A
+// delivery goes to its webhook's current url, or to the one it was queued
+// with once the webhook is gone.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1,
+		    last_attempt_at = NOW(),
+		    next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, COALESCE(d.webhook_id, 0), d.event_type, d.payload::text, d.attempts, d.created_at,
+			COALESCE((SELECT url FROM webhooks w WHERE w.id = d.webhook_id), d.url),
+			COALESCE((SELECT secret FROM webhooks w WHERE w.id = d.webhook_id), d.secret)
+	`, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var claimed []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Status = "pending"
+		claimed = append(claimed, d)
+	}
+	return claimed, rows.Err()
+}
+
+// CompleteWebhookDelivery records an attempt. A nil retryAt with a non-empty
+// errMsg marks the delivery failed for good; with retryAt it stays pending.
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id int64, responseStatus int, responseBody, errMsg string, retryAt *time.Time) error {
+	status := "delivered"
+	if errMsg != "" {
+		status = "failed"
+		if retryAt != nil {
+			status = "pending"
+		}
+	}
+	var statusArg interface{}
+	if responseStatus != 0 {
+		statusArg = responseStatus
+	}
+	var errArg interface{}
+	if errMsg != "" {
+		errArg = errMsg
+	}
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, response_status = $3, response_body = $4, error = $5,
+		    next_attempt_at = COALESCE($6, next_attempt_at),
+		    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE NULL END
+		WHERE id = $1
+	`, id, status, statusArg, responseBody, errArg, retryAt)
+	return err
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	row := s.q.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = $1", id)
+	return scanDelivery(row)
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries first
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// PruneWebhookDeliveries drops finished deliveries older than days
+func (s *Store) PruneWebhookDeliveries(ctx context.Context, days int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < NOW() - $1 * INTERVAL '1 day'", days)
+	return err
+}
+
+const deliveryColumns = `id, COALESCE(webhook_id, 0), event_type, payload::text, status, attempts, next_attempt_at, last_attempt_at,
+	response_status, response_body, error, created_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var next time.Time
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &next, &d.LastAttemptAt,
+		&d.ResponseStatus, &d.ResponseBody, &d.Error, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == "pending" {
+		d.NextAttemptAt = &next
+	}
+	return &d, nil
+}
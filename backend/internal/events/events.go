@@ -0,0 +1,273 @@
+// Package events streams workspace metadata changes (note tree, members,
+// tags) to connected clients. Yjs only syncs note bodies; these events let
+// other clients update their tree without refetching.
+//
+// Events are published with pg_notify and received by a LISTEN connection in
+// every backend replica, each of which fans them out to its own subscribers.
+// A local broker, used with SQLite, delivers within the process instead.
+// Index changes travel the same way on a channel of their own, so search
+// indexes kept by each replica see the writes made through the others.
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// channel is the Postgres NOTIFY channel shared by all replicas
+const channel = "gonotes_events"
+
+// maxPayload stays under Postgres' 8000 byte NOTIFY limit; larger events are
+// sent without their data and clients refetch the entity
+const maxPayload = 7900
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// its stream is closed (it reconnects and refetches)
+const subscriberBuffer = 64
+
+// Event types
+const (
+	WorkspaceUpdated      = "workspace.updated"
+	WorkspaceDeleted      = "workspace.deleted"
+	WorkspaceOwnerChanged = "workspace.owner_changed"
+	MemberAdded           = "member.added"
+	MemberRemoved         = "member.removed"
+	FolderCreated         = "folder.created"
+	FolderUpdated         = "folder.updated"
+	FolderMoved           = "folder.moved"
+	FolderDeleted         = "folder.deleted"
+	NoteCreated           = "note.created"
+	NoteUpdated           = "note.updated"
+	NoteMoved             = "note.moved"
+	NoteTagsUpdated       = "note.tags_updated"
+	NoteTrashed           = "note.trashed"
+	NoteRestored          = "note.restored"
+	NoteDeleted           = "note.deleted"
+	TrashEmptied          = "trash.emptied"
+
+	// Resync is sent locally when the LISTEN connection was lost and events
+	// may have been missed; clients should refetch the workspace
+	Resync = "resync"
+)
+
+// Types lists the event types clients and webhooks can receive
+var Types = []string{
+	WorkspaceUpdated, WorkspaceDeleted, WorkspaceOwnerChanged,
+	MemberAdded, MemberRemoved,
+	FolderCreated, FolderUpdated, FolderMoved, FolderDeleted,
+	NoteCreated, NoteUpdated, NoteMoved, NoteTagsUpdated, NoteTrashed, NoteRestored, NoteDeleted,
+	TrashEmptied,
+}
+
+// Event is one change in a workspace
+type Event struct {
+	Type        string      `json:"type"`
+	WorkspaceID int         `json:"workspace_id"`
+	ActorID     int         `json:"actor_id,omitempty"`
+	UserID      int         `json:"user_id,omitempty"` // member affected by member.* events
+	Data        interface{} `json:"data,omitempty"`
+	At          time.Time   `json:"at"`
+}
+
+// Subscription receives the events of one workspace for one user
+type Subscription struct {
+	WorkspaceID int
+	UserID      int
+	C           <-chan Event
+
+	ch     chan Event
+	closed bool
+}
+
+// Broker publishes events and delivers them to local subscribers
+type Broker struct {
+	database *sql.DB
+	listener *pq.Listener // nil for a local broker
+	origin   string       // tells this broker's index changes from the others'
+
+	mu            sync.Mutex
+	subs          map[int]map[*Subscription]struct{}
+	indexWatchers []*indexWatcher
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewBroker starts listening for events on a dedicated connection
+func NewBroker(database *sql.DB, connString string) (*Broker, error) {
+	b := &Broker{
+		database: database,
+		origin:   newOrigin(),
+		subs:     make(map[int]map[*Subscription]struct{}),
+		done:     make(chan struct{}),
+	}
+	b.listener = pq.NewListener(connString, 2*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("[WARN] Event listener: %v", err)
+		}
+	})
+	for _, ch := range []string{channel, indexChannel} {
+		if err := b.listener.Listen(ch); err != nil {
+			b.listener.Close()
+			return nil, err
+		}
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b, nil
+}
+
+// NewLocalBroker returns a broker that delivers events to subscribers in
+// this process only, for single-instance deployments without PostgreSQL
+func NewLocalBroker() *Broker {
+	return &Broker{
+		subs: make(map[int]map[*Subscription]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Publish sends an event to every replica. Call it after the change committed.
+func (b *Broker) Publish(e Event) error {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if b.listener == nil {
+		b.dispatch(e)
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayload {
+		e.Data = nil
+		if payload, err = json.Marshal(e); err != nil {
+			return err
+		}
+	}
+	_, err = b.database.Exec("SELECT pg_notify($1, $2)", channel, string(payload))
+	return err
+}
+
+// Subscribe registers for a workspace's events; call Unsubscribe when done.
+// The channel is closed when the user loses access or falls too far behind.
+func (b *Broker) Subscribe(workspaceID, userID int) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{WorkspaceID: workspaceID, UserID: userID, C: ch, ch: ch}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[workspaceID] == nil {
+		b.subs[workspaceID] = make(map[*Subscription]struct{})
+	}
+	b.subs[workspaceID][s] = struct{}{}
+	return s
+}
+
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(s)
+}
+
+// drop removes and closes a subscription; caller holds b.mu
+func (b *Broker) drop(s *Subscription) {
+	if subs := b.subs[s.WorkspaceID]; subs != nil {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(b.subs, s.WorkspaceID)
+		}
+	}
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func (b *Broker) run() {
+	defer b.wg.Done()
+	for {
+		select {
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// Reconnected after losing the connection
+				b.broadcast(Event{Type: Resync, At: time.Now().UTC()})
+				b.dispatchIndex(IndexChange{Kind: IndexAll})
+				continue
+			}
+			if n.Channel == indexChannel {
+				var c IndexChange
+				if err := json.Unmarshal([]byte(n.Extra), &c); err != nil {
+					log.Printf("[WARN] Dropping malformed index change: %v", err)
+					continue
+				}
+				b.dispatchIndex(c)
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Printf("[WARN] Dropping malformed event: %v", err)
+				continue
+			}
+			b.dispatch(e)
+		case <-time.After(90 * time.Second):
+			go b.listener.Ping()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Broker) dispatch(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[e.WorkspaceID] {
+		b.send(s, e)
+		// The event is the last one a user who lost access gets
+		if e.Type == WorkspaceDeleted || (e.Type == MemberRemoved && e.UserID == s.UserID) {
+			b.drop(s)
+		}
+	}
+}
+
+func (b *Broker) broadcast(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ws, subs := range b.subs {
+		e.WorkspaceID = ws
+		for s := range subs {
+			b.send(s, e)
+		}
+	}
+}
+
+// send delivers without blocking; caller holds b.mu
+func (b *Broker) send(s *Subscription, e Event) {
+	select {
+	case s.ch <- e:
+	default:
+		log.Printf("[WARN] Event subscriber for workspace %d fell behind, closing stream", s.WorkspaceID)
+		b.drop(s)
+	}
+}
+
+// Close stops listening and ends every subscription
+func (b *Broker) Close() error {
+	close(b.done)
+	b.wg.Wait()
+	b.mu.Lock()
+	for _, subs := range b.subs {
+		for s := range subs {
+			b.drop(s)
+		}
+	}
+	b.mu.Unlock()
+	if b.listener == nil {
+		return nil
+	}
+	return b.listener.Close()
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBroker() *Broker {
+	return &Broker{subs: make(map[int]map[*Subscription]struct{})}
+}
+
+func TestDispatchDeliversToWorkspaceSubscribers(t *testing.T) {
+	b := newTestBroker()
+	inWs := b.Subscribe(1, 10)
+	otherWs := b.Subscribe(2, 10)
+
+	b.dispatch(Event{Type: NoteCreated, WorkspaceID: 1})
+
+	assert.Equal(t, NoteCreated, (<-inWs.C).Type)
+	assert.Empty(t, otherWs.C)
+}
+
+func TestMemberRemovedClosesThatUsersStream(t *testing.T) {
+	b := newTestBroker()
+	removed := b.Subscribe(1, 10)
+	remaining := b.Subscribe(1, 11)
+
+	b.dispatch(Event{Type: MemberRemoved, WorkspaceID: 1, UserID: 10})
+
+	e, ok := <-removed.C
+	assert.True(t, ok)
+	assert.Equal(t, MemberRemoved, e.Type)
+	_, ok = <-removed.C
+	assert.False(t, ok, "stream closed after removal")
+
+	assert.Equal(t, MemberRemoved, (<-remaining.C).Type)
+	b.Unsubscribe(remaining)
+	b.Unsubscribe(removed) // already closed, must not panic
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := newTestBroker()
+	s := b.Subscribe(1, 10)
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.dispatch(Event{Type: NoteUpdated, WorkspaceID: 1})
+	}
+
+	count := 0
+	for range s.C {
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count)
+	assert.Empty(t, b.subs)
+}
+
+func TestLocalBrokerPublishesInProcess(t *testing.T) {
+	b := NewLocalBroker()
+	s := b.Subscribe(1, 10)
+
+	assert.NoError(t, b.Publish(Event{Type: FolderCreated, WorkspaceID: 1}))
+	e := <-s.C
+	assert.Equal(t, FolderCreated, e.Type)
+	assert.False(t, e.At.IsZero())
+
+	assert.NoError(t, b.Close())
+	_, ok := <-s.C
+	assert.False(t, ok, "Close ends subscriptions")
+}
+
+func TestIndexChangesReachWatchersOfOtherReplicas(t *testing.T) {
+	b := NewLocalBroker()
+	b.origin = "self"
+	got := make(chan IndexChange, 2)
+	b.WatchIndex(func(c IndexChange) { got <- c })
+
+	b.dispatchIndex(IndexChange{Kind: IndexNote, NoteID: 1, Origin: "self"})
+	b.dispatchIndex(IndexChange{Kind: IndexNote, NoteID: 2, Origin: "other"})
+	b.dispatchIndex(IndexChange{Kind: IndexAll})
+
+	assert.Equal(t, 2, (<-got).NoteID)
+	assert.Equal(t, IndexAll, (<-got).Kind)
+	assert.NoError(t, b.Close())
+	assert.Empty(t, got)
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// indexChannel is the Postgres NOTIFY channel for index changes
+const indexChannel = "gonotes_index"
+
+// Index change kinds
+const (
+	IndexNote      = "note"      // a note's text, tags or state changed
+	IndexRemove    = "remove"    // a note was deleted
+	IndexWorkspace = "workspace" // many notes of a workspace changed
+	IndexAll       = "all"       // rebuild everything
+)
+
+// IndexChange tells the search indexes kept in each replica's memory or on
+// its disk what to refresh after a write elsewhere. Unlike events they are
+// not sent to clients or webhooks.
+type IndexChange struct {
+	Kind        string `json:"kind"`
+	NoteID      int    `json:"note_id,omitempty"`
+	WorkspaceID int    `json:"workspace_id,omitempty"`
+	// Origin is the broker that published the change
+	Origin string `json:"origin,omitempty"`
+}
+
+// indexWatcher queues changes for one WatchIndex callback, so a slow index
+// neither holds up the broker nor loses a change
+type indexWatcher struct {
+	mu      sync.Mutex
+	pending []IndexChange
+	wake    chan struct{}
+}
+
+func (w *indexWatcher) push(c IndexChange) {
+	w.mu.Lock()
+	w.pending = append(w.pending, c)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func newOrigin() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// PublishIndex tells the other replicas about an index change that this one
+// has applied itself. Call it after the change committed.
+func (b *Broker) PublishIndex(c IndexChange) error {
+	if b.listener == nil {
+		return nil
+	}
+	c.Origin = b.origin
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = b.database.Exec("SELECT pg_notify($1, $2)", indexChannel, string(payload))
+	return err
+}
+
+// WatchIndex calls fn with every index change published by another replica,
+// in order, from a goroutine of its own until the broker is closed. When the
+// LISTEN connection was lost fn gets an IndexAll change, since some may have
+// been missed.
+func (b *Broker) WatchIndex(fn func(IndexChange)) {
+	w := &indexWatcher{wake: make(chan struct{}, 1)}
+	b.mu.Lock()
+	b.indexWatchers = append(b.indexWatchers, w)
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			select {
+			case <-w.wake:
+			case <-b.done:
+				return
+			}
+			w.mu.Lock()
+			batch := w.pending
+			w.pending = nil
+			w.mu.Unlock()
+			for _, c := range batch {
+				fn(c)
+			}
+		}
+	}()
+}
+
+// dispatchIndex queues a change for every watcher unless this broker sent it
+func (b *Broker) dispatchIndex(c IndexChange) {
+	if c.Origin != "" && c.Origin == b.origin {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, w := range b.indexWatchers {
+		w.push(c)
+	}
+}
@@ -0,0 +1,187 @@
+// Package imaging prepares uploaded photos and pictures for storage: it
+// strips their metadata, turns them upright according to their EXIF
+// orientation and renders smaller copies for responsive display.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrInvalid is returned by Process for content that cannot be read as an
+// image of its type
+var ErrInvalid = errors.New("invalid image")
+
+// Widths are the widths thumbnails are rendered at, narrowest first. An
+// image gets those narrower than itself.
+var Widths = []int{320, 640, 1280, 2048}
+
+// maxPixels bounds the images decoded, since a small upload can declare
+// enormous dimensions. Larger ones are stored with their metadata stripped
+// but for their orientation, which browsers apply, and get no thumbnails.
+const maxPixels = 50_000_000
+
+const (
+	jpegQuality      = 90 // images re-encoded after turning
+	thumbnailQuality = 80
+)
+
+// Image is an image ready for storage
+type Image struct {
+	Data          []byte // without metadata but any orientation left to apply
+	Width, Height int    // as displayed
+	Thumbnails    []Thumbnail
+}
+
+// Thumbnail is a smaller copy of an image, in the same format
+type Thumbnail struct {
+	Width int
+	Data  []byte
+}
+
+// Supported reports whether Process handles a MIME type. Other images, such
+// as GIFs whose animation a thumbnail would lose, are stored as uploaded.
+func Supported(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/png"
+}
+
+// Process strips an image's metadata, applies its orientation and renders
+// its thumbnails. JPEG metadata is removed without re-encoding unless the
+// image has to be turned.
+func Process(data []byte, mimeType string) (*Image, error) {
+	var (
+		stripped    []byte
+		orientation int
+		err         error
+	)
+	switch mimeType {
+	case "image/jpeg":
+		stripped, orientation, err = stripJPEG(data)
+	case "image/png":
+		stripped, orientation, err = stripPNG(data)
+	default:
+		return nil, fmt.Errorf("imaging: unsupported type %s", mimeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	out := &Image{Data: stripped, Width: cfg.Width, Height: cfg.Height}
+	if cfg.Width*cfg.Height > maxPixels {
+		if orientation > 1 && orientation <= 8 {
+			out.Data = withOrientation(stripped, mimeType, orientation)
+			if orientation >= 5 {
+				out.Width, out.Height = cfg.Height, cfg.Width
+			}
+		}
+		return out, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if orientation > 1 && orientation <= 8 {
+		img = orient(img, orientation)
+		if out.Data, err = encode(img, mimeType, jpegQuality); err != nil {
+			return nil, err
+		}
+		out.Width, out.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+	for _, w := range Rendered(out.Width) {
+		h := max(1, (out.Height*w+out.Width/2)/out.Width)
+		thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, img.Bounds(), draw.Src, nil)
+		data, err := encode(thumb, mimeType, thumbnailQuality)
+		if err != nil {
+			return nil, err
+		}
+		out.Thumbnails = append(out.Thumbnails, Thumbnail{Width: w, Data: data})
+	}
+	return out, nil
+}
+
+// Rendered returns the thumbnail widths of an image of a width
+func Rendered(width int) []int {
+	var widths []int
+	for _, w := range Widths {
+		if w < width {
+			widths = append(widths, w)
+		}
+	}
+	return widths
+}
+
+// Fit returns the narrowest thumbnail of an image of a width that is at
+// least want pixels wide, or 0 when only the image itself is
+func Fit(want, width int) int {
+	for _, w := range Rendered(width) {
+		if w >= want {
+			return w
+		}
+	}
+	return 0
+}
+
+func encode(img image.Image, mimeType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if mimeType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	return buf.Bytes(), err
+}
+
+// orient returns an image turned and flipped as EXIF orientation 2 to 8
+// asks for display
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	// at maps a pixel of the result to the source pixel shown there
+	var at func(x, y int) (int, int)
+	dw, dh := w, h
+	switch orientation {
+	case 2: // mirrored
+		at = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // upside down
+		at = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // upside down and mirrored
+		at = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		dw, dh = h, w
+		at = func(x, y int) (int, int) { return y, x }
+	case 6: // needs a quarter turn clockwise
+		dw, dh = h, w
+		at = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // transversed
+		dw, dh = h, w
+		at = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // needs a quarter turn anticlockwise
+		dw, dh = h, w
+		at = func(x, y int) (int, int) { return w - 1 - y, x }
+	default:
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := at(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], rgba.Pix[rgba.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
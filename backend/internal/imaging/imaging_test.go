@@ -0,0 +1,211 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exif builds big-endian EXIF data with an orientation tag, followed by a
+// string standing in for location data
+func exif(orientation int) []byte {
+	var b bytes.Buffer
+	b.WriteString("MM\x00\x2a\x00\x00\x00\x08")
+	binary.Write(&b, binary.BigEndian, []uint16{1, 0x0112, 3})
+	binary.Write(&b, binary.BigEndian, []uint32{1, uint32(orientation) << 16, 0})
+	b.WriteString("GPS 51.5N 0.1W")
+	return b.Bytes()
+}
+
+// segment builds a JPEG segment
+func segment(marker byte, payload string) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// chunk builds a PNG chunk
+func chunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(append(c, typ...), data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+// halves is an image red on the left and blue on the right
+func halves(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= w/2 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+// photo inserts camera metadata after a JPEG's start and a second picture
+// after its end
+func photo(plain []byte, orientation int) []byte {
+	var b bytes.Buffer
+	b.Write(plain[:2])
+	b.Write(segment(0xE1, "Exif\x00\x00"+string(exif(orientation))))
+	b.Write(segment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))
+	b.Write(segment(0xFE, "Shot on a phone"))
+	b.Write(plain[2:])
+	b.Write(plain)
+	return b.Bytes()
+}
+
+func decode(t *testing.T, data []byte) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	return img
+}
+
+func TestProcessStripsJPEGMetadata(t *testing.T) {
+	plain := encodeJPEG(t, halves(40, 20))
+	img, err := Process(photo(plain, 1), "image/jpeg")
+	require.NoError(t, err)
+	assert.Equal(t, plain, img.Data, "upright images are not re-encoded")
+	assert.Equal(t, 40, img.Width)
+	assert.Equal(t, 20, img.Height)
+	assert.Empty(t, img.Thumbnails)
+
+	img, err = Process(photo(plain, 6), "image/jpeg")
+	require.NoError(t, err)
+	assert.NotContains(t, string(img.Data), "GPS")
+	assert.NotContains(t, string(img.Data), "xmpmeta")
+	assert.Equal(t, 20, img.Width)
+	assert.Equal(t, 40, img.Height)
+	upright := decode(t, img.Data)
+	assert.Equal(t, image.Rect(0, 0, 20, 40), upright.Bounds())
+	r, _, b, _ := upright.At(10, 5).RGBA()
+	assert.Greater(t, r, b, "the left of the stored image is the top")
+	r, _, b, _ = upright.At(10, 35).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, halves(40, 20)))
+	plain := buf.Bytes()
+	var b bytes.Buffer
+	b.Write(plain[:33]) // signature and IHDR
+	b.Write(chunk("tEXt", []byte("Comment\x00GPS 51.5N 0.1W")))
+	b.Write(chunk("eXIf", exif(3)))
+	b.Write(plain[33:])
+
+	img, err := Process(b.Bytes(), "image/png")
+	require.NoError(t, err)
+	assert.NotContains(t, string(img.Data), "GPS")
+	upright := decode(t, img.Data)
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, color.RGBAModel.Convert(upright.At(0, 0)), "turned upside down")
+}
+
+func TestProcessThumbnails(t *testing.T) {
+	img, err := Process(encodeJPEG(t, halves(1000, 500)), "image/jpeg")
+	require.NoError(t, err)
+	require.Len(t, img.Thumbnails, 2)
+	for i, w := range []int{320, 640} {
+		assert.Equal(t, w, img.Thumbnails[i].Width)
+		assert.Equal(t, image.Rect(0, 0, w, w/2), decode(t, img.Thumbnails[i].Data).Bounds())
+	}
+}
+
+func TestProcessKeepsOrientationOfHugeImages(t *testing.T) {
+	// A 12000x9000 photo, too large to decode: only its header is read, so
+	// a small image declaring that size stands in for it
+	plain := encodeJPEG(t, halves(40, 20))
+	sof := bytes.Index(plain, []byte{0xFF, 0xC0})
+	require.Positive(t, sof)
+	binary.BigEndian.PutUint16(plain[sof+5:], 9000)
+	binary.BigEndian.PutUint16(plain[sof+7:], 12000)
+
+	img, err := Process(photo(plain, 6), "image/jpeg")
+	require.NoError(t, err)
+	assert.NotContains(t, string(img.Data), "GPS")
+	assert.NotContains(t, string(img.Data), "xmpmeta")
+	assert.Equal(t, 9000, img.Width, "as displayed")
+	assert.Equal(t, 12000, img.Height)
+	assert.Empty(t, img.Thumbnails)
+	stripped, orientation, err := stripJPEG(img.Data)
+	require.NoError(t, err)
+	assert.Equal(t, 6, orientation, "left for browsers to apply")
+	assert.Equal(t, plain, stripped)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, halves(40, 20)))
+	huge := buf.Bytes()
+	binary.BigEndian.PutUint32(huge[16:], 12000)
+	binary.BigEndian.PutUint32(huge[20:], 9000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	var b bytes.Buffer
+	b.Write(huge[:33])
+	b.Write(chunk("eXIf", exif(8)))
+	b.Write(huge[33:])
+	img, err = Process(b.Bytes(), "image/png")
+	require.NoError(t, err)
+	assert.NotContains(t, string(img.Data), "GPS")
+	assert.Equal(t, 9000, img.Width)
+	_, orientation, err = stripPNG(img.Data)
+	require.NoError(t, err)
+	assert.Equal(t, 8, orientation)
+	_, err = png.DecodeConfig(bytes.NewReader(img.Data))
+	assert.NoError(t, err, "chunks keep valid checksums")
+}
+
+func TestProcessRejectsDamagedImages(t *testing.T) {
+	plain := encodeJPEG(t, halves(40, 20))
+	for _, data := range [][]byte{plain[:len(plain)/2], []byte("GIF89a"), plain[:3]} {
+		_, err := Process(data, "image/jpeg")
+		assert.ErrorIs(t, err, ErrInvalid)
+	}
+	_, err := Process([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png")
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	marked := color.RGBA{255, 255, 255, 255}
+	src.Set(0, 0, marked)
+	// where the top left pixel of the stored image is displayed
+	corners := map[int]image.Point{
+		1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1},
+		5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2},
+	}
+	for orientation, p := range corners {
+		dst := orient(src, orientation)
+		if orientation >= 5 {
+			assert.Equal(t, image.Rect(0, 0, 2, 3), dst.Bounds(), orientation)
+		} else {
+			assert.Equal(t, image.Rect(0, 0, 3, 2), dst.Bounds(), orientation)
+		}
+		assert.Equal(t, marked, dst.At(p.X, p.Y), orientation)
+	}
+}
+
+func TestFit(t *testing.T) {
+	assert.Equal(t, []int{320, 640, 1280, 2048}, Rendered(4000))
+	assert.Empty(t, Rendered(320))
+	assert.Equal(t, 640, Fit(500, 4000))
+	assert.Equal(t, 320, Fit(1, 4000))
+	assert.Equal(t, 0, Fit(3000, 4000), "wider than every thumbnail")
+	assert.Equal(t, 0, Fit(100, 300), "narrower than the smallest thumbnail")
+}
@@ -0,0 +1,177 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var errTruncated = errors.New("truncated image")
+
+// stripJPEG copies a JPEG without its EXIF, XMP, IPTC and vendor segments,
+// comments or anything after the end of the image, where phones append
+// further pictures. JFIF, ICC profile and Adobe segments are kept, since
+// they affect how the image decodes. It also returns the EXIF orientation,
+// 0 when there is none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errors.New("not a JPEG")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 0
+	for i := 2; ; {
+		if i+1 >= len(data) {
+			return nil, 0, errTruncated
+		}
+		if data[i] != 0xFF {
+			return nil, 0, errors.New("JPEG marker expected")
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xD9: // end of image
+			return append(out, 0xFF, 0xD9), orientation, nil
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7: // no payload
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, errTruncated
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, 0, errTruncated
+		}
+		payload := data[i+4 : end]
+		if marker == 0xE1 && orientation == 0 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			orientation = exifOrientation(payload[6:])
+		}
+		if keepJPEGSegment(marker, payload) {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+		if marker == 0xDA {
+			// Entropy-coded data runs to the next marker; 0xFF is escaped
+			// as 0xFF00 within it and restart markers belong to it
+			j := i
+			for ; j+1 < len(data); j++ {
+				if data[j] == 0xFF && data[j+1] != 0x00 && (data[j+1] < 0xD0 || data[j+1] > 0xD7) {
+					break
+				}
+			}
+			out = append(out, data[i:j]...)
+			i = j
+		}
+	}
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xE0:
+		return bytes.HasPrefix(payload, []byte("JFIF\x00"))
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= 0xE0 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG copies a PNG without its EXIF, text and time chunks or anything
+// after its end, returning its EXIF orientation as stripJPEG does
+func stripPNG(data []byte) ([]byte, int, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, 0, errors.New("not a PNG")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	orientation := 0
+	for i := len(pngSignature); ; {
+		if i+12 > len(data) {
+			return nil, 0, errTruncated
+		}
+		n := binary.BigEndian.Uint32(data[i:])
+		if n > uint32(len(data)-i-12) {
+			return nil, 0, errTruncated
+		}
+		end := i + 12 + int(n)
+		switch string(data[i+4 : i+8]) {
+		case "eXIf":
+			orientation = exifOrientation(data[i+8 : end-4])
+		case "tEXt", "zTXt", "iTXt", "tIME":
+		case "IEND":
+			return append(out, data[i:end]...), orientation, nil
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// exifOrientation reads the orientation tag of the first image of EXIF
+// data, a TIFF structure, returning 0 when it has none
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < entries; k++ {
+		e := ifd + 2 + 12*k
+		if e+12 > len(tiff) {
+			return 0
+		}
+		const orientationTag, shortType = 0x0112, 3
+		if order.Uint16(tiff[e:]) == orientationTag && order.Uint16(tiff[e+2:]) == shortType {
+			return int(order.Uint16(tiff[e+8:]))
+		}
+	}
+	return 0
+}
+
+// withOrientation adds EXIF data holding nothing but an orientation to a
+// stripped JPEG or PNG
+func withOrientation(data []byte, mimeType string, orientation int) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	for _, v := range []uint16{1, 0x0112, 3, 0, 1, uint16(orientation), 0, 0, 0} {
+		tiff = binary.BigEndian.AppendUint16(tiff, v)
+	}
+	var out []byte
+	if mimeType == "image/png" {
+		// eXIf goes after IHDR, the first chunk
+		ihdr := len(pngSignature) + 25
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+		chunk = append(append(chunk, "eXIf"...), tiff...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+		out = append(out, data[:ihdr]...)
+		out = append(out, chunk...)
+		return append(out, data[ihdr:]...)
+	}
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+6+len(tiff)))
+	segment = append(append(segment, "Exif\x00\x00"...), tiff...)
+	out = append(out, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// FormatError is an upload that is not in the format being read. Notes
+// read before the problem was found have already been added.
+type FormatError struct {
+	Source string
+	Err    error
+}
+
+func (e *FormatError) Error() string { return e.Source + ": " + e.Err.Error() }
+
+func (e *FormatError) Unwrap() error { return e.Err }
+
+// enexNote is a note element of an Evernote export
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data struct {
+		Encoding string `xml:"encoding,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"data"`
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// enexTimeLayout is the timestamp format of Evernote exports
+const enexTimeLayout = "20060102T150405Z"
+
+// ReadENEX reads an Evernote export (.enex), one notebook, passing each
+// note to add as soon as it is read so that large exports are never held
+// whole. Notes go in a folder named after the file, keep their tags and
+// timestamps, and have their ENML content converted to a Delta. Every
+// resource becomes an attachment of its note, shown in the content as an
+// image or a link to the file; encrypted text is left out with a warning
+// on the note. An error from add stops the read
+// and is returned as is; a malformed export is a *FormatError.
+func ReadENEX(r io.Reader, name string, add func(Note) error) error {
+	notebook := strings.TrimSpace(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+	d := xml.NewDecoder(r)
+	d.Entity = xml.HTMLEntity
+
+	exported, count := false, 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &FormatError{Source: name, Err: fmt.Errorf("after %d notes: %w", count, err)}
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "en-export":
+			exported = true
+		case "note":
+			if !exported {
+				return &FormatError{Source: name, Err: errors.New("not an Evernote export")}
+			}
+			var n enexNote
+			if err := d.DecodeElement(&n, &start); err != nil {
+				return &FormatError{Source: name, Err: fmt.Errorf("note %d: %w", count+1, err)}
+			}
+			count++
+			note := n.note(fmt.Sprintf("%s #%d", name, count))
+			if notebook != "" {
+				note.Folder = []string{notebook}
+			}
+			if err := add(note); err != nil {
+				return err
+			}
+		}
+	}
+	if !exported {
+		return &FormatError{Source: name, Err: errors.New("not an Evernote export")}
+	}
+	return nil
+}
+
+// note converts an exported note
+func (n *enexNote) note(source string) Note {
+	note := Note{Source: source, Title: strings.TrimSpace(n.Title)}
+	if note.Title == "" {
+		note.Title = "Untitled"
+	}
+	for _, t := range n.Tags {
+		if t = strings.TrimSpace(t); t != "" {
+			note.Tags = append(note.Tags, t)
+		}
+	}
+	note.CreatedAt = enexTime(&note, "created", n.Created)
+	note.UpdatedAt = enexTime(&note, "updated", n.Updated)
+
+	resources := map[string]resource{}
+	for _, r := range n.Resources {
+		if enc := strings.TrimSpace(r.Data.Encoding); enc != "" && enc != "base64" {
+			note.warn("an attachment in %s encoding was not imported", enc)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(r.Data.Value), ""))
+		if err != nil {
+			note.warn("the attachment %s could not be decoded: %v", r.FileName, err)
+			continue
+		}
+		sum := md5.Sum(data)
+		hash := hex.EncodeToString(sum[:])
+		if _, ok := resources[hash]; ok {
+			continue
+		}
+		res := resource{mime: strings.TrimSpace(r.Mime), fileName: resourceName(r.FileName, r.Mime), file: len(note.Files)}
+		resources[hash] = res
+		note.Files = append(note.Files, File{Name: res.fileName, read: func() ([]byte, error) { return data, nil }})
+	}
+	note.Content = enmlToDelta(n.Content, resources, &note)
+	return note
+}
+
+// resourceName is a resource's file name, or one made up from its type
+func resourceName(name, mimeType string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	name = "attachment"
+	if exts, _ := mime.ExtensionsByType(strings.TrimSpace(mimeType)); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
+
+func enexTime(note *Note, field, s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(enexTimeLayout, s)
+	if err != nil {
+		note.warn("unreadable %s time %q; the import time is used instead", field, s)
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/memstore"
+	"go-notes/backend/internal/quill"
+)
+
+// pngData is an image resource, referred to by its MD5
+var (
+	pngData = []byte("\x89PNG fake image")
+	pngHash = md5Hex(pngData)
+)
+
+func md5Hex(b []byte) string {
+	sum := md5.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func enex(notes ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export4.dtd">
+<en-export export-date="20240101T000000Z" application="Evernote" version="10.60">` + strings.Join(notes, "\n") + `</en-export>`
+}
+
+func readENEX(t *testing.T, src, name string) []Note {
+	t.Helper()
+	var notes []Note
+	require.NoError(t, ReadENEX(strings.NewReader(src), name, func(n Note) error {
+		notes = append(notes, n)
+		return nil
+	}))
+	return notes
+}
+
+func TestENMLToDelta(t *testing.T) {
+	enml := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note>
+  <h2>Plan&nbsp;A</h2>
+  <div>Some <b>bold</b>, <span style="font-style: italic; color: rgb(255, 0, 0);">red</span>
+    and <a href="https://example.com">linked</a> text.</div>
+  <div><br/></div>
+  <ul><li>one<ul><li>nested</li></ul></li><li>two</li></ul>
+  <ol><li><div>first</div></li></ol>
+  <div><en-todo checked="true"/>done</div>
+  <div><en-todo/>todo</div>
+  <div style="-en-codeblock:true"><div>x := 1</div><div>  y := 2</div></div>
+  <pre>a
+b</pre>
+  <blockquote>quoted</blockquote>
+  <table><tr><td>c1</td><td>c2</td></tr></table>
+  <div style="text-align:center">centered <en-media type="image/png" hash="` + pngHash + `"/></div>
+  <en-media type="application/pdf" hash="abc"/>
+  <en-crypt hint="pw">c2VjcmV0</en-crypt>
+</en-note>`
+	note := &Note{}
+	d := enmlToDelta(enml, map[string]resource{pngHash: {mime: "image/png", fileName: "attachment.png"}}, note)
+
+	type line struct {
+		text  string
+		attrs map[string]any
+	}
+	var lines []line
+	var cur strings.Builder
+	for _, op := range d.Ops {
+		switch ins := op.Insert.(type) {
+		case string:
+			parts := strings.Split(ins, "\n")
+			for i, p := range parts {
+				cur.WriteString(p)
+				if i < len(parts)-1 {
+					lines = append(lines, line{cur.String(), op.Attributes})
+					cur.Reset()
+				}
+			}
+		case map[string]any:
+			cur.WriteString("[image]")
+			assert.Equal(t, fileRef(0), ins["image"])
+		}
+	}
+	assert.Equal(t, []line{
+		{"Plan A", map[string]any{"header": 2}},
+		{"Some bold, red and linked text.", nil},
+		{"", nil},
+		{"one", map[string]any{"list": "bullet"}},
+		{"nested", map[string]any{"list": "bullet", "indent": 1}},
+		{"two", map[string]any{"list": "bullet"}},
+		{"first", map[string]any{"list": "ordered"}},
+		{"done", map[string]any{"list": "checked"}},
+		{"todo", map[string]any{"list": "unchecked"}},
+		{"x := 1", map[string]any{"code-block": true}},
+		{"  y := 2", map[string]any{"code-block": true}},
+		{"a", map[string]any{"code-block": true}},
+		{"b", map[string]any{"code-block": true}},
+		{"quoted", map[string]any{"blockquote": true}},
+		{"c1 | c2", nil},
+		{"centered [image]", map[string]any{"align": "center"}},
+	}, lines)
+
+	attrsOf := func(text string) map[string]any {
+		for _, op := range d.Ops {
+			if op.Insert == text {
+				return op.Attributes
+			}
+		}
+		return nil
+	}
+	assert.Equal(t, map[string]any{"bold": true}, attrsOf("bold"))
+	assert.Equal(t, map[string]any{"italic": true, "color": "rgb(255, 0, 0)"}, attrsOf("red"))
+	assert.Equal(t, map[string]any{"link": "https://example.com"}, attrsOf("linked"))
+
+	assert.Equal(t, []string{
+		"tables were imported as text",
+		"an embedded application/pdf file is missing from the export",
+		"encrypted text was not imported",
+	}, note.Warnings)
+}
+
+func TestReadENEX(t *testing.T) {
+	src := enex(`<note>
+  <title>Groceries</title>
+  <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><en-note><div>Milk</div><en-media type="image/png" hash="`+pngHash+`"/><en-media type="application/pdf" hash="`+md5Hex([]byte("%PDF"))+`"/></en-note>]]></content>
+  <created>20190304T050607Z</created>
+  <updated>20200102T030405Z</updated>
+  <tag>home</tag><tag> shopping </tag>
+  <resource>
+    <data encoding="base64">`+wrap(base64.StdEncoding.EncodeToString(pngData))+`</data>
+    <mime>image/png</mime>
+  </resource>
+  <resource>
+    <data encoding="base64">`+base64.StdEncoding.EncodeToString([]byte("%PDF"))+`</data>
+    <mime>application/pdf</mime>
+    <resource-attributes><file-name>receipt.pdf</file-name></resource-attributes>
+  </resource>
+</note>`, `<note><title></title><content><![CDATA[<en-note>Hi</en-note>]]></content><created>yesterday</created></note>`)
+
+	notes := readENEX(t, src, "Personal.enex")
+	require.Len(t, notes, 2)
+	n := notes[0]
+	assert.Equal(t, "Personal.enex #1", n.Source)
+	assert.Equal(t, "Groceries", n.Title)
+	assert.Equal(t, []string{"Personal"}, n.Folder)
+	assert.Equal(t, []string{"home", "shopping"}, n.Tags)
+	assert.Equal(t, time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC), *n.CreatedAt)
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), *n.UpdatedAt)
+	assert.Equal(t, "Milk\nreceipt.pdf", quill.PlainText(n.Content))
+	assert.Equal(t, map[string]any{"image": fileRef(0)}, n.Content.Ops[1].Insert)
+	assert.Equal(t, map[string]any{"link": fileRef(1)}, n.Content.Ops[2].Attributes)
+	assert.Empty(t, n.Warnings)
+	require.Len(t, n.Files, 2)
+	assert.Equal(t, "attachment.png", n.Files[0].Name, "a resource without a name is named after its type")
+	assert.Equal(t, "receipt.pdf", n.Files[1].Name)
+	data, err := n.Files[0].read()
+	require.NoError(t, err)
+	assert.Equal(t, pngData, data)
+
+	assert.Equal(t, "Untitled", notes[1].Title)
+	assert.Nil(t, notes[1].CreatedAt)
+	assert.Equal(t, []string{`unreadable created time "yesterday"; the import time is used instead`}, notes[1].Warnings)
+}
+
+func TestReadENEXErrors(t *testing.T) {
+	var formatErr *FormatError
+	err := ReadENEX(strings.NewReader("<html><body/></html>"), "page.enex", func(Note) error { return nil })
+	require.ErrorAs(t, err, &formatErr)
+	assert.Equal(t, "page.enex: not an Evernote export", err.Error())
+
+	// Notes read before the export breaks off have been added
+	var added int
+	err = ReadENEX(strings.NewReader(`<en-export><note><title>A</title></note><note><title>`), "cut.enex", func(Note) error {
+		added++
+		return nil
+	})
+	require.ErrorAs(t, err, &formatErr)
+	assert.Equal(t, 1, added)
+
+	stop := errors.New("store down")
+	err = ReadENEX(strings.NewReader(enex(`<note><title>A</title></note>`)), "a.enex", func(Note) error { return stop })
+	assert.Same(t, stop, err)
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+
+	stream := NewStream(ctx, newAttachments(store), encoder{}, Target{WorkspaceID: workspaces[0].ID, UserID: alice.ID})
+	updated := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, title := range []string{"One", "Two"} {
+		require.NoError(t, stream.Add(Note{Source: title, Folder: []string{"Notebook"}, Title: title, UpdatedAt: &updated,
+			Tags: []string{"ev"}, Content: quill.FromMarkdown(title + "\n"), Warnings: []string{"w"}}))
+	}
+	stream.Warn("file %s skipped", "x")
+	result := stream.Result()
+	assert.Equal(t, 1, result.Folders)
+	assert.Equal(t, []string{"file x skipped"}, result.Warnings)
+	require.Len(t, result.Notes, 2)
+	assert.Equal(t, []string{"w"}, result.Notes[1].Warnings)
+
+	two, err := store.GetNote(ctx, result.Notes[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, updated.Format(time.RFC3339), two.UpdatedAt)
+	var content quill.Delta
+	require.NoError(t, json.Unmarshal(store.Content(two.ID), &content))
+	assert.Equal(t, "Two", quill.PlainText(content))
+}
+
+// wrap breaks base64 into lines as Evernote does
+func wrap(s string) string {
+	var b strings.Builder
+	for len(s) > 8 {
+		b.WriteString(s[:8] + "\n")
+		s = s[8:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,422 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go-notes/backend/internal/quill"
+)
+
+// resource is a file embedded in an Evernote note, found by the MD5 hash
+// ENML's en-media elements refer to it with
+type resource struct {
+	mime     string
+	fileName string
+	file     int // index in the note's Files
+}
+
+// enmlFrame is an open element and what it contributes to the text and
+// line formats
+type enmlFrame struct {
+	name   string
+	inline map[string]any
+	list   string // "bullet" or "ordered" for ul and ol
+	header int
+	code   bool
+	quote  bool
+	align  string
+}
+
+// enmlBlocks are the elements that start and end lines
+var enmlBlocks = map[string]bool{
+	"en-note": true, "div": true, "p": true, "li": true, "ul": true, "ol": true, "pre": true,
+	"blockquote": true, "table": true, "tr": true, "center": true, "section": true, "article": true,
+	"header": true, "footer": true, "dl": true, "dt": true, "dd": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// enmlSkipped are elements whose content is dropped
+var enmlSkipped = map[string]bool{"head": true, "title": true, "style": true, "script": true, "object": true, "en-crypt": true}
+
+// enmlConverter builds a Delta from ENML, Evernote's XHTML note format
+type enmlConverter struct {
+	ops       []quill.Op
+	stack     []enmlFrame
+	line      bool   // the current line has content
+	todo      string // "checked" or "unchecked" after an en-todo
+	cell      bool   // a table cell was closed on the current line
+	resources map[string]resource
+	note      *Note
+	warned    map[string]bool
+}
+
+// enmlToDelta converts a note's ENML, showing its image resources as
+// images and others as links to the file; encrypted text is left out with
+// a warning on the note
+func enmlToDelta(content string, resources map[string]resource, note *Note) quill.Delta {
+	c := &enmlConverter{resources: resources, note: note, warned: map[string]bool{}}
+	d := xml.NewDecoder(strings.NewReader(content))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			note.warn("the content could not be read completely: %v", err)
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if skip > 0 || enmlSkipped[name] {
+				if name == "en-crypt" && skip == 0 {
+					c.warnOnce("encrypted text was not imported")
+				}
+				skip++
+				continue
+			}
+			c.start(name, t.Attr)
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			c.end(strings.ToLower(t.Name.Local))
+		case xml.CharData:
+			if skip == 0 {
+				c.text(string(t))
+			}
+		}
+	}
+	if c.line {
+		c.endLine()
+	}
+	return quill.Delta{Ops: c.ops}
+}
+
+func (c *enmlConverter) warnOnce(msg string) {
+	if !c.warned[msg] {
+		c.warned[msg] = true
+		c.note.warn("%s", msg)
+	}
+}
+
+func (c *enmlConverter) start(name string, attrs []xml.Attr) {
+	switch name {
+	case "br":
+		c.endLine()
+		return
+	case "hr":
+		if c.line {
+			c.endLine()
+		}
+		return
+	case "img":
+		if src := attr(attrs, "src"); src != "" {
+			c.embed(map[string]any{"image": src})
+		}
+		return
+	case "en-media":
+		c.media(attr(attrs, "hash"), attr(attrs, "type"))
+		return
+	case "en-todo":
+		c.todo = "unchecked"
+		if attr(attrs, "checked") == "true" {
+			c.todo = "checked"
+		}
+		return
+	case "td", "th":
+		if c.cell {
+			c.insert(" | ", nil)
+		}
+		c.warnOnce("tables were imported as text")
+	}
+
+	if enmlBlocks[name] && c.line {
+		c.endLine()
+	}
+	f := enmlFrame{name: name, inline: map[string]any{}}
+	switch name {
+	case "b", "strong":
+		f.inline["bold"] = true
+	case "i", "em":
+		f.inline["italic"] = true
+	case "u", "ins":
+		f.inline["underline"] = true
+	case "s", "strike", "del":
+		f.inline["strike"] = true
+	case "code", "tt", "kbd":
+		f.inline["code"] = true
+	case "sup":
+		f.inline["script"] = "super"
+	case "sub":
+		f.inline["script"] = "sub"
+	case "a":
+		if href := attr(attrs, "href"); href != "" {
+			f.inline["link"] = href
+		}
+	case "font":
+		if color := attr(attrs, "color"); color != "" {
+			f.inline["color"] = color
+		}
+	case "ul":
+		f.list = "bullet"
+	case "ol":
+		f.list = "ordered"
+	case "pre":
+		f.code = true
+	case "blockquote":
+		f.quote = true
+	case "center":
+		f.align = "center"
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		f.header = int(name[1] - '0')
+	}
+	c.applyStyle(&f, attr(attrs, "style"))
+	c.stack = append(c.stack, f)
+}
+
+// applyStyle reads the inline CSS Evernote uses for formatting
+func (c *enmlConverter) applyStyle(f *enmlFrame, style string) {
+	for _, decl := range strings.Split(style, ";") {
+		prop, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.ToLower(strings.TrimSpace(prop))
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		lower := strings.ToLower(value)
+		switch prop {
+		case "font-weight":
+			if n, err := strconv.Atoi(lower); lower == "bold" || lower == "bolder" || (err == nil && n >= 600) {
+				f.inline["bold"] = true
+			}
+		case "font-style":
+			if lower == "italic" || lower == "oblique" {
+				f.inline["italic"] = true
+			}
+		case "text-decoration", "text-decoration-line":
+			if strings.Contains(lower, "underline") {
+				f.inline["underline"] = true
+			}
+			if strings.Contains(lower, "line-through") {
+				f.inline["strike"] = true
+			}
+		case "color":
+			f.inline["color"] = value
+		case "background-color":
+			f.inline["background"] = value
+		case "text-align":
+			if lower == "center" || lower == "right" || lower == "justify" {
+				f.align = lower
+			}
+		case "-en-codeblock":
+			if lower == "true" {
+				f.code = true
+			}
+		}
+	}
+}
+
+func (c *enmlConverter) end(name string) {
+	switch name {
+	case "td", "th":
+		c.cell = true
+	}
+	// Close the innermost open element of that name, and any left open
+	// inside it
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if c.stack[i].name != name {
+			continue
+		}
+		if enmlBlocks[name] && c.line {
+			c.endLine()
+		}
+		c.stack = c.stack[:i]
+		return
+	}
+}
+
+// media shows an en-media resource: images as images, anything else as a
+// link named after the file
+func (c *enmlConverter) media(hash, mime string) {
+	res, ok := c.resources[strings.ToLower(hash)]
+	if !ok {
+		c.note.warn("an embedded %s file is missing from the export", mime)
+		return
+	}
+	if res.mime != "" {
+		mime = res.mime
+	}
+	if !strings.HasPrefix(mime, "image/") {
+		attrs := c.inlineAttrs()
+		if attrs == nil {
+			attrs = map[string]any{}
+		}
+		attrs["link"] = fileRef(res.file)
+		c.insert(res.fileName, attrs)
+		return
+	}
+	c.embed(map[string]any{"image": fileRef(res.file)})
+}
+
+// inlineAttrs merges the formats of the open elements
+func (c *enmlConverter) inlineAttrs() map[string]any {
+	var attrs map[string]any
+	for _, f := range c.stack {
+		for k, v := range f.inline {
+			if attrs == nil {
+				attrs = map[string]any{}
+			}
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// lineAttrs is the format of the line being ended
+func (c *enmlConverter) lineAttrs() map[string]any {
+	attrs := map[string]any{}
+	lists, listType, inItem := 0, "", false
+	header, code, quote := 0, false, false
+	for _, f := range c.stack {
+		switch {
+		case f.list != "":
+			lists++
+			listType = f.list
+		case f.name == "li":
+			inItem = true
+		}
+		if f.header > 0 {
+			header = f.header
+		}
+		code = code || f.code
+		quote = quote || f.quote
+		if f.align != "" {
+			attrs["align"] = f.align
+		}
+	}
+	switch {
+	case code:
+		return map[string]any{"code-block": true}
+	case header > 0:
+		attrs["header"] = header
+	case c.todo != "":
+		attrs["list"] = c.todo
+	case inItem && listType != "":
+		attrs["list"] = listType
+		if lists > 1 {
+			attrs["indent"] = lists - 1
+		}
+	case quote:
+		attrs["blockquote"] = true
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+func (c *enmlConverter) inCode() bool {
+	for _, f := range c.stack {
+		if f.code {
+			return true
+		}
+	}
+	return false
+}
+
+// text adds character data, collapsing white space as HTML does outside
+// code
+func (c *enmlConverter) text(s string) {
+	if c.inCode() {
+		lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+		for i, l := range lines {
+			if i > 0 {
+				c.endLine()
+			}
+			if l != "" {
+				c.insert(l, c.inlineAttrs())
+			}
+		}
+		return
+	}
+	core := strings.Join(strings.Fields(s), " ")
+	// Space next to other text is kept once; at the start of a line it
+	// is dropped
+	if startsWithSpace(s) && c.line && !c.endsWithSpace() {
+		core = " " + core
+	}
+	if core != "" && core != " " && endsWithSpace(s) {
+		core += " "
+	}
+	if core != "" {
+		c.insert(core, c.inlineAttrs())
+	}
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s[:1], " \t\r\n") == ""
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s[len(s)-1:], " \t\r\n") == ""
+}
+
+func (c *enmlConverter) endsWithSpace() bool {
+	if len(c.ops) == 0 {
+		return false
+	}
+	s, ok := c.ops[len(c.ops)-1].Insert.(string)
+	return ok && strings.HasSuffix(s, " ")
+}
+
+func (c *enmlConverter) embed(e map[string]any) {
+	c.ops = append(c.ops, quill.Op{Insert: e})
+	c.line = true
+}
+
+// insert adds text, merging it into the previous op when the formats match
+func (c *enmlConverter) insert(s string, attrs map[string]any) {
+	if n := len(c.ops); n > 0 {
+		if prev, ok := c.ops[n-1].Insert.(string); ok && reflect.DeepEqual(c.ops[n-1].Attributes, attrs) {
+			c.ops[n-1].Insert = prev + s
+			c.line = c.line || s != "\n"
+			return
+		}
+	}
+	c.ops = append(c.ops, quill.Op{Insert: s, Attributes: attrs})
+	c.line = c.line || s != "\n"
+}
+
+// endLine ends the current line, trimming its trailing space
+func (c *enmlConverter) endLine() {
+	if n := len(c.ops); n > 0 && !c.inCode() {
+		if s, ok := c.ops[n-1].Insert.(string); ok && !strings.HasSuffix(s, "\n") {
+			if s = strings.TrimRight(s, " "); s == "" {
+				c.ops = c.ops[:n-1]
+			} else {
+				c.ops[n-1].Insert = s
+			}
+		}
+	}
+	c.insert("\n", c.lineAttrs())
+	c.line, c.todo, c.cell = false, "", false
+}
+
+func attr(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
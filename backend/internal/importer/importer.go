@@ -0,0 +1,346 @@
+// Package importer creates notes from other applications' exports in an
+// existing workspace.
+//
+// A reader for each format turns an upload into Notes: a folder path, a
+// title, tags, timestamps and the content as a Quill Delta. Run then
+// creates the folders and notes, has the document service encode each
+// Delta as a Yjs document and stores it with the note, keeping the
+// source's timestamps. Links between notes of one import are written
+// with Link and become note links once the notes exist; files a note
+// embeds or links to are listed in its Files and become its attachments.
+// Formats without links between notes are imported with a Stream, one
+// note at a time as they are read.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-notes/backend/internal/quill"
+)
+
+// Note is a note to create
+type Note struct {
+	// Source says where the note came from in the upload, for reports
+	Source string
+	// Folder is the path of folder names below the import's folder,
+	// outermost first; empty puts the note in the import's folder
+	Folder    []string
+	Title     string
+	Tags      []string
+	CreatedAt *time.Time // nil means now
+	UpdatedAt *time.Time // nil means CreatedAt
+	Content   quill.Delta
+	// Files are attached to the note; Content refers to Files[i] by
+	// fileRef(i)
+	Files []File
+	// Warnings say what of the note was left out or changed
+	Warnings []string
+}
+
+// File is a file a note attaches, read when the note is stored so that a
+// whole upload's files are never held at once
+type File struct {
+	Name   string
+	source string // where in the upload the file is, when that can differ
+	read   func() ([]byte, error)
+}
+
+func (n *Note) warn(format string, args ...interface{}) {
+	n.Warnings = append(n.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Target is where an import goes
+type Target struct {
+	WorkspaceID int
+	FolderID    *int // nil for the workspace root
+	UserID      int
+}
+
+// Result lists what an import created. Warnings about a note are listed
+// with it; Warnings holds those about the upload as a whole.
+type Result struct {
+	Folders  int        `json:"folders"`
+	Notes    []Imported `json:"notes"`
+	Warnings []string   `json:"warnings"`
+}
+
+type Imported struct {
+	ID       int      `json:"id"`
+	Title    string   `json:"title"`
+	Source   string   `json:"source"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Store is what an import writes to
+type Store interface {
+	CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (int, error)
+	CreateNoteWithTags(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string, tags []string) (int, error)
+	SetTagsForNote(ctx context.Context, noteID int, tagNames []string) error
+	SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error
+	// AddAttachment stores a file as an attachment of a note and returns
+	// the URL the content links to it by
+	AddAttachment(ctx context.Context, workspaceID, noteID int, createdBy *int, filename string, data []byte) (string, error)
+}
+
+// Documents encodes note content as Yjs documents
+type Documents interface {
+	Encode(ctx context.Context, d quill.Delta) ([]byte, error)
+}
+
+// linkPrefix marks a link to another note of the same import
+const linkPrefix = "go-notes-import:"
+
+// Link is the href of a link to notes[i] of the same import
+func Link(i int) string {
+	return linkPrefix + strconv.Itoa(i)
+}
+
+// filePrefix marks an image or link of a note that refers to one of its
+// Files
+const filePrefix = "go-notes-file:"
+
+func fileRef(i int) string {
+	return filePrefix + strconv.Itoa(i)
+}
+
+// Run creates the notes under the target, folders first. It stops at the
+// first store or document service error, returning what was created so
+// far with it.
+func Run(ctx context.Context, store Store, docs Documents, target Target, notes []Note, warnings []string) (*Result, error) {
+	r := newRun(ctx, store, docs, target)
+	r.result.Warnings = append(r.result.Warnings, warnings...)
+
+	// Every note is created before any content is stored, so links can
+	// point at notes further down the list
+	ids := make([]int, len(notes))
+	for i, n := range notes {
+		id, err := r.create(n)
+		if err != nil {
+			return r.result, err
+		}
+		ids[i] = id
+	}
+	for i, n := range notes {
+		if err := r.fill(ids[i], n, ids); err != nil {
+			return r.result, err
+		}
+	}
+	return r.result, nil
+}
+
+// Stream creates notes as a reader produces them, for formats whose notes
+// do not link to each other, so that large uploads are never held whole
+type Stream struct {
+	run *run
+}
+
+// NewStream starts an import whose notes are added one at a time
+func NewStream(ctx context.Context, store Store, docs Documents, target Target) *Stream {
+	return &Stream{run: newRun(ctx, store, docs, target)}
+}
+
+// Add creates a note with its content. Links made with Link are dropped.
+func (s *Stream) Add(n Note) error {
+	id, err := s.run.create(n)
+	if err != nil {
+		return err
+	}
+	return s.run.fill(id, n, nil)
+}
+
+// Warn records a warning about the upload as a whole
+func (s *Stream) Warn(format string, args ...interface{}) {
+	s.run.result.Warnings = append(s.run.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Result lists what was created so far
+func (s *Stream) Result() *Result {
+	return s.run.result
+}
+
+// run holds the state of one import
+type run struct {
+	ctx     context.Context
+	store   Store
+	docs    Documents
+	target  Target
+	folders map[string]*int // joined folder path to ID
+	result  *Result
+}
+
+func newRun(ctx context.Context, store Store, docs Documents, target Target) *run {
+	return &run{
+		ctx:     ctx,
+		store:   store,
+		docs:    docs,
+		target:  target,
+		folders: map[string]*int{"": target.FolderID},
+		result:  &Result{Notes: []Imported{}, Warnings: []string{}},
+	}
+}
+
+// folderID returns the folder at a path below the target, creating it and
+// its parents as needed
+func (r *run) folderID(names []string) (*int, error) {
+	key := strings.Join(names, "\x00")
+	if id, ok := r.folders[key]; ok {
+		return id, nil
+	}
+	parentID, err := r.folderID(names[:len(names)-1])
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.store.CreateFolder(r.ctx, r.target.WorkspaceID, names[len(names)-1], parentID)
+	if err != nil {
+		return nil, fmt.Errorf("create folder %s: %w", strings.Join(names, "/"), err)
+	}
+	r.result.Folders++
+	r.folders[key] = &id
+	return &id, nil
+}
+
+// create adds a note, with its tags, in its folder
+func (r *run) create(n Note) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	parentID, err := r.folderID(n.Folder)
+	if err != nil {
+		return 0, err
+	}
+	id, err := r.store.CreateNoteWithTags(r.ctx, r.target.WorkspaceID, n.Title, parentID, &r.target.UserID, "", nil)
+	if err != nil {
+		return 0, fmt.Errorf("create note %s: %w", n.Source, err)
+	}
+	if len(n.Tags) > 0 {
+		if err := r.store.SetTagsForNote(r.ctx, id, n.Tags); err != nil {
+			return 0, fmt.Errorf("tag note %s: %w", n.Source, err)
+		}
+	}
+	r.result.Notes = append(r.result.Notes, Imported{ID: id, Title: n.Title, Source: n.Source, Warnings: n.Warnings})
+	return id, nil
+}
+
+// fill stores a created note's files and content, pointing its links at
+// ids
+func (r *run) fill(id int, n Note, ids []int) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	urls, err := r.attach(id, n)
+	if err != nil {
+		return err
+	}
+	content := linkFiles(linkNotes(n.Content, ids), urls)
+	state, err := r.docs.Encode(r.ctx, content)
+	if err != nil {
+		return fmt.Errorf("encode note %s: %w", n.Source, err)
+	}
+	// Written last so that nothing before touches the timestamps again
+	if err := r.store.SetNoteContent(r.ctx, id, state, quill.PlainText(content), n.CreatedAt, n.UpdatedAt); err != nil {
+		return fmt.Errorf("store note %s: %w", n.Source, err)
+	}
+	return nil
+}
+
+// attach stores a note's files as its attachments, returning their URLs.
+// A file that cannot be read or is refused, such as one over the
+// workspace's quota, is left out with a warning on the note.
+func (r *run) attach(id int, n Note) ([]string, error) {
+	urls := make([]string, len(n.Files))
+	for i, f := range n.Files {
+		data, err := f.read()
+		if err == nil {
+			urls[i], err = r.store.AddAttachment(r.ctx, r.target.WorkspaceID, id, &r.target.UserID, f.Name, data)
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		if err != nil {
+			r.warn(id, fmt.Sprintf("the attachment %s was not imported: %v", f.Name, err))
+		}
+	}
+	return urls, nil
+}
+
+// warn adds a warning to a created note's entry in the result
+func (r *run) warn(id int, msg string) {
+	for i := len(r.result.Notes) - 1; i >= 0; i-- {
+		if r.result.Notes[i].ID == id {
+			r.result.Notes[i].Warnings = append(r.result.Notes[i].Warnings, msg)
+			return
+		}
+	}
+}
+
+// linkNotes turns the import's links into links to the created notes
+func linkNotes(d quill.Delta, ids []int) quill.Delta {
+	out := quill.Delta{Ops: make([]quill.Op, 0, len(d.Ops))}
+	for _, op := range d.Ops {
+		if href, ok := op.Attributes["link"].(string); ok && strings.HasPrefix(href, linkPrefix) {
+			attrs := make(map[string]any, len(op.Attributes))
+			for k, v := range op.Attributes {
+				attrs[k] = v
+			}
+			if i, err := strconv.Atoi(href[len(linkPrefix):]); err == nil && i >= 0 && i < len(ids) {
+				attrs["link"] = quill.NoteLink(ids[i])
+			} else {
+				delete(attrs, "link")
+			}
+			op.Attributes = attrs
+		}
+		out.Ops = append(out.Ops, op)
+	}
+	return out
+}
+
+// linkFiles points a note's images and links to its files at their
+// attachments' URLs. Images of files that were not stored are dropped;
+// links to them lose the link and keep their text.
+func linkFiles(d quill.Delta, urls []string) quill.Delta {
+	url := func(ref string) string {
+		if i, err := strconv.Atoi(ref[len(filePrefix):]); err == nil && i >= 0 && i < len(urls) {
+			return urls[i]
+		}
+		return ""
+	}
+	out := quill.Delta{Ops: make([]quill.Op, 0, len(d.Ops))}
+	for _, op := range d.Ops {
+		if embed, ok := op.Insert.(map[string]any); ok {
+			if src, ok := embed["image"].(string); ok && strings.HasPrefix(src, filePrefix) {
+				u := url(src)
+				if u == "" {
+					continue
+				}
+				e := make(map[string]any, len(embed))
+				for k, v := range embed {
+					e[k] = v
+				}
+				e["image"] = u
+				op.Insert = e
+			}
+		}
+		if href, ok := op.Attributes["link"].(string); ok && strings.HasPrefix(href, filePrefix) {
+			attrs := make(map[string]any, len(op.Attributes))
+			for k, v := range op.Attributes {
+				attrs[k] = v
+			}
+			if u := url(href); u != "" {
+				attrs["link"] = u
+			} else {
+				delete(attrs, "link")
+			}
+			if len(attrs) == 0 {
+				attrs = nil
+			}
+			op.Attributes = attrs
+		}
+		out.Ops = append(out.Ops, op)
+	}
+	return out
+}
@@ -0,0 +1,618 @@
+package importer
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go-notes/backend/internal/quill"
+)
+
+// maxFileSize bounds each file read from a zip, against zip bombs
+const maxFileSize = 64 << 20
+
+// maxZipFiles bounds the entries of a zip, each of which costs memory
+// before anything is read
+const maxZipFiles = 20000
+
+// budget counts the bytes unpacked from a zip against its limit. The sizes
+// entries declare are checked against the limit before anything is read;
+// counting what is read does not rely on them being true.
+type budget struct {
+	mu          sync.Mutex
+	limit, left int64
+}
+
+// take counts n bytes read, failing once the zip has unpacked to more than
+// its limit
+func (b *budget) take(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.left -= n
+	if b.left < 0 {
+		return fmt.Errorf("the archive unpacks to more than %d MB", b.limit>>20)
+	}
+	return nil
+}
+
+// mdFile is a Markdown file of the tree being read
+type mdFile struct {
+	path     string // slash-separated, without the extension
+	dir      string // "" at the root
+	modified time.Time
+	body     string
+	meta     frontMatter
+}
+
+// ReadMarkdown reads a zip of a Markdown directory tree, such as an
+// Obsidian vault. Directories become folders and each .md file a note;
+// YAML front matter supplies tags, a title, aliases and timestamps, which
+// otherwise come from the file. [[Wikilinks]] and relative links to other
+// files of the tree become links between the notes. Images and other
+// files a note embeds or links to become its attachments, read from r
+// when the note is stored; files no note refers to are skipped, as are
+// hidden files and directories, such as .obsidian and .trash. Each note's
+// warnings say what of it was left out, the returned ones which files
+// were. Zips of more than maxZipFiles entries, or whose files add up to
+// more than maxUnpacked bytes, are refused.
+func ReadMarkdown(r io.ReaderAt, size, maxUnpacked int64) ([]Note, []string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+	if len(zr.File) > maxZipFiles {
+		return nil, nil, fmt.Errorf("more than %d files", maxZipFiles)
+	}
+	var declared uint64
+	for _, f := range zr.File {
+		declared += f.UncompressedSize64
+		if f.UncompressedSize64 > uint64(maxUnpacked) || declared > uint64(maxUnpacked) {
+			return nil, nil, fmt.Errorf("unpacks to more than %d MB", maxUnpacked>>20)
+		}
+	}
+	left := &budget{limit: maxUnpacked, left: maxUnpacked}
+
+	var warnings []string
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	var files []*mdFile
+	others := map[string]*zip.File{}
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(f.Name, `\`, "/")), "/")
+		if f.FileInfo().IsDir() || name == "" || hidden(name) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".md" && ext != ".markdown" {
+			others[name] = f
+			continue
+		}
+		raw, err := readZipFile(f, left)
+		if err != nil {
+			warn("%s could not be read and was skipped: %v", name, err)
+			continue
+		}
+		file := &mdFile{path: strings.TrimSuffix(name, path.Ext(name)), modified: f.Modified}
+		if dir := path.Dir(name); dir != "." {
+			file.dir = dir
+		}
+		text := strings.ReplaceAll(strings.TrimPrefix(string(raw), "\ufeff"), "\r\n", "\n")
+		file.meta, file.body, err = parseFrontMatter(text)
+		if err != nil {
+			file.meta.warnings = append(file.meta.warnings, fmt.Sprintf("the front matter could not be read: %v", err))
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	idx := newLinkIndex(files, others, left)
+	notes := make([]Note, len(files))
+	for i, file := range files {
+		source := file.path + ".md"
+		n := Note{
+			Source:    source,
+			Title:     path.Base(file.path),
+			Tags:      file.meta.tags,
+			CreatedAt: file.meta.created,
+			UpdatedAt: file.meta.updated,
+		}
+		if file.dir != "" {
+			n.Folder = strings.Split(file.dir, "/")
+		}
+		if file.meta.title != "" {
+			n.Title = file.meta.title
+		}
+		if !file.modified.IsZero() && file.modified.Year() > 1980 {
+			modified := file.modified
+			if n.UpdatedAt == nil {
+				n.UpdatedAt = &modified
+			}
+			if n.CreatedAt == nil {
+				n.CreatedAt = &modified
+			}
+		}
+		n.Warnings = append(n.Warnings, file.meta.warnings...)
+		body := idx.wikilinks(file, file.body, &n)
+		n.Content = idx.relativeLinks(file, quill.FromMarkdown(body), &n)
+		notes[i] = n
+	}
+
+	var skipped []string
+	for name := range others {
+		if !idx.used[name] {
+			skipped = append(skipped, name)
+		}
+	}
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		warn("%d files that no note refers to were skipped, such as %s", len(skipped), skipped[0])
+	}
+	return notes, warnings, nil
+}
+
+// hidden is true for files under __MACOSX or in a directory, or with a
+// name, starting with a dot
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+func readZipFile(f *zip.File, left *budget) ([]byte, error) {
+	if f.UncompressedSize64 > maxFileSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxFileSize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFileSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxFileSize)
+	}
+	if err := left.take(int64(len(b))); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// frontMatter holds the properties the importer uses
+type frontMatter struct {
+	title    string
+	tags     []string
+	aliases  []string
+	created  *time.Time
+	updated  *time.Time
+	warnings []string
+}
+
+// parseFrontMatter splits a YAML front matter block off the top of a file
+func parseFrontMatter(text string) (frontMatter, string, error) {
+	var fm frontMatter
+	if !strings.HasPrefix(text, "---\n") {
+		return fm, text, nil
+	}
+	rest := text[len("---\n"):]
+	end, after := -1, 0
+	for off := 0; off <= len(rest); {
+		nl := strings.IndexByte(rest[off:], '\n')
+		lineEnd := len(rest)
+		if nl >= 0 {
+			lineEnd = off + nl
+		}
+		if l := strings.TrimRight(rest[off:lineEnd], " \t"); l == "---" || l == "..." {
+			end, after = off, lineEnd+1
+			break
+		}
+		if nl < 0 {
+			break
+		}
+		off = lineEnd + 1
+	}
+	if end < 0 {
+		return fm, text, nil
+	}
+	body := ""
+	if after < len(rest) {
+		body = rest[after:]
+	}
+
+	var props map[string]interface{}
+	if err := yaml.Unmarshal([]byte(rest[:end]), &props); err != nil {
+		return fm, body, err
+	}
+	for key, v := range props {
+		switch strings.ToLower(key) {
+		case "title":
+			if s, ok := v.(string); ok {
+				fm.title = strings.TrimSpace(s)
+			}
+		case "tags", "tag":
+			for _, t := range stringList(v, ", ") {
+				if t = strings.TrimPrefix(t, "#"); t != "" {
+					fm.tags = append(fm.tags, t)
+				}
+			}
+		case "aliases", "alias":
+			fm.aliases = append(fm.aliases, stringList(v, ",")...)
+		case "created", "created_at", "date":
+			if fm.created == nil || strings.ToLower(key) != "date" {
+				fm.created = fm.timestamp(key, v)
+			}
+		case "updated", "updated_at", "modified":
+			fm.updated = fm.timestamp(key, v)
+		}
+	}
+	return fm, body, nil
+}
+
+// stringList reads a YAML list, or a string of items separated by any of
+// seps
+func stringList(v interface{}, seps string) []string {
+	var out []string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if item != nil {
+				out = append(out, strings.TrimSpace(fmt.Sprint(item)))
+			}
+		}
+	case string:
+		for _, item := range strings.FieldsFunc(v, func(r rune) bool { return strings.ContainsRune(seps, r) }) {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	case nil:
+	default:
+		out = []string{fmt.Sprint(v)}
+	}
+	return out
+}
+
+// timestampLayouts are the date formats commonly found in front matter
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (fm *frontMatter) timestamp(key string, v interface{}) *time.Time {
+	switch v := v.(type) {
+	case time.Time:
+		return &v
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.UTC); err == nil {
+				return &t
+			}
+		}
+	}
+	fm.warnings = append(fm.warnings, fmt.Sprintf("unreadable %s %v; the file's time is used instead", key, v))
+	return nil
+}
+
+// linkIndex finds notes by path, file name or alias, and other files by
+// path or file name, all case-insensitive
+type linkIndex struct {
+	paths   map[string]int
+	names   map[string][]int
+	aliases map[string]int
+	files   []*mdFile
+
+	others     map[string]*zip.File // by path as in the zip
+	otherPaths map[string]string    // lowercase path to path
+	otherNames map[string][]string  // lowercase file name to paths
+	used       map[string]bool      // paths of the other files notes refer to
+	left       *budget              // of the zip, which attachments are read from
+}
+
+func newLinkIndex(files []*mdFile, others map[string]*zip.File, left *budget) *linkIndex {
+	idx := &linkIndex{
+		paths: map[string]int{}, names: map[string][]int{}, aliases: map[string]int{}, files: files,
+		others: others, otherPaths: map[string]string{}, otherNames: map[string][]string{}, used: map[string]bool{},
+		left: left,
+	}
+	for i, f := range files {
+		idx.paths[strings.ToLower(f.path)] = i
+		name := strings.ToLower(path.Base(f.path))
+		idx.names[name] = append(idx.names[name], i)
+		for _, a := range f.meta.aliases {
+			if _, ok := idx.aliases[strings.ToLower(a)]; !ok {
+				idx.aliases[strings.ToLower(a)] = i
+			}
+		}
+	}
+	for name := range others {
+		idx.otherPaths[strings.ToLower(name)] = name
+		base := strings.ToLower(path.Base(name))
+		idx.otherNames[base] = append(idx.otherNames[base], name)
+	}
+	// Like Obsidian, a bare name prefers the file closest to the root
+	for _, list := range idx.names {
+		sort.SliceStable(list, func(a, b int) bool {
+			return strings.Count(files[list[a]].path, "/") < strings.Count(files[list[b]].path, "/")
+		})
+	}
+	for _, list := range idx.otherNames {
+		sort.Slice(list, func(a, b int) bool {
+			if da, db := strings.Count(list[a], "/"), strings.Count(list[b], "/"); da != db {
+				return da < db
+			}
+			return list[a] < list[b]
+		})
+	}
+	return idx
+}
+
+// resolve finds the note a wikilink target names: a vault path, possibly
+// below a top-level directory the zip added, a file name or an alias
+func (idx *linkIndex) resolve(target string) (int, bool) {
+	target = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(target), ".md"))
+	if strings.Contains(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+		if i, ok := idx.paths[target]; ok {
+			return i, true
+		}
+		for i, f := range idx.files {
+			if strings.HasSuffix(strings.ToLower(f.path), "/"+target) {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	if list := idx.names[target]; len(list) > 0 {
+		return list[0], true
+	}
+	i, ok := idx.aliases[target]
+	return i, ok
+}
+
+// resolveFile finds a file that is not a note, relative to a directory,
+// by vault path, possibly below a top-level directory the zip added, or
+// by file name
+func (idx *linkIndex) resolveFile(dir, target string) (string, bool) {
+	target = strings.TrimSpace(target)
+	if name, ok := idx.otherPaths[strings.ToLower(path.Join(dir, target))]; ok {
+		return name, true
+	}
+	lower := strings.ToLower(strings.TrimPrefix(path.Clean("/"+target), "/"))
+	if name, ok := idx.otherPaths[lower]; ok {
+		return name, true
+	}
+	if strings.Contains(lower, "/") {
+		for _, name := range idx.otherNames[path.Base(lower)] {
+			if strings.HasSuffix(strings.ToLower(name), "/"+lower) {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	if list := idx.otherNames[lower]; len(list) > 0 {
+		return list[0], true
+	}
+	return "", false
+}
+
+// attach adds a file of the zip to a note's Files, once, returning the
+// reference its content uses for it
+func (idx *linkIndex) attach(n *Note, name string) string {
+	idx.used[name] = true
+	for i, f := range n.Files {
+		if f.source == name {
+			return fileRef(i)
+		}
+	}
+	f := idx.others[name]
+	n.Files = append(n.Files, File{Name: path.Base(name), source: name, read: func() ([]byte, error) { return readZipFile(f, idx.left) }})
+	return fileRef(len(n.Files) - 1)
+}
+
+// isImage is true for a file name with an image type's extension
+func isImage(name string) bool {
+	return strings.HasPrefix(mime.TypeByExtension(strings.ToLower(path.Ext(name))), "image/")
+}
+
+// wikilinks rewrites [[target#heading|label]] links outside code into
+// Markdown links the quill package parses. Links to, and embeds of, files
+// that are not notes become links to, or images of, the note's
+// attachments.
+func (idx *linkIndex) wikilinks(file *mdFile, body string, n *Note) string {
+	self := -1
+	for i, f := range idx.files {
+		if f == file {
+			self = i
+		}
+	}
+	var out strings.Builder
+	fenced := false
+	for line, l := range strings.Split(body, "\n") {
+		if line > 0 {
+			out.WriteByte('\n')
+		}
+		if t := strings.TrimSpace(l); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fenced = !fenced
+		}
+		if fenced || !strings.Contains(l, "[[") {
+			out.WriteString(l)
+			continue
+		}
+		for i := 0; i < len(l); {
+			switch {
+			case l[i] == '`':
+				// Copy a code span through its closing backticks
+				j := i
+				for j < len(l) && l[j] == '`' {
+					j++
+				}
+				fence := l[i:j]
+				if end := strings.Index(l[j:], fence); end >= 0 {
+					j += end + len(fence)
+				}
+				out.WriteString(l[i:j])
+				i = j
+				continue
+			case strings.HasPrefix(l[i:], "[[") || strings.HasPrefix(l[i:], "![["):
+				start := i + strings.Index(l[i:], "[[") + 2
+				end := strings.Index(l[start:], "]]")
+				if end < 0 {
+					break
+				}
+				embed := l[i] == '!'
+				inner := l[start : start+end]
+				target, label := inner, inner
+				if p := strings.IndexByte(inner, '|'); p >= 0 {
+					target, label = inner[:p], inner[p+1:]
+				}
+				name := target
+				if p := strings.IndexAny(target, "#^"); p >= 0 {
+					name = target[:p]
+				}
+				note, ok := self, self >= 0
+				if strings.TrimSpace(name) != "" {
+					note, ok = idx.resolve(name)
+				}
+				other, isFile := "", false
+				if !ok {
+					other, isFile = idx.resolveFile(file.dir, name)
+				}
+				switch {
+				case ok:
+					fmt.Fprintf(&out, "[%s](%s)", escapeMarkdown(label), Link(note))
+				case isFile && embed && isImage(other):
+					fmt.Fprintf(&out, "![](%s)", idx.attach(n, other))
+				case isFile:
+					if embed || label == inner {
+						// An embed's label is its size; a bare link shows the name
+						label = path.Base(other)
+					}
+					fmt.Fprintf(&out, "[%s](%s)", escapeMarkdown(label), idx.attach(n, other))
+				case embed:
+					n.warn("the embedded file %s is not in the upload and was left out", target)
+				default:
+					n.warn("the link to %s does not match a note; its text is kept", target)
+					out.WriteString(escapeMarkdown(label))
+				}
+				i = start + end + 2
+				continue
+			}
+			out.WriteByte(l[i])
+			i++
+		}
+	}
+	return out.String()
+}
+
+// escapeMarkdown backslash-escapes the punctuation of a link label
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x80 && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// relativeLinks points relative links to other Markdown files of the tree
+// at their notes, and relative links and images pointing at other files
+// at the note's attachments. Images of files missing from the tree are
+// dropped and links to them lose the link.
+func (idx *linkIndex) relativeLinks(file *mdFile, d quill.Delta, n *Note) quill.Delta {
+	out := quill.Delta{Ops: make([]quill.Op, 0, len(d.Ops))}
+	for _, op := range d.Ops {
+		if embed, ok := op.Insert.(map[string]any); ok {
+			if src, ok := embed["image"].(string); ok && isRelative(src) {
+				other, found := idx.resolveFile(file.dir, localPath(src))
+				if !found {
+					n.warn("the image %s is not in the upload and was left out", src)
+					continue
+				}
+				op.Insert = map[string]any{"image": idx.attach(n, other)}
+			}
+		}
+		href, ok := op.Attributes["link"].(string)
+		if !ok || !isRelative(href) {
+			out.Ops = append(out.Ops, op)
+			continue
+		}
+		attrs := make(map[string]any, len(op.Attributes))
+		for k, v := range op.Attributes {
+			attrs[k] = v
+		}
+		delete(attrs, "link")
+		target := localPath(href)
+		ext := strings.ToLower(path.Ext(target))
+		switch {
+		case ext != ".md" && ext != ".markdown":
+			if other, found := idx.resolveFile(file.dir, target); found {
+				attrs["link"] = idx.attach(n, other)
+			} else {
+				n.warn("the link to %s points at a file that is not in the upload", href)
+			}
+		default:
+			rel := strings.TrimSuffix(path.Join(file.dir, target), path.Ext(target))
+			i, found := idx.paths[strings.ToLower(rel)]
+			if !found {
+				i, found = idx.resolve(target)
+			}
+			if found {
+				attrs["link"] = Link(i)
+			} else {
+				n.warn("the link to %s does not match a note; its text is kept", href)
+			}
+		}
+		if len(attrs) == 0 {
+			attrs = nil
+		}
+		op.Attributes = attrs
+		out.Ops = append(out.Ops, op)
+	}
+	return out
+}
+
+// localPath is the file a relative link points at, without its fragment
+// or query and unescaped
+func localPath(href string) string {
+	if p := strings.IndexAny(href, "#?"); p >= 0 {
+		href = href[:p]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return href
+}
+
+// isRelative is true for a link to a local file: no scheme, not a
+// fragment and not absolute
+func isRelative(href string) bool {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "/") {
+		return false
+	}
+	if p := strings.IndexByte(href, ':'); p >= 0 && !strings.ContainsAny(href[:p], "/#?") {
+		return false
+	}
+	return true
+}
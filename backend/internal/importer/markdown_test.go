@@ -0,0 +1,283 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/memstore"
+	"go-notes/backend/internal/quill"
+)
+
+// encoder stands in for the document service, encoding a Delta as its JSON
+type encoder struct{ fail bool }
+
+func (e encoder) Encode(ctx context.Context, d quill.Delta) ([]byte, error) {
+	if e.fail {
+		return nil, errors.New("document service returned 500")
+	}
+	return json.Marshal(d)
+}
+
+// attachments stands in for attachment storage over a memstore, refusing
+// the file named refuse
+type attachments struct {
+	*memstore.Store
+	files  map[string][]byte
+	refuse string
+}
+
+func newAttachments(store *memstore.Store) *attachments {
+	return &attachments{Store: store, files: map[string][]byte{}}
+}
+
+func (a *attachments) AddAttachment(ctx context.Context, workspaceID, noteID int, createdBy *int, filename string, data []byte) (string, error) {
+	if filename == a.refuse {
+		return "", errors.New("attachment quota exceeded")
+	}
+	a.files[filename] = data
+	return fmt.Sprintf("/workspaces/%d/notes/%d/attachments/%s", workspaceID, noteID, filename), nil
+}
+
+type zipEntry struct {
+	name     string
+	body     string
+	modified time.Time
+}
+
+func makeZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modified})
+		require.NoError(t, err)
+		w.Write([]byte(e.body))
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func readMarkdown(t *testing.T, b []byte) (map[string]Note, []string) {
+	t.Helper()
+	notes, warnings, err := ReadMarkdown(bytes.NewReader(b), int64(len(b)), 1<<30)
+	require.NoError(t, err)
+	bySource := map[string]Note{}
+	for _, n := range notes {
+		bySource[n.Source] = n
+	}
+	return bySource, warnings
+}
+
+// links lists the text and href of each linked op
+func links(d quill.Delta) map[string]string {
+	out := map[string]string{}
+	for _, op := range d.Ops {
+		if href, ok := op.Attributes["link"].(string); ok {
+			out[op.Insert.(string)] = href
+		}
+	}
+	return out
+}
+
+func TestReadMarkdown(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	b := makeZip(t,
+		zipEntry{name: "Vault/Home.md", modified: modified, body: "---\n" +
+			"tags: [work, \"#planning\"]\n" +
+			"aliases: Start page\n" +
+			"created: 2023-01-02\n" +
+			"---\n" +
+			"# Home\r\n" +
+			"See [[Projects/Plan|the plan]], [[Ideas#Later]] and [[Missing]].\n" +
+			"Back to [[#Home]], `[[not a link]]` and [meeting](Projects/Meeting%20notes.md#agenda).\n" +
+			"![[diagram.png]] [site](https://example.com) ![[gone.png]] [[report.pdf]]\n"},
+		zipEntry{name: "Vault/Ideas.md", body: "---\ntitle: Big ideas\ntags: one two\nupdated: 2024-02-03 10:30\n---\n[home](../Vault/Home.md) and [[start page]]\n"},
+		zipEntry{name: "Vault/Projects/Plan.md", modified: modified, body: "```\n[[Home]]\n```\n"},
+		zipEntry{name: "Vault/Projects/Meeting notes.md", body: "![chart](chart.png) [pdf](files/a.pdf)\n"},
+		zipEntry{name: "Vault/diagram.png", body: "png"},
+		zipEntry{name: "Vault/Projects/chart.png", body: "chart"},
+		zipEntry{name: "Vault/Attachments/report.pdf", body: "pdf"},
+		zipEntry{name: "Vault/unused.txt", body: "txt"},
+		zipEntry{name: "Vault/.obsidian/app.md", body: "settings"},
+		zipEntry{name: "__MACOSX/Vault/._Home.md", body: "resource fork"},
+	)
+	notes, warnings := readMarkdown(t, b)
+	require.Len(t, notes, 4)
+
+	home := notes["Vault/Home.md"]
+	assert.Equal(t, "Home", home.Title)
+	assert.Equal(t, []string{"Vault"}, home.Folder)
+	assert.Equal(t, []string{"work", "planning"}, home.Tags)
+	assert.Equal(t, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), home.CreatedAt.UTC())
+	assert.Equal(t, modified, home.UpdatedAt.UTC(), "updated falls back to the file's time")
+	// Notes are sorted by path: Home, Ideas, Projects/Meeting notes, Projects/Plan
+	assert.Equal(t, map[string]string{
+		"the plan":    Link(3),
+		"Ideas#Later": Link(1),
+		"#Home":       Link(0),
+		"meeting":     Link(2),
+		"site":        "https://example.com",
+		"report.pdf":  fileRef(1),
+	}, links(home.Content))
+	text := quill.PlainText(home.Content)
+	assert.Contains(t, text, "and Missing.")
+	assert.Contains(t, text, "[[not a link]]")
+	assert.NotContains(t, text, "diagram")
+	// Embedded and linked files, found anywhere in the vault by name, are
+	// attached
+	assert.Contains(t, home.Content.Ops, quill.Op{Insert: map[string]any{"image": fileRef(0)}})
+	require.Len(t, home.Files, 2)
+	assert.Equal(t, "diagram.png", home.Files[0].Name)
+	assert.Equal(t, "report.pdf", home.Files[1].Name)
+	data, err := home.Files[1].read()
+	require.NoError(t, err)
+	assert.Equal(t, "pdf", string(data))
+
+	ideas := notes["Vault/Ideas.md"]
+	assert.Equal(t, "Big ideas", ideas.Title)
+	assert.Equal(t, []string{"one", "two"}, ideas.Tags)
+	assert.Equal(t, time.Date(2024, 2, 3, 10, 30, 0, 0, time.UTC), ideas.UpdatedAt.UTC())
+	assert.Equal(t, map[string]string{"home": Link(0), "start page": Link(0)}, links(ideas.Content))
+
+	plan := notes["Vault/Projects/Plan.md"]
+	assert.Equal(t, []string{"Vault", "Projects"}, plan.Folder)
+	assert.Equal(t, modified, plan.CreatedAt.UTC())
+	assert.Equal(t, "[[Home]]", quill.PlainText(plan.Content), "code blocks keep their text")
+
+	// Relative images and links point at the note's attachments
+	meeting := notes["Vault/Projects/Meeting notes.md"]
+	assert.Empty(t, links(meeting.Content))
+	assert.Equal(t, "pdf", quill.PlainText(meeting.Content))
+	assert.Equal(t, quill.Op{Insert: map[string]any{"image": fileRef(0)}}, meeting.Content.Ops[0])
+	require.Len(t, meeting.Files, 1)
+	assert.Equal(t, "chart.png", meeting.Files[0].Name)
+
+	assert.Equal(t, []string{"1 files that no note refers to were skipped, such as Vault/unused.txt"}, warnings)
+	assert.Equal(t, []string{
+		"the link to Missing does not match a note; its text is kept",
+		"the embedded file gone.png is not in the upload and was left out",
+	}, home.Warnings)
+	assert.Equal(t, []string{
+		"the link to files/a.pdf points at a file that is not in the upload",
+	}, meeting.Warnings)
+	assert.Empty(t, ideas.Warnings)
+}
+
+func TestReadMarkdownInvalid(t *testing.T) {
+	_, _, err := ReadMarkdown(bytes.NewReader([]byte("not a zip")), 9, 1<<30)
+	assert.Error(t, err)
+
+	notes, warnings := readMarkdown(t, makeZip(t, zipEntry{name: "a.md", body: "---\ntags: [unclosed\n---\nText\n"}))
+	assert.Equal(t, "Text", quill.PlainText(notes["a.md"].Content))
+	assert.Empty(t, warnings)
+	require.Len(t, notes["a.md"].Warnings, 1)
+	assert.Contains(t, notes["a.md"].Warnings[0], "the front matter could not be read")
+}
+
+func TestReadMarkdownLimits(t *testing.T) {
+	half := strings.Repeat("x", 600<<10)
+	b := makeZip(t, zipEntry{name: "a.md", body: half}, zipEntry{name: "b.md", body: half})
+	_, _, err := ReadMarkdown(bytes.NewReader(b), int64(len(b)), 1<<20)
+	assert.EqualError(t, err, "unpacks to more than 1 MB", "each file fits, not both")
+	notes, _, err := ReadMarkdown(bytes.NewReader(b), int64(len(b)), 2<<20)
+	require.NoError(t, err)
+	assert.Len(t, notes, 2)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i <= maxZipFiles; i++ {
+		_, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%d.md", i), Method: zip.Store})
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	_, _, err = ReadMarkdown(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 1<<30)
+	assert.EqualError(t, err, fmt.Sprintf("more than %d files", maxZipFiles))
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	require.NoError(t, store.CreateUser(ctx, "alice", "hash", false))
+	alice, err := store.GetUserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, alice.ID)
+	require.NoError(t, err)
+	wsID := workspaces[0].ID
+	parentID, err := store.CreateFolder(ctx, wsID, "Imports", nil)
+	require.NoError(t, err)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(48 * time.Hour)
+	file := func(name, data string) File {
+		return File{Name: name, read: func() ([]byte, error) { return []byte(data), nil }}
+	}
+	notes := []Note{
+		{Source: "a.md", Folder: []string{"Vault", "Sub"}, Title: "A", Tags: []string{"x"}, CreatedAt: &created, UpdatedAt: &updated,
+			Content: quill.Delta{Ops: []quill.Op{{Insert: "to B", Attributes: map[string]any{"link": Link(1), "bold": true}}, {Insert: "\n"}}}},
+		{Source: "b.md", Folder: []string{"Vault"}, Title: "B", Files: []File{file("a.png", "png"), file("big.pdf", "pdf")},
+			Content: quill.Delta{Ops: []quill.Op{
+				{Insert: map[string]any{"image": fileRef(0)}},
+				{Insert: "Hello", Attributes: map[string]any{"link": fileRef(1)}},
+				{Insert: map[string]any{"image": fileRef(1)}},
+				{Insert: "\n"},
+			}}},
+	}
+	target := Target{WorkspaceID: wsID, FolderID: &parentID, UserID: alice.ID}
+	files := newAttachments(store)
+	files.refuse = "big.pdf"
+	result, err := Run(ctx, files, encoder{}, target, notes, []string{"earlier warning"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Folders)
+	assert.Equal(t, []string{"earlier warning"}, result.Warnings)
+	require.Len(t, result.Notes, 2)
+
+	a, err := store.GetNote(ctx, result.Notes[0].ID)
+	require.NoError(t, err)
+	sub, err := store.GetFolder(ctx, *a.FolderID)
+	require.NoError(t, err)
+	vault, err := store.GetFolder(ctx, *sub.ParentID)
+	require.NoError(t, err)
+	assert.Equal(t, "Sub", sub.Name)
+	assert.Equal(t, "Vault", vault.Name)
+	assert.Equal(t, parentID, *vault.ParentID)
+	b, err := store.GetNote(ctx, result.Notes[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, vault.ID, *b.FolderID, "folders are created once")
+
+	assert.Equal(t, created.Format(time.RFC3339), a.CreatedAt)
+	assert.Equal(t, updated.Format(time.RFC3339), a.UpdatedAt)
+	tags, err := store.ListTagsForNote(ctx, a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "x", tags[0].Name)
+
+	var content quill.Delta
+	require.NoError(t, json.Unmarshal(store.Content(a.ID), &content))
+	assert.Equal(t, quill.NoteLink(b.ID), content.Ops[0].Attributes["link"])
+	assert.Equal(t, true, content.Ops[0].Attributes["bold"])
+	assert.Equal(t, "to B", store.SearchText(a.ID))
+	assert.Equal(t, Link(1), notes[0].Content.Ops[0].Attributes["link"], "the input is left alone")
+
+	// Files become attachments; one that is refused is left out
+	assert.Equal(t, map[string][]byte{"a.png": []byte("png")}, files.files)
+	content = quill.Delta{}
+	require.NoError(t, json.Unmarshal(store.Content(b.ID), &content))
+	assert.Equal(t, []quill.Op{
+		{Insert: map[string]any{"image": fmt.Sprintf("/workspaces/%d/notes/%d/attachments/a.png", wsID, b.ID)}},
+		{Insert: "Hello"},
+		{Insert: "\n"},
+	}, content.Ops)
+	assert.Equal(t, []string{"the attachment big.pdf was not imported: attachment quota exceeded"}, result.Notes[1].Warnings)
+
+	_, err = Run(ctx, files, encoder{fail: true}, target, notes[:1], nil)
+	assert.ErrorContains(t, err, "encode note a.md")
+}
@@ -1,26 +1,29 @@
 package integration
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 	"testing"
 	"time"
-	"io"
 
 	"github.com/gorilla/websocket"
-	"github.com/stretchr/testify/assert"
 	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-notes/backend/client"
 	"go-notes/backend/internal/db"
 )
 
 // Base URL for testing (your backend runs under /test)
 const baseURL = "http://localhost:8060/test"
 
+var ctx = context.Background()
+
 // Helper
 func getStringField(m map[string]interface{}, keys ...string) string {
 	for _, k := range keys {
@@ -33,497 +36,336 @@ func getStringField(m map[string]interface{}, keys ...string) string {
 	return ""
 }
 
-
 // ---------------------
 // Utility Functions
 // ---------------------
 
-func printError(resp *http.Response) {
-	var body map[string]interface{}
-	_ = json.NewDecoder(resp.Body).Decode(&body)
-	fmt.Printf("Status: %d\nBody: %+v\n", resp.StatusCode, body)
-}
-
 func setupAdmin(t *testing.T) {
-	client := &http.Client{}
-	req := map[string]string{"username": "admin", "password": "supersecret"}
-	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(req)
-	resp, err := client.Post(baseURL+"/setup", "application/json", buf)
-	assert.NoError(t, err)
-	if resp.StatusCode != 200 && resp.StatusCode != 403 {
-		printError(resp)
-		t.Fatalf("Admin setup failed: %s", resp.Status)
+	err := client.New(baseURL).Setup(ctx, "admin", "supersecret")
+	if err != nil && !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("Admin setup failed: %v", err)
 	}
 }
 
-func getToken(t *testing.T, username, password string) string {
-	client := &http.Client{}
-	req := map[string]string{"username": username, "password": password}
-	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(req)
-	resp, err := client.Post(baseURL+"/login", "application/json", buf)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-	var body struct {
-		Token string `json:"token"`
-	}
-	_ = json.NewDecoder(resp.Body).Decode(&body)
-	return body.Token
+// login returns a client that keeps itself logged in as the user
+func login(t *testing.T, username, password string) *client.Client {
+	c := client.New(baseURL, client.WithCredentials(username, password))
+	_, err := c.Login(ctx, username, password)
+	require.NoError(t, err)
+	return c
 }
 
-// Handles both ID/id and Username/username key styles
-func getUserID(t *testing.T, token, username string) int {
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", baseURL+"/users/", nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	var users []map[string]interface{}
-	_ = json.NewDecoder(resp.Body).Decode(&users)
-
-	for _, u := range users {
-		var uname string
-		if v, ok := u["username"].(string); ok {
-			uname = v
-		} else if v, ok := u["Username"].(string); ok {
-			uname = v
-		}
-		if uname == username {
-			if idf, ok := u["id"].(float64); ok {
-				return int(idf)
-			}
-			if idf, ok := u["ID"].(float64); ok {
-				return int(idf)
-			}
-		}
-	}
-	t.Fatalf("User %s not found in /users/ response", username)
-	return -1
+func createUser(t *testing.T, admin *client.Client, username, password string) {
+	err := admin.CreateUser(ctx, client.UserCreate{Username: username, Password: password})
+	require.NoError(t, err)
 }
 
-func createWorkspace(t *testing.T, token, name string) int {
-	client := &http.Client{}
-	req := map[string]string{"name": name}
-	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(req)
-	request, _ := http.NewRequest("POST", baseURL+"/workspaces", buf)
-	request.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(request)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
+func getUserID(t *testing.T, c *client.Client, username string) int {
+	user, err := c.FindUser(ctx, username)
+	require.NoError(t, err, "User %s not found in /users/ response", username)
+	return user.ID
+}
 
-	var ws struct{ ID int `json:"id"` }
-	_ = json.NewDecoder(resp.Body).Decode(&ws)
+func createWorkspace(t *testing.T, c *client.Client, name string) int {
+	ws, err := c.CreateWorkspace(ctx, name)
+	require.NoError(t, err)
 	return ws.ID
 }
 
-func createFolder(t *testing.T, token string, wsID int, name string, parentID *int) int {
-	client := &http.Client{}
-	req := map[string]interface{}{"name": name}
-	if parentID != nil {
-		req["parent_id"] = *parentID
-	}
-	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(req)
-	request, _ := http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/folders", baseURL, wsID), buf)
-	request.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(request)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-	var folder struct{ ID int `json:"id"` }
-	_ = json.NewDecoder(resp.Body).Decode(&folder)
+func addMember(t *testing.T, owner *client.Client, wsID, userID int) {
+	assert.NoError(t, owner.AddMember(ctx, wsID, userID, "member"))
+}
+
+func createFolder(t *testing.T, c *client.Client, wsID int, name string, parentID *int) int {
+	folder, err := c.CreateFolder(ctx, wsID, name, parentID)
+	require.NoError(t, err)
 	return folder.ID
 }
 
-func createNote(t *testing.T, token string, wsID int, title, content string, folderID *int, tags []string) int {
-	client := &http.Client{}
-	req := map[string]interface{}{
-		"title":   title,
-		"content": content,
-	}
-	if folderID != nil {
-		req["folder_id"] = *folderID
-	}
-	if tags != nil {
-		req["tags"] = tags
+// createNote creates a note and, since note bodies live in Yjs, indexes
+// content as its search text
+func createNote(t *testing.T, c *client.Client, wsID int, title, content string, folderID *int, tags []string) int {
+	note, err := c.CreateNote(ctx, wsID, client.NoteCreate{Title: title, FolderID: folderID, Tags: tags})
+	require.NoError(t, err)
+	if content != "" {
+		assert.NoError(t, c.SetNoteSearchText(ctx, wsID, note.ID, content))
 	}
-	buf := new(bytes.Buffer)
-	_ = json.NewEncoder(buf).Encode(req)
-	request, _ := http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/notes", baseURL, wsID), buf)
-	request.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(request)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-	var note struct{ ID int `json:"id"` }
-	_ = json.NewDecoder(resp.Body).Decode(&note)
 	return note.ID
 }
 
-func getNote(t *testing.T, token string, wsID, noteID int) map[string]interface{} {
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/workspaces/%d/notes/%d", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+// getNoteJSON returns the raw note object for checks on fields the typed
+// client does not model
+func getNoteJSON(t *testing.T, c *client.Client, wsID, noteID int) map[string]interface{} {
 	var note map[string]interface{}
-	_ = json.NewDecoder(resp.Body).Decode(&note)
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%d/notes/%d", wsID, noteID), nil, &note)
+	assert.NoError(t, err)
 	return note
 }
 
+// noteEvent applies a granular edit through the REST events endpoint
+func noteEvent(t *testing.T, c *client.Client, wsID, noteID int, event map[string]interface{}) {
+	err := c.Do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/notes/%d/events", wsID, noteID), event, nil)
+	assert.NoError(t, err)
+}
+
+func undo(t *testing.T, c *client.Client, wsID, noteID int) {
+	err := c.Do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/notes/%d/undo", wsID, noteID), nil, nil)
+	assert.NoError(t, err)
+}
+
+func dialNote(t *testing.T, c *client.Client, wsID, noteID int) *websocket.Conn {
+	wsURL := strings.Replace(baseURL, "http", "ws", 1)
+	conn, _, err := websocket.DefaultDialer.Dial(
+		fmt.Sprintf("%s/workspaces/%d/notes/%d/ws", wsURL, wsID, noteID),
+		http.Header{"Authorization": []string{"Bearer " + c.Token()}},
+	)
+	require.NoError(t, err)
+	return conn
+}
+
 // ---------------------
 // Tests
 // ---------------------
 
 func TestHealth(t *testing.T) {
-	resp, err := http.Get(baseURL + "/health")
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-	var body map[string]interface{}
-	_ = json.NewDecoder(resp.Body).Decode(&body)
-	assert.Equal(t, "ok", body["status"])
+	assert.NoError(t, client.New(baseURL).Health(ctx))
 }
 
 func TestUserAdminFlow(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
-
-	client := &http.Client{}
-	body := map[string]interface{}{"username": "user1", "password": "user1pass", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(body)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
+	admin := login(t, "admin", "supersecret")
+
+	dbConn := connectDB(t)
+	defer dbConn.Close()
+	_, _ = dbConn.Exec("DELETE FROM users WHERE username IN ('user1', 'user1b')")
+
+	createUser(t, admin, "user1", "user1pass")
+	user := login(t, "user1", "user1pass")
+
+	// Every user may list accounts (needed for sharing), only admins create them
+	_, err := user.ListUsers(ctx)
 	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
+	err = user.CreateUser(ctx, client.UserCreate{Username: "user1b", Password: "pass"})
+	assert.ErrorIs(t, err, client.ErrForbidden)
 
-	userToken := getToken(t, "user1", "user1pass")
-	req, _ = http.NewRequest("GET", baseURL+"/users/", nil)
-	req.Header.Set("Authorization", "Bearer "+userToken)
-	resp, err = client.Do(req)
+	// Refresh issues a new working token
+	resp, err := user.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", resp.User.Username)
+	_, err = user.ListWorkspaces(ctx)
 	assert.NoError(t, err)
-	assert.Equal(t, 403, resp.StatusCode)
 }
 
 func TestWorkspaceFlow(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
-
-	client := &http.Client{}
-	reqBody := map[string]interface{}{"username": "member", "password": "mempass", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(reqBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ := client.Do(req)
-	assert.Equal(t, 201, resp.StatusCode)
-
-	memberID := getUserID(t, adminToken, "member")
-	memberToken := getToken(t, "member", "mempass")
-
-	wsID := createWorkspace(t, adminToken, "TestWS")
-	addReq := map[string]interface{}{"user_id": memberID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	req, _ = http.NewRequest("GET", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), nil)
-	req.Header.Set("Authorization", "Bearer "+memberToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	admin := login(t, "admin", "supersecret")
+
+	dbConn := connectDB(t)
+	defer dbConn.Close()
+	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'member'")
+
+	createUser(t, admin, "member", "mempass")
+	memberID := getUserID(t, admin, "member")
+	member := login(t, "member", "mempass")
+
+	wsID := createWorkspace(t, admin, "TestWS")
+	addMember(t, admin, wsID, memberID)
+
+	members, err := member.ListMembers(ctx, wsID)
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Members cannot rename the workspace
+	err = member.RenameWorkspace(ctx, wsID, "Hijacked")
+	assert.ErrorIs(t, err, client.ErrForbidden)
 }
 
 func TestNoteLifecycleAndTags(t *testing.T) {
 	setupAdmin(t)
-	token := getToken(t, "admin", "supersecret")
-	wsID := createWorkspace(t, token, "NotesWS")
+	c := login(t, "admin", "supersecret")
+	wsID := createWorkspace(t, c, "NotesWS")
 
-	folderID := createFolder(t, token, wsID, "Folder1", nil)
-	noteID := createNote(t, token, wsID, "My Note", "Hello world", &folderID, []string{"Go", "Test"})
+	folderID := createFolder(t, c, wsID, "Folder1", nil)
+	noteID := createNote(t, c, wsID, "My Note", "Hello world", &folderID, []string{"Go", "Test"})
 
-	note := getNote(t, token, wsID, noteID)
+	note, err := c.GetNote(ctx, wsID, noteID)
+	require.NoError(t, err)
+	assert.Equal(t, "My Note", note.Title)
+	require.NotNil(t, note.FolderID)
+	assert.Equal(t, folderID, *note.FolderID)
+	assert.Len(t, note.Tags, 2)
 
-	title := note["Title"]
-	if title == nil {
-		title = note["title"]
+	hits, err := c.Search(ctx, "Hello", client.SearchOptions{Mode: "full"})
+	assert.NoError(t, err)
+	found := false
+	for _, hit := range hits {
+		found = found || hit.ID == noteID
 	}
-	assert.Equal(t, "My Note", title)
-	content := note["Content"]
-	if content == nil {
-		content = note["content"]
+	assert.True(t, found, "full-text search should find the note by its content")
+
+	title := "Renamed"
+	note, err = c.UpdateNote(ctx, wsID, noteID, client.NoteUpdate{Title: &title, MoveToRoot: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", note.Title)
+	assert.Nil(t, note.FolderID)
+
+	assert.NoError(t, c.SetNoteTags(ctx, wsID, noteID, []string{"Go"}))
+	var listed []int
+	for n, err := range c.Notes(ctx, wsID, client.NoteListOptions{Tag: "go", Limit: 1}) {
+		require.NoError(t, err)
+		listed = append(listed, n.ID)
 	}
-	assert.True(t, strings.Contains(content.(string), "Hello"))
+	assert.Equal(t, []int{noteID}, listed)
+
+	assert.NoError(t, c.DeleteNote(ctx, wsID, noteID))
+	_, err = c.GetNote(ctx, wsID, noteID)
+	assert.ErrorIs(t, err, client.ErrNotFound)
 }
 
 func TestGranularNoteEventEdit(t *testing.T) {
 	setupAdmin(t)
-	token := getToken(t, "admin", "supersecret")
-	wsID := createWorkspace(t, token, "EventWS")
-	noteID := createNote(t, token, wsID, "Event Note", "abc", nil, nil)
-
-	client := &http.Client{}
-	event := map[string]interface{}{"op_type": "insert", "position": 1, "text": "X"}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(event)
-	req, _ := http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	c := login(t, "admin", "supersecret")
+	wsID := createWorkspace(t, c, "EventWS")
+	noteID := createNote(t, c, wsID, "Event Note", "abc", nil, nil)
 
-updated := getNote(t, token, wsID, noteID)
-assert.Equal(t, "aXbc", getStringField(updated, "content", "Content"))
+	noteEvent(t, c, wsID, noteID, map[string]interface{}{"op_type": "insert", "position": 1, "text": "X"})
 
+	updated := getNoteJSON(t, c, wsID, noteID)
+	assert.Equal(t, "aXbc", getStringField(updated, "content", "Content"))
 }
 
 // ✅ New Undo/Redo integration test
 func TestUndoRedoFlow(t *testing.T) {
 	setupAdmin(t)
-	token := getToken(t, "admin", "supersecret")
-	wsID := createWorkspace(t, token, "UndoWS")
-	noteID := createNote(t, token, wsID, "Undo Note", "abc", nil, nil)
-	client := &http.Client{}
+	c := login(t, "admin", "supersecret")
+	wsID := createWorkspace(t, c, "UndoWS")
+	noteID := createNote(t, c, wsID, "Undo Note", "abc", nil, nil)
 
 	// Apply an insert event
-	event := map[string]interface{}{"op_type": "insert", "position": 1, "text": "X"}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(event)
-	req, _ := http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	noteEvent(t, c, wsID, noteID, map[string]interface{}{"op_type": "insert", "position": 1, "text": "X"})
 
 	// Verify note content after insert
-	note := getNote(t, token, wsID, noteID)
-	content := note["content"]
+	note := getNoteJSON(t, c, wsID, noteID)
 	assert.Equal(t, "aXbc", getStringField(note, "content", "Content"))
 
 	// Perform Undo
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/undo", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	note = getNote(t, token, wsID, noteID)
-	content = note["content"]
-	if content == nil {
-		content = note["Content"]
-	}
-	assert.Equal(t, "abc", content)
+	undo(t, c, wsID, noteID)
+	note = getNoteJSON(t, c, wsID, noteID)
+	assert.Equal(t, "abc", getStringField(note, "content", "Content"))
 
 	// Perform Redo
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/redo", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err = client.Do(req)
+	err := c.Do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/notes/%d/redo", wsID, noteID), nil, nil)
 	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	note = getNote(t, token, wsID, noteID)
-	content = note["content"]
+	note = getNoteJSON(t, c, wsID, noteID)
 	assert.Equal(t, "aXbc", getStringField(note, "content", "Content"))
 
-// Verify history entries exist
-req, _ = http.NewRequest("GET",
-	fmt.Sprintf("%s/workspaces/%d/notes/%d/history", baseURL, wsID, noteID), nil)
-req.Header.Set("Authorization", "Bearer "+token)
-resp, err = client.Do(req)
-assert.NoError(t, err)
-assert.Equal(t, 200, resp.StatusCode)
-
-var body struct {
-	Events []map[string]interface{} `json:"events"`
-}
-_ = json.NewDecoder(resp.Body).Decode(&body)
-assert.True(t, len(body.Events) >= 1, "expected at least one edit event in history")
-
+	// Verify history entries exist
+	var body struct {
+		Events []map[string]interface{} `json:"events"`
+	}
+	err = c.Do(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%d/notes/%d/history", wsID, noteID), nil, &body)
+	assert.NoError(t, err)
+	assert.True(t, len(body.Events) >= 1, "expected at least one edit event in history")
 }
 
 func TestTrashAndRetention(t *testing.T) {
 	setupAdmin(t)
-	token := getToken(t, "admin", "supersecret")
-	wsID := createWorkspace(t, token, "TrashWS")
+	c := login(t, "admin", "supersecret")
+	wsID := createWorkspace(t, c, "TrashWS")
 
-	noteID := createNote(t, token, wsID, "Old Note", "Delete me", nil, nil)
-	client := &http.Client{}
+	noteID := createNote(t, c, wsID, "Old Note", "Delete me", nil, nil)
+	assert.NoError(t, c.TrashNote(ctx, wsID, noteID))
 
-	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/notes/%d/trash", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, _ := client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	trashed, err := c.ListTrash(ctx, wsID)
+	assert.NoError(t, err)
+	assert.Len(t, trashed, 1)
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("UPDATE notes SET trashed_at = NOW() - INTERVAL '31 days' WHERE id = $1", noteID)
-	assert.NoError(t, db.AutoEmptyTrash(dbConn))
-
-	req, _ = http.NewRequest("GET", fmt.Sprintf("%s/workspaces/%d/trash", baseURL, wsID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
-	var notes []map[string]interface{}
-	_ = json.NewDecoder(resp.Body).Decode(&notes)
-	assert.Equal(t, 0, len(notes))
+	assert.NoError(t, db.NewStore(dbConn).AutoEmptyTrash(context.Background()))
+
+	trashed, err = c.ListTrash(ctx, wsID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(trashed))
+
+	err = c.RestoreNote(ctx, wsID, noteID)
+	assert.ErrorIs(t, err, client.ErrNotFound)
 }
 
 func TestUndoRedoMultiUserIsolation(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
-	// Create a second user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "user2", "password": "pass2", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
+	dbConn := connectDB(t)
+	defer dbConn.Close()
+	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'user2'")
 
-	user2Token := getToken(t, "user2", "pass2")
-	user2ID := getUserID(t, adminToken, "user2")
+	// Create a second user
+	createUser(t, admin, "user2", "pass2")
+	user2 := login(t, "user2", "pass2")
+	user2ID := getUserID(t, admin, "user2")
 
 	// Create workspace and share with user2
-	wsID := createWorkspace(t, adminToken, "UndoIsolationWS")
-	addReq := map[string]interface{}{"user_id": user2ID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	wsID := createWorkspace(t, admin, "UndoIsolationWS")
+	addMember(t, admin, wsID, user2ID)
 
 	// Admin creates a note and writes "hello there"
-	noteID := createNote(t, adminToken, wsID, "Shared Note", "hello there", nil, nil)
+	noteID := createNote(t, admin, wsID, "Shared Note", "hello there", nil, nil)
 
 	// user2 deletes "o there" and inserts " no"
-	event := map[string]interface{}{"op_type": "delete", "position": 4, "length": 7}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(event)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+user2Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	event = map[string]interface{}{"op_type": "insert", "position": 4, "text": " no"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(event)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+user2Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	noteEvent(t, user2, wsID, noteID, map[string]interface{}{"op_type": "delete", "position": 4, "length": 7})
+	noteEvent(t, user2, wsID, noteID, map[string]interface{}{"op_type": "insert", "position": 4, "text": " no"})
 
 	// Verify final content: "hell no"
-	note := getNote(t, adminToken, wsID, noteID)
-	content := getStringField(note, "content", "Content")
-	assert.Equal(t, "hell no", content)
+	note := getNoteJSON(t, admin, wsID, noteID)
+	assert.Equal(t, "hell no", getStringField(note, "content", "Content"))
 
 	// Admin presses Undo — should revert their own "hello there" edit but not user2’s
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/undo", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	undo(t, admin, wsID, noteID)
 
 	// Content should remain "hell no" since user2’s edits remain untouched
-	note = getNote(t, adminToken, wsID, noteID)
-	content = getStringField(note, "content", "Content")
-	assert.Equal(t, "hell no", content)
-
-	// user2 can now undo their last edit — should restore the deleted section
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/undo", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+user2Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	note = getNoteJSON(t, admin, wsID, noteID)
+	assert.Equal(t, "hell no", getStringField(note, "content", "Content"))
 
-	// user2 undoes again (their delete)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/undo", baseURL, wsID, noteID), nil)
-	req.Header.Set("Authorization", "Bearer "+user2Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
+	// user2 can now undo their last edit, then again (their delete)
+	undo(t, user2, wsID, noteID)
+	undo(t, user2, wsID, noteID)
 
 	// After both of user2’s undos, content should return to "hello there"
-	note = getNote(t, adminToken, wsID, noteID)
-	content = getStringField(note, "content", "Content")
-	assert.Equal(t, "hello there", content)
+	note = getNoteJSON(t, admin, wsID, noteID)
+	assert.Equal(t, "hello there", getStringField(note, "content", "Content"))
 }
 
-
 func TestRealtimeCollaboration(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'user2'")
 
 	// Create second user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "user2", "password": "pass2", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-
-	user2Token := getToken(t, "user2", "pass2")
-	user2ID := getUserID(t, adminToken, "user2")
+	createUser(t, admin, "user2", "pass2")
+	user2 := login(t, "user2", "pass2")
+	user2ID := getUserID(t, admin, "user2")
 
 	// Create workspace and share with user2
-	wsID := createWorkspace(t, adminToken, "RealtimeWS")
-	addReq := map[string]interface{}{"user_id": user2ID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	wsID := createWorkspace(t, admin, "RealtimeWS")
+	addMember(t, admin, wsID, user2ID)
 
 	// Create note
-	noteID := createNote(t, adminToken, wsID, "Live Note", "abc", nil, nil)
+	noteID := createNote(t, admin, wsID, "Live Note", "abc", nil, nil)
 
 	// Open WebSocket connections for both users
-	wsURL := strings.Replace(baseURL, "http", "ws", 1)
-	adminWS, _, err := websocket.DefaultDialer.Dial(
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/ws", wsURL, wsID, noteID),
-		http.Header{"Authorization": []string{"Bearer " + adminToken}},
-	)
-	assert.NoError(t, err)
+	adminWS := dialNote(t, admin, wsID, noteID)
 	defer adminWS.Close()
 
 	// Admin receives presence_list
 	adminWS.SetReadDeadline(time.Now().Add(2 * time.Second))
 	_, _, _ = adminWS.ReadMessage()
 
-	user2WS, _, err := websocket.DefaultDialer.Dial(
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/ws", wsURL, wsID, noteID),
-		http.Header{"Authorization": []string{"Bearer " + user2Token}},
-	)
-	assert.NoError(t, err)
+	user2WS := dialNote(t, user2, wsID, noteID)
 	defer user2WS.Close()
 
 	// user2 receives presence_list
@@ -553,67 +395,42 @@ func TestRealtimeCollaboration(t *testing.T) {
 	user2WS.SetReadDeadline(time.Now().Add(2 * time.Second))
 	var broadcast map[string]interface{}
 	for i := 0; i < 5; i++ {
-		_, msg, err := user2WS.ReadMessage()
-		if err != nil {
+		if err := user2WS.ReadJSON(&broadcast); err != nil {
 			break
 		}
-		if err := json.Unmarshal(msg, &broadcast); err == nil {
-			if broadcast["type"] == "edit_applied" {
-				break
-			}
+		if broadcast["type"] == "edit_applied" {
+			break
 		}
 	}
 	assert.Equal(t, "edit_applied", broadcast["type"])
 
 	// Confirm persisted change via REST
-	note := getNote(t, adminToken, wsID, noteID)
-	content := getStringField(note, "content", "Content")
-	assert.Equal(t, "aXbc", content)
+	note := getNoteJSON(t, admin, wsID, noteID)
+	assert.Equal(t, "aXbc", getStringField(note, "content", "Content"))
 }
 
-
 func TestPresenceTracking(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'user3'")
 
 	// Create second user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "user3", "password": "pass3", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-
-	user3Token := getToken(t, "user3", "pass3")
-	user3ID := getUserID(t, adminToken, "user3")
+	createUser(t, admin, "user3", "pass3")
+	user3 := login(t, "user3", "pass3")
+	user3ID := getUserID(t, admin, "user3")
 
 	// Create workspace and share with user3
-	wsID := createWorkspace(t, adminToken, "PresenceWS")
-	addReq := map[string]interface{}{"user_id": user3ID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	wsID := createWorkspace(t, admin, "PresenceWS")
+	addMember(t, admin, wsID, user3ID)
 
 	// Create note
-	noteID := createNote(t, adminToken, wsID, "Presence Note", "test", nil, nil)
+	noteID := createNote(t, admin, wsID, "Presence Note", "test", nil, nil)
 
 	// Connect admin WebSocket
-	wsURL := strings.Replace(baseURL, "http", "ws", 1)
-	adminWS, _, err := websocket.DefaultDialer.Dial(
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/ws", wsURL, wsID, noteID),
-		http.Header{"Authorization": []string{"Bearer " + adminToken}},
-	)
-	assert.NoError(t, err)
+	adminWS := dialNote(t, admin, wsID, noteID)
 	defer adminWS.Close()
 
 	// Admin receives presence_list
@@ -621,11 +438,7 @@ func TestPresenceTracking(t *testing.T) {
 	_, _, _ = adminWS.ReadMessage()
 
 	// Connect user3 WebSocket
-	user3WS, _, err := websocket.DefaultDialer.Dial(
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/ws", wsURL, wsID, noteID),
-		http.Header{"Authorization": []string{"Bearer " + user3Token}},
-	)
-	assert.NoError(t, err)
+	user3WS := dialNote(t, user3, wsID, noteID)
 	defer user3WS.Close()
 
 	// user3 receives presence_list
@@ -659,10 +472,8 @@ func TestPresenceTracking(t *testing.T) {
 
 	// user3 receives admin's presence update
 	user3WS.SetReadDeadline(time.Now().Add(2 * time.Second))
-	_, msg, err := user3WS.ReadMessage()
-	assert.NoError(t, err)
 	var cursorUpdate map[string]interface{}
-	assert.NoError(t, json.Unmarshal(msg, &cursorUpdate))
+	require.NoError(t, user3WS.ReadJSON(&cursorUpdate))
 	assert.Equal(t, "presence_update", cursorUpdate["type"])
 
 	payload := cursorUpdate["payload"].(map[string]interface{})
@@ -672,7 +483,7 @@ func TestPresenceTracking(t *testing.T) {
 
 	// Verify presence persisted in database
 	var count int
-	err = dbConn.QueryRow("SELECT COUNT(*) FROM note_presence WHERE note_id = $1", noteID).Scan(&count)
+	err := dbConn.QueryRow("SELECT COUNT(*) FROM note_presence WHERE note_id = $1", noteID).Scan(&count)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, count)
 
@@ -684,14 +495,11 @@ func TestPresenceTracking(t *testing.T) {
 	adminWS.SetReadDeadline(time.Now().Add(2 * time.Second))
 	var leftMsg map[string]interface{}
 	for i := 0; i < 5; i++ {
-		_, msg, err := adminWS.ReadMessage()
-		if err != nil {
+		if err := adminWS.ReadJSON(&leftMsg); err != nil {
 			break
 		}
-		if err := json.Unmarshal(msg, &leftMsg); err == nil {
-			if leftMsg["type"] == "presence_left" {
-				break
-			}
+		if leftMsg["type"] == "presence_left" {
+			break
 		}
 	}
 	assert.Equal(t, "presence_left", leftMsg["type"])
@@ -702,265 +510,228 @@ func TestPresenceTracking(t *testing.T) {
 	assert.Equal(t, 1, count)
 }
 
+// offlineSync replays edits made while offline against the last known version
+func offlineSync(t *testing.T, c *client.Client, wsID, noteID int, lastKnownVersion string, op map[string]interface{}) map[string]interface{} {
+	op["timestamp"] = time.Now().Format(time.RFC3339)
+	syncReq := map[string]interface{}{
+		"last_known_version": lastKnownVersion,
+		"operations":         []map[string]interface{}{op},
+	}
+	var syncResult map[string]interface{}
+	err := c.Do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/notes/%d/sync", wsID, noteID), syncReq, &syncResult)
+	assert.NoError(t, err)
+	return syncResult
+}
 
 func TestOfflineEditingNoConflict(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'user4'")
 
 	// Create second user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "user4", "password": "pass4", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-
-	user4Token := getToken(t, "user4", "pass4")
-	user4ID := getUserID(t, adminToken, "user4")
+	createUser(t, admin, "user4", "pass4")
+	user4 := login(t, "user4", "pass4")
+	user4ID := getUserID(t, admin, "user4")
 
 	// Create workspace and share with user4
-	wsID := createWorkspace(t, adminToken, "OfflineWS")
-	addReq := map[string]interface{}{"user_id": user4ID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	wsID := createWorkspace(t, admin, "OfflineWS")
+	addMember(t, admin, wsID, user4ID)
 
 	// Create note with initial content
-	noteID := createNote(t, adminToken, wsID, "Offline Note", "Initial content here.", nil, nil)
+	noteID := createNote(t, admin, wsID, "Offline Note", "Initial content here.", nil, nil)
 
 	// Get note to capture version
-	note := getNote(t, adminToken, wsID, noteID)
-// Try both possible keys for updated_at
-var lastKnownVersion string
-if v, ok := note["updated_at"].(string); ok {
-	lastKnownVersion = v
-} else if v, ok := note["Updated_at"].(string); ok {
-	lastKnownVersion = v
-} else if v, ok := note["UpdatedAt"].(string); ok {
-	lastKnownVersion = v
-} else {
-	t.Fatal("Could not find updated_at timestamp in note response")
-}
-
-// Admin edits position 100 (far from user4's edit)
-event := map[string]interface{}{"op_type": "insert", "position": 21, "text": " Admin edit."}
-buf = new(bytes.Buffer)
-json.NewEncoder(buf).Encode(event)
-req, _ = http.NewRequest("POST",
-	fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-req.Header.Set("Authorization", "Bearer "+adminToken)
-resp, _ = client.Do(req)
-if resp.StatusCode != 200 {
-	var errBody map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&errBody)
-	t.Logf("Events endpoint error: %+v", errBody)
-}
-assert.Equal(t, 200, resp.StatusCode)
+	note, err := admin.GetNote(ctx, wsID, noteID)
+	require.NoError(t, err)
+	lastKnownVersion := note.UpdatedAt
 
+	// Admin edits position 21 (far from user4's edit)
+	noteEvent(t, admin, wsID, noteID, map[string]interface{}{"op_type": "insert", "position": 21, "text": " Admin edit."})
 
 	// user4 "goes offline" and edits position 0-10 (different area)
-	syncReq := map[string]interface{}{
-		"last_known_version": lastKnownVersion,
-		"operations": []map[string]interface{}{
-			{
-				"op_type":   "replace",
-				"position":  0,
-				"length":    7,
-				"text":      "Updated",
-				"timestamp": time.Now().Format(time.RFC3339),
-			},
-		},
-	}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(syncReq)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/sync", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+user4Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	var syncResult map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&syncResult)
+	syncResult := offlineSync(t, user4, wsID, noteID, lastKnownVersion, map[string]interface{}{
+		"op_type":  "replace",
+		"position": 0,
+		"length":   7,
+		"text":     "Updated",
+	})
 	assert.Equal(t, true, syncResult["success"])
 	assert.Equal(t, false, syncResult["conflict"]) // No conflict - different areas
 
 	// Verify final content
-	note = getNote(t, adminToken, wsID, noteID)
-	content := getStringField(note, "content", "Content")
-	assert.Contains(t, content, "Updated") // user4's change
+	content := getStringField(getNoteJSON(t, admin, wsID, noteID), "content", "Content")
+	assert.Contains(t, content, "Updated")     // user4's change
 	assert.Contains(t, content, "Admin edit.") // admin's change
 }
 
 func TestOfflineEditingWithConflict(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'user5'")
 
 	// Create second user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "user5", "password": "pass5", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, err := client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 201, resp.StatusCode)
-
-	user5Token := getToken(t, "user5", "pass5")
-	user5ID := getUserID(t, adminToken, "user5")
+	createUser(t, admin, "user5", "pass5")
+	user5 := login(t, "user5", "pass5")
+	user5ID := getUserID(t, admin, "user5")
 
 	// Create workspace and share with user5
-	wsID := createWorkspace(t, adminToken, "ConflictWS")
-	addReq := map[string]interface{}{"user_id": user5ID, "role": "member"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(addReq)
-	req, _ = http.NewRequest("POST", fmt.Sprintf("%s/workspaces/%d/members", baseURL, wsID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	wsID := createWorkspace(t, admin, "ConflictWS")
+	addMember(t, admin, wsID, user5ID)
 
 	// Create note
-	noteID := createNote(t, adminToken, wsID, "Conflict Note", "Hello world test", nil, nil)
+	noteID := createNote(t, admin, wsID, "Conflict Note", "Hello world test", nil, nil)
 
 	// Capture version before conflict
-	note := getNote(t, adminToken, wsID, noteID)
-// Try both possible keys for updated_at
-var lastKnownVersion string
-if v, ok := note["updated_at"].(string); ok {
-	lastKnownVersion = v
-} else if v, ok := note["Updated_at"].(string); ok {
-	lastKnownVersion = v
-} else if v, ok := note["UpdatedAt"].(string); ok {
-	lastKnownVersion = v
-} else {
-	t.Fatal("Could not find updated_at timestamp in note response")
-}
+	note, err := admin.GetNote(ctx, wsID, noteID)
+	require.NoError(t, err)
+	lastKnownVersion := note.UpdatedAt
 
 	// Admin edits chars 0-5 (overlapping area)
-	event := map[string]interface{}{"op_type": "replace", "position": 0, "length": 5, "text": "Goodbye"}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(event)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/events", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-	resp, _ = client.Do(req)
-	assert.Equal(t, 200, resp.StatusCode)
+	noteEvent(t, admin, wsID, noteID, map[string]interface{}{"op_type": "replace", "position": 0, "length": 5, "text": "Goodbye"})
 
 	// user5 tries to sync edit at chars 3-8 (OVERLAPS with admin's 0-5)
-	syncReq := map[string]interface{}{
-		"last_known_version": lastKnownVersion,
-		"operations": []map[string]interface{}{
-			{
-				"op_type":   "replace",
-				"position":  3,
-				"length":    5,
-				"text":      "CONFLICT",
-				"timestamp": time.Now().Format(time.RFC3339),
-			},
-		},
-	}
-	buf = new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(syncReq)
-	req, _ = http.NewRequest("POST",
-		fmt.Sprintf("%s/workspaces/%d/notes/%d/sync", baseURL, wsID, noteID), buf)
-	req.Header.Set("Authorization", "Bearer "+user5Token)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	var syncResult map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&syncResult)
+	syncResult := offlineSync(t, user5, wsID, noteID, lastKnownVersion, map[string]interface{}{
+		"op_type":  "replace",
+		"position": 3,
+		"length":   5,
+		"text":     "CONFLICT",
+	})
 	assert.Equal(t, true, syncResult["success"])
 	assert.Equal(t, true, syncResult["conflict"]) // Conflict detected
 
 	// Verify conflict section was appended
-	note = getNote(t, adminToken, wsID, noteID)
-	content := getStringField(note, "content", "Content")
+	content := getStringField(getNoteJSON(t, admin, wsID, noteID), "content", "Content")
 	assert.Contains(t, content, "🔄 Your Offline Changes") // Conflict marker
-	assert.Contains(t, content, "Your offline version:") // Conflict section
-	assert.Contains(t, content, "Goodbye") // Server version preserved
+	assert.Contains(t, content, "Your offline version:")  // Conflict section
+	assert.Contains(t, content, "Goodbye")                // Server version preserved
 }
 
-
 func TestDefaultWorkspaceCreation(t *testing.T) {
 	setupAdmin(t)
-	adminToken := getToken(t, "admin", "supersecret")
+	admin := login(t, "admin", "supersecret")
 
 	dbConn := connectDB(t)
 	defer dbConn.Close()
 	_, _ = dbConn.Exec("DELETE FROM users WHERE username = 'testdefault'")
 
-	// Create a new user
-	client := &http.Client{}
-	userBody := map[string]interface{}{"username": "testdefault", "password": "pass123", "is_admin": false}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(userBody)
-	req, _ := http.NewRequest("POST", baseURL+"/users/", buf)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
-resp, err := client.Do(req)
-assert.NoError(t, err)
-if resp.StatusCode != 201 {
-    bodyBytes, _ := io.ReadAll(resp.Body)
-    t.Logf("User creation failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-}
-assert.Equal(t, 201, resp.StatusCode)
-
-	// Login as new user
-	newUserToken := getToken(t, "testdefault", "pass123")
+	// Create a new user and log in
+	createUser(t, admin, "testdefault", "pass123")
+	newUser := login(t, "testdefault", "pass123")
 
 	// List workspaces - should have exactly 1 default workspace
-	req, _ = http.NewRequest("GET", baseURL+"/workspaces", nil)
-	req.Header.Set("Authorization", "Bearer "+newUserToken)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	var workspaces []map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&workspaces)
+	workspaces, err := newUser.ListWorkspaces(ctx)
+	require.NoError(t, err)
 	t.Logf("Workspaces response: %+v", workspaces)
-	assert.Equal(t, 1, len(workspaces), "New user should have exactly 1 default workspace")
-	assert.Contains(t, workspaces[0]["Name"], "testdefault's Workspace")
+	require.Equal(t, 1, len(workspaces), "New user should have exactly 1 default workspace")
+	assert.Contains(t, workspaces[0].Name, "testdefault's Workspace")
+	assert.Equal(t, "owner", workspaces[0].Role)
 
-	wsID := int(workspaces[0]["ID"].(float64))
+	wsID := workspaces[0].ID
 
 	// List notes in default workspace - should have 1 guide note
-	req, _ = http.NewRequest("GET", fmt.Sprintf("%s/workspaces/%d/notes", baseURL, wsID), nil)
-	req.Header.Set("Authorization", "Bearer "+newUserToken)
-	resp, err = client.Do(req)
-	assert.NoError(t, err)
-	assert.Equal(t, 200, resp.StatusCode)
-
-	var notes []map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&notes)
-	assert.Equal(t, 1, len(notes), "Default workspace should have exactly 1 guide note")
-
-	noteTitle := getStringField(notes[0], "title", "Title")
-	assert.Equal(t, "Intro & Guide", noteTitle)
+	notes, err := newUser.ListNotes(ctx, wsID, client.NoteListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(notes), "Default workspace should have exactly 1 guide note")
+	assert.Equal(t, "Intro & Guide", notes[0].Title)
 
-	noteContent := getStringField(notes[0], "content", "Content")
+	guide := getNoteJSON(t, newUser, wsID, notes[0].ID)
+	noteContent := getStringField(guide, "content", "Content")
 	assert.Contains(t, noteContent, "Welcome to go-notes!")
 	assert.Contains(t, noteContent, "Markdown Formatting")
-	
+
 	// Verify note color is white by default
-	noteColor := getStringField(notes[0], "color", "Color")
-	assert.Equal(t, "#FFFFFF", noteColor)
+	assert.Equal(t, "#FFFFFF", notes[0].Color)
+}
+
+// syncChanges reads the sync delta since a cursor, or everything for ""
+func syncChanges(t *testing.T, c *client.Client, since string) db.SyncChanges {
+	var changes db.SyncChanges
+	path := "/sync"
+	if since != "" {
+		path += "?since=" + since
+	}
+	require.NoError(t, c.Do(ctx, http.MethodGet, path, nil, &changes))
+	return changes
+}
+
+func syncedNote(changes db.SyncChanges, noteID int) *db.Note {
+	for i := range changes.Notes {
+		if changes.Notes[i].ID == noteID {
+			return &changes.Notes[i]
+		}
+	}
+	return nil
 }
 
+func TestSyncChangeLog(t *testing.T) {
+	setupAdmin(t)
+	c := login(t, "admin", "supersecret")
+	wsID := createWorkspace(t, c, "SyncWS")
+	folderID := createFolder(t, c, wsID, "Doomed", nil)
+	noteID := createNote(t, c, wsID, "Synced", "", nil, nil)
+	filedID := createNote(t, c, wsID, "Filed", "", &folderID, nil)
+
+	full := syncChanges(t, c, "")
+	assert.True(t, full.Full)
+	require.NotNil(t, syncedNote(full, noteID))
+	cursor := full.Cursor
+
+	dbConn := connectDB(t)
+	defer dbConn.Close()
+	logged := func(id int) int {
+		var n int
+		require.NoError(t, dbConn.QueryRow("SELECT COUNT(*) FROM sync_changes WHERE entity = 'note' AND entity_id = $1", id).Scan(&n))
+		return n
+	}
+
+	// Content edits leave no change rows: neither the search text nor what
+	// the document service writes
+	before := logged(noteID)
+	require.NoError(t, c.SetNoteSearchText(ctx, wsID, noteID, "edited body"))
+	_, err := dbConn.Exec("UPDATE notes SET content_text = 'saved', updated_at = NOW() WHERE id = $1", noteID)
+	require.NoError(t, err)
+	assert.Equal(t, before, logged(noteID))
+	delta := syncChanges(t, c, cursor)
+	assert.False(t, delta.Full)
+	assert.Nil(t, syncedNote(delta, noteID))
+
+	// Metadata changes are sent
+	title := "Renamed"
+	_, err = c.UpdateNote(ctx, wsID, noteID, client.NoteUpdate{Title: &title})
+	require.NoError(t, err)
+	delta = syncChanges(t, c, cursor)
+	require.NotNil(t, syncedNote(delta, noteID))
+	assert.Equal(t, "Renamed", syncedNote(delta, noteID).Title)
+	cursor = delta.Cursor
+
+	// Deleting a folder is a tombstone for it and trashes its notes
+	require.NoError(t, c.DeleteFolder(ctx, wsID, folderID))
+	delta = syncChanges(t, c, cursor)
+	assert.Contains(t, delta.Deleted.Folders, folderID)
+	require.NotNil(t, syncedNote(delta, filedID))
+	assert.True(t, syncedNote(delta, filedID).IsTrashed)
+	assert.Nil(t, syncedNote(delta, filedID).FolderID)
+	cursor = delta.Cursor
+
+	// Emptying the trash is a tombstone for each of its notes
+	require.NoError(t, c.TrashNote(ctx, wsID, noteID))
+	require.NoError(t, c.EmptyTrash(ctx, wsID))
+	delta = syncChanges(t, c, cursor)
+	assert.ElementsMatch(t, []int{noteID, filedID}, delta.Deleted.Notes)
+	assert.Nil(t, syncedNote(delta, noteID))
+
+	// Nothing is sent twice
+	again := syncChanges(t, c, delta.Cursor)
+	assert.Nil(t, syncedNote(again, filedID))
+	assert.NotContains(t, again.Deleted.Notes, noteID)
+	assert.NotContains(t, again.Deleted.Folders, folderID)
+}
 
 // ---------------------
 // DB Helper
@@ -0,0 +1,111 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+type exportJob struct {
+	db.ExportJob
+	heartbeat time.Time
+	expires   time.Time // zero while running
+}
+
+// --- Export Jobs ---
+
+func (s *Store) CreateExportJob(ctx context.Context, id string, workspaceID, userID int) (*db.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	j := &exportJob{
+		ExportJob: db.ExportJob{ID: id, WorkspaceID: workspaceID, UserID: userID, Status: "running", CreatedAt: stamp(now)},
+		heartbeat: now,
+	}
+	s.exportJobs[id] = j
+	out := j.ExportJob
+	return &out, nil
+}
+
+func (s *Store) GetExportJob(ctx context.Context, id string) (*db.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.exportJobs[id]
+	if !ok || (!j.expires.IsZero() && !s.now().Before(j.expires)) {
+		return nil, sql.ErrNoRows
+	}
+	out := j.ExportJob
+	return &out, nil
+}
+
+func (s *Store) CountRunningExportJobs(ctx context.Context, userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, j := range s.exportJobs {
+		if j.UserID == userID && j.Status == "running" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) TouchExportJob(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.exportJobs[id]; ok && j.Status == "running" {
+		j.heartbeat = s.now()
+	}
+	return nil
+}
+
+func (s *Store) FinishExportJob(ctx context.Context, id, status, errMsg string, size int64, retention time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.exportJobs[id]
+	if !ok || j.Status != "running" {
+		return false, nil
+	}
+	s.finishExportJob(j, status, errMsg, size, retention)
+	return true, nil
+}
+
+func (s *Store) finishExportJob(j *exportJob, status, errMsg string, size int64, retention time.Duration) {
+	now := s.now()
+	j.Status, j.Error, j.Size = status, errMsg, size
+	j.FinishedAt = stamp(now)
+	j.expires = now.Add(retention)
+}
+
+func (s *Store) FailStalledExportJobs(ctx context.Context, stalledAfter, retention time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-stalledAfter)
+	var ids []string
+	for id, j := range s.exportJobs {
+		if j.Status == "running" && j.heartbeat.Before(cutoff) {
+			s.finishExportJob(j, "failed", "the export was interrupted", 0, retention)
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *Store) DeleteExpiredExportJobs(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var ids []string
+	for id, j := range s.exportJobs {
+		if !j.expires.IsZero() && !now.Before(j.expires) {
+			delete(s.exportJobs, id)
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
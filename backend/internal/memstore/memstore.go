@@ -0,0 +1,1181 @@
+// Package memstore keeps users, workspaces, folders, notes, tags,
+// attachment metadata, saved searches, webhooks and export jobs in memory. It implements the store interfaces of the
+// server package with the same observable behaviour as the PostgreSQL
+// store, so handlers can be tested with httptest without a database.
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+type workspace struct {
+	db.Workspace
+	members map[int]string // user ID -> role
+}
+
+type note struct {
+	db.Note
+	createdAt   time.Time
+	updatedAt   time.Time
+	contentText string
+	content     []byte // Yjs state written by an import
+	tagIDs      map[int]bool
+}
+
+// Store is a concurrency-safe in-memory store. Lookups of missing rows
+// return sql.ErrNoRows like the database does.
+type Store struct {
+	mu sync.Mutex
+
+	nextID     int
+	users      map[int]*db.User
+	workspaces map[int]*workspace
+	folders    map[int]*db.Folder
+	notes      map[int]*note
+	tags       map[int]db.Tag
+
+	attachments map[int]*db.Attachment
+	blobs       map[string]time.Time // hash -> last used
+
+	savedSearches map[int]*db.SavedSearch
+	webhooks      map[int]*db.Webhook
+	deliveries    map[int64]*db.WebhookDelivery
+	syncStates    []syncState // indexed by sync cursor
+	exportJobs    map[string]*exportJob
+
+	// now is the clock for timestamps
+	now func() time.Time
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		users:      map[int]*db.User{},
+		workspaces: map[int]*workspace{},
+		folders:    map[int]*db.Folder{},
+		notes:      map[int]*note{},
+		tags:       map[int]db.Tag{},
+
+		attachments: map[int]*db.Attachment{},
+		blobs:       map[string]time.Time{},
+
+		savedSearches: map[int]*db.SavedSearch{},
+		webhooks:      map[int]*db.Webhook{},
+		deliveries:    map[int64]*db.WebhookDelivery{},
+		exportJobs:    map[string]*exportJob{},
+		now:           func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// WithTx runs fn against the store itself. There are no transactions in
+// memory: the changes fn made stay when it fails.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	return fn(s)
+}
+
+// IDs are unique across tables, which catches handlers mixing them up
+func (s *Store) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func stamp(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+// --- Users ---
+
+func (s *Store) GetUserCount(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users), nil
+}
+
+func (s *Store) CreateAdmin(ctx context.Context, username, passwordHash string) error {
+	return s.CreateUser(ctx, username, passwordHash, true)
+}
+
+// CreateUser adds a user with a default workspace and intro note. The intro
+// content lives in the document service and is not created here.
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string, isAdmin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			return fmt.Errorf("username %q already exists", username)
+		}
+	}
+	u := &db.User{ID: s.id(), Username: username, PasswordHash: passwordHash, IsAdmin: isAdmin, CreatedAt: stamp(s.now())}
+	s.users[u.ID] = u
+	wsID := s.createWorkspace("Default WS", u.ID)
+	_, err := s.createNote(wsID, "Intro & Guide", nil, &u.ID, "#FFFFFF")
+	return err
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (*db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *u
+	return &out, nil
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			out := *u
+			return &out, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) IsActiveUser(ctx context.Context, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	return ok && !u.Disabled, nil
+}
+
+// ListUsers omits password hashes, as the database listing does
+func (s *Store) ListUsers(ctx context.Context) ([]db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := []db.User{}
+	for _, u := range s.users {
+		out := *u
+		out.PasswordHash = ""
+		users = append(users, out)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int, username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username && u.ID != id {
+			return fmt.Errorf("username %q already exists", username)
+		}
+	}
+	if u, ok := s.users[id]; ok {
+		u.Username = username
+		u.PasswordHash = passwordHash
+	}
+	return nil
+}
+
+// SetUserDisabled blocks or re-enables a user
+func (s *Store) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.Disabled = disabled
+	}
+	return nil
+}
+
+// DeleteUser removes a user with the workspaces they own and their
+// memberships; notes they created elsewhere lose their creator
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	for wsID, w := range s.workspaces {
+		if w.OwnerID == id {
+			s.deleteWorkspace(wsID)
+			continue
+		}
+		delete(w.members, id)
+	}
+	for _, n := range s.notes {
+		if n.CreatedBy != nil && *n.CreatedBy == id {
+			n.CreatedBy = nil
+		}
+	}
+	for _, a := range s.attachments {
+		if a.CreatedBy != nil && *a.CreatedBy == id {
+			a.CreatedBy = nil
+		}
+	}
+	for searchID, ss := range s.savedSearches {
+		if ss.OwnerID == id {
+			delete(s.savedSearches, searchID)
+		}
+	}
+	for _, h := range s.webhooks {
+		if h.CreatedBy != nil && *h.CreatedBy == id {
+			h.CreatedBy = nil
+		}
+	}
+	return nil
+}
+
+// --- Workspaces ---
+
+func (s *Store) CreateWorkspace(ctx context.Context, name string, ownerID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[ownerID]; !ok {
+		return 0, fmt.Errorf("user %d does not exist", ownerID)
+	}
+	return s.createWorkspace(name, ownerID), nil
+}
+
+func (s *Store) createWorkspace(name string, ownerID int) int {
+	w := &workspace{
+		Workspace: db.Workspace{ID: s.id(), Name: name, OwnerID: ownerID, CreatedAt: stamp(s.now()), SearchLanguage: "english"},
+		members:   map[int]string{ownerID: "owner"},
+	}
+	s.workspaces[w.ID] = w
+	return w.ID
+}
+
+func (s *Store) ListWorkspaces(ctx context.Context, userID int) ([]db.Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var workspaces []db.Workspace
+	for _, w := range s.workspaces {
+		if _, ok := w.members[userID]; ok {
+			workspaces = append(workspaces, w.Workspace)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].ID < workspaces[j].ID })
+	return workspaces, nil
+}
+
+// GetWorkspace returns a workspace by ID
+func (s *Store) GetWorkspace(ctx context.Context, id int) (*db.Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := w.Workspace
+	return &out, nil
+}
+
+func (s *Store) UpdateWorkspace(ctx context.Context, id int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.workspaces[id]; ok {
+		w.Name = name
+	}
+	return nil
+}
+
+func (s *Store) DeleteWorkspace(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteWorkspace(id)
+	return nil
+}
+
+func (s *Store) deleteWorkspace(id int) {
+	delete(s.workspaces, id)
+	for folderID, f := range s.folders {
+		if f.WorkspaceID == id {
+			delete(s.folders, folderID)
+		}
+	}
+	for noteID, n := range s.notes {
+		if n.WorkspaceID == id {
+			s.deleteNote(noteID)
+		}
+	}
+	for searchID, ss := range s.savedSearches {
+		if ss.WorkspaceID != nil && *ss.WorkspaceID == id {
+			delete(s.savedSearches, searchID)
+		}
+	}
+	for hookID, h := range s.webhooks {
+		if h.WorkspaceID == id {
+			delete(s.webhooks, hookID)
+			// Deliveries outlive the webhook, as in the database
+			for _, d := range s.deliveries {
+				if d.WebhookID == hookID {
+					d.WebhookID = 0
+				}
+			}
+		}
+	}
+}
+
+func (s *Store) ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]db.WorkspaceMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return nil, nil
+	}
+	var members []db.WorkspaceMember
+	for userID, role := range w.members {
+		members = append(members, db.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].UserID < members[j].UserID })
+	return members, nil
+}
+
+// AddWorkspaceMember leaves an existing membership unchanged
+func (s *Store) AddWorkspaceMember(ctx context.Context, workspaceID, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return fmt.Errorf("workspace %d does not exist", workspaceID)
+	}
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+	if _, ok := w.members[userID]; !ok {
+		w.members[userID] = role
+	}
+	return nil
+}
+
+func (s *Store) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.workspaces[workspaceID]; ok {
+		delete(w.members, userID)
+	}
+	return nil
+}
+
+func (s *Store) TransferWorkspaceOwnership(ctx context.Context, workspaceID, newOwnerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return nil
+	}
+	if _, ok := s.users[newOwnerID]; !ok {
+		return fmt.Errorf("user %d does not exist", newOwnerID)
+	}
+	w.OwnerID = newOwnerID
+	for userID, role := range w.members {
+		if role == "owner" && userID != newOwnerID {
+			w.members[userID] = "member"
+		}
+	}
+	if _, ok := w.members[newOwnerID]; ok {
+		w.members[newOwnerID] = "owner"
+	}
+	return nil
+}
+
+func (s *Store) IsWorkspaceOwner(ctx context.Context, workspaceID, userID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	return ok && w.OwnerID == userID, nil
+}
+
+func (s *Store) IsWorkspaceMember(ctx context.Context, workspaceID, userID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return false, nil
+	}
+	_, member := w.members[userID]
+	return member, nil
+}
+
+// --- Folders ---
+
+func (s *Store) CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[workspaceID]; !ok {
+		return 0, fmt.Errorf("workspace %d does not exist", workspaceID)
+	}
+	if parentID != nil {
+		if _, ok := s.folders[*parentID]; !ok {
+			return 0, fmt.Errorf("folder %d does not exist", *parentID)
+		}
+	}
+	f := &db.Folder{ID: s.id(), WorkspaceID: workspaceID, ParentID: copyInt(parentID), Name: name, CreatedAt: stamp(s.now())}
+	s.folders[f.ID] = f
+	return f.ID, nil
+}
+
+func (s *Store) GetFolder(ctx context.Context, id int) (*db.Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.folders[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *f
+	out.ParentID = copyInt(f.ParentID)
+	return &out, nil
+}
+
+func (s *Store) ListFolders(ctx context.Context, workspaceID int) ([]db.Folder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var folders []db.Folder
+	for _, f := range s.folders {
+		if f.WorkspaceID == workspaceID {
+			out := *f
+			out.ParentID = copyInt(f.ParentID)
+			folders = append(folders, out)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].ID < folders[j].ID })
+	return folders, nil
+}
+
+// UpdateFolderWithCascade renames or moves a folder, refusing cycles;
+// moving it to another workspace takes its subtree and notes along
+func (s *Store) UpdateFolderWithCascade(ctx context.Context, folderID int, name string, parentID *int, workspaceID *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.folders[folderID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if parentID != nil && (f.ParentID == nil || *parentID != *f.ParentID) {
+		for _, id := range s.descendantFolderIDs(folderID) {
+			if id == *parentID {
+				return fmt.Errorf("cannot move folder into itself or its descendants")
+			}
+		}
+		if workspaceID != nil && *workspaceID != f.WorkspaceID {
+			parent, ok := s.folders[*parentID]
+			if !ok {
+				return fmt.Errorf("parent folder not found")
+			}
+			if parent.WorkspaceID != *workspaceID {
+				return fmt.Errorf("parent folder must be in target workspace")
+			}
+		}
+	}
+
+	f.Name = name
+	f.ParentID = copyInt(parentID)
+	if workspaceID == nil || *workspaceID == f.WorkspaceID {
+		return nil
+	}
+	target, ok := s.workspaces[*workspaceID]
+	if !ok {
+		return fmt.Errorf("workspace %d does not exist", *workspaceID)
+	}
+	subtree := map[int]bool{}
+	for _, id := range s.descendantFolderIDs(folderID) {
+		subtree[id] = true
+		s.folders[id].WorkspaceID = target.ID
+	}
+	for _, n := range s.notes {
+		if n.FolderID != nil && subtree[*n.FolderID] {
+			n.WorkspaceID = target.ID
+			if n.SearchLanguageInherited {
+				n.SearchLanguage = target.SearchLanguage
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteFolder deletes a folder and its subfolders. Their live notes are
+// trashed and all their notes move to the deleted folder's parent.
+func (s *Store) DeleteFolder(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.folders[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	subtree := map[int]bool{}
+	for _, folderID := range s.descendantFolderIDs(id) {
+		subtree[folderID] = true
+	}
+	trashedAt := stamp(s.now())
+	for _, n := range s.notes {
+		if n.FolderID == nil || !subtree[*n.FolderID] {
+			continue
+		}
+		if !n.IsTrashed {
+			n.IsTrashed = true
+			n.TrashedAt = &trashedAt
+		}
+		n.FolderID = copyInt(f.ParentID)
+	}
+	for folderID := range subtree {
+		delete(s.folders, folderID)
+	}
+	return nil
+}
+
+// descendantFolderIDs returns a folder's ID followed by those of all folders
+// below it
+func (s *Store) descendantFolderIDs(id int) []int {
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, f := range s.folders {
+			if f.ParentID != nil && *f.ParentID == ids[i] {
+				ids = append(ids, f.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// --- Notes ---
+
+func (s *Store) CreateNote(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createNote(workspaceID, title, folderID, createdBy, color)
+}
+
+func (s *Store) createNote(workspaceID int, title string, folderID *int, createdBy *int, color string) (int, error) {
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return 0, fmt.Errorf("workspace %d does not exist", workspaceID)
+	}
+	if folderID != nil {
+		if _, ok := s.folders[*folderID]; !ok {
+			return 0, fmt.Errorf("folder %d does not exist", *folderID)
+		}
+	}
+	if color == "" {
+		color = "#FFFFFF"
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	now := s.now()
+	n := &note{
+		Note: db.Note{
+			ID:                      s.id(),
+			WorkspaceID:             workspaceID,
+			Title:                   title,
+			FolderID:                copyInt(folderID),
+			CreatedBy:               copyInt(createdBy),
+			Color:                   color,
+			SearchLanguage:          w.SearchLanguage,
+			SearchLanguageInherited: true,
+		},
+		createdAt: now,
+		updatedAt: now,
+		tagIDs:    map[int]bool{},
+	}
+	n.YjsRoomID = fmt.Sprintf("w%d_n%d", workspaceID, n.ID)
+	s.notes[n.ID] = n
+	return n.ID, nil
+}
+
+// CreateNoteWithTags creates a note and sets its tags, or does neither
+func (s *Store) CreateNoteWithTags(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string, tags []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := s.createNote(workspaceID, title, folderID, createdBy, color)
+	if err != nil {
+		return 0, err
+	}
+	s.setTagsForNote(id, tags)
+	return id, nil
+}
+
+// ImportWorkspace creates a workspace with its folders, notes, tags and
+// content, or nothing when a folder key does not resolve
+func (s *Store) ImportWorkspace(ctx context.Context, ownerID int, in db.WorkspaceImport) (*db.ImportedWorkspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[ownerID]; !ok {
+		return nil, fmt.Errorf("user %d does not exist", ownerID)
+	}
+	known := map[int]bool{}
+	for _, f := range in.Folders {
+		if f.ParentKey != nil && !known[*f.ParentKey] {
+			return nil, fmt.Errorf("folder %d is not part of the import", *f.ParentKey)
+		}
+		known[f.Key] = true
+	}
+	for _, n := range in.Notes {
+		if n.FolderKey != nil && !known[*n.FolderKey] {
+			return nil, fmt.Errorf("folder %d is not part of the import", *n.FolderKey)
+		}
+	}
+
+	timeOr := func(t *time.Time, def time.Time) time.Time {
+		if t == nil {
+			return def
+		}
+		return t.UTC()
+	}
+	out := &db.ImportedWorkspace{WorkspaceID: s.createWorkspace(in.Name, ownerID), Folders: map[int]int{}, Notes: []db.ImportedNote{}}
+	w := s.workspaces[out.WorkspaceID]
+	w.CreatedAt = stamp(timeOr(in.CreatedAt, s.now()))
+	if in.SearchLanguage != "" {
+		w.SearchLanguage = in.SearchLanguage
+	}
+	for _, f := range in.Folders {
+		parentID, _ := out.FolderID(f.ParentKey)
+		folder := &db.Folder{ID: s.id(), WorkspaceID: w.ID, ParentID: parentID, Name: f.Name, CreatedAt: stamp(timeOr(f.CreatedAt, s.now()))}
+		s.folders[folder.ID] = folder
+		out.Folders[f.Key] = folder.ID
+	}
+	for _, src := range in.Notes {
+		folderID, _ := out.FolderID(src.FolderKey)
+		id, _ := s.createNote(w.ID, src.Title, folderID, &ownerID, src.Color)
+		n := s.notes[id]
+		n.createdAt = timeOr(src.CreatedAt, n.createdAt)
+		n.updatedAt = timeOr(src.UpdatedAt, n.createdAt)
+		if src.IsTrashed {
+			trashedAt := stamp(timeOr(src.TrashedAt, s.now()))
+			n.IsTrashed, n.TrashedAt = true, &trashedAt
+		}
+		if src.SearchLanguage != "" {
+			n.SearchLanguage, n.SearchLanguageInherited = src.SearchLanguage, false
+		}
+		n.content, n.contentText = src.Content, src.ContentText
+		s.setTagsForNote(id, src.Tags)
+		out.Notes = append(out.Notes, db.ImportedNote{Key: src.Key, ID: id, YjsRoomID: n.YjsRoomID})
+	}
+	return out, nil
+}
+
+// SetNoteContent stores a note's Yjs state and search text, with the
+// given timestamps when set
+func (s *Store) SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok {
+		return nil
+	}
+	n.content, n.contentText = content, contentText
+	if createdAt != nil {
+		n.createdAt, n.updatedAt = createdAt.UTC(), createdAt.UTC()
+	}
+	if updatedAt != nil {
+		n.updatedAt = updatedAt.UTC()
+	}
+	return nil
+}
+
+// export copies a note out of the store; tags are left for the caller
+func (n *note) export() db.Note {
+	out := n.Note
+	out.FolderID = copyInt(n.FolderID)
+	out.CreatedBy = copyInt(n.CreatedBy)
+	out.CreatedAt = stamp(n.createdAt)
+	out.UpdatedAt = stamp(n.updatedAt)
+	if n.TrashedAt != nil {
+		trashedAt := *n.TrashedAt
+		out.TrashedAt = &trashedAt
+	}
+	out.Tags = nil
+	return out
+}
+
+func (s *Store) GetNote(ctx context.Context, id int) (*db.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := n.export()
+	return &out, nil
+}
+
+// noteCursor mirrors the database store's cursor: the sort, the sort key
+// and the ID of the last note of a page
+type noteCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+// sortKey returns a note's key for a sort. Timestamps are formatted with a
+// fixed width so keys compare like the values they encode.
+func (n *note) sortKey(sort string) string {
+	switch sort {
+	case "updated":
+		return n.updatedAt.Format("2006-01-02T15:04:05.000000000")
+	case "title":
+		return strings.ToLower(n.Title)
+	case "color":
+		return n.Color
+	default:
+		return n.createdAt.Format("2006-01-02T15:04:05.000000000")
+	}
+}
+
+func (s *Store) ListNotesPage(ctx context.Context, workspaceID int, opts db.NoteListOptions) (*db.NotePage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "created"
+	}
+	if !db.IsValidNoteSort(opts.Sort) {
+		return nil, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+	var after *noteCursor
+	if opts.Cursor != "" {
+		var c noteCursor
+		b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil || json.Unmarshal(b, &c) != nil || c.Sort != opts.Sort {
+			return nil, db.ErrInvalidCursor
+		}
+		after = &c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tagID := 0
+	if opts.Tag != "" {
+		t, ok := s.findTag(opts.Tag)
+		if !ok {
+			return &db.NotePage{Notes: []db.Note{}}, nil
+		}
+		tagID = t.ID
+	}
+
+	less := func(a, b *note) bool {
+		ka, kb := a.sortKey(opts.Sort), b.sortKey(opts.Sort)
+		if ka != kb {
+			return ka < kb
+		}
+		return a.ID < b.ID
+	}
+	var matches []*note
+	for _, n := range s.notes {
+		switch {
+		case n.WorkspaceID != workspaceID,
+			opts.FolderID != nil && (n.FolderID == nil || *n.FolderID != *opts.FolderID),
+			opts.Trashed != nil && n.IsTrashed != *opts.Trashed,
+			tagID != 0 && !n.tagIDs[tagID],
+			opts.CreatedBy != nil && (n.CreatedBy == nil || *n.CreatedBy != *opts.CreatedBy):
+			continue
+		}
+		if after != nil {
+			key := n.sortKey(opts.Sort)
+			beyond := key > after.Key || (key == after.Key && n.ID > after.ID)
+			if opts.Desc {
+				beyond = key < after.Key || (key == after.Key && n.ID < after.ID)
+			}
+			if !beyond {
+				continue
+			}
+		}
+		matches = append(matches, n)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if opts.Desc {
+			return less(matches[j], matches[i])
+		}
+		return less(matches[i], matches[j])
+	})
+
+	page := &db.NotePage{Notes: []db.Note{}}
+	if opts.Limit > 0 && len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+		last := matches[opts.Limit-1]
+		b, _ := json.Marshal(noteCursor{Sort: opts.Sort, Key: last.sortKey(opts.Sort), ID: last.ID})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(b)
+	}
+	for _, n := range matches {
+		out := n.export()
+		out.Tags = s.tagsForNote(n)
+		page.Notes = append(page.Notes, out)
+	}
+	return page, nil
+}
+
+func (s *Store) ListTrashedNotes(ctx context.Context, workspaceID int) ([]db.Note, error) {
+	trashed := true
+	page, err := s.ListNotesPage(ctx, workspaceID, db.NoteListOptions{Trashed: &trashed})
+	if err != nil {
+		return nil, err
+	}
+	return page.Notes, nil
+}
+
+// UpdateNoteMetadata applies title, folder_id, workspace_id and color values
+// as decoded from JSON, so numbers arrive as float64
+func (s *Store) UpdateNoteMetadata(ctx context.Context, noteID int, updates map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok {
+		return nil
+	}
+	updated := *n
+	for field, value := range updates {
+		switch field {
+		case "title", "color":
+			str, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", field)
+			}
+			if field == "title" {
+				updated.Title = str
+			} else {
+				updated.Color = str
+			}
+		case "folder_id":
+			if value == nil {
+				updated.FolderID = nil
+				continue
+			}
+			id, err := intValue(field, value)
+			if err != nil {
+				return err
+			}
+			if _, ok := s.folders[id]; !ok {
+				return fmt.Errorf("folder %d does not exist", id)
+			}
+			updated.FolderID = &id
+		case "workspace_id":
+			id, err := intValue(field, value)
+			if err != nil {
+				return err
+			}
+			w, ok := s.workspaces[id]
+			if !ok {
+				return fmt.Errorf("workspace %d does not exist", id)
+			}
+			updated.WorkspaceID = id
+			if updated.SearchLanguageInherited {
+				updated.SearchLanguage = w.SearchLanguage
+			}
+		}
+	}
+	updated.updatedAt = s.now()
+	*n = updated
+	return nil
+}
+
+func intValue(field string, value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("%s must be a number", field)
+}
+
+func (s *Store) UpdateNoteSearchText(ctx context.Context, noteID int, contentText string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok || n.contentText == contentText {
+		return false, nil
+	}
+	n.contentText = contentText
+	n.updatedAt = s.now()
+	return true, nil
+}
+
+// SearchText returns the plain text last stored for a note
+func (s *Store) SearchText(noteID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[noteID]; ok {
+		return n.contentText
+	}
+	return ""
+}
+
+// Content returns the Yjs state an import stored for a note
+func (s *Store) Content(noteID int) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[noteID]; ok {
+		return n.content
+	}
+	return nil
+}
+
+func (s *Store) TrashNote(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		trashedAt := stamp(s.now())
+		n.IsTrashed = true
+		n.TrashedAt = &trashedAt
+	}
+	return nil
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n, ok := s.notes[id]; ok {
+		n.IsTrashed = false
+		n.TrashedAt = nil
+	}
+	return nil
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteNote(id)
+	return nil
+}
+
+// deleteNote removes a note with its attachments
+func (s *Store) deleteNote(id int) {
+	delete(s.notes, id)
+	for attachmentID, a := range s.attachments {
+		if a.NoteID == id {
+			delete(s.attachments, attachmentID)
+			s.blobs[a.Hash] = s.now()
+		}
+	}
+}
+
+func (s *Store) EmptyWorkspaceTrash(ctx context.Context, workspaceID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, n := range s.notes {
+		if n.WorkspaceID == workspaceID && n.IsTrashed {
+			s.deleteNote(id)
+		}
+	}
+	return nil
+}
+
+// --- Tags ---
+
+func (s *Store) findTag(name string) (db.Tag, bool) {
+	for _, t := range s.tags {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return db.Tag{}, false
+}
+
+// GetOrCreateTag returns the tag with the name, ignoring case, creating it
+// if needed
+func (s *Store) GetOrCreateTag(ctx context.Context, name string) (db.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getOrCreateTag(name), nil
+}
+
+func (s *Store) getOrCreateTag(name string) db.Tag {
+	if t, ok := s.findTag(name); ok {
+		return t
+	}
+	t := db.Tag{ID: s.id(), Name: name}
+	s.tags[t.ID] = t
+	return t
+}
+
+func sortTags(tags []db.Tag) {
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+}
+
+func (s *Store) ListTags(ctx context.Context) ([]db.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tags []db.Tag
+	for _, t := range s.tags {
+		tags = append(tags, t)
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (s *Store) ListTagsForWorkspace(ctx context.Context, workspaceID int) ([]db.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used := map[int]bool{}
+	for _, n := range s.notes {
+		if n.WorkspaceID == workspaceID {
+			for id := range n.tagIDs {
+				used[id] = true
+			}
+		}
+	}
+	var tags []db.Tag
+	for id := range used {
+		tags = append(tags, s.tags[id])
+	}
+	sortTags(tags)
+	return tags, nil
+}
+
+func (s *Store) ListTagsForNote(ctx context.Context, noteID int) ([]db.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok {
+		return nil, nil
+	}
+	return s.tagsForNote(n), nil
+}
+
+func (s *Store) tagsForNote(n *note) []db.Tag {
+	var tags []db.Tag
+	for id := range n.tagIDs {
+		tags = append(tags, s.tags[id])
+	}
+	sortTags(tags)
+	return tags
+}
+
+// SetTagsForNote replaces a note's tags, creating missing ones
+func (s *Store) SetTagsForNote(ctx context.Context, noteID int, tagNames []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.notes[noteID]; !ok {
+		return fmt.Errorf("note %d does not exist", noteID)
+	}
+	s.setTagsForNote(noteID, tagNames)
+	return nil
+}
+
+func (s *Store) setTagsForNote(noteID int, tagNames []string) {
+	n := s.notes[noteID]
+	n.tagIDs = map[int]bool{}
+	for _, name := range tagNames {
+		n.tagIDs[s.getOrCreateTag(name).ID] = true
+	}
+}
+
+// --- Attachments ---
+
+// CreateAttachment records an upload as db.Store does, under the store's
+// lock, so uploads are serialised
+func (s *Store) CreateAttachment(ctx context.Context, a *db.Attachment, quota int64, put func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[a.NoteID]
+	if !ok {
+		return fmt.Errorf("note %d does not exist", a.NoteID)
+	}
+	if quota > 0 && s.workspaceAttachmentBytes(n.WorkspaceID)+a.Size > quota {
+		return db.ErrQuotaExceeded
+	}
+	if _, ok := s.blobs[a.Hash]; !ok {
+		if err := put(); err != nil {
+			return fmt.Errorf("store blob: %w", err)
+		}
+	}
+	s.blobs[a.Hash] = s.now()
+	out := *a
+	out.ID = s.id()
+	out.Width, out.Height = copyInt(a.Width), copyInt(a.Height)
+	out.CreatedBy = copyInt(a.CreatedBy)
+	out.CreatedAt = stamp(s.now())
+	s.attachments[out.ID] = &out
+	a.ID, a.CreatedAt = out.ID, out.CreatedAt
+	return nil
+}
+
+func (s *Store) GetAttachment(ctx context.Context, id int) (*db.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attachments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *a
+	return &out, nil
+}
+
+func (s *Store) ListAttachments(ctx context.Context, noteID int) ([]db.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachments := []db.Attachment{}
+	for _, a := range s.attachments {
+		if a.NoteID == noteID {
+			attachments = append(attachments, *a)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+func (s *Store) SetAttachmentKey(ctx context.Context, id int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.attachments[id]; ok {
+		a.Key = key
+	}
+	return nil
+}
+
+func (s *Store) DeleteAttachment(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.attachments[id]; ok {
+		delete(s.attachments, id)
+		s.blobs[a.Hash] = s.now()
+	}
+	return nil
+}
+
+func (s *Store) WorkspaceAttachmentBytes(ctx context.Context, workspaceID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workspaceAttachmentBytes(workspaceID), nil
+}
+
+func (s *Store) workspaceAttachmentBytes(workspaceID int) int64 {
+	var used int64
+	for _, a := range s.attachments {
+		if n, ok := s.notes[a.NoteID]; ok && n.WorkspaceID == workspaceID {
+			used += a.Size
+		}
+	}
+	return used
+}
+
+func (s *Store) DeleteOrphanBlobs(ctx context.Context, grace time.Duration, remove func(hash string) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	used := map[string]bool{}
+	for _, a := range s.attachments {
+		used[a.Hash] = true
+	}
+	deleted := 0
+	var errs []error
+	for hash, lastUsed := range s.blobs {
+		if used[hash] || s.now().Sub(lastUsed) <= grace {
+			continue
+		}
+		if err := remove(hash); err != nil {
+			errs = append(errs, fmt.Errorf("delete blob %s: %w", hash, err))
+			continue
+		}
+		delete(s.blobs, hash)
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func copyInt(p *int) *int {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,380 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-notes/backend/internal/db"
+)
+
+// searchLanguages stands in for the text search configurations of a
+// PostgreSQL installation
+var searchLanguages = []string{"english", "french", "german", "simple", "spanish"}
+
+// memberWorkspaceIDs lists the workspaces the user belongs to
+func (s *Store) memberWorkspaceIDs(userID int) []int {
+	ids := []int{}
+	for id, w := range s.workspaces {
+		if _, ok := w.members[userID]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// matches evaluates a parsed query against a note as the database's search
+// conditions do. Full-text matching is approximated by requiring every word
+// of the text in the note's content.
+func (s *Store) matches(n *note, q db.SearchQuery, mode string) bool {
+	if n.IsTrashed {
+		return false
+	}
+	hasTag := func(match func(name string) bool) bool {
+		for id := range n.tagIDs {
+			if match(strings.ToLower(s.tags[id].Name)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tag := range q.Tags {
+		tag = strings.ToLower(tag)
+		if !hasTag(func(name string) bool { return name == tag }) {
+			return false
+		}
+	}
+	if q.WorkspaceID != nil && n.WorkspaceID != *q.WorkspaceID {
+		return false
+	}
+	if q.FolderID != nil && (n.FolderID == nil || *n.FolderID != *q.FolderID) {
+		return false
+	}
+	if q.Author != "" {
+		if n.CreatedBy == nil {
+			return false
+		}
+		u, ok := s.users[*n.CreatedBy]
+		if !ok || !strings.EqualFold(u.Username, q.Author) {
+			return false
+		}
+	}
+	if q.Color != "" && !strings.EqualFold(n.Color, q.Color) {
+		return false
+	}
+	if q.UpdatedAfter != nil && n.updatedAt.Before(*q.UpdatedAfter) {
+		return false
+	}
+	if q.UpdatedBefore != nil && !n.updatedAt.Before(*q.UpdatedBefore) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+	text := strings.ToLower(q.Text)
+	if strings.Contains(strings.ToLower(n.Title), text) || hasTag(func(name string) bool { return strings.Contains(name, text) }) {
+		return true
+	}
+	if mode != "full" {
+		return false
+	}
+	content := map[string]bool{}
+	for _, w := range strings.Fields(strings.ToLower(n.contentText)) {
+		content[strings.Trim(w, ".,;:!?\"'()")] = true
+	}
+	for _, w := range strings.Fields(text) {
+		if !content[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchNotesIn returns the notes in the workspaces matching a query, newest first
+func (s *Store) searchNotesIn(workspaceIDs []int, q db.SearchQuery, mode string) []*note {
+	if len(workspaceIDs) == 0 || q.IsEmpty() {
+		return nil
+	}
+	in := map[int]bool{}
+	for _, id := range workspaceIDs {
+		in[id] = true
+	}
+	var found []*note
+	for _, n := range s.notes {
+		if in[n.WorkspaceID] && s.matches(n, q, mode) {
+			found = append(found, n)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID > found[j].ID })
+	return found
+}
+
+// --- Saved Searches ---
+
+func (s *Store) CreateSavedSearch(ctx context.Context, ownerID int, workspaceID *int, name, query, mode string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[ownerID]; !ok {
+		return 0, fmt.Errorf("user %d does not exist", ownerID)
+	}
+	if workspaceID != nil {
+		if _, ok := s.workspaces[*workspaceID]; !ok {
+			return 0, fmt.Errorf("workspace %d does not exist", *workspaceID)
+		}
+	}
+	now := stamp(s.now())
+	ss := &db.SavedSearch{
+		ID: s.id(), OwnerID: ownerID, WorkspaceID: copyInt(workspaceID), Name: name, Query: query, Mode: mode,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	s.savedSearches[ss.ID] = ss
+	return ss.ID, nil
+}
+
+func exportSavedSearch(ss *db.SavedSearch) db.SavedSearch {
+	out := *ss
+	out.WorkspaceID = copyInt(ss.WorkspaceID)
+	return out
+}
+
+func (s *Store) GetSavedSearch(ctx context.Context, id int) (*db.SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ss, ok := s.savedSearches[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := exportSavedSearch(ss)
+	return &out, nil
+}
+
+// ListSavedSearches returns the user's own searches plus those shared with
+// any workspace the user belongs to
+func (s *Store) ListSavedSearches(ctx context.Context, userID int) ([]db.SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listSavedSearches(userID), nil
+}
+
+func (s *Store) listSavedSearches(userID int) []db.SavedSearch {
+	searches := []db.SavedSearch{}
+	for _, ss := range s.savedSearches {
+		shared := false
+		if ss.WorkspaceID != nil {
+			if w, ok := s.workspaces[*ss.WorkspaceID]; ok {
+				_, shared = w.members[userID]
+			}
+		}
+		if (ss.WorkspaceID == nil && ss.OwnerID == userID) || shared {
+			searches = append(searches, exportSavedSearch(ss))
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		a, b := strings.ToLower(searches[i].Name), strings.ToLower(searches[j].Name)
+		if a != b {
+			return a < b
+		}
+		return searches[i].ID < searches[j].ID
+	})
+	return searches
+}
+
+func (s *Store) UpdateSavedSearch(ctx context.Context, id int, workspaceID *int, name, query, mode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss, ok := s.savedSearches[id]; ok {
+		ss.WorkspaceID = copyInt(workspaceID)
+		ss.Name, ss.Query, ss.Mode = name, query, mode
+		ss.UpdatedAt = stamp(s.now())
+	}
+	return nil
+}
+
+func (s *Store) DeleteSavedSearch(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.savedSearches, id)
+	return nil
+}
+
+// CanViewSavedSearch reports whether the user may evaluate a search: a
+// shared search needs current membership of its workspace, even for the
+// owner, and a private one is the owner's alone
+func (s *Store) CanViewSavedSearch(ctx context.Context, ss *db.SavedSearch, userID int) (bool, error) {
+	if ss.WorkspaceID != nil {
+		return s.IsWorkspaceMember(ctx, *ss.WorkspaceID, userID)
+	}
+	return ss.OwnerID == userID, nil
+}
+
+// savedSearchScope returns the workspaces a saved search is evaluated
+// against: the user's, narrowed to the shared workspace if any
+func (s *Store) savedSearchScope(ss *db.SavedSearch, userID int) []int {
+	memberIDs := s.memberWorkspaceIDs(userID)
+	if ss.WorkspaceID == nil {
+		return memberIDs
+	}
+	for _, id := range memberIDs {
+		if id == *ss.WorkspaceID {
+			return []int{id}
+		}
+	}
+	return nil
+}
+
+// SavedSearchNotes evaluates a saved search for the user, with tags loaded
+func (s *Store) SavedSearchNotes(ctx context.Context, ss *db.SavedSearch, userID int) ([]db.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := []db.Note{}
+	for _, n := range s.searchNotesIn(s.savedSearchScope(ss, userID), db.ParseSearchQuery(ss.Query), ss.Mode) {
+		out := n.export()
+		out.Tags = s.tagsForNote(n)
+		notes = append(notes, out)
+	}
+	return notes, nil
+}
+
+// CountSavedSearches returns live match counts for every saved search visible to the user
+func (s *Store) CountSavedSearches(ctx context.Context, userID int) ([]db.SavedSearchCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	searches := s.listSavedSearches(userID)
+	counts := make([]db.SavedSearchCount, 0, len(searches))
+	for i := range searches {
+		ss := &searches[i]
+		found := s.searchNotesIn(s.savedSearchScope(ss, userID), db.ParseSearchQuery(ss.Query), ss.Mode)
+		counts = append(counts, db.SavedSearchCount{ID: ss.ID, Name: ss.Name, Count: len(found)})
+	}
+	return counts, nil
+}
+
+// --- Search languages ---
+
+func (s *Store) ListSearchLanguages(ctx context.Context) ([]string, error) {
+	return copyStrings(searchLanguages), nil
+}
+
+func (s *Store) IsValidSearchLanguage(ctx context.Context, name string) (bool, error) {
+	for _, l := range searchLanguages {
+		if l == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetWorkspaceSearchLanguage changes a workspace's default language and
+// re-points every note that inherits it
+func (s *Store) SetWorkspaceSearchLanguage(ctx context.Context, workspaceID int, language string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workspaces[workspaceID]
+	if !ok {
+		return nil
+	}
+	w.SearchLanguage = language
+	for _, n := range s.notes {
+		if n.WorkspaceID == workspaceID && n.SearchLanguageInherited {
+			n.SearchLanguage = language
+		}
+	}
+	return nil
+}
+
+// SetNoteSearchLanguage sets a per-note language override; nil follows the
+// workspace again
+func (s *Store) SetNoteSearchLanguage(ctx context.Context, noteID int, language *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notes[noteID]
+	if !ok {
+		return nil
+	}
+	if language == nil {
+		n.SearchLanguageInherited = true
+		if w, ok := s.workspaces[n.WorkspaceID]; ok {
+			n.SearchLanguage = w.SearchLanguage
+		}
+		return nil
+	}
+	n.SearchLanguage = *language
+	n.SearchLanguageInherited = false
+	return nil
+}
+
+// --- Fuzzy search ---
+
+// SearchNotesFuzzy ranks notes by trigram similarity to the query as the
+// pg_trgm search does, with "did you mean" suggestions
+func (s *Store) SearchNotesFuzzy(ctx context.Context, userID int, query string, limit int) (*db.FuzzySearchResult, error) {
+	result := &db.FuzzySearchResult{Notes: []db.ScoredNote{}, Suggestions: []string{}}
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return result, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in := map[int]bool{}
+	for _, id := range s.memberWorkspaceIDs(userID) {
+		in[id] = true
+	}
+	vocabulary := map[string]bool{}
+	type hit struct {
+		n     *note
+		score float64
+	}
+	var hits []hit
+	for _, n := range s.notes {
+		if !in[n.WorkspaceID] || n.IsTrashed {
+			continue
+		}
+		db.AddVocabulary(vocabulary, n.Title+" "+n.contentText)
+		title := db.WordSimilarity(query, n.Title)
+		content := db.WordSimilarity(query, n.contentText)
+		tag := 0.0
+		for id := range n.tagIDs {
+			name := strings.ToLower(s.tags[id].Name)
+			if len([]rune(name)) >= 3 {
+				vocabulary[name] = true
+			}
+			if sim := db.Similarity(name, query); sim > tag {
+				tag = sim
+			}
+		}
+		if title < db.FuzzyThreshold && content < db.FuzzyThreshold && tag < db.FuzzyThreshold {
+			continue
+		}
+		hits = append(hits, hit{n, maxFloat(title, content*0.8, tag)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].n.updatedAt.After(hits[j].n.updatedAt)
+	})
+	for i, h := range hits {
+		if i >= limit {
+			break
+		}
+		out := h.n.export()
+		out.Tags = s.tagsForNote(h.n)
+		result.Notes = append(result.Notes, db.ScoredNote{Note: out, Score: h.score})
+	}
+	result.DidYouMean, result.Suggestions = db.SuggestTerms(query, vocabulary)
+	return result, nil
+}
+
+func maxFloat(values ...float64) float64 {
+	best := values[0]
+	for _, v := range values[1:] {
+		if v > best {
+			best = v
+		}
+	}
+	return best
+}
@@ -0,0 +1,216 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-notes/backend/internal/db"
+)
+
+// syncKey identifies an entity in one workspace, as the rows of the
+// database's sync_changes log do
+type syncKey struct {
+	entity      string // note, folder, tag, member or workspace
+	id          int
+	workspaceID int
+}
+
+// syncState fingerprints every entity clients sync. Instead of logging
+// changes, GetSyncChanges keeps the state it answered from and diffs
+// against it, with the state's index as the cursor.
+type syncState map[syncKey]string
+
+func (s *Store) syncState() syncState {
+	state := syncState{}
+	for id, w := range s.workspaces {
+		state[syncKey{"workspace", id, id}] = fmt.Sprint(w.Name, w.OwnerID, w.SearchLanguage)
+		for userID, role := range w.members {
+			state[syncKey{"member", userID, id}] = role
+		}
+	}
+	for id, f := range s.folders {
+		state[syncKey{"folder", id, f.WorkspaceID}] = fmt.Sprint(f.Name, optionalInt(f.ParentID))
+	}
+	for id, n := range s.notes {
+		tagIDs := make([]string, 0, len(n.tagIDs))
+		for tagID := range n.tagIDs {
+			tagIDs = append(tagIDs, strconv.Itoa(tagID))
+			state[syncKey{"tag", tagID, n.WorkspaceID}] = s.tags[tagID].Name
+		}
+		sort.Strings(tagIDs)
+		state[syncKey{"note", id, n.WorkspaceID}] = fmt.Sprint(n.Title, optionalInt(n.FolderID), n.IsTrashed, n.Color,
+			n.SearchLanguage, n.SearchLanguageInherited, strings.Join(tagIDs, ","))
+	}
+	return state
+}
+
+func optionalInt(p *int) string {
+	if p == nil {
+		return "-"
+	}
+	return strconv.Itoa(*p)
+}
+
+// GetSyncChanges returns changes visible to userID since the given cursor
+// ("" for a full sync), shaped like the database store's answer
+func (s *Store) GetSyncChanges(ctx context.Context, userID int, since string) (*db.SyncChanges, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var previous syncState
+	if since != "" {
+		i, err := strconv.Atoi(since)
+		if err != nil || i < 0 || i >= len(s.syncStates) {
+			return nil, db.ErrInvalidCursor
+		}
+		previous = s.syncStates[i]
+	}
+	current := s.syncState()
+	s.syncStates = append(s.syncStates, current)
+
+	res := &db.SyncChanges{
+		Cursor:     strconv.Itoa(len(s.syncStates) - 1),
+		Full:       since == "",
+		Workspaces: []db.Workspace{},
+		Members:    []db.WorkspaceMember{},
+		Folders:    []db.Folder{},
+		Notes:      []db.Note{},
+		Tags:       []db.SyncTag{},
+		Deleted: db.SyncDeleted{
+			Notes: []int{}, Folders: []int{}, Tags: []db.SyncRef{}, Members: []db.WorkspaceMember{}, Workspaces: []int{},
+		},
+	}
+
+	member := map[int]bool{}
+	for _, id := range s.memberWorkspaceIDs(userID) {
+		member[id] = true
+	}
+	full := map[int]bool{}
+	if since == "" {
+		full = member
+	}
+
+	type change struct {
+		syncKey
+		deleted bool
+	}
+	var changes []change
+	for k, v := range current {
+		if old, ok := previous[k]; since != "" && (!ok || old != v) {
+			changes = append(changes, change{k, false})
+		}
+	}
+	for k := range previous {
+		if _, ok := current[k]; !ok {
+			changes = append(changes, change{k, true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.entity != b.entity {
+			return a.entity < b.entity
+		}
+		if a.workspaceID != b.workspaceID {
+			return a.workspaceID < b.workspaceID
+		}
+		return a.id < b.id
+	})
+
+	for _, ch := range changes {
+		if ch.entity == "member" && ch.id == userID {
+			if !member[ch.workspaceID] {
+				res.Deleted.Workspaces = append(res.Deleted.Workspaces, ch.workspaceID)
+			} else if !ch.deleted {
+				full[ch.workspaceID] = true
+			}
+		}
+	}
+	upserts := map[syncKey]bool{}
+	deletedNotes, deletedFolders := map[int]bool{}, map[int]bool{}
+	for _, ch := range changes {
+		if full[ch.workspaceID] || !member[ch.workspaceID] || ch.entity == "workspace" && ch.deleted {
+			continue
+		}
+		if !ch.deleted {
+			upserts[ch.syncKey] = true
+			continue
+		}
+		switch ch.entity {
+		case "note":
+			deletedNotes[ch.id] = true
+		case "folder":
+			deletedFolders[ch.id] = true
+		case "tag":
+			res.Deleted.Tags = append(res.Deleted.Tags, db.SyncRef{WorkspaceID: ch.workspaceID, ID: ch.id})
+		case "member":
+			res.Deleted.Members = append(res.Deleted.Members, db.WorkspaceMember{WorkspaceID: ch.workspaceID, UserID: ch.id})
+		}
+	}
+
+	// Sent when the workspace is sent whole or the entity changed
+	send := func(entity string, id, workspaceID int) bool {
+		return member[workspaceID] && (full[workspaceID] || upserts[syncKey{entity, id, workspaceID}])
+	}
+	for k := range current {
+		if k.entity == "tag" && send("tag", k.id, k.workspaceID) {
+			res.Tags = append(res.Tags, db.SyncTag{WorkspaceID: k.workspaceID, Tag: s.tags[k.id]})
+		}
+	}
+	sort.Slice(res.Tags, func(i, j int) bool {
+		if res.Tags[i].WorkspaceID != res.Tags[j].WorkspaceID {
+			return res.Tags[i].WorkspaceID < res.Tags[j].WorkspaceID
+		}
+		return res.Tags[i].ID < res.Tags[j].ID
+	})
+	for id, w := range s.workspaces {
+		if send("workspace", id, id) {
+			res.Workspaces = append(res.Workspaces, w.Workspace)
+		}
+		for memberID, role := range w.members {
+			if send("member", memberID, id) {
+				res.Members = append(res.Members, db.WorkspaceMember{WorkspaceID: id, UserID: memberID, Role: role})
+			}
+		}
+	}
+	sort.Slice(res.Workspaces, func(i, j int) bool { return res.Workspaces[i].ID < res.Workspaces[j].ID })
+	sort.Slice(res.Members, func(i, j int) bool {
+		if res.Members[i].WorkspaceID != res.Members[j].WorkspaceID {
+			return res.Members[i].WorkspaceID < res.Members[j].WorkspaceID
+		}
+		return res.Members[i].UserID < res.Members[j].UserID
+	})
+	for id, f := range s.folders {
+		if send("folder", id, f.WorkspaceID) {
+			out := *f
+			out.ParentID = copyInt(f.ParentID)
+			res.Folders = append(res.Folders, out)
+			delete(deletedFolders, id)
+		}
+	}
+	sort.Slice(res.Folders, func(i, j int) bool { return res.Folders[i].ID < res.Folders[j].ID })
+	for id, n := range s.notes {
+		if send("note", id, n.WorkspaceID) {
+			out := n.export()
+			out.Tags = s.tagsForNote(n)
+			res.Notes = append(res.Notes, out)
+			delete(deletedNotes, id)
+		}
+	}
+	sort.Slice(res.Notes, func(i, j int) bool { return res.Notes[i].ID < res.Notes[j].ID })
+
+	// A note or folder that moved out of one workspace and into another the
+	// user can see is an upsert, not a delete
+	for id := range deletedNotes {
+		res.Deleted.Notes = append(res.Deleted.Notes, id)
+	}
+	sort.Ints(res.Deleted.Notes)
+	for id := range deletedFolders {
+		res.Deleted.Folders = append(res.Deleted.Folders, id)
+	}
+	sort.Ints(res.Deleted.Folders)
+	sort.Ints(res.Deleted.Workspaces)
+	return res, nil
+}
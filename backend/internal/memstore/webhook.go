@@ -0,0 +1,237 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// --- Webhooks ---
+
+func (s *Store) CreateWebhook(ctx context.Context, workspaceID int, url, secret string, eventTypes []string, active bool, createdBy int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workspaces[workspaceID]; !ok {
+		return 0, sql.ErrNoRows
+	}
+	now := stamp(s.now())
+	h := &db.Webhook{
+		ID: s.id(), WorkspaceID: workspaceID, URL: url, Secret: secret, EventTypes: copyStrings(eventTypes),
+		Active: active, CreatedBy: &createdBy, CreatedAt: now, UpdatedAt: now,
+	}
+	s.webhooks[h.ID] = h
+	return h.ID, nil
+}
+
+func exportWebhook(h *db.Webhook) db.Webhook {
+	out := *h
+	out.EventTypes = copyStrings(h.EventTypes)
+	out.CreatedBy = copyInt(h.CreatedBy)
+	return out
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id int) (*db.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := exportWebhook(h)
+	return &out, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, workspaceID int) ([]db.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := []db.Webhook{}
+	for _, h := range s.webhooks {
+		if h.WorkspaceID == workspaceID {
+			hooks = append(hooks, exportWebhook(h))
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks, nil
+}
+
+func (s *Store) UpdateWebhook(ctx context.Context, id int, url string, eventTypes []string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.webhooks[id]; ok {
+		h.URL = url
+		h.EventTypes = copyStrings(eventTypes)
+		h.Active = active
+		h.UpdatedAt = stamp(s.now())
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteWebhook(id)
+	return nil
+}
+
+// deleteWebhook removes a webhook with its deliveries
+func (s *Store) deleteWebhook(id int) {
+	delete(s.webhooks, id)
+	for deliveryID, d := range s.deliveries {
+		if d.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+}
+
+// subscribed reports whether a webhook wants an event type; no types means all
+func subscribed(h *db.Webhook, eventType string) bool {
+	if len(h.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range h.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EnqueueWebhookDeliveries queues payload for every active webhook in the
+// workspace subscribed to eventType, returning how many were queued
+func (s *Store) EnqueueWebhookDeliveries(ctx context.Context, workspaceID int, eventType string, payload []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queued int64
+	for _, h := range s.webhooks {
+		if h.WorkspaceID == workspaceID && h.Active && subscribed(h, eventType) {
+			s.enqueueDelivery(h, eventType, payload)
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// EnqueueWebhookDelivery queues payload for one webhook regardless of its
+// subscriptions
+func (s *Store) EnqueueWebhookDelivery(ctx context.Context, webhookID int, eventType string, payload []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.webhooks[webhookID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return s.enqueueDelivery(h, eventType, payload), nil
+}
+
+// enqueueDelivery queues payload for h, keeping its url and secret
+func (s *Store) enqueueDelivery(h *db.Webhook, eventType string, payload []byte) int64 {
+	now := s.now()
+	d := &db.WebhookDelivery{
+		ID: int64(s.id()), WebhookID: h.ID, EventType: eventType, Payload: string(payload),
+		Status: "pending", NextAttemptAt: &now, CreatedAt: now, URL: h.URL, Secret: h.Secret,
+	}
+	s.deliveries[d.ID] = d
+	return d.ID
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and leases them for
+// lease. A delivery goes to its webhook's current url, or to the one it was
+// queued with once the webhook is gone.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]db.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var due []*db.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	var claimed []db.WebhookDelivery
+	for _, d := range due {
+		next := now.Add(lease)
+		d.Attempts++
+		d.LastAttemptAt = &now
+		d.NextAttemptAt = &next
+		out := *d
+		if h, ok := s.webhooks[d.WebhookID]; ok {
+			out.URL, out.Secret = h.URL, h.Secret
+		}
+		claimed = append(claimed, out)
+	}
+	return claimed, nil
+}
+
+// CompleteWebhookDelivery records an attempt. A nil retryAt with a non-empty
+// errMsg marks the delivery failed for good; with retryAt it stays pending.
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id int64, responseStatus int, responseBody, errMsg string, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil
+	}
+	d.Status = "delivered"
+	d.Error = nil
+	if errMsg != "" {
+		d.Status = "failed"
+		if retryAt != nil {
+			d.Status = "pending"
+			next := *retryAt
+			d.NextAttemptAt = &next
+		}
+		d.Error = &errMsg
+	}
+	d.ResponseStatus = nil
+	if responseStatus != 0 {
+		d.ResponseStatus = &responseStatus
+	}
+	d.ResponseBody = &responseBody
+	d.DeliveredAt = nil
+	if d.Status == "delivered" {
+		now := s.now()
+		d.DeliveredAt = &now
+	}
+	return nil
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id int64) (*db.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	out := *d
+	return &out, nil
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries first
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]db.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := []db.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func copyStrings(in []string) []string {
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tags_name_trgm;
+DROP INDEX IF EXISTS idx_notes_content_text_trgm;
+DROP INDEX IF EXISTS idx_notes_title_trgm;
+
+DROP EXTENSION IF EXISTS pg_trgm;
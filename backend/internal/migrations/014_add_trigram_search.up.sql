@@ -0,0 +1,6 @@
+-- Enable trigram matching for typo-tolerant search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_notes_title_trgm ON notes USING gin (LOWER(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_notes_content_text_trgm ON notes USING gin (LOWER(content_text) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_tags_name_trgm ON tags USING gin (LOWER(name) gin_trgm_ops);
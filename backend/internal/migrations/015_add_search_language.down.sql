@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_notes_content_text_lang;
+CREATE INDEX IF NOT EXISTS idx_notes_content_text ON notes USING gin(to_tsvector('english', content_text));
+
+ALTER TABLE notes DROP COLUMN IF EXISTS search_language_inherited;
+ALTER TABLE notes DROP COLUMN IF EXISTS search_language;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS search_language;
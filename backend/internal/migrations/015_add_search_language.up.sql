@@ -0,0 +1,9 @@
+-- Per-workspace default and per-note full-text search configuration
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS search_language regconfig NOT NULL DEFAULT 'english';
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_language regconfig NOT NULL DEFAULT 'english';
+-- TRUE while the note follows its workspace's language rather than its own setting
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_language_inherited BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Replace the english-only index with one keyed on each note's own config
+DROP INDEX IF EXISTS idx_notes_content_text;
+CREATE INDEX IF NOT EXISTS idx_notes_content_text_lang ON notes USING gin(to_tsvector(search_language, content_text));
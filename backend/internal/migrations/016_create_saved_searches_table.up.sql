@@ -0,0 +1,15 @@
+-- Saved searches, shown to clients as virtual "smart folders".
+-- workspace_id NULL = private to the owner, otherwise shared with that workspace's members
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    query TEXT NOT NULL,
+    mode VARCHAR(16) NOT NULL DEFAULT 'metadata',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_owner ON saved_searches(owner_id);
+CREATE INDEX IF NOT EXISTS idx_saved_searches_workspace ON saved_searches(workspace_id) WHERE workspace_id IS NOT NULL;
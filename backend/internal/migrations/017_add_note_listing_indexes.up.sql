@@ -0,0 +1,5 @@
+-- Keyset pagination of workspace note listings: (sort column, id) per sort
+CREATE INDEX IF NOT EXISTS idx_notes_ws_created ON notes(workspace_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_notes_ws_updated ON notes(workspace_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_notes_ws_title ON notes(workspace_id, LOWER(title), id);
+CREATE INDEX IF NOT EXISTS idx_notes_ws_created_by ON notes(workspace_id, created_by);
@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS workspaces_sync ON workspaces;
+DROP TRIGGER IF EXISTS workspace_members_sync ON workspace_members;
+DROP TRIGGER IF EXISTS note_tags_sync ON note_tags;
+DROP TRIGGER IF EXISTS folders_sync ON folders;
+DROP TRIGGER IF EXISTS notes_sync ON notes;
+DROP FUNCTION IF EXISTS sync_track_workspace();
+DROP FUNCTION IF EXISTS sync_track_member();
+DROP FUNCTION IF EXISTS sync_track_note_tag();
+DROP FUNCTION IF EXISTS sync_track_workspace_row();
+DROP FUNCTION IF EXISTS sync_log(INTEGER, VARCHAR, INTEGER, BOOLEAN);
+DROP TABLE IF EXISTS sync_horizon;
+DROP TABLE IF EXISTS sync_changes;
@@ -0,0 +1,107 @@
+-- Change log for delta sync. Rows are written by triggers so every path that
+-- changes data (handlers, cascades, trash auto-empty, the yjs server) leaves a
+-- record, including tombstones for hard deletes.
+--
+-- The sync cursor is a transaction ID watermark: clients receive rows with
+-- txid below the oldest still-running transaction, so a change can never
+-- appear behind a cursor that was already handed out.
+CREATE TABLE IF NOT EXISTS sync_changes (
+    id BIGSERIAL PRIMARY KEY,
+    txid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    workspace_id INTEGER NOT NULL, -- no FK: tombstones outlive the workspace
+    entity VARCHAR(16) NOT NULL,   -- note, folder, tag, member, workspace
+    entity_id INTEGER NOT NULL,    -- user_id for member rows
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_changes_txid ON sync_changes(txid);
+CREATE INDEX IF NOT EXISTS idx_sync_changes_entity ON sync_changes(entity, entity_id, workspace_id);
+
+-- Highest txid removed by retention pruning; older cursors must resync
+CREATE TABLE IF NOT EXISTS sync_horizon (
+    id INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    txid xid8 NOT NULL DEFAULT '0'
+);
+INSERT INTO sync_horizon (id) VALUES (1) ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION sync_log(ws INTEGER, kind VARCHAR, eid INTEGER, is_deleted BOOLEAN) RETURNS VOID AS $$
+BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted) VALUES (ws, kind, eid, is_deleted);
+END;
+$$ LANGUAGE plpgsql;
+
+-- Notes and folders: a move between workspaces is a delete in the old one
+CREATE OR REPLACE FUNCTION sync_track_workspace_row() RETURNS TRIGGER AS $$
+DECLARE
+    kind VARCHAR := TG_ARGV[0];
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM sync_log(OLD.workspace_id, kind, OLD.id, TRUE);
+        RETURN OLD;
+    END IF;
+    IF TG_OP = 'UPDATE' AND OLD.workspace_id <> NEW.workspace_id THEN
+        PERFORM sync_log(OLD.workspace_id, kind, OLD.id, TRUE);
+    END IF;
+    PERFORM sync_log(NEW.workspace_id, kind, NEW.id, FALSE);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_sync AFTER INSERT OR DELETE OR UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION sync_track_workspace_row('note');
+CREATE TRIGGER folders_sync AFTER INSERT OR DELETE OR UPDATE ON folders
+    FOR EACH ROW EXECUTE FUNCTION sync_track_workspace_row('folder');
+
+-- Tag links change the note; a workspace "has" a tag while any note uses it
+CREATE OR REPLACE FUNCTION sync_track_note_tag() RETURNS TRIGGER AS $$
+DECLARE
+    ws INTEGER;
+    link note_tags%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN link := OLD; ELSE link := NEW; END IF;
+    SELECT workspace_id INTO ws FROM notes WHERE id = link.note_id;
+    IF ws IS NULL THEN
+        -- Note itself is being deleted; its tombstone covers the link
+        RETURN NULL;
+    END IF;
+    PERFORM sync_log(ws, 'note', link.note_id, FALSE);
+    IF TG_OP = 'INSERT' THEN
+        PERFORM sync_log(ws, 'tag', link.tag_id, FALSE);
+    ELSIF NOT EXISTS (
+        SELECT 1 FROM note_tags nt JOIN notes n ON n.id = nt.note_id
+        WHERE nt.tag_id = link.tag_id AND n.workspace_id = ws
+    ) THEN
+        PERFORM sync_log(ws, 'tag', link.tag_id, TRUE);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_tags_sync AFTER INSERT OR DELETE ON note_tags
+    FOR EACH ROW EXECUTE FUNCTION sync_track_note_tag();
+
+CREATE OR REPLACE FUNCTION sync_track_member() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM sync_log(OLD.workspace_id, 'member', OLD.user_id, TRUE);
+        RETURN OLD;
+    END IF;
+    PERFORM sync_log(NEW.workspace_id, 'member', NEW.user_id, FALSE);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workspace_members_sync AFTER INSERT OR DELETE OR UPDATE ON workspace_members
+    FOR EACH ROW EXECUTE FUNCTION sync_track_member();
+
+-- Workspace deletion is reported through the cascaded member rows
+CREATE OR REPLACE FUNCTION sync_track_workspace() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM sync_log(NEW.id, 'workspace', NEW.id, FALSE);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workspaces_sync AFTER INSERT OR UPDATE ON workspaces
+    FOR EACH ROW EXECUTE FUNCTION sync_track_workspace();
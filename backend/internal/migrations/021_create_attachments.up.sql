@@ -0,0 +1,23 @@
+-- Attachment bytes live in blob storage (internal/blob) under their SHA-256.
+-- Attachments with the same content share a blob, whose row is swept once
+-- no attachment refers to it.
+CREATE TABLE IF NOT EXISTS attachment_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    note_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    hash CHAR(64) NOT NULL REFERENCES attachment_blobs(hash),
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    access_key CHAR(32) NOT NULL, -- lets image URLs in note content load without a login
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_note ON attachments(note_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);
@@ -0,0 +1,4 @@
+-- Pixel size of image attachments, whose thumbnails are the blobs
+-- <hash>-w<width> for the thumbnail widths narrower than the image
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS height INTEGER;
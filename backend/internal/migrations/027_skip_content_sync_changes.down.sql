@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS notes_sync_update ON notes;
+DROP TRIGGER IF EXISTS notes_sync ON notes;
+
+CREATE TRIGGER notes_sync AFTER INSERT OR DELETE OR UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION sync_track_workspace_row('note');
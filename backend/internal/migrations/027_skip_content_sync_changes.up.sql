@@ -0,0 +1,14 @@
+-- Content edits write updated_at, content and content_text many times a
+-- minute while a note is open; clients fetch content from the document
+-- service, so only changes to the metadata that sync sends are logged.
+DROP TRIGGER IF EXISTS notes_sync ON notes;
+
+CREATE TRIGGER notes_sync AFTER INSERT OR DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION sync_track_workspace_row('note');
+CREATE TRIGGER notes_sync_update AFTER UPDATE ON notes
+    FOR EACH ROW
+    WHEN ((OLD.title, OLD.folder_id, OLD.workspace_id, OLD.is_trashed, OLD.trashed_at, OLD.color,
+           OLD.search_language, OLD.search_language_inherited)
+          IS DISTINCT FROM (NEW.title, NEW.folder_id, NEW.workspace_id, NEW.is_trashed, NEW.trashed_at, NEW.color,
+           NEW.search_language, NEW.search_language_inherited))
+    EXECUTE FUNCTION sync_track_workspace_row('note');
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS attachments_release_blob ON attachments;
+DROP FUNCTION IF EXISTS attachment_blob_released();
@@ -0,0 +1,12 @@
+-- A blob's grace period before the orphan sweep counts from when an
+-- attachment referring to it was last removed, however it went: deleted on
+-- its own or with its note or workspace.
+CREATE OR REPLACE FUNCTION attachment_blob_released() RETURNS trigger AS $$
+BEGIN
+    UPDATE attachment_blobs SET last_used_at = CURRENT_TIMESTAMP WHERE hash = OLD.hash;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_release_blob AFTER DELETE ON attachments
+    FOR EACH ROW EXECUTE FUNCTION attachment_blob_released();
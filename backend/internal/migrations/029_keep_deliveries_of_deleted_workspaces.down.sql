@@ -0,0 +1,7 @@
+DELETE FROM webhook_deliveries WHERE webhook_id IS NULL;
+ALTER TABLE webhook_deliveries DROP CONSTRAINT webhook_deliveries_webhook_id_fkey;
+ALTER TABLE webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_webhook_id_fkey FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+    ALTER COLUMN webhook_id SET NOT NULL,
+    DROP COLUMN url,
+    DROP COLUMN secret;
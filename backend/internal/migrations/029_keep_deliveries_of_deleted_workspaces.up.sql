@@ -0,0 +1,13 @@
+-- Deliveries carry their webhook's url and secret and outlive it, so the
+-- workspace.deleted event, queued just before its workspace and webhooks
+-- are deleted, still goes out. Deleting a webhook on its own removes its
+-- deliveries explicitly.
+ALTER TABLE webhook_deliveries ADD COLUMN url TEXT, ADD COLUMN secret VARCHAR(128);
+UPDATE webhook_deliveries d SET url = w.url, secret = w.secret FROM webhooks w WHERE w.id = d.webhook_id;
+ALTER TABLE webhook_deliveries
+    ALTER COLUMN url SET NOT NULL,
+    ALTER COLUMN secret SET NOT NULL,
+    ALTER COLUMN webhook_id DROP NOT NULL,
+    DROP CONSTRAINT webhook_deliveries_webhook_id_fkey;
+ALTER TABLE webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_webhook_id_fkey FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE SET NULL;
@@ -0,0 +1,19 @@
+-- Background workspace exports, so any replica can report on and serve
+-- them and they survive a restart. A job's result is the file named after
+-- its ID in EXPORT_DIR. There are no foreign keys: a row outlives its
+-- workspace and user until it expires and its file is removed.
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id VARCHAR(32) PRIMARY KEY,
+    workspace_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'running', -- running, done, failed
+    error TEXT,
+    size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    heartbeat_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- while running
+    finished_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_running ON export_jobs(user_id) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_export_jobs_expires ON export_jobs(expires_at);
@@ -0,0 +1,17 @@
+// Package migrations embeds the SQL schema migrations so the binary can
+// run them from any working directory.
+package migrations
+
+import "embed"
+
+// FS holds the NNN_name.up.sql and NNN_name.down.sql files
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLiteFS holds the SQLite migrations under sqlite/. Each driver has its
+// own sequence: a version number names the same change on both, and a
+// driver skips the numbers of changes it needs no schema for.
+//
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
@@ -0,0 +1,2 @@
+-- Yjs document state, written by the yjs server and keyed by note ID as in PostgreSQL
+ALTER TABLE notes ADD COLUMN content BLOB;
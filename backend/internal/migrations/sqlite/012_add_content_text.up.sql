@@ -0,0 +1,24 @@
+-- Add content_text column for searchable plain text
+ALTER TABLE notes ADD COLUMN content_text TEXT;
+
+-- FTS5 stands in for PostgreSQL's to_tsvector index. The table indexes
+-- notes.content_text without storing a second copy; triggers keep it current.
+CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+    content_text,
+    content = 'notes',
+    content_rowid = 'id',
+    tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO notes_fts (rowid, content_text) VALUES (NEW.id, NEW.content_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes BEGIN
+    INSERT INTO notes_fts (notes_fts, rowid, content_text) VALUES ('delete', OLD.id, OLD.content_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE OF content_text ON notes BEGIN
+    INSERT INTO notes_fts (notes_fts, rowid, content_text) VALUES ('delete', OLD.id, OLD.content_text);
+    INSERT INTO notes_fts (rowid, content_text) VALUES (NEW.id, NEW.content_text);
+END;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_folders_parent;
+DROP INDEX IF EXISTS idx_workspace_members_user;
+DROP INDEX IF EXISTS idx_note_tags_tag;
+DROP INDEX IF EXISTS idx_notes_folder;
+DROP INDEX IF EXISTS idx_notes_workspace_trashed;
@@ -0,0 +1,12 @@
+-- Improve search performance
+CREATE INDEX IF NOT EXISTS idx_notes_workspace_trashed ON notes(workspace_id, is_trashed);
+CREATE INDEX IF NOT EXISTS idx_notes_folder ON notes(folder_id) WHERE folder_id IS NOT NULL;
+
+-- Improve tag searches
+CREATE INDEX IF NOT EXISTS idx_note_tags_tag ON note_tags(tag_id);
+
+-- Improve workspace member lookups
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user ON workspace_members(user_id);
+
+-- Improve folder hierarchy queries
+CREATE INDEX IF NOT EXISTS idx_folders_parent ON folders(parent_id) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS notes_fts_simple_update;
+DROP TRIGGER IF EXISTS notes_fts_simple_delete;
+DROP TRIGGER IF EXISTS notes_fts_simple_insert;
+DROP TABLE IF EXISTS notes_fts_simple;
+ALTER TABLE notes DROP COLUMN search_language_inherited;
+ALTER TABLE notes DROP COLUMN search_language;
+ALTER TABLE workspaces DROP COLUMN search_language;
@@ -0,0 +1,31 @@
+-- Per-workspace and per-note search language. FTS5 has no per-language
+-- stemmers: see notes_fts_simple below.
+ALTER TABLE workspaces ADD COLUMN search_language TEXT NOT NULL DEFAULT 'english';
+ALTER TABLE notes ADD COLUMN search_language TEXT NOT NULL DEFAULT 'english';
+-- TRUE while the note follows its workspace's language rather than its own setting
+ALTER TABLE notes ADD COLUMN search_language_inherited BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Notes whose search language is 'simple' are matched without stemming,
+-- through a second FTS5 index over the same content. Every other language
+-- keeps using notes_fts and its porter (English) stemmer.
+CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts_simple USING fts5(
+    content_text,
+    content = 'notes',
+    content_rowid = 'id',
+    tokenize = 'unicode61'
+);
+
+INSERT INTO notes_fts_simple (notes_fts_simple) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_simple_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO notes_fts_simple (rowid, content_text) VALUES (NEW.id, NEW.content_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_simple_delete AFTER DELETE ON notes BEGIN
+    INSERT INTO notes_fts_simple (notes_fts_simple, rowid, content_text) VALUES ('delete', OLD.id, OLD.content_text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_simple_update AFTER UPDATE OF content_text ON notes BEGIN
+    INSERT INTO notes_fts_simple (notes_fts_simple, rowid, content_text) VALUES ('delete', OLD.id, OLD.content_text);
+    INSERT INTO notes_fts_simple (rowid, content_text) VALUES (NEW.id, NEW.content_text);
+END;
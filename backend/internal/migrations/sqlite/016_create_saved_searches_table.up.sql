@@ -0,0 +1,15 @@
+-- Saved searches (smart folders). workspace_id NULL = private to the owner,
+-- otherwise shared with that workspace's members.
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    workspace_id INTEGER REFERENCES workspaces(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    mode TEXT NOT NULL DEFAULT 'metadata',
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_owner ON saved_searches(owner_id);
+CREATE INDEX IF NOT EXISTS idx_saved_searches_workspace ON saved_searches(workspace_id) WHERE workspace_id IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_notes_ws_created_by;
+DROP INDEX IF EXISTS idx_notes_ws_title;
+DROP INDEX IF EXISTS idx_notes_ws_updated;
+DROP INDEX IF EXISTS idx_notes_ws_created;
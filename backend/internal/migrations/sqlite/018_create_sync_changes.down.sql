@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS workspaces_sync_update;
+DROP TRIGGER IF EXISTS workspaces_sync_insert;
+DROP TRIGGER IF EXISTS workspace_members_sync_delete;
+DROP TRIGGER IF EXISTS workspace_members_sync_update;
+DROP TRIGGER IF EXISTS workspace_members_sync_insert;
+DROP TRIGGER IF EXISTS note_tags_sync_delete;
+DROP TRIGGER IF EXISTS note_tags_sync_insert;
+DROP TRIGGER IF EXISTS folders_sync_delete;
+DROP TRIGGER IF EXISTS folders_sync_update;
+DROP TRIGGER IF EXISTS folders_sync_insert;
+DROP TRIGGER IF EXISTS notes_sync_delete;
+DROP TRIGGER IF EXISTS notes_sync_update;
+DROP TRIGGER IF EXISTS notes_sync_insert;
+DROP TABLE IF EXISTS sync_horizon;
+DROP TABLE IF EXISTS sync_changes;
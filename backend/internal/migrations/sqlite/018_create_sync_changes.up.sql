@@ -0,0 +1,102 @@
+-- Change log for delta sync, written by triggers as in PostgreSQL so every
+-- path that changes data leaves a record, including tombstones for
+-- hard deletes.
+--
+-- The sync cursor is the highest change ID a client has seen. SQLite runs
+-- one write transaction at a time, so IDs are committed in order and a
+-- change can never appear behind a cursor that was already handed out.
+-- AUTOINCREMENT keeps IDs from being reused once old rows are pruned.
+CREATE TABLE IF NOT EXISTS sync_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workspace_id INTEGER NOT NULL, -- no FK: tombstones outlive the workspace
+    entity TEXT NOT NULL,          -- note, folder, tag, member, workspace
+    entity_id INTEGER NOT NULL,    -- user_id for member rows
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    changed_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_changes_entity ON sync_changes(entity, entity_id, workspace_id);
+
+-- Highest change ID removed by retention pruning; older cursors must resync
+CREATE TABLE IF NOT EXISTS sync_horizon (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    change_id INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO sync_horizon (id) VALUES (1) ON CONFLICT DO NOTHING;
+
+-- Notes and folders: a move between workspaces is a delete in the old one.
+-- Updates that only touch content (content_text, updated_at) are not
+-- logged; clients fetch content from the document service.
+CREATE TRIGGER IF NOT EXISTS notes_sync_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'note', NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_sync_update AFTER UPDATE ON notes
+WHEN (OLD.title, OLD.folder_id, OLD.workspace_id, OLD.is_trashed, OLD.trashed_at, OLD.color,
+      OLD.search_language, OLD.search_language_inherited)
+  IS NOT (NEW.title, NEW.folder_id, NEW.workspace_id, NEW.is_trashed, NEW.trashed_at, NEW.color,
+      NEW.search_language, NEW.search_language_inherited)
+BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted)
+        SELECT OLD.workspace_id, 'note', OLD.id, TRUE WHERE OLD.workspace_id <> NEW.workspace_id;
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'note', NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS notes_sync_delete AFTER DELETE ON notes BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted) VALUES (OLD.workspace_id, 'note', OLD.id, TRUE);
+END;
+
+CREATE TRIGGER IF NOT EXISTS folders_sync_insert AFTER INSERT ON folders BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'folder', NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS folders_sync_update AFTER UPDATE ON folders BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted)
+        SELECT OLD.workspace_id, 'folder', OLD.id, TRUE WHERE OLD.workspace_id <> NEW.workspace_id;
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'folder', NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS folders_sync_delete AFTER DELETE ON folders BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted) VALUES (OLD.workspace_id, 'folder', OLD.id, TRUE);
+END;
+
+-- Tag links change the note; a workspace "has" a tag while any note uses
+-- it. Links removed with their note are covered by the note's tombstone.
+CREATE TRIGGER IF NOT EXISTS note_tags_sync_insert AFTER INSERT ON note_tags BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id)
+        SELECT workspace_id, 'note', NEW.note_id FROM notes WHERE id = NEW.note_id;
+    INSERT INTO sync_changes (workspace_id, entity, entity_id)
+        SELECT workspace_id, 'tag', NEW.tag_id FROM notes WHERE id = NEW.note_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS note_tags_sync_delete AFTER DELETE ON note_tags BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id)
+        SELECT workspace_id, 'note', OLD.note_id FROM notes WHERE id = OLD.note_id;
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted)
+        SELECT n.workspace_id, 'tag', OLD.tag_id, TRUE FROM notes n
+        WHERE n.id = OLD.note_id AND NOT EXISTS (
+            SELECT 1 FROM note_tags nt JOIN notes other ON other.id = nt.note_id
+            WHERE nt.tag_id = OLD.tag_id AND other.workspace_id = n.workspace_id
+        );
+END;
+
+CREATE TRIGGER IF NOT EXISTS workspace_members_sync_insert AFTER INSERT ON workspace_members BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'member', NEW.user_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS workspace_members_sync_update AFTER UPDATE ON workspace_members BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.workspace_id, 'member', NEW.user_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS workspace_members_sync_delete AFTER DELETE ON workspace_members BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id, deleted) VALUES (OLD.workspace_id, 'member', OLD.user_id, TRUE);
+END;
+
+-- Workspace deletion is reported through the cascaded member rows
+CREATE TRIGGER IF NOT EXISTS workspaces_sync_insert AFTER INSERT ON workspaces BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.id, 'workspace', NEW.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS workspaces_sync_update AFTER UPDATE ON workspaces BEGIN
+    INSERT INTO sync_changes (workspace_id, entity, entity_id) VALUES (NEW.id, 'workspace', NEW.id);
+END;
@@ -0,0 +1,2 @@
+-- Disabled accounts cannot log in and their tokens stop working
+ALTER TABLE users ADD COLUMN disabled_at TEXT;
@@ -0,0 +1,23 @@
+-- Attachment bytes live in blob storage (internal/blob) under their SHA-256.
+-- Attachments with the same content share a blob, whose row is swept once
+-- no attachment refers to it.
+CREATE TABLE IF NOT EXISTS attachment_blobs (
+    hash TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    last_used_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+    hash TEXT NOT NULL REFERENCES attachment_blobs(hash),
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    access_key TEXT NOT NULL, -- lets image URLs in note content load without a login
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_note ON attachments(note_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_hash ON attachments(hash);
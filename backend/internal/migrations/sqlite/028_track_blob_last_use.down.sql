@@ -0,0 +1 @@
+DROP TRIGGER IF EXISTS attachments_release_blob;
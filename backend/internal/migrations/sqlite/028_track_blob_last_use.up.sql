@@ -0,0 +1,7 @@
+-- A blob's grace period before the orphan sweep counts from when an
+-- attachment referring to it was last removed, however it went: deleted on
+-- its own or with its note or workspace.
+CREATE TRIGGER IF NOT EXISTS attachments_release_blob AFTER DELETE ON attachments
+BEGIN
+    UPDATE attachment_blobs SET last_used_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now') WHERE hash = OLD.hash;
+END;
@@ -0,0 +1,27 @@
+CREATE TABLE webhook_deliveries_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    last_attempt_at TEXT,
+    response_status INTEGER,
+    response_body TEXT,
+    error TEXT,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    delivered_at TEXT
+);
+
+INSERT INTO webhook_deliveries_old (id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+    last_attempt_at, response_status, response_body, error, created_at, delivered_at)
+SELECT id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+    last_attempt_at, response_status, response_body, error, created_at, delivered_at
+FROM webhook_deliveries WHERE webhook_id IS NOT NULL;
+
+DROP TABLE webhook_deliveries;
+ALTER TABLE webhook_deliveries_old RENAME TO webhook_deliveries;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
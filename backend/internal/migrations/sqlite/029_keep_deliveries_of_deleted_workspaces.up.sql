@@ -0,0 +1,34 @@
+-- Deliveries carry their webhook's url and secret and outlive it, so the
+-- workspace.deleted event, queued just before its workspace and webhooks
+-- are deleted, still goes out. Deleting a webhook on its own removes its
+-- deliveries explicitly. SQLite cannot change a foreign key in place, so
+-- the table is rebuilt; nothing refers to it.
+CREATE TABLE webhook_deliveries_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER REFERENCES webhooks(id) ON DELETE SET NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    last_attempt_at TEXT,
+    response_status INTEGER,
+    response_body TEXT,
+    error TEXT,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    delivered_at TEXT
+);
+
+INSERT INTO webhook_deliveries_new (id, webhook_id, url, secret, event_type, payload, status, attempts, next_attempt_at,
+    last_attempt_at, response_status, response_body, error, created_at, delivered_at)
+SELECT d.id, d.webhook_id, w.url, w.secret, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+    d.last_attempt_at, d.response_status, d.response_body, d.error, d.created_at, d.delivered_at
+FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id;
+
+DROP TABLE webhook_deliveries;
+ALTER TABLE webhook_deliveries_new RENAME TO webhook_deliveries;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
@@ -0,0 +1,19 @@
+-- Background workspace exports, so they survive a restart. A job's result
+-- is the file named after its ID in EXPORT_DIR. There are no foreign keys:
+-- a row outlives its workspace and user until it expires and its file is
+-- removed.
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id TEXT PRIMARY KEY,
+    workspace_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running', -- running, done, failed
+    error TEXT,
+    size INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    heartbeat_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')), -- while running
+    finished_at TEXT,
+    expires_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_running ON export_jobs(user_id) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_export_jobs_expires ON export_jobs(expires_at);
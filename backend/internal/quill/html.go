@@ -0,0 +1,261 @@
+package quill
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// ToHTML renders a document as an HTML fragment in the markup Quill itself
+// produces: one paragraph per line, nested lists, code blocks as pre and
+// formulas as ql-formula spans holding TeX for KaTeX to typeset
+func ToHTML(d Delta) string {
+	lines := splitLines(d)
+	var b strings.Builder
+	var lists listStack
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		a := l.attrs
+		if kind, _ := a["list"].(string); kind != "" {
+			lists.item(&b, kind, max(intAttr(a, "indent"), 0), alignStyle(a))
+			b.WriteString(renderHTMLInline(l.ops))
+			continue
+		}
+		lists.close(&b, 0)
+
+		if truthy(a, "code-block") {
+			lang, _ := a["code-block"].(string)
+			if lang != "" && lang != "plain" && safeClass.MatchString(lang) {
+				b.WriteString(`<pre><code class="language-` + lang + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			for j := i; j < len(lines) && truthy(lines[j].attrs, "code-block"); j++ {
+				if j > i {
+					b.WriteByte('\n')
+				}
+				b.WriteString(html.EscapeString(lineText(lines[j])))
+				i = j
+			}
+			b.WriteString("</code></pre>\n")
+			continue
+		}
+
+		tag := "p"
+		if h := intAttr(a, "header"); h >= 1 && h <= 6 {
+			tag = fmt.Sprintf("h%d", h)
+		} else if truthy(a, "blockquote") {
+			tag = "blockquote"
+		}
+		inner := renderHTMLInline(l.ops)
+		if inner == "" {
+			inner = "<br>"
+		}
+		b.WriteString("<" + tag + alignStyle(a) + ">" + inner + "</" + tag + ">\n")
+	}
+	lists.close(&b, 0)
+	return b.String()
+}
+
+// listStack tracks the lists open around the current item, outermost first
+type listStack []string
+
+// item opens a list item at an indent level, closing or opening lists to
+// reach it; the item is left open so deeper lists nest inside it
+func (s *listStack) item(b *strings.Builder, kind string, level int, style string) {
+	tag := "ul"
+	if kind == "ordered" {
+		tag = "ol"
+	}
+	s.close(b, level+1)
+	if len(*s) == level+1 && (*s)[level] != tag {
+		s.close(b, level)
+	}
+	if len(*s) == level+1 {
+		b.WriteString("</li>\n")
+	}
+	for len(*s) < level+1 {
+		b.WriteString("<" + tag + ">\n")
+		*s = append(*s, tag)
+	}
+	switch kind {
+	case "checked":
+		b.WriteString(`<li class="checked"` + style + `><input type="checkbox" checked disabled> `)
+	case "unchecked":
+		b.WriteString(`<li class="unchecked"` + style + `><input type="checkbox" disabled> `)
+	default:
+		b.WriteString("<li" + style + ">")
+	}
+}
+
+// close ends the lists nested deeper than depth
+func (s *listStack) close(b *strings.Builder, depth int) {
+	for len(*s) > depth {
+		last := len(*s) - 1
+		b.WriteString("</li>\n</" + (*s)[last] + ">\n")
+		*s = (*s)[:last]
+	}
+}
+
+func alignStyle(attrs map[string]any) string {
+	switch attrs["align"] {
+	case "center", "right", "justify":
+		return fmt.Sprintf(` style="text-align: %s"`, attrs["align"])
+	}
+	return ""
+}
+
+func lineText(l line) string {
+	var b strings.Builder
+	for _, op := range l.ops {
+		if s, ok := op.Insert.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+func renderHTMLInline(ops []Op) string {
+	var b strings.Builder
+	for _, op := range ops {
+		switch ins := op.Insert.(type) {
+		case string:
+			b.WriteString(renderHTMLText(ins, op.Attributes))
+		case map[string]any:
+			b.WriteString(renderHTMLEmbed(ins, op.Attributes))
+		}
+	}
+	return b.String()
+}
+
+func renderHTMLText(s string, attrs map[string]any) string {
+	out := html.EscapeString(s)
+	if truthy(attrs, "code") {
+		out = "<code>" + out + "</code>"
+	}
+	switch attrs["script"] {
+	case "super":
+		out = "<sup>" + out + "</sup>"
+	case "sub":
+		out = "<sub>" + out + "</sub>"
+	}
+	if truthy(attrs, "strike") {
+		out = "<s>" + out + "</s>"
+	}
+	if truthy(attrs, "underline") {
+		out = "<u>" + out + "</u>"
+	}
+	if truthy(attrs, "italic") {
+		out = "<em>" + out + "</em>"
+	}
+	if truthy(attrs, "bold") {
+		out = "<strong>" + out + "</strong>"
+	}
+	var style []string
+	if c, ok := attrs["color"].(string); ok && safeCSSValue.MatchString(c) {
+		style = append(style, "color: "+c)
+	}
+	if c, ok := attrs["background"].(string); ok && safeCSSValue.MatchString(c) {
+		style = append(style, "background-color: "+c)
+	}
+	if len(style) > 0 {
+		out = `<span style="` + strings.Join(style, "; ") + `">` + out + "</span>"
+	}
+	if href, ok := attrs["link"].(string); ok && href != "" {
+		out = `<a href="` + html.EscapeString(safeURL(href)) + `">` + out + "</a>"
+	}
+	return out
+}
+
+func renderHTMLEmbed(embed map[string]any, attrs map[string]any) string {
+	if src, ok := embed["image"].(string); ok {
+		size := ""
+		for _, dim := range []string{"width", "height"} {
+			if n := intAttr(attrs, dim); n > 0 {
+				size += fmt.Sprintf(` %s="%d"`, dim, n)
+			}
+		}
+		return `<img src="` + html.EscapeString(safeImageURL(src)) + `"` + size + ` alt="">`
+	}
+	if src, ok := embed["video"].(string); ok {
+		src = html.EscapeString(safeURL(src))
+		return `<a href="` + src + `">` + src + "</a>"
+	}
+	if tex, ok := embed["formula"].(string); ok {
+		tex = html.EscapeString(tex)
+		return `<span class="ql-formula" data-value="` + tex + `">\(` + tex + `\)</span>`
+	}
+	return ""
+}
+
+var (
+	// safeCSSValue admits colours such as #fff, red and rgb(1, 2, 3)
+	safeCSSValue = regexp.MustCompile(`^[#a-zA-Z0-9(),.% ]+$`)
+	safeClass    = regexp.MustCompile(`^[a-zA-Z0-9_+-]+$`)
+	urlScheme    = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+)
+
+// safeURL keeps a link's href unless its scheme could run script, as the
+// editor's link sanitiser does
+func safeURL(href string) string {
+	m := urlScheme.FindStringSubmatch(strings.TrimSpace(href))
+	if m == nil {
+		return href
+	}
+	switch strings.ToLower(m[1]) {
+	case "http", "https", "mailto", "tel", "ftp":
+		return href
+	}
+	return "about:blank"
+}
+
+// safeImageURL also admits the data URLs pasted and imported images use
+func safeImageURL(src string) string {
+	if strings.HasPrefix(strings.ToLower(src), "data:image/") {
+		return src
+	}
+	return safeURL(src)
+}
+
+// ToText renders a document as plain text: list items keep a marker and
+// their indent, formulas their TeX and videos their URL; images are left
+// out
+func ToText(d Delta) string {
+	var b strings.Builder
+	numbers := ListCounter{}
+	for _, l := range Lines(d) {
+		kind, level := l.List()
+		n := numbers.Next(l)
+		if kind != "" {
+			b.WriteString(strings.Repeat("  ", level))
+		}
+		switch kind {
+		case "bullet":
+			b.WriteString("- ")
+		case "ordered":
+			fmt.Fprintf(&b, "%d. ", n)
+		case "checked":
+			b.WriteString("[x] ")
+		case "unchecked":
+			b.WriteString("[ ] ")
+		}
+		if kind == "" && l.Blockquote() {
+			b.WriteString("> ")
+		}
+		for _, op := range l.Ops {
+			switch ins := op.Insert.(type) {
+			case string:
+				b.WriteString(ins)
+			case map[string]any:
+				if tex, ok := ins["formula"].(string); ok {
+					b.WriteString(tex)
+				} else if url, ok := ins["video"].(string); ok {
+					b.WriteString(url)
+				}
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
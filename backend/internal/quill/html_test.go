@@ -0,0 +1,54 @@
+package quill
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHTML(t *testing.T) {
+	want := "<h1>Welcome</h1>\n" +
+		`<p>Some <strong>bold</strong>, <em>italic</em> and <code>code</code> with a <a href="https://example.com">link</a>.</p>` + "\n" +
+		"<p><br></p>\n" +
+		"<ul>\n<li>first<ul>\n<li>nested</li>\n</ul>\n</li>\n</ul>\n" +
+		"<ol>\n<li>step</li>\n</ol>\n" +
+		"<ul>\n" +
+		`<li class="checked"><input type="checkbox" checked disabled> done</li>` + "\n" +
+		`<li class="unchecked"><input type="checkbox" disabled> todo</li>` + "\n" +
+		"</ul>\n" +
+		"<blockquote>quoted</blockquote>\n" +
+		"<pre><code>x := 1\ny := *p</code></pre>\n" +
+		`<p><img src="https://example.com/a.png" alt=""></p>` + "\n" +
+		"<p># not a heading, 2 * 3 [x] &lt;u&gt;</p>\n"
+	assert.Equal(t, want, ToHTML(mustDelta(t, richDoc)))
+}
+
+func TestToHTMLFormatsAndSafety(t *testing.T) {
+	d := mustDelta(t, `{"ops":[
+		{"insert":{"formula":"e^{i\\pi} < 0"}},
+		{"insert":"x","attributes":{"script":"super","color":"#e60000","background":"red;position:fixed"}},
+		{"insert":"bad","attributes":{"link":"javascript:alert(1)"}},
+		{"insert":"note","attributes":{"link":"#note-4"}},
+		{"insert":"\n","attributes":{"align":"center"}},
+		{"insert":"fmt.Println()"},{"insert":"\n","attributes":{"code-block":"go"}}
+	]}`)
+	assert.Equal(t, `<p style="text-align: center">`+
+		`<span class="ql-formula" data-value="e^{i\pi} &lt; 0">\(e^{i\pi} &lt; 0\)</span>`+
+		`<span style="color: #e60000"><sup>x</sup></span>`+
+		`<a href="about:blank">bad</a><a href="#note-4">note</a></p>`+"\n"+
+		`<pre><code class="language-go">fmt.Println()</code></pre>`+"\n", ToHTML(d))
+}
+
+func TestToText(t *testing.T) {
+	d := mustDelta(t, `{"ops":[
+		{"insert":"Title"},{"insert":"\n","attributes":{"header":1}},
+		{"insert":"one"},{"insert":"\n","attributes":{"list":"ordered"}},
+		{"insert":"sub"},{"insert":"\n","attributes":{"list":"bullet","indent":1}},
+		{"insert":"two"},{"insert":"\n","attributes":{"list":"ordered"}},
+		{"insert":"done"},{"insert":"\n","attributes":{"list":"checked"}},
+		{"insert":"again"},{"insert":"\n","attributes":{"list":"ordered"}},
+		{"insert":"area "},{"insert":{"formula":"\\pi r^2"}},{"insert":{"image":"a.png"}},
+		{"insert":"\nwise"},{"insert":"\n","attributes":{"blockquote":true}}
+	]}`)
+	assert.Equal(t, "Title\n1. one\n  - sub\n2. two\n[x] done\n1. again\narea \\pi r^2\n> wise\n", ToText(d))
+}
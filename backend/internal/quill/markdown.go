@@ -0,0 +1,486 @@
+package quill
+
+import (
+	"regexp"
+	"strings"
+)
+
+// block is a unit of Markdown: one line, or a fenced group of code-block
+// lines
+type block struct {
+	md    string
+	lines []line
+}
+
+// ToMarkdown renders a document as line-oriented Markdown
+func ToMarkdown(d Delta) string {
+	bs := renderBlocks(splitLines(d))
+	if len(bs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, blk := range bs {
+		b.WriteString(blk.md)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// FromMarkdown parses line-oriented Markdown into a document
+func FromMarkdown(md string) Delta {
+	var lines []line
+	for _, blk := range parseBlocks(md) {
+		lines = append(lines, blk.lines...)
+	}
+	return joinLines(lines)
+}
+
+// MergeMarkdown applies an edited Markdown rendering of old: lines whose
+// Markdown is unchanged keep their original operations, so formats Markdown
+// cannot express survive the round trip, and only edited lines are re-parsed
+func MergeMarkdown(old Delta, md string) Delta {
+	before := renderBlocks(splitLines(old))
+	after := parseBlocks(md)
+	match := matchBlocks(before, after)
+
+	var lines []line
+	for i, blk := range after {
+		if j := match[i]; j >= 0 {
+			lines = append(lines, before[j].lines...)
+		} else {
+			lines = append(lines, blk.lines...)
+		}
+	}
+	return joinLines(lines)
+}
+
+// maxMatchCells bounds the LCS table for the changed middle of a document
+const maxMatchCells = 4 << 20
+
+// matchBlocks pairs every new block with an identical old one, in order,
+// by longest common subsequence; unmatched blocks map to -1
+func matchBlocks(before, after []block) []int {
+	match := make([]int, len(after))
+	for i := range match {
+		match[i] = -1
+	}
+	// Edits are usually local: pair the common prefix and suffix directly
+	start := 0
+	for start < len(before) && start < len(after) && before[start].md == after[start].md {
+		match[start] = start
+		start++
+	}
+	endB, endA := len(before), len(after)
+	for endB > start && endA > start && before[endB-1].md == after[endA-1].md {
+		endB--
+		endA--
+		match[endA] = endB
+	}
+	n, m := endB-start, endA-start
+	if n == 0 || m == 0 || n*m > maxMatchCells {
+		return match
+	}
+
+	// lcs[i][j] is the LCS length of before[start+i:endB] and after[start+j:endA]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if before[start+i].md == after[start+j].md {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case before[start+i].md == after[start+j].md:
+			match[start+j] = start + i
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+// --- Rendering ---
+
+func renderBlocks(lines []line) []block {
+	var out []block
+	for i := 0; i < len(lines); i++ {
+		if !truthy(lines[i].attrs, "code-block") {
+			out = append(out, block{md: renderLine(lines[i]), lines: lines[i : i+1]})
+			continue
+		}
+		j := i
+		var b strings.Builder
+		b.WriteString("```")
+		for ; j < len(lines) && truthy(lines[j].attrs, "code-block"); j++ {
+			b.WriteByte('\n')
+			for _, op := range lines[j].ops {
+				if s, ok := op.Insert.(string); ok {
+					b.WriteString(s)
+				}
+			}
+		}
+		b.WriteString("\n```")
+		out = append(out, block{md: b.String(), lines: lines[i:j]})
+		i = j - 1
+	}
+	return out
+}
+
+func renderLine(l line) string {
+	text := renderInline(l.ops)
+	a := l.attrs
+	if h := intAttr(a, "header"); h >= 1 && h <= 6 {
+		return strings.Repeat("#", h) + " " + text
+	}
+	indent := strings.Repeat("    ", max(intAttr(a, "indent"), 0))
+	switch a["list"] {
+	case "bullet":
+		return indent + "- " + text
+	case "ordered":
+		return indent + "1. " + text
+	case "checked":
+		return indent + "- [x] " + text
+	case "unchecked":
+		return indent + "- [ ] " + text
+	}
+	if truthy(a, "blockquote") {
+		return "> " + text
+	}
+	return escapeBlockStart(text)
+}
+
+var orderedStart = regexp.MustCompile(`^\d+[.)]( |$)`)
+
+// escapeBlockStart keeps paragraph text from being read back as a heading,
+// quote or list item
+func escapeBlockStart(s string) string {
+	rest := strings.TrimLeft(s, " ")
+	indent := s[:len(s)-len(rest)]
+	switch {
+	case strings.HasPrefix(rest, "#"), strings.HasPrefix(rest, ">"),
+		strings.HasPrefix(rest, "- "), strings.HasPrefix(rest, "+ "), rest == "-", rest == "+":
+		return indent + `\` + rest
+	case orderedStart.MatchString(rest):
+		i := strings.IndexAny(rest, ".)")
+		return indent + rest[:i] + `\` + rest[i:]
+	}
+	return s
+}
+
+func renderInline(ops []Op) string {
+	var b strings.Builder
+	for _, op := range ops {
+		switch ins := op.Insert.(type) {
+		case string:
+			b.WriteString(renderText(ins, op.Attributes))
+		case map[string]any:
+			b.WriteString(renderEmbed(ins))
+		}
+	}
+	return b.String()
+}
+
+func renderEmbed(embed map[string]any) string {
+	if url, ok := embed["image"].(string); ok {
+		return "![](" + url + ")"
+	}
+	if url, ok := embed["video"].(string); ok {
+		return "[video](" + url + ")"
+	}
+	if tex, ok := embed["formula"].(string); ok {
+		return escapeInline("$" + tex + "$")
+	}
+	return ""
+}
+
+func renderText(s string, attrs map[string]any) string {
+	core := strings.TrimSpace(s)
+	if core == "" {
+		return s
+	}
+	lead := s[:strings.Index(s, core)]
+	trail := s[len(lead)+len(core):]
+
+	if truthy(attrs, "code") {
+		core = codeSpan(core)
+	} else {
+		core = escapeInline(core)
+	}
+	if truthy(attrs, "underline") {
+		core = "<u>" + core + "</u>"
+	}
+	if truthy(attrs, "strike") {
+		core = "~~" + core + "~~"
+	}
+	if truthy(attrs, "italic") {
+		core = "*" + core + "*"
+	}
+	if truthy(attrs, "bold") {
+		core = "**" + core + "**"
+	}
+	if url, ok := attrs["link"].(string); ok && url != "" {
+		core = "[" + core + "](" + url + ")"
+	}
+	return lead + core + trail
+}
+
+func codeSpan(s string) string {
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+var inlineEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "`", "\\`", "[", `\[`, "]", `\]`, "~", `\~`, "<", `\<`,
+)
+
+func escapeInline(s string) string {
+	return inlineEscaper.Replace(s)
+}
+
+// --- Parsing ---
+
+var (
+	headingLine = regexp.MustCompile(`^(#{1,6}) (.*)$`)
+	listLine    = regexp.MustCompile(`^(- \[[ xX]\] |[-*+] |\d+[.)] )(.*)$`)
+)
+
+func parseBlocks(md string) []block {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	md = strings.TrimSuffix(md, "\n")
+	if md == "" {
+		return nil
+	}
+	src := strings.Split(md, "\n")
+	var out []block
+	for i := 0; i < len(src); i++ {
+		if !strings.HasPrefix(src[i], "```") {
+			out = append(out, block{md: src[i], lines: []line{parseLine(src[i])}})
+			continue
+		}
+		j := i + 1
+		for j < len(src) && !strings.HasPrefix(src[j], "```") {
+			j++
+		}
+		blk := block{md: strings.Join(src[i:min(j+1, len(src))], "\n")}
+		for _, code := range src[i+1 : j] {
+			l := line{attrs: map[string]any{"code-block": true}}
+			if code != "" {
+				l.ops = []Op{{Insert: code}}
+			}
+			blk.lines = append(blk.lines, l)
+		}
+		if len(blk.lines) > 0 {
+			out = append(out, blk)
+		}
+		i = j
+	}
+	return out
+}
+
+func parseLine(s string) line {
+	if m := headingLine.FindStringSubmatch(s); m != nil {
+		return line{ops: parseInline(m[2], nil), attrs: map[string]any{"header": len(m[1])}}
+	}
+	if s == ">" || strings.HasPrefix(s, "> ") {
+		return line{ops: parseInline(strings.TrimPrefix(strings.TrimPrefix(s, ">"), " "), nil), attrs: map[string]any{"blockquote": true}}
+	}
+
+	rest := strings.TrimLeft(s, " \t")
+	width := 0
+	for _, r := range s[:len(s)-len(rest)] {
+		if r == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	if m := listLine.FindStringSubmatch(rest); m != nil {
+		attrs := map[string]any{}
+		switch marker := m[1]; {
+		case marker == "- [ ] ":
+			attrs["list"] = "unchecked"
+		case strings.HasPrefix(marker, "- ["):
+			attrs["list"] = "checked"
+		case marker[0] >= '0' && marker[0] <= '9':
+			attrs["list"] = "ordered"
+		default:
+			attrs["list"] = "bullet"
+		}
+		if level := (width + 2) / 4; level > 0 {
+			attrs["indent"] = level
+		}
+		return line{ops: parseInline(m[2], nil), attrs: attrs}
+	}
+	return line{ops: parseInline(s, nil)}
+}
+
+// inline toggles, longest first so "**" wins over "*"
+var toggles = []struct {
+	marker, attr string
+	on           bool // for HTML tags: whether the marker opens
+}{
+	{"<u>", "underline", true},
+	{"</u>", "underline", false},
+	{"**", "bold", false},
+	{"~~", "strike", false},
+	{"*", "italic", false},
+}
+
+// parseInline reads the inline Markdown produced by ToMarkdown; base holds
+// attributes applied to everything, such as an enclosing link
+func parseInline(s string, base map[string]any) []Op {
+	var ops []Op
+	var text strings.Builder
+	marks := map[string]any{}
+
+	flush := func() {
+		if text.Len() > 0 {
+			ops = append(ops, Op{Insert: text.String(), Attributes: withAttrs(base, marks)})
+			text.Reset()
+		}
+	}
+
+outer:
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := 0
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			fence := strings.Repeat("`", n)
+			if end := findRun(s[i+n:], fence); end >= 0 {
+				code := s[i+n : i+n+end]
+				if n > 1 && len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				flush()
+				ops = append(ops, Op{Insert: code, Attributes: withAttrs(withAttrs(base, marks), map[string]any{"code": true})})
+				i += n + end + n
+				continue
+			}
+
+		case c == '!' && strings.HasPrefix(s[i:], "!["):
+			if _, url, n, ok := parseLink(s[i+1:]); ok {
+				flush()
+				ops = append(ops, Op{Insert: map[string]any{"image": url}})
+				i += 1 + n
+				continue
+			}
+
+		case c == '[':
+			if label, url, n, ok := parseLink(s[i:]); ok {
+				flush()
+				ops = append(ops, parseInline(label, withAttrs(withAttrs(base, marks), map[string]any{"link": url}))...)
+				i += n
+				continue
+			}
+		}
+
+		for _, t := range toggles {
+			if !strings.HasPrefix(s[i:], t.marker) {
+				continue
+			}
+			_, active := marks[t.attr]
+			opening := !active
+			if t.marker == "<u>" || t.marker == "</u>" {
+				if opening != t.on {
+					break
+				}
+			}
+			// An opener without a closer later on is literal text
+			if opening {
+				closer := t.marker
+				if t.marker == "<u>" {
+					closer = "</u>"
+				}
+				if !strings.Contains(s[i+len(t.marker):], closer) {
+					break
+				}
+			}
+			flush()
+			if opening {
+				marks[t.attr] = true
+			} else {
+				delete(marks, t.attr)
+			}
+			i += len(t.marker)
+			continue outer
+		}
+
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return ops
+}
+
+// parseLink reads "[label](url)" at the start of s, returning the number of
+// bytes consumed
+func parseLink(s string) (label, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if !strings.HasPrefix(s[i+1:], "(") {
+					return "", "", 0, false
+				}
+				end := strings.IndexByte(s[i+2:], ')')
+				if end < 0 {
+					return "", "", 0, false
+				}
+				return s[1:i], s[i+2 : i+2+end], i + 3 + end, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// findRun finds a run of exactly len(fence) backticks
+func findRun(s, fence string) int {
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], fence)
+		if j < 0 {
+			return -1
+		}
+		j += i
+		k := j + len(fence)
+		if (j == 0 || s[j-1] != '`') && (k >= len(s) || s[k] != '`') {
+			return j
+		}
+		for k < len(s) && s[k] == '`' {
+			k++
+		}
+		i = k
+	}
+	return -1
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
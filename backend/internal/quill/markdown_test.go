@@ -0,0 +1,122 @@
+package quill
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDelta(t *testing.T, s string) Delta {
+	t.Helper()
+	var d Delta
+	require.NoError(t, json.Unmarshal([]byte(s), &d))
+	return d
+}
+
+func jsonOf(t *testing.T, d Delta) string {
+	t.Helper()
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	return string(b)
+}
+
+const richDoc = `{"ops":[
+	{"insert":"Welcome"},{"insert":"\n","attributes":{"header":1}},
+	{"insert":"Some "},{"insert":"bold","attributes":{"bold":true}},{"insert":", "},
+	{"insert":"italic","attributes":{"italic":true}},{"insert":" and "},
+	{"insert":"code","attributes":{"code":true}},{"insert":" with a "},
+	{"insert":"link","attributes":{"link":"https://example.com"}},{"insert":".\n\n"},
+	{"insert":"first"},{"insert":"\n","attributes":{"list":"bullet"}},
+	{"insert":"nested"},{"insert":"\n","attributes":{"list":"bullet","indent":1}},
+	{"insert":"step"},{"insert":"\n","attributes":{"list":"ordered"}},
+	{"insert":"done"},{"insert":"\n","attributes":{"list":"checked"}},
+	{"insert":"todo"},{"insert":"\n","attributes":{"list":"unchecked"}},
+	{"insert":"quoted"},{"insert":"\n","attributes":{"blockquote":true}},
+	{"insert":"x := 1"},{"insert":"\n","attributes":{"code-block":true}},
+	{"insert":"y := *p"},{"insert":"\n","attributes":{"code-block":true}},
+	{"insert":{"image":"https://example.com/a.png"}},{"insert":"\n"},
+	{"insert":"# not a heading, 2 * 3 [x] <u>\n"}
+]}`
+
+func TestToMarkdown(t *testing.T) {
+	want := "# Welcome\n" +
+		"Some **bold**, *italic* and `code` with a [link](https://example.com).\n" +
+		"\n" +
+		"- first\n" +
+		"    - nested\n" +
+		"1. step\n" +
+		"- [x] done\n" +
+		"- [ ] todo\n" +
+		"> quoted\n" +
+		"```\nx := 1\ny := *p\n```\n" +
+		"![](https://example.com/a.png)\n" +
+		`\# not a heading, 2 \* 3 \[x\] \<u>` + "\n"
+	assert.Equal(t, want, ToMarkdown(mustDelta(t, richDoc)))
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	d := mustDelta(t, richDoc)
+	assert.JSONEq(t, jsonOf(t, joinLines(splitLines(d))), jsonOf(t, FromMarkdown(ToMarkdown(d))))
+}
+
+func TestFromMarkdownInline(t *testing.T) {
+	d := FromMarkdown("***both*** ~~gone~~ <u>under</u> [**bold link**](/x) a * b\n")
+	assert.JSONEq(t, `{"ops":[
+		{"insert":"both","attributes":{"bold":true,"italic":true}},
+		{"insert":" "},
+		{"insert":"gone","attributes":{"strike":true}},
+		{"insert":" "},
+		{"insert":"under","attributes":{"underline":true}},
+		{"insert":" "},
+		{"insert":"bold link","attributes":{"bold":true,"link":"/x"}},
+		{"insert":" a * b\n"}
+	]}`, jsonOf(t, d))
+}
+
+func TestFromMarkdownListIndent(t *testing.T) {
+	d := FromMarkdown("* a\n  + b\n\t3) c\n")
+	assert.JSONEq(t, `{"ops":[
+		{"insert":"a"},{"insert":"\n","attributes":{"list":"bullet"}},
+		{"insert":"b"},{"insert":"\n","attributes":{"list":"bullet","indent":1}},
+		{"insert":"c"},{"insert":"\n","attributes":{"list":"ordered","indent":1}}
+	]}`, jsonOf(t, d))
+}
+
+func TestMergeMarkdownKeepsUnchangedLines(t *testing.T) {
+	old := mustDelta(t, `{"ops":[
+		{"insert":"red","attributes":{"color":"#ff0000"}},{"insert":"\n","attributes":{"align":"center"}},
+		{"insert":"plain\n"},
+		{"insert":"tail","attributes":{"size":"large"}},{"insert":"\n"}
+	]}`)
+	md := ToMarkdown(old)
+	assert.Equal(t, "red\nplain\ntail\n", md)
+
+	// Unedited, the document is unchanged despite the lossy rendering
+	assert.JSONEq(t, jsonOf(t, old), jsonOf(t, MergeMarkdown(old, md)))
+
+	// Editing the middle line only touches that line
+	merged := MergeMarkdown(old, "red\n**plain** text\nnew line\ntail\n")
+	assert.JSONEq(t, `{"ops":[
+		{"insert":"red","attributes":{"color":"#ff0000"}},{"insert":"\n","attributes":{"align":"center"}},
+		{"insert":"plain","attributes":{"bold":true}},{"insert":" text\nnew line\n"},
+		{"insert":"tail","attributes":{"size":"large"}},{"insert":"\n"}
+	]}`, jsonOf(t, merged))
+}
+
+func TestEmptyDocument(t *testing.T) {
+	assert.Equal(t, "", ToMarkdown(Delta{}))
+	assert.Empty(t, FromMarkdown("").Ops)
+	assert.Equal(t, "a b", PlainText(mustDelta(t, `{"ops":[{"insert":"a "},{"insert":{"image":"x"}},{"insert":"b\n"}]}`)))
+}
+
+func TestNoteLink(t *testing.T) {
+	id, ok := NoteLinkID(NoteLink(42))
+	assert.True(t, ok)
+	assert.Equal(t, 42, id)
+	for _, href := range []string{"#note-", "#note-x", "#note-0", "https://example.com", "#heading"} {
+		_, ok := NoteLinkID(href)
+		assert.False(t, ok, href)
+	}
+}
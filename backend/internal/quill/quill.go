@@ -0,0 +1,245 @@
+// Package quill converts between Quill Deltas, the content model of the
+// collaborative note documents, and Markdown, and renders them as HTML and
+// plain text for export.
+//
+// The Markdown is line-oriented like the editor: every line of the file is
+// one Quill line and blank lines are empty lines, rather than CommonMark's
+// paragraph folding. Formats Markdown cannot express (colours, sizes,
+// alignment, most embeds) are dropped by ToMarkdown; MergeMarkdown keeps them
+// on the lines an edit left untouched.
+package quill
+
+import (
+	"encoding/json"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Op is one Delta operation. Documents only contain inserts, whose value is
+// a string or an embed such as {"image": url}.
+type Op struct {
+	Insert     any            `json:"insert,omitempty"`
+	Delete     int            `json:"delete,omitempty"`
+	Retain     int            `json:"retain,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// Delta is a Quill document or change
+type Delta struct {
+	Ops []Op `json:"ops"`
+}
+
+// line is a document line: inline content plus the block format carried by
+// its terminating newline
+type line struct {
+	ops   []Op
+	attrs map[string]any
+}
+
+// splitLines breaks a document into lines; a missing final newline is
+// tolerated
+func splitLines(d Delta) []line {
+	var out []line
+	var cur line
+	for _, op := range d.Ops {
+		switch ins := op.Insert.(type) {
+		case nil:
+			// retain and delete are not part of a document
+		case string:
+			parts := strings.Split(ins, "\n")
+			for i, part := range parts {
+				if part != "" {
+					cur.ops = append(cur.ops, Op{Insert: part, Attributes: op.Attributes})
+				}
+				if i < len(parts)-1 {
+					cur.attrs = op.Attributes
+					out = append(out, cur)
+					cur = line{}
+				}
+			}
+		default:
+			cur.ops = append(cur.ops, op)
+		}
+	}
+	if len(cur.ops) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// Line is a document line as renderers outside the package see it: the
+// inline operations and the block format of the terminating newline
+type Line struct {
+	Ops   []Op
+	Attrs map[string]any
+}
+
+// Lines breaks a document into lines
+func Lines(d Delta) []Line {
+	lines := splitLines(d)
+	out := make([]Line, len(lines))
+	for i, l := range lines {
+		out[i] = Line{Ops: l.ops, Attrs: l.attrs}
+	}
+	return out
+}
+
+// Header is the heading level, 1 to 6, or 0 for other lines
+func (l Line) Header() int {
+	if h := intAttr(l.Attrs, "header"); h >= 1 && h <= 6 {
+		return h
+	}
+	return 0
+}
+
+// List is the list type (bullet, ordered, checked or unchecked) and indent
+// level of a list item; kind is empty for other lines
+func (l Line) List() (kind string, level int) {
+	kind, _ = l.Attrs["list"].(string)
+	if kind == "" {
+		return "", 0
+	}
+	return kind, max(intAttr(l.Attrs, "indent"), 0)
+}
+
+func (l Line) CodeBlock() bool  { return truthy(l.Attrs, "code-block") }
+func (l Line) Blockquote() bool { return truthy(l.Attrs, "blockquote") }
+
+// Align is center, right, justify or empty for the default
+func (l Line) Align() string {
+	switch a, _ := l.Attrs["align"].(string); a {
+	case "center", "right", "justify":
+		return a
+	}
+	return ""
+}
+
+// ListCounter numbers ordered list items in document order; a list
+// restarts after any line that is not a deeper item
+type ListCounter map[int]int // indent level to the last number
+
+// Next returns the number of an ordered item, or 0 for other lines
+func (c ListCounter) Next(l Line) int {
+	kind, level := l.List()
+	for lvl := range c {
+		if kind == "" || lvl > level || (lvl == level && kind != "ordered") {
+			delete(c, lvl)
+		}
+	}
+	if kind != "ordered" {
+		return 0
+	}
+	c[level]++
+	return c[level]
+}
+
+// joinLines rebuilds a document, merging neighbouring inserts that share
+// attributes
+func joinLines(lines []line) Delta {
+	d := Delta{Ops: []Op{}}
+	for _, l := range lines {
+		for _, op := range l.ops {
+			d.push(op)
+		}
+		d.push(Op{Insert: "\n", Attributes: l.attrs})
+	}
+	return d
+}
+
+func (d *Delta) push(op Op) {
+	if len(op.Attributes) == 0 {
+		op.Attributes = nil
+	}
+	if s, ok := op.Insert.(string); ok && len(d.Ops) > 0 {
+		last := &d.Ops[len(d.Ops)-1]
+		if prev, ok := last.Insert.(string); ok && sameAttrs(last.Attributes, op.Attributes) {
+			last.Insert = prev + s
+			return
+		}
+	}
+	d.Ops = append(d.Ops, op)
+}
+
+func sameAttrs(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// PlainText is the document text without formatting or embeds, trimmed like
+// the editor's search text
+func PlainText(d Delta) string {
+	var b strings.Builder
+	for _, op := range d.Ops {
+		if s, ok := op.Insert.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// noteLinkPrefix starts the href of a link to another note, which the
+// editor opens in place rather than navigating
+const noteLinkPrefix = "#note-"
+
+// NoteLink is the href of a link to a note
+func NoteLink(noteID int) string {
+	return noteLinkPrefix + strconv.Itoa(noteID)
+}
+
+// NoteLinkID returns the note a NoteLink href points at
+func NoteLinkID(href string) (int, bool) {
+	if !strings.HasPrefix(href, noteLinkPrefix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(href[len(noteLinkPrefix):])
+	return id, err == nil && id > 0
+}
+
+func truthy(attrs map[string]any, key string) bool {
+	switch v := attrs[key].(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+func intAttr(attrs map[string]any, key string) int {
+	switch v := attrs[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		n := 0
+		for _, r := range v {
+			if r < '0' || r > '9' {
+				return 0
+			}
+			n = n*10 + int(r-'0')
+		}
+		return n
+	}
+	return 0
+}
+
+func withAttrs(base map[string]any, extra map[string]any) map[string]any {
+	if len(base) == 0 && len(extra) == 0 {
+		return nil
+	}
+	out := maps.Clone(base)
+	if out == nil {
+		out = map[string]any{}
+	}
+	maps.Copy(out, extra)
+	return out
+}
@@ -0,0 +1,381 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for the images embedded in notes
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+
+	"go-notes/backend/internal/quill"
+)
+
+func init() {
+	formats["pdf"] = Format{Name: "pdf", Ext: ".pdf", ContentType: "application/pdf", Write: writePDF}
+}
+
+// Page layout in millimetres, and type sizes in points
+const (
+	pdfMargin     = 20.0
+	pdfIndent     = 7.0   // per list level and for quotes
+	pdfMaxImageMM = 120.0 // tallest an image is drawn
+	pdfBodySize   = 11.0
+	pdfCodeSize   = 9.0
+)
+
+var pdfHeaderSizes = [7]float64{0, 20, 16, 14, 12, 11, 11}
+
+// pdfWriter lays out a note with the PDF core fonts: Helvetica for text
+// and Courier for code. They cover Windows-1252, so other scripts are
+// replaced.
+type pdfWriter struct {
+	pdf    *fpdf.Fpdf
+	tr     func(string) string
+	load   Images
+	images int
+}
+
+func writePDF(w io.Writer, d Doc) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	p := &pdfWriter{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor(""), load: d.Images}
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(d.Title, true)
+	pdf.SetKeywords(strings.Join(d.Tags, ", "), true)
+	pdf.SetCreator("go-notes", true)
+	if !d.UpdatedAt.IsZero() {
+		pdf.SetCreationDate(d.UpdatedAt)
+		pdf.SetModificationDate(d.UpdatedAt)
+	}
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin / 2)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 4, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	p.header(d)
+	p.body(d.Content)
+	return pdf.Output(w)
+}
+
+// header writes the title, tags and update time above a rule
+func (p *pdfWriter) header(d Doc) {
+	pdf := p.pdf
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.MultiCell(0, 9, p.tr(d.Title), "", "L", false)
+
+	var meta []string
+	if len(d.Tags) > 0 {
+		meta = append(meta, "Tags: "+strings.Join(d.Tags, ", "))
+	}
+	if !d.UpdatedAt.IsZero() {
+		meta = append(meta, "Updated "+d.UpdatedAt.UTC().Format("2 January 2006 15:04 UTC"))
+	}
+	if len(meta) > 0 {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.MultiCell(0, 5, p.tr(strings.Join(meta, "  ·  ")), "", "L", false)
+	}
+	pdf.Ln(2)
+	width, _ := pdf.GetPageSize()
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.Line(pdfMargin, pdf.GetY(), width-pdfMargin, pdf.GetY())
+	pdf.Ln(4)
+}
+
+func (p *pdfWriter) body(d quill.Delta) {
+	pdf := p.pdf
+	lines := quill.Lines(d)
+	numbers := quill.ListCounter{}
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		n := numbers.Next(l)
+		pdf.SetTextColor(0, 0, 0)
+		switch {
+		case l.CodeBlock():
+			var code []string
+			for ; i < len(lines) && lines[i].CodeBlock(); i++ {
+				code = append(code, lineText(lines[i]))
+			}
+			i--
+			p.code(code)
+		case l.Header() > 0:
+			size := pdfHeaderSizes[l.Header()]
+			pdf.Ln(size * 0.25)
+			p.inline(l, size, "B", size*0.5)
+			pdf.Ln(size * 0.15)
+		default:
+			if kind, level := l.List(); kind != "" {
+				p.listItem(l, kind, level, n)
+				continue
+			}
+			if l.Blockquote() {
+				p.quote(l)
+				continue
+			}
+			p.inline(l, pdfBodySize, "", 5.5)
+		}
+	}
+}
+
+// inline writes a line's text and embeds, wrapping at the right margin
+// and continuing wrapped lines at the current left margin
+func (p *pdfWriter) inline(l quill.Line, size float64, base string, height float64) {
+	pdf := p.pdf
+	if align := l.Align(); align != "" && !hasEmbeds(l) {
+		pdf.SetFont("Helvetica", base, size)
+		pdf.WriteAligned(0, height, p.tr(lineText(l)), strings.ToUpper(align[:1]))
+		pdf.Ln(height)
+		return
+	}
+	for _, op := range l.Ops {
+		switch ins := op.Insert.(type) {
+		case string:
+			p.text(ins, op.Attributes, size, base, height)
+		case map[string]any:
+			p.embed(ins, size, height)
+		}
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(height)
+}
+
+func (p *pdfWriter) text(s string, attrs map[string]any, size float64, base string, height float64) {
+	pdf := p.pdf
+	family, style := "Helvetica", base
+	if attrs["code"] == true {
+		family = "Courier"
+	}
+	if attrs["bold"] == true && !strings.Contains(style, "B") {
+		style += "B"
+	}
+	if attrs["italic"] == true && !strings.Contains(style, "I") {
+		style += "I"
+	}
+	if attrs["underline"] == true {
+		style += "U"
+	}
+	if attrs["strike"] == true {
+		style += "S"
+	}
+	pdf.SetFont(family, style, size)
+	r, g, b := 0, 0, 0
+	if c, ok := attrs["color"].(string); ok {
+		r, g, b = parseColor(c)
+	}
+	href, _ := attrs["link"].(string)
+	if _, isNote := quill.NoteLinkID(href); href != "" && !isNote {
+		pdf.SetTextColor(30, 90, 200)
+		pdf.WriteLinkString(height, p.tr(s), href)
+		return
+	}
+	pdf.SetTextColor(r, g, b)
+	pdf.Write(height, p.tr(s))
+}
+
+// embed draws an image on a line of its own, or writes a formula's TeX
+// or a video's URL inline
+func (p *pdfWriter) embed(e map[string]any, size, height float64) {
+	pdf := p.pdf
+	if tex, ok := e["formula"].(string); ok {
+		pdf.SetFont("Courier", "I", size)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Write(height, p.tr(tex))
+		return
+	}
+	if url, ok := e["video"].(string); ok {
+		pdf.SetFont("Helvetica", "", size)
+		pdf.SetTextColor(30, 90, 200)
+		pdf.WriteLinkString(height, p.tr(url), url)
+		return
+	}
+	src, ok := e["image"].(string)
+	if !ok {
+		return
+	}
+	name, info := p.image(src)
+	if info == nil {
+		// Remote images are not fetched; the PDF links to them instead
+		pdf.SetFont("Helvetica", "I", size)
+		pdf.SetTextColor(110, 110, 110)
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+			pdf.WriteLinkString(height, "[image]", src)
+		} else {
+			pdf.Write(height, "[image]")
+		}
+		return
+	}
+
+	left, _, right, _ := pdf.GetMargins()
+	pageW, pageH := pdf.GetPageSize()
+	w, h := info.Width(), info.Height()
+	if maxW := pageW - left - right; w > maxW {
+		w, h = maxW, h*maxW/w
+	}
+	if h > pdfMaxImageMM {
+		w, h = w*pdfMaxImageMM/h, pdfMaxImageMM
+	}
+	if pdf.GetX() > left {
+		pdf.Ln(height)
+	}
+	if pdf.GetY()+h > pageH-pdfMargin {
+		pdf.AddPage()
+	}
+	pdf.ImageOptions(name, left, pdf.GetY(), w, h, true, fpdf.ImageOptions{}, 0, "")
+}
+
+// image registers an embedded image, from a data URL or loaded by the
+// document's Images, re-encoded as the JPEG or PNG fpdf reads; nil means
+// it cannot be drawn
+func (p *pdfWriter) image(src string) (string, *fpdf.ImageInfoType) {
+	raw := dataURLImage(src)
+	if raw == nil && p.load != nil && !strings.HasPrefix(src, "data:") {
+		raw = p.load(src)
+	}
+	if raw == nil {
+		return "", nil
+	}
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	kind := "PNG"
+	if format == "jpeg" {
+		kind = "JPG"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return "", nil
+	}
+	p.images++
+	name := "image" + strconv.Itoa(p.images)
+	info := p.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: kind, ReadDpi: true}, &buf)
+	if p.pdf.Err() {
+		// A picture fpdf cannot read must not fail the whole document
+		p.pdf.ClearError()
+		return "", nil
+	}
+	return name, info
+}
+
+// dataURLImage decodes a base64 data URL of an image, or returns nil
+func dataURLImage(src string) []byte {
+	meta, data, ok := strings.Cut(src, ",")
+	if !ok || !strings.HasPrefix(meta, "data:image/") || !strings.HasSuffix(meta, ";base64") {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+func (p *pdfWriter) listItem(l quill.Line, kind string, level, number int) {
+	pdf := p.pdf
+	left, _, _, _ := pdf.GetMargins()
+	indent := pdfMargin + float64(level)*pdfIndent
+	pdf.SetX(indent)
+	pdf.SetFont("Helvetica", "", pdfBodySize)
+	switch kind {
+	case "ordered":
+		pdf.CellFormat(pdfIndent, 5.5, strconv.Itoa(number)+".", "", 0, "L", false, 0, "")
+	case "checked", "unchecked":
+		y := pdf.GetY() + 1.2
+		pdf.SetDrawColor(90, 90, 90)
+		pdf.Rect(indent+0.5, y, 3, 3, "D")
+		if kind == "checked" {
+			pdf.Line(indent+1, y+1.6, indent+1.8, y+2.5)
+			pdf.Line(indent+1.8, y+2.5, indent+3.1, y+0.6)
+		}
+		pdf.SetX(indent + pdfIndent)
+	default:
+		pdf.CellFormat(pdfIndent, 5.5, p.tr("•"), "", 0, "L", false, 0, "")
+	}
+	pdf.SetLeftMargin(indent + pdfIndent)
+	p.inline(l, pdfBodySize, "", 5.5)
+	pdf.SetLeftMargin(left)
+}
+
+func (p *pdfWriter) quote(l quill.Line) {
+	pdf := p.pdf
+	left, _, _, _ := pdf.GetMargins()
+	top := pdf.GetY()
+	pdf.SetLeftMargin(left + pdfIndent)
+	pdf.SetX(left + pdfIndent)
+	p.inline(l, pdfBodySize, "I", 5.5)
+	pdf.SetLeftMargin(left)
+	// The bar is only drawn when the quote stayed on one page
+	if bottom := pdf.GetY(); bottom > top {
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.SetLineWidth(0.8)
+		pdf.Line(left+1.5, top, left+1.5, bottom)
+		pdf.SetLineWidth(0.2)
+	}
+}
+
+// code draws a run of code-block lines on a shaded background
+func (p *pdfWriter) code(lines []string) {
+	pdf := p.pdf
+	pdf.SetFont("Courier", "", pdfCodeSize)
+	pdf.SetFillColor(244, 244, 244)
+	pdf.Ln(1)
+	for _, l := range lines {
+		l = strings.ReplaceAll(l, "\t", "    ")
+		if l == "" {
+			l = " "
+		}
+		pdf.MultiCell(0, 4.5, p.tr(l), "", "L", true)
+	}
+	pdf.Ln(2)
+}
+
+func lineText(l quill.Line) string {
+	var b strings.Builder
+	for _, op := range l.Ops {
+		if s, ok := op.Insert.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+func hasEmbeds(l quill.Line) bool {
+	for _, op := range l.Ops {
+		if _, ok := op.Insert.(string); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColor reads the #rgb and #rrggbb colours the editor writes; others
+// are drawn black
+func parseColor(c string) (r, g, b int) {
+	c = strings.TrimPrefix(strings.TrimSpace(c), "#")
+	if len(c) == 3 {
+		c = string([]byte{c[0], c[0], c[1], c[1], c[2], c[2]})
+	}
+	if len(c) != 6 {
+		return 0, 0, 0
+	}
+	v, err := strconv.ParseUint(c, 16, 32)
+	if err != nil {
+		return 0, 0, 0
+	}
+	return int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff)
+}
@@ -0,0 +1,118 @@
+// Package render turns a note into a file to download or share: Markdown,
+// a standalone HTML page, plain text or a PDF, rendered from the note's
+// Delta.
+package render
+
+import (
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/quill"
+)
+
+// Doc is a note to render
+type Doc struct {
+	Title     string
+	Tags      []string
+	UpdatedAt time.Time // zero when unknown
+	Content   quill.Delta
+	// Images loads the images the note embeds by URL, such as its
+	// attachments; without it only data URLs are drawn
+	Images Images
+}
+
+// Images returns the content of an embedded image's URL, or nil when it
+// cannot be loaded
+type Images func(src string) []byte
+
+// NewDoc takes a note's title, tags and update time from its metadata
+func NewDoc(n db.Note, content quill.Delta) Doc {
+	d := Doc{Title: n.Title, Content: content}
+	for _, t := range n.Tags {
+		d.Tags = append(d.Tags, t.Name)
+	}
+	// The stores' timestamps are RFC 3339 on both databases
+	d.UpdatedAt, _ = time.Parse(time.RFC3339Nano, n.UpdatedAt)
+	return d
+}
+
+// Format is a file type a note can be rendered as
+type Format struct {
+	Name        string // the ?format= value
+	Ext         string // file extension, with the dot
+	ContentType string
+	Write       func(w io.Writer, d Doc) error
+}
+
+var formats = map[string]Format{
+	"md":   {Name: "md", Ext: ".md", ContentType: "text/markdown; charset=utf-8", Write: writeMarkdown},
+	"html": {Name: "html", Ext: ".html", ContentType: "text/html; charset=utf-8", Write: writeHTML},
+	"txt":  {Name: "txt", Ext: ".txt", ContentType: "text/plain; charset=utf-8", Write: writeText},
+}
+
+// Lookup returns the format with a ?format= name
+func Lookup(name string) (Format, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Names lists the formats, for error messages
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeMarkdown(w io.Writer, d Doc) error {
+	_, err := io.WriteString(w, quill.ToMarkdown(d.Content))
+	return err
+}
+
+func writeText(w io.Writer, d Doc) error {
+	_, err := io.WriteString(w, quill.ToText(d.Content))
+	return err
+}
+
+// katex typesets the formulas of an HTML export when it is opened, as the
+// editor does; pages without formulas load nothing
+const katex = `<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.25/dist/katex.min.css">
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.25/dist/katex.min.js"></script>
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.25/dist/contrib/auto-render.min.js" onload="renderMathInElement(document.body)"></script>
+`
+
+const htmlStyle = `<style>
+body { max-width: 48rem; margin: 2rem auto; padding: 0 1rem; font-family: system-ui, sans-serif; line-height: 1.5; color: #222; }
+p { margin: 0; }
+pre { background: #f4f4f4; padding: 0.75rem; overflow-x: auto; }
+code { font-family: ui-monospace, monospace; }
+blockquote { margin: 0; padding-left: 1rem; border-left: 4px solid #ccc; }
+li.checked, li.unchecked { list-style: none; }
+img { max-width: 100%; }
+</style>
+`
+
+func writeHTML(w io.Writer, d Doc) error {
+	body := quill.ToHTML(d.Content)
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(d.Title) + "</title>\n")
+	if len(d.Tags) > 0 {
+		b.WriteString(`<meta name="keywords" content="` + html.EscapeString(strings.Join(d.Tags, ", ")) + "\">\n")
+	}
+	b.WriteString(htmlStyle)
+	if strings.Contains(body, `class="ql-formula"`) {
+		b.WriteString(katex)
+	}
+	b.WriteString("</head>\n<body>\n")
+	b.WriteString(body)
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
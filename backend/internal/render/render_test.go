@@ -0,0 +1,113 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/quill"
+)
+
+func pngURL(t *testing.T) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 6), 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func render(t *testing.T, name string, d Doc) string {
+	t.Helper()
+	f, ok := Lookup(name)
+	require.True(t, ok)
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf, d))
+	return buf.String()
+}
+
+func TestNewDoc(t *testing.T) {
+	d := NewDoc(db.Note{Title: "Plan", UpdatedAt: "2024-03-04T05:06:07Z", Tags: []db.Tag{{Name: "work"}}}, quill.Delta{})
+	assert.Equal(t, "Plan", d.Title)
+	assert.Equal(t, []string{"work"}, d.Tags)
+	assert.Equal(t, time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC), d.UpdatedAt)
+	assert.Equal(t, []string{"html", "md", "pdf", "txt"}, Names())
+}
+
+func TestHTML(t *testing.T) {
+	page := render(t, "html", Doc{Title: "A <b>", Tags: []string{"x"}, Content: quill.FromMarkdown("Hello\n")})
+	assert.Contains(t, page, "<title>A &lt;b&gt;</title>")
+	assert.Contains(t, page, `<meta name="keywords" content="x">`)
+	assert.Contains(t, page, "<p>Hello</p>")
+	assert.NotContains(t, page, "katex", "pages without formulas load nothing")
+
+	page = render(t, "html", Doc{Content: quill.Delta{Ops: []quill.Op{{Insert: map[string]any{"formula": "x^2"}}, {Insert: "\n"}}}})
+	assert.Contains(t, page, "katex.min.js")
+}
+
+func TestPDF(t *testing.T) {
+	ops := []quill.Op{
+		{Insert: "Agenda"}, {Insert: "\n", Attributes: map[string]any{"header": 1}},
+		{Insert: "Ship "}, {Insert: "it", Attributes: map[string]any{"bold": true, "color": "#e60000"}},
+		{Insert: " now", Attributes: map[string]any{"link": "https://example.com"}}, {Insert: "\n"},
+		{Insert: "café ✓"}, {Insert: "\n", Attributes: map[string]any{"list": "checked"}},
+		{Insert: "nested"}, {Insert: "\n", Attributes: map[string]any{"list": "ordered", "indent": 1}},
+		{Insert: "func main() {}"}, {Insert: "\n", Attributes: map[string]any{"code-block": true}},
+		{Insert: "\tpanic(1)"}, {Insert: "\n", Attributes: map[string]any{"code-block": true}},
+		{Insert: map[string]any{"image": pngURL(t)}},
+		{Insert: map[string]any{"image": "data:image/png;base64,bm90IGEgcG5n"}},
+		{Insert: map[string]any{"formula": "e^{i\\pi}"}},
+		{Insert: "\n", Attributes: map[string]any{"align": "center"}},
+		{Insert: "wise words"}, {Insert: "\n", Attributes: map[string]any{"blockquote": true}},
+	}
+	for i := 0; i < 80; i++ {
+		ops = append(ops, quill.Op{Insert: "Line of the long note\n"})
+	}
+	doc := render(t, "pdf", Doc{
+		Title:     "Weekly sync",
+		Tags:      []string{"meetings"},
+		UpdatedAt: time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC),
+		Content:   quill.Delta{Ops: ops},
+	})
+	assert.True(t, strings.HasPrefix(doc, "%PDF-"))
+	assert.Contains(t, doc, "%%EOF")
+	assert.Equal(t, 1, strings.Count(doc, "/Subtype /Image"), "the unreadable image is left out")
+	assert.Greater(t, strings.Count(doc, "/Type /Page\n"), 1, "long notes break across pages")
+	assert.Contains(t, doc, "/URI (https://example.com)")
+}
+
+func TestPDFImagesByURL(t *testing.T) {
+	photo, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pngURL(t), "data:image/png;base64,"))
+	require.NoError(t, err)
+	var asked []string
+	doc := render(t, "pdf", Doc{
+		Title: "Trip",
+		Content: quill.Delta{Ops: []quill.Op{
+			{Insert: map[string]any{"image": "/api/workspaces/1/notes/2/attachments/3?key=abc"}},
+			{Insert: map[string]any{"image": "/api/workspaces/1/notes/2/attachments/4?key=def"}},
+			{Insert: "\n"},
+		}},
+		Images: func(src string) []byte {
+			asked = append(asked, src)
+			if strings.Contains(src, "/attachments/3?") {
+				return photo
+			}
+			return nil
+		},
+	})
+	assert.Len(t, asked, 2)
+	assert.Equal(t, 1, strings.Count(doc, "/Subtype /Image"), "images that cannot be loaded are left out")
+}
@@ -0,0 +1,566 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go-notes/backend/internal/db"
+)
+
+// indexFormatVersion is bumped whenever the persisted layout changes; an index
+// with a different version is discarded and rebuilt from the database
+const indexFormatVersion = 1
+
+// flushInterval is how often pending index changes are written to disk
+const flushInterval = 2 * time.Second
+
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldTags
+	fieldContent
+	numFields
+)
+
+// fieldBoost weights a match in each field relative to note content
+var fieldBoost = [numFields]float64{3.0, 2.0, 1.0}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// document is the indexed form of a note, persisted as-is
+type document struct {
+	NoteID      int
+	WorkspaceID int
+	FolderID    *int
+	CreatedBy   *int
+	Author      string
+	Color       string
+	Title       string
+	Tags        []string
+	Content     string
+	IsTrashed   bool
+	UpdatedAt   time.Time
+	Lengths     [numFields]int
+}
+
+// termFreq counts occurrences of a term in each field of one document
+type termFreq [numFields]int
+
+// snapshot is the on-disk representation; postings are rebuilt on load
+type snapshot struct {
+	Version int
+	Docs    []*document
+}
+
+// Embedded is an on-disk inverted index in the spirit of Bleve: each note is
+// analysed into per-field term frequencies and hits are ranked with BM25.
+// It is kept up to date incrementally by the handlers of every replica (see
+// Follow) and can be rebuilt from the database at any time.
+type Embedded struct {
+	store *db.Store
+	path  string
+
+	mu       sync.RWMutex
+	docs     map[int]*document
+	postings map[string]map[int]*termFreq
+	totalLen [numFields]int
+	dirty    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewEmbedded opens (or builds) the index stored in dir
+func NewEmbedded(database *sql.DB, dir string) (*Embedded, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create search index dir: %w", err)
+	}
+	e := &Embedded{
+		store: db.NewStore(database),
+		path:  filepath.Join(dir, "index.gob"),
+		done:  make(chan struct{}),
+	}
+	e.reset()
+
+	loaded, err := e.load()
+	if err != nil {
+		log.Printf("[WARN] Search index at %s unreadable, rebuilding: %v", e.path, err)
+	}
+	if !loaded {
+		count, err := e.Reindex(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("build search index: %w", err)
+		}
+		log.Printf("[INFO] Built search index with %d notes", count)
+	}
+
+	e.wg.Add(1)
+	go e.flushLoop()
+	if loaded {
+		// The file lacks what other replicas wrote while this one was not
+		// running; it serves searches until a rebuild has caught up
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			if _, err := e.Reindex(context.Background()); err != nil {
+				log.Printf("[WARN] Search index catch-up failed: %v", err)
+			}
+		}()
+	}
+	return e, nil
+}
+
+func (e *Embedded) Name() string { return "embedded" }
+
+func (e *Embedded) reset() {
+	e.docs = make(map[int]*document)
+	e.postings = make(map[string]map[int]*termFreq)
+	e.totalLen = [numFields]int{}
+}
+
+// --- Analysis ---
+
+// analyze lowercases text and splits it into letter/digit runs
+func analyze(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func newDocument(n db.IndexableNote) *document {
+	d := &document{
+		NoteID:      n.ID,
+		WorkspaceID: n.WorkspaceID,
+		FolderID:    n.FolderID,
+		CreatedBy:   n.CreatedBy,
+		Author:      n.Author,
+		Color:       n.Color,
+		Title:       n.Title,
+		Content:     n.ContentText,
+		IsTrashed:   n.IsTrashed,
+		UpdatedAt:   n.UpdatedAtRaw,
+	}
+	for _, t := range n.Tags {
+		d.Tags = append(d.Tags, t.Name)
+	}
+	return d
+}
+
+func (d *document) fieldText(f field) string {
+	switch f {
+	case fieldTitle:
+		return d.Title
+	case fieldTags:
+		return strings.Join(d.Tags, " ")
+	default:
+		return d.Content
+	}
+}
+
+// --- Index maintenance (callers hold e.mu) ---
+
+func (e *Embedded) put(d *document) {
+	e.remove(d.NoteID)
+	for f := field(0); f < numFields; f++ {
+		tokens := analyze(d.fieldText(f))
+		d.Lengths[f] = len(tokens)
+		e.totalLen[f] += len(tokens)
+		for _, tok := range tokens {
+			pl := e.postings[tok]
+			if pl == nil {
+				pl = make(map[int]*termFreq)
+				e.postings[tok] = pl
+			}
+			tf := pl[d.NoteID]
+			if tf == nil {
+				tf = &termFreq{}
+				pl[d.NoteID] = tf
+			}
+			tf[f]++
+		}
+	}
+	e.docs[d.NoteID] = d
+	e.dirty = true
+}
+
+func (e *Embedded) remove(noteID int) {
+	old, ok := e.docs[noteID]
+	if !ok {
+		return
+	}
+	for f := field(0); f < numFields; f++ {
+		e.totalLen[f] -= old.Lengths[f]
+		for _, tok := range analyze(old.fieldText(f)) {
+			if pl := e.postings[tok]; pl != nil {
+				delete(pl, noteID)
+				if len(pl) == 0 {
+					delete(e.postings, tok)
+				}
+			}
+		}
+	}
+	delete(e.docs, noteID)
+	e.dirty = true
+}
+
+func (e *Embedded) IndexNote(ctx context.Context, noteID int) error {
+	notes, err := e.store.ListIndexableNotes(ctx, []int{noteID})
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(notes) == 0 {
+		e.remove(noteID)
+		return nil
+	}
+	e.put(newDocument(notes[0]))
+	return nil
+}
+
+func (e *Embedded) RemoveNote(ctx context.Context, noteID int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.remove(noteID)
+	return nil
+}
+
+func (e *Embedded) ReindexWorkspace(ctx context.Context, workspaceID int) error {
+	notes, err := e.store.ListWorkspaceIndexableNotes(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	current := make(map[int]bool, len(notes))
+	for _, n := range notes {
+		current[n.ID] = true
+		e.put(newDocument(n))
+	}
+	for id, d := range e.docs {
+		if d.WorkspaceID == workspaceID && !current[id] {
+			e.remove(id)
+		}
+	}
+	return nil
+}
+
+func (e *Embedded) Prune(ctx context.Context) error {
+	ids, err := e.store.ListNoteIDs(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		existing[id] = true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id := range e.docs {
+		if !existing[id] {
+			e.remove(id)
+		}
+	}
+	return nil
+}
+
+func (e *Embedded) Reindex(ctx context.Context) (int, error) {
+	notes, err := e.store.ListIndexableNotes(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	e.reset()
+	for _, n := range notes {
+		e.put(newDocument(n))
+	}
+	e.dirty = true
+	e.mu.Unlock()
+	return len(notes), e.flush()
+}
+
+// --- Query ---
+
+func (e *Embedded) Search(ctx context.Context, req Request) (*Response, error) {
+	resp := &Response{Notes: []db.Note{}, Facets: Facets{Tags: []FacetCount{}, Workspaces: []FacetCount{}, Authors: []FacetCount{}}}
+
+	q := db.ParseSearchQuery(req.Query)
+	if q.IsEmpty() {
+		return resp, nil
+	}
+	workspaceIDs, err := e.store.MemberWorkspaceIDs(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	allowed := idSet(workspaceIDs)
+
+	fields := []field{fieldTitle, fieldTags}
+	if req.Mode == "full" {
+		fields = append(fields, fieldContent)
+	}
+
+	e.mu.RLock()
+	scores := e.score(analyze(q.Text), fields)
+
+	type hit struct {
+		id    int
+		score float64
+	}
+	hits := make([]hit, 0, len(scores))
+	tags, workspaces, authors := newFacetBuilder(), newFacetBuilder(), newFacetBuilder()
+	for id, score := range scores {
+		d := e.docs[id]
+		if d == nil || d.IsTrashed || !allowed[d.WorkspaceID] || !matchesFilters(d, q) {
+			continue
+		}
+		hits = append(hits, hit{id, score})
+		for _, t := range d.Tags {
+			tags.add(strings.ToLower(t), 0, t)
+		}
+		workspaces.add(strconv.Itoa(d.WorkspaceID), d.WorkspaceID, "")
+		if d.CreatedBy != nil {
+			authors.add(strconv.Itoa(*d.CreatedBy), *d.CreatedBy, d.Author)
+		}
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].id > hits[j].id
+	})
+	resp.Total = len(hits)
+	if req.Limit > 0 && len(hits) > req.Limit {
+		hits = hits[:req.Limit]
+	}
+
+	ids := make([]int, len(hits))
+	for i, h := range hits {
+		ids[i] = h.id
+	}
+	notes, err := e.store.GetVisibleNotes(ctx, ids, workspaceIDs)
+	if err != nil {
+		return nil, err
+	}
+	resp.Notes = notes
+	resp.Facets = Facets{Tags: tags.result(), Workspaces: workspaces.result(), Authors: authors.result()}
+	labelWorkspaces(ctx, e.store, resp.Facets.Workspaces)
+	return resp, nil
+}
+
+// score ranks documents containing every term (the last term also matches as
+// a prefix, for search-as-you-type). With no terms every document scores 0
+// and filters alone decide. Caller holds e.mu for reading.
+func (e *Embedded) score(terms []string, fields []field) map[int]float64 {
+	if len(terms) == 0 {
+		all := make(map[int]float64, len(e.docs))
+		for id := range e.docs {
+			all[id] = 0
+		}
+		return all
+	}
+
+	n := float64(len(e.docs))
+	var avgLen [numFields]float64
+	for f := field(0); f < numFields; f++ {
+		if n > 0 {
+			avgLen[f] = float64(e.totalLen[f]) / n
+		}
+	}
+
+	var scores map[int]float64
+	for i, term := range terms {
+		expansions := []string{term}
+		if i == len(terms)-1 {
+			expansions = e.prefixTerms(term)
+		}
+
+		termScores := make(map[int]float64)
+		for _, t := range expansions {
+			pl := e.postings[t]
+			df := float64(len(pl))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			for id, tf := range pl {
+				d := e.docs[id]
+				var s float64
+				for _, f := range fields {
+					if tf[f] == 0 || avgLen[f] == 0 {
+						continue
+					}
+					freq := float64(tf[f])
+					norm := 1 - bm25B + bm25B*float64(d.Lengths[f])/avgLen[f]
+					s += fieldBoost[f] * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+				}
+				if s > 0 {
+					termScores[id] += idf * s
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if ts, ok := termScores[id]; ok {
+				scores[id] += ts
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	return scores
+}
+
+// prefixTerms returns indexed terms starting with prefix (including prefix itself)
+func (e *Embedded) prefixTerms(prefix string) []string {
+	terms := []string{}
+	for t := range e.postings {
+		if strings.HasPrefix(t, prefix) {
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+// matchesFilters applies the field filters of a parsed query to a document
+func matchesFilters(d *document, q db.SearchQuery) bool {
+	for _, want := range q.Tags {
+		found := false
+		for _, t := range d.Tags {
+			if strings.EqualFold(t, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.WorkspaceID != nil && d.WorkspaceID != *q.WorkspaceID {
+		return false
+	}
+	if q.FolderID != nil && (d.FolderID == nil || *d.FolderID != *q.FolderID) {
+		return false
+	}
+	if q.Author != "" && !strings.EqualFold(d.Author, q.Author) {
+		return false
+	}
+	if q.Color != "" && !strings.EqualFold(d.Color, q.Color) {
+		return false
+	}
+	if q.UpdatedAfter != nil && d.UpdatedAt.Before(*q.UpdatedAfter) {
+		return false
+	}
+	if q.UpdatedBefore != nil && !d.UpdatedAt.Before(*q.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// --- Persistence ---
+
+func (e *Embedded) load() (bool, error) {
+	f, err := os.Open(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return false, err
+	}
+	if snap.Version != indexFormatVersion {
+		return false, fmt.Errorf("index format version %d, want %d", snap.Version, indexFormatVersion)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reset()
+	for _, d := range snap.Docs {
+		e.put(d)
+	}
+	e.dirty = false
+	return true, nil
+}
+
+// flush writes the index to a temp file and renames it into place
+func (e *Embedded) flush() error {
+	e.mu.Lock()
+	if !e.dirty {
+		e.mu.Unlock()
+		return nil
+	}
+	snap := snapshot{Version: indexFormatVersion, Docs: make([]*document, 0, len(e.docs))}
+	for _, d := range e.docs {
+		snap.Docs = append(snap.Docs, d)
+	}
+	e.dirty = false
+	e.mu.Unlock()
+
+	tmp := e.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(&snap)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, e.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		// Try again on the next tick
+		e.mu.Lock()
+		e.dirty = true
+		e.mu.Unlock()
+	}
+	return err
+}
+
+func (e *Embedded) flushLoop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.flush(); err != nil {
+				log.Printf("[WARN] Search index flush failed: %v", err)
+			}
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *Embedded) Close() error {
+	close(e.done)
+	e.wg.Wait()
+	return e.flush()
+}
@@ -0,0 +1,75 @@
+package search
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+)
+
+func newTestIndex(t *testing.T) *Embedded {
+	e := &Embedded{path: filepath.Join(t.TempDir(), "index.gob"), done: make(chan struct{})}
+	e.reset()
+	e.put(&document{NoteID: 1, WorkspaceID: 1, Title: "Weekly meeting", Content: "agenda for the team", Tags: []string{"work"}})
+	e.put(&document{NoteID: 2, WorkspaceID: 1, Title: "Groceries", Content: "milk eggs and a meeting reminder"})
+	e.put(&document{NoteID: 3, WorkspaceID: 2, Title: "Recipes", Content: "pasta", Tags: []string{"meetings"}})
+	return e
+}
+
+func TestEmbeddedScoreRanksTitleAboveContent(t *testing.T) {
+	e := newTestIndex(t)
+
+	metadata := e.score(analyze("meeting"), []field{fieldTitle, fieldTags})
+	assert.Contains(t, metadata, 1)
+	assert.Contains(t, metadata, 3, "last term matches tags by prefix")
+	assert.NotContains(t, metadata, 2, "content is not searched in metadata mode")
+
+	full := e.score(analyze("meeting"), []field{fieldTitle, fieldTags, fieldContent})
+	assert.Greater(t, full[1], full[2])
+}
+
+func TestEmbeddedScoreRequiresEveryTerm(t *testing.T) {
+	e := newTestIndex(t)
+
+	scores := e.score(analyze("weekly agenda"), []field{fieldTitle, fieldTags, fieldContent})
+	assert.Len(t, scores, 1)
+	assert.Contains(t, scores, 1)
+}
+
+func TestEmbeddedRemoveNote(t *testing.T) {
+	e := newTestIndex(t)
+	require.NoError(t, e.RemoveNote(context.Background(), 1))
+
+	scores := e.score(analyze("weekly"), []field{fieldTitle})
+	assert.Empty(t, scores)
+	_, ok := e.postings["weekly"]
+	assert.False(t, ok)
+}
+
+func TestEmbeddedMatchesFilters(t *testing.T) {
+	d := &document{Tags: []string{"Work"}, WorkspaceID: 4, Author: "alice", UpdatedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+
+	assert.True(t, matchesFilters(d, db.ParseSearchQuery("tag:work author:Alice ws:4 after:2024-02-01")))
+	assert.False(t, matchesFilters(d, db.ParseSearchQuery("tag:home")))
+	assert.False(t, matchesFilters(d, db.ParseSearchQuery("before:2024-03-01")))
+}
+
+func TestEmbeddedPersistence(t *testing.T) {
+	e := newTestIndex(t)
+	require.NoError(t, e.flush())
+
+	loaded := &Embedded{path: e.path, done: make(chan struct{})}
+	loaded.reset()
+	ok, err := loaded.load()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	assert.Len(t, loaded.docs, 3)
+	assert.Equal(t, e.totalLen, loaded.totalLen)
+	assert.Contains(t, loaded.score(analyze("groceries"), []field{fieldTitle}), 2)
+}
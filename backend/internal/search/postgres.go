@@ -0,0 +1,57 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+
+	"go-notes/backend/internal/db"
+)
+
+// Postgres searches with the database's own trigram/tsvector indexes, which
+// PostgreSQL maintains itself, so the index maintenance methods are no-ops
+type Postgres struct {
+	store *db.Store
+}
+
+func NewPostgres(database *sql.DB) *Postgres {
+	return &Postgres{store: db.NewStore(database)}
+}
+
+func (p *Postgres) Name() string { return "postgres" }
+
+func (p *Postgres) Search(ctx context.Context, req Request) (*Response, error) {
+	notes, err := p.store.SearchNotes(ctx, req.UserID, req.Query, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if notes == nil {
+		notes = []db.Note{}
+	}
+	if err := p.store.AttachTags(ctx, notes); err != nil {
+		return nil, err
+	}
+
+	resp := &Response{Total: len(notes), Facets: noteFacets(ctx, p.store, notes)}
+	if req.Limit > 0 && len(notes) > req.Limit {
+		notes = notes[:req.Limit]
+	}
+	resp.Notes = notes
+	return resp, nil
+}
+
+func (p *Postgres) IndexNote(ctx context.Context, noteID int) error             { return nil }
+func (p *Postgres) RemoveNote(ctx context.Context, noteID int) error            { return nil }
+func (p *Postgres) ReindexWorkspace(ctx context.Context, workspaceID int) error { return nil }
+func (p *Postgres) Prune(ctx context.Context) error                             { return nil }
+func (p *Postgres) Close() error                                                { return nil }
+
+// Reindex rebuilds the full-text and trigram indexes in place
+func (p *Postgres) Reindex(ctx context.Context) (int, error) {
+	database := p.store.DB()
+	if _, err := database.ExecContext(ctx, "REINDEX TABLE notes"); err != nil {
+		return 0, err
+	}
+	var count int
+	err := database.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes").Scan(&count)
+	return count, err
+}
@@ -0,0 +1,210 @@
+// Package search provides pluggable full-text search backends for notes.
+//
+// The default backend delegates to PostgreSQL (Store.SearchNotes). The embedded
+// backend keeps its own inverted index on disk, which allows relevance tuning
+// and indexing text that does not live in the notes table. The SQLite backend
+// queries the FTS5 index kept by the SQLite schema.
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+)
+
+// Request describes a search on behalf of a user
+type Request struct {
+	UserID int
+	Query  string
+	Mode   string // "metadata" (title+tags) or "full" (title+tags+content)
+	Limit  int
+}
+
+// FacetCount is one bucket of a facet, e.g. a tag and how many hits carry it
+type FacetCount struct {
+	ID    int    `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Facets summarise all hits (not just the returned page) by tag, workspace and author
+type Facets struct {
+	Tags       []FacetCount `json:"tags"`
+	Workspaces []FacetCount `json:"workspaces"`
+	Authors    []FacetCount `json:"authors"`
+}
+
+// Response is a page of hydrated notes plus facet counts
+type Response struct {
+	Notes  []db.Note `json:"notes"`
+	Total  int       `json:"total"`
+	Facets Facets    `json:"facets"`
+}
+
+// Backend is a full-text search implementation. Index maintenance methods are
+// called after the corresponding database change has been committed.
+type Backend interface {
+	// Name identifies the backend, e.g. "postgres" or "embedded"
+	Name() string
+	// Search runs a query within the user's workspaces
+	Search(ctx context.Context, req Request) (*Response, error)
+	// IndexNote (re)indexes a created, edited, trashed or restored note
+	IndexNote(ctx context.Context, noteID int) error
+	// RemoveNote drops a permanently deleted note
+	RemoveNote(ctx context.Context, noteID int) error
+	// ReindexWorkspace refreshes every note in a workspace after bulk changes
+	ReindexWorkspace(ctx context.Context, workspaceID int) error
+	// Prune drops index entries for notes that no longer exist
+	Prune(ctx context.Context) error
+	// Reindex rebuilds the whole index and returns the number of notes indexed
+	Reindex(ctx context.Context) (int, error)
+	// Close flushes pending writes
+	Close() error
+}
+
+// Index is the maintenance side of an index, shared by Backend and Semantic
+type Index interface {
+	IndexNote(ctx context.Context, noteID int) error
+	RemoveNote(ctx context.Context, noteID int) error
+	ReindexWorkspace(ctx context.Context, workspaceID int) error
+	Reindex(ctx context.Context) (int, error)
+}
+
+// Apply makes an index change in each index. Failures are logged: they only
+// leave search results stale until the next change or reindex.
+func Apply(ctx context.Context, c events.IndexChange, indexes ...Index) {
+	for _, index := range indexes {
+		var err error
+		switch c.Kind {
+		case events.IndexNote:
+			err = index.IndexNote(ctx, c.NoteID)
+		case events.IndexRemove:
+			err = index.RemoveNote(ctx, c.NoteID)
+		case events.IndexWorkspace:
+			err = index.ReindexWorkspace(ctx, c.WorkspaceID)
+		case events.IndexAll:
+			_, err = index.Reindex(ctx)
+		}
+		if err != nil {
+			log.Printf("[WARN] Index update (%s note=%d workspace=%d) failed: %v", c.Kind, c.NoteID, c.WorkspaceID, err)
+		}
+	}
+}
+
+// Follow applies the index changes other replicas publish through the broker
+// to indexes this process keeps itself, the embedded backend and Semantic,
+// so they see every write and not only those made through this replica.
+// Indexes inside the database must not follow, or each replica would
+// rebuild them.
+func Follow(b *events.Broker, indexes ...Index) {
+	if len(indexes) == 0 {
+		return
+	}
+	b.WatchIndex(func(c events.IndexChange) {
+		Apply(context.Background(), c, indexes...)
+	})
+}
+
+// New returns the backend selected by SEARCH_BACKEND ("postgres" by default,
+// or "embedded" with its index stored under SEARCH_INDEX_DIR). With
+// DB_DRIVER=sqlite the FTS5 backend is the only choice.
+func New(database *sql.DB) (Backend, error) {
+	kind := os.Getenv("SEARCH_BACKEND")
+	if db.Driver() == db.DriverSQLite {
+		if kind != "" && kind != "sqlite" {
+			return nil, fmt.Errorf("SEARCH_BACKEND %q is not supported with DB_DRIVER=sqlite", kind)
+		}
+		return NewSQLite(database), nil
+	}
+	switch kind {
+	case "", "postgres":
+		return NewPostgres(database), nil
+	case "embedded":
+		dir := os.Getenv("SEARCH_INDEX_DIR")
+		if dir == "" {
+			dir = "./data/search-index"
+		}
+		return NewEmbedded(database, dir)
+	default:
+		return nil, fmt.Errorf("unknown SEARCH_BACKEND %q", kind)
+	}
+}
+
+// facetBuilder accumulates facet counts keyed by ID or name
+type facetBuilder struct {
+	counts map[string]*FacetCount
+}
+
+func newFacetBuilder() *facetBuilder {
+	return &facetBuilder{counts: make(map[string]*FacetCount)}
+}
+
+func (f *facetBuilder) add(key string, id int, name string) {
+	if c, ok := f.counts[key]; ok {
+		c.Count++
+		return
+	}
+	f.counts[key] = &FacetCount{ID: id, Name: name, Count: 1}
+}
+
+// result returns buckets ordered by count, then name
+func (f *facetBuilder) result() []FacetCount {
+	out := make([]FacetCount, 0, len(f.counts))
+	for _, c := range f.counts {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// facetStore looks up the names shown in facet buckets
+type facetStore interface {
+	GetUserByID(ctx context.Context, id int) (*db.User, error)
+	GetWorkspace(ctx context.Context, id int) (*db.Workspace, error)
+}
+
+// noteFacets counts hydrated notes by tag, workspace and author
+func noteFacets(ctx context.Context, store facetStore, notes []db.Note) Facets {
+	tags, workspaces, authors := newFacetBuilder(), newFacetBuilder(), newFacetBuilder()
+	usernames := make(map[int]string)
+	for _, n := range notes {
+		for _, t := range n.Tags {
+			tags.add(t.Name, t.ID, t.Name)
+		}
+		workspaces.add(strconv.Itoa(n.WorkspaceID), n.WorkspaceID, "")
+		if n.CreatedBy != nil {
+			name, ok := usernames[*n.CreatedBy]
+			if !ok {
+				if u, err := store.GetUserByID(ctx, *n.CreatedBy); err == nil {
+					name = u.Username
+				}
+				usernames[*n.CreatedBy] = name
+			}
+			authors.add(strconv.Itoa(*n.CreatedBy), *n.CreatedBy, name)
+		}
+	}
+	facets := Facets{Tags: tags.result(), Workspaces: workspaces.result(), Authors: authors.result()}
+	labelWorkspaces(ctx, store, facets.Workspaces)
+	return facets
+}
+
+// labelWorkspaces fills in workspace names for workspace facet buckets
+func labelWorkspaces(ctx context.Context, store facetStore, facets []FacetCount) {
+	for i := range facets {
+		if ws, err := store.GetWorkspace(ctx, facets[i].ID); err == nil {
+			facets[i].Name = ws.Name
+		}
+	}
+}
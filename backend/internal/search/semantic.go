@@ -0,0 +1,307 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"sync"
+
+	"go-notes/backend/internal/db"
+)
+
+// minSimilarity drops hits whose cosine similarity is mostly noise
+const minSimilarity = 0.05
+
+// Title and tag terms say more about what a note is about than body text
+const (
+	titleTermWeight = 2.0
+	tagTermWeight   = 2.0
+)
+
+// stopWords are skipped when building vectors; IDF alone under-weights them
+// poorly in small workspaces
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "for": true, "from": true, "has": true, "have": true, "i": true, "in": true, "is": true,
+	"it": true, "its": true, "of": true, "on": true, "or": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "we": true, "were": true, "will": true, "with": true, "you": true,
+}
+
+// semanticEntry is a note's raw term weights; TF-IDF is applied at query time
+// so vectors never go stale as document frequencies change
+type semanticEntry struct {
+	doc   *document
+	terms map[string]float64
+}
+
+// Semantic is an in-process TF-IDF vector index used to find notes similar
+// to a note or to a free-text query, without any external model or API.
+// Vectors are built from title, tags and content_text and recomputed
+// whenever those change, through any replica (see Follow).
+type Semantic struct {
+	store *db.Store
+
+	mu      sync.RWMutex
+	entries map[int]*semanticEntry
+	df      map[string]int
+}
+
+// NewSemantic builds the vector index from every note in the database
+func NewSemantic(database *sql.DB) (*Semantic, error) {
+	s := &Semantic{store: db.NewStore(database)}
+	if _, err := s.Reindex(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// termWeights turns a note into raw term weights (title and tags boosted)
+func termWeights(d *document) map[string]float64 {
+	terms := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, tok := range analyze(text) {
+			if len(tok) > 1 && !stopWords[tok] {
+				terms[tok] += weight
+			}
+		}
+	}
+	add(d.Title, titleTermWeight)
+	for _, t := range d.Tags {
+		add(t, tagTermWeight)
+	}
+	add(d.Content, 1)
+	return terms
+}
+
+// Callers hold s.mu for writing
+func (s *Semantic) put(d *document) {
+	s.remove(d.NoteID)
+	e := &semanticEntry{doc: d, terms: termWeights(d)}
+	for t := range e.terms {
+		s.df[t]++
+	}
+	s.entries[d.NoteID] = e
+}
+
+func (s *Semantic) remove(noteID int) {
+	old, ok := s.entries[noteID]
+	if !ok {
+		return
+	}
+	for t := range old.terms {
+		if s.df[t]--; s.df[t] <= 0 {
+			delete(s.df, t)
+		}
+	}
+	delete(s.entries, noteID)
+}
+
+// IndexNote recomputes the vector of a created or edited note
+func (s *Semantic) IndexNote(ctx context.Context, noteID int) error {
+	notes, err := s.store.ListIndexableNotes(ctx, []int{noteID})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(notes) == 0 {
+		s.remove(noteID)
+		return nil
+	}
+	s.put(newDocument(notes[0]))
+	return nil
+}
+
+func (s *Semantic) RemoveNote(ctx context.Context, noteID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(noteID)
+	return nil
+}
+
+// ReindexWorkspace recomputes every vector in a workspace after bulk changes
+func (s *Semantic) ReindexWorkspace(ctx context.Context, workspaceID int) error {
+	notes, err := s.store.ListWorkspaceIndexableNotes(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := make(map[int]bool, len(notes))
+	for _, n := range notes {
+		current[n.ID] = true
+		s.put(newDocument(n))
+	}
+	for id, e := range s.entries {
+		if e.doc.WorkspaceID == workspaceID && !current[id] {
+			s.remove(id)
+		}
+	}
+	return nil
+}
+
+// Prune drops vectors of notes that no longer exist
+func (s *Semantic) Prune(ctx context.Context) error {
+	ids, err := s.store.ListNoteIDs(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		existing[id] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.entries {
+		if !existing[id] {
+			s.remove(id)
+		}
+	}
+	return nil
+}
+
+// Reindex rebuilds every vector and returns the number of notes indexed
+func (s *Semantic) Reindex(ctx context.Context) (int, error) {
+	notes, err := s.store.ListIndexableNotes(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[int]*semanticEntry, len(notes))
+	s.df = make(map[string]int)
+	for _, n := range notes {
+		s.put(newDocument(n))
+	}
+	return len(notes), nil
+}
+
+// --- Similarity ---
+
+func (s *Semantic) idf(term string) float64 {
+	return math.Log(float64(len(s.entries)+1)/float64(s.df[term]+1)) + 1
+}
+
+// vector applies sublinear TF and IDF to raw term weights and L2-normalises
+func (s *Semantic) vector(terms map[string]float64) map[string]float64 {
+	v := make(map[string]float64, len(terms))
+	var norm float64
+	for t, w := range terms {
+		x := (1 + math.Log(w)) * s.idf(t)
+		v[t] = x
+		norm += x * x
+	}
+	if norm == 0 {
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for t := range v {
+		v[t] /= norm
+	}
+	return v
+}
+
+// rank scores every visible note against a query vector by cosine similarity.
+// Caller holds s.mu for reading.
+func (s *Semantic) rank(query map[string]float64, exclude int, allowed map[int]bool, filter func(*document) bool) []db.ScoredNote {
+	hits := []db.ScoredNote{}
+	if len(query) == 0 {
+		return hits
+	}
+	for id, e := range s.entries {
+		d := e.doc
+		if id == exclude || d.IsTrashed || !allowed[d.WorkspaceID] || (filter != nil && !filter(d)) {
+			continue
+		}
+		shared := false
+		for t := range query {
+			if _, ok := e.terms[t]; ok {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			continue
+		}
+		v := s.vector(e.terms)
+		var dot float64
+		for t, w := range query {
+			dot += w * v[t]
+		}
+		if dot >= minSimilarity {
+			hits = append(hits, db.ScoredNote{Note: db.Note{ID: id}, Score: dot})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID > hits[j].ID
+	})
+	return hits
+}
+
+// Related returns the notes most similar to noteID within the user's workspaces
+func (s *Semantic) Related(ctx context.Context, userID, noteID, limit int) ([]db.ScoredNote, error) {
+	workspaceIDs, err := s.store.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var hits []db.ScoredNote
+	if e, ok := s.entries[noteID]; ok {
+		hits = s.rank(s.vector(e.terms), noteID, idSet(workspaceIDs), nil)
+	}
+	s.mu.RUnlock()
+
+	return s.hydrate(ctx, hits, workspaceIDs, limit)
+}
+
+// Search ranks notes by similarity to the free text of a query; field
+// filters (tag:, folder:, ...) restrict the candidates as in other modes
+func (s *Semantic) Search(ctx context.Context, req Request) ([]db.ScoredNote, error) {
+	q := db.ParseSearchQuery(req.Query)
+	workspaceIDs, err := s.store.MemberWorkspaceIDs(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	query := s.vector(termWeights(&document{Content: q.Text}))
+	hits := s.rank(query, 0, idSet(workspaceIDs), func(d *document) bool { return matchesFilters(d, q) })
+	s.mu.RUnlock()
+
+	return s.hydrate(ctx, hits, workspaceIDs, req.Limit)
+}
+
+// hydrate loads the top hits from the database, keeping their scores
+func (s *Semantic) hydrate(ctx context.Context, hits []db.ScoredNote, workspaceIDs []int, limit int) ([]db.ScoredNote, error) {
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	ids := make([]int, len(hits))
+	scores := make(map[int]float64, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+		scores[h.ID] = h.Score
+	}
+	notes, err := s.store.GetVisibleNotes(ctx, ids, workspaceIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]db.ScoredNote, len(notes))
+	for i, n := range notes {
+		result[i] = db.ScoredNote{Note: n, Score: scores[n.ID]}
+	}
+	return result, nil
+}
+
+func idSet(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go-notes/backend/internal/events"
+)
+
+func newTestSemantic() *Semantic {
+	s := &Semantic{entries: make(map[int]*semanticEntry), df: make(map[string]int)}
+	s.put(&document{NoteID: 1, WorkspaceID: 1, Title: "Sourdough bread", Content: "starter flour water salt, long proof overnight"})
+	s.put(&document{NoteID: 2, WorkspaceID: 1, Title: "Pizza dough", Content: "flour water salt yeast, proof for two hours"})
+	s.put(&document{NoteID: 3, WorkspaceID: 1, Title: "Quarterly planning", Content: "roadmap, hiring and budget for the team"})
+	s.put(&document{NoteID: 4, WorkspaceID: 2, Title: "Bread notes", Content: "flour water salt starter"})
+	s.put(&document{NoteID: 5, WorkspaceID: 1, Title: "Old bread", Content: "flour water salt starter", IsTrashed: true})
+	return s
+}
+
+func TestSemanticRankFindsSimilarNotes(t *testing.T) {
+	s := newTestSemantic()
+
+	hits := s.rank(s.vector(s.entries[1].terms), 1, map[int]bool{1: true}, nil)
+	if assert.NotEmpty(t, hits) {
+		assert.Equal(t, 2, hits[0].ID)
+	}
+	for _, h := range hits {
+		assert.NotEqual(t, 3, h.ID, "unrelated note")
+		assert.NotEqual(t, 4, h.ID, "other workspace")
+		assert.NotEqual(t, 5, h.ID, "trashed note")
+	}
+}
+
+func TestSemanticVectorsFollowEdits(t *testing.T) {
+	s := newTestSemantic()
+	s.put(&document{NoteID: 3, WorkspaceID: 1, Title: "Rye bread", Content: "starter flour water salt"})
+
+	hits := s.rank(s.vector(s.entries[1].terms), 1, map[int]bool{1: true}, nil)
+	ids := []int{}
+	for _, h := range hits {
+		ids = append(ids, h.ID)
+	}
+	assert.Contains(t, ids, 3)
+
+	s.remove(3)
+	assert.NotContains(t, s.df, "rye")
+}
+
+func TestApplyRemovesDeletedNotes(t *testing.T) {
+	s := newTestSemantic()
+	Apply(context.Background(), events.IndexChange{Kind: events.IndexRemove, NoteID: 4}, s)
+	assert.NotContains(t, s.entries, 4)
+	assert.Contains(t, s.entries, 1)
+}
+
+func TestTermWeightsSkipStopWords(t *testing.T) {
+	terms := termWeights(&document{Title: "The plan", Content: "the plan is a plan"})
+	assert.NotContains(t, terms, "the")
+	assert.NotContains(t, terms, "a")
+	assert.Equal(t, titleTermWeight+2, terms["plan"])
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+
+	"go-notes/backend/internal/sqlitestore"
+)
+
+// SQLite searches with the FTS5 notes_fts table, which triggers keep in step
+// with notes.content_text, so the index maintenance methods are no-ops
+type SQLite struct {
+	store *sqlitestore.Store
+}
+
+func NewSQLite(database *sql.DB) *SQLite {
+	return &SQLite{store: sqlitestore.New(database)}
+}
+
+func (s *SQLite) Name() string { return "sqlite" }
+
+func (s *SQLite) Search(ctx context.Context, req Request) (*Response, error) {
+	notes, err := s.store.SearchNotes(ctx, req.UserID, req.Query, req.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{Total: len(notes), Facets: noteFacets(ctx, s.store, notes)}
+	if req.Limit > 0 && len(notes) > req.Limit {
+		notes = notes[:req.Limit]
+	}
+	resp.Notes = notes
+	return resp, nil
+}
+
+func (s *SQLite) IndexNote(ctx context.Context, noteID int) error             { return nil }
+func (s *SQLite) RemoveNote(ctx context.Context, noteID int) error            { return nil }
+func (s *SQLite) ReindexWorkspace(ctx context.Context, workspaceID int) error { return nil }
+func (s *SQLite) Prune(ctx context.Context) error                             { return nil }
+func (s *SQLite) Close() error                                                { return nil }
+
+// Reindex rebuilds the FTS5 index from the notes table
+func (s *SQLite) Reindex(ctx context.Context) (int, error) {
+	database := s.store.DB()
+	if _, err := database.ExecContext(ctx, "INSERT INTO notes_fts (notes_fts) VALUES ('rebuild')"); err != nil {
+		return 0, err
+	}
+	var count int
+	err := database.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes").Scan(&count)
+	return count, err
+}
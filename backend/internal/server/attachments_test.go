@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/blob"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/quill"
+)
+
+// countingBlobs counts the blobs written
+type countingBlobs struct {
+	blob.Store
+	puts int
+}
+
+func (b *countingBlobs) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	b.puts++
+	return b.Store.Put(ctx, key, r, size)
+}
+
+// attach uploads a file as the file field of a multipart form
+func (ts *testServer) attach(path, token, filename string, data []byte) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	require.NoError(ts.t, err)
+	part.Write(data)
+	require.NoError(ts.t, mw.Close())
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAttachments(t *testing.T) {
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	blobs := &countingBlobs{Store: disk}
+	ts := newTestServer(t, Deps{Blobs: blobs})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Trip"}, http.StatusCreated, &note)
+	base := fmt.Sprintf("/workspaces/%d/notes/%d/attachments", wsID, note.ID)
+
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4))))
+	w := ts.attach(base, alice, `C:\Users\alice\photo.png`, img.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var photo attachmentJSON
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &photo))
+	sum := sha256.Sum256(img.Bytes())
+	assert.Equal(t, hex.EncodeToString(sum[:]), photo.Hash)
+	assert.Equal(t, "photo.png", photo.Filename)
+	assert.Equal(t, "image/png", photo.MimeType)
+	assert.Equal(t, int64(img.Len()), photo.Size)
+	assert.Equal(t, aliceID, *photo.CreatedBy)
+	assert.Regexp(t, fmt.Sprintf(`^%s/%d\?key=[0-9a-f]{32}$`, base, photo.ID), photo.URL)
+	assert.NotContains(t, w.Body.String(), `"Key"`)
+
+	// The same content under another name shares the blob
+	w = ts.attach(base, alice, "copy.txt", img.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code)
+	var dup attachmentJSON
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dup))
+	assert.Equal(t, photo.Hash, dup.Hash)
+	assert.Equal(t, "image/png", dup.MimeType, "the type comes from the content")
+	assert.Equal(t, 1, blobs.puts)
+
+	var list []attachmentJSON
+	ts.call("GET", base, alice, nil, http.StatusOK, &list)
+	require.Len(t, list, 2)
+	assert.Equal(t, photo.URL, list[0].URL)
+	ts.call("GET", base, bob, nil, http.StatusForbidden, nil)
+
+	// Members download with their login, anyone with the URL's key
+	w = ts.do("GET", fmt.Sprintf("%s/%d", base, photo.ID), alice, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, img.Bytes(), w.Body.Bytes())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename=photo.png`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	w = ts.do("GET", photo.URL, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, img.Bytes(), w.Body.Bytes())
+	ts.call("GET", fmt.Sprintf("%s/%d?key=%s", base, photo.ID, strings.Repeat("0", 32)), "", nil, http.StatusNotFound, nil)
+	ts.call("GET", fmt.Sprintf("%s/%d?key=%s", base, dup.ID, strings.TrimPrefix(photo.URL, fmt.Sprintf("%s/%d?key=", base, photo.ID))), "", nil, http.StatusNotFound, nil)
+	ts.call("GET", fmt.Sprintf("%s/%d", base, photo.ID), "", nil, http.StatusUnauthorized, nil)
+	ts.call("GET", fmt.Sprintf("%s/%d", base, photo.ID), bob, nil, http.StatusForbidden, nil)
+
+	// Content that could run script is downloaded rather than shown
+	for name, data := range map[string][]byte{
+		"page.html": []byte("<html><script>alert(1)</script></html>"),
+		"logo.svg":  {0, 1, 2, 3},
+	} {
+		w = ts.attach(base, alice, name, data)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var a attachmentJSON
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &a))
+		w = ts.do("GET", a.URL, "", nil)
+		assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;"), name)
+	}
+
+	// Size limits
+	t.Setenv("ATTACHMENT_MAX_MB", "1")
+	ts.call("POST", base, alice, nil, http.StatusBadRequest, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, ts.attach(base, alice, "big.bin", make([]byte, 3<<19)).Code)
+	t.Setenv("ATTACHMENT_QUOTA_MB", "1")
+	require.Equal(t, http.StatusCreated, ts.attach(base, alice, "a.bin", bytes.Repeat([]byte{1}, 600<<10)).Code)
+	w = ts.attach(base, alice, "b.bin", bytes.Repeat([]byte{2}, 600<<10))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "1 MB quota")
+
+	ts.call("DELETE", fmt.Sprintf("%s/%d", base, photo.ID), bob, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", fmt.Sprintf("%s/%d", base, photo.ID), alice, nil, http.StatusOK, nil)
+	ts.call("GET", photo.URL, "", nil, http.StatusNotFound, nil)
+	ts.call("DELETE", fmt.Sprintf("%s/%d", base, photo.ID), alice, nil, http.StatusNotFound, nil)
+	ts.call("GET", dup.URL, "", nil, http.StatusOK, nil)
+
+	// Without blob storage the routes say so
+	ts = newTestServer(t, Deps{})
+	aliceID, alice = ts.user("alice", false)
+	wsID = ts.defaultWorkspace(aliceID)
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Trip"}, http.StatusCreated, &note)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d/attachments", wsID, note.ID), alice, nil, http.StatusServiceUnavailable, nil)
+}
+
+func TestAttachmentImages(t *testing.T) {
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Blobs: disk})
+	aliceID, alice := ts.user("alice", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Trip"}, http.StatusCreated, &note)
+	base := fmt.Sprintf("/workspaces/%d/notes/%d/attachments", wsID, note.ID)
+
+	// A photo taken with the phone turned, with its location in the EXIF
+	var plain bytes.Buffer
+	require.NoError(t, jpeg.Encode(&plain, image.NewGray(image.Rect(0, 0, 1000, 500)), nil))
+	var tiff bytes.Buffer
+	tiff.WriteString("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	binary.Write(&tiff, binary.BigEndian, []uint16{1, 0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, []uint32{1, 6 << 16, 0})
+	tiff.WriteString("GPS 51.5N 0.1W")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(tiff.Len()+2))...)
+	photo = append(append(photo, tiff.Bytes()...), plain.Bytes()[2:]...)
+
+	w := ts.attach(base, alice, "IMG_0001.jpg", photo)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var a attachmentJSON
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &a))
+	assert.Equal(t, 500, *a.Width, "turned upright")
+	assert.Equal(t, 1000, *a.Height)
+	assert.Equal(t, []int{320}, a.Widths)
+
+	w = ts.do("GET", a.URL, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "GPS")
+	sum := sha256.Sum256(w.Body.Bytes())
+	assert.Equal(t, hex.EncodeToString(sum[:]), a.Hash, "the stored image is what is hashed")
+	assert.Equal(t, a.Size, int64(w.Body.Len()))
+	assert.Equal(t, `"`+a.Hash+`"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "immutable")
+
+	w = ts.do("GET", a.URL+"&w=200", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	cfg, err := jpeg.DecodeConfig(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 320, cfg.Width)
+	assert.Equal(t, 640, cfg.Height)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"`+blob.VariantKey(a.Hash, 320)+`"`, etag)
+	w = ts.do("GET", a.URL+"&w=800", "", nil)
+	assert.Equal(t, `"`+a.Hash+`"`, w.Header().Get("ETag"), "no thumbnail is that wide")
+	ts.call("GET", a.URL+"&w=wide", "", nil, http.StatusBadRequest, nil)
+
+	req := httptest.NewRequest("GET", a.URL+"&w=200", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	w = httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+
+	// Without its thumbnail an image is served whole
+	require.NoError(t, disk.Delete(context.Background(), blob.VariantKey(a.Hash, 320)))
+	w = ts.do("GET", a.URL+"&w=200", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"`+a.Hash+`"`, w.Header().Get("ETag"))
+
+	// Other files are not processed
+	w = ts.attach(base, alice, "notes.txt", []byte("GPS 51.5N 0.1W"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &a))
+	assert.Nil(t, a.Width)
+	assert.Equal(t, []int{}, a.Widths)
+	assert.Equal(t, "GPS 51.5N 0.1W", ts.do("GET", a.URL+"&w=200", "", nil).Body.String())
+
+	w = ts.attach(base, alice, "broken.jpg", plain.Bytes()[:plain.Len()/2])
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "The image could not be read")
+}
+
+func TestAttachmentKeys(t *testing.T) {
+	docs, client := newFakeDocuments(t)
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Documents: client, Blobs: disk})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	var other struct{ ID int }
+	ts.call("POST", "/workspaces", alice, gin.H{"name": "Other"}, http.StatusCreated, &other)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Trip"}, http.StatusCreated, &note)
+	base := fmt.Sprintf("/workspaces/%d/notes/%d/attachments", wsID, note.ID)
+
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4))))
+	w := ts.attach(base, alice, "photo.png", img.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var photo attachmentJSON
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &photo))
+	docs.deltas[note.YjsRoomID] = quill.Delta{Ops: []quill.Op{{Insert: map[string]any{"image": photo.URL + "&w=1280"}}, {Insert: "\n"}}}
+	embedded := func() string {
+		return docs.deltas[note.YjsRoomID].Ops[0].Insert.(map[string]any)["image"].(string)
+	}
+
+	// The key only works under the note's workspace
+	ts.call("GET", strings.Replace(photo.URL, fmt.Sprintf("/workspaces/%d/", wsID), fmt.Sprintf("/workspaces/%d/", other.ID), 1), "", nil, http.StatusNotFound, nil)
+
+	// A new key retires the old URL and the note's content follows it
+	keyPath := fmt.Sprintf("%s/%d/key", base, photo.ID)
+	ts.call("POST", keyPath, bob, nil, http.StatusForbidden, nil)
+	var rotated attachmentJSON
+	ts.call("POST", keyPath, alice, nil, http.StatusOK, &rotated)
+	assert.NotEqual(t, photo.URL, rotated.URL)
+	ts.call("GET", photo.URL, "", nil, http.StatusNotFound, nil)
+	ts.call("GET", rotated.URL, "", nil, http.StatusOK, nil)
+	assert.Equal(t, rotated.URL+"&w=1280", embedded())
+
+	// So does a note moved to another workspace
+	ts.call("PUT", fmt.Sprintf("/workspaces/%d/notes/%d", wsID, note.ID), alice, gin.H{"workspace_id": other.ID}, http.StatusOK, nil)
+	ts.call("GET", rotated.URL, "", nil, http.StatusNotFound, nil)
+	moved := strings.Replace(rotated.URL, fmt.Sprintf("/workspaces/%d/", wsID), fmt.Sprintf("/workspaces/%d/", other.ID), 1)
+	assert.Equal(t, moved+"&w=1280", embedded())
+	ts.call("GET", moved, "", nil, http.StatusOK, nil)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-notes/backend/internal/auth"
+)
+
+// authRoutes registers first-run setup, login, token refresh and the
+// token check the document service makes for each connection
+func (s *server) authRoutes(api *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	var mu sync.Mutex
+	adminExists := false
+	userCount, err := s.Users.GetUserCount(context.Background())
+	if err == nil && userCount > 0 {
+		adminExists = true
+	}
+
+	// Check if setup is complete
+	api.GET("/setup", func(c *gin.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.JSON(http.StatusOK, gin.H{"completed": adminExists})
+	})
+
+	api.POST("/setup", authMiddleware, func(c *gin.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+		if adminExists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Setup endpoint disabled after admin creation"})
+			return
+		}
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if req.Username == "" || req.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password required"})
+			return
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+			return
+		}
+		if err := s.Users.CreateAdmin(c.Request.Context(), req.Username, string(passwordHash)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Admin creation failed"})
+			return
+		}
+		adminExists = true
+		c.JSON(http.StatusOK, gin.H{"message": "Admin user created"})
+	})
+
+	// --- Authentication/Login ---
+	api.POST("/login", authMiddleware, func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		user, err := s.Users.GetUserByUsername(c.Request.Context(), req.Username)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return
+		}
+		if user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+			return
+		}
+		token, err := auth.GenerateToken(user.ID, user.IsAdmin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token": token,
+			"user":  gin.H{"id": user.ID, "username": user.Username, "is_admin": user.IsAdmin},
+		})
+	})
+
+	// Reissue a token for the caller before the current one expires; the
+	// admin flag is re-read so promotions and demotions take effect
+	api.POST("/refresh", authMiddleware, auth.AuthRequired(s.Users), func(c *gin.Context) {
+		user, err := s.Users.GetUserByID(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+		token, err := auth.GenerateToken(user.ID, user.IsAdmin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token": token,
+			"user":  gin.H{"id": user.ID, "username": user.Username, "is_admin": user.IsAdmin},
+		})
+	})
+
+	// --- Yjs Token Validation Endpoint ---
+	api.POST("/validate-yjs-token", func(c *gin.Context) {
+		// Extract token from Authorization header
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			c.JSON(http.StatusUnauthorized, gin.H{"valid": false, "error": "Missing or invalid authorization header"})
+			return
+		}
+
+		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+
+		// Parse and validate JWT
+		claims, err := auth.ParseToken(tokenStr)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"valid": false, "error": "Invalid or expired token"})
+			return
+		}
+
+		// Verify user still exists in database and is not disabled
+		user, err := s.Users.GetUserByID(c.Request.Context(), claims.UserID)
+		if err != nil || user.Disabled {
+			c.JSON(http.StatusUnauthorized, gin.H{"valid": false, "error": "User not found"})
+			return
+		}
+
+		// Parse request body
+		var req struct {
+			RoomID      string `json:"room_id"`
+			WorkspaceID int    `json:"workspace_id"`
+			NoteID      int    `json:"note_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": "Invalid request body"})
+			return
+		}
+
+		// Verify workspace membership
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), req.WorkspaceID, claims.UserID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"valid": false, "error": "Not a workspace member"})
+			return
+		}
+
+		// Token is valid and user has access
+		c.JSON(http.StatusOK, gin.H{
+			"valid":        true,
+			"user_id":      claims.UserID,
+			"workspace_id": req.WorkspaceID,
+		})
+	})
+}
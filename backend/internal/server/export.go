@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/archive"
+	"go-notes/backend/internal/blob"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/render"
+)
+
+// exportStore gives an export the metadata it reads
+type exportStore struct {
+	UserStore
+	FolderStore
+	NoteStore
+}
+
+func (s *server) exportRoutes(workspaceGroup *gin.RouterGroup) {
+	// Streams the workspace archive. Workspaces with more notes than
+	// EXPORT_STREAM_MAX_NOTES, or any with ?async=true, are exported by a
+	// background job instead, answering 202 with the job to poll.
+	workspaceGroup.GET("/:id/export", func(c *gin.Context) {
+		ws, ok := s.exportWorkspace(c)
+		if !ok {
+			return
+		}
+
+		async := c.Query("async") == "true"
+		if !async && s.Exports != nil {
+			limit := getenvInt("EXPORT_STREAM_MAX_NOTES", 1000)
+			page, err := s.Notes.ListNotesPage(c.Request.Context(), ws.ID, db.NoteListOptions{Limit: limit + 1})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notes"})
+				return
+			}
+			async = len(page.Notes) > limit
+		}
+		if async {
+			s.startExportJob(c, ws)
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="workspace-%d.zip"`, ws.ID))
+		c.Status(http.StatusOK)
+		if err := s.writeExport(c.Request.Context(), c.Writer, ws); err != nil {
+			// The status has been sent; a truncated archive fails to open
+			log.Printf("[WARN] Export of workspace %d failed: %v", ws.ID, err)
+			c.Abort()
+		}
+	})
+
+	workspaceGroup.POST("/:id/export/jobs", func(c *gin.Context) {
+		ws, ok := s.exportWorkspace(c)
+		if !ok {
+			return
+		}
+		s.startExportJob(c, ws)
+	})
+
+	workspaceGroup.GET("/:id/export/jobs/:job_id", func(c *gin.Context) {
+		job, ok := s.exportJob(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	workspaceGroup.GET("/:id/export/jobs/:job_id/download", func(c *gin.Context) {
+		job, ok := s.exportJob(c)
+		if !ok {
+			return
+		}
+		f, err := s.Exports.Open(c.Request.Context(), job.ID)
+		if errors.Is(err, archive.ErrJobNotFinished) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "status": job.Status})
+			return
+		}
+		if errors.Is(err, archive.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("[WARN] Opening export %s failed: %v", job.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open export"})
+			return
+		}
+		defer f.Close()
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="workspace-%d.zip"`, job.WorkspaceID))
+		c.DataFromReader(http.StatusOK, job.Size, "application/zip", f, nil)
+	})
+
+	// A single note rendered for reading elsewhere (?format=md, html or txt)
+	workspaceGroup.GET("/:id/notes/:note_id/export", func(c *gin.Context) {
+		format, ok := exportFormat(c)
+		if !ok {
+			return
+		}
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		note.Tags, _ = s.Tags.ListTagsForNote(c.Request.Context(), noteID)
+
+		delta, err := s.Documents.Delta(c.Request.Context(), note.YjsRoomID)
+		if err != nil {
+			log.Printf("[WARN] Reading content of note %d failed: %v", noteID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Document service unavailable"})
+			return
+		}
+		doc := render.NewDoc(*note, delta)
+		doc.Images = s.attachmentImages(c.Request.Context())
+		var buf bytes.Buffer
+		if err := format.Write(&buf, doc); err != nil {
+			log.Printf("[WARN] Rendering note %d as %s failed: %v", noteID, format.Name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render note"})
+			return
+		}
+		c.Header("Content-Disposition", attachment(archive.SafeName(note.Title)+format.Ext))
+		c.Data(http.StatusOK, format.ContentType, buf.Bytes())
+	})
+
+	// A folder and its subfolders as a zip of rendered notes
+	workspaceGroup.GET("/:id/folders/:folder_id/export", func(c *gin.Context) {
+		format, ok := exportFormat(c)
+		if !ok {
+			return
+		}
+		folderID, _ := strconv.Atoi(c.Param("folder_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		folder, err := s.Folders.GetFolder(c.Request.Context(), folderID)
+		if err != nil || folder.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", attachment(archive.SafeName(folder.Name)+".zip"))
+		c.Status(http.StatusOK)
+		store := exportStore{s.Users, s.Folders, s.Notes}
+		if err := archive.WriteFolder(c.Request.Context(), c.Writer, *folder, store, s.Documents, format, s.attachmentImages(c.Request.Context())); err != nil {
+			// The status has been sent; a truncated archive fails to open
+			log.Printf("[WARN] Export of folder %d failed: %v", folderID, err)
+			c.Abort()
+		}
+	})
+}
+
+// exportFormat reads ?format=, Markdown by default
+func exportFormat(c *gin.Context) (render.Format, bool) {
+	format, ok := render.Lookup(c.DefaultQuery("format", "md"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of " + strings.Join(render.Names(), ", ")})
+	}
+	return format, ok
+}
+
+// attachment is a Content-Disposition for a download named after a title,
+// which may be any text
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// exportWorkspace checks membership and returns the workspace to export
+func (s *server) exportWorkspace(c *gin.Context) (db.Workspace, bool) {
+	workspaceID, _ := strconv.Atoi(c.Param("id"))
+	userID := c.GetInt("user_id")
+	isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+	if err != nil || !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+		return db.Workspace{}, false
+	}
+	workspaces, err := s.Workspaces.ListWorkspaces(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workspace"})
+		return db.Workspace{}, false
+	}
+	for _, ws := range workspaces {
+		if ws.ID == workspaceID {
+			return ws, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+	return db.Workspace{}, false
+}
+
+// attachmentFiles gives an export the attachments it copies
+type attachmentFiles struct {
+	AttachmentStore
+	blob.Store
+}
+
+func (s *server) writeExport(ctx context.Context, w io.Writer, ws db.Workspace) error {
+	var files archive.Files
+	if s.Attachments != nil && s.Blobs != nil {
+		files = attachmentFiles{s.Attachments, s.Blobs}
+	}
+	return archive.Write(ctx, w, ws, exportStore{s.Users, s.Folders, s.Notes}, s.Documents, files)
+}
+
+func (s *server) startExportJob(c *gin.Context, ws db.Workspace) {
+	if s.Exports == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Background exports are not configured"})
+		return
+	}
+	job, err := s.Exports.Start(c.Request.Context(), ws.ID, c.GetInt("user_id"), func(ctx context.Context, w io.Writer) error {
+		return s.writeExport(ctx, w, ws)
+	})
+	switch {
+	case errors.Is(err, archive.ErrTooManyJobs):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Wait for your running exports to finish"})
+		return
+	case errors.Is(err, archive.ErrBusy):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many exports are running, try again later"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+	c.Header("Location", fmt.Sprintf("%s/workspaces/%d/export/jobs/%s", strings.TrimSuffix(s.BasePath, "/"), ws.ID, job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+// exportJob returns a job started by the requesting user for the workspace
+// in the path
+func (s *server) exportJob(c *gin.Context) (archive.Job, bool) {
+	workspaceID, _ := strconv.Atoi(c.Param("id"))
+	if s.Exports == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return archive.Job{}, false
+	}
+	job, err := s.Exports.Get(c.Request.Context(), c.Param("job_id"))
+	if err != nil && !errors.Is(err, archive.ErrJobNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load export"})
+		return archive.Job{}, false
+	}
+	if err != nil || job.WorkspaceID != workspaceID || job.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return archive.Job{}, false
+	}
+	return job, true
+}
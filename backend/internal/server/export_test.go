@@ -0,0 +1,549 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/archive"
+	"go-notes/backend/internal/blob"
+	"go-notes/backend/internal/collab"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/importer"
+	"go-notes/backend/internal/memstore"
+	"go-notes/backend/internal/quill"
+)
+
+// fakeDocuments stands in for the document service, keeping each room's
+// Delta and raw state, and encoding a Delta as its JSON
+type fakeDocuments struct {
+	mu     sync.Mutex
+	deltas map[string]quill.Delta
+	states map[string][]byte
+}
+
+func newFakeDocuments(t *testing.T) (*fakeDocuments, *collab.Client) {
+	docs := &fakeDocuments{deltas: map[string]quill.Delta{}, states: map[string][]byte{}}
+	service := httptest.NewServer(docs)
+	t.Cleanup(service.Close)
+	return docs, collab.New(service.URL)
+}
+
+func (f *fakeDocuments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/documents/encode" || r.URL.Path == "/documents/decode" {
+		// The "state" is the Delta's JSON
+		io.Copy(w, r.Body)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/documents/"), "/")
+	room, resource := parts[0], parts[1]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case resource == "delta" && r.Method == http.MethodPut:
+		var d quill.Delta
+		json.NewDecoder(r.Body).Decode(&d)
+		f.deltas[room] = d
+		json.NewEncoder(w).Encode(gin.H{"success": true})
+	case resource == "delta":
+		json.NewEncoder(w).Encode(f.deltas[room])
+	default:
+		w.Write(f.states[room])
+	}
+}
+
+func TestWorkspaceExport(t *testing.T) {
+	docs, client := newFakeDocuments(t)
+	jobStore := memstore.New()
+	jobs, err := archive.NewJobs(t.TempDir(), jobStore, time.Hour, 0, 2)
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Documents: client, Exports: jobs})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Doc", "tags": []string{"go"}}, http.StatusCreated, &note)
+	docs.deltas[note.YjsRoomID] = quill.FromMarkdown("# Hi\n")
+	docs.states[note.YjsRoomID] = []byte{1, 2, 3}
+
+	exportPath := fmt.Sprintf("/workspaces/%d/export", wsID)
+	ts.call("GET", exportPath, bob, nil, http.StatusForbidden, nil)
+
+	w := ts.do("GET", exportPath, alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	files := unzip(t, w.Body.Bytes())
+	var m archive.Manifest
+	require.NoError(t, json.Unmarshal(files[archive.ManifestName], &m))
+	assert.Equal(t, wsID, m.Workspace.ID)
+	assert.Equal(t, []string{"go"}, m.Tags)
+	var exported archive.Note
+	for _, n := range m.Notes {
+		if n.ID == note.ID {
+			exported = n
+		}
+	}
+	assert.Equal(t, []byte{1, 2, 3}, files[exported.State])
+	assert.Equal(t, "# Hi\n", string(files[exported.Markdown]))
+
+	// Large workspaces are handed to a background job
+	t.Setenv("EXPORT_STREAM_MAX_NOTES", "1")
+	var job archive.Job
+	w = ts.do("GET", exportPath, alice, nil)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	jobPath := fmt.Sprintf("/workspaces/%d/export/jobs/%s", wsID, job.ID)
+	assert.Equal(t, jobPath, w.Header().Get("Location"))
+
+	ts.call("GET", jobPath, bob, nil, http.StatusNotFound, nil)
+	require.Eventually(t, func() bool {
+		ts.call("GET", jobPath, alice, nil, http.StatusOK, &job)
+		return job.Status != archive.JobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, archive.JobDone, job.Status, job.Error)
+
+	w = ts.do("GET", jobPath+"/download", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, unzip(t, w.Body.Bytes()), archive.ManifestName)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/export/jobs/missing/download", wsID), alice, nil, http.StatusNotFound, nil)
+
+	// Jobs running for the user on any replica count against their limit
+	for _, id := range []string{"elsewhere1", "elsewhere2"} {
+		_, err := jobStore.CreateExportJob(context.Background(), id, wsID, aliceID)
+		require.NoError(t, err)
+	}
+	ts.call("POST", exportPath+"/jobs", alice, nil, http.StatusTooManyRequests, nil)
+}
+
+func TestNoteExport(t *testing.T) {
+	docs, client := newFakeDocuments(t)
+	ts := newTestServer(t, Deps{Documents: client})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var folder db.Folder
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/folders", wsID), alice, gin.H{"name": "Meetings"}, http.StatusCreated, &folder)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Standup: Monday", "folder_id": folder.ID}, http.StatusCreated, &note)
+	docs.deltas[note.YjsRoomID] = quill.FromMarkdown("# Agenda\n- **ship**\n```\nmake\n```\n")
+
+	notePath := fmt.Sprintf("/workspaces/%d/notes/%d/export", wsID, note.ID)
+	ts.call("GET", notePath, bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", notePath+"?format=doc", alice, nil, http.StatusBadRequest, nil)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d/export", wsID+1, note.ID), alice, nil, http.StatusNotFound, nil)
+
+	w := ts.do("GET", notePath, alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="Standup_ Monday.md"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "# Agenda\n- **ship**\n```\nmake\n```\n", w.Body.String())
+
+	w = ts.do("GET", notePath+"?format=html", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "<title>Standup: Monday</title>")
+	assert.Contains(t, w.Body.String(), "<h1>Agenda</h1>\n<ul>\n<li><strong>ship</strong></li>\n</ul>\n<pre><code>make</code></pre>")
+
+	w = ts.do("GET", notePath+"?format=txt", alice, nil)
+	assert.Equal(t, "Agenda\n- ship\nmake\n", w.Body.String())
+
+	w = ts.do("GET", notePath+"?format=pdf", alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+
+	folderPath := fmt.Sprintf("/workspaces/%d/folders/%d/export?format=txt", wsID, folder.ID)
+	ts.call("GET", folderPath, bob, nil, http.StatusForbidden, nil)
+	w = ts.do("GET", folderPath, alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `attachment; filename=Meetings.zip`, w.Header().Get("Content-Disposition"))
+	files := unzip(t, w.Body.Bytes())
+	assert.Equal(t, "Agenda\n- ship\nmake\n", string(files["Meetings/Standup_ Monday.txt"]))
+
+	w = ts.do("GET", fmt.Sprintf("/workspaces/%d/folders/%d/export?format=pdf", wsID, folder.ID), alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	files = unzip(t, w.Body.Bytes())
+	assert.True(t, bytes.HasPrefix(files["Meetings/Standup_ Monday.pdf"], []byte("%PDF-")))
+}
+
+func unzip(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+	}
+	return files
+}
+
+// upload posts an archive as the file field of a multipart form
+func (ts *testServer) upload(path, token string, archiveBytes []byte, fields map[string]string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "workspace.zip")
+	require.NoError(ts.t, err)
+	part.Write(archiveBytes)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	require.NoError(ts.t, mw.Close())
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestWorkspaceImport(t *testing.T) {
+	docs, client := newFakeDocuments(t)
+	ts := newTestServer(t, Deps{Documents: client})
+	aliceID, alice := ts.user("alice", false)
+	bobID, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var folder, sub db.Folder
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/folders", wsID), alice, gin.H{"name": "Projects"}, http.StatusCreated, &folder)
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/folders", wsID), alice, gin.H{"name": "2025", "parent_id": folder.ID}, http.StatusCreated, &sub)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Plan", "folder_id": sub.ID, "color": "#FFEB3B", "tags": []string{"work"}}, http.StatusCreated, &note)
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes/%d/trash", wsID, note.ID), alice, nil, http.StatusOK, nil)
+	page, err := ts.store.ListNotesPage(context.Background(), wsID, db.NoteListOptions{})
+	require.NoError(t, err)
+	for _, n := range page.Notes {
+		docs.deltas[n.YjsRoomID] = quill.FromMarkdown("Ship it\n")
+		docs.states[n.YjsRoomID] = []byte("state of " + n.Title)
+	}
+
+	w := ts.do("GET", fmt.Sprintf("/workspaces/%d/export", wsID), alice, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	exported := w.Body.Bytes()
+
+	w = ts.upload("/workspaces/import", bob, []byte("not a zip"), nil)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	ts.call("POST", "/workspaces/import", bob, gin.H{}, http.StatusBadRequest, nil)
+
+	var dryRun struct {
+		DryRun bool           `json:"dry_run"`
+		Report archive.Report `json:"report"`
+	}
+	w = ts.upload("/workspaces/import?dry_run=true", bob, exported, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dryRun))
+	assert.True(t, dryRun.DryRun)
+	assert.Equal(t, 2, dryRun.Report.Folders)
+	assert.Equal(t, 2, dryRun.Report.Notes)
+	assert.Equal(t, 1, dryRun.Report.Trashed)
+	assert.Empty(t, dryRun.Report.Warnings)
+	workspaces, err := ts.store.ListWorkspaces(context.Background(), bobID)
+	require.NoError(t, err)
+	assert.Len(t, workspaces, 1, "a dry run creates nothing")
+
+	var imported struct {
+		WorkspaceID int               `json:"workspace_id"`
+		Name        string            `json:"name"`
+		Folders     map[string]int    `json:"folders"`
+		Notes       []db.ImportedNote `json:"notes"`
+	}
+	w = ts.upload("/workspaces/import", bob, exported, map[string]string{"name": "Alice's copy"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+	assert.Equal(t, "Alice's copy", imported.Name)
+
+	owner, err := ts.store.IsWorkspaceOwner(context.Background(), imported.WorkspaceID, bobID)
+	require.NoError(t, err)
+	assert.True(t, owner)
+	newSub, err := ts.store.GetFolder(context.Background(), imported.Folders[fmt.Sprint(sub.ID)])
+	require.NoError(t, err)
+	assert.Equal(t, imported.Folders[fmt.Sprint(folder.ID)], *newSub.ParentID)
+
+	var plan db.ImportedNote
+	for _, n := range imported.Notes {
+		if n.Key == note.ID {
+			plan = n
+		}
+	}
+	copied, err := ts.store.GetNote(context.Background(), plan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("w%d_n%d", imported.WorkspaceID, plan.ID), copied.YjsRoomID)
+	assert.Equal(t, "Plan", copied.Title)
+	assert.Equal(t, "#FFEB3B", copied.Color)
+	assert.Equal(t, newSub.ID, *copied.FolderID)
+	assert.True(t, copied.IsTrashed)
+	tags, err := ts.store.ListTagsForNote(context.Background(), plan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "work", tags[0].Name)
+	assert.Equal(t, []byte("state of Plan"), ts.store.Content(plan.ID))
+	assert.Equal(t, "Ship it", ts.store.SearchText(plan.ID))
+}
+
+func TestAttachmentsExportAndImport(t *testing.T) {
+	docs, client := newFakeDocuments(t)
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Documents: client, Blobs: disk})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Trip"}, http.StatusCreated, &note)
+	base := fmt.Sprintf("/workspaces/%d/notes/%d/attachments", wsID, note.ID)
+	var photo bytes.Buffer
+	require.NoError(t, png.Encode(&photo, image.NewGray(image.Rect(0, 0, 40, 20))))
+	var img, pdf attachmentJSON
+	w := ts.attach(base, alice, "map.png", photo.Bytes())
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &img))
+	w = ts.attach(base, alice, "tickets.pdf", []byte("%PDF-1.4 tickets"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pdf))
+
+	content := quill.Delta{Ops: []quill.Op{
+		{Insert: map[string]any{"image": img.URL}},
+		{Insert: "Tickets", Attributes: map[string]any{"link": pdf.URL}},
+		{Insert: "\n"},
+	}}
+	state, err := json.Marshal(content)
+	require.NoError(t, err)
+	docs.deltas[note.YjsRoomID] = content
+	docs.states[note.YjsRoomID] = state
+
+	// PDFs draw the images attached to the note
+	w = ts.do("GET", fmt.Sprintf("/workspaces/%d/notes/%d/export?format=pdf", wsID, note.ID), alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "/Subtype /Image"))
+
+	w = ts.do("GET", fmt.Sprintf("/workspaces/%d/export", wsID), alice, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	exported := w.Body.Bytes()
+	files := unzip(t, exported)
+	var m archive.Manifest
+	require.NoError(t, json.Unmarshal(files[archive.ManifestName], &m))
+	var entry archive.Note
+	for _, n := range m.Notes {
+		if n.ID == note.ID {
+			entry = n
+		}
+	}
+	require.Len(t, entry.Attachments, 2)
+	assert.Equal(t, "tickets.pdf", entry.Attachments[1].Filename)
+	assert.Equal(t, "%PDF-1.4 tickets", string(files[entry.Attachments[1].File]))
+
+	var imported struct {
+		WorkspaceID int               `json:"workspace_id"`
+		Notes       []db.ImportedNote `json:"notes"`
+		Report      archive.Report    `json:"report"`
+	}
+	w = ts.upload("/workspaces/import", bob, exported, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+	assert.Equal(t, 2, imported.Report.Attachments)
+	var copyID int
+	for _, n := range imported.Notes {
+		if n.Key == note.ID {
+			copyID = n.ID
+		}
+	}
+	var copies []attachmentJSON
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d/attachments", imported.WorkspaceID, copyID), bob, nil, http.StatusOK, &copies)
+	require.Len(t, copies, 2)
+	assert.Equal(t, img.Hash, copies[0].Hash)
+	assert.Equal(t, []int{}, copies[0].Widths)
+	assert.Equal(t, "%PDF-1.4 tickets", ts.do("GET", copies[1].URL, "", nil).Body.String())
+
+	var rewritten quill.Delta
+	require.NoError(t, json.Unmarshal(ts.store.Content(copyID), &rewritten))
+	assert.Equal(t, copies[0].URL, rewritten.Ops[0].Insert.(map[string]any)["image"])
+	assert.Equal(t, copies[1].URL, rewritten.Ops[1].Attributes["link"])
+}
+
+func TestMarkdownImport(t *testing.T) {
+	_, client := newFakeDocuments(t)
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Documents: client, Blobs: disk})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	var folder db.Folder
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/folders", wsID), alice, gin.H{"name": "Obsidian"}, http.StatusCreated, &folder)
+
+	var photo bytes.Buffer
+	require.NoError(t, png.Encode(&photo, image.NewGray(image.Rect(0, 0, 40, 20))))
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"Daily/2025-01-02.md":   "---\ntags: [journal]\nupdated: 2025-01-03T08:00:00Z\n---\nSee [[Index]]\n",
+		"Index.md":              "Start [here](Daily/2025-01-02.md)\n![[photo.png]]\n",
+		"Attachments/photo.png": photo.String(),
+	} {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(body))
+	}
+	require.NoError(t, zw.Close())
+
+	path := fmt.Sprintf("/workspaces/%d/import/markdown", wsID)
+	w := ts.upload(path, bob, buf.Bytes(), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = ts.upload(path, alice, []byte("not a zip"), nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = ts.upload(path, alice, buf.Bytes(), map[string]string{"folder_id": "999"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var result struct {
+		Folders int `json:"folders"`
+		Notes   []struct {
+			ID     int    `json:"id"`
+			Title  string `json:"title"`
+			Source string `json:"source"`
+		} `json:"notes"`
+		Warnings []string `json:"warnings"`
+	}
+	w = ts.upload(path, alice, buf.Bytes(), map[string]string{"folder_id": fmt.Sprint(folder.ID)})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Folders)
+	assert.Empty(t, result.Warnings)
+	require.Len(t, result.Notes, 2)
+	daily, index := result.Notes[0], result.Notes[1]
+	assert.Equal(t, "Daily/2025-01-02.md", daily.Source)
+
+	note, err := ts.store.GetNote(context.Background(), daily.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01-02", note.Title)
+	assert.Equal(t, "2025-01-03T08:00:00Z", note.UpdatedAt)
+	sub, err := ts.store.GetFolder(context.Background(), *note.FolderID)
+	require.NoError(t, err)
+	assert.Equal(t, "Daily", sub.Name)
+	assert.Equal(t, folder.ID, *sub.ParentID)
+	tags, err := ts.store.ListTagsForNote(context.Background(), daily.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "journal", tags[0].Name)
+
+	var content quill.Delta
+	require.NoError(t, json.Unmarshal(ts.store.Content(daily.ID), &content))
+	assert.Equal(t, quill.NoteLink(index.ID), content.Ops[1].Attributes["link"])
+	require.NoError(t, json.Unmarshal(ts.store.Content(index.ID), &content))
+	assert.Equal(t, quill.NoteLink(daily.ID), content.Ops[1].Attributes["link"])
+	assert.Equal(t, "Start here", ts.store.SearchText(index.ID))
+
+	// The embedded image is attached to the note that shows it
+	attachments, err := ts.store.ListAttachments(context.Background(), index.ID)
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	a := attachments[0]
+	assert.Equal(t, "photo.png", a.Filename)
+	assert.Contains(t, content.Ops, quill.Op{Insert: map[string]any{"image": fmt.Sprintf("/workspaces/%d/notes/%d/attachments/%d?key=%s", wsID, index.ID, a.ID, a.Key)}})
+}
+
+func TestENEXImport(t *testing.T) {
+	_, client := newFakeDocuments(t)
+	disk, err := blob.NewDisk(t.TempDir())
+	require.NoError(t, err)
+	ts := newTestServer(t, Deps{Documents: client, Blobs: disk})
+	aliceID, alice := ts.user("alice", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var photo bytes.Buffer
+	require.NoError(t, png.Encode(&photo, image.NewGray(image.Rect(0, 0, 40, 20))))
+	pdf := []byte("%PDF-1.4 recipe card")
+	md5Hex := func(b []byte) string {
+		sum := md5.Sum(b)
+		return hex.EncodeToString(sum[:])
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range map[string]string{
+		"Recipes.enex": `<?xml version="1.0" encoding="UTF-8"?>
+<en-export><note><title>Pancakes</title>
+<content><![CDATA[<en-note><div><b>Flour</b>, eggs</div><en-media type="image/png" hash="` + md5Hex(photo.Bytes()) + `"/><en-media type="application/pdf" hash="` + md5Hex(pdf) + `"/></en-note>]]></content>
+<created>20180101T090000Z</created><updated>20190101T090000Z</updated><tag>food</tag>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(photo.Bytes()) + `</data><mime>image/png</mime></resource>
+<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(pdf) + `</data><mime>application/pdf</mime><resource-attributes><file-name>card.pdf</file-name></resource-attributes></resource>
+</note></en-export>`,
+		"broken.enex": "<html/>",
+	} {
+		part, err := mw.CreateFormFile("file", name)
+		require.NoError(t, err)
+		part.Write([]byte(content))
+	}
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest("POST", fmt.Sprintf("/workspaces/%d/import/enex", wsID), &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+alice)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var result struct {
+		Folders  int                 `json:"folders"`
+		Notes    []importer.Imported `json:"notes"`
+		Warnings []string            `json:"warnings"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Folders)
+	assert.Equal(t, []string{"broken.enex: not an Evernote export"}, result.Warnings)
+	require.Len(t, result.Notes, 1)
+	assert.Empty(t, result.Notes[0].Warnings)
+
+	note, err := ts.store.GetNote(context.Background(), result.Notes[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pancakes", note.Title)
+	assert.Equal(t, "2018-01-01T09:00:00Z", note.CreatedAt)
+	assert.Equal(t, "2019-01-01T09:00:00Z", note.UpdatedAt)
+	folder, err := ts.store.GetFolder(context.Background(), *note.FolderID)
+	require.NoError(t, err)
+	assert.Equal(t, "Recipes", folder.Name)
+	tags, err := ts.store.ListTagsForNote(context.Background(), note.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "food", tags[0].Name)
+	assert.Equal(t, "Flour, eggs\ncard.pdf", ts.store.SearchText(note.ID))
+
+	// Resources become attachments the content shows and links to
+	attachments, err := ts.store.ListAttachments(context.Background(), note.ID)
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+	var content quill.Delta
+	require.NoError(t, json.Unmarshal(ts.store.Content(note.ID), &content))
+	urls := map[string]string{}
+	for _, a := range attachments {
+		urls[a.MimeType] = fmt.Sprintf("/workspaces/%d/notes/%d/attachments/%d?key=%s", wsID, note.ID, a.ID, a.Key)
+	}
+	assert.Contains(t, content.Ops, quill.Op{Insert: map[string]any{"image": urls["image/png"]}})
+	assert.Contains(t, content.Ops, quill.Op{Insert: "card.pdf", Attributes: map[string]any{"link": urls["application/pdf"]}})
+	w = ts.do("GET", urls["application/pdf"], "", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, pdf, w.Body.Bytes())
+
+	w = ts.upload(fmt.Sprintf("/workspaces/%d/import/enex", wsID), alice, []byte("<html/>"), nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+)
+
+func (s *server) folderRoutes(workspaceGroup *gin.RouterGroup) {
+	// --- Folder CRUD Endpoints ---
+	folderGroup := workspaceGroup.Group("/:id/folders")
+	folderGroup.POST("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		var req struct {
+			Name     string `json:"name"`
+			ParentID *int   `json:"parent_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		var folder *db.Folder
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			folderID, err := tx.CreateFolder(ctx, workspaceID, req.Name, req.ParentID)
+			if err != nil {
+				return nil, err
+			}
+			// Return the complete folder object
+			if folder, err = tx.GetFolder(ctx, folderID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.FolderCreated, WorkspaceID: workspaceID, Data: folder}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create folder"})
+			return
+		}
+		c.JSON(http.StatusCreated, folder)
+	})
+	folderGroup.GET("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		folders, err := s.Folders.ListFolders(c.Request.Context(), workspaceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list folders"})
+			return
+		}
+		c.JSON(http.StatusOK, folders)
+	})
+
+	folderGroup.PUT("/:folder_id", func(c *gin.Context) {
+		folderID, _ := strconv.Atoi(c.Param("folder_id"))
+		sourceWorkspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		// Verify user is member of source workspace
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), sourceWorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of source workspace"})
+			return
+		}
+
+		var req struct {
+			Name        string `json:"name"`
+			ParentID    *int   `json:"parent_id"`
+			WorkspaceID *int   `json:"workspace_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// If moving to a different workspace, verify user is member there too
+		if req.WorkspaceID != nil && *req.WorkspaceID != sourceWorkspaceID {
+			isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), *req.WorkspaceID, userID)
+			if err != nil || !isMember {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of target workspace"})
+				return
+			}
+		}
+
+		// Notes in the folder subtree follow it to the target workspace
+		moved := req.WorkspaceID != nil && *req.WorkspaceID != sourceWorkspaceID
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.UpdateFolderWithCascade(c.Request.Context(), folderID, req.Name, req.ParentID, req.WorkspaceID); err != nil {
+				return nil, err
+			}
+			if moved {
+				data := gin.H{"folder_id": folderID, "from_workspace_id": sourceWorkspaceID, "to_workspace_id": *req.WorkspaceID}
+				return []events.Event{
+					{Type: events.FolderMoved, WorkspaceID: sourceWorkspaceID, Data: data},
+					{Type: events.FolderMoved, WorkspaceID: *req.WorkspaceID, Data: data},
+				}, nil
+			}
+			return []events.Event{{Type: events.FolderUpdated, WorkspaceID: sourceWorkspaceID, Data: gin.H{"folder_id": folderID, "name": req.Name, "parent_id": req.ParentID}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update folder: %v", err)})
+			return
+		}
+		if moved {
+			s.reindexWorkspace(c.Request.Context(), sourceWorkspaceID)
+			s.reindexWorkspace(c.Request.Context(), *req.WorkspaceID)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Folder updated"})
+	})
+
+	folderGroup.DELETE("/:folder_id", func(c *gin.Context) {
+		folderID, _ := strconv.Atoi(c.Param("folder_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.DeleteFolder(c.Request.Context(), folderID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.FolderDeleted, WorkspaceID: workspaceID, Data: gin.H{"folder_id": folderID}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+			return
+		}
+		s.reindexWorkspace(c.Request.Context(), workspaceID)
+		c.JSON(http.StatusOK, gin.H{"message": "Folder deleted"})
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// frontendRoutes registers the Hocuspocus WebSocket proxy and the React app
+func (s *server) frontendRoutes(r *gin.Engine, api *gin.RouterGroup) {
+	// Handle /yjs without trailing slash (for Hocuspocus root connection)
+	api.Any("/yjs", func(c *gin.Context) {
+		yjsPort := os.Getenv("YJS_WS_PORT")
+		if yjsPort == "" {
+			yjsPort = "1234"
+		}
+
+		targetURL, err := url.Parse(fmt.Sprintf("http://yjs:%s", yjsPort))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Proxy configuration error"})
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+		originalDirector := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			originalDirector(req)
+			req.Host = targetURL.Host
+			req.URL.Path = "/"
+			req.URL.RawQuery = c.Request.URL.RawQuery
+
+			log.Printf("[PROXY] Forwarding %s %s to yjs service root: %s", req.Method, c.Request.URL.Path, req.URL.String())
+		}
+
+		proxy.ServeHTTP(c.Writer, c.Request)
+	})
+
+	// --- Yjs WebSocket Proxy ---
+	api.Any("/yjs/*proxyPath", func(c *gin.Context) {
+		yjsPort := os.Getenv("YJS_WS_PORT")
+		if yjsPort == "" {
+			yjsPort = "1234"
+		}
+
+		// Create target URL for yjs service
+		targetURL, err := url.Parse(fmt.Sprintf("http://yjs:%s", yjsPort))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Proxy configuration error"})
+			return
+		}
+
+		// Create reverse proxy
+		proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+		// Modify the request to strip the base path and /yjs prefix
+		originalDirector := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			originalDirector(req)
+			req.Host = targetURL.Host
+			// Strip API_BASE_PATH and /yjs from the path
+			// Example: /test/yjs/socket -> /socket
+			req.URL.Path = strings.TrimPrefix(c.Request.URL.Path, s.BasePath+"/yjs")
+			if req.URL.Path == "" {
+				req.URL.Path = "/"
+			}
+			req.URL.RawQuery = c.Request.URL.RawQuery
+
+			log.Printf("[PROXY] Forwarding %s %s to yjs service: %s", req.Method, c.Request.URL.Path, req.URL.String())
+		}
+
+		// Handle WebSocket upgrade and proxy
+		proxy.ServeHTTP(c.Writer, c.Request)
+	})
+
+	// Serve static frontend files
+	api.Static("/assets", "./static/assets")
+	api.StaticFile("/vite.svg", "./static/vite.svg")
+
+	// Root route serves index.html
+	api.GET("/", func(c *gin.Context) {
+		c.Header("Content-Type", "text/html")
+		content, err := os.ReadFile("./static/index.html")
+		if err != nil {
+			c.String(500, "Error loading page")
+			return
+		}
+		// Inject base tag
+		html := string(content)
+		baseTag := fmt.Sprintf(`<base href="%s/">`, s.BasePath)
+		html = strings.Replace(html, "<head>", "<head>"+baseTag, 1)
+		c.String(200, html)
+	})
+
+	// Catch-all for React Router - must be last
+	r.NoRoute(func(c *gin.Context) {
+		// Only serve index.html for routes under the base path
+		if !strings.HasPrefix(c.Request.URL.Path, s.BasePath) {
+			c.String(404, "Not found")
+			return
+		}
+
+		c.Header("Content-Type", "text/html")
+		content, err := os.ReadFile("./static/index.html")
+		if err != nil {
+			c.String(500, "Error loading page")
+			return
+		}
+		// Inject base tag
+		html := string(content)
+		baseTag := fmt.Sprintf(`<base href="%s/">`, s.BasePath)
+		html = strings.Replace(html, "<head>", "<head>"+baseTag, 1)
+		c.String(200, html)
+	})
+}
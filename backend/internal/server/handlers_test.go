@@ -0,0 +1,835 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-notes/backend/internal/auth"
+	"go-notes/backend/internal/collab"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/memstore"
+	"go-notes/backend/internal/quill"
+)
+
+var (
+	_ UserStore           = (*memstore.Store)(nil)
+	_ WorkspaceStore      = (*memstore.Store)(nil)
+	_ FolderStore         = (*memstore.Store)(nil)
+	_ NoteStore           = (*memstore.Store)(nil)
+	_ TagStore            = (*memstore.Store)(nil)
+	_ AttachmentStore     = (*memstore.Store)(nil)
+	_ SavedSearchStore    = (*memstore.Store)(nil)
+	_ SyncStore           = (*memstore.Store)(nil)
+	_ WebhookStore        = (*memstore.Store)(nil)
+	_ SearchLanguageStore = (*memstore.Store)(nil)
+	_ FuzzySearcher       = (*memstore.Store)(nil)
+	_ TxStores            = (*memstore.Store)(nil)
+)
+
+// testServer is the router over an in-memory store
+type testServer struct {
+	t      *testing.T
+	store  *memstore.Store
+	router *gin.Engine
+}
+
+func newTestServer(t *testing.T, deps Deps) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := memstore.New()
+	deps.Users, deps.Workspaces, deps.Folders, deps.Notes, deps.Tags = store, store, store, store, store
+	deps.Transactions = Transactions(store.WithTx)
+	deps.Attachments = store
+	deps.SavedSearches, deps.Sync, deps.Webhooks, deps.Languages, deps.Fuzzy = store, store, store, store, store
+	deps.BasePath = "/"
+	return &testServer{t: t, store: store, router: NewRouter(deps)}
+}
+
+// user creates an account and returns its ID and a token for it
+func (ts *testServer) user(name string, isAdmin bool) (int, string) {
+	ts.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(name+"-pass"), bcrypt.MinCost)
+	require.NoError(ts.t, err)
+	ctx := context.Background()
+	require.NoError(ts.t, ts.store.CreateUser(ctx, name, string(hash), isAdmin))
+	u, err := ts.store.GetUserByUsername(ctx, name)
+	require.NoError(ts.t, err)
+	token, err := auth.GenerateToken(u.ID, isAdmin)
+	require.NoError(ts.t, err)
+	return u.ID, token
+}
+
+// defaultWorkspace returns the ID of the workspace created with a user
+func (ts *testServer) defaultWorkspace(userID int) int {
+	ts.t.Helper()
+	workspaces, err := ts.store.ListWorkspaces(context.Background(), userID)
+	require.NoError(ts.t, err)
+	require.NotEmpty(ts.t, workspaces)
+	return workspaces[0].ID
+}
+
+// do sends a request, JSON-encoding body unless it is nil
+func (ts *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(ts.t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+// call is do that also checks the status and decodes the response into out
+func (ts *testServer) call(method, path, token string, body interface{}, status int, out interface{}) {
+	ts.t.Helper()
+	w := ts.do(method, path, token, body)
+	require.Equal(ts.t, status, w.Code, "%s %s: %s", method, path, w.Body.String())
+	if out != nil {
+		require.NoError(ts.t, json.Unmarshal(w.Body.Bytes(), out))
+	}
+}
+
+func TestSetupAndLogin(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+
+	var setup struct{ Completed bool }
+	ts.call("GET", "/setup", "", nil, http.StatusOK, &setup)
+	assert.False(t, setup.Completed)
+
+	ts.call("POST", "/setup", "", gin.H{"username": "root"}, http.StatusBadRequest, nil)
+	ts.call("POST", "/setup", "", gin.H{"username": "root", "password": "secret"}, http.StatusOK, nil)
+	ts.call("POST", "/setup", "", gin.H{"username": "again", "password": "secret"}, http.StatusForbidden, nil)
+	ts.call("GET", "/setup", "", nil, http.StatusOK, &setup)
+	assert.True(t, setup.Completed)
+
+	ts.call("POST", "/login", "", gin.H{"username": "root", "password": "wrong"}, http.StatusUnauthorized, nil)
+	var login struct {
+		Token string
+		User  struct {
+			ID      int
+			IsAdmin bool `json:"is_admin"`
+		}
+	}
+	ts.call("POST", "/login", "", gin.H{"username": "root", "password": "secret"}, http.StatusOK, &login)
+	assert.NotEmpty(t, login.Token)
+	assert.True(t, login.User.IsAdmin)
+}
+
+func TestRefreshRereadsAdminFlag(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	id, _ := ts.user("alice", true)
+	stale, err := auth.GenerateToken(id, false)
+	require.NoError(t, err)
+
+	var refreshed struct{ Token string }
+	ts.call("POST", "/refresh", stale, nil, http.StatusOK, &refreshed)
+	claims, err := auth.ParseToken(refreshed.Token)
+	require.NoError(t, err)
+	assert.Equal(t, id, claims.UserID)
+	assert.True(t, claims.IsAdmin)
+	ts.call("POST", "/refresh", "", nil, http.StatusUnauthorized, nil)
+}
+
+func TestLoginRejectsDisabledUser(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	id, token := ts.user("alice", false)
+	require.NoError(t, ts.store.SetUserDisabled(context.Background(), id, true))
+
+	ts.call("POST", "/login", "", gin.H{"username": "alice", "password": "alice-pass"}, http.StatusForbidden, nil)
+	ts.call("GET", "/workspaces", token, nil, http.StatusUnauthorized, nil)
+	ts.call("GET", "/workspaces", "", nil, http.StatusUnauthorized, nil)
+	ts.call("GET", "/workspaces", "not-a-token", nil, http.StatusUnauthorized, nil)
+}
+
+func TestValidateYjsToken(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	room := gin.H{"room_id": fmt.Sprintf("w%d_n1", wsID), "workspace_id": wsID}
+
+	var resp struct {
+		Valid  bool
+		UserID int `json:"user_id"`
+	}
+	ts.call("POST", "/validate-yjs-token", alice, room, http.StatusOK, &resp)
+	assert.True(t, resp.Valid)
+	assert.Equal(t, aliceID, resp.UserID)
+	ts.call("POST", "/validate-yjs-token", bob, room, http.StatusForbidden, nil)
+	ts.call("POST", "/validate-yjs-token", "", room, http.StatusUnauthorized, nil)
+}
+
+func TestUserEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	adminID, admin := ts.user("admin", true)
+	aliceID, alice := ts.user("alice", false)
+
+	var users []db.User
+	ts.call("GET", "/users/", alice, nil, http.StatusOK, &users)
+	require.Len(t, users, 2)
+	assert.Empty(t, users[0].PasswordHash)
+
+	ts.call("POST", "/users/", alice, gin.H{"username": "bob", "password": "pw"}, http.StatusForbidden, nil)
+	ts.call("POST", "/users/", admin, gin.H{"username": "bob", "password": "pw"}, http.StatusCreated, nil)
+	ts.call("POST", "/users/", admin, gin.H{"username": "bob", "password": "pw"}, http.StatusInternalServerError, nil)
+	bob, err := ts.store.GetUserByUsername(context.Background(), "bob")
+	require.NoError(t, err)
+
+	var user db.User
+	ts.call("GET", fmt.Sprintf("/users/%d", aliceID), alice, nil, http.StatusOK, &user)
+	assert.Equal(t, "alice", user.Username)
+	ts.call("GET", fmt.Sprintf("/users/%d", bob.ID), alice, nil, http.StatusForbidden, nil)
+	ts.call("GET", fmt.Sprintf("/users/%d", bob.ID), admin, nil, http.StatusOK, nil)
+	ts.call("GET", "/users/9999", admin, nil, http.StatusNotFound, nil)
+
+	ts.call("PUT", fmt.Sprintf("/users/%d", aliceID), alice, gin.H{"username": "alice2"}, http.StatusOK, &user)
+	assert.Equal(t, "alice2", user.Username)
+	ts.call("PUT", fmt.Sprintf("/users/%d", bob.ID), alice, gin.H{"username": "x"}, http.StatusForbidden, nil)
+
+	ts.call("DELETE", fmt.Sprintf("/users/%d", adminID), admin, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", fmt.Sprintf("/users/%d", bob.ID), alice, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", fmt.Sprintf("/users/%d", bob.ID), admin, nil, http.StatusOK, nil)
+	ts.call("DELETE", fmt.Sprintf("/users/%d", aliceID), alice, nil, http.StatusOK, nil)
+	// The deleted user's token stops working
+	ts.call("GET", "/users/", alice, nil, http.StatusUnauthorized, nil)
+}
+
+func TestWorkspaceEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	bobID, bob := ts.user("bob", false)
+
+	ts.call("POST", "/workspaces", alice, gin.H{}, http.StatusBadRequest, nil)
+	var created struct{ ID int }
+	ts.call("POST", "/workspaces", alice, gin.H{"name": "Team"}, http.StatusCreated, &created)
+	wsPath := fmt.Sprintf("/workspaces/%d", created.ID)
+
+	var listed []struct {
+		Name string
+		Role string
+	}
+	ts.call("GET", "/workspaces", alice, nil, http.StatusOK, &listed)
+	require.Len(t, listed, 2)
+	assert.Equal(t, "Team", listed[1].Name)
+	assert.Equal(t, "owner", listed[1].Role)
+
+	ts.call("PUT", wsPath, bob, gin.H{"name": "Mine"}, http.StatusForbidden, nil)
+	ts.call("PUT", wsPath, alice, gin.H{"name": "Renamed"}, http.StatusOK, nil)
+
+	ts.call("GET", wsPath+"/members", bob, nil, http.StatusForbidden, nil)
+	ts.call("POST", wsPath+"/members", bob, gin.H{"user_id": bobID, "role": "member"}, http.StatusForbidden, nil)
+	ts.call("POST", wsPath+"/members", alice, gin.H{"user_id": bobID, "role": "admin"}, http.StatusBadRequest, nil)
+	ts.call("POST", wsPath+"/members", alice, gin.H{"user_id": bobID, "role": "member"}, http.StatusOK, nil)
+	var members []db.WorkspaceMember
+	ts.call("GET", wsPath+"/members", bob, nil, http.StatusOK, &members)
+	assert.Len(t, members, 2)
+
+	ts.call("PUT", wsPath+"/owner", bob, gin.H{"new_owner_id": bobID}, http.StatusForbidden, nil)
+	ts.call("PUT", wsPath+"/owner", alice, gin.H{"new_owner_id": aliceID}, http.StatusBadRequest, nil)
+	ts.call("PUT", wsPath+"/owner", alice, gin.H{"new_owner_id": bobID}, http.StatusOK, nil)
+	ts.call("GET", wsPath+"/members", bob, nil, http.StatusOK, &members)
+	roles := map[int]string{}
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	assert.Equal(t, map[int]string{aliceID: "member", bobID: "owner"}, roles)
+
+	// The owner cannot leave; other members can
+	ts.call("DELETE", fmt.Sprintf("%s/members/%d", wsPath, bobID), bob, nil, http.StatusBadRequest, nil)
+	ts.call("DELETE", fmt.Sprintf("%s/members/%d", wsPath, aliceID), alice, nil, http.StatusOK, nil)
+	ts.call("GET", wsPath+"/members", alice, nil, http.StatusForbidden, nil)
+
+	ts.call("DELETE", wsPath, alice, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", wsPath, bob, nil, http.StatusOK, nil)
+	ts.call("GET", wsPath+"/members", bob, nil, http.StatusForbidden, nil)
+}
+
+func TestFolderEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	foldersPath := fmt.Sprintf("/workspaces/%d/folders", wsID)
+
+	ts.call("POST", foldersPath, bob, gin.H{"name": "Nope"}, http.StatusForbidden, nil)
+	var parent, child db.Folder
+	ts.call("POST", foldersPath, alice, gin.H{"name": "Projects"}, http.StatusCreated, &parent)
+	ts.call("POST", foldersPath, alice, gin.H{"name": "Go", "parent_id": parent.ID}, http.StatusCreated, &child)
+	assert.Equal(t, &parent.ID, child.ParentID)
+
+	var folders []db.Folder
+	ts.call("GET", foldersPath, alice, nil, http.StatusOK, &folders)
+	assert.Len(t, folders, 2)
+
+	// A folder cannot move below itself
+	ts.call("PUT", fmt.Sprintf("%s/%d", foldersPath, parent.ID), alice, gin.H{"name": "Projects", "parent_id": child.ID}, http.StatusInternalServerError, nil)
+	ts.call("PUT", fmt.Sprintf("%s/%d", foldersPath, child.ID), alice, gin.H{"name": "Golang", "parent_id": parent.ID}, http.StatusOK, nil)
+
+	// Moving to another workspace takes the subtree and its notes along
+	var other struct{ ID int }
+	ts.call("POST", "/workspaces", alice, gin.H{"name": "Archive"}, http.StatusCreated, &other)
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Deep", "folder_id": child.ID}, http.StatusCreated, &note)
+	ts.call("PUT", fmt.Sprintf("%s/%d", foldersPath, parent.ID), bob, gin.H{"name": "Projects", "workspace_id": other.ID}, http.StatusForbidden, nil)
+	ts.call("PUT", fmt.Sprintf("%s/%d", foldersPath, parent.ID), alice, gin.H{"name": "Projects", "workspace_id": other.ID}, http.StatusOK, nil)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/folders", other.ID), alice, nil, http.StatusOK, &folders)
+	assert.Len(t, folders, 2)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d", other.ID, note.ID), alice, nil, http.StatusOK, &note)
+	assert.Equal(t, other.ID, note.WorkspaceID)
+
+	// Deleting a folder trashes its notes and moves them up
+	otherFolders := fmt.Sprintf("/workspaces/%d/folders", other.ID)
+	ts.call("DELETE", fmt.Sprintf("%s/%d", otherFolders, child.ID), bob, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", fmt.Sprintf("%s/%d", otherFolders, child.ID), alice, nil, http.StatusOK, nil)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d", other.ID, note.ID), alice, nil, http.StatusOK, &note)
+	assert.True(t, note.IsTrashed)
+	assert.Equal(t, &parent.ID, note.FolderID)
+}
+
+func TestNoteEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	notesPath := fmt.Sprintf("/workspaces/%d/notes", wsID)
+
+	ts.call("POST", notesPath, bob, gin.H{"title": "Nope"}, http.StatusForbidden, nil)
+	var note db.Note
+	ts.call("POST", notesPath, alice, gin.H{"title": "Plan", "tags": []string{"Work", "todo"}, "color": "#FF0000"}, http.StatusCreated, &note)
+	assert.Equal(t, fmt.Sprintf("w%d_n%d", wsID, note.ID), note.YjsRoomID)
+	assert.Equal(t, "english", note.SearchLanguage)
+	require.Len(t, note.Tags, 2)
+	assert.Equal(t, "todo", note.Tags[0].Name)
+
+	var untitled db.Note
+	ts.call("POST", notesPath, alice, gin.H{}, http.StatusCreated, &untitled)
+	assert.Equal(t, "Untitled", untitled.Title)
+	assert.Equal(t, "#FFFFFF", untitled.Color)
+
+	notePath := fmt.Sprintf("%s/%d", notesPath, note.ID)
+	ts.call("GET", notePath, bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", notesPath+"/9999", alice, nil, http.StatusNotFound, nil)
+
+	// Listing: plain array, filters, projections and pages
+	var notes []db.Note
+	ts.call("GET", notesPath, alice, nil, http.StatusOK, &notes)
+	assert.Len(t, notes, 3) // with the intro note
+	ts.call("GET", notesPath+"?tag=WORK", alice, nil, http.StatusOK, &notes)
+	require.Len(t, notes, 1)
+	assert.Equal(t, note.ID, notes[0].ID)
+	var projected []map[string]interface{}
+	ts.call("GET", notesPath+"?fields=title,color&sort=title", alice, nil, http.StatusOK, &projected)
+	assert.Equal(t, []map[string]interface{}{
+		{"title": "Intro & Guide", "color": "#FFFFFF"},
+		{"title": "Plan", "color": "#FF0000"},
+		{"title": "Untitled", "color": "#FFFFFF"},
+	}, projected)
+	ts.call("GET", notesPath+"?fields=nope", alice, nil, http.StatusBadRequest, nil)
+	ts.call("GET", notesPath+"?sort=size", alice, nil, http.StatusBadRequest, nil)
+
+	var page struct {
+		Notes      []db.Note
+		NextCursor string `json:"next_cursor"`
+	}
+	var seen []string
+	path := notesPath + "?sort=title&order=desc&limit=2"
+	for {
+		ts.call("GET", path, alice, nil, http.StatusOK, &page)
+		for _, n := range page.Notes {
+			seen = append(seen, n.Title)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = notesPath + "?sort=title&order=desc&limit=2&cursor=" + page.NextCursor
+	}
+	assert.Equal(t, []string{"Untitled", "Plan", "Intro & Guide"}, seen)
+	ts.call("GET", notesPath+"?cursor=garbage", alice, nil, http.StatusBadRequest, nil)
+
+	// Metadata updates, including moving to a folder and back to the root
+	var folder db.Folder
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/folders", wsID), alice, gin.H{"name": "Inbox"}, http.StatusCreated, &folder)
+	ts.call("PUT", notePath, alice, gin.H{"title": "Plan B", "folder_id": folder.ID}, http.StatusOK, &note)
+	assert.Equal(t, "Plan B", note.Title)
+	assert.Equal(t, &folder.ID, note.FolderID)
+	assert.Len(t, note.Tags, 2)
+	ts.call("GET", fmt.Sprintf("%s?folder_id=%d", notesPath, folder.ID), alice, nil, http.StatusOK, &notes)
+	assert.Len(t, notes, 1)
+	ts.call("PUT", notePath, alice, gin.H{"folder_id": nil}, http.StatusOK, &note)
+	assert.Nil(t, note.FolderID)
+
+	// Moving needs membership of the target workspace
+	bobWS := ts.defaultWorkspace(ts.userID("bob"))
+	ts.call("PUT", notePath, alice, gin.H{"workspace_id": bobWS}, http.StatusForbidden, nil)
+	var other struct{ ID int }
+	ts.call("POST", "/workspaces", alice, gin.H{"name": "Other"}, http.StatusCreated, &other)
+	ts.call("PUT", notePath, alice, gin.H{"workspace_id": other.ID}, http.StatusOK, &note)
+	assert.Equal(t, other.ID, note.WorkspaceID)
+	notePath = fmt.Sprintf("/workspaces/%d/notes/%d", other.ID, note.ID)
+
+	ts.call("PUT", notePath+"/search-text", alice, gin.H{"content_text": "milestones"}, http.StatusOK, nil)
+	assert.Equal(t, "milestones", ts.store.SearchText(note.ID))
+
+	// Without the semantic index there is no semantic search nor related
+	// notes
+	ts.call("GET", notePath+"/related", alice, nil, http.StatusNotImplemented, nil)
+	ts.call("GET", "/search?mode=semantic&q=milestones", alice, nil, http.StatusNotImplemented, nil)
+
+	ts.call("DELETE", notePath, bob, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", notePath, alice, nil, http.StatusOK, nil)
+	ts.call("GET", notePath, alice, nil, http.StatusNotFound, nil)
+}
+
+func TestTrashEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+
+	var a, b db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "A"}, http.StatusCreated, &a)
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "B"}, http.StatusCreated, &b)
+
+	ts.call("POST", fmt.Sprintf("%s/notes/%d/trash", wsPath, a.ID), bob, nil, http.StatusForbidden, nil)
+	ts.call("POST", fmt.Sprintf("%s/notes/9999/trash", wsPath), alice, nil, http.StatusNotFound, nil)
+	ts.call("POST", fmt.Sprintf("%s/notes/%d/trash", wsPath, a.ID), alice, nil, http.StatusOK, nil)
+	ts.call("POST", fmt.Sprintf("%s/notes/%d/trash", wsPath, b.ID), alice, nil, http.StatusOK, nil)
+
+	var trashed []db.Note
+	ts.call("GET", wsPath+"/trash", bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", wsPath+"/trash", alice, nil, http.StatusOK, &trashed)
+	require.Len(t, trashed, 2)
+	assert.NotNil(t, trashed[0].TrashedAt)
+	var live []db.Note
+	ts.call("GET", wsPath+"/notes?trashed=false", alice, nil, http.StatusOK, &live)
+	assert.Len(t, live, 1)
+
+	ts.call("POST", fmt.Sprintf("%s/notes/%d/restore", wsPath, a.ID), alice, nil, http.StatusOK, nil)
+	ts.call("POST", wsPath+"/trash/empty", bob, nil, http.StatusForbidden, nil)
+	ts.call("POST", wsPath+"/trash/empty", alice, nil, http.StatusOK, nil)
+	ts.call("GET", wsPath+"/trash", alice, nil, http.StatusOK, &trashed)
+	assert.Empty(t, trashed)
+	ts.call("GET", fmt.Sprintf("%s/notes/%d", wsPath, a.ID), alice, nil, http.StatusOK, nil)
+	ts.call("GET", fmt.Sprintf("%s/notes/%d", wsPath, b.ID), alice, nil, http.StatusNotFound, nil)
+}
+
+func TestTagEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+
+	var note db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Tagged", "tags": []string{"beta"}}, http.StatusCreated, &note)
+	tagsPath := fmt.Sprintf("%s/notes/%d/tags", wsPath, note.ID)
+	ts.call("PUT", tagsPath, bob, gin.H{"tags": []string{"x"}}, http.StatusForbidden, nil)
+	ts.call("PUT", fmt.Sprintf("/workspaces/%d/notes/%d/tags", wsID+1000, note.ID), alice, gin.H{"tags": []string{"x"}}, http.StatusNotFound, nil)
+	ts.call("PUT", tagsPath, alice, gin.H{"tags": []string{"Alpha", "BETA"}}, http.StatusOK, nil)
+
+	var tags []db.Tag
+	ts.call("GET", wsPath+"/tags", bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", wsPath+"/tags", alice, nil, http.StatusOK, &tags)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "Alpha", tags[0].Name)
+	assert.Equal(t, "beta", tags[1].Name, "existing tags are matched ignoring case")
+
+	ts.call("PUT", tagsPath, alice, gin.H{"tags": []string{}}, http.StatusOK, nil)
+	ts.call("GET", wsPath+"/tags", alice, nil, http.StatusOK, &tags)
+	assert.Empty(t, tags)
+	ts.call("GET", "/tags", "", nil, http.StatusOK, &tags)
+	assert.Len(t, tags, 2, "tags outlive their notes")
+}
+
+func TestNoteContentEndpoints(t *testing.T) {
+	documents := map[string]quill.Delta{}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var room string
+		fmt.Sscanf(r.URL.Path, "/documents/%s", &room)
+		room = room[:len(room)-len("/delta")]
+		if r.Method == http.MethodPut {
+			var d quill.Delta
+			json.NewDecoder(r.Body).Decode(&d)
+			documents[room] = d
+		}
+		json.NewEncoder(w).Encode(documents[room])
+	}))
+	defer service.Close()
+
+	ts := newTestServer(t, Deps{Documents: collab.New(service.URL)})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Doc"}, http.StatusCreated, &note)
+	contentPath := fmt.Sprintf("/workspaces/%d/notes/%d/content", wsID, note.ID)
+
+	ts.call("PUT", contentPath, alice, gin.H{}, http.StatusBadRequest, nil)
+	ts.call("PUT", contentPath, bob, gin.H{"markdown": "# Hi\n"}, http.StatusForbidden, nil)
+	ts.call("PUT", contentPath, alice, gin.H{"markdown": "# Hi\n"}, http.StatusOK, nil)
+	assert.Equal(t, "Hi", ts.store.SearchText(note.ID))
+
+	var content struct{ Markdown string }
+	ts.call("GET", contentPath, alice, nil, http.StatusOK, &content)
+	assert.Equal(t, "# Hi\n", content.Markdown)
+	ts.call("GET", fmt.Sprintf("/workspaces/%d/notes/%d/content", wsID+1000, note.ID), alice, nil, http.StatusNotFound, nil)
+}
+
+func TestNoteBodyEditEvents(t *testing.T) {
+	_, client := newFakeDocuments(t)
+	ts := newTestServer(t, Deps{Documents: client})
+	aliceID, alice := ts.user("alice", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+	var hook db.Webhook
+	ts.call("POST", wsPath+"/webhooks", alice, gin.H{"url": "https://203.0.113.5/hook", "event_types": []string{"note.updated"}}, http.StatusCreated, &hook)
+	var note db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Doc"}, http.StatusCreated, &note)
+	notePath := fmt.Sprintf("%s/notes/%d", wsPath, note.ID)
+	updates := func() int {
+		var deliveries []db.WebhookDelivery
+		ts.call("GET", fmt.Sprintf("%s/webhooks/%d/deliveries", wsPath, hook.ID), alice, nil, http.StatusOK, &deliveries)
+		return len(deliveries)
+	}
+
+	ts.call("PUT", notePath+"/search-text", alice, gin.H{"content_text": "one"}, http.StatusOK, nil)
+	assert.Equal(t, 1, updates())
+	ts.call("PUT", notePath+"/search-text", alice, gin.H{"content_text": "one"}, http.StatusOK, nil)
+	assert.Equal(t, 1, updates(), "unchanged text is no edit")
+	ts.call("PUT", notePath+"/search-text", alice, gin.H{"content_text": "one two"}, http.StatusOK, nil)
+	assert.Equal(t, 1, updates(), "held until the interval ends")
+	assert.Equal(t, "one two", ts.store.SearchText(note.ID))
+
+	ts.call("PUT", notePath+"/content", alice, gin.H{"markdown": "three\n"}, http.StatusOK, nil)
+	assert.Equal(t, 2, updates(), "content set through the API is announced at once")
+}
+
+func TestBodyEditsPacing(t *testing.T) {
+	edits := newBodyEdits(20 * time.Millisecond)
+	flushed := make(chan [2]int, 1)
+	flush := func(noteID, actorID int) { flushed <- [2]int{noteID, actorID} }
+
+	assert.True(t, edits.edited(1, 10, flush))
+	assert.True(t, edits.edited(2, 10, flush), "notes are paced apart")
+	assert.False(t, edits.edited(1, 10, flush))
+	assert.False(t, edits.edited(1, 11, flush))
+	select {
+	case got := <-flushed:
+		assert.Equal(t, [2]int{1, 11}, got, "held edits are announced once, for the last editor")
+	case <-time.After(time.Second):
+		t.Fatal("held edits were not announced")
+	}
+	assert.Eventually(t, func() bool { return edits.edited(1, 10, flush) }, time.Second, 5*time.Millisecond)
+	select {
+	case got := <-flushed:
+		t.Fatalf("note 2 had nothing held, but %v was announced", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// userID looks up an account created by user
+func (ts *testServer) userID(name string) int {
+	ts.t.Helper()
+	u, err := ts.store.GetUserByUsername(context.Background(), name)
+	require.NoError(ts.t, err)
+	return u.ID
+}
+
+func TestSavedSearchEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	bobID, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+
+	var plan, other db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Project plan", "tags": []string{"work"}}, http.StatusCreated, &plan)
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Groceries"}, http.StatusCreated, &other)
+	ts.call("PUT", fmt.Sprintf("%s/notes/%d/search-text", wsPath, other.ID), alice, gin.H{"content_text": "milk and project paper"}, http.StatusOK, nil)
+
+	ts.call("POST", "/saved-searches", alice, gin.H{"name": "Work"}, http.StatusBadRequest, nil)
+	ts.call("POST", "/saved-searches", alice, gin.H{"name": "Work", "query": "tag:work", "mode": "exact"}, http.StatusBadRequest, nil)
+	ts.call("POST", "/saved-searches", bob, gin.H{"name": "Work", "query": "tag:work", "workspace_id": wsID}, http.StatusForbidden, nil)
+	var work, project db.SavedSearch
+	ts.call("POST", "/saved-searches", alice, gin.H{"name": "Work", "query": "tag:work"}, http.StatusCreated, &work)
+	assert.Equal(t, "metadata", work.Mode)
+	assert.Nil(t, work.WorkspaceID)
+	ts.call("POST", "/saved-searches", alice, gin.H{"name": "project", "query": "project", "mode": "full"}, http.StatusCreated, &project)
+
+	var notes []db.Note
+	workPath := fmt.Sprintf("/saved-searches/%d", work.ID)
+	ts.call("GET", workPath+"/notes", alice, nil, http.StatusOK, &notes)
+	require.Len(t, notes, 1)
+	assert.Equal(t, plan.ID, notes[0].ID)
+	require.Len(t, notes[0].Tags, 1)
+	ts.call("GET", fmt.Sprintf("/saved-searches/%d/notes", project.ID), alice, nil, http.StatusOK, &notes)
+	assert.Len(t, notes, 2, "full mode also matches content")
+
+	var counts []db.SavedSearchCount
+	ts.call("GET", "/saved-searches/counts", alice, nil, http.StatusOK, &counts)
+	assert.Equal(t, []db.SavedSearchCount{{ID: project.ID, Name: "project", Count: 2}, {ID: work.ID, Name: "Work", Count: 1}}, counts)
+
+	// Private until shared with a workspace the viewer belongs to
+	ts.call("GET", workPath, bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", workPath+"/notes", bob, nil, http.StatusForbidden, nil)
+	ts.call("POST", wsPath+"/members", alice, gin.H{"user_id": bobID, "role": "member"}, http.StatusOK, nil)
+	ts.call("PUT", workPath, alice, gin.H{"name": "Team work", "query": "tag:work", "workspace_id": wsID}, http.StatusOK, &work)
+	assert.Equal(t, &wsID, work.WorkspaceID)
+	ts.call("GET", workPath+"/notes", bob, nil, http.StatusOK, &notes)
+	assert.Len(t, notes, 1)
+	var searches []db.SavedSearch
+	ts.call("GET", "/saved-searches", bob, nil, http.StatusOK, &searches)
+	require.Len(t, searches, 1)
+	assert.Equal(t, "Team work", searches[0].Name)
+
+	ts.call("PUT", workPath, bob, gin.H{"name": "Mine", "query": "x"}, http.StatusForbidden, nil)
+	ts.call("DELETE", workPath, bob, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", workPath, alice, nil, http.StatusOK, nil)
+	ts.call("GET", workPath, alice, nil, http.StatusNotFound, nil)
+}
+
+func TestSavedSearchNeedsCurrentMembership(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	bobID, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Salary review", "tags": []string{"hr"}}, http.StatusCreated, nil)
+	ts.call("POST", wsPath+"/members", alice, gin.H{"user_id": bobID, "role": "member"}, http.StatusOK, nil)
+
+	var shared, private db.SavedSearch
+	ts.call("POST", "/saved-searches", bob, gin.H{"name": "HR", "query": "tag:hr", "workspace_id": wsID}, http.StatusCreated, &shared)
+	ts.call("POST", "/saved-searches", bob, gin.H{"name": "All HR", "query": "tag:hr"}, http.StatusCreated, &private)
+	sharedPath := fmt.Sprintf("/saved-searches/%d", shared.ID)
+	var notes []db.Note
+	ts.call("GET", sharedPath+"/notes", bob, nil, http.StatusOK, &notes)
+	assert.Len(t, notes, 1)
+
+	// Removed from the workspace, bob still owns the search but it is no
+	// longer listed and shows nothing
+	ts.call("DELETE", fmt.Sprintf("%s/members/%d", wsPath, bobID), alice, nil, http.StatusOK, nil)
+	var searches []db.SavedSearch
+	ts.call("GET", "/saved-searches", bob, nil, http.StatusOK, &searches)
+	require.Len(t, searches, 1)
+	assert.Equal(t, private.ID, searches[0].ID)
+	ts.call("GET", sharedPath, bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", sharedPath+"/notes", bob, nil, http.StatusForbidden, nil)
+	ts.call("GET", fmt.Sprintf("/saved-searches/%d/notes", private.ID), bob, nil, http.StatusOK, &notes)
+	assert.Empty(t, notes)
+	var counts []db.SavedSearchCount
+	ts.call("GET", "/saved-searches/counts", bob, nil, http.StatusOK, &counts)
+	assert.Equal(t, []db.SavedSearchCount{{ID: private.ID, Name: "All HR", Count: 0}}, counts)
+
+	ts.call("PUT", sharedPath, bob, gin.H{"name": "HR", "query": "tag:hr", "workspace_id": wsID}, http.StatusForbidden, nil)
+	ts.call("DELETE", sharedPath, bob, nil, http.StatusOK, nil)
+}
+
+func TestSyncEndpoint(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	bobID, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+
+	var changes db.SyncChanges
+	ts.call("GET", "/sync", alice, nil, http.StatusOK, &changes)
+	assert.True(t, changes.Full)
+	require.Len(t, changes.Workspaces, 1)
+	assert.Len(t, changes.Notes, 1, "the intro note")
+	cursor := changes.Cursor
+	ts.call("GET", "/sync?since=garbage", alice, nil, http.StatusBadRequest, nil)
+
+	var folder db.Folder
+	var note db.Note
+	ts.call("POST", wsPath+"/folders", alice, gin.H{"name": "Inbox"}, http.StatusCreated, &folder)
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Plan", "folder_id": folder.ID, "tags": []string{"work"}}, http.StatusCreated, &note)
+	ts.call("GET", "/sync?since="+cursor, alice, nil, http.StatusOK, &changes)
+	assert.False(t, changes.Full)
+	assert.Empty(t, changes.Workspaces)
+	require.Len(t, changes.Folders, 1)
+	assert.Equal(t, folder.ID, changes.Folders[0].ID)
+	require.Len(t, changes.Notes, 1)
+	assert.Equal(t, note.ID, changes.Notes[0].ID)
+	require.Len(t, changes.Tags, 1)
+	assert.Equal(t, "work", changes.Tags[0].Name)
+	cursor = changes.Cursor
+
+	// Content is synced through the document service, not here
+	notePath := fmt.Sprintf("%s/notes/%d", wsPath, note.ID)
+	ts.call("PUT", notePath+"/search-text", alice, gin.H{"content_text": "milestones"}, http.StatusOK, nil)
+	ts.call("GET", "/sync?since="+cursor, alice, nil, http.StatusOK, &changes)
+	assert.Empty(t, changes.Notes)
+	cursor = changes.Cursor
+
+	ts.call("DELETE", notePath, alice, nil, http.StatusOK, nil)
+	ts.call("DELETE", fmt.Sprintf("%s/folders/%d", wsPath, folder.ID), alice, nil, http.StatusOK, nil)
+	ts.call("GET", "/sync?since="+cursor, alice, nil, http.StatusOK, &changes)
+	assert.Equal(t, []int{note.ID}, changes.Deleted.Notes)
+	assert.Equal(t, []int{folder.ID}, changes.Deleted.Folders)
+	assert.Equal(t, []db.SyncRef{{WorkspaceID: wsID, ID: changes.Deleted.Tags[0].ID}}, changes.Deleted.Tags)
+
+	// Joining a workspace sends it whole; leaving it drops it
+	ts.call("GET", "/sync", bob, nil, http.StatusOK, &changes)
+	cursor = changes.Cursor
+	ts.call("POST", wsPath+"/members", alice, gin.H{"user_id": bobID, "role": "member"}, http.StatusOK, nil)
+	ts.call("GET", "/sync?since="+cursor, bob, nil, http.StatusOK, &changes)
+	require.Len(t, changes.Workspaces, 1)
+	assert.Equal(t, wsID, changes.Workspaces[0].ID)
+	assert.Len(t, changes.Members, 2)
+	cursor = changes.Cursor
+	ts.call("DELETE", fmt.Sprintf("%s/members/%d", wsPath, bobID), bob, nil, http.StatusOK, nil)
+	ts.call("GET", "/sync?since="+cursor, bob, nil, http.StatusOK, &changes)
+	assert.Equal(t, []int{wsID}, changes.Deleted.Workspaces)
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+	hooksPath := wsPath + "/webhooks"
+
+	ts.call("GET", hooksPath, bob, nil, http.StatusForbidden, nil)
+	ts.call("POST", hooksPath, alice, gin.H{"url": "http://127.0.0.1/hook"}, http.StatusBadRequest, nil)
+	ts.call("POST", hooksPath, alice, gin.H{"url": "https://203.0.113.5/hook", "event_types": []string{"note.exploded"}}, http.StatusBadRequest, nil)
+	var hook db.Webhook
+	ts.call("POST", hooksPath, alice, gin.H{"url": "https://203.0.113.5/hook", "event_types": []string{"note.created"}}, http.StatusCreated, &hook)
+	assert.NotEmpty(t, hook.Secret)
+	assert.True(t, hook.Active)
+
+	var hooks []db.Webhook
+	ts.call("GET", hooksPath, alice, nil, http.StatusOK, &hooks)
+	require.Len(t, hooks, 1)
+	assert.Empty(t, hooks[0].Secret)
+
+	// Only subscribed events are queued
+	var note db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Plan"}, http.StatusCreated, &note)
+	ts.call("PUT", fmt.Sprintf("%s/notes/%d", wsPath, note.ID), alice, gin.H{"title": "Plan B"}, http.StatusOK, nil)
+	hookPath := fmt.Sprintf("%s/%d", hooksPath, hook.ID)
+	var deliveries []db.WebhookDelivery
+	ts.call("GET", hookPath+"/deliveries", alice, nil, http.StatusOK, &deliveries)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "note.created", deliveries[0].EventType)
+	assert.Equal(t, "pending", deliveries[0].Status)
+
+	var queued struct {
+		DeliveryID int64 `json:"delivery_id"`
+	}
+	ts.call("POST", hookPath+"/ping", alice, nil, http.StatusAccepted, &queued)
+	ts.call("POST", fmt.Sprintf("%s/deliveries/%d/redeliver", hookPath, deliveries[0].ID), alice, nil, http.StatusAccepted, nil)
+	ts.call("POST", hookPath+"/deliveries/9999/redeliver", alice, nil, http.StatusNotFound, nil)
+	ts.call("GET", hookPath+"/deliveries", alice, nil, http.StatusOK, &deliveries)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, "note.created", deliveries[0].EventType)
+	assert.Equal(t, queued.DeliveryID, deliveries[1].ID)
+
+	ts.call("PUT", hookPath, bob, gin.H{"url": "https://203.0.113.5/hook"}, http.StatusForbidden, nil)
+	ts.call("PUT", hookPath, alice, gin.H{"url": "https://203.0.113.6/hook", "active": false}, http.StatusOK, nil)
+	ts.call("GET", hookPath, alice, nil, http.StatusOK, &hook)
+	assert.False(t, hook.Active)
+	assert.Empty(t, hook.EventTypes)
+	ts.call("DELETE", hookPath, alice, nil, http.StatusOK, nil)
+	ts.call("GET", hookPath, alice, nil, http.StatusNotFound, nil)
+}
+
+func TestWorkspaceDeletedWebhook(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	var ws db.Workspace
+	ts.call("POST", "/workspaces", alice, gin.H{"name": "Temp"}, http.StatusCreated, &ws)
+	wsPath := fmt.Sprintf("/workspaces/%d", ws.ID)
+	ts.call("POST", wsPath+"/webhooks", alice, gin.H{"url": "https://203.0.113.5/hook", "event_types": []string{"workspace.deleted"}}, http.StatusCreated, nil)
+
+	ts.call("DELETE", wsPath, bob, nil, http.StatusForbidden, nil)
+	ts.call("DELETE", wsPath, alice, nil, http.StatusOK, nil)
+
+	// The webhook went with the workspace but its delivery did not
+	claimed, err := ts.store.ClaimWebhookDeliveries(context.Background(), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "workspace.deleted", claimed[0].EventType)
+	assert.Equal(t, "https://203.0.113.5/hook", claimed[0].URL)
+	assert.NotEmpty(t, claimed[0].Secret)
+	var payload events.Event
+	require.NoError(t, json.Unmarshal([]byte(claimed[0].Payload), &payload))
+	assert.Equal(t, ws.ID, payload.WorkspaceID)
+	assert.Equal(t, aliceID, payload.ActorID)
+}
+
+func TestSearchLanguageEndpoints(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+	wsPath := fmt.Sprintf("/workspaces/%d", wsID)
+
+	var languages struct {
+		Default   string
+		Languages []string
+	}
+	ts.call("GET", "/search/languages", alice, nil, http.StatusOK, &languages)
+	assert.Equal(t, "english", languages.Default)
+	assert.Contains(t, languages.Languages, "german")
+
+	var note db.Note
+	ts.call("POST", wsPath+"/notes", alice, gin.H{"title": "Plan"}, http.StatusCreated, &note)
+	ts.call("PUT", wsPath+"/search-language", bob, gin.H{"language": "german"}, http.StatusForbidden, nil)
+	ts.call("PUT", wsPath+"/search-language", alice, gin.H{"language": "klingon"}, http.StatusBadRequest, nil)
+	ts.call("PUT", wsPath+"/search-language", alice, gin.H{"language": "german"}, http.StatusOK, nil)
+
+	notePath := fmt.Sprintf("%s/notes/%d", wsPath, note.ID)
+	ts.call("GET", notePath, alice, nil, http.StatusOK, &note)
+	assert.Equal(t, "german", note.SearchLanguage, "notes follow their workspace")
+	ts.call("PUT", notePath, alice, gin.H{"search_language": "klingon"}, http.StatusBadRequest, nil)
+	ts.call("PUT", notePath, alice, gin.H{"search_language": "french"}, http.StatusOK, &note)
+	assert.Equal(t, "french", note.SearchLanguage)
+	assert.False(t, note.SearchLanguageInherited)
+	ts.call("PUT", notePath, alice, gin.H{"search_language": nil}, http.StatusOK, &note)
+	assert.Equal(t, "german", note.SearchLanguage)
+	assert.True(t, note.SearchLanguageInherited)
+}
+
+func TestFuzzySearch(t *testing.T) {
+	ts := newTestServer(t, Deps{})
+	aliceID, alice := ts.user("alice", false)
+	_, bob := ts.user("bob", false)
+	wsID := ts.defaultWorkspace(aliceID)
+
+	var note db.Note
+	ts.call("POST", fmt.Sprintf("/workspaces/%d/notes", wsID), alice, gin.H{"title": "Weekly meeting"}, http.StatusCreated, &note)
+
+	var result db.FuzzySearchResult
+	ts.call("GET", "/search?mode=fuzzy&q=meetnig", alice, nil, http.StatusOK, &result)
+	require.Len(t, result.Notes, 1)
+	assert.Equal(t, note.ID, result.Notes[0].ID)
+	assert.Equal(t, "meeting", result.DidYouMean)
+	assert.Equal(t, []string{"meeting"}, result.Suggestions)
+
+	var hidden db.FuzzySearchResult
+	ts.call("GET", "/search?mode=fuzzy&q=meetnig", bob, nil, http.StatusOK, &hidden)
+	assert.Empty(t, hidden.Notes)
+	assert.Empty(t, hidden.DidYouMean)
+}
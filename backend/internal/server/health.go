@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/auth"
+	"go-notes/backend/internal/db"
+)
+
+// healthRoutes registers the probes and the migration status report
+func (s *server) healthRoutes(api *gin.RouterGroup) {
+	api.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	// Liveness probe - is the application alive?
+	api.GET("/health/live", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "alive"})
+	})
+
+	// Readiness probe - is the application ready to serve traffic?
+	api.GET("/health/ready", func(c *gin.Context) {
+		// Check database connectivity
+		if err := s.DB.PingContext(c.Request.Context()); err != nil {
+			c.JSON(503, gin.H{"status": "not ready", "error": "database unreachable"})
+			return
+		}
+		c.JSON(200, gin.H{"status": "ready", "database": "connected"})
+	})
+
+	// Schema migration state (admin only); dirty means a migration failed part
+	// way and needs `go-notes migrate force`
+	api.GET("/admin/migrations", auth.AuthRequired(s.Users), func(c *gin.Context) {
+		if !c.GetBool("is_admin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin only"})
+			return
+		}
+		status, err := db.GetMigrationStatus(s.DB)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read migration status"})
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+}
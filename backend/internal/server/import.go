@@ -0,0 +1,452 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/archive"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/imaging"
+	"go-notes/backend/internal/importer"
+	"go-notes/backend/internal/quill"
+)
+
+func (s *server) importRoutes(workspaceGroup *gin.RouterGroup) {
+	// Recreates a workspace from an export archive uploaded as the file
+	// field, owned by the caller, attachments included. ?dry_run=true only
+	// validates and reports.
+	workspaceGroup.POST("/import", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		headers, ok := uploadedFiles(c)
+		if !ok {
+			return
+		}
+		file, err := headers[0].Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the upload"})
+			return
+		}
+		defer file.Close()
+
+		in, report := archive.Read(file, headers[0].Size, maxUnpacked())
+		if in == nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid archive", "report": report})
+			return
+		}
+		if name := strings.TrimSpace(c.PostForm("name")); name != "" {
+			in.Name, report.Workspace = name, name
+		}
+		if err := s.checkImportLanguages(c.Request.Context(), &in.WorkspaceImport, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check search languages"})
+			return
+		}
+
+		if c.Query("dry_run") == "true" {
+			c.JSON(http.StatusOK, gin.H{"dry_run": true, "report": report})
+			return
+		}
+
+		imported, err := s.Workspaces.ImportWorkspace(c.Request.Context(), userID, in.WorkspaceImport)
+		if err != nil {
+			log.Printf("[WARN] Importing workspace %q failed: %v", in.Name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed"})
+			return
+		}
+		s.importAttachments(c.Request.Context(), userID, in, imported, &report)
+		s.reindexWorkspace(c.Request.Context(), imported.WorkspaceID)
+		c.JSON(http.StatusCreated, gin.H{
+			"workspace_id": imported.WorkspaceID,
+			"name":         in.Name,
+			"folders":      imported.Folders,
+			"notes":        imported.Notes,
+			"report":       report,
+		})
+	})
+
+	// Imports a zip of a Markdown directory tree, such as an Obsidian vault,
+	// into the workspace, below the folder_id form field when given
+	workspaceGroup.POST("/:id/import/markdown", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		headers, ok := uploadedFiles(c)
+		if !ok {
+			return
+		}
+		target, ok := s.importTarget(c, workspaceID, userID)
+		if !ok {
+			return
+		}
+		file, err := headers[0].Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the upload"})
+			return
+		}
+		defer file.Close()
+
+		notes, warnings, err := importer.ReadMarkdown(file, headers[0].Size, maxUnpacked())
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid archive: " + err.Error()})
+			return
+		}
+		result, err := importer.Run(c.Request.Context(), s.importStore(c), s.Documents, target, notes, warnings)
+		s.finishImport(c, target, result, err)
+	})
+
+	// Imports Evernote exports, one notebook per .enex file field, into
+	// folders named after the files. Notes are created as they are read.
+	workspaceGroup.POST("/:id/import/enex", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		headers, ok := uploadedFiles(c)
+		if !ok {
+			return
+		}
+		target, ok := s.importTarget(c, workspaceID, userID)
+		if !ok {
+			return
+		}
+
+		stream := importer.NewStream(c.Request.Context(), s.importStore(c), s.Documents, target)
+		for _, header := range headers {
+			err := readENEX(header, stream)
+			var formatErr *importer.FormatError
+			if errors.As(err, &formatErr) {
+				// The notes before the problem are kept; the next file may
+				// still be fine
+				stream.Warn("%v", err)
+				continue
+			}
+			if err != nil {
+				s.finishImport(c, target, stream.Result(), err)
+				return
+			}
+		}
+		if result := stream.Result(); len(result.Notes) == 0 && len(result.Warnings) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No notes could be read", "warnings": result.Warnings})
+			return
+		}
+		s.finishImport(c, target, stream.Result(), nil)
+	})
+}
+
+func readENEX(header *multipart.FileHeader, stream *importer.Stream) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return importer.ReadENEX(file, header.Filename, stream.Add)
+}
+
+// importTarget reads the optional folder_id form field of an import into
+// a workspace, answering the request itself when it is not one of its
+// folders
+func (s *server) importTarget(c *gin.Context, workspaceID, userID int) (importer.Target, bool) {
+	target := importer.Target{WorkspaceID: workspaceID, UserID: userID}
+	raw := c.PostForm("folder_id")
+	if raw == "" {
+		return target, true
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder_id"})
+		return target, false
+	}
+	folder, err := s.Folders.GetFolder(c.Request.Context(), id)
+	if err != nil || folder.WorkspaceID != workspaceID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Folder not found in this workspace"})
+		return target, false
+	}
+	target.FolderID = &id
+	return target, true
+}
+
+// importStore gives an import the folders, notes and tags it writes
+type importStore struct {
+	FolderStore
+	NoteStore
+	TagStore
+
+	s *server
+	c *gin.Context
+}
+
+func (s *server) importStore(c *gin.Context) importStore {
+	return importStore{FolderStore: s.Folders, NoteStore: s.Notes, TagStore: s.Tags, s: s, c: c}
+}
+
+// SetNoteContent writes a note's content, the last step of creating it, in
+// the transaction that announces the note
+func (st importStore) SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error {
+	return st.s.change(st.c, func(tx TxStores) ([]events.Event, error) {
+		if err := tx.SetNoteContent(ctx, noteID, content, contentText, createdAt, updatedAt); err != nil {
+			return nil, err
+		}
+		note, err := tx.GetNote(ctx, noteID)
+		if err != nil {
+			return nil, err
+		}
+		if note.Tags, err = tx.ListTagsForNote(ctx, noteID); err != nil {
+			return nil, err
+		}
+		return []events.Event{{Type: events.NoteCreated, WorkspaceID: note.WorkspaceID, Data: note}}, nil
+	})
+}
+
+// errAttachmentsOff is why an import leaves files out when the server
+// stores no attachments
+var errAttachmentsOff = errors.New("attachments are not configured")
+
+// AddAttachment stores a file of an imported note as an attachment, within
+// the workspace's quota as uploads are, and returns its URL
+func (st importStore) AddAttachment(ctx context.Context, workspaceID, noteID int, createdBy *int, filename string, data []byte) (string, error) {
+	if st.s.Attachments == nil || st.s.Blobs == nil {
+		return "", errAttachmentsOff
+	}
+	a, err := st.s.storeAttachment(ctx, noteID, createdBy, filename, bytes.NewReader(data))
+	switch {
+	case errors.Is(err, imaging.ErrInvalid), errors.Is(err, db.ErrQuotaExceeded):
+		return "", err
+	case err != nil:
+		log.Printf("[WARN] Storing imported attachment for note %d failed: %v", noteID, err)
+		return "", errors.New("it could not be stored")
+	}
+	return st.s.attachmentJSON(workspaceID, a).URL, nil
+}
+
+// finishImport indexes the notes of an import and answers with what was
+// created. Notes created before a failure are kept and listed; those whose
+// content was not written yet were not announced.
+func (s *server) finishImport(c *gin.Context, target importer.Target, result *importer.Result, err error) {
+	s.reindexWorkspace(c.Request.Context(), target.WorkspaceID)
+	if err != nil {
+		log.Printf("[WARN] Import into workspace %d stopped: %v", target.WorkspaceID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":    "Import stopped before every note was created",
+			"folders":  result.Folders,
+			"notes":    result.Notes,
+			"warnings": result.Warnings,
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
+
+// maxUnpacked is what an uploaded archive may unpack to in all,
+// IMPORT_MAX_UNPACKED_MB
+func maxUnpacked() int64 {
+	return int64(getenvInt("IMPORT_MAX_UNPACKED_MB", 2048)) << 20
+}
+
+// uploadedFiles returns the file fields of an import upload of at most
+// IMPORT_MAX_MB, answering the request itself when there are none
+func uploadedFiles(c *gin.Context) ([]*multipart.FileHeader, bool) {
+	return formFiles(c, int64(getenvInt("IMPORT_MAX_MB", 512))<<20, "Upload the archive as the file field")
+}
+
+// formFiles returns the file fields of a multipart upload of at most
+// maxBytes, answering the request itself with the missing message when
+// there are none
+func formFiles(c *gin.Context, maxBytes int64, missing string) ([]*multipart.FileHeader, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload is larger than %d MB", maxBytes>>20)})
+			return nil, false
+		}
+	}
+	if err != nil || len(form.File["file"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": missing})
+		return nil, false
+	}
+	return form.File["file"], true
+}
+
+// importAttachments re-creates the attachments of an imported workspace's
+// notes and points the URLs in the notes' content at them. Attachments
+// that cannot be stored are reported and left out, since the notes already
+// exist.
+func (s *server) importAttachments(ctx context.Context, userID int, in *archive.Import, imported *db.ImportedWorkspace, report *archive.Report) {
+	if len(in.Attachments) == 0 {
+		return
+	}
+	if s.Attachments == nil || s.Blobs == nil {
+		report.Warnings = append(report.Warnings, "Attachment storage is not configured; attachments are left out")
+		return
+	}
+
+	// Content may embed attachments of other notes, so every attachment is
+	// stored before any content is rewritten
+	urls := map[int]string{} // exported attachment ID to new URL
+	for _, n := range imported.Notes {
+		for _, f := range in.Attachments[n.Key] {
+			a, err := s.importAttachment(ctx, n.ID, userID, f)
+			if err != nil {
+				if !errors.Is(err, db.ErrQuotaExceeded) && !errors.Is(err, imaging.ErrInvalid) {
+					log.Printf("[WARN] Importing attachment %d of note %d failed: %v", f.ID, n.ID, err)
+				}
+				report.Warnings = append(report.Warnings, fmt.Sprintf("Note %d: attachment %s is left out: %v", n.Key, f.Filename, err))
+				continue
+			}
+			urls[f.ID] = s.attachmentJSON(imported.WorkspaceID, a).URL
+		}
+	}
+
+	byKey := make(map[int]db.ImportNote, len(in.Notes))
+	for _, n := range in.Notes {
+		byKey[n.Key] = n
+	}
+	for _, n := range imported.Notes {
+		note := byKey[n.Key]
+		if len(in.Attachments[n.Key]) == 0 || len(note.Content) == 0 {
+			continue
+		}
+		if err := s.relinkAttachments(ctx, n.ID, note, urls); err != nil {
+			log.Printf("[WARN] Rewriting attachment URLs of note %d failed: %v", n.ID, err)
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Note %d (%s): its attachments may not display: %v", n.Key, note.Title, err))
+		}
+	}
+}
+
+// importAttachment streams an attachment from the archive into storage
+func (s *server) importAttachment(ctx context.Context, noteID, userID int, f archive.File) (db.Attachment, error) {
+	r, err := f.Open()
+	if err != nil {
+		return db.Attachment{}, err
+	}
+	defer r.Close()
+	return s.storeAttachment(ctx, noteID, &userID, f.Filename, r)
+}
+
+// relinkAttachments rewrites the attachment URLs of an imported note's
+// content, keeping its timestamps
+func (s *server) relinkAttachments(ctx context.Context, noteID int, note db.ImportNote, urls map[int]string) error {
+	delta, err := s.Documents.Decode(ctx, note.Content)
+	if err != nil {
+		return err
+	}
+	delta, changed := rewriteAttachmentURLs(delta, urls)
+	if !changed {
+		return nil
+	}
+	state, err := s.Documents.Encode(ctx, delta)
+	if err != nil {
+		return err
+	}
+	return s.Notes.SetNoteContent(ctx, noteID, state, note.ContentText, note.CreatedAt, note.UpdatedAt)
+}
+
+// rewriteAttachmentURLs points the images and links of a Delta that refer
+// to an attachment, by ID, at the URL urls gives it, keeping the
+// thumbnail width a URL asks for. It reports whether anything changed.
+func rewriteAttachmentURLs(d quill.Delta, urls map[int]string) (quill.Delta, bool) {
+	replace := func(src string) (string, bool) {
+		if _, id, _, ok := parseAttachmentURL(src); ok {
+			if u, ok := urls[id]; ok {
+				if parsed, err := url.Parse(src); err == nil && parsed.Query().Get("w") != "" {
+					u += "&w=" + url.QueryEscape(parsed.Query().Get("w"))
+				}
+				return u, u != src
+			}
+		}
+		return src, false
+	}
+	changed := false
+	out := quill.Delta{Ops: make([]quill.Op, 0, len(d.Ops))}
+	for _, op := range d.Ops {
+		if embed, ok := op.Insert.(map[string]any); ok {
+			if src, ok := embed["image"].(string); ok {
+				if u, ok := replace(src); ok {
+					copied := make(map[string]any, len(embed))
+					for k, v := range embed {
+						copied[k] = v
+					}
+					copied["image"] = u
+					op.Insert = copied
+					changed = true
+				}
+			}
+		}
+		if href, ok := op.Attributes["link"].(string); ok {
+			if u, ok := replace(href); ok {
+				attrs := make(map[string]any, len(op.Attributes))
+				for k, v := range op.Attributes {
+					attrs[k] = v
+				}
+				attrs["link"] = u
+				op.Attributes = attrs
+				changed = true
+			}
+		}
+		out.Ops = append(out.Ops, op)
+	}
+	return out, changed
+}
+
+// checkImportLanguages drops search languages this server cannot use,
+// warning about each, so they fall back to the defaults
+func (s *server) checkImportLanguages(ctx context.Context, in *db.WorkspaceImport, report *archive.Report) error {
+	valid := map[string]bool{"": true}
+	check := func(language string) (bool, error) {
+		ok, seen := valid[language]
+		if seen {
+			return ok, nil
+		}
+		if s.Languages != nil {
+			var err error
+			if ok, err = s.Languages.IsValidSearchLanguage(ctx, language); err != nil {
+				return false, err
+			}
+		} else {
+			ok = true
+		}
+		valid[language] = ok
+		if !ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Search language %q is not available; the default is used", language))
+		}
+		return ok, nil
+	}
+
+	ok, err := check(in.SearchLanguage)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		in.SearchLanguage = ""
+	}
+	for i := range in.Notes {
+		ok, err := check(in.Notes[i].SearchLanguage)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			in.Notes[i].SearchLanguage = ""
+		}
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/quill"
+)
+
+// selectFields projects notes onto the requested JSON fields (?fields=id,title)
+func selectFields(notes []db.Note, fields []string) ([]map[string]interface{}, error) {
+	// A note with tags set marshals every field, giving the set of valid names
+	var known map[string]interface{}
+	sample, _ := json.Marshal(db.Note{Tags: []db.Tag{{}}})
+	json.Unmarshal(sample, &known)
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+		if _, ok := known[fields[i]]; !ok {
+			return nil, fmt.Errorf("unknown field %q", fields[i])
+		}
+	}
+
+	raw, err := json.Marshal(notes)
+	if err != nil {
+		return nil, err
+	}
+	var full []map[string]interface{}
+	if err := json.Unmarshal(raw, &full); err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]interface{}, len(full))
+	for i, n := range full {
+		projected[i] = make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			projected[i][f] = n[f]
+		}
+	}
+	return projected, nil
+}
+
+func (s *server) noteRoutes(workspaceGroup *gin.RouterGroup) {
+	// --- Notes CRUD Endpoints (with tags) ---
+	notesGroup := workspaceGroup.Group("/:id/notes")
+
+	notesGroup.POST("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		var req struct {
+			Title    string   `json:"title"`
+			FolderID *int     `json:"folder_id"`
+			Tags     []string `json:"tags"`
+			Color    string   `json:"color"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// Title defaults to "Untitled" if empty (handled in CreateNote)
+		// The note and its tags are created together or not at all
+		ctx := c.Request.Context()
+		var note *db.Note
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			noteID, err := tx.CreateNoteWithTags(ctx, workspaceID, req.Title, req.FolderID, &userID, req.Color, req.Tags)
+			if err != nil {
+				return nil, err
+			}
+			// Return the complete note object
+			if note, err = tx.GetNote(ctx, noteID); err != nil {
+				return nil, err
+			}
+			if note.Tags, err = tx.ListTagsForNote(ctx, noteID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.NoteCreated, WorkspaceID: workspaceID, Data: note}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create note"})
+			return
+		}
+		s.indexNote(ctx, note.ID)
+
+		c.JSON(http.StatusCreated, note)
+	})
+
+	notesGroup.GET("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		var folderID *int
+		folderIDQuery := c.Query("folder_id")
+		if folderIDQuery != "" {
+			id, err := strconv.Atoi(folderIDQuery)
+			if err == nil {
+				folderID = &id
+			}
+		}
+
+		// Optional filters, sorting and pagination; without limit/cursor the
+		// whole listing is returned as a plain array like before
+		opts := db.NoteListOptions{
+			FolderID: folderID,
+			Tag:      c.Query("tag"),
+			Sort:     c.Query("sort"),
+			Desc:     c.Query("order") == "desc",
+			Cursor:   c.Query("cursor"),
+		}
+		if !db.IsValidNoteSort(opts.Sort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be created, updated, title or color"})
+			return
+		}
+		if order := c.Query("order"); order != "" && order != "asc" && order != "desc" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+			return
+		}
+		if v := c.Query("trashed"); v != "" {
+			trashed, err := strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid trashed filter"})
+				return
+			}
+			opts.Trashed = &trashed
+		}
+		if v := c.Query("created_by"); v != "" {
+			creatorID, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid created_by filter"})
+				return
+			}
+			opts.CreatedBy = &creatorID
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+				return
+			}
+			opts.Limit = limit
+			if maxLimit := getenvInt("NOTES_PAGE_MAX", 500); opts.Limit > maxLimit {
+				opts.Limit = maxLimit
+			}
+		}
+
+		page, err := s.Notes.ListNotesPage(c.Request.Context(), workspaceID, opts)
+		if errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notes"})
+			return
+		}
+
+		// Tags are already loaded by ListNotesPage using batch loading
+		var notes interface{} = page.Notes
+		if fields := c.Query("fields"); fields != "" {
+			projected, err := selectFields(page.Notes, strings.Split(fields, ","))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			notes = projected
+		}
+
+		if opts.Limit > 0 || opts.Cursor != "" {
+			c.JSON(http.StatusOK, gin.H{"notes": notes, "next_cursor": page.NextCursor})
+			return
+		}
+		c.JSON(http.StatusOK, notes)
+	})
+
+	notesGroup.PUT("/:note_id", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		userID := c.GetInt("user_id")
+
+		// Get current note to verify workspace membership
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+
+		// Verify user is member of source workspace
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), note.WorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of source workspace"})
+			return
+		}
+
+		// Use a custom struct that can distinguish between null and absent
+		var reqBody map[string]interface{}
+		if err := c.ShouldBindJSON(&reqBody); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// If moving to a different workspace, verify user is member there too
+		if newWorkspaceID, exists := reqBody["workspace_id"]; exists && newWorkspaceID != nil {
+			if wsID, ok := newWorkspaceID.(float64); ok && int(wsID) != note.WorkspaceID {
+				isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), int(wsID), userID)
+				if err != nil || !isMember {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of target workspace"})
+					return
+				}
+			}
+		}
+
+		updates := make(map[string]interface{})
+
+		// Check each field - if present in request, add to updates (even if null)
+		if title, exists := reqBody["title"]; exists {
+			updates["title"] = title
+		}
+		if folderID, exists := reqBody["folder_id"]; exists {
+			updates["folder_id"] = folderID // Will be nil if null in JSON
+		}
+		if workspaceID, exists := reqBody["workspace_id"]; exists {
+			if workspaceID != nil {
+				updates["workspace_id"] = workspaceID
+			}
+		}
+		if color, exists := reqBody["color"]; exists {
+			updates["color"] = color
+		}
+
+		// search_language: a config name sets a per-note override, null reverts to the workspace's
+		var searchLanguage *string
+		languageChanged := false
+		if lang, exists := reqBody["search_language"]; exists {
+			languageChanged = true
+			if lang != nil {
+				name, ok := lang.(string)
+				if !ok {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search language"})
+					return
+				}
+				valid, err := s.Languages.IsValidSearchLanguage(c.Request.Context(), name)
+				if err != nil || !valid {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown search language"})
+					return
+				}
+				searchLanguage = &name
+			}
+		}
+
+		ctx := c.Request.Context()
+		var updatedNote *db.Note
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.UpdateNoteMetadata(ctx, noteID, updates); err != nil {
+				return nil, err
+			}
+			if languageChanged {
+				if err := tx.SetNoteSearchLanguage(ctx, noteID, searchLanguage); err != nil {
+					return nil, err
+				}
+			}
+			// Return updated note
+			var err error
+			if updatedNote, err = tx.GetNote(ctx, noteID); err != nil {
+				return nil, err
+			}
+			if updatedNote.Tags, err = tx.ListTagsForNote(ctx, noteID); err != nil {
+				return nil, err
+			}
+			if updatedNote.WorkspaceID != note.WorkspaceID {
+				moved := gin.H{"note_id": noteID, "from_workspace_id": note.WorkspaceID, "to_workspace_id": updatedNote.WorkspaceID, "note": updatedNote}
+				return []events.Event{
+					{Type: events.NoteMoved, WorkspaceID: note.WorkspaceID, Data: moved},
+					{Type: events.NoteMoved, WorkspaceID: updatedNote.WorkspaceID, Data: moved},
+				}, nil
+			}
+			return []events.Event{{Type: events.NoteUpdated, WorkspaceID: updatedNote.WorkspaceID, Data: updatedNote}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+			return
+		}
+		s.indexNote(ctx, noteID)
+		// Attachment URLs name the workspace, so a moved note's must follow it
+		if updatedNote.WorkspaceID != note.WorkspaceID {
+			if err := s.refreshAttachmentLinks(ctx, updatedNote); err != nil {
+				log.Printf("[WARN] Pointing moved note %d at its attachments failed: %v", noteID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, updatedNote)
+	})
+
+	notesGroup.GET("/:note_id", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), note.WorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		tags, _ := s.Tags.ListTagsForNote(c.Request.Context(), noteID)
+		note.Tags = tags
+		c.JSON(http.StatusOK, note)
+	})
+
+	// Notes similar in content to this one, across the user's workspaces
+	notesGroup.GET("/:note_id/related", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), note.WorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		limit := 10
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+		if s.Semantic == nil {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "Semantic search is not enabled (SEMANTIC_SEARCH)"})
+			return
+		}
+		related, err := s.Semantic.Related(c.Request.Context(), userID, noteID, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find related notes"})
+			return
+		}
+		c.JSON(http.StatusOK, related)
+	})
+	notesGroup.DELETE("/:note_id", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), note.WorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.DeleteNote(c.Request.Context(), noteID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.NoteDeleted, WorkspaceID: note.WorkspaceID, Data: gin.H{"note_id": noteID}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+			return
+		}
+		s.removeFromIndex(c.Request.Context(), noteID)
+		c.JSON(http.StatusOK, gin.H{"message": "Note deleted permanently"})
+	})
+
+	// Update note searchable text
+	notesGroup.PUT("/:note_id/search-text", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		userID := c.GetInt("user_id")
+
+		// Get note to verify access
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+
+		// Verify user is member of workspace
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), note.WorkspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		var req struct {
+			ContentText string `json:"content_text"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// Every open editor saves the text after each edit, so only a change
+		// counts, and bodyEdits paces the events while someone types
+		ctx := c.Request.Context()
+		var changed bool
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			var err error
+			if changed, err = tx.UpdateNoteSearchText(ctx, noteID, req.ContentText); err != nil || !changed {
+				return nil, err
+			}
+			if !s.bodyEdits.edited(noteID, userID, s.announceBodyEdit) {
+				return nil, nil
+			}
+			return noteUpdated(ctx, tx, noteID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update search text"})
+			return
+		}
+		if changed {
+			s.indexNote(ctx, noteID)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Search text updated"})
+	})
+
+	// Note content as Markdown and as the underlying Quill Delta. Changes go
+	// through the document service so open editors receive them live.
+	notesGroup.GET("/:note_id/content", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		delta, err := s.Documents.Delta(c.Request.Context(), note.YjsRoomID)
+		if err != nil {
+			log.Printf("[WARN] Reading content of note %d failed: %v", noteID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Document service unavailable"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"markdown": quill.ToMarkdown(delta), "ops": delta.Ops})
+	})
+
+	notesGroup.PUT("/:note_id/content", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		// Exactly one of markdown or ops
+		var req struct {
+			Markdown *string    `json:"markdown"`
+			Ops      []quill.Op `json:"ops"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Markdown == nil) == (req.Ops == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either markdown or ops"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		delta := quill.Delta{Ops: req.Ops}
+		if req.Markdown != nil {
+			// Lines left unchanged keep formatting Markdown cannot express
+			current, err := s.Documents.Delta(ctx, note.YjsRoomID)
+			if err != nil {
+				log.Printf("[WARN] Reading content of note %d failed: %v", noteID, err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Document service unavailable"})
+				return
+			}
+			delta = quill.MergeMarkdown(current, *req.Markdown)
+		}
+		if err := s.Documents.SetDelta(ctx, note.YjsRoomID, delta); err != nil {
+			log.Printf("[WARN] Updating content of note %d failed: %v", noteID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Document service unavailable"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if _, err := tx.UpdateNoteSearchText(ctx, noteID, quill.PlainText(delta)); err != nil {
+				return nil, err
+			}
+			return noteUpdated(ctx, tx, noteID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update search text"})
+			return
+		}
+		s.indexNote(ctx, noteID)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Content updated"})
+	})
+}
+
+// noteUpdated returns the note.updated event for a note's current state
+func noteUpdated(ctx context.Context, tx TxStores, noteID int) ([]events.Event, error) {
+	note, err := tx.GetNote(ctx, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if note.Tags, err = tx.ListTagsForNote(ctx, noteID); err != nil {
+		return nil, err
+	}
+	return []events.Event{{Type: events.NoteUpdated, WorkspaceID: note.WorkspaceID, Data: note}}, nil
+}
+
+// bodyEditInterval is the shortest time between note.updated events for
+// edits to one note's body
+const bodyEditInterval = time.Minute
+
+// bodyEdits paces note.updated events for edits to note bodies. An edit is
+// announced at once unless one was in the last interval; the edits held
+// back are announced together when that interval ends.
+type bodyEdits struct {
+	interval time.Duration
+	mu       sync.Mutex
+	held     map[int]*heldEdits // by note, while an interval runs
+}
+
+type heldEdits struct {
+	actorID int // editor of the last edit held back, 0 if none
+}
+
+func newBodyEdits(interval time.Duration) *bodyEdits {
+	return &bodyEdits{interval: interval, held: map[int]*heldEdits{}}
+}
+
+// edited records an edit by actorID and reports whether to announce it now;
+// otherwise flush announces it when the interval ends
+func (b *bodyEdits) edited(noteID, actorID int, flush func(noteID, actorID int)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h, ok := b.held[noteID]; ok {
+		h.actorID = actorID
+		return false
+	}
+	h := &heldEdits{}
+	b.held[noteID] = h
+	time.AfterFunc(b.interval, func() {
+		b.mu.Lock()
+		delete(b.held, noteID)
+		actorID := h.actorID
+		b.mu.Unlock()
+		if actorID != 0 {
+			flush(noteID, actorID)
+		}
+	})
+	return true
+}
+
+// announceBodyEdit sends note.updated for edits bodyEdits held back. They
+// are lost if the process stops first; the text itself is saved.
+func (s *server) announceBodyEdit(noteID, actorID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := s.commit(ctx, actorID, func(tx TxStores) ([]events.Event, error) {
+		return noteUpdated(ctx, tx, noteID)
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[WARN] Announcing edits to note %d failed: %v", noteID, err)
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/apidoc"
+	"go-notes/backend/internal/archive"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/importer"
+	"go-notes/backend/internal/quill"
+	"go-notes/backend/internal/search"
+)
+
+// testRouter builds the router over a database that refuses connections, so
+// every request runs until its first query and gets a real response
+func testRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	database, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+	store := db.NewStore(database)
+	return NewRouter(Deps{Users: store, Workspaces: store, Folders: store, Notes: store, Tags: store, Transactions: Transactions(store.WithTx), SavedSearches: store, Sync: store, Webhooks: store, Languages: store, Fuzzy: store, DB: database, BasePath: "/"})
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(apidoc.Document())
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(loader.Context))
+	return doc
+}
+
+var (
+	ginParam  = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+	pathParam = regexp.MustCompile(`\{[A-Za-z_]+\}`)
+)
+
+// specPath converts a gin route (/notes/:note_id, /assets/*filepath) to an
+// OpenAPI path template
+func specPath(ginPath string) string {
+	return ginParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// anyMethod reports whether the path is registered with gin's Any and
+// documented once for every method
+func anyMethod(item *openapi3.PathItem) bool {
+	v, _ := item.Extensions["x-any-method"].(bool)
+	return v
+}
+
+func TestOpenAPIDescribesEveryRoute(t *testing.T) {
+	doc := loadSpec(t)
+	registered := map[string]bool{}
+	for _, route := range testRouter(t).Routes() {
+		// HEAD is served with GET for static files and implied by it
+		if route.Method == http.MethodHead {
+			continue
+		}
+		path := specPath(route.Path)
+		registered[route.Method+" "+path] = true
+
+		item := doc.Paths.Value(path)
+		if !assert.NotNil(t, item, "route %s %s is not in openapi.json", route.Method, route.Path) {
+			continue
+		}
+		if anyMethod(item) {
+			continue
+		}
+		assert.NotNil(t, item.GetOperation(route.Method), "route %s %s is not in openapi.json", route.Method, route.Path)
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, registered[method+" "+path], "openapi.json describes %s %s, which is not a route", method, path)
+		}
+	}
+}
+
+// TestResponsesMatchOpenAPI calls every route the way an anonymous client
+// would and checks the response against the documented status codes and
+// schemas. Without a database this covers authentication failures, request
+// validation and the public endpoints.
+func TestResponsesMatchOpenAPI(t *testing.T) {
+	doc := loadSpec(t)
+	r := testRouter(t)
+	paramValue := strings.NewReplacer("{filepath}", "missing.js", "{proxyPath}", "socket")
+
+	for _, route := range r.Routes() {
+		if route.Method == http.MethodHead {
+			continue
+		}
+		path := specPath(route.Path)
+		item := doc.Paths.Value(path)
+		require.NotNil(t, item, path)
+		// The Yjs proxy would dial the yjs service
+		if anyMethod(item) {
+			continue
+		}
+
+		target := pathParam.ReplaceAllString(paramValue.Replace(path), "1")
+		var body io.Reader
+		if route.Method == http.MethodPost || route.Method == http.MethodPut {
+			body = strings.NewReader("{}")
+		}
+		req := httptest.NewRequest(route.Method, target, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		t.Run(route.Method+" "+path, func(t *testing.T) {
+			validateResponse(t, doc, route.Method, path, req, w)
+		})
+	}
+
+	// The Swagger UI page itself, rather than a missing asset
+	req := httptest.NewRequest(http.MethodGet, "/docs/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "swagger-ui-bundle.js")
+	validateResponse(t, doc, http.MethodGet, "/docs/{filepath}", req, w)
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/swagger-ui-bundle.js", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func validateResponse(t *testing.T, doc *openapi3.T, method, path string, req *http.Request, w *httptest.ResponseRecorder) {
+	t.Helper()
+	item := doc.Paths.Value(path)
+	operation := item.GetOperation(method)
+	require.NotNil(t, operation)
+
+	contentType := w.Header().Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request: req,
+			Route:   &routers.Route{Spec: doc, Path: path, PathItem: item, Method: method, Operation: operation},
+		},
+		Status: w.Code,
+		Header: w.Header(),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			// Only JSON bodies have schemas worth checking
+			ExcludeResponseBody: mediaType != "application/json",
+		},
+	}
+	input.SetBodyBytes(w.Body.Bytes())
+	assert.NoError(t, openapi3filter.ValidateResponse(context.Background(), input), "body: %s", w.Body.String())
+
+	if response := operation.Responses.Status(w.Code); response != nil && len(response.Value.Content) > 0 {
+		assert.NotNil(t, response.Value.Content.Get(contentType), "%d response with undocumented content type %q", w.Code, contentType)
+	}
+}
+
+// TestModelsMatchOpenAPISchemas checks the JSON encoding of the types
+// handlers return against their schemas, so fields added on either side
+// without the other fail here
+func TestModelsMatchOpenAPISchemas(t *testing.T) {
+	doc := loadSpec(t)
+	folderID, creator, status := 3, 4, 200
+	width, height := 4032, 3024
+	trashedAt, responseBody, errMsg := "2025-01-02 10:00:00", "ok", "timeout"
+	now := time.Now().UTC()
+	note := db.Note{
+		ID: 1, WorkspaceID: 2, Title: "Title", YjsRoomID: "w2_n1", FolderID: &folderID, CreatedBy: &creator,
+		CreatedAt: "2025-01-01 10:00:00", UpdatedAt: "2025-01-01 10:00:00", IsTrashed: true, TrashedAt: &trashedAt,
+		Color: "#ffffff", SearchLanguage: "english", SearchLanguageInherited: true,
+		Tags: []db.Tag{{ID: 5, Name: "go"}},
+	}
+	bare := db.Note{ID: 1, WorkspaceID: 2, Title: "Untitled"}
+
+	cases := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"User", db.User{ID: 1, Username: "admin", IsAdmin: true, CreatedAt: "2025-01-01 10:00:00"}},
+		{"Workspace", db.Workspace{ID: 1, Name: "Personal", OwnerID: 1, CreatedAt: "2025-01-01", SearchLanguage: "simple"}},
+		{"WorkspaceMember", db.WorkspaceMember{WorkspaceID: 1, UserID: 2, Role: "member"}},
+		{"Folder", db.Folder{ID: 1, WorkspaceID: 1, Name: "Inbox", CreatedAt: "2025-01-01"}},
+		{"Folder", db.Folder{ID: 2, WorkspaceID: 1, ParentID: &folderID, Name: "Sub"}},
+		{"Tag", db.Tag{ID: 1, Name: "go"}},
+		{"Note", note},
+		{"Note", bare},
+		{"NoteProjection", map[string]interface{}{"id": 1, "title": "Title"}},
+		{"NoteContent", gin.H{"markdown": "# Hi\n", "ops": quill.FromMarkdown("# Hi\n![](a.png)\n").Ops}},
+		{"ScoredNote", db.ScoredNote{Note: note, Score: 0.42}},
+		{"Attachment", attachmentJSON{Attachment: db.Attachment{ID: 1, NoteID: 2, Filename: "photo.png", MimeType: "image/png", Size: 1024, Hash: strings.Repeat("ab", 32), Key: "k", Width: &width, Height: &height, CreatedBy: &creator, CreatedAt: "2025-01-01 10:00:00"}, URL: "/workspaces/1/notes/2/attachments/1?key=k", Widths: []int{320, 640, 1280, 2048}}},
+		{"Attachment", attachmentJSON{Attachment: db.Attachment{ID: 1, NoteID: 2}, Widths: []int{}}},
+		{"FuzzySearchResult", db.FuzzySearchResult{Notes: []db.ScoredNote{{Note: bare, Score: 0.3}}, DidYouMean: "golang", Suggestions: []string{"golang"}}},
+		{"FuzzySearchResult", db.FuzzySearchResult{Notes: []db.ScoredNote{}, Suggestions: []string{}}},
+		{"SearchResponse", search.Response{Notes: []db.Note{note}, Total: 1, Facets: search.Facets{
+			Tags: []search.FacetCount{{Name: "go", Count: 1}}, Workspaces: []search.FacetCount{{ID: 2, Name: "Work", Count: 1}},
+			Authors: []search.FacetCount{{ID: 4, Name: "bob", Count: 1}},
+		}}},
+		{"MigrationStatus", db.MigrationStatus{Version: 19, Dirty: true, Latest: 20, Pending: true}},
+		{"SavedSearch", db.SavedSearch{ID: 1, OwnerID: 1, WorkspaceID: &folderID, Name: "Go", Query: "tag:go", Mode: "metadata"}},
+		{"SavedSearchCount", db.SavedSearchCount{ID: 1, Name: "Go", Count: 3}},
+		{"SyncChanges", db.SyncChanges{
+			Cursor: "1234", Full: false,
+			Workspaces: []db.Workspace{{ID: 2, Name: "Work"}}, Members: []db.WorkspaceMember{{WorkspaceID: 2, UserID: 1, Role: "owner"}},
+			Folders: []db.Folder{{ID: 3, WorkspaceID: 2}}, Notes: []db.Note{note},
+			Tags: []db.SyncTag{{WorkspaceID: 2, Tag: db.Tag{ID: 5, Name: "go"}}},
+			Deleted: db.SyncDeleted{
+				Notes: []int{9}, Folders: []int{}, Tags: []db.SyncRef{{WorkspaceID: 2, ID: 6}},
+				Members: []db.WorkspaceMember{}, Workspaces: []int{7},
+			},
+		}},
+		{"Webhook", db.Webhook{ID: 1, WorkspaceID: 2, URL: "https://example.com/hook", Secret: "s3cret", EventTypes: []string{"note.created"}, Active: true, CreatedBy: &creator}},
+		{"Webhook", db.Webhook{ID: 1, WorkspaceID: 2, URL: "https://example.com/hook", EventTypes: []string{}}},
+		{"WebhookDelivery", db.WebhookDelivery{ID: 1, WebhookID: 1, EventType: "ping", Status: "pending", Attempts: 1, NextAttemptAt: &now, LastAttemptAt: &now, Error: &errMsg, CreatedAt: now}},
+		{"WebhookDelivery", db.WebhookDelivery{ID: 2, WebhookID: 1, EventType: "note.created", Status: "delivered", Attempts: 1, ResponseStatus: &status, ResponseBody: &responseBody, CreatedAt: now, DeliveredAt: &now}},
+		{"Event", events.Event{Type: events.NoteCreated, WorkspaceID: 2, ActorID: 1, Data: note, At: now}},
+		{"Event", events.Event{Type: events.Resync, WorkspaceID: 2, At: now}},
+		{"ExportJob", archive.Job{ID: "ab12", WorkspaceID: 2, UserID: 1, Status: archive.JobRunning, CreatedAt: "2025-01-01T10:00:00Z"}},
+		{"ImportReport", archive.Report{Workspace: "Work", Folders: 2, Notes: 3, Trashed: 1, Tags: []string{"go"}, Warnings: []string{}, Errors: []string{}}},
+		{"WorkspaceImported", gin.H{
+			"workspace_id": 9, "name": "Work", "folders": map[int]int{3: 10},
+			"notes":  []db.ImportedNote{{Key: 1, ID: 11, YjsRoomID: "w9_n11"}},
+			"report": archive.Report{Workspace: "Work", Tags: []string{}, Warnings: []string{}, Errors: []string{}},
+		}},
+		{"NotesImported", importer.Result{Folders: 1, Notes: []importer.Imported{{ID: 4, Title: "Home", Source: "Vault/Home.md", Warnings: []string{"the image a.png was not imported"}}}, Warnings: []string{}}},
+		{"ExportJob", archive.Job{ID: "ab12", WorkspaceID: 2, UserID: 1, Status: archive.JobDone, Size: 2048, CreatedAt: "2025-01-01T10:00:00Z", FinishedAt: "2025-01-01T10:01:00Z"}},
+	}
+	for _, tc := range cases {
+		schema := doc.Components.Schemas[tc.schema]
+		require.NotNil(t, schema, tc.schema)
+		encoded, err := json.Marshal(tc.value)
+		require.NoError(t, err)
+		var value interface{}
+		require.NoError(t, json.NewDecoder(bytes.NewReader(encoded)).Decode(&value))
+		assert.NoError(t, schema.Value.VisitJSON(value, openapi3.EnableJSONSchema2020()), "%s: %s", tc.schema, encoded)
+	}
+
+	for _, eventType := range events.Types {
+		assert.NoError(t, doc.Components.Schemas["EventType"].Value.VisitJSON(eventType, openapi3.EnableJSONSchema2020()))
+	}
+}
+
+func TestServedSpecUsesBasePath(t *testing.T) {
+	served, err := apidoc.Spec("/notes")
+	require.NoError(t, err)
+	var doc struct {
+		OpenAPI string              `json:"openapi"`
+		Servers []map[string]string `json:"servers"`
+	}
+	require.NoError(t, json.Unmarshal(served, &doc))
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.Equal(t, []map[string]string{{"url": "/notes"}}, doc.Servers)
+}
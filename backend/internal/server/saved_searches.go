@@ -0,0 +1,174 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/auth"
+)
+
+func (s *server) savedSearchRoutes(api *gin.RouterGroup) {
+	// --- Saved Searches (Smart Folders) ---
+	savedSearchGroup := api.Group("/saved-searches")
+	savedSearchGroup.Use(auth.AuthRequired(s.Users))
+
+	type savedSearchRequest struct {
+		Name        string `json:"name"`
+		Query       string `json:"query"`
+		Mode        string `json:"mode"`
+		WorkspaceID *int   `json:"workspace_id"`
+	}
+
+	// validateSavedSearch normalises the mode and checks access to a shared workspace
+	validateSavedSearch := func(c *gin.Context, req *savedSearchRequest) bool {
+		if req.Name == "" || req.Query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name and query required"})
+			return false
+		}
+		if req.Mode == "" {
+			req.Mode = "metadata"
+		}
+		if req.Mode != "metadata" && req.Mode != "full" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be metadata or full"})
+			return false
+		}
+		if req.WorkspaceID != nil {
+			isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), *req.WorkspaceID, c.GetInt("user_id"))
+			if err != nil || !isMember {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of target workspace"})
+				return false
+			}
+		}
+		return true
+	}
+
+	savedSearchGroup.GET("", func(c *gin.Context) {
+		searches, err := s.SavedSearches.ListSavedSearches(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list saved searches"})
+			return
+		}
+		c.JSON(http.StatusOK, searches)
+	})
+
+	savedSearchGroup.POST("", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		var req savedSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if !validateSavedSearch(c, &req) {
+			return
+		}
+		id, err := s.SavedSearches.CreateSavedSearch(c.Request.Context(), userID, req.WorkspaceID, req.Name, req.Query, req.Mode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create saved search"})
+			return
+		}
+		search, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Created saved search but failed to retrieve"})
+			return
+		}
+		c.JSON(http.StatusCreated, search)
+	})
+
+	// Live note counts for every visible smart folder
+	savedSearchGroup.GET("/counts", func(c *gin.Context) {
+		counts, err := s.SavedSearches.CountSavedSearches(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count saved searches"})
+			return
+		}
+		c.JSON(http.StatusOK, counts)
+	})
+
+	savedSearchGroup.GET("/:search_id", func(c *gin.Context) {
+		searchID, _ := strconv.Atoi(c.Param("search_id"))
+		search, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), searchID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+			return
+		}
+		canView, err := s.SavedSearches.CanViewSavedSearch(c.Request.Context(), search, c.GetInt("user_id"))
+		if err != nil || !canView {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.JSON(http.StatusOK, search)
+	})
+
+	savedSearchGroup.PUT("/:search_id", func(c *gin.Context) {
+		searchID, _ := strconv.Atoi(c.Param("search_id"))
+		search, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), searchID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+			return
+		}
+		if search.OwnerID != c.GetInt("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can update saved search"})
+			return
+		}
+		var req savedSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if !validateSavedSearch(c, &req) {
+			return
+		}
+		if err := s.SavedSearches.UpdateSavedSearch(c.Request.Context(), searchID, req.WorkspaceID, req.Name, req.Query, req.Mode); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update saved search"})
+			return
+		}
+		updated, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), searchID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Updated but failed to retrieve saved search"})
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	})
+
+	savedSearchGroup.DELETE("/:search_id", func(c *gin.Context) {
+		searchID, _ := strconv.Atoi(c.Param("search_id"))
+		search, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), searchID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+			return
+		}
+		if search.OwnerID != c.GetInt("user_id") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can delete saved search"})
+			return
+		}
+		if err := s.SavedSearches.DeleteSavedSearch(c.Request.Context(), searchID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete saved search"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Saved search deleted"})
+	})
+
+	// Smart folder contents: same shape as the workspace notes listing, evaluated on every request
+	savedSearchGroup.GET("/:search_id/notes", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		searchID, _ := strconv.Atoi(c.Param("search_id"))
+		search, err := s.SavedSearches.GetSavedSearch(c.Request.Context(), searchID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved search not found"})
+			return
+		}
+		canView, err := s.SavedSearches.CanViewSavedSearch(c.Request.Context(), search, userID)
+		if err != nil || !canView {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		notes, err := s.SavedSearches.SavedSearchNotes(c.Request.Context(), search, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate saved search"})
+			return
+		}
+		c.JSON(http.StatusOK, notes)
+	})
+}
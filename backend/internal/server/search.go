@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/auth"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/search"
+)
+
+// searchRoutes registers search, index maintenance and offline sync
+func (s *server) searchRoutes(api *gin.RouterGroup) {
+	// Search notes endpoint
+	api.GET("/search", auth.AuthRequired(s.Users), func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		query := c.Query("q")
+		mode := c.DefaultQuery("mode", "metadata") // "metadata", "full", "fuzzy" or "semantic"
+
+		if mode == "semantic" {
+			if s.unsupported(c) {
+				return
+			}
+			if s.Semantic == nil {
+				c.JSON(http.StatusNotImplemented, gin.H{"error": "Semantic search is not enabled (SEMANTIC_SEARCH)"})
+				return
+			}
+		}
+
+		if mode == "fuzzy" {
+			// Typo-tolerant search ranked by trigram similarity, with "did you mean" suggestions
+			limit := getenvInt("SEARCH_FUZZY_LIMIT", 50)
+			if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l < limit {
+				limit = l
+			}
+			result, err := s.Fuzzy.SearchNotesFuzzy(c.Request.Context(), userID, query, limit)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+			return
+		}
+
+		if query == "" {
+			c.JSON(http.StatusOK, []db.Note{})
+			return
+		}
+
+		if mode == "semantic" {
+			// Notes ranked by TF-IDF similarity to the query text, with scores
+			limit := 20
+			if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 100 {
+				limit = l
+			}
+			notes, err := s.Semantic.Search(c.Request.Context(), search.Request{UserID: userID, Query: query, Limit: limit})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+				return
+			}
+			c.JSON(http.StatusOK, notes)
+			return
+		}
+
+		if mode != "metadata" && mode != "full" {
+			mode = "metadata"
+		}
+
+		limit := 0
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		result, err := s.Search.Search(c.Request.Context(), search.Request{UserID: userID, Query: query, Mode: mode, Limit: limit})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+			return
+		}
+
+		// facets=true returns {notes, total, facets}; otherwise the plain note array
+		if c.Query("facets") == "true" {
+			c.JSON(http.StatusOK, result)
+			return
+		}
+		c.JSON(http.StatusOK, result.Notes)
+	})
+
+	// Rebuild the search index (admin only)
+	api.POST("/admin/search/reindex", auth.AuthRequired(s.Users), func(c *gin.Context) {
+		if !c.GetBool("is_admin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin only"})
+			return
+		}
+		count, err := s.Search.Reindex(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Reindex failed"})
+			return
+		}
+		if s.Semantic != nil {
+			if _, err := s.Semantic.Reindex(c.Request.Context()); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Semantic reindex failed"})
+				return
+			}
+		}
+		// The other replicas rebuild the indexes they keep themselves
+		if s.Events != nil {
+			if err := s.Events.PublishIndex(events.IndexChange{Kind: events.IndexAll}); err != nil {
+				log.Printf("[WARN] Publishing index rebuild failed: %v", err)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Search index rebuilt", "backend": s.Search.Name(), "notes": count})
+	})
+
+	// Delta sync for offline clients: everything that changed since a cursor,
+	// with tombstones for deletes. Omit since for a full sync.
+	api.GET("/sync", auth.AuthRequired(s.Users), func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		changes, err := s.Sync.GetSyncChanges(c.Request.Context(), userID, c.Query("since"))
+		if errors.Is(err, db.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		if errors.Is(err, db.ErrSyncCursorExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": "Cursor expired, sync again without since"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Sync failed"})
+			return
+		}
+		c.JSON(http.StatusOK, changes)
+	})
+
+	// List available full-text search languages
+	api.GET("/search/languages", auth.AuthRequired(s.Users), func(c *gin.Context) {
+		languages, err := s.Languages.ListSearchLanguages(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list search languages"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"default": db.DefaultSearchLanguage, "languages": languages})
+	})
+}
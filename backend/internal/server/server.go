@@ -0,0 +1,306 @@
+// Package server holds the HTTP API: routing, middleware and handlers
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	mgin "github.com/ulule/limiter/v3/drivers/middleware/gin"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+
+	"go-notes/backend/internal/apidoc"
+	"go-notes/backend/internal/archive"
+	"go-notes/backend/internal/auth"
+	"go-notes/backend/internal/blob"
+	"go-notes/backend/internal/collab"
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/search"
+	"go-notes/backend/internal/webhooks"
+)
+
+// Deps are the services the routes use. The five stores are required, and
+// Transactions, which makes changes through the same database; attachment
+// routes also need Attachments and Blobs, and saved searches, sync,
+// webhooks, search languages and fuzzy search their own stores.
+//
+// DB backs the readiness probe and migration status. With Driver set to
+// db.DriverSQLite those use the SQLite database, and the features that need
+// PostgreSQL answer 501. The other services may be left nil by tests that
+// do not exercise them; publishing events, waking the webhook dispatcher
+// and index maintenance are then skipped.
+type Deps struct {
+	Users      UserStore
+	Workspaces WorkspaceStore
+	Folders    FolderStore
+	Notes      NoteStore
+	Tags       TagStore
+
+	// Transactions makes a change together with queueing its webhooks
+	Transactions Transactor
+
+	Attachments AttachmentStore
+	Blobs       blob.Store // attachment content
+
+	SavedSearches SavedSearchStore
+	Sync          SyncStore
+	Webhooks      WebhookStore
+	Languages     SearchLanguageStore
+	Fuzzy         FuzzySearcher
+
+	DB         *sql.DB
+	Driver     string // db.DriverPostgres (the default when empty) or db.DriverSQLite
+	Search     search.Backend
+	Semantic   *search.Semantic
+	Events     *events.Broker
+	Dispatcher *webhooks.Dispatcher // delivers queued webhooks
+	Documents  *collab.Client
+	Exports    *archive.Jobs // background workspace exports
+
+	// BasePath is the prefix of every route, "/" or e.g. "/notes"
+	BasePath string
+}
+
+type server struct {
+	Deps
+	bodyEdits *bodyEdits
+}
+
+// NewRouter registers every route. The services are created by the caller;
+// routes only use them while handling requests, so tests can build the
+// router without them to inspect or exercise the routing table.
+func NewRouter(deps Deps) *gin.Engine {
+	s := &server{Deps: deps, bodyEdits: newBodyEdits(bodyEditInterval)}
+
+	r := gin.Default()
+	r.Use(cors.New(corsConfig()))
+	r.Use(requestTimeout(time.Duration(getenvInt("REQUEST_TIMEOUT_SECONDS", 30)) * time.Second))
+
+	api := r.Group(s.BasePath)
+
+	// Setup rate limiting
+	rateStore := memory.NewStore()
+
+	// General rate limit: 60 requests per minute
+	generalRate := limiter.Rate{
+		Period: 1 * time.Minute,
+		Limit:  60,
+	}
+	generalMiddleware := mgin.NewMiddleware(limiter.New(rateStore, generalRate))
+
+	// Strict rate limit for auth: 5 requests per minute
+	authRate := limiter.Rate{
+		Period: 1 * time.Minute,
+		Limit:  5,
+	}
+	authMiddleware := mgin.NewMiddleware(limiter.New(rateStore, authRate))
+
+	s.healthRoutes(api)
+
+	// OpenAPI document and Swagger UI
+	if err := apidoc.Register(api, s.BasePath); err != nil {
+		log.Fatalf("OpenAPI document init failed: %v", err)
+	}
+
+	s.authRoutes(api, authMiddleware)
+	s.userRoutes(api, generalMiddleware)
+
+	// --- Workspace CRUD & Sharing ---
+	workspaceGroup := api.Group("/workspaces")
+	workspaceGroup.Use(auth.AuthRequired(s.Users))
+	s.workspaceRoutes(workspaceGroup)
+	s.webhookRoutes(workspaceGroup)
+	s.trashRoutes(workspaceGroup)
+	s.folderRoutes(workspaceGroup)
+	s.noteRoutes(workspaceGroup)
+	s.exportRoutes(workspaceGroup)
+	s.importRoutes(workspaceGroup)
+	s.attachmentRoutes(api, workspaceGroup)
+	s.tagRoutes(api, workspaceGroup)
+
+	s.searchRoutes(api)
+	s.savedSearchRoutes(api)
+	s.frontendRoutes(r, api)
+	return r
+}
+
+func corsConfig() cors.Config {
+	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
+	if allowedOrigins == "" {
+		// Default: allow from same origin (use PORT and API_BASE_PATH from env)
+		defaultPort := os.Getenv("PORT")
+		if defaultPort == "" {
+			defaultPort = "8080"
+		}
+		allowedOrigins = fmt.Sprintf("http://localhost:%s,http://127.0.0.1:%s", defaultPort, defaultPort)
+	}
+
+	origins := []string{}
+	if allowedOrigins != "*" {
+		origins = strings.Split(allowedOrigins, ",")
+		// Trim whitespace from each origin
+		for i := range origins {
+			origins[i] = strings.TrimSpace(origins[i])
+		}
+	} else {
+		origins = []string{"*"}
+	}
+
+	return cors.Config{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: allowedOrigins != "*", // Only allow credentials if not wildcard
+		MaxAge:           12 * time.Hour,
+	}
+}
+
+// requestTimeout bounds each request with a deadline on its context, which
+// the store's queries and document service calls honour. Event streams,
+// WebSocket upgrades, the collaboration proxy, export downloads, imports and
+// attachment transfers are long-lived and exempt.
+func requestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if timeout <= 0 || c.GetHeader("Upgrade") != "" || strings.HasSuffix(path, "/events") || strings.Contains(path, "/yjs") ||
+			strings.HasSuffix(path, "/export") || strings.HasSuffix(path, "/download") || strings.Contains(path, "/import") || strings.Contains(path, "/attachments") {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// change runs fn in a transaction and announces the events it returns:
+// their webhooks are queued in the transaction, so a change that rolls
+// back queues none and one that commits cannot lose them, and clients
+// watching the workspace are told once it has committed
+func (s *server) change(c *gin.Context, fn func(tx TxStores) ([]events.Event, error)) error {
+	return s.commit(c.Request.Context(), c.GetInt("user_id"), fn)
+}
+
+// commit is change outside a request, for events a user caused earlier
+func (s *server) commit(ctx context.Context, actorID int, fn func(tx TxStores) ([]events.Event, error)) error {
+	var committed []events.Event
+	err := s.Transactions.InTx(ctx, func(tx TxStores) error {
+		evs, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		for i := range evs {
+			if !evs[i].At.IsZero() {
+				continue // queued by fn with queueEvent
+			}
+			if evs[i], err = queueEvent(ctx, tx, actorID, evs[i]); err != nil {
+				return err
+			}
+		}
+		committed = evs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if s.Events != nil {
+		for _, e := range committed {
+			if err := s.Events.Publish(e); err != nil {
+				log.Printf("[WARN] Publishing %s event failed: %v", e.Type, err)
+			}
+		}
+	}
+	if len(committed) > 0 {
+		s.wakeWebhooks()
+	}
+	return nil
+}
+
+// queueEvent stamps e with the actor and time and queues its webhooks. fn
+// of change calls it itself, before returning e, when what it does next
+// would take the webhooks with it.
+func queueEvent(ctx context.Context, tx TxStores, actorID int, e events.Event) (events.Event, error) {
+	e.ActorID = actorID
+	e.At = time.Now().UTC()
+	if err := webhooks.Enqueue(ctx, tx, e); err != nil {
+		return e, fmt.Errorf("queue %s webhooks: %w", e.Type, err)
+	}
+	return e, nil
+}
+
+func (s *server) sqlite() bool {
+	return s.Driver == db.DriverSQLite
+}
+
+// unsupported answers 501 and returns true for a feature that needs
+// PostgreSQL when the data lives in SQLite
+func (s *server) unsupported(c *gin.Context) bool {
+	if !s.sqlite() {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": "Not supported with the SQLite database"})
+	return true
+}
+
+func (s *server) wakeWebhooks() {
+	if s.Dispatcher != nil {
+		s.Dispatcher.Wake()
+	}
+}
+
+// updateIndexes applies an index change to this replica's indexes and
+// announces it to the other replicas, whose embedded and semantic indexes
+// follow the broker (search.Follow). It runs after the database change has
+// committed; a failure only leaves search results stale, so it is logged
+// rather than returned.
+func (s *server) updateIndexes(ctx context.Context, c events.IndexChange) {
+	var indexes []search.Index
+	if s.Search != nil {
+		indexes = append(indexes, s.Search)
+	}
+	if s.Semantic != nil {
+		indexes = append(indexes, s.Semantic)
+	}
+	search.Apply(ctx, c, indexes...)
+	if s.Events != nil {
+		if err := s.Events.PublishIndex(c); err != nil {
+			log.Printf("[WARN] Publishing index change (%s) failed: %v", c.Kind, err)
+		}
+	}
+}
+
+func (s *server) indexNote(ctx context.Context, noteID int) {
+	s.updateIndexes(ctx, events.IndexChange{Kind: events.IndexNote, NoteID: noteID})
+}
+
+func (s *server) reindexWorkspace(ctx context.Context, workspaceID int) {
+	s.updateIndexes(ctx, events.IndexChange{Kind: events.IndexWorkspace, WorkspaceID: workspaceID})
+}
+
+func (s *server) removeFromIndex(ctx context.Context, noteID int) {
+	s.updateIndexes(ctx, events.IndexChange{Kind: events.IndexRemove, NoteID: noteID})
+}
+
+func getenvInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return def
+	}
+	return i
+}
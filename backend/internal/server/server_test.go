@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(requestTimeout(time.Minute))
+	deadline := func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	}
+	r.GET("/notes", deadline)
+	r.GET("/workspaces/:id/events", deadline)
+
+	for path, want := range map[string]string{"/notes": `{"deadline":true}`, "/workspaces/1/events": `{"deadline":false}`} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, want, w.Body.String(), path)
+	}
+}
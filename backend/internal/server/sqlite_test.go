@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/search"
+	"go-notes/backend/internal/sqlitestore"
+)
+
+var (
+	_ UserStore           = (*sqlitestore.Store)(nil)
+	_ WorkspaceStore      = (*sqlitestore.Store)(nil)
+	_ AdminStore          = (*sqlitestore.Store)(nil)
+	_ FolderStore         = (*sqlitestore.Store)(nil)
+	_ NoteStore           = (*sqlitestore.Store)(nil)
+	_ TagStore            = (*sqlitestore.Store)(nil)
+	_ AttachmentStore     = (*sqlitestore.Store)(nil)
+	_ SavedSearchStore    = (*sqlitestore.Store)(nil)
+	_ SyncStore           = (*sqlitestore.Store)(nil)
+	_ WebhookStore        = (*sqlitestore.Store)(nil)
+	_ SearchLanguageStore = (*sqlitestore.Store)(nil)
+	_ FuzzySearcher       = (*sqlitestore.Store)(nil)
+	_ TxStores            = (*sqlitestore.Store)(nil)
+)
+
+// TestSQLiteDeployment runs the API the way serve wires it for DB_DRIVER=sqlite
+func TestSQLiteDeployment(t *testing.T) {
+	t.Setenv("DB_DRIVER", db.DriverSQLite)
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "notes.db"))
+	t.Setenv("YJS_HTTP_URL", "http://127.0.0.1:1") // intro note stays empty
+	require.NoError(t, db.RunMigrations())
+	database, err := db.Connect()
+	require.NoError(t, err)
+	defer database.Close()
+
+	gin.SetMode(gin.TestMode)
+	store := sqlitestore.New(database)
+	broker := events.NewLocalBroker()
+	defer broker.Close()
+	backend, err := search.New(database)
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite", backend.Name())
+	ts := &testServer{t: t, router: NewRouter(Deps{
+		Users: store, Workspaces: store, Folders: store, Notes: store, Tags: store, Transactions: Transactions(store.WithTx),
+		SavedSearches: store, Sync: store, Webhooks: store, Languages: store, Fuzzy: store,
+		DB: database, Driver: db.DriverSQLite, Search: backend, Events: broker, BasePath: "/",
+	})}
+
+	ts.call("POST", "/setup", "", gin.H{"username": "root", "password": "secret"}, http.StatusOK, nil)
+	var login struct {
+		Token string
+		User  struct{ ID int }
+	}
+	ts.call("POST", "/login", "", gin.H{"username": "root", "password": "secret"}, http.StatusOK, &login)
+	token := login.Token
+
+	var workspaces []db.Workspace
+	ts.call("GET", "/workspaces", token, nil, http.StatusOK, &workspaces)
+	require.Len(t, workspaces, 1)
+	wsPath := fmt.Sprintf("/workspaces/%d", workspaces[0].ID)
+
+	var changes db.SyncChanges
+	ts.call("GET", "/sync", token, nil, http.StatusOK, &changes)
+	assert.True(t, changes.Full)
+	cursor := changes.Cursor
+	var hook db.Webhook
+	ts.call("POST", wsPath+"/webhooks", token, gin.H{"url": "https://203.0.113.5/hook", "event_types": []string{"note.created"}}, http.StatusCreated, &hook)
+
+	sub := broker.Subscribe(workspaces[0].ID, login.User.ID)
+	var folder db.Folder
+	ts.call("POST", wsPath+"/folders", token, gin.H{"name": "Kitchen"}, http.StatusCreated, &folder)
+	assert.Equal(t, events.FolderCreated, (<-sub.C).Type, "events are delivered in-process")
+	broker.Unsubscribe(sub)
+
+	var note db.Note
+	ts.call("POST", wsPath+"/notes", token, gin.H{"title": "Bread", "folder_id": folder.ID, "tags": []string{"baking"}}, http.StatusCreated, &note)
+	assert.Equal(t, fmt.Sprintf("w%d_n%d", workspaces[0].ID, note.ID), note.YjsRoomID)
+	ts.call("PUT", fmt.Sprintf("%s/notes/%d/search-text", wsPath, note.ID), token, gin.H{"content_text": "Knead the dough for ten minutes"}, http.StatusOK, nil)
+
+	var found []db.Note
+	ts.call("GET", "/search?mode=full&q=kneading", token, nil, http.StatusOK, &found)
+	require.Len(t, found, 1)
+	assert.Equal(t, note.ID, found[0].ID)
+	var fuzzy db.FuzzySearchResult
+	ts.call("GET", "/search?mode=fuzzy&q=bred", token, nil, http.StatusOK, &fuzzy)
+	require.Len(t, fuzzy.Notes, 1)
+	assert.Equal(t, "bread", fuzzy.DidYouMean)
+
+	var languages struct{ Languages []string }
+	ts.call("GET", "/search/languages", token, nil, http.StatusOK, &languages)
+	assert.Equal(t, []string{"english", "simple"}, languages.Languages)
+	ts.call("PUT", wsPath+"/search-language", token, gin.H{"language": "german"}, http.StatusBadRequest, nil)
+	ts.call("PUT", fmt.Sprintf("%s/notes/%d", wsPath, note.ID), token, gin.H{"search_language": "simple"}, http.StatusOK, nil)
+	ts.call("GET", "/search?mode=full&q=kneading", token, nil, http.StatusOK, &found)
+	assert.Empty(t, found, "no stemming in the simple index")
+
+	var saved db.SavedSearch
+	ts.call("POST", "/saved-searches", token, gin.H{"name": "Baking", "query": "tag:baking"}, http.StatusCreated, &saved)
+	ts.call("GET", fmt.Sprintf("/saved-searches/%d/notes", saved.ID), token, nil, http.StatusOK, &found)
+	require.Len(t, found, 1)
+
+	var deliveries []db.WebhookDelivery
+	ts.call("GET", fmt.Sprintf("%s/webhooks/%d/deliveries", wsPath, hook.ID), token, nil, http.StatusOK, &deliveries)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "note.created", deliveries[0].EventType)
+
+	ts.call("GET", "/sync?since="+cursor, token, nil, http.StatusOK, &changes)
+	require.Len(t, changes.Notes, 1)
+	assert.Equal(t, note.ID, changes.Notes[0].ID)
+	assert.Equal(t, "simple", changes.Notes[0].SearchLanguage)
+	require.Len(t, changes.Folders, 1)
+	var faceted search.Response
+	ts.call("GET", "/search?q=tag:baking&facets=true", token, nil, http.StatusOK, &faceted)
+	assert.Equal(t, 1, faceted.Total)
+	assert.Equal(t, "root", faceted.Facets.Authors[0].Name)
+
+	ts.call("POST", "/admin/search/reindex", token, nil, http.StatusOK, nil)
+	ts.call("GET", "/health/ready", "", nil, http.StatusOK, nil)
+	var status db.MigrationStatus
+	ts.call("GET", "/admin/migrations", token, nil, http.StatusOK, &status)
+	assert.False(t, status.Pending)
+
+	// Deleting the folder trashes its notes
+	ts.call("DELETE", fmt.Sprintf("%s/folders/%d", wsPath, folder.ID), token, nil, http.StatusOK, nil)
+	var trashed []db.Note
+	ts.call("GET", wsPath+"/trash", token, nil, http.StatusOK, &trashed)
+	require.Len(t, trashed, 1)
+	assert.Equal(t, note.ID, trashed[0].ID)
+
+	ts.call("GET", "/sync?since="+changes.Cursor, token, nil, http.StatusOK, &changes)
+	assert.Equal(t, []int{folder.ID}, changes.Deleted.Folders)
+
+	// Semantic search reads notes through the PostgreSQL store and answers 501
+	ts.call("GET", "/search?mode=semantic&q=bread", token, nil, http.StatusNotImplemented, nil)
+}
+
+// TestChangeQueuesWebhooksWithIt checks that a change and the webhooks
+// announcing it commit or roll back together
+func TestChangeQueuesWebhooksWithIt(t *testing.T) {
+	t.Setenv("DB_DRIVER", db.DriverSQLite)
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "notes.db"))
+	t.Setenv("YJS_HTTP_URL", "http://127.0.0.1:1")
+	require.NoError(t, db.RunMigrations())
+	database, err := db.Connect()
+	require.NoError(t, err)
+	defer database.Close()
+
+	ctx := context.Background()
+	store := sqlitestore.New(database)
+	require.NoError(t, store.CreateUser(ctx, "ann", "hash", false))
+	user, err := store.GetUserByUsername(ctx, "ann")
+	require.NoError(t, err)
+	workspaces, err := store.ListWorkspaces(ctx, user.ID)
+	require.NoError(t, err)
+	wsID := workspaces[0].ID
+	hookID, err := store.CreateWebhook(ctx, wsID, "https://203.0.113.5/hook", "secret", nil, true, user.ID)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	s := &server{Deps: Deps{Transactions: Transactions(store.WithTx)}}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", nil)
+	c.Set("user_id", user.ID)
+	createFolder := func(name string, data any, failure error) error {
+		return s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if _, err := tx.CreateFolder(ctx, wsID, name, nil); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.FolderCreated, WorkspaceID: wsID, Data: data}}, failure
+		})
+	}
+
+	// A change that fails queues nothing
+	failure := errors.New("boom")
+	assert.ErrorIs(t, createFolder("Failed", nil, failure), failure)
+	// A webhook that cannot be queued undoes the change
+	assert.Error(t, createFolder("Unannounced", make(chan int), nil))
+	require.NoError(t, createFolder("Committed", nil, nil))
+
+	folders, err := store.ListFolders(ctx, wsID)
+	require.NoError(t, err)
+	require.Len(t, folders, 1)
+	assert.Equal(t, "Committed", folders[0].Name)
+	deliveries, err := store.ListWebhookDeliveries(ctx, hookID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, events.FolderCreated, deliveries[0].EventType)
+	assert.Contains(t, string(deliveries[0].Payload), fmt.Sprintf(`"actor_id":%d`, user.ID))
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/webhooks"
+)
+
+// The handlers reach the data only through these interfaces. *db.Store
+// implements all of them against PostgreSQL; internal/memstore implements
+// them in memory for handler tests.
+
+// UserStore manages accounts
+type UserStore interface {
+	GetUserCount(ctx context.Context) (int, error)
+	CreateAdmin(ctx context.Context, username, passwordHash string) error
+	// CreateUser also creates the user's default workspace
+	CreateUser(ctx context.Context, username, passwordHash string, isAdmin bool) error
+	GetUserByID(ctx context.Context, id int) (*db.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*db.User, error)
+	IsActiveUser(ctx context.Context, id int) (bool, error)
+	ListUsers(ctx context.Context) ([]db.User, error)
+	UpdateUser(ctx context.Context, id int, username, passwordHash string) error
+	DeleteUser(ctx context.Context, id int) error
+}
+
+// WorkspaceStore manages workspaces and their members
+type WorkspaceStore interface {
+	// CreateWorkspace also adds the owner as a member
+	CreateWorkspace(ctx context.Context, name string, ownerID int) (int, error)
+	ListWorkspaces(ctx context.Context, userID int) ([]db.Workspace, error)
+	UpdateWorkspace(ctx context.Context, id int, name string) error
+	DeleteWorkspace(ctx context.Context, id int) error
+	ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]db.WorkspaceMember, error)
+	AddWorkspaceMember(ctx context.Context, workspaceID, userID int, role string) error
+	RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error
+	TransferWorkspaceOwnership(ctx context.Context, workspaceID, newOwnerID int) error
+	IsWorkspaceOwner(ctx context.Context, workspaceID, userID int) (bool, error)
+	IsWorkspaceMember(ctx context.Context, workspaceID, userID int) (bool, error)
+	// ImportWorkspace creates a workspace with its folders, notes, tags and
+	// document content in one transaction
+	ImportWorkspace(ctx context.Context, ownerID int, in db.WorkspaceImport) (*db.ImportedWorkspace, error)
+}
+
+// AdminStore is the server administration the maintenance commands do
+// beyond the user and workspace stores
+type AdminStore interface {
+	SetUserPassword(ctx context.Context, id int, passwordHash string) error
+	SetUserAdmin(ctx context.Context, id int, isAdmin bool) error
+	SetUserDisabled(ctx context.Context, id int, disabled bool) error
+	CountActiveAdmins(ctx context.Context) (int, error)
+	GetWorkspace(ctx context.Context, id int) (*db.Workspace, error)
+	ListAllWorkspaces(ctx context.Context) ([]db.WorkspaceSummary, error)
+	// PurgeTrash deletes trashed notes, in workspaceID or all when 0, that
+	// were trashed more than olderThanDays ago, 0 for all of them
+	PurgeTrash(ctx context.Context, workspaceID, olderThanDays int) (int64, error)
+}
+
+// FolderStore manages the folder tree
+type FolderStore interface {
+	CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (int, error)
+	GetFolder(ctx context.Context, id int) (*db.Folder, error)
+	ListFolders(ctx context.Context, workspaceID int) ([]db.Folder, error)
+	// UpdateFolderWithCascade renames or moves a folder; moving it to another
+	// workspace takes its subfolders and notes along
+	UpdateFolderWithCascade(ctx context.Context, folderID int, name string, parentID *int, workspaceID *int) error
+	// DeleteFolder removes a folder and its subfolders, trashing their notes
+	DeleteFolder(ctx context.Context, id int) error
+}
+
+// NoteStore manages note metadata; content lives in the document service
+type NoteStore interface {
+	CreateNoteWithTags(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string, tags []string) (int, error)
+	GetNote(ctx context.Context, id int) (*db.Note, error)
+	ListNotesPage(ctx context.Context, workspaceID int, opts db.NoteListOptions) (*db.NotePage, error)
+	ListTrashedNotes(ctx context.Context, workspaceID int) ([]db.Note, error)
+	// UpdateNoteMetadata applies title, folder_id, workspace_id and color
+	// values decoded from a JSON request
+	UpdateNoteMetadata(ctx context.Context, noteID int, updates map[string]interface{}) error
+	// UpdateNoteSearchText reports whether the text changed
+	UpdateNoteSearchText(ctx context.Context, noteID int, contentText string) (bool, error)
+	// SetNoteContent writes an imported note's Yjs state, search text and
+	// original timestamps (nil keeps the current one) before anyone opens it
+	SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error
+	TrashNote(ctx context.Context, id int) error
+	RestoreNote(ctx context.Context, id int) error
+	DeleteNote(ctx context.Context, id int) error
+	EmptyWorkspaceTrash(ctx context.Context, workspaceID int) error
+}
+
+// TagStore manages tags, which are shared by every workspace
+type TagStore interface {
+	ListTags(ctx context.Context) ([]db.Tag, error)
+	ListTagsForWorkspace(ctx context.Context, workspaceID int) ([]db.Tag, error)
+	ListTagsForNote(ctx context.Context, noteID int) ([]db.Tag, error)
+	SetTagsForNote(ctx context.Context, noteID int, tagNames []string) error
+}
+
+// AttachmentStore keeps the metadata of files uploaded to notes; their
+// bytes are blobs named by their SHA-256
+type AttachmentStore interface {
+	// CreateAttachment records an upload, calling put to write its blob when
+	// no attachment shares the content. A positive quota caps the bytes of
+	// the workspace's attachments, failing with db.ErrQuotaExceeded.
+	CreateAttachment(ctx context.Context, a *db.Attachment, quota int64, put func() error) error
+	GetAttachment(ctx context.Context, id int) (*db.Attachment, error)
+	ListAttachments(ctx context.Context, noteID int) ([]db.Attachment, error)
+	// SetAttachmentKey replaces the key that lets an attachment's URL load
+	// without a login
+	SetAttachmentKey(ctx context.Context, id int, key string) error
+	DeleteAttachment(ctx context.Context, id int) error
+	WorkspaceAttachmentBytes(ctx context.Context, workspaceID int) (int64, error)
+	// DeleteOrphanBlobs deletes the blobs unreferenced for the grace period,
+	// calling remove for each
+	DeleteOrphanBlobs(ctx context.Context, grace time.Duration, remove func(hash string) error) (int, error)
+}
+
+// SavedSearchStore manages saved searches, shown as smart folders
+type SavedSearchStore interface {
+	CreateSavedSearch(ctx context.Context, ownerID int, workspaceID *int, name, query, mode string) (int, error)
+	GetSavedSearch(ctx context.Context, id int) (*db.SavedSearch, error)
+	// ListSavedSearches returns the user's own searches and those shared
+	// with the user's workspaces
+	ListSavedSearches(ctx context.Context, userID int) ([]db.SavedSearch, error)
+	UpdateSavedSearch(ctx context.Context, id int, workspaceID *int, name, query, mode string) error
+	DeleteSavedSearch(ctx context.Context, id int) error
+	CanViewSavedSearch(ctx context.Context, search *db.SavedSearch, userID int) (bool, error)
+	// SavedSearchNotes evaluates a search for the user, with tags loaded
+	SavedSearchNotes(ctx context.Context, search *db.SavedSearch, userID int) ([]db.Note, error)
+	CountSavedSearches(ctx context.Context, userID int) ([]db.SavedSearchCount, error)
+}
+
+// SyncStore reads the changes offline clients catch up with
+type SyncStore interface {
+	// GetSyncChanges returns what changed in the user's workspaces since a
+	// cursor, or everything for an empty one. It fails with
+	// db.ErrInvalidCursor or db.ErrSyncCursorExpired.
+	GetSyncChanges(ctx context.Context, userID int, since string) (*db.SyncChanges, error)
+}
+
+// WebhookStore manages webhook subscriptions and their delivery queue
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, workspaceID int, url, secret string, eventTypes []string, active bool, createdBy int) (int, error)
+	GetWebhook(ctx context.Context, id int) (*db.Webhook, error)
+	ListWebhooks(ctx context.Context, workspaceID int) ([]db.Webhook, error)
+	UpdateWebhook(ctx context.Context, id int, url string, eventTypes []string, active bool) error
+	DeleteWebhook(ctx context.Context, id int) error
+	// EnqueueWebhookDeliveries queues an event for the workspace's active
+	// webhooks subscribed to it
+	EnqueueWebhookDeliveries(ctx context.Context, workspaceID int, eventType string, payload []byte) (int64, error)
+	// EnqueueWebhookDelivery queues an event for one webhook whatever it
+	// subscribes to
+	EnqueueWebhookDelivery(ctx context.Context, webhookID int, eventType string, payload []byte) (int64, error)
+	GetWebhookDelivery(ctx context.Context, id int64) (*db.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]db.WebhookDelivery, error)
+}
+
+// SearchLanguageStore manages the languages note content is indexed in
+type SearchLanguageStore interface {
+	ListSearchLanguages(ctx context.Context) ([]string, error)
+	IsValidSearchLanguage(ctx context.Context, name string) (bool, error)
+	// SetWorkspaceSearchLanguage also changes the notes that inherit it
+	SetWorkspaceSearchLanguage(ctx context.Context, workspaceID int, language string) error
+	// SetNoteSearchLanguage overrides a note's language; nil inherits the
+	// workspace's again
+	SetNoteSearchLanguage(ctx context.Context, noteID int, language *string) error
+}
+
+// FuzzySearcher runs typo-tolerant searches with "did you mean" suggestions
+type FuzzySearcher interface {
+	SearchNotesFuzzy(ctx context.Context, userID int, query string, limit int) (*db.FuzzySearchResult, error)
+}
+
+// TxStores are the stores a change is made through, bound to one
+// transaction. The webhooks announcing the change are queued in the same
+// transaction, so they are delivered exactly when it commits.
+type TxStores interface {
+	WorkspaceStore
+	FolderStore
+	NoteStore
+	TagStore
+	SearchLanguageStore
+	webhooks.Queue
+}
+
+// Transactor runs changes in a transaction
+type Transactor interface {
+	// InTx runs fn with stores bound to a new transaction, committing when
+	// fn returns nil and rolling back otherwise
+	InTx(ctx context.Context, fn func(tx TxStores) error) error
+}
+
+// Transactions adapts the WithTx method of a store, which hands fn a copy
+// of the store bound to the transaction, to a Transactor
+func Transactions[S TxStores](withTx func(ctx context.Context, fn func(tx S) error) error) Transactor {
+	return txFunc[S](withTx)
+}
+
+type txFunc[S TxStores] func(ctx context.Context, fn func(tx S) error) error
+
+func (f txFunc[S]) InTx(ctx context.Context, fn func(tx TxStores) error) error {
+	return f(ctx, func(tx S) error { return fn(tx) })
+}
+
+var (
+	_ UserStore           = (*db.Store)(nil)
+	_ WorkspaceStore      = (*db.Store)(nil)
+	_ AdminStore          = (*db.Store)(nil)
+	_ FolderStore         = (*db.Store)(nil)
+	_ NoteStore           = (*db.Store)(nil)
+	_ TagStore            = (*db.Store)(nil)
+	_ AttachmentStore     = (*db.Store)(nil)
+	_ SavedSearchStore    = (*db.Store)(nil)
+	_ SyncStore           = (*db.Store)(nil)
+	_ WebhookStore        = (*db.Store)(nil)
+	_ SearchLanguageStore = (*db.Store)(nil)
+	_ FuzzySearcher       = (*db.Store)(nil)
+	_ TxStores            = (*db.Store)(nil)
+)
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/events"
+)
+
+func (s *server) tagRoutes(api, workspaceGroup *gin.RouterGroup) {
+	// --- Tags Global Endpoint ---
+	api.GET("/tags", func(c *gin.Context) {
+		tags, err := s.Tags.ListTags(c.Request.Context())
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to list tags"})
+			return
+		}
+		c.JSON(200, tags)
+	})
+
+	workspaceGroup.GET("/:id/tags", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		tags, err := s.Tags.ListTagsForWorkspace(c.Request.Context(), workspaceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tags"})
+			return
+		}
+		c.JSON(http.StatusOK, tags)
+	})
+
+	workspaceGroup.PUT("/:id/notes/:note_id/tags", func(c *gin.Context) {
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		// Verify note exists and user has access
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		var req struct {
+			Tags []string `json:"tags"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.SetTagsForNote(ctx, noteID, req.Tags); err != nil {
+				return nil, err
+			}
+			tags, err := tx.ListTagsForNote(ctx, noteID)
+			if err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.NoteTagsUpdated, WorkspaceID: workspaceID, Data: gin.H{"note_id": noteID, "tags": tags}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tags"})
+			return
+		}
+		s.indexNote(ctx, noteID)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Tags updated"})
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/events"
+)
+
+func (s *server) trashRoutes(workspaceGroup *gin.RouterGroup) {
+	// --- Trash Endpoints ---
+	workspaceGroup.GET("/:id/trash", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		notes, err := s.Notes.ListTrashedNotes(c.Request.Context(), workspaceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list trashed notes"})
+			return
+		}
+		c.JSON(http.StatusOK, notes)
+	})
+
+	workspaceGroup.POST("/:id/trash/empty", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.EmptyWorkspaceTrash(c.Request.Context(), workspaceID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.TrashEmptied, WorkspaceID: workspaceID}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to empty trash"})
+			return
+		}
+		s.reindexWorkspace(c.Request.Context(), workspaceID)
+		c.JSON(http.StatusOK, gin.H{"message": "Trash emptied"})
+	})
+
+	workspaceGroup.POST("/:id/notes/:note_id/trash", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.TrashNote(c.Request.Context(), noteID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.NoteTrashed, WorkspaceID: workspaceID, Data: gin.H{"note_id": noteID}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trash note"})
+			return
+		}
+		s.indexNote(c.Request.Context(), noteID)
+		c.JSON(http.StatusOK, gin.H{"message": "Note moved to trash"})
+	})
+
+	workspaceGroup.POST("/:id/notes/:note_id/restore", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		noteID, _ := strconv.Atoi(c.Param("note_id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		note, err := s.Notes.GetNote(c.Request.Context(), noteID)
+		if err != nil || note.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.RestoreNote(c.Request.Context(), noteID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.NoteRestored, WorkspaceID: workspaceID, Data: gin.H{"note_id": noteID}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore note"})
+			return
+		}
+		s.indexNote(c.Request.Context(), noteID)
+		c.JSON(http.StatusOK, gin.H{"message": "Note restored from trash"})
+	})
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"go-notes/backend/internal/auth"
+)
+
+func (s *server) userRoutes(api *gin.RouterGroup, generalMiddleware gin.HandlerFunc) {
+	// --- User CRUD & Access Control ---
+	userGroup := api.Group("/users")
+	userGroup.Use(auth.AuthRequired(s.Users))
+	userGroup.Use(generalMiddleware)
+
+	userGroup.GET("/", func(c *gin.Context) {
+		// Allow all authenticated users to list users (needed for workspace sharing)
+		users, err := s.Users.ListUsers(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+			return
+		}
+		c.JSON(http.StatusOK, users)
+	})
+	userGroup.POST("/", func(c *gin.Context) {
+		isAdmin := c.GetBool("is_admin")
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin only"})
+			return
+		}
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			IsAdmin  bool   `json:"is_admin"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+			return
+		}
+		err = s.Users.CreateUser(c.Request.Context(), req.Username, string(passwordHash), req.IsAdmin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User creation failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "User created"})
+	})
+	userGroup.GET("/:id", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		isAdmin := c.GetBool("is_admin")
+		paramID := c.Param("id")
+		id := 0
+		fmt.Sscanf(paramID, "%d", &id)
+		if !isAdmin && userID != id {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		user, err := s.Users.GetUserByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusOK, user)
+	})
+
+	userGroup.PUT("/:id", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		isAdmin := c.GetBool("is_admin")
+		paramID := c.Param("id")
+		id := 0
+		fmt.Sscanf(paramID, "%d", &id)
+		if !isAdmin && userID != id {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// Get current user data
+		user, err := s.Users.GetUserByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// Use existing values if not provided
+		newUsername := user.Username
+		newPasswordHash := user.PasswordHash
+
+		if req.Username != "" {
+			newUsername = req.Username
+		}
+
+		if req.Password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+				return
+			}
+			newPasswordHash = string(hash)
+		}
+
+		err = s.Users.UpdateUser(c.Request.Context(), id, newUsername, newPasswordHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Update failed"})
+			return
+		}
+
+		// Return updated user
+		updatedUser, _ := s.Users.GetUserByID(c.Request.Context(), id)
+		c.JSON(http.StatusOK, updatedUser)
+	})
+
+	userGroup.DELETE("/:id", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		isAdmin := c.GetBool("is_admin")
+		paramID := c.Param("id")
+		id := 0
+		fmt.Sscanf(paramID, "%d", &id)
+		user, err := s.Users.GetUserByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if isAdmin {
+			if user.IsAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete admin"})
+				return
+			}
+			if userID == id {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Admin cannot delete self"})
+				return
+			}
+		} else {
+			if userID != id {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+				return
+			}
+		}
+		err = s.Users.DeleteUser(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+	})
+}
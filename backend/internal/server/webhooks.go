@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+	"go-notes/backend/internal/webhooks"
+)
+
+func (s *server) webhookRoutes(workspaceGroup *gin.RouterGroup) {
+	// --- Webhooks (owner only) ---
+	webhookGroup := workspaceGroup.Group("/:id/webhooks")
+
+	type webhookRequest struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Active     *bool    `json:"active"`
+		Secret     string   `json:"secret"`
+	}
+
+	// validateWebhook checks the target URL and subscribed event types
+	validateWebhook := func(c *gin.Context, req *webhookRequest) bool {
+		if err := webhooks.CheckURL(c.Request.Context(), req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		if req.EventTypes == nil {
+			req.EventTypes = []string{}
+		}
+		for _, t := range req.EventTypes {
+			if !webhooks.IsEventType(t) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown event type %q", t)})
+				return false
+			}
+		}
+		return true
+	}
+
+	// ownedWebhook loads the webhook in the URL after checking the caller owns the workspace
+	ownedWebhook := func(c *gin.Context) (*db.Webhook, bool) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		hookID, _ := strconv.Atoi(c.Param("hook_id"))
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, c.GetInt("user_id"))
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can manage webhooks"})
+			return nil, false
+		}
+		hook, err := s.Webhooks.GetWebhook(c.Request.Context(), hookID)
+		if err != nil || hook.WorkspaceID != workspaceID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return nil, false
+		}
+		return hook, true
+	}
+
+	webhookGroup.GET("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, c.GetInt("user_id"))
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can manage webhooks"})
+			return
+		}
+		hooks, err := s.Webhooks.ListWebhooks(c.Request.Context(), workspaceID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+			return
+		}
+		for i := range hooks {
+			hooks[i].Secret = ""
+		}
+		c.JSON(http.StatusOK, hooks)
+	})
+
+	// The secret is only returned here; receivers use it to verify signatures
+	webhookGroup.POST("", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can manage webhooks"})
+			return
+		}
+		var req webhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if !validateWebhook(c, &req) {
+			return
+		}
+		if req.Secret == "" {
+			if req.Secret, err = webhooks.NewSecret(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+				return
+			}
+		}
+		active := req.Active == nil || *req.Active
+		id, err := s.Webhooks.CreateWebhook(c.Request.Context(), workspaceID, req.URL, req.Secret, req.EventTypes, active, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create webhook"})
+			return
+		}
+		hook, err := s.Webhooks.GetWebhook(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Created webhook but failed to retrieve"})
+			return
+		}
+		c.JSON(http.StatusCreated, hook)
+	})
+
+	webhookGroup.GET("/:hook_id", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		hook.Secret = ""
+		c.JSON(http.StatusOK, hook)
+	})
+
+	webhookGroup.PUT("/:hook_id", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		var req webhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		if !validateWebhook(c, &req) {
+			return
+		}
+		active := hook.Active
+		if req.Active != nil {
+			active = *req.Active
+		}
+		if err := s.Webhooks.UpdateWebhook(c.Request.Context(), hook.ID, req.URL, req.EventTypes, active); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook updated"})
+	})
+
+	webhookGroup.DELETE("/:hook_id", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		if err := s.Webhooks.DeleteWebhook(c.Request.Context(), hook.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	})
+
+	// Delivery log, newest first. Response bodies are shown to admins only:
+	// a receiver's answer is content from another system.
+	webhookGroup.GET("/:hook_id/deliveries", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		limit := 50
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+		deliveries, err := s.Webhooks.ListWebhookDeliveries(c.Request.Context(), hook.ID, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list deliveries"})
+			return
+		}
+		if !c.GetBool("is_admin") {
+			for i := range deliveries {
+				deliveries[i].ResponseBody = nil
+			}
+		}
+		c.JSON(http.StatusOK, deliveries)
+	})
+
+	// Queue a copy of a past delivery; the original stays in the log
+	webhookGroup.POST("/:hook_id/deliveries/:delivery_id/redeliver", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		deliveryID, _ := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+		delivery, err := s.Webhooks.GetWebhookDelivery(c.Request.Context(), deliveryID)
+		if err != nil || delivery.WebhookID != hook.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		id, err := s.Webhooks.EnqueueWebhookDelivery(c.Request.Context(), hook.ID, delivery.EventType, []byte(delivery.Payload))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue redelivery"})
+			return
+		}
+		s.wakeWebhooks()
+		c.JSON(http.StatusAccepted, gin.H{"message": "Redelivery queued", "delivery_id": id})
+	})
+
+	// Send a test event
+	webhookGroup.POST("/:hook_id/ping", func(c *gin.Context) {
+		hook, ok := ownedWebhook(c)
+		if !ok {
+			return
+		}
+		payload, _ := json.Marshal(events.Event{Type: webhooks.PingEvent, WorkspaceID: hook.WorkspaceID, ActorID: c.GetInt("user_id"), At: time.Now().UTC()})
+		id, err := s.Webhooks.EnqueueWebhookDelivery(c.Request.Context(), hook.ID, webhooks.PingEvent, payload)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue ping"})
+			return
+		}
+		s.wakeWebhooks()
+		c.JSON(http.StatusAccepted, gin.H{"message": "Ping queued", "delivery_id": id})
+	})
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-notes/backend/internal/events"
+)
+
+func (s *server) workspaceRoutes(workspaceGroup *gin.RouterGroup) {
+	workspaceGroup.POST("", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		id, err := s.Workspaces.CreateWorkspace(c.Request.Context(), req.Name, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Workspace creation failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": id, "name": req.Name, "owner_id": userID})
+	})
+	workspaceGroup.GET("", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		workspaces, err := s.Workspaces.ListWorkspaces(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list workspaces"})
+			return
+		}
+
+		// Add role to each workspace
+		type WorkspaceWithRole struct {
+			ID        int    `json:"id"`
+			Name      string `json:"name"`
+			OwnerID   int    `json:"owner_id"`
+			CreatedAt string `json:"created_at"`
+			Role      string `json:"role"`
+		}
+
+		var result []WorkspaceWithRole
+		for _, ws := range workspaces {
+			role := "member"
+			if ws.OwnerID == userID {
+				role = "owner"
+			}
+			result = append(result, WorkspaceWithRole{
+				ID:        ws.ID,
+				Name:      ws.Name,
+				OwnerID:   ws.OwnerID,
+				CreatedAt: ws.CreatedAt,
+				Role:      role,
+			})
+		}
+
+		c.JSON(http.StatusOK, result)
+	})
+
+	workspaceGroup.PUT("/:id", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can update workspace"})
+			return
+		}
+
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.UpdateWorkspace(c.Request.Context(), workspaceID, req.Name); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.WorkspaceUpdated, WorkspaceID: workspaceID, Data: gin.H{"name": req.Name}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workspace"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Workspace updated"})
+	})
+
+	workspaceGroup.PUT("/:id/search-language", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can update workspace"})
+			return
+		}
+
+		var req struct {
+			Language string `json:"language"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Language == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		valid, err := s.Languages.IsValidSearchLanguage(c.Request.Context(), req.Language)
+		if err != nil || !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown search language"})
+			return
+		}
+
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.SetWorkspaceSearchLanguage(c.Request.Context(), workspaceID, req.Language); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.WorkspaceUpdated, WorkspaceID: workspaceID, Data: gin.H{"search_language": req.Language}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update search language"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Search language updated", "search_language": req.Language})
+	})
+
+	workspaceGroup.DELETE("/:id", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can delete workspace"})
+			return
+		}
+
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			// The delete takes the webhooks with it; their deliveries stay
+			deleted, err := queueEvent(c.Request.Context(), tx, userID, events.Event{Type: events.WorkspaceDeleted, WorkspaceID: workspaceID})
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.DeleteWorkspace(c.Request.Context(), workspaceID); err != nil {
+				return nil, err
+			}
+			return []events.Event{deleted}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete workspace"})
+			return
+		}
+		s.reindexWorkspace(c.Request.Context(), workspaceID)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted"})
+	})
+
+	workspaceGroup.GET("/:id/members", func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		id, _ := strconv.Atoi(c.Param("id"))
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), id, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+		members, err := s.Workspaces.ListWorkspaceMembers(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list members"})
+			return
+		}
+		c.JSON(http.StatusOK, members)
+	})
+	workspaceGroup.POST("/:id/members", func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), id, userID)
+		if err != nil || !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can add members"})
+			return
+		}
+		var req struct {
+			UserID int    `json:"user_id"`
+			Role   string `json:"role"` // "member" or "owner"
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.UserID == 0 || (req.Role != "member" && req.Role != "owner") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.AddWorkspaceMember(c.Request.Context(), id, req.UserID, req.Role); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.MemberAdded, WorkspaceID: id, UserID: req.UserID, Data: gin.H{"role": req.Role}}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not add member"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Member added"})
+	})
+
+	workspaceGroup.DELETE("/:id/members/:user_id", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		memberUserID, _ := strconv.Atoi(c.Param("user_id"))
+		currentUserID := c.GetInt("user_id")
+
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, currentUserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Workspace lookup failed"})
+			return
+		}
+
+		// Allow if: (1) user is removing themselves, OR (2) user is owner removing someone else
+		isSelfRemoval := memberUserID == currentUserID
+
+		if !isSelfRemoval && !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owner can remove other members"})
+			return
+		}
+
+		// Prevent owner from leaving their own workspace
+		if isSelfRemoval && isOwner {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot leave workspace you own. Transfer ownership first."})
+			return
+		}
+
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.RemoveWorkspaceMember(c.Request.Context(), workspaceID, memberUserID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.MemberRemoved, WorkspaceID: workspaceID, UserID: memberUserID}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+	})
+
+	workspaceGroup.PUT("/:id/owner", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isOwner, err := s.Workspaces.IsWorkspaceOwner(c.Request.Context(), workspaceID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Workspace lookup failed"})
+			return
+		}
+		if !isOwner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the current owner can transfer ownership"})
+			return
+		}
+		var req struct {
+			NewOwnerID int `json:"new_owner_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.NewOwnerID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, req.NewOwnerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Workspace member lookup failed"})
+			return
+		}
+		if !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "New owner must be an existing member"})
+			return
+		}
+		if req.NewOwnerID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You are already the owner"})
+			return
+		}
+		err = s.change(c, func(tx TxStores) ([]events.Event, error) {
+			if err := tx.TransferWorkspaceOwnership(c.Request.Context(), workspaceID, req.NewOwnerID); err != nil {
+				return nil, err
+			}
+			return []events.Event{{Type: events.WorkspaceOwnerChanged, WorkspaceID: workspaceID, UserID: req.NewOwnerID}}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ownership transfer failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Ownership transferred successfully", "new_owner_id": req.NewOwnerID})
+	})
+
+	// Server-sent events for metadata changes in the workspace (note tree,
+	// members, tags). EventSource cannot set headers, so ?token= is accepted.
+	workspaceGroup.GET("/:id/events", func(c *gin.Context) {
+		workspaceID, _ := strconv.Atoi(c.Param("id"))
+		userID := c.GetInt("user_id")
+		isMember, err := s.Workspaces.IsWorkspaceMember(c.Request.Context(), workspaceID, userID)
+		if err != nil || !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member"})
+			return
+		}
+
+		sub := s.Events.Subscribe(workspaceID, userID)
+		defer s.Events.Unsubscribe(sub)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // disable nginx buffering
+		c.SSEvent("ready", gin.H{"workspace_id": workspaceID})
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(25 * time.Second)
+		defer keepAlive.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return false
+				}
+				c.SSEvent(e.Type, e)
+				return true
+			case <-keepAlive.C:
+				io.WriteString(w, ": keepalive\n\n")
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	})
+}
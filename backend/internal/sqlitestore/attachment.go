@@ -0,0 +1,162 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// --- Attachments ---
+
+const attachmentColumns = "id, note_id, filename, mime_type, size, hash, access_key, width, height, created_by, created_at"
+
+func scanAttachment(scan func(dest ...any) error, a *db.Attachment) error {
+	return scan(&a.ID, &a.NoteID, &a.Filename, &a.MimeType, &a.Size, &a.Hash, &a.Key, &a.Width, &a.Height, &a.CreatedBy, &a.CreatedAt)
+}
+
+// CreateAttachment records an upload as db.Store does. Write transactions
+// take the database lock when they begin, so uploads are serialised and
+// the quota check cannot race.
+func (s *Store) CreateAttachment(ctx context.Context, a *db.Attachment, quota int64, put func() error) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		if quota > 0 {
+			var used int64
+			err := tx.q.QueryRowContext(ctx, `
+				SELECT COALESCE(SUM(a.size), 0)
+				FROM attachments a JOIN notes n ON n.id = a.note_id
+				WHERE n.workspace_id = (SELECT workspace_id FROM notes WHERE id = $1)
+			`, a.NoteID).Scan(&used)
+			if err != nil {
+				return err
+			}
+			if used+a.Size > quota {
+				return db.ErrQuotaExceeded
+			}
+		}
+		if err := tx.claimBlob(ctx, a.Hash, a.Size, put); err != nil {
+			return err
+		}
+		return tx.q.QueryRowContext(ctx, `
+			INSERT INTO attachments (note_id, hash, filename, mime_type, size, access_key, width, height, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at
+		`, a.NoteID, a.Hash, a.Filename, a.MimeType, a.Size, a.Key, a.Width, a.Height, a.CreatedBy).Scan(&a.ID, &a.CreatedAt)
+	})
+}
+
+// claimBlob marks a blob as in use, creating its row and calling put when
+// it has none
+func (s *Store) claimBlob(ctx context.Context, hash string, size int64, put func() error) error {
+	res, err := s.q.ExecContext(ctx, "UPDATE attachment_blobs SET last_used_at = "+now+" WHERE hash = $1", hash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	if _, err := s.q.ExecContext(ctx, "INSERT INTO attachment_blobs (hash, size) VALUES ($1, $2)", hash, size); err != nil {
+		return err
+	}
+	if err := put(); err != nil {
+		return fmt.Errorf("store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetAttachment(ctx context.Context, id int) (*db.Attachment, error) {
+	var a db.Attachment
+	row := s.q.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = $1", id)
+	if err := scanAttachment(row.Scan, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *Store) ListAttachments(ctx context.Context, noteID int) ([]db.Attachment, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE note_id = $1 ORDER BY id", noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []db.Attachment{}
+	for rows.Next() {
+		var a db.Attachment
+		if err := scanAttachment(rows.Scan, &a); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *Store) SetAttachmentKey(ctx context.Context, id int, key string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE attachments SET access_key = $1 WHERE id = $2", key, id)
+	return err
+}
+
+func (s *Store) DeleteAttachment(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM attachments WHERE id = $1", id)
+	return err
+}
+
+func (s *Store) WorkspaceAttachmentBytes(ctx context.Context, workspaceID int) (int64, error) {
+	var used int64
+	err := s.q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(a.size), 0)
+		FROM attachments a JOIN notes n ON n.id = a.note_id
+		WHERE n.workspace_id = $1
+	`, workspaceID).Scan(&used)
+	return used, err
+}
+
+// orphanBlobs is the condition on attachment_blobs b of a blob to sweep; the
+// cutoff is bound to $1 as a strftime modifier
+const orphanBlobs = `b.last_used_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)
+	AND NOT EXISTS (SELECT 1 FROM attachments a WHERE a.hash = b.hash)`
+
+func (s *Store) DeleteOrphanBlobs(ctx context.Context, grace time.Duration, remove func(hash string) error) (int, error) {
+	cutoff := fmt.Sprintf("-%d seconds", int64(grace.Seconds()))
+	rows, err := s.q.QueryContext(ctx, "SELECT b.hash FROM attachment_blobs b WHERE "+orphanBlobs, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var errs []error
+	for _, hash := range hashes {
+		err := s.WithTx(ctx, func(tx *Store) error {
+			res, err := tx.q.ExecContext(ctx, "DELETE FROM attachment_blobs AS b WHERE b.hash = $2 AND "+orphanBlobs, cutoff, hash)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+			if err := remove(hash); err != nil {
+				return err
+			}
+			deleted++
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete blob %s: %w", hash, err))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// --- Export Jobs ---
+
+const exportJobColumns = "id, workspace_id, user_id, status, COALESCE(error, ''), size, created_at, finished_at"
+
+func scanExportJob(scan func(dest ...any) error) (*db.ExportJob, error) {
+	var j db.ExportJob
+	var finished sql.NullString
+	if err := scan(&j.ID, &j.WorkspaceID, &j.UserID, &j.Status, &j.Error, &j.Size, &j.CreatedAt, &finished); err != nil {
+		return nil, err
+	}
+	j.FinishedAt = finished.String
+	return &j, nil
+}
+
+// secondsFromNow is a strftime modifier shifting 'now' by d
+func secondsFromNow(d time.Duration) string {
+	return fmt.Sprintf("%+d seconds", int64(d.Seconds()))
+}
+
+// CreateExportJob records a running job
+func (s *Store) CreateExportJob(ctx context.Context, id string, workspaceID, userID int) (*db.ExportJob, error) {
+	return scanExportJob(s.q.QueryRowContext(ctx,
+		"INSERT INTO export_jobs (id, workspace_id, user_id) VALUES ($1, $2, $3) RETURNING "+exportJobColumns,
+		id, workspaceID, userID,
+	).Scan)
+}
+
+// GetExportJob returns a job that has not expired
+func (s *Store) GetExportJob(ctx context.Context, id string) (*db.ExportJob, error) {
+	return scanExportJob(s.q.QueryRowContext(ctx,
+		"SELECT "+exportJobColumns+" FROM export_jobs WHERE id = $1 AND (expires_at IS NULL OR expires_at > "+now+")", id).Scan)
+}
+
+// CountRunningExportJobs counts a user's running jobs
+func (s *Store) CountRunningExportJobs(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM export_jobs WHERE user_id = $1 AND status = 'running'", userID).Scan(&n)
+	return n, err
+}
+
+// TouchExportJob records that a running job's process is still alive
+func (s *Store) TouchExportJob(ctx context.Context, id string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE export_jobs SET heartbeat_at = "+now+" WHERE id = $1 AND status = 'running'", id)
+	return err
+}
+
+// FinishExportJob records the outcome of a running job, kept for retention.
+// It reports false when the job was no longer running, having been given
+// up as stalled.
+func (s *Store) FinishExportJob(ctx context.Context, id, status, errMsg string, size int64, retention time.Duration) (bool, error) {
+	var errArg interface{}
+	if errMsg != "" {
+		errArg = errMsg
+	}
+	res, err := s.q.ExecContext(ctx, `
+		UPDATE export_jobs
+		SET status = $2, error = $3, size = $4, finished_at = `+now+`,
+		    expires_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $5)
+		WHERE id = $1 AND status = 'running'
+	`, id, status, errArg, size, secondsFromNow(retention))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FailStalledExportJobs fails the running jobs whose process has not been
+// heard from for stalledAfter, which died with it, returning their IDs
+func (s *Store) FailStalledExportJobs(ctx context.Context, stalledAfter, retention time.Duration) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE export_jobs
+		SET status = 'failed', error = 'the export was interrupted', finished_at = `+now+`,
+		    expires_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $2)
+		WHERE status = 'running' AND heartbeat_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)
+		RETURNING id
+	`, secondsFromNow(-stalledAfter), secondsFromNow(retention))
+	if err != nil {
+		return nil, err
+	}
+	return scanJobIDs(rows)
+}
+
+// DeleteExpiredExportJobs forgets the jobs past their retention, returning
+// their IDs so their files can be removed
+func (s *Store) DeleteExpiredExportJobs(ctx context.Context) ([]string, error) {
+	rows, err := s.q.QueryContext(ctx, "DELETE FROM export_jobs WHERE expires_at <= "+now+" RETURNING id")
+	if err != nil {
+		return nil, err
+	}
+	return scanJobIDs(rows)
+}
+
+func scanJobIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
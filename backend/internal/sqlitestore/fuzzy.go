@@ -0,0 +1,94 @@
+package sqlitestore
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go-notes/backend/internal/db"
+)
+
+// SearchNotesFuzzy ranks notes by trigram similarity to the query, scoring
+// them as the pg_trgm search does. SQLite has no trigram index, so the
+// user's live notes are scored in Go; the vocabulary for "did you mean"
+// comes from the same notes.
+func (s *Store) SearchNotesFuzzy(ctx context.Context, userID int, query string, limit int) (*db.FuzzySearchResult, error) {
+	result := &db.FuzzySearchResult{Notes: []db.ScoredNote{}, Suggestions: []string{}}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return result, nil
+	}
+
+	workspaceIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaceIDs) == 0 {
+		return result, nil
+	}
+
+	var args []interface{}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+noteColumns+`, COALESCE(n.content_text, '')
+		FROM notes n
+		WHERE n.workspace_id IN (`+placeholders(workspaceIDs, &args)+`) AND n.is_trashed = FALSE
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var notes []db.Note
+	var contents []string
+	for rows.Next() {
+		var n db.Note
+		var content string
+		if err := scanNote(rows.Scan, &n, &content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		notes = append(notes, n)
+		contents = append(contents, content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.AttachTags(ctx, notes); err != nil {
+		return nil, err
+	}
+
+	vocabulary := make(map[string]bool)
+	for i, n := range notes {
+		db.AddVocabulary(vocabulary, n.Title+" "+contents[i])
+		title := db.WordSimilarity(query, strings.ToLower(n.Title))
+		content := db.WordSimilarity(query, strings.ToLower(contents[i]))
+		tag := 0.0
+		for _, t := range n.Tags {
+			name := strings.ToLower(t.Name)
+			if len([]rune(name)) >= 3 {
+				vocabulary[name] = true
+			}
+			if sim := db.Similarity(name, query); sim > tag {
+				tag = sim
+			}
+		}
+		if title < db.FuzzyThreshold && content < db.FuzzyThreshold && tag < db.FuzzyThreshold {
+			continue
+		}
+		result.Notes = append(result.Notes, db.ScoredNote{Note: n, Score: max(title, content*0.8, tag)})
+	}
+
+	sort.SliceStable(result.Notes, func(i, j int) bool {
+		a, b := result.Notes[i], result.Notes[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.UpdatedAt > b.UpdatedAt
+	})
+	if len(result.Notes) > limit {
+		result.Notes = result.Notes[:limit]
+	}
+
+	result.DidYouMean, result.Suggestions = db.SuggestTerms(query, vocabulary)
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package sqlitestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// ImportWorkspace creates a workspace owned by ownerID with its folders,
+// notes, tags, content and search languages in one transaction
+func (s *Store) ImportWorkspace(ctx context.Context, ownerID int, in db.WorkspaceImport) (*db.ImportedWorkspace, error) {
+	out := &db.ImportedWorkspace{Folders: map[int]int{}, Notes: []db.ImportedNote{}}
+	err := s.WithTx(ctx, func(tx *Store) error {
+		id, err := tx.CreateWorkspace(ctx, in.Name, ownerID)
+		if err != nil {
+			return err
+		}
+		out.WorkspaceID = id
+		_, err = tx.q.ExecContext(ctx, `UPDATE workspaces SET created_at = COALESCE($1, created_at),
+				search_language = COALESCE(NULLIF($2, ''), search_language)
+			WHERE id = $3`,
+			timestamp(in.CreatedAt), in.SearchLanguage, id)
+		if err != nil {
+			return fmt.Errorf("workspace: %w", err)
+		}
+
+		for _, f := range in.Folders {
+			parentID, err := out.FolderID(f.ParentKey)
+			if err != nil {
+				return err
+			}
+			var folderID int
+			err = tx.q.QueryRowContext(ctx,
+				"INSERT INTO folders (workspace_id, name, parent_id, created_at) VALUES ($1, $2, $3, COALESCE($4, "+now+")) RETURNING id",
+				id, f.Name, parentID, timestamp(f.CreatedAt),
+			).Scan(&folderID)
+			if err != nil {
+				return fmt.Errorf("folder %d: %w", f.Key, err)
+			}
+			out.Folders[f.Key] = folderID
+		}
+
+		for _, n := range in.Notes {
+			folderID, err := out.FolderID(n.FolderKey)
+			if err != nil {
+				return err
+			}
+			var noteID int
+			err = tx.q.QueryRowContext(ctx, `
+				INSERT INTO notes (workspace_id, title, yjs_room_id, folder_id, created_by, color, content, content_text,
+					is_trashed, trashed_at, created_at, updated_at, search_language, search_language_inherited)
+				VALUES ($1, $2, 'temp', $3, $4, $5, $6, $7,
+					$8, CASE WHEN $8 THEN COALESCE($9, `+now+`) END,
+					COALESCE($10, `+now+`), COALESCE($11, $10, `+now+`),
+					COALESCE(NULLIF($12, ''), (SELECT search_language FROM workspaces WHERE id = $1)), $12 = '')
+				RETURNING id`,
+				id, n.Title, folderID, ownerID, n.Color, n.Content, n.ContentText,
+				n.IsTrashed, timestamp(n.TrashedAt), timestamp(n.CreatedAt), timestamp(n.UpdatedAt), n.SearchLanguage,
+			).Scan(&noteID)
+			if err != nil {
+				return fmt.Errorf("note %d: %w", n.Key, err)
+			}
+			roomID := fmt.Sprintf("w%d_n%d", id, noteID)
+			if _, err := tx.q.ExecContext(ctx, "UPDATE notes SET yjs_room_id=$1 WHERE id=$2", roomID, noteID); err != nil {
+				return err
+			}
+			if len(n.Tags) > 0 {
+				if err := tx.SetTagsForNote(ctx, noteID, n.Tags); err != nil {
+					return fmt.Errorf("note %d tags: %w", n.Key, err)
+				}
+			}
+			out.Notes = append(out.Notes, db.ImportedNote{Key: n.Key, ID: noteID, YjsRoomID: roomID})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// timestamp formats an optional time like the columns' defaults
+func timestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(timestampLayout)
+}
+
+// SetNoteContent stores a note's Yjs state and search text directly, with
+// the source's timestamps when given
+func (s *Store) SetNoteContent(ctx context.Context, noteID int, content []byte, contentText string, createdAt, updatedAt *time.Time) error {
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE notes SET content = $1, content_text = $2,
+			created_at = COALESCE($3, created_at), updated_at = COALESCE($4, $3, updated_at)
+		WHERE id = $5`,
+		content, contentText, timestamp(createdAt), timestamp(updatedAt), noteID)
+	return err
+}
@@ -0,0 +1,56 @@
+package sqlitestore
+
+import "context"
+
+// searchLanguages are the languages with an FTS5 index: "english" uses
+// notes_fts with the porter stemmer, "simple" notes_fts_simple without
+// stemming, as PostgreSQL's configurations of those names do
+var searchLanguages = []string{"english", "simple"}
+
+// ListSearchLanguages returns the languages note content can be indexed in
+func (s *Store) ListSearchLanguages(ctx context.Context) ([]string, error) {
+	return append([]string(nil), searchLanguages...), nil
+}
+
+// IsValidSearchLanguage reports whether name is one of searchLanguages
+func (s *Store) IsValidSearchLanguage(ctx context.Context, name string) (bool, error) {
+	for _, lang := range searchLanguages {
+		if lang == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetWorkspaceSearchLanguage changes a workspace's default language and
+// re-points every note that inherits it
+func (s *Store) SetWorkspaceSearchLanguage(ctx context.Context, workspaceID int, language string) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		if _, err := tx.q.ExecContext(ctx, "UPDATE workspaces SET search_language=$1 WHERE id=$2", language, workspaceID); err != nil {
+			return err
+		}
+		_, err := tx.q.ExecContext(ctx,
+			"UPDATE notes SET search_language=$1 WHERE workspace_id=$2 AND search_language_inherited",
+			language, workspaceID,
+		)
+		return err
+	})
+}
+
+// SetNoteSearchLanguage sets a per-note language override.
+// A nil language drops the override so the note follows its workspace again.
+func (s *Store) SetNoteSearchLanguage(ctx context.Context, noteID int, language *string) error {
+	if language == nil {
+		_, err := s.q.ExecContext(ctx, `
+			UPDATE notes SET search_language_inherited=TRUE,
+				search_language=(SELECT w.search_language FROM workspaces w WHERE w.id = notes.workspace_id)
+			WHERE id=$1
+		`, noteID)
+		return err
+	}
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE notes SET search_language=$1, search_language_inherited=FALSE WHERE id=$2",
+		*language, noteID,
+	)
+	return err
+}
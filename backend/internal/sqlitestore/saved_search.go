@@ -0,0 +1,129 @@
+package sqlitestore
+
+import (
+	"context"
+
+	"go-notes/backend/internal/db"
+)
+
+// --- Saved Searches / Smart Folders ---
+
+const savedSearchColumns = "id, owner_id, workspace_id, name, query, mode, created_at, updated_at"
+
+func scanSavedSearch(scan func(dest ...any) error, ss *db.SavedSearch) error {
+	return scan(&ss.ID, &ss.OwnerID, &ss.WorkspaceID, &ss.Name, &ss.Query, &ss.Mode, &ss.CreatedAt, &ss.UpdatedAt)
+}
+
+func (s *Store) CreateSavedSearch(ctx context.Context, ownerID int, workspaceID *int, name, query, mode string) (int, error) {
+	var id int
+	err := s.q.QueryRowContext(ctx,
+		"INSERT INTO saved_searches (owner_id, workspace_id, name, query, mode) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		ownerID, workspaceID, name, query, mode,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) GetSavedSearch(ctx context.Context, id int) (*db.SavedSearch, error) {
+	var ss db.SavedSearch
+	row := s.q.QueryRowContext(ctx, "SELECT "+savedSearchColumns+" FROM saved_searches WHERE id = $1", id)
+	if err := scanSavedSearch(row.Scan, &ss); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// ListSavedSearches returns the user's private searches plus those shared
+// with any workspace the user belongs to, the ones CanViewSavedSearch
+// allows; a search shared with a workspace its owner has left is not
+// listed
+func (s *Store) ListSavedSearches(ctx context.Context, userID int) ([]db.SavedSearch, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT `+savedSearchColumns+`
+		FROM saved_searches
+		WHERE (workspace_id IS NULL AND owner_id = $1)
+		OR workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+		ORDER BY LOWER(name), id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	searches := []db.SavedSearch{}
+	for rows.Next() {
+		var ss db.SavedSearch
+		if err := scanSavedSearch(rows.Scan, &ss); err != nil {
+			return nil, err
+		}
+		searches = append(searches, ss)
+	}
+	return searches, rows.Err()
+}
+
+func (s *Store) UpdateSavedSearch(ctx context.Context, id int, workspaceID *int, name, query, mode string) error {
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE saved_searches SET workspace_id=$1, name=$2, query=$3, mode=$4, updated_at="+now+" WHERE id=$5",
+		workspaceID, name, query, mode, id,
+	)
+	return err
+}
+
+func (s *Store) DeleteSavedSearch(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM saved_searches WHERE id=$1", id)
+	return err
+}
+
+// CanViewSavedSearch reports whether the user may evaluate a search: a
+// shared search needs current membership of its workspace, even for the
+// owner, and a private one is the owner's alone
+func (s *Store) CanViewSavedSearch(ctx context.Context, ss *db.SavedSearch, userID int) (bool, error) {
+	if ss.WorkspaceID != nil {
+		return s.IsWorkspaceMember(ctx, *ss.WorkspaceID, userID)
+	}
+	return ss.OwnerID == userID, nil
+}
+
+// savedSearchScope returns the workspaces a saved search is evaluated
+// against: those of memberIDs, narrowed to the shared workspace if any
+func savedSearchScope(ss *db.SavedSearch, memberIDs []int) []int {
+	if ss.WorkspaceID == nil {
+		return memberIDs
+	}
+	for _, id := range memberIDs {
+		if id == *ss.WorkspaceID {
+			return []int{id}
+		}
+	}
+	return []int{}
+}
+
+// SavedSearchNotes evaluates a saved search for the user, returning the
+// smart folder's current contents with tags loaded
+func (s *Store) SavedSearchNotes(ctx context.Context, ss *db.SavedSearch, userID int) ([]db.Note, error) {
+	memberIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.searchNotesIn(ctx, savedSearchScope(ss, memberIDs), db.ParseSearchQuery(ss.Query), ss.Mode)
+}
+
+// CountSavedSearches returns live match counts for every saved search visible to the user
+func (s *Store) CountSavedSearches(ctx context.Context, userID int) ([]db.SavedSearchCount, error) {
+	searches, err := s.ListSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]db.SavedSearchCount, 0, len(searches))
+	for _, ss := range searches {
+		count, err := s.countNotesIn(ctx, savedSearchScope(&ss, memberIDs), db.ParseSearchQuery(ss.Query), ss.Mode)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, db.SavedSearchCount{ID: ss.ID, Name: ss.Name, Count: count})
+	}
+	return counts, nil
+}
@@ -0,0 +1,134 @@
+package sqlitestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go-notes/backend/internal/db"
+)
+
+// timestampLayout matches the text the migrations store in timestamp columns
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+// SearchNotes runs a search string (see db.ParseSearchQuery) within the
+// user's workspaces, newest note first, with tags attached. mode "full"
+// also matches note content through the FTS5 index of the note's language.
+func (s *Store) SearchNotes(ctx context.Context, userID int, query, mode string) ([]db.Note, error) {
+	workspaceIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.searchNotesIn(ctx, workspaceIDs, db.ParseSearchQuery(query), mode)
+}
+
+// searchNotesIn runs a parsed query within the given workspaces
+func (s *Store) searchNotesIn(ctx context.Context, workspaceIDs []int, q db.SearchQuery, mode string) ([]db.Note, error) {
+	if len(workspaceIDs) == 0 || q.IsEmpty() {
+		return []db.Note{}, nil
+	}
+
+	var args []interface{}
+	where := searchConditions(workspaceIDs, q, mode, &args)
+	rows, err := s.q.QueryContext(ctx, "SELECT "+noteColumns+" FROM notes n WHERE "+where+" ORDER BY n.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []db.Note{}
+	for rows.Next() {
+		var n db.Note
+		if err := scanNote(rows.Scan, &n); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.AttachTags(ctx, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// countNotesIn counts the notes a parsed query matches within the given
+// workspaces
+func (s *Store) countNotesIn(ctx context.Context, workspaceIDs []int, q db.SearchQuery, mode string) (int, error) {
+	if len(workspaceIDs) == 0 || q.IsEmpty() {
+		return 0, nil
+	}
+	var args []interface{}
+	where := searchConditions(workspaceIDs, q, mode, &args)
+	var count int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM notes n WHERE "+where, args...).Scan(&count)
+	return count, err
+}
+
+// searchConditions translates a parsed query into a WHERE clause over
+// "notes n", with the same filters as the PostgreSQL search
+func searchConditions(workspaceIDs []int, q db.SearchQuery, mode string, args *[]interface{}) string {
+	conditions := []string{"n.workspace_id IN (" + placeholders(workspaceIDs, args) + ")", "n.is_trashed = FALSE"}
+	next := func(v interface{}) int {
+		*args = append(*args, v)
+		return len(*args)
+	}
+
+	for _, tag := range q.Tags {
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND LOWER(t.name) = LOWER($%d))",
+			next(tag)))
+	}
+	if q.WorkspaceID != nil {
+		conditions = append(conditions, fmt.Sprintf("n.workspace_id = $%d", next(*q.WorkspaceID)))
+	}
+	if q.FolderID != nil {
+		conditions = append(conditions, fmt.Sprintf("n.folder_id = $%d", next(*q.FolderID)))
+	}
+	if q.Author != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			"n.created_by = (SELECT id FROM users WHERE LOWER(username) = LOWER($%d))", next(q.Author)))
+	}
+	if q.Color != "" {
+		conditions = append(conditions, fmt.Sprintf("LOWER(n.color) = LOWER($%d)", next(q.Color)))
+	}
+	if q.UpdatedAfter != nil {
+		conditions = append(conditions, fmt.Sprintf("n.updated_at >= $%d", next(q.UpdatedAfter.UTC().Format(timestampLayout))))
+	}
+	if q.UpdatedBefore != nil {
+		conditions = append(conditions, fmt.Sprintf("n.updated_at < $%d", next(q.UpdatedBefore.UTC().Format(timestampLayout))))
+	}
+
+	if q.Text != "" {
+		likeArg := next("%" + strings.ToLower(q.Text) + "%")
+		textMatch := fmt.Sprintf(`LOWER(n.title) LIKE $%d
+			OR EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND LOWER(t.name) LIKE $%d)`,
+			likeArg, likeArg)
+		if match := ftsQuery(q.Text); mode == "full" && match != "" {
+			// Each note is matched in the index of its search language
+			matchArg := next(match)
+			textMatch += fmt.Sprintf(`
+			OR (n.search_language <> 'simple' AND n.id IN (SELECT rowid FROM notes_fts WHERE notes_fts MATCH $%d))
+			OR (n.search_language = 'simple' AND n.id IN (SELECT rowid FROM notes_fts_simple WHERE notes_fts_simple MATCH $%d))`,
+				matchArg, matchArg)
+		}
+		conditions = append(conditions, "("+textMatch+")")
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// ftsQuery turns free text into an FTS5 query that, like plainto_tsquery,
+// requires every word and treats operators as plain text. Words are quoted
+// so characters such as '-' or '*' are not parsed as FTS5 syntax.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ")
+}
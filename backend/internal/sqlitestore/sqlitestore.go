@@ -0,0 +1,908 @@
+// Package sqlitestore implements the data layer on SQLite, for single-user
+// and embedded deployments selected with DB_DRIVER=sqlite. It satisfies the
+// store interfaces of the server package with the same observable behaviour
+// as the PostgreSQL store; the schema comes from internal/migrations/sqlite.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-notes/backend/internal/db"
+)
+
+// now is the SQL for the current time in the format the migrations use for
+// timestamp columns: ISO 8601 UTC text, which sorts chronologically
+const now = "strftime('%Y-%m-%dT%H:%M:%fZ', 'now')"
+
+// subtree selects a folder's ID and those of all folders below it; the
+// folder ID is bound to the given placeholder
+func subtree(param string) string {
+	return `WITH RECURSIVE tree(id) AS (
+			SELECT id FROM folders WHERE id = ` + param + `
+			UNION ALL
+			SELECT f.id FROM folders f JOIN tree t ON f.parent_id = t.id
+		)
+		SELECT id FROM tree`
+}
+
+// Store runs the data layer's queries against SQLite. Compound operations
+// run in a transaction via WithTx, as in db.Store.
+type Store struct {
+	db *sql.DB
+	q  db.DBTX  // db, or the transaction this store is bound to
+	tx *txState // nil outside a transaction
+
+	// initializeDocument writes the intro content of a new user's first note
+	initializeDocument func(ctx context.Context, roomID string, userID int)
+}
+
+type txState struct {
+	afterCommit []func()
+}
+
+// New returns a store using the connection pool, which must have been
+// opened with db.Connect so foreign keys are enforced
+func New(database *sql.DB) *Store {
+	return &Store{db: database, q: database, initializeDocument: db.InitializeDocument}
+}
+
+// DB returns the connection pool
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// WithTx runs fn with a store bound to a new transaction, committing when fn
+// returns nil and rolling back otherwise. On a store that is already in a
+// transaction fn joins it.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	state := &txState{}
+	if err := fn(&Store{db: s.db, q: tx, tx: state, initializeDocument: s.initializeDocument}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range state.afterCommit {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit defers side effects outside the database until the
+// surrounding transaction has committed
+func (s *Store) afterCommit(fn func()) {
+	if s.tx == nil {
+		fn()
+		return
+	}
+	s.tx.afterCommit = append(s.tx.afterCommit, fn)
+}
+
+// placeholders appends ids to args and returns their placeholders, for IN lists
+func placeholders(ids []int, args *[]interface{}) string {
+	marks := make([]string, len(ids))
+	for i, id := range ids {
+		*args = append(*args, id)
+		marks[i] = fmt.Sprintf("$%d", len(*args))
+	}
+	return strings.Join(marks, ", ")
+}
+
+// --- Users ---
+
+func (s *Store) GetUserCount(ctx context.Context) (int, error) {
+	var count int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func (s *Store) CreateAdmin(ctx context.Context, username, passwordHash string) error {
+	return s.CreateUser(ctx, username, passwordHash, true)
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (*db.User, error) {
+	var u db.User
+	err := s.q.QueryRowContext(ctx, "SELECT id, username, password_hash, is_admin, disabled_at IS NOT NULL, created_at FROM users WHERE id = $1", id).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.Disabled, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (*db.User, error) {
+	var u db.User
+	err := s.q.QueryRowContext(ctx, "SELECT id, username, password_hash, is_admin, disabled_at IS NOT NULL, created_at FROM users WHERE username = $1", username).
+		Scan(&u.ID, &u.Username, &u.PasswordHash, &u.IsAdmin, &u.Disabled, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// IsActiveUser reports whether a user exists and is not disabled
+func (s *Store) IsActiveUser(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := s.q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND disabled_at IS NULL)", id).Scan(&exists)
+	return exists, err
+}
+
+// ListUsers omits password hashes
+func (s *Store) ListUsers(ctx context.Context) ([]db.User, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT id, username, is_admin, disabled_at IS NOT NULL, created_at FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []db.User{}
+	for rows.Next() {
+		var u db.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.Disabled, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// CreateUser adds a user together with their default workspace and intro
+// note; either everything is created or nothing is
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string, isAdmin bool) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		var userID int
+		err := tx.q.QueryRowContext(ctx, "INSERT INTO users (username, password_hash, is_admin) VALUES ($1, $2, $3) RETURNING id", username, passwordHash, isAdmin).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		wsID, err := tx.CreateWorkspace(ctx, "Default WS", userID)
+		if err != nil {
+			return err
+		}
+		noteID, err := tx.CreateNote(ctx, wsID, "Intro & Guide", nil, &userID, "#FFFFFF")
+		if err != nil {
+			return err
+		}
+		roomID := fmt.Sprintf("w%d_n%d", wsID, noteID)
+		tx.afterCommit(func() { tx.initializeDocument(ctx, roomID, userID) })
+		return nil
+	})
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int, username, passwordHash string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE users SET username=$1, password_hash=$2 WHERE id=$3", username, passwordHash, id)
+	return err
+}
+
+// SetUserDisabled blocks or re-enables a user
+func (s *Store) SetUserDisabled(ctx context.Context, id int, disabled bool) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE users SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, "+now+") END WHERE id=$2", disabled, id)
+	return err
+}
+
+// SetUserPassword replaces a user's password hash
+func (s *Store) SetUserPassword(ctx context.Context, id int, passwordHash string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE users SET password_hash=$1 WHERE id=$2", passwordHash, id)
+	return err
+}
+
+// SetUserAdmin grants or revokes admin rights; issued tokens keep the old
+// flag until they are refreshed
+func (s *Store) SetUserAdmin(ctx context.Context, id int, isAdmin bool) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE users SET is_admin=$1 WHERE id=$2", isAdmin, id)
+	return err
+}
+
+// CountActiveAdmins counts admins who are not disabled
+func (s *Store) CountActiveAdmins(ctx context.Context) (int, error) {
+	var count int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE is_admin AND disabled_at IS NULL").Scan(&count)
+	return count, err
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM users WHERE id=$1", id)
+	return err
+}
+
+// --- Workspaces ---
+
+func (s *Store) CreateWorkspace(ctx context.Context, name string, ownerID int) (int, error) {
+	var id int
+	err := s.WithTx(ctx, func(tx *Store) error {
+		err := tx.q.QueryRowContext(ctx, "INSERT INTO workspaces (name, owner_id) VALUES ($1, $2) RETURNING id", name, ownerID).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, 'owner')", id, ownerID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) ListWorkspaces(ctx context.Context, userID int) ([]db.Workspace, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT w.id, w.name, w.owner_id, w.created_at, w.search_language
+		FROM workspaces w
+		JOIN workspace_members wm ON wm.workspace_id = w.id
+		WHERE wm.user_id = $1
+		ORDER BY w.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var workspaces []db.Workspace
+	for rows.Next() {
+		var w db.Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	return workspaces, rows.Err()
+}
+
+// ListAllWorkspaces returns every workspace on the server
+func (s *Store) ListAllWorkspaces(ctx context.Context) ([]db.WorkspaceSummary, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT w.id, w.name, w.owner_id, w.created_at, w.search_language, u.username,
+		       (SELECT COUNT(*) FROM workspace_members wm WHERE wm.workspace_id = w.id),
+		       (SELECT COUNT(*) FROM notes n WHERE n.workspace_id = w.id AND NOT n.is_trashed)
+		FROM workspaces w
+		JOIN users u ON u.id = w.owner_id
+		ORDER BY w.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	workspaces := []db.WorkspaceSummary{}
+	for rows.Next() {
+		var w db.WorkspaceSummary
+		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage, &w.OwnerName, &w.Members, &w.Notes); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, w)
+	}
+	return workspaces, rows.Err()
+}
+
+func (s *Store) GetWorkspace(ctx context.Context, id int) (*db.Workspace, error) {
+	var w db.Workspace
+	err := s.q.QueryRowContext(ctx, "SELECT id, name, owner_id, created_at, search_language FROM workspaces WHERE id = $1", id).
+		Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *Store) UpdateWorkspace(ctx context.Context, id int, name string) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE workspaces SET name=$1 WHERE id=$2", name, id)
+	return err
+}
+
+func (s *Store) DeleteWorkspace(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM workspaces WHERE id=$1", id)
+	return err
+}
+
+func (s *Store) ListWorkspaceMembers(ctx context.Context, workspaceID int) ([]db.WorkspaceMember, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT workspace_id, user_id, role FROM workspace_members WHERE workspace_id = $1", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []db.WorkspaceMember
+	for rows.Next() {
+		var wm db.WorkspaceMember
+		if err := rows.Scan(&wm.WorkspaceID, &wm.UserID, &wm.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, wm)
+	}
+	return members, rows.Err()
+}
+
+func (s *Store) AddWorkspaceMember(ctx context.Context, workspaceID, userID int, role string) error {
+	_, err := s.q.ExecContext(ctx, "INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", workspaceID, userID, role)
+	return err
+}
+
+func (s *Store) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID)
+	return err
+}
+
+func (s *Store) TransferWorkspaceOwnership(ctx context.Context, workspaceID, newOwnerID int) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		_, err := tx.q.ExecContext(ctx, "UPDATE workspaces SET owner_id=$1 WHERE id=$2", newOwnerID, workspaceID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE workspace_members SET role='owner' WHERE workspace_id=$1 AND user_id=$2", workspaceID, newOwnerID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE workspace_members SET role='member' WHERE workspace_id=$1 AND user_id!=$2 AND role='owner'", workspaceID, newOwnerID)
+		return err
+	})
+}
+
+func (s *Store) IsWorkspaceOwner(ctx context.Context, workspaceID, userID int) (bool, error) {
+	var count int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspaces WHERE id=$1 AND owner_id=$2", workspaceID, userID).Scan(&count)
+	return count > 0, err
+}
+
+func (s *Store) IsWorkspaceMember(ctx context.Context, workspaceID, userID int) (bool, error) {
+	var count int
+	err := s.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspace_members WHERE workspace_id=$1 AND user_id=$2", workspaceID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// MemberWorkspaceIDs returns the IDs of all workspaces the user belongs to
+func (s *Store) MemberWorkspaceIDs(ctx context.Context, userID int) ([]int, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT workspace_id FROM workspace_members WHERE user_id = $1 ORDER BY workspace_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// --- Folders ---
+
+func (s *Store) CreateFolder(ctx context.Context, workspaceID int, name string, parentID *int) (int, error) {
+	var id int
+	err := s.q.QueryRowContext(ctx,
+		"INSERT INTO folders (workspace_id, name, parent_id) VALUES ($1, $2, $3) RETURNING id",
+		workspaceID, name, parentID,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) GetFolder(ctx context.Context, id int) (*db.Folder, error) {
+	var f db.Folder
+	err := s.q.QueryRowContext(ctx, "SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE id = $1", id).
+		Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *Store) ListFolders(ctx context.Context, workspaceID int) ([]db.Folder, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE workspace_id = $1 ORDER BY id", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var folders []db.Folder
+	for rows.Next() {
+		var f db.Folder
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// isDescendantFolder reports whether candidateID is folderID or lies below it
+func (s *Store) isDescendantFolder(ctx context.Context, folderID, candidateID int) (bool, error) {
+	var found bool
+	err := s.q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM ("+subtree("$1")+") WHERE id = $2)", folderID, candidateID).Scan(&found)
+	return found, err
+}
+
+// UpdateFolderWithCascade renames or moves a folder; moving it to another
+// workspace takes its subfolders and notes along
+func (s *Store) UpdateFolderWithCascade(ctx context.Context, folderID int, name string, parentID *int, workspaceID *int) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		oldFolder, err := tx.GetFolder(ctx, folderID)
+		if err != nil {
+			return err
+		}
+
+		// If parentID is changing, validate it won't create a cycle
+		if parentID != nil && (oldFolder.ParentID == nil || *parentID != *oldFolder.ParentID) {
+			isDescendant, err := tx.isDescendantFolder(ctx, folderID, *parentID)
+			if err != nil {
+				return err
+			}
+			if isDescendant {
+				return fmt.Errorf("cannot move folder into itself or its descendants")
+			}
+
+			if workspaceID != nil && *workspaceID != oldFolder.WorkspaceID {
+				parentFolder, err := tx.GetFolder(ctx, *parentID)
+				if err != nil {
+					return fmt.Errorf("parent folder not found")
+				}
+				if parentFolder.WorkspaceID != *workspaceID {
+					return fmt.Errorf("parent folder must be in target workspace")
+				}
+			}
+		}
+
+		targetWorkspace := oldFolder.WorkspaceID
+		if workspaceID != nil {
+			targetWorkspace = *workspaceID
+		}
+		_, err = tx.q.ExecContext(ctx,
+			"UPDATE folders SET name=$1, parent_id=$2, workspace_id=$3 WHERE id=$4",
+			name, parentID, targetWorkspace, folderID,
+		)
+		if err != nil || targetWorkspace == oldFolder.WorkspaceID {
+			return err
+		}
+
+		// Cascade the new workspace to every folder and note in the subtree
+		_, err = tx.q.ExecContext(ctx, "UPDATE folders SET workspace_id=$1 WHERE id IN ("+subtree("$2")+")", targetWorkspace, folderID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, `
+			UPDATE notes SET workspace_id=$1,
+				search_language = CASE WHEN search_language_inherited THEN (SELECT search_language FROM workspaces WHERE id=$1) ELSE search_language END
+			WHERE folder_id IN (`+subtree("$2")+`)
+		`, targetWorkspace, folderID)
+		return err
+	})
+}
+
+// DeleteFolder deletes a folder and its subfolders. Their live notes are
+// moved to the trash and all their notes to the deleted folder's parent,
+// in one transaction.
+func (s *Store) DeleteFolder(ctx context.Context, id int) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		var parentID *int
+		err := tx.q.QueryRowContext(ctx, "SELECT parent_id FROM folders WHERE id=$1", id).Scan(&parentID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.q.ExecContext(ctx, "UPDATE notes SET is_trashed=TRUE, trashed_at="+now+" WHERE is_trashed=FALSE AND folder_id IN ("+subtree("$1")+")", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE notes SET folder_id=$1 WHERE folder_id IN ("+subtree("$2")+")", parentID, id)
+		if err != nil {
+			return err
+		}
+
+		// Subfolders go with it through ON DELETE CASCADE
+		_, err = tx.q.ExecContext(ctx, "DELETE FROM folders WHERE id=$1", id)
+		return err
+	})
+}
+
+// --- Notes ---
+
+const noteColumns = `n.id, n.workspace_id, n.title, n.yjs_room_id, n.folder_id, n.created_by, n.created_at, n.updated_at,
+	n.is_trashed, n.trashed_at, n.color, n.search_language, n.search_language_inherited`
+
+func scanNote(scan func(dest ...any) error, n *db.Note, extra ...any) error {
+	dest := []any{&n.ID, &n.WorkspaceID, &n.Title, &n.YjsRoomID, &n.FolderID, &n.CreatedBy, &n.CreatedAt, &n.UpdatedAt,
+		&n.IsTrashed, &n.TrashedAt, &n.Color, &n.SearchLanguage, &n.SearchLanguageInherited}
+	return scan(append(dest, extra...)...)
+}
+
+func (s *Store) CreateNote(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string) (int, error) {
+	if color == "" {
+		color = "#FFFFFF"
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+
+	var id int
+	err := s.WithTx(ctx, func(tx *Store) error {
+		// The room ID embeds the note ID, so it is set once the row exists
+		err := tx.q.QueryRowContext(ctx,
+			"INSERT INTO notes (workspace_id, title, yjs_room_id, folder_id, created_by, color, search_language) VALUES ($1, $2, $3, $4, $5, $6, (SELECT search_language FROM workspaces WHERE id = $1)) RETURNING id",
+			workspaceID, title, "temp", folderID, createdBy, color,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "UPDATE notes SET yjs_room_id=$1 WHERE id=$2", fmt.Sprintf("w%d_n%d", workspaceID, id), id)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// CreateNoteWithTags creates a note and sets its tags in one transaction
+func (s *Store) CreateNoteWithTags(ctx context.Context, workspaceID int, title string, folderID *int, createdBy *int, color string, tags []string) (int, error) {
+	var id int
+	err := s.WithTx(ctx, func(tx *Store) error {
+		var err error
+		id, err = tx.CreateNote(ctx, workspaceID, title, folderID, createdBy, color)
+		if err != nil || len(tags) == 0 {
+			return err
+		}
+		return tx.SetTagsForNote(ctx, id, tags)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) GetNote(ctx context.Context, id int) (*db.Note, error) {
+	var n db.Note
+	row := s.q.QueryRowContext(ctx, "SELECT "+noteColumns+" FROM notes n WHERE n.id = $1", id)
+	if err := scanNote(row.Scan, &n); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// noteSortColumns maps a sort name to its SQL expression. Timestamps are
+// ISO 8601 text, so every key compares as text.
+var noteSortColumns = map[string]string{
+	"created": "n.created_at",
+	"updated": "n.updated_at",
+	"title":   "LOWER(n.title)",
+	"color":   "COALESCE(n.color, '')",
+}
+
+// noteCursor is the position after the last note of a page
+type noteCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+func encodeNoteCursor(c noteCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeNoteCursor(s string) (noteCursor, error) {
+	var c noteCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, db.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, db.ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ListNotesPage lists a workspace's notes using keyset pagination on
+// (sort column, id), then batch-loads their tags
+func (s *Store) ListNotesPage(ctx context.Context, workspaceID int, opts db.NoteListOptions) (*db.NotePage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "created"
+	}
+	col, ok := noteSortColumns[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+
+	conds := []string{"n.workspace_id = $1"}
+	args := []interface{}{workspaceID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.FolderID != nil {
+		conds = append(conds, "n.folder_id = "+arg(*opts.FolderID))
+	}
+	if opts.Trashed != nil {
+		conds = append(conds, "n.is_trashed = "+arg(*opts.Trashed))
+	}
+	if opts.Tag != "" {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE nt.note_id = n.id AND LOWER(t.name) = LOWER(`+arg(opts.Tag)+`))`)
+	}
+	if opts.CreatedBy != nil {
+		conds = append(conds, "n.created_by = "+arg(*opts.CreatedBy))
+	}
+
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if opts.Cursor != "" {
+		c, err := decodeNoteCursor(opts.Cursor)
+		if err != nil || c.Sort != opts.Sort {
+			return nil, db.ErrInvalidCursor
+		}
+		conds = append(conds, fmt.Sprintf("(%s, n.id) %s (%s, %s)", col, cmp, arg(c.Key), arg(c.ID)))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM notes n
+		WHERE %s
+		ORDER BY %s %s, n.id %s`, noteColumns, col, strings.Join(conds, " AND "), col, dir, dir)
+	if opts.Limit > 0 {
+		// One extra row tells us whether there is a next page
+		query += " LIMIT " + arg(opts.Limit+1)
+	}
+
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &db.NotePage{Notes: []db.Note{}}
+	var keys []string
+	for rows.Next() {
+		var n db.Note
+		var key string
+		if err := scanNote(rows.Scan, &n, &key); err != nil {
+			return nil, err
+		}
+		page.Notes = append(page.Notes, n)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Limit > 0 && len(page.Notes) > opts.Limit {
+		page.Notes = page.Notes[:opts.Limit]
+		last := page.Notes[opts.Limit-1]
+		page.NextCursor = encodeNoteCursor(noteCursor{Sort: opts.Sort, Key: keys[opts.Limit-1], ID: last.ID})
+	}
+
+	if err := s.AttachTags(ctx, page.Notes); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *Store) ListTrashedNotes(ctx context.Context, workspaceID int) ([]db.Note, error) {
+	trashed := true
+	page, err := s.ListNotesPage(ctx, workspaceID, db.NoteListOptions{Trashed: &trashed})
+	if err != nil {
+		return nil, err
+	}
+	return page.Notes, nil
+}
+
+// AttachTags batch loads tags onto the given notes in place
+func (s *Store) AttachTags(ctx context.Context, notes []db.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	noteIDs := make([]int, len(notes))
+	for i, n := range notes {
+		noteIDs[i] = n.ID
+	}
+	var args []interface{}
+	rows, err := s.q.QueryContext(ctx, `
+		SELECT nt.note_id, t.id, t.name
+		FROM note_tags nt
+		JOIN tags t ON t.id = nt.tag_id
+		WHERE nt.note_id IN (`+placeholders(noteIDs, &args)+`)
+		ORDER BY nt.note_id, LOWER(t.name)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tagMap := make(map[int][]db.Tag)
+	for rows.Next() {
+		var noteID int
+		var t db.Tag
+		if err := rows.Scan(&noteID, &t.ID, &t.Name); err != nil {
+			return err
+		}
+		tagMap[noteID] = append(tagMap[noteID], t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range notes {
+		notes[i].Tags = tagMap[notes[i].ID]
+	}
+	return nil
+}
+
+// UpdateNoteMetadata updates note metadata fields; content is left to the
+// document service
+func (s *Store) UpdateNoteMetadata(ctx context.Context, noteID int, updates map[string]interface{}) error {
+	allowedFields := map[string]bool{
+		"title": true, "folder_id": true, "workspace_id": true, "color": true,
+	}
+
+	setClauses := []string{"updated_at=" + now}
+	args := []interface{}{}
+
+	for field, value := range updates {
+		if !allowedFields[field] {
+			continue
+		}
+		// Safe because field is validated against whitelist
+		args = append(args, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s=$%d", field, len(args)))
+	}
+
+	// Notes that follow their workspace's search language pick up the new workspace's setting
+	if workspaceID, moving := updates["workspace_id"]; moving {
+		args = append(args, workspaceID)
+		setClauses = append(setClauses, fmt.Sprintf(
+			"search_language = CASE WHEN search_language_inherited THEN (SELECT search_language FROM workspaces WHERE id=$%d) ELSE search_language END",
+			len(args)))
+	}
+
+	args = append(args, noteID)
+	query := fmt.Sprintf("UPDATE notes SET %s WHERE id=$%d", strings.Join(setClauses, ", "), len(args))
+	_, err := s.q.ExecContext(ctx, query, args...)
+	return err
+}
+
+// UpdateNoteSearchText updates the searchable plain text content, reporting
+// whether it changed; triggers keep the FTS5 index in step
+func (s *Store) UpdateNoteSearchText(ctx context.Context, noteID int, contentText string) (bool, error) {
+	res, err := s.q.ExecContext(ctx, "UPDATE notes SET content_text=$1, updated_at="+now+" WHERE id=$2 AND content_text IS NOT $1", contentText, noteID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) TrashNote(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE notes SET is_trashed=TRUE, trashed_at="+now+" WHERE id=$1", id)
+	return err
+}
+
+func (s *Store) RestoreNote(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "UPDATE notes SET is_trashed=FALSE, trashed_at=NULL WHERE id=$1", id)
+	return err
+}
+
+func (s *Store) DeleteNote(ctx context.Context, id int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM notes WHERE id=$1", id)
+	return err
+}
+
+func (s *Store) EmptyWorkspaceTrash(ctx context.Context, workspaceID int) error {
+	_, err := s.q.ExecContext(ctx, "DELETE FROM notes WHERE workspace_id=$1 AND is_trashed=TRUE", workspaceID)
+	return err
+}
+
+// AutoEmptyTrash deletes notes trashed more than TRASH_AUTO_DELETE_DAYS
+// (default 30) days ago
+func (s *Store) AutoEmptyTrash(ctx context.Context) error {
+	days := 30
+	if d, err := strconv.Atoi(os.Getenv("TRASH_AUTO_DELETE_DAYS")); err == nil && d > 0 {
+		days = d
+	}
+	_, err := s.q.ExecContext(ctx,
+		"DELETE FROM notes WHERE is_trashed=TRUE AND trashed_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)",
+		fmt.Sprintf("-%d days", days))
+	return err
+}
+
+// PurgeTrash permanently deletes trashed notes, in one workspace or all
+// when workspaceID is 0, that were trashed more than olderThanDays ago
+// (0 purges everything). It returns the number of notes deleted.
+func (s *Store) PurgeTrash(ctx context.Context, workspaceID, olderThanDays int) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `
+		DELETE FROM notes
+		WHERE is_trashed = TRUE
+		  AND ($1 = 0 OR workspace_id = $1)
+		  AND ($2 = 0 OR trashed_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $3))
+	`, workspaceID, olderThanDays, fmt.Sprintf("-%d days", olderThanDays))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// --- Tags ---
+
+func (s *Store) GetOrCreateTag(ctx context.Context, name string) (db.Tag, error) {
+	var t db.Tag
+	err := s.q.QueryRowContext(ctx, "INSERT INTO tags (name) VALUES ($1) ON CONFLICT DO NOTHING RETURNING id, name", name).Scan(&t.ID, &t.Name)
+	if err == sql.ErrNoRows {
+		err = s.q.QueryRowContext(ctx, "SELECT id, name FROM tags WHERE LOWER(name)=LOWER($1)", name).Scan(&t.ID, &t.Name)
+	}
+	return t, err
+}
+
+func (s *Store) ListTags(ctx context.Context) ([]db.Tag, error) {
+	return s.queryTags(ctx, "SELECT id, name FROM tags ORDER BY LOWER(name)")
+}
+
+func (s *Store) ListTagsForNote(ctx context.Context, noteID int) ([]db.Tag, error) {
+	return s.queryTags(ctx, `
+		SELECT t.id, t.name
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		WHERE nt.note_id = $1
+		ORDER BY LOWER(t.name)
+	`, noteID)
+}
+
+func (s *Store) ListTagsForWorkspace(ctx context.Context, workspaceID int) ([]db.Tag, error) {
+	return s.queryTags(ctx, `
+		SELECT t.id, t.name
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE n.workspace_id = $1
+		GROUP BY t.id, t.name
+		ORDER BY LOWER(t.name)
+	`, workspaceID)
+}
+
+func (s *Store) queryTags(ctx context.Context, query string, args ...interface{}) ([]db.Tag, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []db.Tag
+	for rows.Next() {
+		var t db.Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// SetTagsForNote replaces a note's tags, creating missing ones, atomically
+func (s *Store) SetTagsForNote(ctx context.Context, noteID int, tagNames []string) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		_, err := tx.q.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id = $1", noteID)
+		if err != nil {
+			return err
+		}
+		for _, name := range tagNames {
+			t, err := tx.GetOrCreateTag(ctx, name)
+			if err != nil {
+				return fmt.Errorf("GetOrCreateTag failed for tag '%s': %v", name, err)
+			}
+			_, err = tx.q.ExecContext(ctx, "INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", noteID, t.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to insert note_tag for note %d tag %d: %v", noteID, t.ID, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,744 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+)
+
+// newTestStore migrates a fresh database file and records the documents
+// that would have been initialised
+func newTestStore(t *testing.T) (*Store, *[]string) {
+	t.Helper()
+	t.Setenv("DB_DRIVER", db.DriverSQLite)
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "notes.db"))
+	require.NoError(t, db.RunMigrations())
+	database, err := db.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	var rooms []string
+	s := New(database)
+	s.initializeDocument = func(ctx context.Context, roomID string, userID int) { rooms = append(rooms, roomID) }
+	return s, &rooms
+}
+
+func createUser(t *testing.T, s *Store, name string) (userID, workspaceID int) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.CreateUser(ctx, name, "hash", false))
+	u, err := s.GetUserByUsername(ctx, name)
+	require.NoError(t, err)
+	workspaces, err := s.ListWorkspaces(ctx, u.ID)
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+	return u.ID, workspaces[0].ID
+}
+
+func TestCreateUser(t *testing.T) {
+	s, rooms := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+
+	page, err := s.ListNotesPage(ctx, wsID, db.NoteListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Notes, 1)
+	intro := page.Notes[0]
+	assert.Equal(t, "Intro & Guide", intro.Title)
+	assert.Equal(t, *intro.CreatedBy, userID)
+	assert.Equal(t, []string{intro.YjsRoomID}, *rooms, "intro document initialised after commit")
+	assert.Regexp(t, `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z$`, intro.CreatedAt)
+
+	owner, err := s.IsWorkspaceOwner(ctx, wsID, userID)
+	require.NoError(t, err)
+	assert.True(t, owner)
+
+	// A duplicate username rolls back without touching the document service
+	assert.Error(t, s.CreateUser(ctx, "alice", "hash", false))
+	assert.Len(t, *rooms, 1)
+	count, err := s.GetUserCount(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, s.SetUserDisabled(ctx, userID, true))
+	active, err := s.IsActiveUser(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// Deleting the user cascades to the workspace and its notes
+	require.NoError(t, s.DeleteUser(ctx, userID))
+	_, err = s.GetNote(ctx, intro.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestFolderTree(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	_, otherWS := createUser(t, s, "bob")
+
+	root, err := s.CreateFolder(ctx, wsID, "root", nil)
+	require.NoError(t, err)
+	child, err := s.CreateFolder(ctx, wsID, "child", &root)
+	require.NoError(t, err)
+	grandchild, err := s.CreateFolder(ctx, wsID, "grandchild", &child)
+	require.NoError(t, err)
+	deep, err := s.CreateNote(ctx, wsID, "deep", &grandchild, &userID, "")
+	require.NoError(t, err)
+
+	// Cycles are rejected however deep
+	err = s.UpdateFolderWithCascade(ctx, root, "root", &grandchild, nil)
+	assert.ErrorContains(t, err, "cannot move folder into itself")
+
+	// Moving to another workspace takes the subtree along
+	require.NoError(t, s.UpdateFolderWithCascade(ctx, child, "child", nil, &otherWS))
+	for _, id := range []int{child, grandchild} {
+		f, err := s.GetFolder(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, otherWS, f.WorkspaceID)
+	}
+	n, err := s.GetNote(ctx, deep)
+	require.NoError(t, err)
+	assert.Equal(t, otherWS, n.WorkspaceID)
+
+	// Deleting a folder trashes the notes below it and moves them up
+	require.NoError(t, s.DeleteFolder(ctx, child))
+	n, err = s.GetNote(ctx, deep)
+	require.NoError(t, err)
+	assert.True(t, n.IsTrashed)
+	assert.NotNil(t, n.TrashedAt)
+	assert.Nil(t, n.FolderID)
+	_, err = s.GetFolder(ctx, grandchild)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestListNotesPage(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	for _, title := range []string{"b", "D", "a", "c"} {
+		_, err := s.CreateNoteWithTags(ctx, wsID, title, nil, &userID, "", []string{"Work"})
+		require.NoError(t, err)
+	}
+
+	var titles []string
+	opts := db.NoteListOptions{Sort: "title", Desc: true, Limit: 2, Tag: "work"}
+	for {
+		page, err := s.ListNotesPage(ctx, wsID, opts)
+		require.NoError(t, err)
+		for _, n := range page.Notes {
+			titles = append(titles, n.Title)
+			assert.Equal(t, []db.Tag{{ID: n.Tags[0].ID, Name: "Work"}}, n.Tags)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"D", "c", "b", "a"}, titles)
+
+	_, err := s.ListNotesPage(ctx, wsID, db.NoteListOptions{Sort: "created", Cursor: opts.Cursor})
+	assert.ErrorIs(t, err, db.ErrInvalidCursor)
+}
+
+func TestTagsAreCaseInsensitive(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	noteID, err := s.CreateNote(ctx, wsID, "note", nil, &userID, "")
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetTagsForNote(ctx, noteID, []string{"Go", "go", "SQL"}))
+	tags, err := s.ListTagsForNote(ctx, noteID)
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "Go", tags[0].Name)
+	assert.Equal(t, "SQL", tags[1].Name)
+
+	all, err := s.ListTags(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestSearchNotes(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	_, otherWS := createUser(t, s, "bob")
+
+	recipe, err := s.CreateNoteWithTags(ctx, wsID, "Recipes", nil, &userID, "", []string{"cooking"})
+	require.NoError(t, err)
+	changed, err := s.UpdateNoteSearchText(ctx, recipe, "Running out of flour? Bake flatbreads instead.")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = s.UpdateNoteSearchText(ctx, recipe, "Running out of flour? Bake flatbreads instead.")
+	require.NoError(t, err)
+	assert.False(t, changed, "the same text again")
+	trashed, err := s.CreateNote(ctx, wsID, "Old recipes", nil, &userID, "")
+	require.NoError(t, err)
+	require.NoError(t, s.TrashNote(ctx, trashed))
+	hidden, err := s.CreateNote(ctx, otherWS, "Bob's recipes", nil, nil, "")
+	require.NoError(t, err)
+	_, err = s.UpdateNoteSearchText(ctx, hidden, "running")
+	require.NoError(t, err)
+
+	ids := func(query, mode string) []int {
+		notes, err := s.SearchNotes(ctx, userID, query, mode)
+		require.NoError(t, err)
+		out := []int{}
+		for _, n := range notes {
+			out = append(out, n.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []int{recipe}, ids("recipe", "metadata"))
+	assert.Equal(t, []int{recipe}, ids("cook", "metadata"), "tags match by substring")
+	assert.Empty(t, ids("run", "metadata"), "content needs full mode")
+	assert.Equal(t, []int{recipe}, ids("run flour", "full"), "porter stemming, every word required")
+	assert.Empty(t, ids("run sugar", "full"))
+	assert.Equal(t, []int{recipe}, ids(`flour* -"bake`, "full"), "FTS5 operators are plain text")
+	assert.Equal(t, []int{recipe}, ids("tag:Cooking", "metadata"))
+	assert.Empty(t, ids("tag:cooking author:bob", "metadata"))
+	assert.Equal(t, []int{recipe}, ids("after:2000-01-01 bake", "full"))
+	assert.Empty(t, ids("before:2000-01-01", "full"))
+
+	// Edits replace the indexed text
+	_, err = s.UpdateNoteSearchText(ctx, recipe, "Nothing to see")
+	require.NoError(t, err)
+	assert.Empty(t, ids("flour", "full"))
+	require.NoError(t, s.DeleteNote(ctx, recipe))
+	assert.Empty(t, ids("nothing", "full"))
+}
+
+// The yjs server persists documents in notes.content keyed by note ID, with
+// the same statements as on PostgreSQL apart from the timestamp format
+func TestDocumentContentColumn(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	noteID, err := s.CreateNote(ctx, wsID, "doc", nil, &userID, "")
+	require.NoError(t, err)
+
+	state := []byte{0x01, 0x02, 0x00, 0xff}
+	_, err = s.DB().ExecContext(ctx, "UPDATE notes SET content=$1, updated_at="+now+" WHERE id=$2", state, noteID)
+	require.NoError(t, err)
+	var content []byte
+	require.NoError(t, s.DB().QueryRowContext(ctx, "SELECT content FROM notes WHERE id=$1", noteID).Scan(&content))
+	assert.Equal(t, state, content)
+
+	// Metadata changes leave the document alone
+	require.NoError(t, s.UpdateNoteMetadata(ctx, noteID, map[string]interface{}{"title": "renamed", "color": "#000000"}))
+	require.NoError(t, s.DB().QueryRowContext(ctx, "SELECT content FROM notes WHERE id=$1", noteID).Scan(&content))
+	assert.Equal(t, state, content)
+}
+
+func TestImportWorkspace(t *testing.T) {
+	s, rooms := newTestStore(t)
+	ctx := context.Background()
+	userID, _ := createUser(t, s, "alice")
+
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	trashed := created.Add(time.Hour)
+	parent := 7
+	imported, err := s.ImportWorkspace(ctx, userID, db.WorkspaceImport{
+		Name:      "Restored",
+		CreatedAt: &created,
+		Folders: []db.ImportFolder{
+			{Key: 7, Name: "Parent", CreatedAt: &created},
+			{Key: 8, ParentKey: &parent, Name: "Child"},
+		},
+		Notes: []db.ImportNote{
+			{Key: 20, FolderKey: &parent, Title: "Kept", Color: "#FFEB3B", Tags: []string{"Go"},
+				CreatedAt: &created, Content: []byte{1, 2, 3}, ContentText: "imported words"},
+			{Key: 21, Title: "Binned", Color: "#FFFFFF", IsTrashed: true, TrashedAt: &trashed},
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, *rooms, 1, "imported notes bring their own content")
+
+	child, err := s.GetFolder(ctx, imported.Folders[8])
+	require.NoError(t, err)
+	assert.Equal(t, imported.Folders[7], *child.ParentID)
+	assert.Equal(t, imported.WorkspaceID, child.WorkspaceID)
+
+	require.Len(t, imported.Notes, 2)
+	kept, err := s.GetNote(ctx, imported.Notes[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("w%d_n%d", imported.WorkspaceID, kept.ID), kept.YjsRoomID)
+	assert.Equal(t, kept.YjsRoomID, imported.Notes[0].YjsRoomID)
+	assert.Equal(t, imported.Folders[7], *kept.FolderID)
+	assert.Equal(t, userID, *kept.CreatedBy)
+	assert.Equal(t, "2024-03-01T09:30:00.000Z", kept.CreatedAt)
+	assert.Equal(t, kept.CreatedAt, kept.UpdatedAt, "updated_at defaults to created_at")
+	tags, err := s.ListTagsForNote(ctx, kept.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Go", tags[0].Name)
+	var content []byte
+	require.NoError(t, s.DB().QueryRowContext(ctx, "SELECT content FROM notes WHERE id=$1", kept.ID).Scan(&content))
+	assert.Equal(t, []byte{1, 2, 3}, content)
+
+	found, err := s.SearchNotes(ctx, userID, "imported", "full")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, kept.ID, found[0].ID)
+
+	binned, err := s.GetNote(ctx, imported.Notes[1].ID)
+	require.NoError(t, err)
+	assert.True(t, binned.IsTrashed)
+	assert.Equal(t, "2024-03-01T10:30:00.000Z", *binned.TrashedAt)
+
+	// A note in a folder outside the import rolls everything back
+	before, err := s.ListWorkspaces(ctx, userID)
+	require.NoError(t, err)
+	_, err = s.ImportWorkspace(ctx, userID, db.WorkspaceImport{Name: "Broken", Notes: []db.ImportNote{{Key: 1, FolderKey: &parent}}})
+	assert.ErrorContains(t, err, "folder 7 is not part of the import")
+	after, err := s.ListWorkspaces(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, after, len(before))
+}
+
+func TestSetNoteContent(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	noteID, err := s.CreateNoteWithTags(ctx, wsID, "Imported", nil, &userID, "", nil)
+	require.NoError(t, err)
+
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SetNoteContent(ctx, noteID, []byte{4, 5}, "vault words", &created, nil))
+	note, err := s.GetNote(ctx, noteID)
+	require.NoError(t, err)
+	assert.Equal(t, "2021-06-01T12:00:00.000Z", note.CreatedAt)
+	assert.Equal(t, note.CreatedAt, note.UpdatedAt, "updated_at defaults to created_at")
+	var content []byte
+	require.NoError(t, s.DB().QueryRowContext(ctx, "SELECT content FROM notes WHERE id=$1", noteID).Scan(&content))
+	assert.Equal(t, []byte{4, 5}, content)
+
+	updated := created.Add(24 * time.Hour)
+	require.NoError(t, s.SetNoteContent(ctx, noteID, nil, "", nil, &updated))
+	note, err = s.GetNote(ctx, noteID)
+	require.NoError(t, err)
+	assert.Equal(t, "2021-06-01T12:00:00.000Z", note.CreatedAt)
+	assert.Equal(t, "2021-06-02T12:00:00.000Z", note.UpdatedAt)
+}
+
+func TestAttachments(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	noteID, err := s.CreateNoteWithTags(ctx, wsID, "Trip", nil, &userID, "", nil)
+	require.NoError(t, err)
+
+	puts := 0
+	put := func() error { puts++; return nil }
+	attach := func(hash string, size int64, quota int64) (*db.Attachment, error) {
+		width, height := 640, 480
+		a := &db.Attachment{NoteID: noteID, Filename: "photo.png", MimeType: "image/png", Size: size, Hash: hash, Key: "key", Width: &width, Height: &height, CreatedBy: &userID}
+		return a, s.CreateAttachment(ctx, a, quota, put)
+	}
+	first, err := attach("aa", 600, 1000)
+	require.NoError(t, err)
+	assert.NotZero(t, first.ID)
+	assert.NotEmpty(t, first.CreatedAt)
+	_, err = attach("aa", 600, 1000)
+	assert.ErrorIs(t, err, db.ErrQuotaExceeded)
+	_, err = attach("aa", 600, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, puts, "identical content is stored once")
+
+	used, err := s.WorkspaceAttachmentBytes(ctx, wsID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1200), used)
+	list, err := s.ListAttachments(ctx, noteID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, *first, list[0])
+
+	// A failed put leaves nothing behind
+	err = s.CreateAttachment(ctx, &db.Attachment{NoteID: noteID, Hash: "bb", Size: 1}, 0, func() error { return fmt.Errorf("disk full") })
+	require.Error(t, err)
+	list, err = s.ListAttachments(ctx, noteID)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// Blobs are swept once the grace period passes without attachments
+	var removed []string
+	remove := func(hash string) error { removed = append(removed, hash); return nil }
+	require.NoError(t, s.DeleteAttachment(ctx, first.ID))
+	n, err := s.DeleteOrphanBlobs(ctx, 0, remove)
+	require.NoError(t, err)
+	assert.Zero(t, n, "another attachment shares the content")
+	// The grace period counts from when the last attachment went, not from
+	// the upload
+	_, err = s.db.ExecContext(ctx, "UPDATE attachment_blobs SET last_used_at = '2000-01-01T00:00:00.000Z'")
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteNote(ctx, noteID))
+	list, err = s.ListAttachments(ctx, noteID)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	n, err = s.DeleteOrphanBlobs(ctx, time.Hour, remove)
+	require.NoError(t, err)
+	assert.Zero(t, n, "within the grace period")
+	time.Sleep(10 * time.Millisecond)
+	n, err = s.DeleteOrphanBlobs(ctx, 0, remove)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"aa"}, removed)
+	_, err = s.GetAttachment(ctx, first.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSavedSearches(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	bobID, bobWS := createUser(t, s, "bob")
+	require.NoError(t, s.AddWorkspaceMember(ctx, wsID, bobID, "member"))
+
+	_, err := s.CreateNoteWithTags(ctx, wsID, "Shopping list", nil, &userID, "", []string{"errands"})
+	require.NoError(t, err)
+	_, err = s.CreateNote(ctx, bobWS, "Bob's shopping", nil, &bobID, "")
+	require.NoError(t, err)
+
+	private, err := s.CreateSavedSearch(ctx, bobID, nil, "Shopping", "shopping", "metadata")
+	require.NoError(t, err)
+	shared, err := s.CreateSavedSearch(ctx, bobID, &wsID, "Errands", "tag:errands", "metadata")
+	require.NoError(t, err)
+
+	list, err := s.ListSavedSearches(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, list, 1, "alice sees the search shared with her workspace")
+	assert.Equal(t, shared, list[0].ID)
+
+	ss, err := s.GetSavedSearch(ctx, private)
+	require.NoError(t, err)
+	notes, err := s.SavedSearchNotes(ctx, ss, bobID)
+	require.NoError(t, err)
+	assert.Len(t, notes, 2, "a private search covers all the owner's workspaces")
+	ok, err := s.CanViewSavedSearch(ctx, ss, userID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	counts, err := s.CountSavedSearches(ctx, bobID)
+	require.NoError(t, err)
+	assert.Equal(t, []db.SavedSearchCount{{ID: shared, Name: "Errands", Count: 1}, {ID: private, Name: "Shopping", Count: 2}}, counts)
+
+	// Leaving the workspace takes the shared search's results with it
+	require.NoError(t, s.RemoveWorkspaceMember(ctx, wsID, bobID))
+	ss, err = s.GetSavedSearch(ctx, shared)
+	require.NoError(t, err)
+	ok, err = s.CanViewSavedSearch(ctx, ss, bobID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	notes, err = s.SavedSearchNotes(ctx, ss, bobID)
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+
+	require.NoError(t, s.UpdateSavedSearch(ctx, shared, nil, "Mine", "bob", "full"))
+	ss, err = s.GetSavedSearch(ctx, shared)
+	require.NoError(t, err)
+	assert.Nil(t, ss.WorkspaceID)
+	assert.Equal(t, "full", ss.Mode)
+	require.NoError(t, s.DeleteSavedSearch(ctx, shared))
+	_, err = s.GetSavedSearch(ctx, shared)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSearchLanguages(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	noteID, err := s.CreateNote(ctx, wsID, "Log", nil, &userID, "")
+	require.NoError(t, err)
+	_, err = s.UpdateNoteSearchText(ctx, noteID, "running late")
+	require.NoError(t, err)
+	found := func(query string) bool {
+		notes, err := s.SearchNotes(ctx, userID, query, "full")
+		require.NoError(t, err)
+		for _, n := range notes {
+			if n.ID == noteID {
+				return true
+			}
+		}
+		return false
+	}
+
+	languages, err := s.ListSearchLanguages(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"english", "simple"}, languages)
+	ok, err := s.IsValidSearchLanguage(ctx, "german")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.True(t, found("run"), "english stems")
+	require.NoError(t, s.SetWorkspaceSearchLanguage(ctx, wsID, "simple"))
+	n, err := s.GetNote(ctx, noteID)
+	require.NoError(t, err)
+	assert.Equal(t, "simple", n.SearchLanguage)
+	assert.False(t, found("run"), "simple matches whole words only")
+	assert.True(t, found("running"))
+
+	english := "english"
+	require.NoError(t, s.SetNoteSearchLanguage(ctx, noteID, &english))
+	assert.True(t, found("run"))
+	require.NoError(t, s.SetNoteSearchLanguage(ctx, noteID, nil))
+	n, err = s.GetNote(ctx, noteID)
+	require.NoError(t, err)
+	assert.Equal(t, "simple", n.SearchLanguage)
+	assert.True(t, n.SearchLanguageInherited)
+}
+
+func TestSearchNotesFuzzy(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	meeting, err := s.CreateNoteWithTags(ctx, wsID, "Weekly team meeting", nil, &userID, "", []string{"work"})
+	require.NoError(t, err)
+	budget, err := s.CreateNote(ctx, wsID, "Budget", nil, &userID, "")
+	require.NoError(t, err)
+	_, err = s.UpdateNoteSearchText(ctx, budget, "Quarterly meeting costs")
+	require.NoError(t, err)
+
+	res, err := s.SearchNotesFuzzy(ctx, userID, "Meetnig", 10)
+	require.NoError(t, err)
+	require.Len(t, res.Notes, 2)
+	assert.Equal(t, meeting, res.Notes[0].ID, "title matches outrank content")
+	assert.Equal(t, budget, res.Notes[1].ID)
+	assert.Equal(t, []db.Tag{{ID: res.Notes[0].Tags[0].ID, Name: "work"}}, res.Notes[0].Tags)
+	assert.Equal(t, "meeting", res.DidYouMean)
+
+	res, err = s.SearchNotesFuzzy(ctx, userID, "meeting", 1)
+	require.NoError(t, err)
+	assert.Len(t, res.Notes, 1)
+	assert.Empty(t, res.DidYouMean)
+}
+
+func TestSyncChanges(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+	bobID, bobWS := createUser(t, s, "bob")
+
+	full, err := s.GetSyncChanges(ctx, userID, "")
+	require.NoError(t, err)
+	assert.True(t, full.Full)
+	require.Len(t, full.Workspaces, 1)
+	require.Len(t, full.Notes, 1)
+	intro := full.Notes[0].ID
+
+	folderID, err := s.CreateFolder(ctx, wsID, "Projects", nil)
+	require.NoError(t, err)
+	noteID, err := s.CreateNoteWithTags(ctx, wsID, "Plan", &folderID, &userID, "", []string{"todo"})
+	require.NoError(t, err)
+	_, err = s.CreateNote(ctx, bobWS, "Not for alice", nil, &bobID, "")
+	require.NoError(t, err)
+
+	delta, err := s.GetSyncChanges(ctx, userID, full.Cursor)
+	require.NoError(t, err)
+	assert.False(t, delta.Full)
+	require.Len(t, delta.Folders, 1)
+	require.Len(t, delta.Notes, 1, "bob's workspace is not visible")
+	assert.Equal(t, noteID, delta.Notes[0].ID)
+	require.Len(t, delta.Tags, 1)
+	assert.Equal(t, "todo", delta.Tags[0].Name)
+
+	// Content edits are not sync changes; the document service has them
+	_, err = s.UpdateNoteSearchText(ctx, intro, "edited")
+	require.NoError(t, err)
+	quiet, err := s.GetSyncChanges(ctx, userID, delta.Cursor)
+	require.NoError(t, err)
+	assert.Empty(t, quiet.Notes)
+	assert.Equal(t, delta.Cursor, quiet.Cursor)
+
+	// Deleting the folder trashes its note; emptying the trash leaves tombstones
+	require.NoError(t, s.DeleteFolder(ctx, folderID))
+	require.NoError(t, s.EmptyWorkspaceTrash(ctx, wsID))
+	gone, err := s.GetSyncChanges(ctx, userID, quiet.Cursor)
+	require.NoError(t, err)
+	assert.Empty(t, gone.Notes)
+	assert.Equal(t, []int{noteID}, gone.Deleted.Notes)
+	assert.Equal(t, []int{folderID}, gone.Deleted.Folders)
+
+	// Joining a workspace sends it whole; leaving it removes it
+	require.NoError(t, s.AddWorkspaceMember(ctx, bobWS, userID, "member"))
+	joined, err := s.GetSyncChanges(ctx, userID, gone.Cursor)
+	require.NoError(t, err)
+	require.Len(t, joined.Workspaces, 1)
+	assert.Equal(t, bobWS, joined.Workspaces[0].ID)
+	assert.Len(t, joined.Notes, 2)
+	assert.Len(t, joined.Members, 2)
+	require.NoError(t, s.RemoveWorkspaceMember(ctx, bobWS, userID))
+	left, err := s.GetSyncChanges(ctx, userID, joined.Cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []int{bobWS}, left.Deleted.Workspaces)
+
+	// Pruning everything expires cursors that had changes left to read
+	_, err = s.GetSyncChanges(ctx, userID, "abc")
+	assert.ErrorIs(t, err, db.ErrInvalidCursor)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.PruneSyncChanges(ctx, 0))
+	current, err := s.GetSyncChanges(ctx, userID, left.Cursor)
+	require.NoError(t, err)
+	assert.Empty(t, current.Notes)
+	_, err = s.GetSyncChanges(ctx, userID, full.Cursor)
+	assert.ErrorIs(t, err, db.ErrSyncCursorExpired)
+	fresh, err := s.GetSyncChanges(ctx, userID, "")
+	require.NoError(t, err)
+	assert.Equal(t, left.Cursor, fresh.Cursor, "cursors never move backwards")
+}
+
+func TestWebhookQueue(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+
+	all, err := s.CreateWebhook(ctx, wsID, "https://203.0.113.5/all", "secret", nil, true, userID)
+	require.NoError(t, err)
+	_, err = s.CreateWebhook(ctx, wsID, "https://203.0.113.5/folders", "secret", []string{"folder.created"}, true, userID)
+	require.NoError(t, err)
+	_, err = s.CreateWebhook(ctx, wsID, "https://203.0.113.5/off", "secret", nil, false, userID)
+	require.NoError(t, err)
+
+	hook, err := s.GetWebhook(ctx, all)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, hook.EventTypes)
+	hooks, err := s.ListWebhooks(ctx, wsID)
+	require.NoError(t, err)
+	require.Len(t, hooks, 3)
+	assert.Equal(t, []string{"folder.created"}, hooks[1].EventTypes)
+
+	queued, err := s.EnqueueWebhookDeliveries(ctx, wsID, "note.created", []byte(`{"type":"note.created"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), queued, "only active webhooks subscribed to the event")
+	queued, err = s.EnqueueWebhookDeliveries(ctx, wsID, "folder.created", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), queued)
+
+	claimed, err := s.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	assert.Equal(t, "https://203.0.113.5/all", claimed[0].URL)
+	assert.Equal(t, `{"type":"note.created"}`, claimed[0].Payload)
+	again, err := s.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, again, "claims are leased")
+
+	retry := time.Now().Add(-time.Second)
+	require.NoError(t, s.CompleteWebhookDelivery(ctx, claimed[0].ID, 500, "oops", "HTTP 500", &retry))
+	require.NoError(t, s.CompleteWebhookDelivery(ctx, claimed[1].ID, 200, "ok", "", nil))
+	require.NoError(t, s.CompleteWebhookDelivery(ctx, claimed[2].ID, 0, "", "refused", nil))
+
+	d, err := s.GetWebhookDelivery(ctx, claimed[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "pending", d.Status)
+	require.NotNil(t, d.NextAttemptAt)
+	assert.WithinDuration(t, retry, *d.NextAttemptAt, time.Millisecond)
+	assert.Equal(t, "HTTP 500", *d.Error)
+	d, err = s.GetWebhookDelivery(ctx, claimed[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "delivered", d.Status)
+	assert.NotNil(t, d.DeliveredAt)
+	assert.Nil(t, d.NextAttemptAt)
+	d, err = s.GetWebhookDelivery(ctx, claimed[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", d.Status)
+	assert.Nil(t, d.ResponseStatus)
+
+	retried, err := s.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, retried, 1)
+	assert.Equal(t, 2, retried[0].Attempts)
+
+	id, err := s.EnqueueWebhookDelivery(ctx, all, "ping", []byte(`{}`))
+	require.NoError(t, err)
+	deliveries, err := s.ListWebhookDeliveries(ctx, all, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, id, deliveries[0].ID)
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, s.PruneWebhookDeliveries(ctx, 0))
+	deliveries, err = s.ListWebhookDeliveries(ctx, all, 10)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 2, "pending deliveries are kept")
+
+	require.NoError(t, s.UpdateWebhook(ctx, all, "https://203.0.113.5/new", []string{"note.created"}, false))
+	hook, err = s.GetWebhook(ctx, all)
+	require.NoError(t, err)
+	assert.False(t, hook.Active)
+	require.NoError(t, s.DeleteWebhook(ctx, all))
+	_, err = s.GetWebhookDelivery(ctx, id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Deliveries outlive a webhook deleted with its workspace
+	_, err = s.CreateWebhook(ctx, wsID, "https://203.0.113.5/gone", "secret", []string{"workspace.deleted"}, true, userID)
+	require.NoError(t, err)
+	queued, err = s.EnqueueWebhookDeliveries(ctx, wsID, "workspace.deleted", []byte(`{"type":"workspace.deleted"}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), queued)
+	require.NoError(t, s.DeleteWorkspace(ctx, wsID))
+	claimed, err = s.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "workspace.deleted", claimed[0].EventType)
+	assert.Equal(t, "https://203.0.113.5/gone", claimed[0].URL)
+	assert.Equal(t, "secret", claimed[0].Secret)
+	assert.Zero(t, claimed[0].WebhookID)
+	d, err = s.GetWebhookDelivery(ctx, claimed[0].ID)
+	require.NoError(t, err)
+	assert.Zero(t, d.WebhookID)
+}
+
+func TestExportJobs(t *testing.T) {
+	s, _ := newTestStore(t)
+	ctx := context.Background()
+	userID, wsID := createUser(t, s, "alice")
+
+	job, err := s.CreateExportJob(ctx, "ab12", wsID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "running", job.Status)
+	assert.Empty(t, job.FinishedAt)
+	_, err = s.CreateExportJob(ctx, "cd34", wsID, userID)
+	require.NoError(t, err)
+	n, err := s.CountRunningExportJobs(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	recorded, err := s.FinishExportJob(ctx, "ab12", "done", "", 2048, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+	job, err = s.GetExportJob(ctx, "ab12")
+	require.NoError(t, err)
+	assert.Equal(t, "done", job.Status)
+	assert.Equal(t, int64(2048), job.Size)
+	assert.NotEmpty(t, job.FinishedAt)
+
+	// A job kept alive is not given up; a silent one is, and cannot finish
+	require.NoError(t, s.TouchExportJob(ctx, "cd34"))
+	stalled, err := s.FailStalledExportJobs(ctx, time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, stalled)
+	stalled, err = s.FailStalledExportJobs(ctx, -time.Second, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cd34"}, stalled)
+	recorded, err = s.FinishExportJob(ctx, "cd34", "done", "", 10, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, recorded)
+
+	expired, err := s.DeleteExpiredExportJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cd34"}, expired)
+	_, err = s.GetExportJob(ctx, "cd34")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetExportJob(ctx, "ab12")
+	assert.NoError(t, err)
+}
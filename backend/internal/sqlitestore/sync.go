@@ -0,0 +1,328 @@
+package sqlitestore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go-notes/backend/internal/db"
+)
+
+// GetSyncChanges returns changes visible to userID since the given cursor
+// ("" for a full sync). The cursor is the last change ID that was read;
+// write transactions are serialised, so everything is read in one
+// transaction that no write can interleave with.
+func (s *Store) GetSyncChanges(ctx context.Context, userID int, since string) (*db.SyncChanges, error) {
+	var sinceID int64
+	if since != "" {
+		var err error
+		if sinceID, err = strconv.ParseInt(since, 10, 64); err != nil || sinceID < 0 {
+			return nil, db.ErrInvalidCursor
+		}
+	}
+
+	var res *db.SyncChanges
+	err := s.WithTx(ctx, func(tx *Store) error {
+		var err error
+		res, err = tx.syncChanges(ctx, userID, since, sinceID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// syncChanges reads the changes for GetSyncChanges within its transaction
+func (s *Store) syncChanges(ctx context.Context, userID int, since string, sinceID int64) (*db.SyncChanges, error) {
+	res := &db.SyncChanges{
+		Full:       since == "",
+		Workspaces: []db.Workspace{},
+		Members:    []db.WorkspaceMember{},
+		Folders:    []db.Folder{},
+		Notes:      []db.Note{},
+		Tags:       []db.SyncTag{},
+		Deleted: db.SyncDeleted{
+			Notes: []int{}, Folders: []int{}, Tags: []db.SyncRef{}, Members: []db.WorkspaceMember{}, Workspaces: []int{},
+		},
+	}
+
+	// sqlite_sequence holds the highest ID ever given out, which pruning
+	// does not lower
+	var cursorID int64
+	err := s.q.QueryRowContext(ctx, "SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'sync_changes'), 0)").Scan(&cursorID)
+	if err != nil {
+		return nil, err
+	}
+	if since != "" {
+		var horizon int64
+		if err := s.q.QueryRowContext(ctx, "SELECT change_id FROM sync_horizon WHERE id = 1").Scan(&horizon); err != nil {
+			return nil, err
+		}
+		if sinceID < horizon {
+			return nil, db.ErrSyncCursorExpired
+		}
+		if sinceID > cursorID {
+			// A cursor never moves backwards
+			cursorID = sinceID
+		}
+	}
+	res.Cursor = strconv.FormatInt(cursorID, 10)
+
+	memberIDs, err := s.MemberWorkspaceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[int]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		member[id] = true
+	}
+
+	// Workspaces that are sent whole: all of them on a full sync, or ones the
+	// user joined since the cursor
+	full := make(map[int]bool)
+	if since == "" {
+		full = member
+	}
+	workspaces := make(map[int]bool)
+	notes, folders := make(map[int]bool), make(map[int]bool)
+	tags, members := make(map[db.SyncRef]bool), make(map[db.SyncRef]bool)
+	var deletedNotes, deletedFolders []int
+
+	if since != "" {
+		// Only the latest change to each entity counts; SQLite takes the
+		// other columns from the row holding MAX(id)
+		args := []interface{}{sinceID, cursorID, userID}
+		rows, err := s.q.QueryContext(ctx, `
+			SELECT entity, entity_id, workspace_id, deleted, MAX(id)
+			FROM sync_changes
+			WHERE id > $1 AND id <= $2
+			  AND (workspace_id IN (`+placeholders(memberIDs, &args)+`) OR (entity = 'member' AND entity_id = $3))
+			GROUP BY entity, entity_id, workspace_id
+			ORDER BY entity, entity_id, workspace_id
+		`, args...)
+		if err != nil {
+			return nil, err
+		}
+		type change struct {
+			entity  string
+			id, ws  int
+			deleted bool
+		}
+		var changes []change
+		for rows.Next() {
+			var ch change
+			var changeID int64
+			if err := rows.Scan(&ch.entity, &ch.id, &ch.ws, &ch.deleted, &changeID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			changes = append(changes, ch)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, ch := range changes {
+			if ch.entity == "member" && ch.id == userID {
+				if !member[ch.ws] {
+					res.Deleted.Workspaces = append(res.Deleted.Workspaces, ch.ws)
+				} else if !ch.deleted {
+					full[ch.ws] = true
+				}
+			}
+		}
+		for _, ch := range changes {
+			if full[ch.ws] || !member[ch.ws] {
+				continue
+			}
+			ref := db.SyncRef{WorkspaceID: ch.ws, ID: ch.id}
+			switch ch.entity {
+			case "note":
+				if ch.deleted {
+					deletedNotes = append(deletedNotes, ch.id)
+				} else {
+					notes[ch.id] = true
+				}
+			case "folder":
+				if ch.deleted {
+					deletedFolders = append(deletedFolders, ch.id)
+				} else {
+					folders[ch.id] = true
+				}
+			case "tag":
+				if ch.deleted {
+					res.Deleted.Tags = append(res.Deleted.Tags, ref)
+				} else {
+					tags[ref] = true
+				}
+			case "member":
+				if ch.deleted {
+					res.Deleted.Members = append(res.Deleted.Members, db.WorkspaceMember{WorkspaceID: ch.ws, UserID: ch.id})
+				} else {
+					members[ref] = true
+				}
+			case "workspace":
+				workspaces[ch.ws] = true
+			}
+		}
+	}
+	for id := range full {
+		workspaces[id] = true
+	}
+
+	if err := s.loadSyncPayload(ctx, res, memberIDs, full, workspaces, notes, folders, tags, members); err != nil {
+		return nil, err
+	}
+
+	// A note or folder that moved out of one workspace and into another the
+	// user can see is an upsert, not a delete
+	for _, n := range res.Notes {
+		notes[n.ID] = true
+	}
+	for _, f := range res.Folders {
+		folders[f.ID] = true
+	}
+	for _, id := range deletedNotes {
+		if !notes[id] {
+			res.Deleted.Notes = append(res.Deleted.Notes, id)
+		}
+	}
+	for _, id := range deletedFolders {
+		if !folders[id] {
+			res.Deleted.Folders = append(res.Deleted.Folders, id)
+		}
+	}
+	return res, nil
+}
+
+// loadSyncPayload reads the current state of the changed entities within
+// the user's workspaces, and everything in the full ones
+func (s *Store) loadSyncPayload(ctx context.Context, res *db.SyncChanges, memberIDs []int, full, workspaces, notes, folders map[int]bool, tags, members map[db.SyncRef]bool) error {
+	if len(memberIDs) == 0 {
+		return nil
+	}
+	var args []interface{}
+	inMember := placeholders(memberIDs, &args)
+
+	rows, err := s.q.QueryContext(ctx, "SELECT id, name, owner_id, created_at, search_language FROM workspaces WHERE id IN ("+inMember+") ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var w db.Workspace
+		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.SearchLanguage); err != nil {
+			rows.Close()
+			return err
+		}
+		if workspaces[w.ID] {
+			res.Workspaces = append(res.Workspaces, w)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.q.QueryContext(ctx, "SELECT workspace_id, user_id, role FROM workspace_members WHERE workspace_id IN ("+inMember+") ORDER BY workspace_id, user_id", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var m db.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role); err != nil {
+			rows.Close()
+			return err
+		}
+		if full[m.WorkspaceID] || members[db.SyncRef{WorkspaceID: m.WorkspaceID, ID: m.UserID}] {
+			res.Members = append(res.Members, m)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.q.QueryContext(ctx, "SELECT id, workspace_id, parent_id, name, created_at FROM folders WHERE workspace_id IN ("+inMember+") ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var f db.Folder
+		if err := rows.Scan(&f.ID, &f.WorkspaceID, &f.ParentID, &f.Name, &f.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if full[f.WorkspaceID] || folders[f.ID] {
+			res.Folders = append(res.Folders, f)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.q.QueryContext(ctx, "SELECT "+noteColumns+" FROM notes n WHERE n.workspace_id IN ("+inMember+") ORDER BY n.id", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var n db.Note
+		if err := scanNote(rows.Scan, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		if full[n.WorkspaceID] || notes[n.ID] {
+			res.Notes = append(res.Notes, n)
+		}
+	}
+	rows.Close()
+	if err := s.AttachTags(ctx, res.Notes); err != nil {
+		return err
+	}
+
+	rows, err = s.q.QueryContext(ctx, `
+		SELECT DISTINCT n.workspace_id, t.id, t.name
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE n.workspace_id IN (`+inMember+`)
+		ORDER BY n.workspace_id, t.id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t db.SyncTag
+		if err := rows.Scan(&t.WorkspaceID, &t.ID, &t.Name); err != nil {
+			return err
+		}
+		if full[t.WorkspaceID] || tags[db.SyncRef{WorkspaceID: t.WorkspaceID, ID: t.ID}] {
+			res.Tags = append(res.Tags, t)
+		}
+	}
+	return rows.Err()
+}
+
+// PruneSyncChanges drops change rows superseded by a newer change to the same
+// entity, then expires rows older than retentionDays. Cursors from before the
+// expired rows get db.ErrSyncCursorExpired.
+func (s *Store) PruneSyncChanges(ctx context.Context, retentionDays int) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		_, err := tx.q.ExecContext(ctx, `
+			DELETE FROM sync_changes
+			WHERE EXISTS (
+				SELECT 1 FROM sync_changes newer
+				WHERE newer.entity = sync_changes.entity AND newer.entity_id = sync_changes.entity_id
+				  AND newer.workspace_id = sync_changes.workspace_id AND newer.id > sync_changes.id
+			)
+		`)
+		if err != nil {
+			return err
+		}
+		cutoff := fmt.Sprintf("-%d days", retentionDays)
+		_, err = tx.q.ExecContext(ctx, `
+			UPDATE sync_horizon
+			SET change_id = MAX(change_id, (SELECT MAX(id) FROM sync_changes WHERE changed_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)))
+			WHERE id = 1 AND EXISTS (SELECT 1 FROM sync_changes WHERE changed_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1))
+		`, cutoff)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, "DELETE FROM sync_changes WHERE changed_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)", cutoff)
+		return err
+	})
+}
@@ -0,0 +1,260 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-notes/backend/internal/db"
+)
+
+// --- Webhooks ---
+
+const webhookColumns = "id, workspace_id, url, secret, event_types, active, created_by, created_at, updated_at"
+
+// scanWebhook reads a webhook row; event_types is a JSON array
+func scanWebhook(scan func(dest ...any) error) (*db.Webhook, error) {
+	var w db.Webhook
+	var eventTypes string
+	if err := scan(&w.ID, &w.WorkspaceID, &w.URL, &w.Secret, &eventTypes, &w.Active, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &w.EventTypes); err != nil {
+		return nil, fmt.Errorf("webhook %d event types: %w", w.ID, err)
+	}
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	return &w, nil
+}
+
+// eventTypesJSON encodes subscribed event types for the event_types column
+func eventTypesJSON(eventTypes []string) string {
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	b, _ := json.Marshal(eventTypes)
+	return string(b)
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, workspaceID int, url, secret string, eventTypes []string, active bool, createdBy int) (int, error) {
+	var id int
+	err := s.q.QueryRowContext(ctx,
+		"INSERT INTO webhooks (workspace_id, url, secret, event_types, active, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		workspaceID, url, secret, eventTypesJSON(eventTypes), active, createdBy,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *Store) GetWebhook(ctx context.Context, id int) (*db.Webhook, error) {
+	return scanWebhook(s.q.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id).Scan)
+}
+
+func (s *Store) ListWebhooks(ctx context.Context, workspaceID int) ([]db.Webhook, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE workspace_id = $1 ORDER BY id", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []db.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *w)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *Store) UpdateWebhook(ctx context.Context, id int, url string, eventTypes []string, active bool) error {
+	_, err := s.q.ExecContext(ctx,
+		"UPDATE webhooks SET url=$1, event_types=$2, active=$3, updated_at="+now+" WHERE id=$4",
+		url, eventTypesJSON(eventTypes), active, id,
+	)
+	return err
+}
+
+// DeleteWebhook removes a webhook with its deliveries, which would
+// otherwise outlive it
+func (s *Store) DeleteWebhook(ctx context.Context, id int) error {
+	if _, err := s.q.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id=$1", id); err != nil {
+		return err
+	}
+	_, err := s.q.ExecContext(ctx, "DELETE FROM webhooks WHERE id=$1", id)
+	return err
+}
+
+// EnqueueWebhookDeliveries queues payload for every active webhook in the
+// workspace subscribed to eventType, returning how many were queued. The
+// deliveries keep the webhook's url and secret, so they still go out if
+// the workspace is deleted next.
+func (s *Store) EnqueueWebhookDeliveries(ctx context.Context, workspaceID int, eventType string, payload []byte) (int64, error) {
+	res, err := s.q.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, url, secret, event_type, payload)
+		SELECT id, url, secret, $2, $3 FROM webhooks
+		WHERE workspace_id = $1 AND active
+		  AND (json_array_length(event_types) = 0 OR EXISTS (SELECT 1 FROM json_each(event_types) WHERE value = $2))
+	`, workspaceID, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// EnqueueWebhookDelivery queues payload for one webhook regardless of its
+// subscriptions (pings and manual redeliveries)
+func (s *Store) EnqueueWebhookDelivery(ctx context.Context, webhookID int, eventType string, payload []byte) (int64, error) {
+	var id int64
+	err := s.q.QueryRowContext(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, url, secret, event_type, payload)
+		 SELECT id, url, secret, $2, $3 FROM webhooks WHERE id = $1 RETURNING id`,
+		webhookID, eventType, string(payload),
+	).Scan(&id)
+	return id, err
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and leases them for
+// lease, so a crashed worker's claims are retried later. Only one write
+// runs at a time, so no two claims overlap. A delivery goes to its
+// webhook's current url, or to the one it was queued with once the webhook
+// is gone.
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]db.WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    last_attempt_at = `+now+`,
+		    next_attempt_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $2)
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= `+now+`
+			ORDER BY next_attempt_at
+			LIMIT $1
+		)
+		RETURNING id, COALESCE(webhook_id, 0), event_type, payload, attempts, created_at,
+			COALESCE((SELECT url FROM webhooks w WHERE w.id = webhook_deliveries.webhook_id), url),
+			COALESCE((SELECT secret FROM webhooks w WHERE w.id = webhook_deliveries.webhook_id), secret)
+	`, limit, fmt.Sprintf("+%d seconds", int64(lease.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var claimed []db.WebhookDelivery
+	for rows.Next() {
+		var d db.WebhookDelivery
+		var createdAt string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Attempts, &createdAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		if d.CreatedAt, err = time.Parse(timestampLayout, createdAt); err != nil {
+			return nil, err
+		}
+		d.Status = "pending"
+		claimed = append(claimed, d)
+	}
+	return claimed, rows.Err()
+}
+
+// CompleteWebhookDelivery records an attempt. A nil retryAt with a non-empty
+// errMsg marks the delivery failed for good; with retryAt it stays pending.
+func (s *Store) CompleteWebhookDelivery(ctx context.Context, id int64, responseStatus int, responseBody, errMsg string, retryAt *time.Time) error {
+	status := "delivered"
+	if errMsg != "" {
+		status = "failed"
+		if retryAt != nil {
+			status = "pending"
+		}
+	}
+	var statusArg, errArg, retryArg interface{}
+	if responseStatus != 0 {
+		statusArg = responseStatus
+	}
+	if errMsg != "" {
+		errArg = errMsg
+	}
+	if retryAt != nil {
+		retryArg = retryAt.UTC().Format(timestampLayout)
+	}
+	_, err := s.q.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, response_status = $3, response_body = $4, error = $5,
+		    next_attempt_at = COALESCE($6, next_attempt_at),
+		    delivered_at = CASE WHEN $2 = 'delivered' THEN `+now+` ELSE NULL END
+		WHERE id = $1
+	`, id, status, statusArg, responseBody, errArg, retryArg)
+	return err
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, id int64) (*db.WebhookDelivery, error) {
+	return scanDelivery(s.q.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = $1", id).Scan)
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries first
+func (s *Store) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]db.WebhookDelivery, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []db.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// PruneWebhookDeliveries drops finished deliveries older than days
+func (s *Store) PruneWebhookDeliveries(ctx context.Context, days int) error {
+	_, err := s.q.ExecContext(ctx,
+		"DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < strftime('%Y-%m-%dT%H:%M:%fZ', 'now', $1)",
+		fmt.Sprintf("-%d days", days))
+	return err
+}
+
+const deliveryColumns = `id, COALESCE(webhook_id, 0), event_type, payload, status, attempts, next_attempt_at, last_attempt_at,
+	response_status, response_body, error, created_at, delivered_at`
+
+// scanDelivery reads a delivery row, parsing its timestamp text
+func scanDelivery(scan func(dest ...any) error) (*db.WebhookDelivery, error) {
+	var d db.WebhookDelivery
+	var next, createdAt string
+	var lastAttempt, delivered sql.NullString
+	err := scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &next, &lastAttempt,
+		&d.ResponseStatus, &d.ResponseBody, &d.Error, &createdAt, &delivered)
+	if err != nil {
+		return nil, err
+	}
+	if d.CreatedAt, err = time.Parse(timestampLayout, createdAt); err != nil {
+		return nil, err
+	}
+	if d.Status == "pending" {
+		if d.NextAttemptAt, err = parseTimestamp(sql.NullString{String: next, Valid: true}); err != nil {
+			return nil, err
+		}
+	}
+	if d.LastAttemptAt, err = parseTimestamp(lastAttempt); err != nil {
+		return nil, err
+	}
+	if d.DeliveredAt, err = parseTimestamp(delivered); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// parseTimestamp parses an optional timestamp column
+func parseTimestamp(text sql.NullString) (*time.Time, error) {
+	if !text.Valid {
+		return nil, nil
+	}
+	t, err := time.Parse(timestampLayout, text.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,90 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned for receivers on loopback, private,
+// link-local or unspecified addresses. Any user owns a workspace, so
+// without this check webhooks would let anyone make the backend call the
+// database, the yjs server or a cloud metadata service and read the answer
+// back from the delivery log.
+var ErrForbiddenAddress = errors.New("webhook receivers must have a public address")
+
+// sharedAddressSpace (RFC 6598) is carrier-grade NAT, also used for VPN
+// overlays and by some clouds' metadata services
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// thisNetwork (0.0.0.0/8) is routed to the local host by Linux
+var thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+
+// forbidden reports whether webhooks may not be sent to an address.
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS=true lifts the check for installations
+// whose receivers run on the same network.
+func forbidden(addr netip.Addr) bool {
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true" {
+		return false
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || sharedAddressSpace.Contains(addr) || thisNetwork.Contains(addr)
+}
+
+// CheckURL checks that a receiver URL is absolute http(s) and that its host
+// resolves only to addresses webhooks may be sent to. Deliveries check
+// again when they connect, since DNS answers can change in between.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if forbidden(addr) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. It refuses to
+// connect to forbidden addresses whatever name led there, ignores proxy
+// settings, which would connect on its behalf, and does not follow
+// redirects.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if forbidden(addrPort.Addr()) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
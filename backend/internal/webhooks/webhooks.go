@@ -0,0 +1,242 @@
+// Package webhooks delivers workspace events to subscribed URLs.
+//
+// Events are queued in the database (webhook_deliveries) in the request
+// that caused them, and a Dispatcher in each backend replica claims due rows,
+// POSTs them with an HMAC-SHA256 signature and reschedules failures with
+// exponential backoff. Every attempt is kept as the delivery log.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-notes/backend/internal/db"
+	"go-notes/backend/internal/events"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-GoNotes-Event"
+	HeaderDelivery  = "X-GoNotes-Delivery"
+	HeaderTimestamp = "X-GoNotes-Timestamp"
+	HeaderSignature = "X-GoNotes-Signature"
+)
+
+// PingEvent is sent by the ping endpoint to test a subscription
+const PingEvent = "ping"
+
+const (
+	batchSize       = 20
+	pollInterval    = 5 * time.Second
+	requestTimeout  = 10 * time.Second
+	claimLease      = 2 * time.Minute // > requestTimeout, so a live attempt is never re-claimed
+	maxResponseBody = 2048
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = 6 * time.Hour
+)
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed by the webhook secret, prefixed with "sha256="
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign; receivers can use it as-is
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Backoff is the delay before retrying after the given number of attempts:
+// 30s, 1m, 2m, 4m ... capped at 6h
+func Backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+// IsEventType reports whether name can be subscribed to
+func IsEventType(name string) bool {
+	for _, t := range events.Types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Queue stores deliveries for the dispatcher to send
+type Queue interface {
+	EnqueueWebhookDeliveries(ctx context.Context, workspaceID int, eventType string, payload []byte) (int64, error)
+}
+
+// Enqueue queues an event for the workspace's matching webhooks
+func Enqueue(ctx context.Context, store Queue, e events.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = store.EnqueueWebhookDeliveries(ctx, e.WorkspaceID, e.Type, payload)
+	return err
+}
+
+// DeliveryQueue is the side of the delivery queue the Dispatcher works
+type DeliveryQueue interface {
+	// ClaimWebhookDeliveries leases up to limit due deliveries
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]db.WebhookDelivery, error)
+	// CompleteWebhookDelivery records an attempt; a non-nil retryAt keeps
+	// a failed delivery pending
+	CompleteWebhookDelivery(ctx context.Context, id int64, responseStatus int, responseBody, errMsg string, retryAt *time.Time) error
+}
+
+// Dispatcher delivers queued webhooks until Close is called
+type Dispatcher struct {
+	store       DeliveryQueue
+	client      *http.Client
+	maxAttempts int
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher starts delivering; a delivery is abandoned after maxAttempts
+func NewDispatcher(store DeliveryQueue, maxAttempts int) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		store:       store,
+		client:      newClient(),
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+		cancel:      cancel,
+	}
+	d.wg.Add(1)
+	go d.run(ctx)
+	return d
+}
+
+// Wake makes the dispatcher check the queue now instead of at the next poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil && d.deliverBatch(ctx) == batchSize {
+			// Queue is backed up; keep going without waiting
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverBatch claims and delivers one batch concurrently, returning its size
+func (d *Dispatcher) deliverBatch(ctx context.Context) int {
+	claimed, err := d.store.ClaimWebhookDeliveries(ctx, batchSize, claimLease)
+	if err != nil {
+		log.Printf("[WARN] Claiming webhook deliveries failed: %v", err)
+		return 0
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range claimed {
+		wg.Add(1)
+		go func(delivery db.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(claimed)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery db.WebhookDelivery) {
+	status, body, err := d.Send(ctx, delivery)
+	errMsg := ""
+	var retryAt *time.Time
+	if err != nil {
+		errMsg = err.Error()
+		if delivery.Attempts < d.maxAttempts {
+			t := time.Now().Add(Backoff(delivery.Attempts))
+			retryAt = &t
+		}
+	}
+	// Recorded even when Close cancelled the attempt
+	if err := d.store.CompleteWebhookDelivery(context.WithoutCancel(ctx), delivery.ID, status, body, errMsg, retryAt); err != nil {
+		log.Printf("[WARN] Recording webhook delivery %d failed: %v", delivery.ID, err)
+	}
+}
+
+// Send POSTs one delivery and returns the response status and (truncated)
+// body. Any non-2xx response is an error.
+func (d *Dispatcher) Send(ctx context.Context, delivery db.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-notes-webhooks")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
+
+// Close stops the dispatcher; in-flight deliveries are cancelled and
+// rescheduled like any other failed attempt
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
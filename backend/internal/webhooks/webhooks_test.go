@@ -0,0 +1,126 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go-notes/backend/internal/db"
+)
+
+// receiver is a local webhook endpoint that verifies signatures like a
+// real consumer would
+type receiver struct {
+	secret   string
+	status   int
+	received []*http.Request
+	bodies   [][]byte
+	verified []bool
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	ts, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	r.received = append(r.received, req)
+	r.bodies = append(r.bodies, body)
+	r.verified = append(r.verified, Verify(r.secret, ts, body, req.Header.Get(HeaderSignature)))
+	w.WriteHeader(r.status)
+	io.WriteString(w, "ok")
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	recv := &receiver{secret: "s3cret", status: http.StatusOK}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	status, body, err := d.Send(context.Background(), db.WebhookDelivery{
+		ID: 7, EventType: "note.created", Payload: `{"type":"note.created"}`, URL: srv.URL, Secret: "s3cret",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", body)
+	require.Len(t, recv.received, 1)
+	assert.True(t, recv.verified[0])
+	assert.Equal(t, "note.created", recv.received[0].Header.Get(HeaderEvent))
+	assert.Equal(t, "7", recv.received[0].Header.Get(HeaderDelivery))
+	assert.JSONEq(t, `{"type":"note.created"}`, string(recv.bodies[0]))
+}
+
+func TestSendReportsReceiverErrors(t *testing.T) {
+	recv := &receiver{secret: "s3cret", status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := &Dispatcher{client: srv.Client()}
+	status, _, err := d.Send(context.Background(), db.WebhookDelivery{Payload: `{}`, URL: srv.URL, Secret: "s3cret"})
+
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	sig := Sign("key", 100, []byte(`{"a":1}`))
+	assert.True(t, Verify("key", 100, []byte(`{"a":1}`), sig))
+	assert.False(t, Verify("key", 100, []byte(`{"a":2}`), sig))
+	assert.False(t, Verify("key", 101, []byte(`{"a":1}`), sig))
+	assert.False(t, Verify("other", 100, []byte(`{"a":1}`), sig))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(1))
+	assert.Equal(t, time.Minute, Backoff(2))
+	assert.Equal(t, 4*time.Minute, Backoff(4))
+	assert.Equal(t, 6*time.Hour, Backoff(20))
+}
+
+func TestCheckURLRejectsInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	for _, u := range []string{
+		"http://127.0.0.1:5432",
+		"http://localhost:1235/documents/w1_n1",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.7/hook",
+		"http://192.168.1.1/",
+		"http://100.100.100.200/",
+		"http://0.0.0.0:8060/",
+		"http://[::1]/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://[fe80::1]/",
+	} {
+		assert.ErrorIs(t, CheckURL(ctx, u), ErrForbiddenAddress, u)
+	}
+	assert.Error(t, CheckURL(ctx, "ftp://example.com/"))
+	assert.Error(t, CheckURL(ctx, "/relative"))
+	assert.NoError(t, CheckURL(ctx, "https://93.184.215.14/hook"))
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	assert.NoError(t, CheckURL(ctx, "http://10.0.0.7/hook"))
+}
+
+func TestDeliveriesRefuseInternalAddresses(t *testing.T) {
+	// A name that resolved to a public address when the webhook was saved
+	// can point at the backend's own network by the time it is delivered
+	recv := &receiver{secret: "s3cret", status: http.StatusOK}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	delivery := db.WebhookDelivery{Payload: `{}`, URL: srv.URL, Secret: "s3cret"}
+
+	d := &Dispatcher{client: newClient()}
+	_, _, err := d.Send(context.Background(), delivery)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Empty(t, recv.received)
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	status, _, err := d.Send(context.Background(), delivery)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+}
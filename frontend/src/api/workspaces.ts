@@ -180,6 +180,40 @@ export async function getNote(workspaceId: number, noteId: number): Promise<Note
   return response.data;
 }
 
+// ============================================================================
+// ATTACHMENT ENDPOINTS
+// ============================================================================
+
+export interface Attachment {
+  id: number;
+  note_id: number;
+  filename: string;
+  mime_type: string;
+  size: number;
+  hash: string;
+  width: number | null; // pixels, for JPEG and PNG images
+  height: number | null;
+  created_by: number | null;
+  created_at: string;
+  url: string; // loads without a login, for use in note content
+  widths: number[]; // thumbnails the url's &w= can select
+}
+
+export async function uploadAttachment(
+  workspaceId: number,
+  noteId: number,
+  file: File
+): Promise<Attachment> {
+  const form = new FormData();
+  form.append('file', file);
+  const response = await apiClient.post<Attachment>(
+    `/workspaces/${workspaceId}/notes/${noteId}/attachments`,
+    form,
+    { headers: { 'Content-Type': 'multipart/form-data' }, timeout: 0 }
+  );
+  return response.data;
+}
+
 // ============================================================================
 // TRASH ENDPOINTS
 // ============================================================================
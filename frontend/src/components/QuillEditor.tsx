@@ -7,7 +7,7 @@ import QuillCursors from 'quill-cursors';
 import QuillTableBetter from 'quill-table-better';
 import useWorkspaceStore from '../store/workspaceStore';
 import useAuthStore from '../store/authStore';
-import { getNote, updateNoteSearchText } from '../api/workspaces';
+import { getNote, updateNoteSearchText, uploadAttachment } from '../api/workspaces';
 import 'quill/dist/quill.snow.css';
 import 'quill-table-better/dist/quill-table-better.css';
 import 'katex/dist/katex.min.css';
@@ -21,6 +21,9 @@ Quill.register({
   'modules/table-better': QuillTableBetter
 }, true);
 
+// Width in pixels of the image thumbnails embedded in notes
+const EDITOR_IMAGE_WIDTH = 1280;
+
 function QuillEditor() {
   const containerRef = useRef<HTMLDivElement>(null);
   const quillRef = useRef<Quill | null>(null);
@@ -103,10 +106,36 @@ function QuillEditor() {
       `;
     }
     
+    // Pasted, dropped and picked images are uploaded as attachments of the
+    // open note, so the document holds their URL instead of base64 data.
+    // Photos are shown through a thumbnail about as wide as the editor.
+    const uploadImages = async (range: { index: number; length: number }, files: File[]) => {
+      const quill = quillRef.current;
+      const { selectedWorkspaceId: workspaceId, selectedNoteId: noteId } = useWorkspaceStore.getState();
+      if (!quill || workspaceId === null || noteId === null) return;
+      let index = range.index;
+      quill.deleteText(index, range.length, 'user');
+      for (const file of files) {
+        try {
+          const attachment = await uploadAttachment(workspaceId, noteId, file);
+          const src = attachment.widths.length > 0 ? `${attachment.url}&w=${EDITOR_IMAGE_WIDTH}` : attachment.url;
+          quill.insertEmbed(index, 'image', src, 'user');
+          index += 1;
+        } catch (err: any) {
+          alert(err.response?.data?.error || `Failed to upload ${file.name}`);
+        }
+      }
+      quill.setSelection(index, 0, 'silent');
+    };
+
     quillRef.current = new Quill(containerRef.current, {
       theme: 'snow',
       modules: {
         toolbar: '#toolbar-container',
+        uploader: {
+          mimetypes: ['image/png', 'image/jpeg', 'image/gif', 'image/webp'],
+          handler: uploadImages,
+        },
         cursors: true,
         history: {
           userOnly: true
@@ -153,6 +182,17 @@ function QuillEditor() {
       });
     }
 
+    // Links to other notes (#note-<id>, as written by imports) open the note
+    // here instead of a new tab; this covers the link tooltip's preview too
+    containerRef.current.addEventListener('click', (e) => {
+      const link = (e.target as HTMLElement).closest('a[href^="#note-"]');
+      if (!link) return;
+      const noteId = parseInt(link.getAttribute('href')!.slice('#note-'.length), 10);
+      if (!noteId) return;
+      e.preventDefault();
+      useWorkspaceStore.getState().setSelectedNote(noteId);
+    });
+
     return () => {
       console.log('[QuillEditor] Unmounting - destroying Quill');
       quillRef.current = null;
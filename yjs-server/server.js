@@ -1,23 +1,19 @@
 const { Server } = require('@hocuspocus/server');
 const { Database } = require('@hocuspocus/extension-database');
-const { Pool } = require('pg');
+const { createStorage } = require('./storage');
 const { validateToken } = require('./auth');
 const { createDefaultIntroDocument } = require('./createDefaultContent');
 const express = require('express');
+const Delta = require('quill-delta');
+const Y = require('yjs');
 
 const PORT = process.env.YJS_WS_PORT || 1234;
 const HTTP_PORT = process.env.YJS_HTTP_PORT || 1235;
 
-// PostgreSQL connection pool
-const pool = new Pool({
-  host: process.env.DB_HOST || 'db',
-  port: process.env.DB_PORT || 5432,
-  user: process.env.DB_USER || 'notes',
-  password: process.env.DB_PASSWORD || 'notespass',
-  database: process.env.DB_NAME || 'notesdb'
-});
+// notes.content in the backend's database (PostgreSQL or SQLite)
+const storage = createStorage();
 
-console.log('[YJS] Initializing Hocuspocus with PostgreSQL persistence');
+console.log(`[YJS] Initializing Hocuspocus with ${storage.name} persistence`);
 
 // Create Hocuspocus server
 const server = Server.configure({
@@ -38,13 +34,9 @@ const server = Server.configure({
         const noteId = parseInt(match[2], 10);
         
         try {
-          const result = await pool.query(
-            'SELECT content FROM notes WHERE id = $1',
-            [noteId]
-          );
+          const content = await storage.load(noteId);
           
-          if (result.rows.length > 0 && result.rows[0].content) {
-            const content = result.rows[0].content;
+          if (content) {
             console.log(`[YJS] Loaded ${content.length} bytes for ${documentName}`);
             return content;
           }
@@ -71,10 +63,7 @@ const server = Server.configure({
         const noteId = parseInt(match[2], 10);
         
         try {
-          await pool.query(
-            'UPDATE notes SET content = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
-            [Buffer.from(state), noteId]
-          );
+          await storage.save(noteId, Buffer.from(state));
           
           console.log(`[YJS] Saved ${state.length} bytes for ${documentName}`);
           
@@ -137,7 +126,7 @@ console.log(`[YJS] Hocuspocus server listening on port ${PORT}`);
 
 // Create Express HTTP server for initialization endpoint
 const app = express();
-app.use(express.json());
+app.use(express.json({ limit: '20mb' }));
 
 /**
  * POST /initialize-document
@@ -166,10 +155,7 @@ app.post('/initialize-document', async (req, res) => {
     const defaultContent = createDefaultIntroDocument();
     
     // Store in database
-    await pool.query(
-      'UPDATE notes SET content = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
-      [Buffer.from(defaultContent), noteId]
-    );
+    await storage.save(noteId, Buffer.from(defaultContent));
     
     console.log(`[YJS] Successfully initialized ${defaultContent.length} bytes for ${room_id}`);
     res.json({ success: true, message: 'Document initialized' });
@@ -180,6 +166,137 @@ app.post('/initialize-document', async (req, res) => {
   }
 });
 
+const ROOM_PATTERN = /^w\d+_n\d+$/;
+
+/**
+ * GET /documents/:room/delta
+ * Returns the note content as a Quill Delta, loading the document from the
+ * database when no editor has it open
+ */
+app.get('/documents/:room/delta', async (req, res) => {
+  const { room } = req.params;
+  if (!ROOM_PATTERN.test(room)) {
+    return res.status(400).json({ error: 'Invalid room_id format' });
+  }
+
+  let connection;
+  try {
+    connection = await server.openDirectConnection(room, {});
+    res.json({ ops: connection.document.getText('quill').toDelta() });
+  } catch (error) {
+    console.error(`[YJS] Error reading ${room}:`, error);
+    res.status(500).json({ error: 'Failed to read document' });
+  } finally {
+    if (connection) await connection.disconnect();
+  }
+});
+
+/**
+ * PUT /documents/:room/delta
+ * Replaces the note content with the given Quill Delta. Only the difference
+ * is applied, so open editors receive it as a normal collaborative change.
+ * Body: { "ops": [...] }
+ */
+app.put('/documents/:room/delta', async (req, res) => {
+  const { room } = req.params;
+  const { ops } = req.body;
+  if (!ROOM_PATTERN.test(room)) {
+    return res.status(400).json({ error: 'Invalid room_id format' });
+  }
+  if (!Array.isArray(ops)) {
+    return res.status(400).json({ error: 'ops array required' });
+  }
+
+  let connection;
+  try {
+    connection = await server.openDirectConnection(room, {});
+    await connection.transact((doc) => {
+      const ytext = doc.getText('quill');
+      const change = new Delta(ytext.toDelta()).diff(new Delta(ops));
+      ytext.applyDelta(change.ops);
+    });
+    console.log(`[YJS] Applied content update to ${room}`);
+    res.json({ success: true });
+  } catch (error) {
+    console.error(`[YJS] Error updating ${room}:`, error);
+    res.status(500).json({ error: 'Failed to update document' });
+  } finally {
+    if (connection) await connection.disconnect();
+  }
+});
+
+/**
+ * GET /documents/:room/state
+ * Returns the whole Yjs document as a binary update, as used by workspace
+ * exports
+ */
+app.get('/documents/:room/state', async (req, res) => {
+  const { room } = req.params;
+  if (!ROOM_PATTERN.test(room)) {
+    return res.status(400).json({ error: 'Invalid room_id format' });
+  }
+
+  let connection;
+  try {
+    connection = await server.openDirectConnection(room, {});
+    const state = Y.encodeStateAsUpdate(connection.document);
+    res.type('application/octet-stream').send(Buffer.from(state));
+  } catch (error) {
+    console.error(`[YJS] Error encoding ${room}:`, error);
+    res.status(500).json({ error: 'Failed to read document' });
+  } finally {
+    if (connection) await connection.disconnect();
+  }
+});
+
+/**
+ * POST /documents/encode
+ * Builds a Yjs document holding the given Quill Delta, as the editor's
+ * binding would, and returns it as a binary update without storing it.
+ * Imports write the result straight into a new note.
+ * Body: { "ops": [...] }
+ */
+app.post('/documents/encode', (req, res) => {
+  const { ops } = req.body;
+  if (!Array.isArray(ops)) {
+    return res.status(400).json({ error: 'ops array required' });
+  }
+
+  try {
+    const doc = new Y.Doc();
+    doc.getText('quill').applyDelta(ops);
+    res.type('application/octet-stream').send(Buffer.from(Y.encodeStateAsUpdate(doc)));
+    doc.destroy();
+  } catch (error) {
+    console.error('[YJS] Error encoding delta:', error);
+    res.status(500).json({ error: 'Failed to encode document' });
+  }
+});
+
+/**
+ * POST /documents/decode
+ * Returns the content of a binary Yjs update as a Quill Delta without
+ * storing anything. Imports use it to rewrite the attachment URLs of
+ * exported notes.
+ * Body: the update (application/octet-stream)
+ */
+app.post('/documents/decode', express.raw({ type: 'application/octet-stream', limit: '256mb' }), (req, res) => {
+  if (!Buffer.isBuffer(req.body) || req.body.length === 0) {
+    return res.status(400).json({ error: 'Yjs update required' });
+  }
+
+  const doc = new Y.Doc();
+  try {
+    Y.applyUpdate(doc, new Uint8Array(req.body));
+    res.json({ ops: doc.getText('quill').toDelta() });
+  } catch (error) {
+    console.error('[YJS] Error decoding update:', error);
+    res.status(400).json({ error: 'Invalid Yjs update' });
+  } finally {
+    doc.destroy();
+  }
+});
+
 // Health check endpoint
 app.get('/health', (req, res) => {
   res.json({ status: 'ok', service: 'yjs-server' });
@@ -193,7 +310,7 @@ app.listen(HTTP_PORT, () => {
 process.on('SIGTERM', async () => {
   console.log('[YJS] SIGTERM received, closing servers...');
   await server.destroy();
-  await pool.end();
+  await storage.close();
   console.log('[YJS] Servers closed');
   process.exit(0);
 });
@@ -201,7 +318,7 @@ process.on('SIGTERM', async () => {
 process.on('SIGINT', async () => {
   console.log('[YJS] SIGINT received, closing servers...');
   await server.destroy();
-  await pool.end();
+  await storage.close();
   console.log('[YJS] Servers closed');
   process.exit(0);
 });
@@ -0,0 +1,82 @@
+/**
+ * Document persistence shared with the Go backend: the Yjs state of each
+ * note lives in notes.content, keyed by note ID. DB_DRIVER selects
+ * PostgreSQL (default) or the SQLite file at DB_PATH.
+ */
+
+// SQLite timestamps are ISO 8601 UTC text, as written by the backend's migrations
+const SQLITE_NOW = "strftime('%Y-%m-%dT%H:%M:%fZ', 'now')";
+
+function createPostgresStorage() {
+  const { Pool } = require('pg');
+  const pool = new Pool({
+    host: process.env.DB_HOST || 'db',
+    port: process.env.DB_PORT || 5432,
+    user: process.env.DB_USER || 'notes',
+    password: process.env.DB_PASSWORD || 'notespass',
+    database: process.env.DB_NAME || 'notesdb'
+  });
+
+  return {
+    name: 'PostgreSQL',
+    async load(noteId) {
+      const result = await pool.query('SELECT content FROM notes WHERE id = $1', [noteId]);
+      return result.rows.length > 0 ? result.rows[0].content : null;
+    },
+    async save(noteId, content) {
+      await pool.query(
+        'UPDATE notes SET content = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2',
+        [content, noteId]
+      );
+    },
+    async close() {
+      await pool.end();
+    }
+  };
+}
+
+function createSQLiteStorage() {
+  // Loaded only here so PostgreSQL deployments do not need the native module
+  const Database = require('better-sqlite3');
+  const db = new Database(process.env.DB_PATH || './data/notes.db');
+  db.pragma('journal_mode = WAL');
+  db.pragma('busy_timeout = 5000');
+
+  // Prepared on first use: the backend may not have created the schema yet
+  let statements;
+  const prepared = () => {
+    statements = statements || {
+      select: db.prepare('SELECT content FROM notes WHERE id = ?'),
+      update: db.prepare(`UPDATE notes SET content = ?, updated_at = ${SQLITE_NOW} WHERE id = ?`)
+    };
+    return statements;
+  };
+
+  return {
+    name: 'SQLite',
+    async load(noteId) {
+      const row = prepared().select.get(noteId);
+      return row ? row.content : null;
+    },
+    async save(noteId, content) {
+      prepared().update.run(content, noteId);
+    },
+    async close() {
+      db.close();
+    }
+  };
+}
+
+function createStorage() {
+  const driver = process.env.DB_DRIVER || 'postgres';
+  switch (driver) {
+    case 'postgres':
+      return createPostgresStorage();
+    case 'sqlite':
+      return createSQLiteStorage();
+    default:
+      throw new Error(`Unknown DB_DRIVER "${driver}" (want postgres or sqlite)`);
+  }
+}
+
+module.exports = { createStorage };